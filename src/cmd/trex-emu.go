@@ -21,6 +21,10 @@ import (
 	"emu/plugins/igmp"
 	"emu/plugins/ipfix"
 	"emu/plugins/ipv6"
+	"emu/plugins/lacp"
+	"emu/plugins/mcsource"
+	"emu/plugins/pairflow"
+	"emu/plugins/profile"
 	"emu/plugins/transport"
 	"emu/plugins/transport_example"
 )
@@ -34,10 +38,14 @@ func RegisterPlugins(tctx *core.CThreadCtx) {
 	icmp.Register(tctx)
 	igmp.Register(tctx)
 	ipv6.Register(tctx)
+	mcsource.Register(tctx)
 	dhcp.Register(tctx)
 	dhcpv6.Register(tctx)
 	dot1x.Register(tctx)
+	lacp.Register(tctx)
 	ipfix.Register(tctx)
+	pairflow.Register(tctx)
+	profile.Register(tctx)
 	transport.Register(tctx)
 	transport_example.Register(tctx)
 }
@@ -55,7 +63,11 @@ type MainArgs struct {
 	zmqServer  *string
 	version    *bool
 	duration   time.Duration
-	emuTCPoZMQ *bool // use TCP over ZMQ instead of the classic IPC
+	emuTCPoZMQ *bool   // use TCP over ZMQ instead of the classic IPC
+	rpcToken   *string // shared token required in each RPC request, empty disables it
+	rpcRate    *int    // RPC requests per second, zero disables the limit
+	rpcBurst   *int    // RPC requests burst, zero is one second of rpcRate
+	rpcQueue   *int    // answer busy if this many requests wait for the main loop, zero is the default
 }
 
 func parseMainArgs() *MainArgs {
@@ -74,6 +86,10 @@ func parseMainArgs() *MainArgs {
 	args.dummyVeth = parser.Flag("d", "dummy-veth", &argparse.Options{Default: false, Help: "Run server with a dummy veth, all packets to rx will be dropped"})
 	args.version = parser.Flag("V", "version", &argparse.Options{Default: false, Help: "Show TRex-emu version"})
 	args.emuTCPoZMQ = parser.Flag("", "emu-zmq-tcp", &argparse.Options{Default: false, Help: "Run TCP over ZMQ. Default is IPC"})
+	args.rpcToken = parser.String("", "rpc-token", &argparse.Options{Default: "", Help: "Shared token required in the auth_token param of each RPC request. Default is no authentication"})
+	args.rpcRate = parser.Int("", "rpc-rate", &argparse.Options{Default: 0, Help: "RPC requests per second, over the rate the requests are answered busy. Default is no limit"})
+	args.rpcBurst = parser.Int("", "rpc-burst", &argparse.Options{Default: 0, Help: "RPC requests burst over the rpc-rate. Default is one second of rpc-rate"})
+	args.rpcQueue = parser.Int("", "rpc-queue", &argparse.Options{Default: 0, Help: "Answer busy if this many RPC requests wait for the main loop. Default is 64"})
 
 	err := parser.Parse(os.Args)
 	if err != nil {
@@ -119,6 +135,8 @@ func RunCoreZmq(args *MainArgs) {
 	RegisterPlugins(tctx)
 
 	tctx.SetVerbose(*args.verbose)
+	tctx.SetRpcAuthToken(*args.rpcToken)
+	tctx.SetRpcLimit(uint32(*args.rpcRate), uint32(*args.rpcBurst), uint32(*args.rpcQueue))
 	tctx.Veth.SetDebug(*args.monitor, *args.capture)
 	tctx.StartRxThread()
 	defer tctx.Delete()
@@ -0,0 +1,347 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"fmt"
+	"net"
+	"sort"
+)
+
+const (
+	/* kind of an owned address */
+	ADDR_OWNER_MAC    = "mac"
+	ADDR_OWNER_IPV4   = "ipv4"
+	ADDR_OWNER_IPV6   = "ipv6"   // static ipv6 of the client
+	ADDR_OWNER_DHCPV6 = "dhcpv6" // ipv6 leased by DHCPv6
+)
+
+// CAddrOwnerStats the counters of the address ownership registry of a namespace
+type CAddrOwnerStats struct {
+	lookupMac     uint64
+	lookupIpv4    uint64
+	lookupIpv6    uint64
+	lookupMiss    uint64 // the address is not owned by any client
+	errConflict   uint64 // add/renumber to an address of another client
+	errNotOwner   uint64 // remove/renumber of an address the client does not own
+	renumberIpv4  uint64
+	renumberIpv6  uint64
+	activeAddress uint64
+}
+
+func newAddrOwnerStatsDb(o *CAddrOwnerStats) *CCounterDb {
+	db := NewCCounterDb("addr")
+	db.Add(&CCounterRec{
+		Counter:  &o.lookupMac,
+		Name:     "lookupMac",
+		Help:     "lookups of the owner of a MAC",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.lookupIpv4,
+		Name:     "lookupIpv4",
+		Help:     "lookups of the owner of an ipv4",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.lookupIpv6,
+		Name:     "lookupIpv6",
+		Help:     "lookups of the owner of an ipv6",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.lookupMiss,
+		Name:     "lookupMiss",
+		Help:     "lookups of an address without an owner",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.errConflict,
+		Name:     "errConflict",
+		Help:     "address is owned by another client",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScERROR})
+	db.Add(&CCounterRec{
+		Counter:  &o.errNotOwner,
+		Name:     "errNotOwner",
+		Help:     "address is not owned by the client",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScERROR})
+	db.Add(&CCounterRec{
+		Counter:  &o.renumberIpv4,
+		Name:     "renumberIpv4",
+		Help:     "ipv4 address changes",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.renumberIpv6,
+		Name:     "renumberIpv6",
+		Help:     "ipv6 address changes",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.activeAddress,
+		Name:     "activeAddress",
+		Help:     "owned addresses",
+		Unit:     "",
+		DumpZero: false,
+		Info:     ScINFO})
+	return db
+}
+
+// CAddrOwnerRec an address and the client that owns it, see ctx_get_addr_owners
+type CAddrOwnerRec struct {
+	Kind  string `json:"kind"`
+	Addr  string `json:"addr"`
+	Owner MACKey `json:"owner"`
+}
+
+// CAddrOwner maps the MAC, IPv4 and IPv6 addresses of a namespace to the client that owns them.
+// It is the only place the ownership is kept, the plugins ask the namespace (CLookupBy*) and the
+// client (OwnsIPv4/OwnsIPv6) instead of tracking the addresses by themselves. A change is
+// validated before it is applied, an error leaves the registry and the client as they were.
+type CAddrOwner struct {
+	mapIpv6 MapClientIPv6
+	mapIpv4 MapClientIPv4
+	mapMAC  MapClientMAC
+	stats   CAddrOwnerStats
+	cdbv    *CCounterDbVec
+}
+
+func newAddrOwner() *CAddrOwner {
+	o := new(CAddrOwner)
+	o.mapIpv6 = make(MapClientIPv6)
+	o.mapIpv4 = make(MapClientIPv4)
+	o.mapMAC = make(MapClientMAC)
+	o.cdbv = NewCCounterDbVec("addr")
+	o.cdbv.Add(newAddrOwnerStatsDb(&o.stats))
+	return o
+}
+
+func (o *CAddrOwner) miss(c *CClient) *CClient {
+	if c == nil {
+		o.stats.lookupMiss++
+	}
+	return c
+}
+
+// LookupMac returns the client with the MAC, nil if there is none
+func (o *CAddrOwner) LookupMac(mac *MACKey) *CClient {
+	o.stats.lookupMac++
+	if mac.IsZero() {
+		return o.miss(nil)
+	}
+	return o.miss(o.mapMAC[*mac])
+}
+
+// LookupIpv4 returns the owner of the ipv4, nil if there is none
+func (o *CAddrOwner) LookupIpv4(ipv4 *Ipv4Key) *CClient {
+	o.stats.lookupIpv4++
+	if ipv4.IsZero() {
+		return o.miss(nil)
+	}
+	return o.miss(o.mapIpv4[*ipv4])
+}
+
+// LookupIpv6 returns the owner of the static or DHCPv6 ipv6, nil if there is none
+func (o *CAddrOwner) LookupIpv6(ipv6 *Ipv6Key) *CClient {
+	o.stats.lookupIpv6++
+	if ipv6.IsZero() {
+		return o.miss(nil)
+	}
+	return o.miss(o.mapIpv6[*ipv6])
+}
+
+func (o *CAddrOwner) conflict(format string, a ...interface{}) error {
+	o.stats.errConflict++
+	return fmt.Errorf(format, a...)
+}
+
+// Add adds all the addresses of a new client
+func (o *CAddrOwner) Add(client *CClient) error {
+	if client.Mac.IsZero() {
+		return fmt.Errorf(" Adding client with invalid zero MAC (zero)")
+	}
+	if _, ok := o.mapMAC[client.Mac]; ok {
+		return o.conflict(" client with the same MAC %v already exist", client.Mac)
+	}
+	if !client.Ipv4.IsZero() {
+		if _, ok := o.mapIpv4[client.Ipv4]; ok {
+			return o.conflict(" client with the same IPv4 %v already exist", client.Ipv4)
+		}
+	}
+	for _, ipv6 := range []Ipv6Key{client.Ipv6, client.Dhcpv6} {
+		if ipv6.IsZero() {
+			continue
+		}
+		if _, ok := o.mapIpv6[ipv6]; ok {
+			return o.conflict(" client with the same IPv6 %v already exist", ipv6)
+		}
+	}
+
+	o.mapMAC[client.Mac] = client
+	o.stats.activeAddress++
+	if !client.Ipv4.IsZero() {
+		o.mapIpv4[client.Ipv4] = client
+		o.stats.activeAddress++
+	}
+	for _, ipv6 := range []Ipv6Key{client.Ipv6, client.Dhcpv6} {
+		if !ipv6.IsZero() && o.mapIpv6[ipv6] == nil {
+			o.mapIpv6[ipv6] = client
+			o.stats.activeAddress++
+		}
+	}
+	return nil
+}
+
+func (o *CAddrOwner) removed(ok bool) bool {
+	if ok {
+		o.stats.activeAddress--
+	} else {
+		o.stats.errNotOwner++
+	}
+	return ok
+}
+
+// RemoveMac removes the MAC of the client, false in case the client does not own it
+func (o *CAddrOwner) RemoveMac(client *CClient) bool {
+	ok := o.mapMAC[client.Mac] == client
+	if ok {
+		delete(o.mapMAC, client.Mac)
+	}
+	return o.removed(ok)
+}
+
+// RemoveIpv4 removes the ipv4 of the client, false in case the client does not own it
+func (o *CAddrOwner) RemoveIpv4(client *CClient) bool {
+	ok := o.mapIpv4[client.Ipv4] == client
+	if ok {
+		delete(o.mapIpv4, client.Ipv4)
+	}
+	return o.removed(ok)
+}
+
+// RemoveIpv6 removes an ipv6 of the client, the static and the DHCPv6 addresses may be the same
+// and it is kept while the other one holds it. false in case the client does not own it.
+func (o *CAddrOwner) RemoveIpv6(client *CClient, ipv6, other Ipv6Key) bool {
+	ok := o.mapIpv6[ipv6] == client
+	if !ok {
+		return o.removed(false)
+	}
+	if ipv6 != other {
+		delete(o.mapIpv6, ipv6)
+		o.removed(true)
+	}
+	return true
+}
+
+// RenumberIpv4 moves the client from the old to the new ipv4, zero is no address
+func (o *CAddrOwner) RenumberIpv4(client *CClient, old, new Ipv4Key) error {
+	if !old.IsZero() && o.mapIpv4[old] != client {
+		o.stats.errNotOwner++
+		return fmt.Errorf(" Somthing is wrong, couldn't find self ipv4 %v ", old)
+	}
+	if !new.IsZero() {
+		if _, ok := o.mapIpv4[new]; ok {
+			return o.conflict(" Somthing is wrong, couldn't update client with new ipv4 %v ", new)
+		}
+	}
+	if !old.IsZero() {
+		delete(o.mapIpv4, old)
+		o.stats.activeAddress--
+	}
+	if !new.IsZero() {
+		o.mapIpv4[new] = client
+		o.stats.activeAddress++
+	}
+	o.stats.renumberIpv4++
+	return nil
+}
+
+// RenumberIpv6 moves the client from the old to the new ipv6, other is the second ipv6 of the
+// client (static/DHCPv6) that may share the entry
+func (o *CAddrOwner) RenumberIpv6(client *CClient, old, new, other Ipv6Key) error {
+	if !old.IsZero() && o.mapIpv6[old] != client {
+		o.stats.errNotOwner++
+		return fmt.Errorf(" Somthing is wrong, couldn't find self ipv6 %v ", old)
+	}
+	if !new.IsZero() && new != other {
+		if _, ok := o.mapIpv6[new]; ok {
+			return o.conflict(" Somthing is wrong, couldn't update client with new ipv6 %v ", new)
+		}
+	}
+	if !old.IsZero() && old != other {
+		delete(o.mapIpv6, old)
+		o.stats.activeAddress--
+	}
+	if !new.IsZero() && new != other {
+		o.mapIpv6[new] = client
+		o.stats.activeAddress++
+	}
+	o.stats.renumberIpv6++
+	return nil
+}
+
+var addrOwnerKindOrder = map[string]int{ADDR_OWNER_MAC: 0, ADDR_OWNER_IPV4: 1, ADDR_OWNER_IPV6: 2, ADDR_OWNER_DHCPV6: 3}
+
+// GetOwners returns the owned addresses of the kind, all the kinds in case kind is empty,
+// ordered by kind and address.
+func (o *CAddrOwner) GetOwners(kind string) ([]CAddrOwnerRec, error) {
+	r := []CAddrOwnerRec{}
+	switch kind {
+	case "", ADDR_OWNER_MAC, ADDR_OWNER_IPV4, ADDR_OWNER_IPV6, ADDR_OWNER_DHCPV6:
+	default:
+		return nil, fmt.Errorf("invalid address kind %q", kind)
+	}
+	if kind == "" || kind == ADDR_OWNER_MAC {
+		for k, c := range o.mapMAC {
+			r = append(r, CAddrOwnerRec{Kind: ADDR_OWNER_MAC, Addr: net.HardwareAddr(k[:]).String(), Owner: c.Mac})
+		}
+	}
+	if kind == "" || kind == ADDR_OWNER_IPV4 {
+		for k, c := range o.mapIpv4 {
+			r = append(r, CAddrOwnerRec{Kind: ADDR_OWNER_IPV4, Addr: k.ToIP().String(), Owner: c.Mac})
+		}
+	}
+	for k, c := range o.mapIpv6 {
+		for _, kd := range o.ipv6Kinds(k, c) {
+			if kind == "" || kind == kd {
+				r = append(r, CAddrOwnerRec{Kind: kd, Addr: k.ToIP().String(), Owner: c.Mac})
+			}
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		if r[i].Kind != r[j].Kind {
+			return addrOwnerKindOrder[r[i].Kind] < addrOwnerKindOrder[r[j].Kind]
+		}
+		return r[i].Addr < r[j].Addr
+	})
+	return r, nil
+}
+
+func (o *CAddrOwner) ipv6Kinds(k Ipv6Key, c *CClient) []string {
+	var r []string
+	if k == c.Ipv6 {
+		r = append(r, ADDR_OWNER_IPV6)
+	}
+	if k == c.Dhcpv6 {
+		r = append(r, ADDR_OWNER_DHCPV6)
+	}
+	return r
+}
+
+// GetCdbv returns the counters of the registry
+func (o *CAddrOwner) GetCdbv() *CCounterDbVec {
+	return o.cdbv
+}
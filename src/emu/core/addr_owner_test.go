@@ -0,0 +1,66 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+)
+
+func TestAddrOwner1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+
+	ipv6 := Ipv6Key{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
+	c1 := NewClient(ns, MACKey{0, 0, 1, 0, 0, 1}, Ipv4Key{16, 0, 0, 1}, ipv6, Ipv4Key{})
+	c2 := NewClient(ns, MACKey{0, 0, 1, 0, 0, 2}, Ipv4Key{16, 0, 0, 2}, Ipv6Key{}, Ipv4Key{})
+	c3 := NewClient(ns, MACKey{0, 0, 1, 0, 0, 3}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{})
+	if ns.AddClient(c1) != nil || ns.AddClient(c2) != nil {
+		t.Fatalf(" can't add clients \n")
+	}
+	// the ipv4 is owned by c1, c3 is not added at all
+	if ns.AddClient(c3) == nil || ns.CLookupByMac(&c3.Mac) != nil {
+		t.Fatalf(" client with an owned ipv4 was added \n")
+	}
+
+	// renumber to an owned address fails and keeps the old one
+	if c2.UpdateIPv4(Ipv4Key{16, 0, 0, 1}) == nil {
+		t.Fatalf(" renumber to an owned ipv4 \n")
+	}
+	if c2.Ipv4 != (Ipv4Key{16, 0, 0, 2}) || !c2.OwnsIPv4(Ipv4Key{16, 0, 0, 2}) || !c1.OwnsIPv4(Ipv4Key{16, 0, 0, 1}) {
+		t.Fatalf(" failed renumber changed the ownership \n")
+	}
+	if c2.UpdateIPv4(Ipv4Key{16, 0, 0, 3}) != nil || ns.CLookupByIPv4(&Ipv4Key{16, 0, 0, 2}) != nil {
+		t.Fatalf(" renumber failed \n")
+	}
+
+	// the static and the DHCPv6 ipv6 are the same, the entry is kept while one of them holds it
+	if c1.UpdateDIPv6(ipv6) != nil {
+		t.Fatalf(" can't share the ipv6 \n")
+	}
+	if c1.UpdateIPv6(Ipv6Key{}) != nil || ns.CLookupByIPv6(&ipv6) != c1 {
+		t.Fatalf(" shared ipv6 was removed \n")
+	}
+
+	owners, _ := ns.GetAddrOwner().GetOwners("")
+	if len(owners) != 5 || owners[2].Addr != "16.0.0.1" || owners[4].Kind != ADDR_OWNER_DHCPV6 {
+		t.Fatalf(" bad owners %+v \n", owners)
+	}
+	if _, err := ns.GetAddrOwner().GetOwners("ipx"); err == nil {
+		t.Fatalf(" invalid kind \n")
+	}
+
+	if ns.RemoveClient(c1) != nil || ns.CLookupByIPv6(&ipv6) != nil || ns.CLookupByIPv4(&Ipv4Key{16, 0, 0, 1}) != nil {
+		t.Fatalf(" addresses of a removed client \n")
+	}
+	s := ns.GetAddrOwner().stats
+	if s.activeAddress != 2 || s.errConflict != 2 || s.renumberIpv4 != 1 || s.renumberIpv6 != 2 || s.errNotOwner != 0 {
+		t.Fatalf(" bad stats %+v \n", s)
+	}
+}
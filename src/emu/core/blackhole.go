@@ -0,0 +1,79 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+/* Blackhole of a client
+
+A client in blackhole continues to exist with all the state of its plugins (leases, authentication,
+caches) but it is dark, the frames it sends are dropped and the frames to its MAC are dropped before
+they are decoded. It models a hung or unreachable host, turning the blackhole off restores the client
+as it was without removing and adding it again. Broadcast and multicast frames are still delivered
+to the namespace, the answers of the client are dropped on tx.
+*/
+
+// SetBlackhole sets whether the client drops all its tx and rx frames
+func (o *CClient) SetBlackhole(enable bool) {
+	if o.blackhole == enable {
+		return
+	}
+	if enable {
+		o.Ns.ThreadCtx.bhClients++
+	} else {
+		o.Ns.ThreadCtx.bhClients--
+	}
+	o.blackhole = enable
+}
+
+// IsBlackhole returns true in case the client is in blackhole
+func (o *CClient) IsBlackhole() bool {
+	return o.blackhole
+}
+
+// lookupBlackhole returns the client of the namespace of the frame with the MAC at off in case it is
+// in blackhole
+func (o *CThreadCtx) lookupBlackhole(m *Mbuf, off int) (*CNSCtx, bool) {
+	p := m.GetData()
+	if len(p) < 14 {
+		return nil, false
+	}
+	var key CTunnelKey
+	frameTunnelKey(m, &key)
+	ns := o.GetNs(&key)
+	if ns == nil {
+		return nil, false
+	}
+	var mac MACKey
+	copy(mac[:], p[off:off+6])
+	c := ns.CLookupByMac(&mac)
+	return ns, c != nil && c.blackhole
+}
+
+// txBlackhole returns false in case the frame was sent by a client in blackhole and should be dropped,
+// the client is looked up only in case there is a client in blackhole
+func (o *CThreadCtx) txBlackhole(m *Mbuf) bool {
+	if o.bhClients == 0 {
+		return true
+	}
+	ns, drop := o.lookupBlackhole(m, 6)
+	if drop {
+		ns.stats.txBlackhole++
+		return false
+	}
+	return true
+}
+
+// rxBlackhole returns false in case the frame is to a client in blackhole and should be dropped
+func (o *CThreadCtx) rxBlackhole(m *Mbuf) bool {
+	if o.bhClients == 0 || !m.IsContiguous() {
+		return true
+	}
+	ns, drop := o.lookupBlackhole(m, 0)
+	if drop {
+		ns.stats.rxBlackhole++
+		return false
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+)
+
+func TestClientBlackhole1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+
+	mac := MACKey{0, 0, 1, 0, 0, 1}
+	client := NewClient(ns, mac, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 2})
+	ns.AddClient(client)
+
+	// an ARP frame from the client, the same frame with the MACs swapped is to the client
+	f := []byte{0, 0, 2, 0, 0, 0, 0, 0, 1, 0, 0, 1, 0x08, 0x06, 0, 1, 8, 0, 6, 4, 0, 1}
+	r := append([]byte{}, f[6:12]...)
+	r = append(r, f[0:6]...)
+	r = append(r, f[12:]...)
+	frame := func(d []byte) *Mbuf {
+		m := tctx.MPool.Alloc(128)
+		m.SetVPort(1)
+		m.Append(d)
+		return m
+	}
+	check := func(d []byte, tx bool) bool {
+		m := frame(d)
+		defer m.FreeMbuf()
+		if tx {
+			return tctx.txBlackhole(m)
+		}
+		return tctx.rxBlackhole(m)
+	}
+
+	if !check(f, true) || !check(r, false) {
+		t.Fatalf(" frames of a client should pass \n")
+	}
+
+	client.SetBlackhole(true)
+	client.SetBlackhole(true)
+	if tctx.bhClients != 1 || !client.GetInfo().Blackhole {
+		t.Fatalf(" client should be in blackhole \n")
+	}
+	if check(f, true) || check(r, false) || check(r, false) {
+		t.Fatalf(" frames of a client in blackhole should be dropped \n")
+	}
+	// frames of other clients
+	o := append([]byte{}, f...)
+	o[11] = 2
+	if !check(o, true) {
+		t.Fatalf(" frames of other clients should pass \n")
+	}
+	if ns.stats.txBlackhole != 1 || ns.stats.rxBlackhole != 2 {
+		t.Fatalf(" bad counters %+v \n", ns.stats)
+	}
+
+	client.SetBlackhole(false)
+	if tctx.bhClients != 0 || !check(f, true) || !check(r, false) {
+		t.Fatalf(" client should be restored \n")
+	}
+
+	client.SetBlackhole(true)
+	ns.RemoveClient(client)
+	if tctx.bhClients != 0 {
+		t.Fatalf(" removed client should not be counted \n")
+	}
+}
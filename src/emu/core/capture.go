@@ -0,0 +1,261 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import "fmt"
+
+/* Limits of the concurrent captures
+
+The captures of the thread are the rings of frames that are kept in memory: the received frames
+history (ctx_rx_history), the sample of the frames with a bad checksum (ctx_cs_verify) and the samples
+of the frames with a bad FCS of each namespace (ctx_set_rx_fcs). The memory of a capture is its worst
+case, the number of frames times the size of a jumbo frame. A trace to a file is registered by its max
+size with StartTrace and is limited by the disk bytes. With limits on the number of captures, on their
+memory and on the disk, a capture that exceeds them is rejected or the oldest captures are stopped to
+make room for it, by the policy. A rejected capture returns an error and MSG_CAPTURE_REJECT is sent to
+the thread plugins. Unlimited by default.
+*/
+
+const (
+	CAPTURE_POLICY_REJECT = "reject" // the new capture is rejected, default
+	CAPTURE_POLICY_EVICT  = "evict"  // the oldest captures are stopped
+
+	CAPTURE_FRAME_BYTES = 9216
+
+	CAPTURE_RX_HISTORY = "rx_history"
+	CAPTURE_CS_ERRORS  = "cs_errors"
+	CAPTURE_FCS_ERRORS = "fcs_errors" // followed by the tunnel of the namespace
+)
+
+// CCaptureLimits the limits of the concurrent captures, zero is unlimited
+type CCaptureLimits struct {
+	MaxCaptures  uint32 `json:"max_captures"`
+	MaxBytes     uint64 `json:"max_bytes"`
+	MaxDiskBytes uint64 `json:"max_disk_bytes"` // the traces to files
+	Policy       string `json:"policy"`         // see CAPTURE_POLICY_REJECT, empty is reject
+}
+
+func (o *CCaptureLimits) Validate() error {
+	switch o.Policy {
+	case "", CAPTURE_POLICY_REJECT, CAPTURE_POLICY_EVICT:
+		return nil
+	}
+	return fmt.Errorf("invalid capture policy '%s', should be %s or %s", o.Policy, CAPTURE_POLICY_REJECT, CAPTURE_POLICY_EVICT)
+}
+
+// CCaptureInfo a capture in progress, see ctx_get_captures
+type CCaptureInfo struct {
+	Name   string `json:"name"`
+	Frames uint32 `json:"frames"`         // the size of the ring, zero for a trace
+	Bytes  uint64 `json:"bytes"`          // worst case memory, the max size of a trace
+	Disk   bool   `json:"disk,omitempty"` // a trace to a file
+}
+
+// CCaptureInfoResult the captures in progress, oldest first
+type CCaptureInfoResult struct {
+	Limits    CCaptureLimits `json:"limits"`
+	Captures  []CCaptureInfo `json:"captures"`
+	Count     uint32         `json:"count"`
+	Bytes     uint64         `json:"bytes"`
+	DiskBytes uint64         `json:"disk_bytes"`
+	Started   uint64         `json:"started"`
+	Rejected  uint64         `json:"rejected"` // captures that were rejected by the limits
+	Evicted   uint64         `json:"evicted"`  // captures that were stopped to make room for a new one
+}
+
+type captureRec struct {
+	info CCaptureInfo
+	stop func() // stops the capture, by the evict policy
+}
+
+// CCaptureReject a capture that was rejected by the limits, argument of MSG_CAPTURE_REJECT
+type CCaptureReject struct {
+	Name  string
+	Bytes uint64
+	Err   error
+}
+
+// CCaptureReg the captures of the thread and their limits
+type CCaptureReg struct {
+	tctx      *CThreadCtx
+	limits    CCaptureLimits
+	caps      []*captureRec // oldest first
+	bytes     uint64
+	diskBytes uint64
+
+	started  uint64
+	rejected uint64
+	evicted  uint64
+}
+
+func (o *CCaptureReg) find(name string) int {
+	for i, c := range o.caps {
+		if c.info.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// used returns the bytes in use and their limit, of the memory or of the disk
+func (o *CCaptureReg) used(disk bool) (*uint64, uint64) {
+	if disk {
+		return &o.diskBytes, o.limits.MaxDiskBytes
+	}
+	return &o.bytes, o.limits.MaxBytes
+}
+
+func (o *CCaptureReg) remove(i int) {
+	used, _ := o.used(o.caps[i].info.Disk)
+	*used -= o.caps[i].info.Bytes
+	o.caps = append(o.caps[:i], o.caps[i+1:]...)
+}
+
+func (o *CCaptureReg) insert(i int, c *captureRec) {
+	used, _ := o.used(c.info.Disk)
+	*used += c.info.Bytes
+	o.caps = append(o.caps[:i], append([]*captureRec{c}, o.caps[i:]...)...)
+}
+
+func (o *CCaptureReg) exceedsCount() bool {
+	return o.limits.MaxCaptures > 0 && uint32(len(o.caps)) >= o.limits.MaxCaptures
+}
+
+func (o *CCaptureReg) exceeds(info *CCaptureInfo) bool {
+	used, limit := o.used(info.Disk)
+	return o.exceedsCount() || (limit > 0 && *used+info.Bytes > limit)
+}
+
+// oldest returns the oldest capture that makes room for info when it is stopped
+func (o *CCaptureReg) oldest(info *CCaptureInfo) int {
+	if !o.exceedsCount() {
+		for i, c := range o.caps {
+			if c.info.Disk == info.Disk {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+func (o *CCaptureReg) reject(info *CCaptureInfo, err error) error {
+	o.rejected++
+	if o.tctx != nil {
+		o.tctx.PluginCtx.BroadcastMsg(nil, MSG_CAPTURE_REJECT, &CCaptureReject{Name: info.Name, Bytes: info.Bytes, Err: err}, nil)
+	}
+	return err
+}
+
+// add registers a capture, a capture with the same name is replaced. It returns an error in case the
+// capture exceeds the limits and the policy is reject.
+func (o *CCaptureReg) add(info CCaptureInfo, stop func()) error {
+	i := o.find(info.Name)
+	var old *captureRec
+	if i >= 0 {
+		old = o.caps[i]
+		o.remove(i)
+	}
+	if info.Bytes == 0 {
+		return nil
+	}
+	// a rejected capture keeps the one it should have replaced
+	restore := func() {
+		if old != nil {
+			o.insert(i, old)
+		}
+	}
+	used, limit := o.used(info.Disk)
+	if limit > 0 && info.Bytes > limit {
+		restore()
+		return o.reject(&info, fmt.Errorf("capture %s of %d bytes is bigger than the limit of %d bytes", info.Name, info.Bytes, limit))
+	}
+	if o.exceeds(&info) && o.limits.Policy != CAPTURE_POLICY_EVICT {
+		restore()
+		return o.reject(&info, fmt.Errorf("capture %s is rejected, %d captures of %d bytes, the limits are %d captures of %d bytes",
+			info.Name, len(o.caps), *used, o.limits.MaxCaptures, limit))
+	}
+	for o.exceeds(&info) {
+		j := o.oldest(&info)
+		c := o.caps[j]
+		o.remove(j)
+		o.evicted++
+		c.stop()
+	}
+	o.insert(len(o.caps), &captureRec{info: info, stop: stop})
+	o.started++
+	return nil
+}
+
+// start registers a capture of frames in memory, see add
+func (o *CCaptureReg) start(name string, frames uint32, stop func()) error {
+	return o.add(CCaptureInfo{Name: name, Frames: frames, Bytes: uint64(frames) * CAPTURE_FRAME_BYTES}, stop)
+}
+
+// stop unregisters a capture that was stopped
+func (o *CCaptureReg) stop(name string) {
+	if i := o.find(name); i >= 0 {
+		o.remove(i)
+	}
+}
+
+// SetLimits sets the limits of the new captures, the captures in progress are kept
+func (o *CCaptureReg) SetLimits(limits *CCaptureLimits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	o.limits = *limits
+	return nil
+}
+
+// GetInfo returns the captures in progress and the limits
+func (o *CCaptureReg) GetInfo() *CCaptureInfoResult {
+	res := &CCaptureInfoResult{Limits: o.limits, Captures: make([]CCaptureInfo, 0, len(o.caps))}
+	for _, c := range o.caps {
+		res.Captures = append(res.Captures, c.info)
+	}
+	res.Count = uint32(len(o.caps))
+	res.Bytes = o.bytes
+	res.DiskBytes = o.diskBytes
+	res.Started = o.started
+	res.Rejected = o.rejected
+	res.Evicted = o.evicted
+	return res
+}
+
+// StartTrace registers a trace to a file of at most maxBytes, stop is called in case it is evicted.
+// It returns an error in case the trace exceeds the limits, zero maxBytes stops it.
+func (o *CThreadCtx) StartTrace(name string, maxBytes uint64, stop func()) error {
+	return o.captures.add(CCaptureInfo{Name: name, Bytes: maxBytes, Disk: true}, stop)
+}
+
+// StopTrace unregisters a trace that was stopped
+func (o *CThreadCtx) StopTrace(name string) {
+	o.captures.stop(name)
+}
+
+// SetRxHistory sets the number of received frames to keep, see CRxHistory
+func (o *CThreadCtx) SetRxHistory(size uint32) error {
+	if size > RX_HISTORY_MAX_SIZE {
+		return fmt.Errorf("rx history size %d is bigger than %d", size, RX_HISTORY_MAX_SIZE)
+	}
+	err := o.captures.start(CAPTURE_RX_HISTORY, size, func() { o.rxHistory.SetSize(0) })
+	if err != nil {
+		return err
+	}
+	return o.rxHistory.SetSize(size)
+}
+
+// SetCsErrSampler sets the sample of the frames with a bad checksum, see CCsErrSampler
+func (o *CThreadCtx) SetCsErrSampler(size, rate uint32) error {
+	if size > CS_ERR_MAX_SAMPLES {
+		return fmt.Errorf("checksum errors sample size %d is bigger than %d", size, CS_ERR_MAX_SAMPLES)
+	}
+	err := o.captures.start(CAPTURE_CS_ERRORS, size, func() { o.parser.csErrs.Set(0, 0) })
+	if err != nil {
+		return err
+	}
+	return o.parser.csErrs.Set(size, rate)
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+)
+
+func TestCaptureLimits1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+
+	if tctx.captures.SetLimits(&CCaptureLimits{Policy: "drop"}) == nil {
+		t.Fatalf(" invalid policy should fail \n")
+	}
+	tctx.captures.SetLimits(&CCaptureLimits{MaxCaptures: 2, MaxBytes: 100 * CAPTURE_FRAME_BYTES})
+
+	if tctx.SetRxHistory(10) != nil || tctx.SetCsErrSampler(20, 1) != nil {
+		t.Fatalf(" captures under the limits should start \n")
+	}
+	if tctx.SetRxHistory(101) == nil {
+		t.Fatalf(" capture bigger than the memory limit should be rejected \n")
+	}
+	if ns.SetRxFcs(true, 10, 1) == nil || ns.fcs != nil {
+		t.Fatalf(" third capture should be rejected \n")
+	}
+	info := tctx.captures.GetInfo()
+	if info.Count != 2 || info.Bytes != 30*CAPTURE_FRAME_BYTES || info.Rejected != 2 || info.Captures[0].Name != CAPTURE_RX_HISTORY {
+		t.Fatalf(" bad captures %+v \n", info)
+	}
+	// a rejected resize keeps the capture
+	if !tctx.rxHistory.IsEnabled() || len(tctx.rxHistory.frames) != 10 {
+		t.Fatalf(" rx history should be kept \n")
+	}
+
+	// evict the oldest, the rx history
+	tctx.captures.SetLimits(&CCaptureLimits{MaxCaptures: 2, Policy: CAPTURE_POLICY_EVICT})
+	if ns.SetRxFcs(true, 10, 1) != nil {
+		t.Fatalf(" capture should start by evicting the oldest \n")
+	}
+	info = tctx.captures.GetInfo()
+	if info.Count != 2 || info.Evicted != 1 || tctx.rxHistory.IsEnabled() || info.Captures[0].Name != CAPTURE_CS_ERRORS {
+		t.Fatalf(" bad captures after evict %+v \n", info)
+	}
+
+	// disabled captures are removed
+	tctx.SetCsErrSampler(0, 0)
+	ns.SetRxFcs(false, 0, 0)
+	if info = tctx.captures.GetInfo(); info.Count != 0 || info.Bytes != 0 {
+		t.Fatalf(" captures should be removed %+v \n", info)
+	}
+}
+
+type captureRejectPlug struct {
+	PluginBase
+	rejects []*CCaptureReject
+}
+
+func (o *captureRejectPlug) OnEvent(msg string, a, b interface{}) {
+	o.rejects = append(o.rejects, a.(*CCaptureReject))
+}
+
+func (o *captureRejectPlug) OnRemove(ctx *PluginCtx) {}
+
+// the traces are limited by the disk bytes, a rejected capture is sent to the thread plugins
+func TestCaptureLimitsTrace(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var plug captureRejectPlug
+	plug.InitPluginBase(tctx.PluginCtx, &plug)
+	plug.RegisterEvents(tctx.PluginCtx, []string{MSG_CAPTURE_REJECT}, &plug)
+
+	tctx.captures.SetLimits(&CCaptureLimits{MaxBytes: 10 * CAPTURE_FRAME_BYTES, MaxDiskBytes: 1000})
+	var stopped bool
+	if tctx.StartTrace("a", 600, func() { stopped = true }) != nil || tctx.SetRxHistory(10) != nil {
+		t.Fatalf(" trace and capture under the limits should start \n")
+	}
+	if tctx.StartTrace("b", 600, nil) == nil || tctx.StartTrace("c", 1001, nil) == nil {
+		t.Fatalf(" traces over the disk limit should be rejected \n")
+	}
+	info := tctx.captures.GetInfo()
+	if info.Count != 2 || info.DiskBytes != 600 || info.Bytes != 10*CAPTURE_FRAME_BYTES || info.Rejected != 2 ||
+		len(plug.rejects) != 2 || plug.rejects[0].Name != "b" || plug.rejects[1].Bytes != 1001 || plug.rejects[1].Err == nil {
+		t.Fatalf(" bad traces %+v %+v \n", info, plug.rejects)
+	}
+
+	// the oldest trace is evicted, the capture in memory is kept
+	tctx.captures.SetLimits(&CCaptureLimits{MaxDiskBytes: 1000, Policy: CAPTURE_POLICY_EVICT})
+	if tctx.StartTrace("b", 600, nil) != nil || !stopped {
+		t.Fatalf(" trace should start by evicting the oldest trace \n")
+	}
+	info = tctx.captures.GetInfo()
+	if info.Count != 2 || info.DiskBytes != 600 || info.Captures[0].Name != CAPTURE_RX_HISTORY || !info.Captures[1].Disk {
+		t.Fatalf(" bad traces after evict %+v \n", info)
+	}
+	tctx.StopTrace("b")
+	if info = tctx.captures.GetInfo(); info.Count != 1 || info.DiskBytes != 0 {
+		t.Fatalf(" trace should be removed %+v \n", info)
+	}
+}
@@ -54,15 +54,69 @@ func castDlistClient(dlist *DList) *CClient {
 type CClientDg struct {
 	IpdgResolved bool   `json:"resolve"` // bool in case it is resolved
 	IpdgMac      MACKey `json:"rmac"`    // default
+
+	resolveStart   uint64 // ticks of the first query
+	resolveTicks   uint64 // ticks from the first query to the resolution
+	resolveStarted bool   // a query was sent and not answered yet
+	resolveValid   bool   // resolveTicks is valid
+}
+
+// StartResolve should be called by the resolver (ARP/ND) when it sends the first query for the gateway
+func (o *CClientDg) StartResolve(ticks uint64) {
+	o.resolveStart = ticks
+	o.resolveStarted = true
+	o.resolveValid = false
+}
+
+// OnResolved should be called by the resolver when the gateway MAC was learned
+func (o *CClientDg) OnResolved(ticks uint64) {
+	if o.resolveStarted {
+		o.resolveTicks = ticks - o.resolveStart
+		o.resolveStarted = false
+		o.resolveValid = true
+	}
+}
+
+// GetResolveTicks returns the ticks from the first query to the resolution, false in case it was not measured
+func (o *CClientDg) GetResolveTicks() (uint64, bool) {
+	return o.resolveTicks, o.resolveValid
+}
+
+const (
+	/* gateway resolution state */
+	GW_STATE_NONE       = "none"       // no gateway
+	GW_STATE_FORCED     = "forced"     // the MAC is forced by configuration
+	GW_STATE_ROUTER     = "router"     // the MAC is learned from RA (IPv6 only)
+	GW_STATE_UNRESOLVED = "unresolved" // waiting for resolution
+	GW_STATE_RESOLVED   = "resolved"
+)
+
+// CClientGwInfo the gateway resolution state of one address family
+type CClientGwInfo struct {
+	State        string `json:"state"`
+	Mac          MACKey `json:"mac"`
+	ResolveMsec  uint64 `json:"resolve_msec"` // time from the first query to resolution, valid if ResolveValid
+	ResolveValid bool   `json:"resolve_valid"`
+}
+
+// CClientGwStatus the gateway of a client, see ctx_client_get_gw
+type CClientGwStatus struct {
+	Mac    MACKey        `json:"mac"`
+	DgIpv4 Ipv4Key       `json:"ipv4_dg"`
+	Ipv4   CClientGwInfo `json:"ipv4"`
+	DgIpv6 Ipv6Key       `json:"ipv6_dg"`
+	Ipv6   CClientGwInfo `json:"ipv6"`
 }
 
 //CClientIpv6Nd information from learned from router
 type CClientIpv6Nd struct {
-	MTU        uint16  `json:"mtu"`   // MTU in L3 1500 by default
-	DgMac      MACKey  `json:"dgmac"` // router dg
-	PrefixIpv6 Ipv6Key `json:"prefix"`
-	PrefixLen  uint8   `json:"prefix_len"`
-	IPv6       Ipv6Key `json:"ipv6"`
+	MTU        uint16    `json:"mtu"`   // MTU in L3 1500 by default
+	DgMac      MACKey    `json:"dgmac"` // router dg
+	PrefixIpv6 Ipv6Key   `json:"prefix"`
+	PrefixLen  uint8     `json:"prefix_len"`
+	IPv6       Ipv6Key   `json:"ipv6"`
+	Deprecated bool      `json:"deprecated,omitempty"` // the preferred lifetime of the prefix expired
+	Rdnss      []Ipv6Key `json:"rdnss,omitempty"`      // recursive DNS servers of the RA
 }
 
 // CClient represent one client
@@ -89,9 +143,20 @@ type CClient struct {
 	ForceDGW       bool /* true in case we want to enforce default gateway MAC */
 	Ipv4ForcedgMac MACKey
 
+	Routes     []*CClientRoute // static routes, longest prefix first
+	routesEpoc uint32          // changed each time the static routes are replaced
+
+	vlanPolicy *CClientVlanPolicy // per destination vlan tag, nil for untagged
+	blackhole  bool               // drops all its tx and rx frames, see SetBlackhole
+	nat64      *clientNat64       // NAT64 prefix of an IPv6-only client, nil for none
+	dns        clientDns          // static and learned DNS resolvers
+	encap      *clientEncap       // tx and rx encapsulation, nil for the one of the namespace
+	ipv6Scope  bool               // drops the rx ipv6 packets that violate the scope, see rxIpv6Scope
+
 	PluginCtx *PluginCtx
 
 	transport interface{} // pointer to transport, allocated only if needed
+	initCmd   CClientCmd  // the configuration of the client, a restart starts from it
 
 	timerw             *TimerCtx  // Timer Wheel
 	timer              CHTimerObj // Timer Object for notifying in case DG MAC resolved.
@@ -114,6 +179,18 @@ type CClientCmd struct {
 	ForceDGW       bool   `json:"ipv4_force_dg"`
 	Ipv4ForcedgMac MACKey `json:"ipv4_force_mac"`
 
+	Routes []CClientRouteCmd `json:"routes"` // static routes
+
+	VlanPolicy []CClientVlanRuleCmd `json:"vlan_policy"` // per destination vlan tag, untagged by default
+
+	Nat64 *CClientNat64Cmd `json:"nat64"` // NAT64/DNS64 prefix, none by default
+
+	Dns *CClientDnsCmd `json:"dns"` // static DNS resolvers, none by default
+
+	Encap *CClientEncapCmd `json:"encap"` // tx and rx encapsulation, the namespace by default
+
+	Ipv6ScopeFilter bool `json:"ipv6_scope_filter"` // drops the rx ipv6 packets that violate the scope
+
 	Plugins *MapJsonPlugs `json:"plugs"`
 }
 
@@ -144,6 +221,8 @@ type CClientInfo struct {
 	Ipv6DGW    *CClientDg     `json:"ipv6_dgw"`
 
 	PlugNames []string `json:"plug_names"`
+
+	Blackhole bool `json:"blackhole,omitempty"`
 }
 
 /* NewClient Create a new client with default information and key */
@@ -164,6 +243,7 @@ func NewClient(ns *CNSCtx,
 	o.Maskv4 = [4]byte{0xff, 0xff, 0xff, 0xff}
 	o.MTU = 1500
 	o.PluginCtx = NewPluginCtx(o, ns, ns.ThreadCtx, PLUGIN_LEVEL_CLIENT)
+	o.initCmd = CClientCmd{Mac: Mac, Ipv4: Ipv4, DgIpv4: DgIpv4, Ipv6: Ipv6}
 	return o
 }
 
@@ -180,16 +260,18 @@ func NewClientCmd(ns *CNSCtx, cmd *CClientCmd) *CClient {
 	c.Ipv6ForcedgMac = cmd.Ipv6ForcedgMac
 	c.ForceDGW = cmd.ForceDGW
 	c.Ipv4ForcedgMac = cmd.Ipv4ForcedgMac
+	c.initCmd = *cmd
+	c.initCmd.Plugins = nil
 
 	return c
 }
 
 // AttemptResolve tells the client to start attempting to resolve.
 func (o *CClient) AttemptResolve() {
-	o.maxResolveAttempts = 5                // Maximum amount of resolved attempts.
-	o.timerw = o.Ns.ThreadCtx.GetTimerCtx() // Initialize timer wheel
-	o.timer.SetCB(o, 0, 0)                  // Set callback for timer
-	o.OnEvent(0, 0)                         // Call on Event explicitly the first time
+	o.maxResolveAttempts = 5      // Maximum amount of resolved attempts.
+	o.timerw = o.Ns.GetTimerCtx() // Initialize timer wheel
+	o.timer.SetCB(o, 0, 0)        // Set callback for timer
+	o.OnEvent(0, 0)               // Call on Event explicitly the first time
 }
 
 /*OnRemove called on before removing the client */
@@ -197,6 +279,14 @@ func (o *CClient) OnRemove() {
 	if o.timer.IsRunning() {
 		o.timerw.Stop(&o.timer)
 	}
+	if o.vlanPolicy != nil {
+		o.Ns.ThreadCtx.vlanClients--
+		o.Ns.refVlanTags(o.vlanPolicy, false)
+		o.vlanPolicy = nil
+	}
+	o.SetBlackhole(false)
+	o.SetEncap(nil)
+	o.SetIpv6ScopeFilter(false)
 	o.PluginCtx.OnRemove()
 }
 
@@ -243,20 +333,25 @@ func (o *CClient) GetIpv6Slaac(l6 *Ipv6Key) bool {
 		return false
 	}
 	if o.Ipv6Router.PrefixLen == 64 && !o.Ipv6Router.PrefixIpv6.IsZero() {
-		copy(l6[:], o.Ipv6Router.PrefixIpv6[:])
-		l6[8] = o.Mac[0] ^ 0x2
-		l6[9] = o.Mac[1]
-		l6[10] = o.Mac[2]
-		l6[11] = 0xFF
-		l6[12] = 0xFE
-		l6[13] = o.Mac[3]
-		l6[14] = o.Mac[4]
-		l6[15] = o.Mac[5]
+		o.GetIpv6SlaacOfPrefix(&o.Ipv6Router.PrefixIpv6, l6)
 		return true
 	}
 	return false
 }
 
+// GetIpv6SlaacOfPrefix builds the SLAAC address of the client from a /64 prefix
+func (o *CClient) GetIpv6SlaacOfPrefix(prefix *Ipv6Key, l6 *Ipv6Key) {
+	copy(l6[:], prefix[:])
+	l6[8] = o.Mac[0] ^ 0x2
+	l6[9] = o.Mac[1]
+	l6[10] = o.Mac[2]
+	l6[11] = 0xFF
+	l6[12] = 0xFE
+	l6[13] = o.Mac[3]
+	l6[14] = o.Mac[4]
+	l6[15] = o.Mac[5]
+}
+
 func (o *CClient) GetIpv6LocalLink(l6 *Ipv6Key) {
 	l6[0] = 0xFE
 	l6[1] = 0x80
@@ -349,6 +444,12 @@ func (o *CClient) UpdateDIPv6(NewIpv6 Ipv6Key) error {
 	return o.Ns.UpdateClientDIpv6(o, NewIpv6)
 }
 
+// LinkUp notifies the plugins that the link of the client is up again after a link change,
+// MSG_LINK_UP is sent so the plugins could verify their state (e.g. DHCPv6 CONFIRM)
+func (o *CClient) LinkUp() {
+	o.PluginCtx.BroadcastMsg(nil, MSG_LINK_UP, nil, nil)
+}
+
 // GetL2Header get L2 header
 func (o *CClient) GetL2Header(broadcast bool, next uint16) []byte {
 	var tund CTunnelData
@@ -423,10 +524,65 @@ func (o *CClient) GetInfo() *CClientInfo {
 	info.Ipv6DGW = o.Ipv6DGW
 
 	info.PlugNames = o.PluginCtx.GetAllPlugNames()
+	info.Blackhole = o.blackhole
 
 	return &info
 }
 
+func (o *CClient) fillGwInfo(info *CClientGwInfo, dg *CClientDg) {
+	if dg == nil || !dg.IpdgResolved {
+		info.State = GW_STATE_UNRESOLVED
+	} else {
+		info.State = GW_STATE_RESOLVED
+		info.Mac = dg.IpdgMac
+	}
+	if dg == nil {
+		return
+	}
+	if ticks, ok := dg.GetResolveTicks(); ok {
+		tickDuration := o.Ns.GetTimerCtx().TickDuration
+		info.ResolveMsec = uint64(time.Duration(ticks) * tickDuration / time.Millisecond)
+		info.ResolveValid = true
+	}
+}
+
+// GetGwStatus returns the resolved gateway MAC (IPv4/IPv6) and the resolution latency
+func (o *CClient) GetGwStatus() *CClientGwStatus {
+	var status CClientGwStatus
+
+	status.Mac = o.Mac
+	status.DgIpv4 = o.DgIpv4
+	if o.ForceDGW {
+		status.Ipv4.State = GW_STATE_FORCED
+		status.Ipv4.Mac = o.Ipv4ForcedgMac
+	} else if o.DgIpv4.IsZero() {
+		status.Ipv4.State = GW_STATE_NONE
+	} else {
+		o.fillGwInfo(&status.Ipv4, o.DGW)
+	}
+
+	if ipv6, ok := o.ResolveDGIPv6(); ok {
+		status.DgIpv6 = ipv6
+	}
+	if o.Ipv6ForceDGW {
+		status.Ipv6.State = GW_STATE_FORCED
+		status.Ipv6.Mac = o.Ipv6ForcedgMac
+	} else if !o.DgIpv6.IsZero() {
+		o.fillGwInfo(&status.Ipv6, o.Ipv6DGW)
+	} else if o.Ipv6Router != nil {
+		status.Ipv6.State = GW_STATE_ROUTER
+		status.Ipv6.Mac = o.Ipv6Router.DgMac
+	} else {
+		status.Ipv6.State = GW_STATE_NONE
+	}
+	return &status
+}
+
+// IsGwUnresolved returns true in case one of the gateways is configured but not resolved
+func (o *CClientGwStatus) IsGwUnresolved() bool {
+	return o.Ipv4.State == GW_STATE_UNRESOLVED || o.Ipv6.State == GW_STATE_UNRESOLVED
+}
+
 func (o *CClient) ResolveIPv4DGMac() (mac MACKey, ok bool) {
 	if o.ForceDGW {
 		mac, ok = o.Ipv4ForcedgMac, true
@@ -447,6 +603,8 @@ func (o *CClient) ResolveIPv6DGMac() (mac MACKey, ok bool) {
 	return mac, ok
 }
 
+// GetSourceIPv6 returns the source of new traffic. A deprecated SLAAC address is not used for
+// new traffic (RFC 4862 5.5.4), it is still valid for the existing one, see ResolveSourceIPv6
 func (o *CClient) GetSourceIPv6() (Ipv6Key, error) {
 	if !o.Dhcpv6.IsZero() {
 		return o.Dhcpv6, nil
@@ -456,6 +614,9 @@ func (o *CClient) GetSourceIPv6() (Ipv6Key, error) {
 	}
 	var ipv6Slaac Ipv6Key
 	if o.GetIpv6Slaac(&ipv6Slaac) {
+		if o.Ipv6Router.Deprecated {
+			return ipv6Slaac, fmt.Errorf(" The IPv6 SLAAC address of this client is deprecated! client %v ", o.Mac)
+		}
 		return ipv6Slaac, nil
 	}
 	var key Ipv6Key
@@ -486,6 +647,11 @@ func (o *CClient) ResolveDGIPv6() (ipv6 Ipv6Key, ok bool) {
 	return ipv6, ok
 }
 
+// OwnsIPv4 checks in the address registry of the namespace that the client owns the ipv4
+func (o *CClient) OwnsIPv4(ipv4 Ipv4Key) bool {
+	return o.Ns.CLookupByIPv4(&ipv4) == o
+}
+
 func (o *CClient) OwnsIPv6(ipv6 Ipv6Key) bool {
 	var ipv6Slaac Ipv6Key
 	o.GetIpv6Slaac(&ipv6Slaac)
@@ -0,0 +1,173 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"errors"
+	"time"
+)
+
+// CCorrelatorOnTimeout is called when an outstanding request was not answered in time.
+type CCorrelatorOnTimeout interface {
+	OnCorrelatorTimeout(key uint64, ctx interface{})
+}
+
+// CCorrelatorStats are the counters of a correlator.
+type CCorrelatorStats struct {
+	registered   uint64 // requests registered
+	outstanding  uint64 // requests waiting for a response
+	matched      uint64 // responses that matched an outstanding request
+	timedOut     uint64 // requests that were not answered in time
+	unmatched    uint64 // responses without an outstanding request (late or duplicate)
+	duplicateKey uint64 // register failed, the key is already outstanding
+}
+
+// NewCorrelatorStatsDb creates a database of correlator stats
+func NewCorrelatorStatsDb(name string, o *CCorrelatorStats) *CCounterDb {
+	db := NewCCounterDb(name)
+	db.Add(&CCounterRec{
+		Counter:  &o.registered,
+		Name:     "registered",
+		Help:     "requests registered",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.outstanding,
+		Name:     "outstanding",
+		Help:     "requests waiting for a response",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.matched,
+		Name:     "matched",
+		Help:     "responses matched to a request",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.timedOut,
+		Name:     "timedOut",
+		Help:     "requests timed out",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScERROR})
+	db.Add(&CCounterRec{
+		Counter:  &o.unmatched,
+		Name:     "unmatched",
+		Help:     "responses without an outstanding request",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScERROR})
+	db.Add(&CCounterRec{
+		Counter:  &o.duplicateKey,
+		Name:     "duplicateKey",
+		Help:     "register with a key that is already outstanding",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScERROR})
+	return db
+}
+
+type correlatorEntry struct {
+	timer CHTimerObj
+	key   uint64
+	ctx   interface{}
+	cb    CCorrelatorOnTimeout
+	owner *CCorrelator
+}
+
+func (o *correlatorEntry) OnEvent(a, b interface{}) {
+	o.owner.onTimeout(o)
+}
+
+// CCorrelator keeps track of outstanding requests of a plugin and matches the
+// responses by key (sequence number, transaction id etc). Each request has its
+// own timer on the thread timer wheel, the callback is called if no response
+// was matched before the timeout.
+type CCorrelator struct {
+	timerw *TimerCtx
+	tbl    map[uint64]*correlatorEntry
+	stats  CCorrelatorStats
+	Cdb    *CCounterDb
+}
+
+// NewCorrelator creates a correlator, name is the name of the counters database.
+func NewCorrelator(timerw *TimerCtx, name string) *CCorrelator {
+	o := new(CCorrelator)
+	o.timerw = timerw
+	o.tbl = make(map[uint64]*correlatorEntry)
+	o.Cdb = NewCorrelatorStatsDb(name, &o.stats)
+	return o
+}
+
+// Register a new outstanding request. cb can be nil in case the plugin is only interested in the counters.
+func (o *CCorrelator) Register(key uint64, timeout time.Duration, ctx interface{}, cb CCorrelatorOnTimeout) error {
+	if _, ok := o.tbl[key]; ok {
+		o.stats.duplicateKey++
+		return errors.New("correlator key is already outstanding")
+	}
+	e := &correlatorEntry{key: key, ctx: ctx, cb: cb, owner: o}
+	e.timer.SetCB(e, 0, 0)
+	ticks := o.timerw.DurationToTicks(timeout)
+	if ticks == 0 {
+		ticks = 1
+	}
+	o.timerw.StartTicks(&e.timer, ticks)
+	o.tbl[key] = e
+	o.stats.registered++
+	o.stats.outstanding++
+	return nil
+}
+
+// Match resolves the outstanding request of key and returns its ctx.
+// In case there is no such request the response is counted as unmatched and false is returned.
+func (o *CCorrelator) Match(key uint64) (interface{}, bool) {
+	e, ok := o.tbl[key]
+	if !ok {
+		o.stats.unmatched++
+		return nil, false
+	}
+	o.remove(e)
+	o.stats.matched++
+	return e.ctx, true
+}
+
+// IsOutstanding returns true if there is a request waiting for a response with this key.
+func (o *CCorrelator) IsOutstanding(key uint64) bool {
+	_, ok := o.tbl[key]
+	return ok
+}
+
+// Outstanding returns the number of requests waiting for a response.
+func (o *CCorrelator) Outstanding() int {
+	return len(o.tbl)
+}
+
+// OnRemove stops all the timers, should be called when the owner is removed.
+// The timeout callbacks are not called.
+func (o *CCorrelator) OnRemove() {
+	for _, e := range o.tbl {
+		o.remove(e)
+	}
+}
+
+func (o *CCorrelator) remove(e *correlatorEntry) {
+	if e.timer.IsRunning() {
+		o.timerw.Stop(&e.timer)
+	}
+	delete(o.tbl, e.key)
+	o.stats.outstanding--
+}
+
+func (o *CCorrelator) onTimeout(e *correlatorEntry) {
+	o.remove(e)
+	o.stats.timedOut++
+	if e.cb != nil {
+		e.cb.OnCorrelatorTimeout(e.key, e.ctx)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+type myCorrTimeout struct {
+	keys []uint64
+}
+
+func (o *myCorrTimeout) OnCorrelatorTimeout(key uint64, ctx interface{}) {
+	o.keys = append(o.keys, key)
+}
+
+func TestCorrelator1(t *testing.T) {
+	timerw := NewTimerCtx(true)
+	corr := NewCorrelator(timerw, "test_corr")
+	var cb myCorrTimeout
+
+	for i := uint64(1); i <= 3; i++ {
+		if err := corr.Register(i, time.Second, i*10, &cb); err != nil {
+			t.Fatalf(" register %d failed %v \n", i, err)
+		}
+	}
+	if corr.Register(2, time.Second, nil, &cb) == nil {
+		t.Fatalf(" duplicate key should fail \n")
+	}
+
+	ctx, ok := corr.Match(2)
+	if !ok || ctx.(uint64) != 20 {
+		t.Fatalf(" match failed %v %v \n", ctx, ok)
+	}
+	if _, ok := corr.Match(2); ok {
+		t.Fatalf(" second match should fail \n")
+	}
+
+	for i := 0; i < 20; i++ {
+		timerw.HandleTicks()
+	}
+
+	if len(cb.keys) != 2 {
+		t.Fatalf(" expected 2 timeouts got %v \n", cb.keys)
+	}
+	if corr.Outstanding() != 0 {
+		t.Fatalf(" expected no outstanding requests got %d \n", corr.Outstanding())
+	}
+	s := &corr.stats
+	if s.registered != 3 || s.matched != 1 || s.timedOut != 2 || s.unmatched != 1 || s.duplicateKey != 1 || s.outstanding != 0 {
+		t.Fatalf(" bad stats %+v \n", *s)
+	}
+}
+
+func TestCorrelator2(t *testing.T) {
+	timerw := NewTimerCtx(true)
+	corr := NewCorrelator(timerw, "test_corr")
+	var cb myCorrTimeout
+
+	corr.Register(7, time.Second, nil, &cb)
+	corr.Register(8, time.Second, nil, nil)
+	corr.OnRemove()
+	for i := 0; i < 20; i++ {
+		timerw.HandleTicks()
+	}
+	if len(cb.keys) != 0 || timerw.ActiveTimers() != 0 {
+		t.Fatalf(" timers should be stopped on remove \n")
+	}
+}
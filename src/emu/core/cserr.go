@@ -0,0 +1,88 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"encoding/binary"
+	"external/google/gopacket/layers"
+	"fmt"
+)
+
+const (
+	CS_ERR_MAX_SAMPLES = 256
+)
+
+// CCsErrFrame a received TCP/UDP frame with a bad checksum, see ctx_get_cs_errors
+type CCsErrFrame struct {
+	Proto    string `json:"proto"` // tcp or udp
+	Ipv6     bool   `json:"ipv6"`
+	Vport    uint16 `json:"vport"`
+	Received uint16 `json:"received"` // the checksum of the frame
+	Expected uint16 `json:"expected"` // the checksum with the right pseudo header
+	Data     []byte `json:"data"`     // base64
+}
+
+// CCsErrSampler keeps a sample of the received frames with a bad TCP/UDP checksum, one of every
+// rate errors, the oldest is replaced when size frames are kept. Disabled by default.
+type CCsErrSampler struct {
+	size   uint32
+	rate   uint32
+	cnt    uint64 // errors seen since the last Set
+	frames []CCsErrFrame
+}
+
+// Set sets the number of frames to keep and the sample rate, zero size disables the sampler.
+// The frames are cleared.
+func (o *CCsErrSampler) Set(size, rate uint32) error {
+	if size > CS_ERR_MAX_SAMPLES {
+		return fmt.Errorf("checksum errors sample size %d is bigger than %d", size, CS_ERR_MAX_SAMPLES)
+	}
+	if rate == 0 {
+		rate = 1
+	}
+	o.size = size
+	o.rate = rate
+	o.cnt = 0
+	o.frames = nil
+	return nil
+}
+
+// OnErr handles a frame with a bad checksum at l4+csOff, it returns true in case it was sampled
+func (o *CCsErrSampler) OnErr(m *Mbuf, proto string, ipv6 bool, l4, l4len, csOff uint16, pcs uint32) bool {
+	if o.size == 0 {
+		return false
+	}
+	o.cnt++
+	if (o.cnt-1)%uint64(o.rate) != 0 {
+		return false
+	}
+	p := m.GetData()
+	var f CCsErrFrame
+	f.Proto = proto
+	f.Ipv6 = ipv6
+	f.Vport = m.VPort()
+	f.Received = binary.BigEndian.Uint16(p[l4+csOff : l4+csOff+2])
+	f.Data = append([]byte{}, p...)
+	seg := f.Data[l4 : l4+l4len]
+	binary.BigEndian.PutUint16(seg[csOff:csOff+2], 0)
+	f.Expected = layers.PktChecksum(seg, pcs)
+	binary.BigEndian.PutUint16(seg[csOff:csOff+2], f.Received)
+
+	if uint32(len(o.frames)) == o.size {
+		o.frames = append(o.frames[:0], o.frames[1:]...)
+	}
+	o.frames = append(o.frames, f)
+	return true
+}
+
+// Get returns the sampled frames, oldest first
+func (o *CCsErrSampler) Get(clear bool) []CCsErrFrame {
+	r := o.frames
+	if clear {
+		o.frames = nil
+	}
+	return r
+}
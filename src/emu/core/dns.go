@@ -0,0 +1,142 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"fmt"
+	"net"
+)
+
+/* DNS resolvers of a client
+
+The emulator does not have a DNS plugin, an application of the client (e.g. over the transport)
+sends its queries to the resolver of the client. The resolvers are learned by DHCPv4 (option 6),
+updated by every ACK including the renewals, and by the RDNSS option of the RA of the namespace
+(RFC 8106). Static resolvers are configured by ctx_client_set_dns. The learned resolvers are
+preferred, the static resolvers are used in case nothing was learned. The transport resolves the
+host DNS_RESOLVER_HOST, e.g. Dial("udp", "resolver:53", cb, nil), to the resolver of the client.
+*/
+
+const DNS_RESOLVER_HOST = "resolver"
+
+// CClientDnsCmd the static resolvers of a client
+type CClientDnsCmd struct {
+	Ipv4 []Ipv4Key `json:"ipv4"`
+	Ipv6 []Ipv6Key `json:"ipv6"`
+}
+
+// CClientDnsInfo the resolvers of a client and the queries sent to them
+type CClientDnsInfo struct {
+	Mac           MACKey        `json:"mac"`
+	Static        CClientDnsCmd `json:"static"`
+	Dhcp          []Ipv4Key     `json:"dhcp"`            // DHCPv4 option 6
+	Ra            []Ipv6Key     `json:"ra"`              // RDNSS of the RA
+	LearnedQuery  uint64        `json:"learned_query"`   // queries sent to a learned resolver
+	StaticQuery   uint64        `json:"static_query"`    // queries sent to a static resolver
+	DhcpUpdates   uint64        `json:"dhcp_updates"`    // changes of the resolvers learned by DHCP
+	NoResolverErr uint64        `json:"no_resolver_err"` // queries without a resolver
+}
+
+type clientDns struct {
+	static        CClientDnsCmd
+	dhcp          []Ipv4Key
+	learnedQuery  uint64
+	staticQuery   uint64
+	dhcpUpdates   uint64
+	noResolverErr uint64
+}
+
+// SetDns sets the static resolvers of the client, nil removes them
+func (o *CClient) SetDns(cmd *CClientDnsCmd) error {
+	if cmd == nil {
+		o.dns.static = CClientDnsCmd{}
+		o.initCmd.Dns = nil
+		return nil
+	}
+	for _, ipv4 := range cmd.Ipv4 {
+		if ipv4.IsZero() {
+			return fmt.Errorf("invalid dns resolver %v", ipv4)
+		}
+	}
+	for _, ipv6 := range cmd.Ipv6 {
+		if ipv6.IsZero() {
+			return fmt.Errorf("invalid dns resolver %v", ipv6)
+		}
+	}
+	o.dns.static.Ipv4 = append([]Ipv4Key(nil), cmd.Ipv4...)
+	o.dns.static.Ipv6 = append([]Ipv6Key(nil), cmd.Ipv6...)
+	c := CClientDnsCmd{Ipv4: o.dns.static.Ipv4, Ipv6: o.dns.static.Ipv6}
+	o.initCmd.Dns = &c
+	return nil
+}
+
+// SetDhcpDns sets the resolvers the client learned by DHCPv4, nil in case the lease was lost
+func (o *CClient) SetDhcpDns(vec []Ipv4Key) {
+	if len(vec) == len(o.dns.dhcp) {
+		same := true
+		for i := range vec {
+			if vec[i] != o.dns.dhcp[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return
+		}
+	}
+	o.dns.dhcp = append([]Ipv4Key(nil), vec...)
+	o.dns.dhcpUpdates++
+	o.Ns.stats.dnsDhcpUpdate++
+}
+
+func (o *CClient) raDns() []Ipv6Key {
+	if o.Ipv6Router == nil {
+		return nil
+	}
+	return o.Ipv6Router.Rdnss
+}
+
+// GetDns returns the resolvers of the client
+func (o *CClient) GetDns() *CClientDnsInfo {
+	res := &CClientDnsInfo{Mac: o.Mac}
+	res.Static.Ipv4 = append([]Ipv4Key{}, o.dns.static.Ipv4...)
+	res.Static.Ipv6 = append([]Ipv6Key{}, o.dns.static.Ipv6...)
+	res.Dhcp = append([]Ipv4Key{}, o.dns.dhcp...)
+	res.Ra = append([]Ipv6Key{}, o.raDns()...)
+	res.LearnedQuery = o.dns.learnedQuery
+	res.StaticQuery = o.dns.staticQuery
+	res.DhcpUpdates = o.dns.dhcpUpdates
+	res.NoResolverErr = o.dns.noResolverErr
+	return res
+}
+
+// DnsResolver returns the resolver a query of the client is sent to, the first resolver learned by
+// DHCP or by the RA, otherwise the first static resolver. The query is counted as learned or static.
+func (o *CClient) DnsResolver() (net.IP, error) {
+	if len(o.dns.dhcp) > 0 {
+		o.dns.learnedQuery++
+		o.Ns.stats.dnsLearnedQuery++
+		return net.IP(o.dns.dhcp[0][:]), nil
+	}
+	if ra := o.raDns(); len(ra) > 0 {
+		o.dns.learnedQuery++
+		o.Ns.stats.dnsLearnedQuery++
+		return net.IP(ra[0][:]), nil
+	}
+	if len(o.dns.static.Ipv4) > 0 {
+		o.dns.staticQuery++
+		o.Ns.stats.dnsStaticQuery++
+		return net.IP(o.dns.static.Ipv4[0][:]), nil
+	}
+	if len(o.dns.static.Ipv6) > 0 {
+		o.dns.staticQuery++
+		o.Ns.stats.dnsStaticQuery++
+		return net.IP(o.dns.static.Ipv6[0][:]), nil
+	}
+	o.dns.noResolverErr++
+	o.Ns.stats.dnsNoResolver++
+	return nil, fmt.Errorf("client %v does not have a dns resolver", o.Mac)
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"net"
+	"testing"
+)
+
+func TestClientDns(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	client := NewClient(ns, MACKey{0, 0, 1, 0, 0, 1}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 2})
+	ns.AddClient(client)
+
+	if _, err := client.DnsResolver(); err == nil {
+		t.Fatalf(" client without a resolver \n")
+	}
+	if client.SetDns(&CClientDnsCmd{Ipv4: []Ipv4Key{{}}}) == nil {
+		t.Fatalf(" zero resolver should fail \n")
+	}
+	client.SetDns(&CClientDnsCmd{Ipv4: []Ipv4Key{{8, 8, 8, 8}}, Ipv6: []Ipv6Key{parseIpv6("2001:db8::53")}})
+	if r, err := client.DnsResolver(); err != nil || !r.Equal(net.IPv4(8, 8, 8, 8)) {
+		t.Fatalf(" bad static resolver %v %v \n", r, err)
+	}
+
+	// the learned resolvers are preferred
+	client.SetDhcpDns([]Ipv4Key{{16, 0, 0, 53}, {16, 0, 0, 54}})
+	client.SetDhcpDns([]Ipv4Key{{16, 0, 0, 53}, {16, 0, 0, 54}})
+	if r, _ := client.DnsResolver(); !r.Equal(net.IPv4(16, 0, 0, 53)) {
+		t.Fatalf(" bad dhcp resolver %v \n", r)
+	}
+	client.SetDhcpDns(nil)
+	client.Ipv6Router = &CClientIpv6Nd{Rdnss: []Ipv6Key{parseIpv6("2001:db8::1:53")}}
+	if r, _ := client.DnsResolver(); !r.Equal(net.ParseIP("2001:db8::1:53")) {
+		t.Fatalf(" bad ra resolver %v \n", r)
+	}
+
+	info := client.GetDns()
+	if info.LearnedQuery != 2 || info.StaticQuery != 1 || info.DhcpUpdates != 2 || info.NoResolverErr != 1 ||
+		len(info.Ra) != 1 || len(info.Dhcp) != 0 || len(info.Static.Ipv6) != 1 || ns.stats.dnsLearnedQuery != 2 {
+		t.Fatalf(" bad info %+v \n", info)
+	}
+
+	client.Ipv6Router = nil
+	client.SetDns(nil)
+	if _, err := client.DnsResolver(); err == nil || client.initCmd.Dns != nil {
+		t.Fatalf(" static resolvers should be removed \n")
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"external/google/gopacket/layers"
+	"fmt"
+)
+
+/* Asymmetric encapsulation of a client
+
+A DUT that rewrites the encapsulation returns the traffic of a client on another encapsulation than
+the one it was sent on, e.g. sent tagged and returned untagged or on another VNI. The tx
+encapsulation of a client replaces the vlan tags of the namespace on the frames it sends. The rx
+encapsulation is the one its replies are expected on, a frame that arrives on it to the MAC of the
+client (or to a broadcast/multicast MAC) is rewritten to the encapsulation of the namespace before it
+is decoded. An encapsulation is up to two vlan tags (QinQ, outer first), optionally of the outer
+frame of a VXLAN tunnel over IPv4. A nil encapsulation is the one of the namespace.
+*/
+
+const (
+	ENCAP_VXLAN_PORT = 4789
+	encapVxlanHdrLen = 14 + 20 + 8 + 8 // outer ethernet without tags, ipv4, udp and vxlan
+)
+
+// CEncapVxlanCmd the VXLAN tunnel of an encapsulation, the outer addresses are used only on tx
+type CEncapVxlanCmd struct {
+	Vni    uint32  `json:"vni" validate:"lte=16777215"`
+	Port   uint16  `json:"port"` // zero is 4789
+	Src    Ipv4Key `json:"src"`
+	Dst    Ipv4Key `json:"dst"`
+	SrcMac MACKey  `json:"src_mac"`
+	DstMac MACKey  `json:"dst_mac"`
+}
+
+// CEncapCmd an encapsulation, the vlans (outer first) with their tpid (zero is 0x8100) and a tunnel
+type CEncapCmd struct {
+	Vlans []uint16        `json:"vlans"`
+	Tpids []uint16        `json:"tpids"`
+	Vxlan *CEncapVxlanCmd `json:"vxlan"`
+}
+
+// CClientEncapCmd the tx and rx encapsulation of a client, nil is the encapsulation of the namespace
+type CClientEncapCmd struct {
+	Tx *CEncapCmd `json:"tx"`
+	Rx *CEncapCmd `json:"rx"` // the replies are accepted on it
+}
+
+// CClientEncapInfo the encapsulation of a client, see ctx_client_get_encap
+type CClientEncapInfo struct {
+	Mac       MACKey     `json:"mac"`
+	Tx        *CEncapCmd `json:"tx"`
+	Rx        *CEncapCmd `json:"rx"`
+	TxPkts    uint64     `json:"tx_pkts"`    // frames sent on the tx encapsulation
+	TxErr     uint64     `json:"tx_err"`     // frames without headroom for the tx encapsulation
+	RxMatched uint64     `json:"rx_matched"` // frames received on the rx encapsulation
+}
+
+type cEncap struct {
+	cmd  CEncapCmd
+	tags []uint32 // tpid<<16 | vlan, outer first
+	port uint16
+}
+
+type clientEncap struct {
+	cmd       CClientEncapCmd
+	tx        *cEncap
+	rx        *cEncap
+	txPkts    uint64
+	txErr     uint64
+	rxMatched uint64
+}
+
+func newEncap(cmd *CEncapCmd, tx bool) (*cEncap, error) {
+	if cmd == nil {
+		return nil, nil
+	}
+	o := &cEncap{cmd: *cmd}
+	if len(cmd.Vlans) > 2 || len(cmd.Tpids) > len(cmd.Vlans) {
+		return nil, fmt.Errorf("encapsulation should have up to two vlans and a tpid per vlan")
+	}
+	for i, vlan := range cmd.Vlans {
+		if vlan == 0 || vlan > 4094 {
+			return nil, fmt.Errorf("invalid vlan %d", vlan)
+		}
+		tpid := uint16(DEF_TPID)
+		if i < len(cmd.Tpids) && cmd.Tpids[i] != 0 {
+			tpid = cmd.Tpids[i]
+		}
+		o.tags = append(o.tags, uint32(tpid)<<16|uint32(vlan))
+	}
+	if v := cmd.Vxlan; v != nil {
+		if v.Vni > 0xffffff {
+			return nil, fmt.Errorf("invalid vxlan vni %d", v.Vni)
+		}
+		if tx && (v.Dst.IsZero() || v.DstMac.IsZero()) {
+			return nil, fmt.Errorf("tx vxlan should have an outer destination ip and mac")
+		}
+		o.port = v.Port
+		if o.port == 0 {
+			o.port = ENCAP_VXLAN_PORT
+		}
+	}
+	return o, nil
+}
+
+func (o *cEncap) headroom() int {
+	n := 4 * len(o.tags)
+	if o.cmd.Vxlan != nil {
+		n += encapVxlanHdrLen
+	}
+	return n
+}
+
+// push replaces the nsTags tags of the namespace of a frame with the encapsulation
+func (o *cEncap) push(m *Mbuf, nsTags int) bool {
+	if int(m.Headroom())+4*nsTags < o.headroom() {
+		return false
+	}
+	for i := 0; i < nsTags; i++ {
+		m.PopVlan(12)
+	}
+	if v := o.cmd.Vxlan; v != nil {
+		inner := m.PktLen()
+		var h [encapVxlanHdrLen]byte
+		copy(h[0:6], v.DstMac[:])
+		copy(h[6:12], v.SrcMac[:])
+		binary.BigEndian.PutUint16(h[12:14], uint16(layers.EthernetTypeIPv4))
+		ipv4 := layers.IPv4Header(h[14:34])
+		h[14] = 0x45
+		ipv4.SetLength(uint16(20 + 8 + 8 + inner))
+		ipv4.SetTTL(64)
+		h[23] = uint8(layers.IPProtocolUDP)
+		copy(h[26:30], v.Src[:])
+		copy(h[30:34], v.Dst[:])
+		ipv4.UpdateChecksum()
+		// the source port is the entropy of the inner flow (RFC 7348), the checksum is zero
+		p := m.GetData()
+		binary.BigEndian.PutUint16(h[34:36], 0xc000|binary.BigEndian.Uint16(p[10:12])&0x3fff)
+		binary.BigEndian.PutUint16(h[36:38], o.port)
+		binary.BigEndian.PutUint16(h[38:40], uint16(8+8+inner))
+		h[42] = 0x08 // the vni is valid
+		binary.BigEndian.PutUint32(h[46:50], v.Vni<<8)
+		m.Prepend(h[:])
+	}
+	for i := len(o.tags) - 1; i >= 0; i-- {
+		m.PushVlan(12, o.tags[i])
+	}
+	return true
+}
+
+// SetEncap sets the tx and rx encapsulation of the client, nil removes both
+func (o *CClient) SetEncap(cmd *CClientEncapCmd) error {
+	var e *clientEncap
+	if cmd != nil && (cmd.Tx != nil || cmd.Rx != nil) {
+		tx, err := newEncap(cmd.Tx, true)
+		if err != nil {
+			return err
+		}
+		rx, err := newEncap(cmd.Rx, false)
+		if err != nil {
+			return err
+		}
+		e = &clientEncap{cmd: *cmd, tx: tx, rx: rx}
+	}
+	tctx := o.Ns.ThreadCtx
+	if o.encap != nil {
+		tctx.encapCnt--
+		for i, c := range tctx.encapRx {
+			if c == o {
+				tctx.encapRx = append(tctx.encapRx[:i], tctx.encapRx[i+1:]...)
+				break
+			}
+		}
+	}
+	if e != nil {
+		tctx.encapCnt++
+		if e.rx != nil {
+			tctx.encapRx = append(tctx.encapRx, o)
+		}
+	}
+	o.encap = e
+	o.initCmd.Encap = nil
+	if e != nil {
+		c := e.cmd
+		o.initCmd.Encap = &c
+	}
+	return nil
+}
+
+// GetEncap returns the encapsulation of the client with its frames
+func (o *CClient) GetEncap() *CClientEncapInfo {
+	res := &CClientEncapInfo{Mac: o.Mac}
+	if o.encap != nil {
+		res.Tx = o.encap.cmd.Tx
+		res.Rx = o.encap.cmd.Rx
+		res.TxPkts = o.encap.txPkts
+		res.TxErr = o.encap.txErr
+		res.RxMatched = o.encap.rxMatched
+	}
+	return res
+}
+
+func nsTagsCnt(key *CTunnelKey) (int, [2]uint32) {
+	var d CTunnelData
+	key.Get(&d)
+	n := 0
+	for n < 2 && d.Vlans[n] != 0 {
+		n++
+	}
+	return n, d.Vlans
+}
+
+// txEncap sends a frame on the tx encapsulation of the client that sends it, the client is looked up
+// by the source MAC only in case there is a client with an encapsulation
+func (o *CThreadCtx) txEncap(m *Mbuf) {
+	if o.encapCnt == 0 {
+		return
+	}
+	p := m.GetData()
+	if len(p) < 14 {
+		return
+	}
+	var key CTunnelKey
+	frameTunnelKey(m, &key)
+	ns := o.GetNs(&key)
+	if ns == nil {
+		return
+	}
+	var mac MACKey
+	copy(mac[:], p[6:12])
+	c := ns.CLookupByMac(&mac)
+	if c == nil || c.encap == nil || c.encap.tx == nil {
+		return
+	}
+	n, _ := nsTagsCnt(&key)
+	if !c.encap.tx.push(m, n) {
+		c.encap.txErr++
+		ns.stats.txEncapErr++
+		return
+	}
+	c.encap.txPkts++
+	ns.stats.txEncap++
+}
+
+// rxEncapOwned returns true in case a namespace owns the frames that arrive on the port and tags
+func (o *CThreadCtx) rxEncapOwned(port uint16, tags [2]uint32) bool {
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: port, Vlans: tags})
+	return o.HasNs(&key)
+}
+
+// rxEncap rewrites a frame that arrived on the rx encapsulation of a client to the encapsulation of
+// its namespace. A broadcast or multicast frame is taken only in case no namespace owns its tags.
+func (o *CThreadCtx) rxEncap(m *Mbuf) {
+	if len(o.encapRx) == 0 || !m.IsContiguous() {
+		return
+	}
+	p := m.GetData()
+	var tags [2]uint32
+	n := 0
+	off := 12
+	for n < 2 && len(p) >= off+6 {
+		t := layers.EthernetType(binary.BigEndian.Uint16(p[off : off+2]))
+		if t != layers.EthernetTypeDot1Q && t != layers.EthernetTypeQinQ {
+			break
+		}
+		tags[n] = binary.BigEndian.Uint32(p[off:off+4]) & 0xffff0fff
+		off += 4
+		n++
+	}
+	// the inner frame in case it is VXLAN over IPv4 without options
+	var vni uint32
+	var port uint16
+	inner := -1
+	if l3 := off + 2; len(p) >= l3+20+8+8+14 &&
+		layers.EthernetType(binary.BigEndian.Uint16(p[off:off+2])) == layers.EthernetTypeIPv4 &&
+		p[l3] == 0x45 && p[l3+9] == uint8(layers.IPProtocolUDP) && p[l3+28]&0x08 != 0 {
+		port = binary.BigEndian.Uint16(p[l3+22 : l3+24])
+		vni = binary.BigEndian.Uint32(p[l3+32:l3+36]) >> 8
+		inner = l3 + 20 + 8 + 8
+	}
+
+	for _, c := range o.encapRx {
+		e := c.encap.rx
+		if c.Ns.GetVport() != m.VPort() || len(e.tags) != n {
+			continue
+		}
+		match := true
+		for i := range e.tags {
+			if e.tags[i] != tags[i] {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		dst := p[0:6]
+		if e.cmd.Vxlan != nil {
+			if inner < 0 || port != e.port || vni != e.cmd.Vxlan.Vni {
+				continue
+			}
+			dst = p[inner : inner+6]
+		}
+		if dst[0]&1 == 0 && !bytes.Equal(dst, c.Mac[:]) {
+			continue
+		}
+		if dst[0]&1 != 0 && e.cmd.Vxlan == nil && o.rxEncapOwned(m.VPort(), tags) {
+			return // broadcast or multicast of the namespace on these tags
+		}
+		if e.cmd.Vxlan != nil {
+			m.Adj(uint16(inner))
+		} else {
+			for i := 0; i < n; i++ {
+				m.PopVlan(12)
+			}
+		}
+		nsTags, vlans := nsTagsCnt(&c.Ns.Key)
+		for i := nsTags - 1; i >= 0; i-- {
+			m.PushVlan(12, vlans[i])
+		}
+		c.encap.rxMatched++
+		c.Ns.stats.rxEncapMatched++
+		return
+	}
+}
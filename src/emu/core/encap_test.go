@@ -0,0 +1,176 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/intel-go/fastjson"
+)
+
+func TestClientEncap1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000007, 0}})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	c := NewClient(ns, MACKey{0, 0, 1, 0, 0, 0}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 2})
+	ns.AddClient(c)
+
+	if c.SetEncap(&CClientEncapCmd{Tx: &CEncapCmd{Vlans: []uint16{1, 2, 3}}}) == nil ||
+		c.SetEncap(&CClientEncapCmd{Tx: &CEncapCmd{Vxlan: &CEncapVxlanCmd{Vni: 100}}}) == nil {
+		t.Fatalf(" invalid encapsulation should fail \n")
+	}
+
+	// sent on QinQ 20/30, the replies are expected untagged
+	err := c.SetEncap(&CClientEncapCmd{Tx: &CEncapCmd{Vlans: []uint16{20, 30}, Tpids: []uint16{0x88a8}}, Rx: &CEncapCmd{}})
+	if err != nil || tctx.encapCnt != 1 || len(tctx.encapRx) != 1 {
+		t.Fatalf(" set encapsulation failed %v \n", err)
+	}
+
+	frame := func(dst MACKey, tags ...uint32) *Mbuf {
+		m := tctx.MPool.Alloc(128)
+		m.SetVPort(1)
+		m.Append(dst[:])
+		m.Append([]byte{0, 0, 1, 0, 0, 0})
+		for _, tag := range tags {
+			var b [4]byte
+			binary.BigEndian.PutUint32(b[:], tag)
+			m.Append(b[:])
+		}
+		m.Append([]byte{0x08, 0x06})
+		m.Append(make([]byte, 28))
+		return m
+	}
+
+	m := frame(MACKey{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 0x81000007)
+	tctx.txEncap(m)
+	if p := m.GetData(); !bytes.Equal(p[12:22], []byte{0x88, 0xa8, 0, 20, 0x81, 0, 0, 30, 0x08, 0x06}) {
+		t.Fatalf(" bad tx encapsulation %x \n", p[:22])
+	}
+	m.FreeMbuf()
+
+	m = frame(c.Mac)
+	tctx.rxEncap(m)
+	if p := m.GetData(); !bytes.Equal(p[12:18], []byte{0x81, 0, 0, 7, 0x08, 0x06}) {
+		t.Fatalf(" reply should be moved to the namespace %x \n", p[:18])
+	}
+	m.FreeMbuf()
+
+	m = frame(MACKey{0, 0, 1, 0, 0, 9})
+	tctx.rxEncap(m)
+	if p := m.GetData(); len(p) != 42 {
+		t.Fatalf(" frame to another mac should not match %x \n", p)
+	}
+	m.FreeMbuf()
+
+	// sent untagged over vxlan 100, the replies are expected on vxlan 200
+	vx := &CEncapVxlanCmd{Vni: 100, Src: Ipv4Key{1, 1, 1, 1}, Dst: Ipv4Key{2, 2, 2, 2}, DstMac: MACKey{0, 0, 3, 0, 0, 0}}
+	c.SetEncap(&CClientEncapCmd{Tx: &CEncapCmd{Vxlan: vx}, Rx: &CEncapCmd{Vxlan: &CEncapVxlanCmd{Vni: 200}}})
+	if tctx.encapCnt != 1 || len(tctx.encapRx) != 1 {
+		t.Fatalf(" encapsulation should be replaced \n")
+	}
+	m = frame(c.Mac, 0x81000007)
+	tctx.txEncap(m)
+	p := append([]byte(nil), m.GetData()...)
+	m.FreeMbuf()
+	if len(p) != encapVxlanHdrLen+42 || binary.BigEndian.Uint16(p[36:38]) != ENCAP_VXLAN_PORT ||
+		binary.BigEndian.Uint32(p[46:50])>>8 != 100 || !bytes.Equal(p[encapVxlanHdrLen+12:encapVxlanHdrLen+14], []byte{0x08, 0x06}) {
+		t.Fatalf(" bad vxlan encapsulation %x \n", p)
+	}
+
+	// the reply is on vni 200
+	binary.BigEndian.PutUint32(p[46:50], 200<<8)
+	m = tctx.MPool.Alloc(128)
+	m.SetVPort(1)
+	m.Append(p)
+	tctx.rxEncap(m)
+	if q := m.GetData(); len(q) != 46 || !bytes.Equal(q[0:6], c.Mac[:]) || !bytes.Equal(q[12:14], []byte{0x81, 0}) {
+		t.Fatalf(" vxlan reply should be decapsulated %x \n", q)
+	}
+	m.FreeMbuf()
+
+	info := c.GetEncap()
+	if info.TxPkts != 1 || info.RxMatched != 1 || ns.stats.txEncap != 2 || ns.stats.rxEncapMatched != 2 {
+		t.Fatalf(" bad info %+v %+v \n", info, ns.stats)
+	}
+	c.SetEncap(nil)
+	if tctx.encapCnt != 0 || len(tctx.encapRx) != 0 || c.initCmd.Encap != nil {
+		t.Fatalf(" encapsulation should be removed \n")
+	}
+}
+
+func TestClientEncapAddError(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	ns.AddClient(NewClient(ns, MACKey{0, 0, 1, 0, 0, 0}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 2}))
+
+	// a client with the same mac is not added and should not keep its encapsulation
+	params := fastjson.RawMessage(`{"tun": {"vport": 1}, "clients": [{"mac": [0, 0, 1, 0, 0, 0],
+		"encap": {"tx": {"vlans": [20]}, "rx": {}}}]}`)
+	if _, err := (ApiClientAddHandler{}).ServeJSONRPC(tctx, &params); err == nil {
+		t.Fatalf(" client with the same mac should not be added \n")
+	}
+	if tctx.encapCnt != 0 || len(tctx.encapRx) != 0 {
+		t.Fatalf(" encapsulation of a client that was not added should be removed \n")
+	}
+}
+
+func TestClientEncapRxOwned(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key, key2 CTunnelKey
+	key.Set(&CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000007, 0}})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	c := NewClient(ns, MACKey{0, 0, 1, 0, 0, 0}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 2})
+	ns.AddClient(c)
+	c.SetEncap(&CClientEncapCmd{Rx: &CEncapCmd{Vlans: []uint16{20}}})
+
+	frame := func(dst MACKey) *Mbuf {
+		m := tctx.MPool.Alloc(128)
+		m.SetVPort(1)
+		m.Append(dst[:])
+		m.Append([]byte{0, 0, 1, 0, 0, 9, 0x81, 0, 0, 20, 0x08, 0x06})
+		m.Append(make([]byte, 28))
+		return m
+	}
+	bcast := MACKey{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	// no namespace on vlan 20, the broadcast is taken
+	m := frame(bcast)
+	tctx.rxEncap(m)
+	if p := m.GetData(); !bytes.Equal(p[12:16], []byte{0x81, 0, 0, 7}) {
+		t.Fatalf(" broadcast should be moved to the namespace %x \n", p[:16])
+	}
+	m.FreeMbuf()
+
+	// a namespace on vlan 20 keeps its broadcast, the unicast to the client is still taken
+	key2.Set(&CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000014, 0}})
+	tctx.AddNs(&key2, NewNSCtx(tctx, &key2))
+	m = frame(bcast)
+	tctx.rxEncap(m)
+	if p := m.GetData(); !bytes.Equal(p[12:16], []byte{0x81, 0, 0, 20}) {
+		t.Fatalf(" broadcast of another namespace should not be taken %x \n", p[:16])
+	}
+	m.FreeMbuf()
+	m = frame(c.Mac)
+	tctx.rxEncap(m)
+	if p := m.GetData(); !bytes.Equal(p[12:16], []byte{0x81, 0, 0, 7}) {
+		t.Fatalf(" unicast should be moved to the namespace %x \n", p[:16])
+	}
+	m.FreeMbuf()
+	if c.GetEncap().RxMatched != 2 {
+		t.Fatalf(" bad info %+v \n", c.GetEncap())
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+/* FCS of the received frames
+
+In case the input delivers the frames with the FCS (e.g. raw captures that retain it), the namespace
+could be configured to verify it like a NIC. A frame with a bad FCS is dropped before it is decoded
+and a sample of them is kept, the FCS of a good frame is removed.
+*/
+
+const (
+	FCS_LEN             = 4
+	FCS_ERR_MAX_SAMPLES = 256
+)
+
+// FcsCalc returns the ethernet FCS of a frame without the FCS
+func FcsCalc(frame []byte) uint32 {
+	return crc32.ChecksumIEEE(frame)
+}
+
+// FcsVerify verifies the FCS of a frame that ends with the FCS (little endian on the wire)
+func FcsVerify(frame []byte) bool {
+	n := len(frame)
+	if n < 14+FCS_LEN {
+		return false
+	}
+	return FcsCalc(frame[:n-FCS_LEN]) == binary.LittleEndian.Uint32(frame[n-FCS_LEN:])
+}
+
+// CFcsErrFrame a received frame with a bad FCS, see ctx_get_fcs_errors
+type CFcsErrFrame struct {
+	Vport    uint16 `json:"vport"`
+	Received uint32 `json:"received"` // the FCS of the frame
+	Expected uint32 `json:"expected"`
+	Data     []byte `json:"data"` // base64, with the FCS
+}
+
+// CFcsRx the FCS verification of a namespace, keeps one of every rate bad frames, the oldest
+// is replaced when size frames are kept
+type CFcsRx struct {
+	size   uint32
+	rate   uint32
+	cnt    uint64
+	frames []CFcsErrFrame
+}
+
+func (o *CFcsRx) onErr(vport uint16, p []byte) {
+	if o.size == 0 {
+		return
+	}
+	o.cnt++
+	if (o.cnt-1)%uint64(o.rate) != 0 {
+		return
+	}
+	var f CFcsErrFrame
+	f.Vport = vport
+	f.Data = append([]byte{}, p...)
+	if n := len(p); n >= FCS_LEN {
+		f.Received = binary.LittleEndian.Uint32(p[n-FCS_LEN:])
+		f.Expected = FcsCalc(p[:n-FCS_LEN])
+	}
+	if uint32(len(o.frames)) == o.size {
+		o.frames = append(o.frames[:0], o.frames[1:]...)
+	}
+	o.frames = append(o.frames, f)
+}
+
+// SetRxFcs sets whether the received frames of the namespace end with the FCS, the frames with a
+// bad FCS are dropped and size of them are sampled, one of every rate
+func (o *CNSCtx) SetRxFcs(enable bool, size, rate uint32) error {
+	if size > FCS_ERR_MAX_SAMPLES {
+		return fmt.Errorf("fcs errors sample size %d is bigger than %d", size, FCS_ERR_MAX_SAMPLES)
+	}
+	name := CAPTURE_FCS_ERRORS + " " + o.Key.StringRpc()
+	if !enable {
+		if o.fcs != nil {
+			o.ThreadCtx.fcsNs--
+			o.fcs = nil
+			o.ThreadCtx.captures.stop(name)
+		}
+		return nil
+	}
+	stop := func() {
+		if o.fcs != nil {
+			o.fcs.size = 0
+			o.fcs.frames = nil
+		}
+	}
+	if err := o.ThreadCtx.captures.start(name, size, stop); err != nil {
+		return err
+	}
+	if rate == 0 {
+		rate = 1
+	}
+	if o.fcs == nil {
+		o.ThreadCtx.fcsNs++
+	}
+	o.fcs = &CFcsRx{size: size, rate: rate}
+	return nil
+}
+
+// GetFcsErrors returns the sampled frames with a bad FCS, oldest first
+func (o *CNSCtx) GetFcsErrors(clear bool) []CFcsErrFrame {
+	r := make([]CFcsErrFrame, 0)
+	if o.fcs == nil {
+		return r
+	}
+	r = append(r, o.fcs.frames...)
+	if clear {
+		o.fcs.frames = nil
+	}
+	return r
+}
+
+// rxFcs verifies the FCS of a received frame of a namespace with FCS on rx, it returns false in
+// case the frame should be dropped. The FCS of a good frame is removed.
+func (o *CThreadCtx) rxFcs(m *Mbuf) bool {
+	if o.fcsNs == 0 {
+		return true
+	}
+	var key CTunnelKey
+	frameTunnelKey(m, &key)
+	ns := o.GetNs(&key)
+	if ns == nil || ns.fcs == nil {
+		return true
+	}
+	p := m.GetData()
+	if !m.IsContiguous() {
+		c := m.GetContiguous(&o.MPool)
+		defer c.FreeMbuf()
+		p = c.GetData()
+	}
+	if !FcsVerify(p) {
+		ns.stats.rxBadFcs++
+		ns.fcs.onErr(m.VPort(), p)
+		return false
+	}
+	ns.stats.rxFcsOk++
+	trimFcs(m)
+	return true
+}
+
+// trimFcs removes the FCS from the end of a frame, the segments that hold only FCS bytes are freed
+func trimFcs(m *Mbuf) {
+	n := uint16(FCS_LEN)
+	for {
+		last := m.LastSeg()
+		if last == m || last.DataLen() > n {
+			m.Trim(n)
+			return
+		}
+		n -= last.DataLen()
+		m.DetachLast().FreeMbuf()
+		if n == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestRxFcs1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+
+	if ns.SetRxFcs(true, FCS_ERR_MAX_SAMPLES+1, 0) == nil {
+		t.Fatalf(" sample size should be limited \n")
+	}
+	if ns.SetRxFcs(true, 2, 1) != nil || tctx.fcsNs != 1 || !ns.GetInfo().RxFcs {
+		t.Fatalf(" set rx fcs failed \n")
+	}
+
+	// an ARP frame with its FCS
+	f := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 1, 0, 0, 0, 0x08, 0x06, 0, 1, 8, 0, 6, 4, 0, 1}
+	f = append(f, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(f[len(f)-4:], FcsCalc(f[:len(f)-4]))
+	if !FcsVerify(f) {
+		t.Fatalf(" fcs should be valid \n")
+	}
+
+	rx := func(d []byte) (bool, uint16) {
+		m := tctx.MPool.Alloc(128)
+		m.SetVPort(1)
+		m.Append(d)
+		defer m.FreeMbuf()
+		return tctx.rxFcs(m), m.DataLen()
+	}
+	if ok, l := rx(f); !ok || l != uint16(len(f)-FCS_LEN) {
+		t.Fatalf(" good frame should be kept without the fcs %v %d \n", ok, l)
+	}
+	bad := append([]byte{}, f...)
+	bad[15] ^= 1
+	for i := 0; i < 3; i++ {
+		if ok, _ := rx(bad); ok {
+			t.Fatalf(" bad frame should be dropped \n")
+		}
+	}
+	if ns.stats.rxFcsOk != 1 || ns.stats.rxBadFcs != 3 {
+		t.Fatalf(" bad counters %+v \n", ns.stats)
+	}
+	e := ns.GetFcsErrors(true)
+	if len(e) != 2 || e[0].Expected == e[0].Received || len(ns.GetFcsErrors(false)) != 0 {
+		t.Fatalf(" bad sample %+v \n", e)
+	}
+
+	// a frame of segments, the FCS could span the last segments
+	rxSegs := func(d []byte, split int) (bool, uint32, bool) {
+		m := tctx.MPool.Alloc(128)
+		m.SetVPort(1)
+		m.Append(d[:split])
+		m1 := tctx.MPool.Alloc(128)
+		m1.Append(d[split:])
+		m.AppendMbuf(m1)
+		defer m.FreeMbuf()
+		return tctx.rxFcs(m), m.PktLen(), m.IsContiguous()
+	}
+	for _, split := range []int{len(f) - 10, len(f) - FCS_LEN, len(f) - 2} {
+		ok, l, c := rxSegs(f, split)
+		if !ok || l != uint32(len(f)-FCS_LEN) || c != (split == len(f)-FCS_LEN || split == len(f)-2) {
+			t.Fatalf(" good frame of segments should be kept without the fcs %d %v %d \n", split, ok, l)
+		}
+	}
+	if ok, _, _ := rxSegs(bad, len(bad)-10); ok || ns.stats.rxFcsOk != 4 || ns.stats.rxBadFcs != 4 {
+		t.Fatalf(" bad frame of segments should be dropped %+v \n", ns.stats)
+	}
+	if e = ns.GetFcsErrors(true); len(e) != 1 || len(e[0].Data) != len(bad) || e[0].Received != binary.LittleEndian.Uint32(bad[len(bad)-FCS_LEN:]) {
+		t.Fatalf(" bad sample of segments %+v \n", e)
+	}
+
+	ns.SetRxFcs(false, 0, 0)
+	if ok, l := rx(bad); !ok || l != uint16(len(bad)) || tctx.fcsNs != 0 {
+		t.Fatalf(" fcs should not be verified \n")
+	}
+}
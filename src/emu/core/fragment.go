@@ -0,0 +1,151 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"encoding/binary"
+	"external/google/gopacket/layers"
+	"math/rand"
+	"time"
+)
+
+/* IPv6 fragmentation of the tx side, the counterpart of the rx reassembly.
+It is used to test the reassembly of the DUT, the fragment size, the
+identification and overlapping fragments (negative testing, RFC 5722) are
+controlled by the caller. Only the IPv6 header is the unfragmentable part.
+Ipv4Fragment is a plain IPv4 fragmentation to a given MTU. */
+
+const (
+	FRAG_ID_SEQ    = 0 // sequential identification per generator
+	FRAG_ID_RANDOM = 1 // random identification
+
+	FRAG_OVERLAP_SIZE = 8 // bytes of the previous fragment repeated by an overlapping fragment
+)
+
+// CIpv6FragGen generator of IPv6 fragments, the identification is kept between packets
+type CIpv6FragGen struct {
+	Size    uint16 // payload bytes of each fragment, a multiple of 8. zero disables the fragmentation
+	Overlap bool   // each fragment except the first overlaps the previous one
+	IdMode  uint8  // FRAG_ID_SEQ or FRAG_ID_RANDOM
+	id      uint32
+	rnd     *rand.Rand
+}
+
+// SetCfg sets the generator, the size is rounded down to a multiple of 8
+func (o *CIpv6FragGen) SetCfg(size uint16, overlap bool, idMode uint8, simulation bool) {
+	o.Size = size &^ 0x7
+	o.Overlap = overlap
+	o.IdMode = idMode
+	if o.IdMode == FRAG_ID_RANDOM && o.rnd == nil {
+		seed := time.Now().UnixNano()
+		if simulation {
+			seed = 0x1234
+		}
+		o.rnd = rand.New(rand.NewSource(seed))
+	}
+}
+
+// IsEnabled returns true if packets bigger than the fragment size are fragmented
+func (o *CIpv6FragGen) IsEnabled() bool {
+	return o.Size > 0
+}
+
+func (o *CIpv6FragGen) nextId() uint32 {
+	if o.IdMode == FRAG_ID_RANDOM {
+		return o.rnd.Uint32()
+	}
+	o.id++
+	return o.id
+}
+
+// Fragment splits the packet p, l3 is the offset of the ipv6 header. It returns nil in case
+// the payload fits in one fragment. Each fragment is a copy of the L2 and IPv6 headers with a
+// fragment header and up to Size bytes of the payload.
+func (o *CIpv6FragGen) Fragment(p []byte, l3 uint16) [][]byte {
+	hdr := l3 + IPV6_HEADER_SIZE
+	if !o.IsEnabled() || len(p) <= int(hdr) {
+		return nil
+	}
+	payload := p[hdr:]
+	if len(payload) <= int(o.Size) {
+		return nil
+	}
+	id := o.nextId()
+	nh := p[l3+6]
+	var frags [][]byte
+	off := 0
+	for off < len(payload) {
+		start := off
+		if o.Overlap && off > 0 {
+			start -= FRAG_OVERLAP_SIZE
+		}
+		end := off + int(o.Size)
+		more := true
+		if end >= len(payload) {
+			end = len(payload)
+			more = false
+		}
+		f := make([]byte, 0, int(hdr)+8+end-start)
+		f = append(f, p[:hdr]...)
+		f = append(f, nh, 0, 0, 0, 0, 0, 0, 0)
+		f = append(f, payload[start:end]...)
+
+		fo := uint16(start) & 0xfff8
+		if more {
+			fo |= 0x1
+		}
+		fh := f[hdr : hdr+8]
+		binary.BigEndian.PutUint16(fh[2:4], fo)
+		binary.BigEndian.PutUint32(fh[4:8], id)
+
+		ipv6 := layers.IPv6Header(f[l3:hdr])
+		ipv6.SetNextHeader(IPV6_EXT_Fragment)
+		ipv6.SetPyloadLength(uint16(len(f) - int(hdr)))
+		frags = append(frags, f)
+		off = end
+	}
+	return frags
+}
+
+// Ipv4Fragment splits the packet p, l3 is the offset of the ipv4 header, so each fragment is up to
+// mtu bytes of L3. It returns nil in case the packet fits, has the DF bit or mtu is too small.
+// Each fragment is a copy of the L2 and IPv4 headers (with the options) and the identification
+// of the packet is kept.
+func Ipv4Fragment(p []byte, l3 uint16, mtu uint16) [][]byte {
+	if len(p) <= int(l3)+int(mtu) || len(p) < int(l3)+20 {
+		return nil
+	}
+	hlen := layers.IPv4Header(p[l3:]).GetHeaderLen()
+	hdr := l3 + hlen
+	if len(p) < int(hdr) || mtu < hlen+8 || (binary.BigEndian.Uint16(p[l3+6:l3+8])&0x4000) != 0 {
+		return nil
+	}
+	size := int(mtu-hlen) &^ 0x7
+	payload := p[hdr:]
+	var frags [][]byte
+	for off := 0; off < len(payload); off += size {
+		end := off + size
+		more := true
+		if end >= len(payload) {
+			end = len(payload)
+			more = false
+		}
+		f := make([]byte, 0, int(hdr)+end-off)
+		f = append(f, p[:hdr]...)
+		f = append(f, payload[off:end]...)
+
+		fo := uint16(off>>3) & 0x1fff
+		if more {
+			fo |= 0x2000
+		}
+		fh := layers.IPv4Header(f[l3:hdr])
+		binary.BigEndian.PutUint16(f[l3+6:l3+8], fo)
+		fh.SetLength(uint16(len(f) - int(l3)))
+		fh.UpdateChecksum()
+		frags = append(frags, f)
+	}
+	return frags
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"external/google/gopacket/layers"
+	"testing"
+)
+
+func fragTestPkt(l3 uint16, payload int) []byte {
+	p := make([]byte, int(l3)+IPV6_HEADER_SIZE+payload)
+	p[l3] = 0x60
+	p[l3+6] = 17 // udp
+	binary.BigEndian.PutUint16(p[l3+4:l3+6], uint16(payload))
+	for i := 0; i < payload; i++ {
+		p[int(l3)+IPV6_HEADER_SIZE+i] = byte(i)
+	}
+	return p
+}
+
+func fragTestCheck(t *testing.T, p []byte, l3 uint16, frags [][]byte, size int, overlap bool) uint32 {
+	hdr := int(l3) + IPV6_HEADER_SIZE
+	payload := p[hdr:]
+	res := make([]byte, len(payload))
+	var id uint32
+	next := 0
+	for i, f := range frags {
+		if f[l3+6] != IPV6_EXT_Fragment {
+			t.Fatalf(" bad next header %d \n", f[l3+6])
+		}
+		if int(binary.BigEndian.Uint16(f[l3+4:l3+6])) != len(f)-hdr {
+			t.Fatalf(" bad payload length \n")
+		}
+		fh := f[hdr : hdr+8]
+		if fh[0] != 17 {
+			t.Fatalf(" bad fragment next header %d \n", fh[0])
+		}
+		fo := binary.BigEndian.Uint16(fh[2:4])
+		off := int(fo & 0xfff8)
+		more := (fo & 1) == 1
+		if i == 0 {
+			id = binary.BigEndian.Uint32(fh[4:8])
+		} else if id != binary.BigEndian.Uint32(fh[4:8]) {
+			t.Fatalf(" identification should be the same for all the fragments \n")
+		}
+		if more != (i != len(frags)-1) {
+			t.Fatalf(" bad M flag, fragment %d \n", i)
+		}
+		expOff, expSize := next, size
+		if overlap && i > 0 {
+			expOff -= FRAG_OVERLAP_SIZE
+			expSize += FRAG_OVERLAP_SIZE
+		}
+		if off != expOff {
+			t.Fatalf(" bad offset %d expected %d \n", off, expOff)
+		}
+		data := f[hdr+8:]
+		if more && len(data) != expSize {
+			t.Fatalf(" bad fragment size %d \n", len(data))
+		}
+		copy(res[off:], data)
+		next = off + len(data)
+	}
+	if next != len(payload) || !bytes.Equal(res, payload) {
+		t.Fatalf(" fragments do not rebuild the packet \n")
+	}
+	return id
+}
+
+func TestIpv6Fragment1(t *testing.T) {
+	var l3 uint16 = 14
+	p := fragTestPkt(l3, 1000)
+
+	var gen CIpv6FragGen
+	if gen.Fragment(p, l3) != nil {
+		t.Fatalf(" fragmentation is disabled by default \n")
+	}
+	gen.SetCfg(403, false, FRAG_ID_SEQ, true)
+	if gen.Size != 400 {
+		t.Fatalf(" size should be a multiple of 8, %d \n", gen.Size)
+	}
+	frags := gen.Fragment(p, l3)
+	if len(frags) != 3 {
+		t.Fatalf(" expected 3 fragments, got %d \n", len(frags))
+	}
+	if fragTestCheck(t, p, l3, frags, 400, false) != 1 {
+		t.Fatalf(" sequential identification should start with 1 \n")
+	}
+	if fragTestCheck(t, p, l3, gen.Fragment(p, l3), 400, false) != 2 {
+		t.Fatalf(" sequential identification should be incremented \n")
+	}
+	if gen.Fragment(fragTestPkt(l3, 400), l3) != nil {
+		t.Fatalf(" a packet that fits should not be fragmented \n")
+	}
+
+	gen.SetCfg(256, true, FRAG_ID_SEQ, true)
+	frags = gen.Fragment(p, l3)
+	if len(frags) != 4 {
+		t.Fatalf(" expected 4 overlapping fragments, got %d \n", len(frags))
+	}
+	fragTestCheck(t, p, l3, frags, 256, true)
+
+	gen.SetCfg(256, false, FRAG_ID_RANDOM, true)
+	id1 := fragTestCheck(t, p, l3, gen.Fragment(p, l3), 256, false)
+	id2 := fragTestCheck(t, p, l3, gen.Fragment(p, l3), 256, false)
+	if id1 == id2 || id1 == 3 {
+		t.Fatalf(" random identification expected %d %d \n", id1, id2)
+	}
+}
+
+func TestIpv4Fragment1(t *testing.T) {
+	var l3 uint16 = 14
+	p := make([]byte, int(l3)+20+1000)
+	p[l3] = 0x45
+	binary.BigEndian.PutUint16(p[l3+4:l3+6], 0x1234)
+	for i := 0; i < 1000; i++ {
+		p[int(l3)+20+i] = byte(i)
+	}
+	if Ipv4Fragment(p, l3, 1500) != nil {
+		t.Fatalf(" a packet that fits should not be fragmented \n")
+	}
+	frags := Ipv4Fragment(p, l3, 403)
+	if len(frags) != 3 {
+		t.Fatalf(" expected 3 fragments, got %d \n", len(frags))
+	}
+	res := make([]byte, 0, 1000)
+	for i, f := range frags {
+		ipv4 := layers.IPv4Header(f[l3 : l3+20])
+		fo := binary.BigEndian.Uint16(f[l3+6 : l3+8])
+		more := (fo & 0x2000) != 0
+		if more != (i != len(frags)-1) || int(fo&0x1fff)*8 != len(res) {
+			t.Fatalf(" bad fragment offset/flags 0x%x, fragment %d \n", fo, i)
+		}
+		if binary.BigEndian.Uint16(f[l3+4:l3+6]) != 0x1234 || !ipv4.IsValidHeaderChecksum() {
+			t.Fatalf(" bad identification or checksum, fragment %d \n", i)
+		}
+		if int(ipv4.GetLength()) != len(f)-int(l3) || (more && len(f)-int(l3) != 20+376) {
+			t.Fatalf(" bad length %d, fragment %d \n", ipv4.GetLength(), i)
+		}
+		res = append(res, f[l3+20:]...)
+	}
+	if !bytes.Equal(res, p[l3+20:]) {
+		t.Fatalf(" fragments do not rebuild the packet \n")
+	}
+	binary.BigEndian.PutUint16(p[l3+6:l3+8], 0x4000)
+	if Ipv4Fragment(p, l3, 403) != nil {
+		t.Fatalf(" DF packet should not be fragmented \n")
+	}
+}
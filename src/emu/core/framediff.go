@@ -0,0 +1,182 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// keys of a frame, used to find the received frame to compare with
+const (
+	FRAME_KEY_DST_MAC  = "dst_mac"
+	FRAME_KEY_SRC_MAC  = "src_mac"
+	FRAME_KEY_ETH_TYPE = "eth_type" // the inner ethertype, after the vlan tags
+	FRAME_KEY_VPORT    = "vport"
+
+	RX_HISTORY_MAX_SIZE = 1024
+)
+
+// CRxFrame a received frame kept by the history
+type CRxFrame struct {
+	data  []byte
+	vport uint16
+	ticks uint64
+	ts    float64
+}
+
+// CRxHistory keeps the last received frames of the thread, disabled by default
+type CRxHistory struct {
+	frames []CRxFrame
+	next   int
+	cnt    int
+}
+
+// SetSize sets the number of frames to keep, zero disables the history. The frames are cleared.
+func (o *CRxHistory) SetSize(size uint32) error {
+	if size > RX_HISTORY_MAX_SIZE {
+		return fmt.Errorf("rx history size %d is bigger than %d", size, RX_HISTORY_MAX_SIZE)
+	}
+	o.frames = make([]CRxFrame, size)
+	o.next = 0
+	o.cnt = 0
+	return nil
+}
+
+// IsEnabled returns true if frames are kept
+func (o *CRxHistory) IsEnabled() bool {
+	return len(o.frames) > 0
+}
+
+// Add copies a received frame, the oldest is replaced
+func (o *CRxHistory) Add(m *Mbuf, ticks uint64, ts float64) {
+	f := &o.frames[o.next]
+	f.data = append(f.data[:0], m.GetData()...)
+	f.vport = m.VPort()
+	f.ticks = ticks
+	f.ts = ts
+	o.next = (o.next + 1) % len(o.frames)
+	if o.cnt < len(o.frames) {
+		o.cnt++
+	}
+}
+
+// frameEthType returns the ethertype after the vlan tags or -1 if the frame is too short
+func frameEthType(p []byte) int {
+	off := 12
+	for {
+		if len(p) < off+2 {
+			return -1
+		}
+		t := binary.BigEndian.Uint16(p[off : off+2])
+		if t != 0x8100 && t != 0x88a8 {
+			return int(t)
+		}
+		off += 4
+	}
+}
+
+func frameKeyMatch(key []string, expected []byte, f *CRxFrame, vport uint16) bool {
+	if len(f.data) < 14 {
+		return false
+	}
+	for _, k := range key {
+		switch k {
+		case FRAME_KEY_DST_MAC:
+			if !bytes.Equal(expected[0:6], f.data[0:6]) {
+				return false
+			}
+		case FRAME_KEY_SRC_MAC:
+			if !bytes.Equal(expected[6:12], f.data[6:12]) {
+				return false
+			}
+		case FRAME_KEY_ETH_TYPE:
+			if frameEthType(expected) != frameEthType(f.data) {
+				return false
+			}
+		case FRAME_KEY_VPORT:
+			if vport != f.vport {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// CFrameDiffByte a byte that is different, see ctx_frame_diff
+type CFrameDiffByte struct {
+	Offset   uint32 `json:"offset"`
+	Expected int    `json:"expected"` // -1 beyond the end of the expected frame
+	Received int    `json:"received"` // -1 beyond the end of the received frame
+}
+
+// CFrameDiff the result of a compare of an expected frame with the received one
+type CFrameDiff struct {
+	Found       bool             `json:"found"` // a received frame matched the key
+	Match       bool             `json:"match"` // the frames are identical
+	ExpectedLen uint32           `json:"expected_len"`
+	ReceivedLen uint32           `json:"received_len"`
+	Ticks       uint64           `json:"ticks"` // ticks of the received frame
+	Time        float64          `json:"time"`  // timestamp of the received frame, see TS_SOURCE_MONO
+	Diffs       []CFrameDiffByte `json:"diffs"`
+	Truncated   bool             `json:"truncated"` // there are more diffs than maxDiffs
+}
+
+// Compare looks for the most recent received frame that matches the key of the expected frame and
+// compares it byte by byte, up to maxDiffs bytes are reported
+func (o *CRxHistory) Compare(expected []byte, key []string, vport uint16, maxDiffs int) (*CFrameDiff, error) {
+	if len(expected) < 14 {
+		return nil, fmt.Errorf("expected frame is too short, %d bytes", len(expected))
+	}
+	for _, k := range key {
+		switch k {
+		case FRAME_KEY_DST_MAC, FRAME_KEY_SRC_MAC, FRAME_KEY_ETH_TYPE, FRAME_KEY_VPORT:
+		default:
+			return nil, fmt.Errorf("invalid frame key '%s'", k)
+		}
+	}
+	res := &CFrameDiff{ExpectedLen: uint32(len(expected)), Diffs: make([]CFrameDiffByte, 0)}
+	var f *CRxFrame
+	for i := 1; i <= o.cnt; i++ {
+		e := &o.frames[(o.next-i+len(o.frames))%len(o.frames)]
+		if frameKeyMatch(key, expected, e, vport) {
+			f = e
+			break
+		}
+	}
+	if f == nil {
+		return res, nil
+	}
+	res.Found = true
+	res.ReceivedLen = uint32(len(f.data))
+	res.Ticks = f.ticks
+	res.Time = f.ts
+
+	n := len(expected)
+	if len(f.data) > n {
+		n = len(f.data)
+	}
+	for i := 0; i < n; i++ {
+		d := CFrameDiffByte{Offset: uint32(i), Expected: -1, Received: -1}
+		if i < len(expected) {
+			d.Expected = int(expected[i])
+		}
+		if i < len(f.data) {
+			d.Received = int(f.data[i])
+		}
+		if d.Expected == d.Received {
+			continue
+		}
+		if len(res.Diffs) == maxDiffs {
+			res.Truncated = true
+			break
+		}
+		res.Diffs = append(res.Diffs, d)
+	}
+	res.Match = len(res.Diffs) == 0
+	return res, nil
+}
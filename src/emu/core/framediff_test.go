@@ -0,0 +1,95 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/intel-go/fastjson"
+)
+
+func TestFrameDiff1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+
+	arp := []byte{0, 0, 2, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0x81, 0, 0, 1, 0x08, 0x06, 0, 1, 0x08, 0, 6, 4}
+	ipv4 := []byte{0, 0, 2, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0x08, 0x00, 0x45, 0, 0, 20}
+	other := append([]byte{}, arp...)
+	other[11] = 9
+
+	var p ApiFrameDiffParams
+	p.Frame = arp
+	if _, err := (ApiFrameDiffHandler{}).ServeJSONRPC(tctx, frameDiffParams(&p)); err == nil {
+		t.Fatalf(" history should be disabled by default \n")
+	}
+	if tctx.rxHistory.SetSize(RX_HISTORY_MAX_SIZE+1) == nil {
+		t.Fatalf(" size should be limited \n")
+	}
+	tctx.rxHistory.SetSize(3)
+	for _, f := range [][]byte{arp, ipv4, other, ipv4} {
+		m := tctx.MPool.Alloc(uint16(len(f)))
+		m.Append(f)
+		tctx.HandleRxPacket(m)
+	}
+
+	// the first arp frame was replaced, the other one has a different source
+	p.Key = []string{FRAME_KEY_ETH_TYPE, FRAME_KEY_SRC_MAC}
+	res := frameDiffServe(t, tctx, &p)
+	if res.Found {
+		t.Fatalf(" unexpected frame %+v \n", res)
+	}
+
+	p.Key = []string{FRAME_KEY_ETH_TYPE}
+	res = frameDiffServe(t, tctx, &p)
+	if !res.Found || res.Match || len(res.Diffs) != 1 || res.Diffs[0].Offset != 11 || res.Diffs[0].Received != 9 {
+		t.Fatalf(" bad diff %+v \n", res)
+	}
+	if res.ExpectedLen != 24 || res.ReceivedLen != 24 {
+		t.Fatalf(" bad length %+v \n", res)
+	}
+
+	p.Frame = append([]byte{}, ipv4...)
+	p.Key = nil
+	res = frameDiffServe(t, tctx, &p)
+	if !res.Found || !res.Match {
+		t.Fatalf(" identical frames %+v \n", res)
+	}
+
+	p.Frame = append(p.Frame, 1, 2)
+	p.Frame[0] = 0xff
+	p.MaxDiffs = 2
+	res = frameDiffServe(t, tctx, &p)
+	if res.Match || !res.Truncated || len(res.Diffs) != 2 || res.Diffs[1].Offset != 18 || res.Diffs[1].Received != -1 {
+		t.Fatalf(" bad diff %+v \n", res)
+	}
+
+	p.Key = []string{"ttl"}
+	if _, err := (ApiFrameDiffHandler{}).ServeJSONRPC(tctx, frameDiffParams(&p)); err == nil {
+		t.Fatalf(" invalid key should be rejected \n")
+	}
+}
+
+func frameDiffParams(p *ApiFrameDiffParams) *fastjson.RawMessage {
+	s := fmt.Sprintf(`{"frame": "%s", "max_diffs": %d, "key": [`, base64.StdEncoding.EncodeToString(p.Frame), p.MaxDiffs)
+	for i, k := range p.Key {
+		if i > 0 {
+			s += ","
+		}
+		s += fmt.Sprintf(`"%s"`, k)
+	}
+	raw := fastjson.RawMessage(s + "]}")
+	return &raw
+}
+
+func frameDiffServe(t *testing.T, tctx *CThreadCtx, p *ApiFrameDiffParams) *CFrameDiff {
+	res, err := (ApiFrameDiffHandler{}).ServeJSONRPC(tctx, frameDiffParams(p))
+	if err != nil {
+		t.Fatalf(" frame diff failed %v \n", err)
+	}
+	return res.(*CFrameDiff)
+}
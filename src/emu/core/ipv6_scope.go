@@ -0,0 +1,178 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+/* IPv6 scope filtering on rx
+
+The rx path accepts any IPv6 source and destination. A client with scope filtering models a compliant
+host that drops a received packet whose addresses are not valid on the link (RFC 4291, RFC 4007):
+the loopback address, a multicast source, an interface-local (or reserved) multicast destination, or
+a source of a limited scope (link-local, site-local) toward a destination of a larger scope. The
+drops are counted per scope and the last violations are kept. The unicast packets are checked for
+the client of the destination MAC, the multicast packets in case a client of the namespace filters.
+*/
+
+const (
+	IPV6_SCOPE_LOOPBACK   = "loopback"
+	IPV6_SCOPE_MCAST_SRC  = "multicast_src"
+	IPV6_SCOPE_IF_LOCAL   = "interface_local"
+	IPV6_SCOPE_LINK_LOCAL = "link_local"
+	IPV6_SCOPE_SITE_LOCAL = "site_local"
+
+	IPV6_SCOPE_MAX_SAMPLES = 16
+
+	ipv6ScopeLink   = 0x2
+	ipv6ScopeSite   = 0x5
+	ipv6ScopeGlobal = 0xe
+)
+
+// CIpv6ScopeViolation a dropped packet, see ctx_get_ipv6_scope
+type CIpv6ScopeViolation struct {
+	Mac   MACKey  `json:"mac"` // the client, zero for multicast
+	Src   Ipv6Key `json:"src"`
+	Dst   Ipv6Key `json:"dst"`
+	Scope string  `json:"scope"` // see IPV6_SCOPE_LINK_LOCAL
+	Time  float64 `json:"time"`
+}
+
+// CIpv6ScopeInfo the scope filtering of a namespace
+type CIpv6ScopeInfo struct {
+	Clients uint32                `json:"clients"` // clients with scope filtering
+	Drops   uint64                `json:"drops"`
+	Samples []CIpv6ScopeViolation `json:"samples"` // the last violations, oldest first
+}
+
+// CIpv6ScopeRx the scope filtering of a namespace
+type CIpv6ScopeRx struct {
+	clients uint32
+	drops   uint64
+	samples []CIpv6ScopeViolation
+}
+
+func ipv6IsLoopback(a *Ipv6Key) bool {
+	for i := 0; i < 15; i++ {
+		if a[i] != 0 {
+			return false
+		}
+	}
+	return a[15] == 1
+}
+
+// ipv6Scope returns the scope of a unicast or multicast address, the unique local addresses are
+// global (RFC 4193)
+func ipv6Scope(a *Ipv6Key) uint8 {
+	switch {
+	case a[0] == 0xff:
+		return a[1] & 0xf
+	case a[0] == 0xfe && a[1]&0xc0 == 0x80:
+		return ipv6ScopeLink
+	case a[0] == 0xfe && a[1]&0xc0 == 0xc0:
+		return ipv6ScopeSite
+	}
+	return ipv6ScopeGlobal
+}
+
+// Ipv6ScopeViolation returns the scope that a received packet violates, empty in case it is valid
+func Ipv6ScopeViolation(src, dst *Ipv6Key) string {
+	switch {
+	case ipv6IsLoopback(src) || ipv6IsLoopback(dst):
+		return IPV6_SCOPE_LOOPBACK
+	case src[0] == 0xff:
+		return IPV6_SCOPE_MCAST_SRC
+	case dst[0] == 0xff && dst[1]&0xf <= 1:
+		return IPV6_SCOPE_IF_LOCAL
+	case src.IsZero():
+		return "" // DAD and MLD before an address is assigned
+	}
+	s := ipv6Scope(src)
+	if s < ipv6Scope(dst) {
+		switch s {
+		case ipv6ScopeLink:
+			return IPV6_SCOPE_LINK_LOCAL
+		case ipv6ScopeSite:
+			return IPV6_SCOPE_SITE_LOCAL
+		}
+	}
+	return ""
+}
+
+// SetIpv6ScopeFilter sets whether the client drops the received packets that violate the scope
+// of their addresses
+func (o *CClient) SetIpv6ScopeFilter(enable bool) {
+	if o.ipv6Scope == enable {
+		return
+	}
+	if enable {
+		o.Ns.scope.clients++
+		o.Ns.ThreadCtx.scopeCnt++
+	} else {
+		o.Ns.scope.clients--
+		o.Ns.ThreadCtx.scopeCnt--
+	}
+	o.ipv6Scope = enable
+	o.initCmd.Ipv6ScopeFilter = enable
+}
+
+// GetIpv6Scope returns the scope filtering of the namespace
+func (o *CNSCtx) GetIpv6Scope(clear bool) *CIpv6ScopeInfo {
+	res := &CIpv6ScopeInfo{Clients: o.scope.clients, Drops: o.scope.drops}
+	res.Samples = append([]CIpv6ScopeViolation{}, o.scope.samples...)
+	if clear {
+		o.scope.samples = nil
+	}
+	return res
+}
+
+func (o *CNSCtx) onIpv6ScopeViolation(c *CClient, src, dst *Ipv6Key, scope string) {
+	switch scope {
+	case IPV6_SCOPE_LOOPBACK:
+		o.stats.rxScopeLoopback++
+	case IPV6_SCOPE_MCAST_SRC:
+		o.stats.rxScopeMcastSrc++
+	case IPV6_SCOPE_IF_LOCAL:
+		o.stats.rxScopeIfLocal++
+	case IPV6_SCOPE_LINK_LOCAL:
+		o.stats.rxScopeLinkLocal++
+	case IPV6_SCOPE_SITE_LOCAL:
+		o.stats.rxScopeSiteLocal++
+	}
+	o.scope.drops++
+	v := CIpv6ScopeViolation{Src: *src, Dst: *dst, Scope: scope, Time: o.Timestamp()}
+	if c != nil {
+		v.Mac = c.Mac
+	}
+	if len(o.scope.samples) == IPV6_SCOPE_MAX_SAMPLES {
+		o.scope.samples = append(o.scope.samples[:0], o.scope.samples[1:]...)
+	}
+	o.scope.samples = append(o.scope.samples, v)
+}
+
+// rxIpv6Scope checks the scope of the addresses of a received IPv6 packet at l3, it returns false in
+// case the packet should be dropped
+func (o *CThreadCtx) rxIpv6Scope(tun *CTunnelKey, p []byte, l3 uint16) bool {
+	ns := o.GetNs(tun)
+	if ns == nil || ns.scope.clients == 0 {
+		return true
+	}
+	var c *CClient
+	if p[0]&1 == 0 {
+		var mac MACKey
+		copy(mac[:], p[0:6])
+		c = ns.CLookupByMac(&mac)
+		if c == nil || !c.ipv6Scope {
+			return true
+		}
+	}
+	var src, dst Ipv6Key
+	copy(src[:], p[l3+8:l3+24])
+	copy(dst[:], p[l3+24:l3+40])
+	scope := Ipv6ScopeViolation(&src, &dst)
+	if scope == "" {
+		return true
+	}
+	ns.onIpv6ScopeViolation(c, &src, &dst, scope)
+	return false
+}
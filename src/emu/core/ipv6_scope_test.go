@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/intel-go/fastjson"
+)
+
+func TestIpv6ScopeViolation1(t *testing.T) {
+	vec := []struct {
+		src, dst string
+		scope    string
+	}{
+		{"fe80::1", "fe80::2", ""},
+		{"fe80::1", "ff02::1", ""},
+		{"2001:db8::1", "fe80::2", ""},
+		{"::", "ff02::1:ff00:1", ""},
+		{"fd00::1", "2001:db8::1", ""},
+		{"::1", "2001:db8::1", IPV6_SCOPE_LOOPBACK},
+		{"ff02::1", "fe80::2", IPV6_SCOPE_MCAST_SRC},
+		{"fe80::1", "ff01::1", IPV6_SCOPE_IF_LOCAL},
+		{"fe80::1", "2001:db8::1", IPV6_SCOPE_LINK_LOCAL},
+		{"fe80::1", "ff05::2", IPV6_SCOPE_LINK_LOCAL},
+		{"fec0::1", "2001:db8::1", IPV6_SCOPE_SITE_LOCAL},
+		{"fec0::1", "fec0::2", ""},
+	}
+	for _, e := range vec {
+		src, dst := parseIpv6(e.src), parseIpv6(e.dst)
+		if s := Ipv6ScopeViolation(&src, &dst); s != e.scope {
+			t.Fatalf(" %s -> %s should be %q not %q \n", e.src, e.dst, e.scope, s)
+		}
+	}
+}
+
+func TestClientIpv6Scope(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	c1 := NewClient(ns, MACKey{0, 0, 1, 0, 0, 1}, Ipv4Key{}, parseIpv6("2001:db8::1"), Ipv4Key{})
+	c2 := NewClient(ns, MACKey{0, 0, 1, 0, 0, 2}, Ipv4Key{}, parseIpv6("2001:db8::2"), Ipv4Key{})
+	ns.AddClient(c1)
+	ns.AddClient(c2)
+
+	frame := func(dmac MACKey, src, dst string) []byte {
+		p := make([]byte, 14+40)
+		copy(p[0:6], dmac[:])
+		s, d := parseIpv6(src), parseIpv6(dst)
+		copy(p[14+8:], s[:])
+		copy(p[14+24:], d[:])
+		return p
+	}
+
+	if !tctx.rxIpv6Scope(&key, frame(c1.Mac, "fe80::1", "2001:db8::1"), 14) {
+		t.Fatalf(" clients without scope filtering accept any packet \n")
+	}
+	c1.SetIpv6ScopeFilter(true)
+	if tctx.rxIpv6Scope(&key, frame(c1.Mac, "fe80::1", "2001:db8::1"), 14) ||
+		!tctx.rxIpv6Scope(&key, frame(c2.Mac, "fe80::1", "2001:db8::2"), 14) ||
+		!tctx.rxIpv6Scope(&key, frame(c1.Mac, "2001:db8::9", "2001:db8::1"), 14) ||
+		tctx.rxIpv6Scope(&key, frame(MACKey{0x33, 0x33, 0, 0, 0, 1}, "ff02::5", "ff02::1"), 14) {
+		t.Fatalf(" bad scope filtering \n")
+	}
+
+	info := ns.GetIpv6Scope(true)
+	if info.Clients != 1 || info.Drops != 2 || len(info.Samples) != 2 || info.Samples[0].Mac != c1.Mac ||
+		info.Samples[1].Scope != IPV6_SCOPE_MCAST_SRC || ns.stats.rxScopeLinkLocal != 1 || ns.stats.rxScopeMcastSrc != 1 {
+		t.Fatalf(" bad info %+v \n", info)
+	}
+	if len(ns.GetIpv6Scope(false).Samples) != 0 {
+		t.Fatalf(" samples should be cleared \n")
+	}
+
+	ns.RemoveClient(c1)
+	if tctx.scopeCnt != 0 || ns.scope.clients != 0 {
+		t.Fatalf(" scope filtering should be removed with the client \n")
+	}
+}
+
+func TestClientIpv6ScopeAddError(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	ns.AddClient(NewClient(ns, MACKey{0, 0, 1, 0, 0, 1}, Ipv4Key{}, parseIpv6("2001:db8::1"), Ipv4Key{}))
+
+	// a client with the same mac is not added and should not keep its scope filtering
+	params := fastjson.RawMessage(`{"tun": {"vport": 1}, "clients": [{"mac": [0, 0, 1, 0, 0, 1],
+		"ipv6_scope_filter": true}]}`)
+	if _, err := (ApiClientAddHandler{}).ServeJSONRPC(tctx, &params); err == nil {
+		t.Fatalf(" client with the same mac should not be added \n")
+	}
+	if tctx.scopeCnt != 0 || ns.scope.clients != 0 {
+		t.Fatalf(" scope filtering of a client that was not added should be removed \n")
+	}
+}
@@ -6,6 +6,7 @@
 package core
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"unsafe"
@@ -389,6 +390,35 @@ func (o *Mbuf) Prepend(d []byte) {
 	copy(o.data[o.dataOff:], d)
 }
 
+// PushVlan inserts a vlan tag (tpid<<16 | tci) at offset off of the first segment, 12 for the outer
+// tag. It returns false in case there is not enough headroom.
+func (o *Mbuf) PushVlan(off uint16, tag uint32) bool {
+	if o.dataOff < 4 || off > o.dataLen {
+		return false
+	}
+	o.dataOff -= 4
+	o.dataLen += 4
+	o.pktLen += 4
+	p := o.data[o.dataOff:]
+	copy(p[:off], p[4:4+off])
+	binary.BigEndian.PutUint32(p[off:off+4], tag)
+	return true
+}
+
+// PopVlan removes the vlan tag at offset off of the first segment, 12 for the outer tag. It returns
+// false in case the segment is too short.
+func (o *Mbuf) PopVlan(off uint16) bool {
+	if off+4 > o.dataLen {
+		return false
+	}
+	p := o.data[o.dataOff:]
+	copy(p[4:4+off], p[:off])
+	o.dataOff += 4
+	o.dataLen -= 4
+	o.pktLen -= 4
+	return true
+}
+
 //GetData return the byte stream of current object
 func (o *Mbuf) GetData() []byte {
 	return o.data[o.dataOff:(o.dataOff + o.dataLen)]
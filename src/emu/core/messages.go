@@ -1,5 +1,10 @@
 package core
 
+import (
+	"fmt"
+	"net"
+)
+
 const (
 	RESOLVED_IPV4_DG_MAC = 1 << iota // Flag to indicate the IPv4 default gateway mac was resolved
 	RESOLVED_IPV6_DG_MAC             // Flag to indicate the IPv6 default gateway mac was resolved
@@ -12,4 +17,136 @@ const (
 	MSG_UPDATE_DGIPV4_ADDR = "update_dgipv4"   // client plugin, DG ipv4 addr was changed (oldIpv4, NewIpv4 from type Ipv4Key )
 	MSG_UPDATE_DGIPV6_ADDR = "update_dgipv6"   // client plugin, DG ipv4 addr was changed (oldIpv6, NewIpv6 from type Ipv6Key )
 	MSG_DG_MAC_RESOLVED    = "dg_mac_resolved" // client plugin, DG MAC was resolved. When sending this message, the first broadcast parameter `a` is a bit mask of the previous flags.
+	MSG_ARP_FLAP           = "arp_flap"        // ns plugin, ARP entry flapped at or above the flap threshold (ipv4 from type Ipv4Key, flaps uint32)
+	MSG_ND_FLAP            = "nd_flap"         // ns plugin, ND entry flapped at or above the flap threshold (ipv6 from type Ipv6Key, flaps uint32)
+	MSG_ARP_RX             = "arp_rx"          // ns plugin, ARP packet was received (*CArpRx), used for address conflict detection
+	MSG_ARP_GARP           = "arp_garp"        // ns plugin, gratuitous ARP of a neighbor was received (*CNeighborAnnounce)
+	MSG_ND_UNSOLICITED_NA  = "nd_una"          // ns plugin, unsolicited NA of a neighbor was received (*CNeighborAnnounce)
+	MSG_UPDATE_ROUTES      = "update_routes"   // client plugin, the static routes were replaced (old, new from type []*CClientRoute)
+	MSG_LINK_UP            = "link_up"         // client plugin, the link of the client is up again after a link change, e.g. a flap (no arguments)
+	MSG_DF_DROP            = "df_drop"         // ns plugin, packets with DF bigger than the max packet size are dropped, once for each flow template (*CDfDrop)
+	MSG_RATE_SHORTFALL     = "rate_shortfall"  // ns plugin, a flow is below its requested rate for a window (*CRateShortfall)
+	MSG_CAPTURE_REJECT     = "capture_reject"  // thread plugin, a capture was rejected by the limits (*CCaptureReject)
+)
+
+// CNeighborAnnounce a neighbor announced its address (gratuitous ARP, unsolicited NA),
+// argument of MSG_ARP_GARP and MSG_ND_UNSOLICITED_NA
+type CNeighborAnnounce struct {
+	Time    float64 `json:"time"` // seconds, by the timestamp source of the namespace
+	Ip      net.IP  `json:"ip"`
+	Mac     MACKey  `json:"mac"`
+	Changed bool    `json:"changed"` // the cache had a different MAC for this address, e.g. failover
+}
+
+// CDfDrop packets of a flow with the DF bit that are bigger than the max packet size, argument of MSG_DF_DROP
+type CDfDrop struct {
+	Src  MACKey
+	Dst  MACKey
+	Size uint16 // L3
+	Mtu  uint16
+	Pkts uint32
+}
+
+// CRateShortfall the achieved rate of a flow in a window, argument of MSG_RATE_SHORTFALL
+type CRateShortfall struct {
+	Src         MACKey
+	Dst         MACKey
+	Pps         float64 // requested
+	AchievedPps float64
+}
+
+// CArpRx the fields of a received ARP packet, argument of MSG_ARP_RX
+type CArpRx struct {
+	Operation uint16
+	SrcMac    MACKey
+	SrcIpv4   Ipv4Key
+	DstIpv4   Ipv4Key
+}
+
+const (
+	ANNOUNCE_POLICY_LEARN  = 0 // update the cache entry or add a new one (default)
+	ANNOUNCE_POLICY_UPDATE = 1 // update only an existing cache entry
+	ANNOUNCE_POLICY_IGNORE = 2 // count and report, do not touch the cache
+
+	neighborAnnounceLogSize = 64
 )
+
+// ParseAnnouncePolicy converts "learn", "update" or "ignore" to ANNOUNCE_POLICY_xx, empty is learn
+func ParseAnnouncePolicy(s string) (uint8, error) {
+	switch s {
+	case "", "learn":
+		return ANNOUNCE_POLICY_LEARN, nil
+	case "update":
+		return ANNOUNCE_POLICY_UPDATE, nil
+	case "ignore":
+		return ANNOUNCE_POLICY_IGNORE, nil
+	}
+	return ANNOUNCE_POLICY_LEARN, fmt.Errorf("invalid announce policy %q, should be learn, update or ignore", s)
+}
+
+const (
+	OFF_SUBNET_ANSWER = 0 // answer the ARP/ND requests of hosts outside the subnet of the client (default)
+	OFF_SUBNET_IGNORE = 1 // do not answer them, for testing of subnet misconfiguration
+)
+
+// ParseOffSubnetPolicy converts "answer" or "ignore" to OFF_SUBNET_xx, empty is answer
+func ParseOffSubnetPolicy(s string) (uint8, error) {
+	switch s {
+	case "", "answer":
+		return OFF_SUBNET_ANSWER, nil
+	case "ignore":
+		return OFF_SUBNET_IGNORE, nil
+	}
+	return OFF_SUBNET_ANSWER, fmt.Errorf("invalid off subnet policy %q, should be answer or ignore", s)
+}
+
+const (
+	ICMP_SRC_ALLOW_ALL = 0 // answer the ICMP queries of any source (default)
+	ICMP_SRC_ON_LINK   = 1 // answer only the sources on the link of the client, a host with a local firewall
+	ICMP_SRC_DENY_ALL  = 2 // do not answer the ICMP queries
+)
+
+// ParseIcmpSrcPolicy converts "allow_all", "on_link" or "deny_all" to ICMP_SRC_xx, empty is allow_all
+func ParseIcmpSrcPolicy(s string) (uint8, error) {
+	switch s {
+	case "", "allow_all":
+		return ICMP_SRC_ALLOW_ALL, nil
+	case "on_link":
+		return ICMP_SRC_ON_LINK, nil
+	case "deny_all":
+		return ICMP_SRC_DENY_ALL, nil
+	}
+	return ICMP_SRC_ALLOW_ALL, fmt.Errorf("invalid icmp source policy %q, should be allow_all, on_link or deny_all", s)
+}
+
+// CNeighborAnnounceLog keeps the last announcements
+type CNeighborAnnounceLog struct {
+	vec []CNeighborAnnounce
+	cnt uint64
+}
+
+func (o *CNeighborAnnounceLog) Add(ev *CNeighborAnnounce) {
+	if len(o.vec) < neighborAnnounceLogSize {
+		o.vec = append(o.vec, *ev)
+	} else {
+		o.vec[o.cnt%neighborAnnounceLogSize] = *ev
+	}
+	o.cnt++
+}
+
+// Get returns the last announcements, oldest first
+func (o *CNeighborAnnounceLog) Get() []CNeighborAnnounce {
+	r := make([]CNeighborAnnounce, 0, len(o.vec))
+	if len(o.vec) < neighborAnnounceLogSize {
+		return append(r, o.vec...)
+	}
+	i := int(o.cnt % neighborAnnounceLogSize)
+	r = append(r, o.vec[i:]...)
+	return append(r, o.vec[:i]...)
+}
+
+// Clear removes all the announcements
+func (o *CNeighborAnnounceLog) Clear() {
+	o.vec = nil
+	o.cnt = 0
+}
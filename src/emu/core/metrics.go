@@ -0,0 +1,192 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* Prometheus text exposition of the counters tree
+
+emu_<db>_<counter>{labels} value
+
+thread counters have no labels, namespace counters have the ns label (vport:tci0:tci1)
+plugin counters have the ns and plugin labels. Client plugin counters are aggregated
+per namespace, the client label (MAC) is added only when asked for, as it is unbounded.
+*/
+
+const METRICS_PREFIX = "emu_"
+
+// IPluginCounters is implemented by plugins that expose their counters for the metrics export
+type IPluginCounters interface {
+	GetCounterDbVec() *CCounterDbVec
+}
+
+type metricSample struct {
+	labels string
+	val    float64
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+	index   map[string]int // labels -> sample, for aggregation
+}
+
+// CMetrics builds the text of the export
+type CMetrics struct {
+	zero     bool
+	families []*metricFamily
+	index    map[string]*metricFamily
+}
+
+func NewMetrics(zero bool) *CMetrics {
+	o := new(CMetrics)
+	o.zero = zero
+	o.index = make(map[string]*metricFamily)
+	return o
+}
+
+func metricName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func metricLabelValue(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return strings.Replace(s, "\n", `\n`, -1)
+}
+
+func counterValue(rec *CCounterRec) (float64, bool) {
+	switch v := rec.Counter.(type) {
+	case *uint32:
+		return float64(*v), true
+	case *uint64:
+		return float64(*v), true
+	case *float32:
+		return float64(*v), true
+	case *float64:
+		return *v, true
+	}
+	return 0, false
+}
+
+// AddDb adds the counters of a database, samples with the same labels are summed
+func (o *CMetrics) AddDb(db *CCounterDb, labels string) {
+	if db.IOpt != nil {
+		db.IOpt.PreUpdate()
+	}
+	for _, rec := range db.Vec {
+		val, ok := counterValue(rec)
+		if !ok {
+			continue
+		}
+		name := METRICS_PREFIX + metricName(db.Name+"_"+rec.Name)
+		f, ok := o.index[name]
+		if !ok {
+			f = &metricFamily{name: name, help: rec.Help, index: make(map[string]int)}
+			o.index[name] = f
+			o.families = append(o.families, f)
+		}
+		if i, ok := f.index[labels]; ok {
+			f.samples[i].val += val
+		} else {
+			f.index[labels] = len(f.samples)
+			f.samples = append(f.samples, metricSample{labels: labels, val: val})
+		}
+	}
+}
+
+// AddDbVec adds the counters of all the databases
+func (o *CMetrics) AddDbVec(vec *CCounterDbVec, labels string) {
+	for _, db := range vec.Vec {
+		o.AddDb(db, labels)
+	}
+}
+
+// AddPlugins adds the counters of the plugins that implement IPluginCounters
+func (o *CMetrics) AddPlugins(ctx *PluginCtx, labels string) {
+	names := ctx.GetAllPlugNames()
+	sort.Strings(names)
+	for _, name := range names {
+		plug := ctx.Get(name)
+		if plug == nil {
+			continue
+		}
+		if c, ok := plug.Ext.(IPluginCounters); ok {
+			if vec := c.GetCounterDbVec(); vec != nil {
+				o.AddDbVec(vec, labels+`,plugin="`+metricLabelValue(name)+`"`)
+			}
+		}
+	}
+}
+
+// String returns the text exposition format
+func (o *CMetrics) String() string {
+	var b bytes.Buffer
+	for _, f := range o.families {
+		first := true
+		for _, s := range f.samples {
+			if s.val == 0 && !o.zero {
+				continue
+			}
+			if first {
+				fmt.Fprintf(&b, "# HELP %s %s\n", f.name, strings.Replace(strings.TrimSpace(f.help), "\n", " ", -1))
+				fmt.Fprintf(&b, "# TYPE %s untyped\n", f.name)
+				first = false
+			}
+			labels := strings.TrimPrefix(s.labels, ",")
+			if labels != "" {
+				labels = "{" + labels + "}"
+			}
+			fmt.Fprintf(&b, "%s%s %s\n", f.name, labels, strconv.FormatFloat(s.val, 'f', -1, 64))
+		}
+	}
+	return b.String()
+}
+
+func nsMetricLabel(ns *CNSCtx) string {
+	var d CTunnelDataJson
+	ns.Key.GetJson(&d)
+	return fmt.Sprintf(`ns="%d:%d:%d"`, d.Vport, d.Tci[0], d.Tci[1])
+}
+
+// GetMetrics exports the counters of the thread, the namespaces and the plugins.
+// Client plugin counters are summed per namespace unless clients is true.
+func (o *CThreadCtx) GetMetrics(zero bool, clients bool) string {
+	m := NewMetrics(zero)
+	m.AddDbVec(o.GetCounterDbVec(), "")
+
+	var nsIter DListIterHead
+	for nsIter.Init(&o.nsHead); nsIter.IsCont(); nsIter.Next() {
+		ns := castDlistNSCtx(nsIter.Val())
+		nsLabel := "," + nsMetricLabel(ns)
+		m.AddDb(ns.cdb, nsLabel)
+		m.AddPlugins(ns.PluginCtx, nsLabel)
+
+		var cIter DListIterHead
+		for cIter.Init(&ns.clientHead); cIter.IsCont(); cIter.Next() {
+			client := castDlistClient(cIter.Val())
+			labels := nsLabel
+			if clients {
+				labels += `,client="` + net.HardwareAddr(client.Mac[:]).String() + `"`
+			}
+			m.AddPlugins(client.PluginCtx, labels)
+		}
+	}
+	return m.String()
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+)
+
+type myMetricsCnt struct {
+	pkts  uint64
+	drops uint32
+	rate  float64
+}
+
+func newMyMetricsDb(o *myMetricsCnt) *CCounterDb {
+	db := NewCCounterDb("my-db")
+	db.Add(&CCounterRec{Counter: &o.pkts, Name: "pkts", Help: "packets", Unit: "pkts", Info: ScINFO})
+	db.Add(&CCounterRec{Counter: &o.drops, Name: "drops", Help: "dropped packets", Unit: "pkts", Info: ScERROR})
+	db.Add(&CCounterRec{Counter: &o.rate, Name: "rate", Help: "rate", Unit: "pps", Info: ScINFO})
+	return db
+}
+
+func TestMetrics1(t *testing.T) {
+	c1 := myMetricsCnt{pkts: 10, rate: 1.5}
+	c2 := myMetricsCnt{pkts: 5, drops: 2}
+	c3 := myMetricsCnt{pkts: 7}
+
+	m := NewMetrics(false)
+	m.AddDb(newMyMetricsDb(&c1), "")
+	m.AddDb(newMyMetricsDb(&c2), `,ns="1:0:0"`)
+	m.AddDb(newMyMetricsDb(&c3), `,ns="1:0:0"`) // summed with c2
+	exp := `# HELP emu_my_db_pkts packets
+# TYPE emu_my_db_pkts untyped
+emu_my_db_pkts 10
+emu_my_db_pkts{ns="1:0:0"} 12
+# HELP emu_my_db_drops dropped packets
+# TYPE emu_my_db_drops untyped
+emu_my_db_drops{ns="1:0:0"} 2
+# HELP emu_my_db_rate rate
+# TYPE emu_my_db_rate untyped
+emu_my_db_rate 1.5
+`
+	if r := m.String(); r != exp {
+		t.Fatalf(" bad metrics \n%s\nexpected\n%s", r, exp)
+	}
+
+	m = NewMetrics(true)
+	m.AddDb(newMyMetricsDb(&c3), "")
+	exp = `# HELP emu_my_db_pkts packets
+# TYPE emu_my_db_pkts untyped
+emu_my_db_pkts 7
+# HELP emu_my_db_drops dropped packets
+# TYPE emu_my_db_drops untyped
+emu_my_db_drops 0
+# HELP emu_my_db_rate rate
+# TYPE emu_my_db_rate untyped
+emu_my_db_rate 0
+`
+	if r := m.String(); r != exp {
+		t.Fatalf(" bad metrics with zero \n%s\nexpected\n%s", r, exp)
+	}
+}
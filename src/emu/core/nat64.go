@@ -0,0 +1,150 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import "fmt"
+
+/* NAT64/DNS64 aware clients
+
+An IPv6-only client behind a NAT64 gateway reaches the IPv4 destinations by IPv4-embedded IPv6
+addresses (RFC 6052), the NAT64 prefix followed by the IPv4 address. With DNS64 the A records of a
+lookup are synthesized into AAAA records with the prefix, see ctx_client_dns64. The transport of a
+client with NAT64 sends the flows to an IPv4 destination to the synthesized address, so the traffic
+goes through the NAT64 gateway.
+*/
+
+const NAT64_DEF_PREFIX_LEN = 96
+
+// NAT64_WKP the well-known prefix 64:ff9b::/96
+var NAT64_WKP = Ipv6Key{0, 0x64, 0xff, 0x9b}
+
+// CClientNat64Cmd the NAT64 prefix of a client, the well-known prefix in case it is zero
+type CClientNat64Cmd struct {
+	Prefix    Ipv6Key `json:"prefix"`
+	PrefixLen uint8   `json:"prefix_len"` // 32, 40, 48, 56, 64 or 96, zero is 96
+	Dns64     bool    `json:"dns64"`      // A records are synthesized into AAAA records
+}
+
+// CClientNat64Info the NAT64 of a client and the synthesized addresses it used
+type CClientNat64Info struct {
+	Mac   MACKey           `json:"mac"`
+	Nat64 *CClientNat64Cmd `json:"nat64"` // nil in case there is no NAT64
+	Synth uint64           `json:"synth"` // synthesized addresses used for traffic
+	Dns64 uint64           `json:"dns64"` // A records synthesized into AAAA records
+}
+
+type clientNat64 struct {
+	cmd   CClientNat64Cmd
+	synth uint64
+	dns64 uint64
+}
+
+// Nat64Embed returns the IPv4-embedded IPv6 address of ipv4 with the prefix, the bits 64-71 are
+// reserved and zero (RFC 6052 section 2.2)
+func Nat64Embed(prefix Ipv6Key, plen uint8, ipv4 Ipv4Key) Ipv6Key {
+	var r Ipv6Key
+	pos := int(plen / 8)
+	copy(r[:pos], prefix[:pos])
+	for _, b := range ipv4 {
+		if pos == 8 {
+			pos++
+		}
+		r[pos] = b
+		pos++
+	}
+	return r
+}
+
+// Nat64Extract returns the IPv4 address that is embedded in an IPv6 address with the prefix, false
+// in case the address does not match the prefix
+func Nat64Extract(prefix Ipv6Key, plen uint8, ipv6 Ipv6Key) (Ipv4Key, bool) {
+	var r Ipv4Key
+	pos := int(plen / 8)
+	if !matchPrefix(ipv6[:], prefix[:], plen) {
+		return r, false
+	}
+	for i := range r {
+		if pos == 8 {
+			pos++
+		}
+		r[i] = ipv6[pos]
+		pos++
+	}
+	return r, true
+}
+
+func validNat64PrefixLen(plen uint8) bool {
+	switch plen {
+	case 32, 40, 48, 56, 64, 96:
+		return true
+	}
+	return false
+}
+
+// SetNat64 sets the NAT64 prefix of the client, nil removes it
+func (o *CClient) SetNat64(cmd *CClientNat64Cmd) error {
+	if cmd == nil {
+		o.nat64 = nil
+		o.initCmd.Nat64 = nil
+		return nil
+	}
+	n := &clientNat64{cmd: *cmd}
+	if n.cmd.PrefixLen == 0 {
+		n.cmd.PrefixLen = NAT64_DEF_PREFIX_LEN
+	}
+	if !validNat64PrefixLen(n.cmd.PrefixLen) {
+		return fmt.Errorf("invalid nat64 prefix length %d, should be 32, 40, 48, 56, 64 or 96", n.cmd.PrefixLen)
+	}
+	if n.cmd.Prefix.IsZero() {
+		n.cmd.Prefix = NAT64_WKP
+		n.cmd.PrefixLen = NAT64_DEF_PREFIX_LEN
+	}
+	maskPrefix(n.cmd.Prefix[:], n.cmd.PrefixLen)
+	if n.cmd.PrefixLen < 64 && n.cmd.Prefix[8] != 0 {
+		return fmt.Errorf("nat64 prefix %v bits 64-71 should be zero", n.cmd.Prefix)
+	}
+	o.nat64 = n
+	c := n.cmd
+	o.initCmd.Nat64 = &c
+	return nil
+}
+
+// GetNat64 returns the NAT64 of the client
+func (o *CClient) GetNat64() *CClientNat64Info {
+	res := &CClientNat64Info{Mac: o.Mac}
+	if o.nat64 != nil {
+		c := o.nat64.cmd
+		res.Nat64 = &c
+		res.Synth = o.nat64.synth
+		res.Dns64 = o.nat64.dns64
+	}
+	return res
+}
+
+// Nat64Dst returns the synthesized IPv6 address the traffic of the client toward ipv4 should be sent
+// to, false in case the client does not have NAT64
+func (o *CClient) Nat64Dst(ipv4 Ipv4Key) (Ipv6Key, bool) {
+	if o.nat64 == nil {
+		return Ipv6Key{}, false
+	}
+	o.nat64.synth++
+	o.Ns.stats.nat64Synth++
+	return Nat64Embed(o.nat64.cmd.Prefix, o.nat64.cmd.PrefixLen, ipv4), true
+}
+
+// Dns64 synthesizes the A records of a lookup into AAAA records with the NAT64 prefix of the client
+func (o *CClient) Dns64(vec []Ipv4Key) ([]Ipv6Key, error) {
+	if o.nat64 == nil || !o.nat64.cmd.Dns64 {
+		return nil, fmt.Errorf("client %v does not have dns64", o.Mac)
+	}
+	r := make([]Ipv6Key, 0, len(vec))
+	for _, ipv4 := range vec {
+		r = append(r, Nat64Embed(o.nat64.cmd.Prefix, o.nat64.cmd.PrefixLen, ipv4))
+	}
+	o.nat64.dns64 += uint64(len(vec))
+	o.Ns.stats.dns64Synth += uint64(len(vec))
+	return r, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"net"
+	"testing"
+)
+
+func parseIpv6(s string) Ipv6Key {
+	var k Ipv6Key
+	copy(k[:], net.ParseIP(s).To16())
+	return k
+}
+
+// the examples of RFC 6052 section 2.4
+func TestNat64Embed1(t *testing.T) {
+	ipv4 := Ipv4Key{192, 0, 2, 33}
+	tests := []struct {
+		prefix string
+		plen   uint8
+		res    string
+	}{
+		{"2001:db8::", 32, "2001:db8:c000:221::"},
+		{"2001:db8:100::", 40, "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::", 48, "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::", 56, "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::", 64, "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::", 96, "2001:db8:122:344::192.0.2.33"},
+	}
+	for _, e := range tests {
+		prefix := parseIpv6(e.prefix)
+		r := Nat64Embed(prefix, e.plen, ipv4)
+		if r != parseIpv6(e.res) {
+			t.Fatalf(" /%d %v should be %v \n", e.plen, r, e.res)
+		}
+		if v, ok := Nat64Extract(prefix, e.plen, r); !ok || v != ipv4 {
+			t.Fatalf(" /%d extract %v \n", e.plen, v)
+		}
+	}
+}
+
+func TestClientNat64(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	client := NewClient(ns, MACKey{0, 0, 1, 0, 0, 1}, Ipv4Key{}, Ipv6Key{0x20, 0x01, 0x0d, 0xb8, 15: 1}, Ipv4Key{})
+	ns.AddClient(client)
+
+	if _, ok := client.Nat64Dst(Ipv4Key{8, 8, 8, 8}); ok {
+		t.Fatalf(" client without nat64 \n")
+	}
+	if client.SetNat64(&CClientNat64Cmd{Prefix: parseIpv6("2001:db8::"), PrefixLen: 33}) == nil {
+		t.Fatalf(" invalid prefix length should fail \n")
+	}
+	if client.SetNat64(&CClientNat64Cmd{}) != nil {
+		t.Fatalf(" well-known prefix should be valid \n")
+	}
+	if _, err := client.Dns64([]Ipv4Key{{8, 8, 8, 8}}); err == nil {
+		t.Fatalf(" dns64 is not enabled \n")
+	}
+	if d, ok := client.Nat64Dst(Ipv4Key{8, 8, 8, 8}); !ok || d != parseIpv6("64:ff9b::8.8.8.8") {
+		t.Fatalf(" bad synthesized address %v \n", d)
+	}
+
+	client.SetNat64(&CClientNat64Cmd{Prefix: parseIpv6("2001:db8:122:344::"), PrefixLen: 64, Dns64: true})
+	r, err := client.Dns64([]Ipv4Key{{192, 0, 2, 33}, {192, 0, 2, 34}})
+	if err != nil || len(r) != 2 || r[0] != parseIpv6("2001:db8:122:344:c0:2:2100:0") {
+		t.Fatalf(" bad dns64 %v %v \n", r, err)
+	}
+	info := client.GetNat64()
+	if info.Nat64 == nil || info.Dns64 != 2 || info.Synth != 0 || ns.stats.nat64Synth != 1 || ns.stats.dns64Synth != 2 {
+		t.Fatalf(" bad info %+v %+v \n", info, ns.stats)
+	}
+	client.SetNat64(nil)
+	if client.GetNat64().Nat64 != nil {
+		t.Fatalf(" nat64 should be removed \n")
+	}
+}
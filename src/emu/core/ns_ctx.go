@@ -7,6 +7,7 @@ package core
 
 import (
 	"encoding/binary"
+	"external/google/gopacket/layers"
 	"fmt"
 	"net"
 	"unsafe"
@@ -97,6 +98,32 @@ type CNSCtxStats struct {
 	errRemoveMactbl  uint64 /* client MAC does not exits in the MAC table */
 	errRemoveIPv6tbl uint64 /* ipv4 of client does not exits in the ipv6 table */
 	errInvalidMac    uint64 /* mac is zero  */
+	txSuppressed     uint64 /* proactive tx suppressed by the stealth mode */
+	reflectRewrite   uint64 /* reflected frames with a rewritten DSCP/PCP */
+	restartClient    uint64 /* clients removed and added again by a restart */
+	stuckFound       uint64 /* transactions of the clients that exceeded the stuck limits */
+	stuckCleared     uint64 /* stuck transactions that were reset */
+	txVlanTagged     uint64 /* frames tagged by the vlan policy of the clients */
+	txVlanUntagged   uint64 /* frames of clients with a vlan policy that were sent untagged */
+	rxFcsOk          uint64 /* received frames with a good FCS, the FCS was removed */
+	rxBadFcs         uint64 /* received frames with a bad FCS, dropped */
+	txBlackhole      uint64 /* frames of clients in blackhole, dropped */
+	rxBlackhole      uint64 /* frames to clients in blackhole, dropped */
+	nat64Synth       uint64 /* flows of the clients to synthesized NAT64 addresses */
+	dns64Synth       uint64 /* A records synthesized into AAAA records by DNS64 */
+	dnsLearnedQuery  uint64 /* queries of the clients to resolvers learned by DHCP or RA */
+	dnsStaticQuery   uint64 /* queries of the clients to static resolvers */
+	dnsNoResolver    uint64 /* queries of clients without a resolver */
+	dnsDhcpUpdate    uint64 /* changes of the resolvers learned by DHCP */
+	txEncap          uint64 /* frames of the clients sent on their tx encapsulation */
+	txEncapErr       uint64 /* frames without headroom for the tx encapsulation, sent as is */
+	rxEncapMatched   uint64 /* frames received on the rx encapsulation of a client */
+	rxScopeLoopback  uint64 /* ipv6 packets with the loopback address, dropped */
+	rxScopeMcastSrc  uint64 /* ipv6 packets with a multicast source, dropped */
+	rxScopeIfLocal   uint64 /* ipv6 packets to an interface-local multicast, dropped */
+	rxScopeLinkLocal uint64 /* ipv6 packets from a link-local source to a larger scope, dropped */
+	rxScopeSiteLocal uint64 /* ipv6 packets from a site-local source to a larger scope, dropped */
+	rxVlanPopped     uint64 /* frames with the tag of the vlan policy of a client, the tag was popped */
 }
 
 func (o *CNSCtxStats) PreUpdate() {
@@ -166,6 +193,214 @@ func newNsStats(o *CNSCtxStats) *CCounterDb {
 		DumpZero: false,
 		Info:     ScERROR})
 
+	db.Add(&CCounterRec{
+		Counter:  &o.txSuppressed,
+		Name:     "txSuppressed",
+		Help:     "proactive tx suppressed by the stealth mode",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.reflectRewrite,
+		Name:     "reflectRewrite",
+		Help:     "reflected frames with a rewritten DSCP/PCP",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.restartClient,
+		Name:     "restartClient",
+		Help:     "clients restarted",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.stuckFound,
+		Name:     "stuckFound",
+		Help:     "stuck transactions found",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.stuckCleared,
+		Name:     "stuckCleared",
+		Help:     "stuck transactions reset",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.txVlanTagged,
+		Name:     "txVlanTagged",
+		Help:     "frames tagged by the vlan policy",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.txVlanUntagged,
+		Name:     "txVlanUntagged",
+		Help:     "frames untagged by the vlan policy",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.rxFcsOk,
+		Name:     "rxFcsOk",
+		Help:     "rx frames with a good FCS",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.rxBadFcs,
+		Name:     "rxBadFcs",
+		Help:     "rx frames with a bad FCS, dropped",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.txBlackhole,
+		Name:     "txBlackhole",
+		Help:     "tx frames of clients in blackhole, dropped",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.rxBlackhole,
+		Name:     "rxBlackhole",
+		Help:     "rx frames to clients in blackhole, dropped",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.nat64Synth,
+		Name:     "nat64Synth",
+		Help:     "flows of the clients to synthesized NAT64 addresses",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.dns64Synth,
+		Name:     "dns64Synth",
+		Help:     "A records synthesized into AAAA records by DNS64",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.dnsLearnedQuery,
+		Name:     "dnsLearnedQuery",
+		Help:     "queries of the clients to resolvers learned by DHCP or RA",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.dnsStaticQuery,
+		Name:     "dnsStaticQuery",
+		Help:     "queries of the clients to static resolvers",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.dnsNoResolver,
+		Name:     "dnsNoResolver",
+		Help:     "queries of clients without a resolver",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.dnsDhcpUpdate,
+		Name:     "dnsDhcpUpdate",
+		Help:     "changes of the resolvers learned by DHCP",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.txEncap,
+		Name:     "txEncap",
+		Help:     "frames of the clients sent on their tx encapsulation",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.txEncapErr,
+		Name:     "txEncapErr",
+		Help:     "frames without headroom for the tx encapsulation, sent as is",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.rxEncapMatched,
+		Name:     "rxEncapMatched",
+		Help:     "frames received on the rx encapsulation of a client",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.rxScopeLoopback,
+		Name:     "rxScopeLoopback",
+		Help:     "ipv6 packets with the loopback address, dropped",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.rxScopeMcastSrc,
+		Name:     "rxScopeMcastSrc",
+		Help:     "ipv6 packets with a multicast source, dropped",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.rxScopeIfLocal,
+		Name:     "rxScopeIfLocal",
+		Help:     "ipv6 packets to an interface-local multicast, dropped",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.rxScopeLinkLocal,
+		Name:     "rxScopeLinkLocal",
+		Help:     "ipv6 packets from a link-local source to a larger scope, dropped",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.rxScopeSiteLocal,
+		Name:     "rxScopeSiteLocal",
+		Help:     "ipv6 packets from a site-local source to a larger scope, dropped",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.rxVlanPopped,
+		Name:     "rxVlanPopped",
+		Help:     "frames with the tag of the vlan policy of a client, the tag was popped",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
 	return db
 }
 
@@ -177,11 +412,9 @@ func castDlistNSCtx(dlist *DList) *CNSCtx {
 type CNSCtx struct {
 	dlist          DList //for thread  ctx dlist
 	ThreadCtx      *CThreadCtx
-	Key            CTunnelKey // the key tunnel of this namespace
-	mapIpv6        MapClientIPv6
-	mapIpv4        MapClientIPv4
-	mapMAC         MapClientMAC
-	clientHead     DList // list of ns
+	Key            CTunnelKey  // the key tunnel of this namespace
+	owner          *CAddrOwner // the addresses of the clients
+	clientHead     DList       // list of ns
 	stats          CNSCtxStats
 	PluginCtx      *PluginCtx
 	epoc           uint32
@@ -190,6 +423,21 @@ type CNSCtx struct {
 	iter           DListIterHead
 	cdb            *CCounterDb
 	DefClientPlugs *MapJsonPlugs // Default plugins for each new client
+	timerctx       *TimerCtx     // scaled view of the thread timer, nil for real time
+	stealth        bool          // passive, only responses to received packets are sent
+	reflect        *CReflectRewrite
+	restart        *CClientRestart   // allocated on the first restart
+	tsSource       uint8             // see TS_SOURCE_MONO
+	fcs            *CFcsRx           // nil in case the rx frames have no FCS
+	scope          CIpv6ScopeRx      // ipv6 scope filtering of the clients
+	vlanTags       map[uint32]uint32 // tags of the vlan policies of the clients, see rxVlanPolicy
+}
+
+// CReflectRewrite the QoS marking of the frames the namespace reflects back (echo replies),
+// a nil field keeps the received value
+type CReflectRewrite struct {
+	Dscp *uint8 `json:"dscp,omitempty" validate:"omitempty,lte=63"`
+	Pcp  *uint8 `json:"pcp,omitempty" validate:"omitempty,lte=7"`
 }
 
 type CNsInfo struct {
@@ -198,6 +446,11 @@ type CNsInfo struct {
 	Tpid          [2]uint16 `json:"tpid"`
 	ActiveClients uint64    `json:"active_clients"`
 	PlugNames     []string  `json:"plug_names"`
+	Stealth       bool      `json:"stealth"`
+	TsSource      string    `json:"ts_source"`
+	RxFcs         bool      `json:"rx_fcs"`
+
+	ReflectRewrite *CReflectRewrite `json:"reflect_rewrite,omitempty"`
 }
 
 // NewNSCtx create new one
@@ -208,9 +461,7 @@ func NewNSCtx(tctx *CThreadCtx,
 	o.Key = *key
 	o.cdb = newNsStats(&o.stats)
 	o.cdb.IOpt = &o.stats
-	o.mapIpv6 = make(MapClientIPv6)
-	o.mapIpv4 = make(MapClientIPv4)
-	o.mapMAC = make(MapClientMAC)
+	o.owner = newAddrOwner()
 	o.PluginCtx = NewPluginCtx(nil, o, tctx, PLUGIN_LEVEL_NS)
 	o.DefClientPlugs = nil
 	o.clientHead.SetSelf()
@@ -221,6 +472,107 @@ func NewNSCtx(tctx *CThreadCtx,
 //OnRemove called before remove
 func (o *CNSCtx) OnRemove() {
 	o.PluginCtx.OnRemove()
+	if o.restart != nil {
+		o.restart.Stop()
+	}
+	o.SetRxFcs(false, 0, 0)
+	if o.timerctx != nil {
+		o.ThreadCtx.GetTimerCtx().RemoveScaled(o.timerctx)
+		o.timerctx = nil
+	}
+}
+
+// GetTimerCtx returns the timer of the namespace, plugins of the namespace and its clients
+// should use it instead of the thread timer so the time scale of the namespace applies.
+func (o *CNSCtx) GetTimerCtx() *TimerCtx {
+	if o.timerctx != nil {
+		return o.timerctx
+	}
+	return o.ThreadCtx.GetTimerCtx()
+}
+
+// SetTimeScale makes the timers of the namespace run scale times faster than real time.
+// WARNING: it affects all the protocol timers of the namespace (leases, aging, retransmission,
+// rates etc), it is intended for accelerated tests. Packet timestamps are not scaled.
+// The plugins take the timer on create, so it can be changed only for an empty namespace.
+func (o *CNSCtx) SetTimeScale(scale uint32) error {
+	if scale == 0 {
+		return fmt.Errorf("invalid time scale %d", scale)
+	}
+	o.stats.PreUpdate()
+	if o.stats.activeClient > 0 || len(o.PluginCtx.GetAllPlugNames()) > 0 {
+		return fmt.Errorf("time scale can be changed only before adding clients and plugins to the namespace")
+	}
+	tctx := o.ThreadCtx.GetTimerCtx()
+	if o.timerctx != nil {
+		tctx.RemoveScaled(o.timerctx)
+		o.timerctx = nil
+	}
+	if scale != 1 {
+		o.timerctx = tctx.NewScaled(scale)
+	}
+	return nil
+}
+
+// GetTimeScale returns the time scale of the namespace, 1 for real time
+func (o *CNSCtx) GetTimeScale() uint32 {
+	return o.GetTimerCtx().Scale()
+}
+
+// SetStealth sets the passive mode of the namespace, the plugins don't initiate any tx (gratuitous
+// ARP, queries, solicitations, DHCP, reports, flows) and only respond to received packets
+func (o *CNSCtx) SetStealth(enable bool) {
+	o.stealth = enable
+}
+
+// IsStealth returns true in case the namespace is in passive mode
+func (o *CNSCtx) IsStealth() bool {
+	return o.stealth
+}
+
+// SuppressTx should be called by a plugin before a proactive tx, it returns true and counts the
+// packet in case the namespace is in passive mode
+func (o *CNSCtx) SuppressTx() bool {
+	if o.stealth {
+		o.stats.txSuppressed++
+	}
+	return o.stealth
+}
+
+// SetReflectRewrite sets the DSCP/PCP rewrite of the reflected frames, nil fields disable it
+func (o *CNSCtx) SetReflectRewrite(rw *CReflectRewrite) {
+	if rw == nil || (rw.Dscp == nil && rw.Pcp == nil) {
+		o.reflect = nil
+		return
+	}
+	o.reflect = rw
+}
+
+// ReflectRewrite should be called by a plugin on a received frame that is sent back, it rewrites
+// the PCP of all the VLAN tags and the DSCP of the IP header at l3 keeping the ECN bits
+func (o *CNSCtx) ReflectRewrite(p []byte, l3 uint16, ipv6 bool) {
+	rw := o.reflect
+	if rw == nil {
+		return
+	}
+	if rw.Pcp != nil {
+		for i := uint16(12); i+6 <= l3; i += 4 {
+			tci := binary.BigEndian.Uint16(p[i+2 : i+4])
+			binary.BigEndian.PutUint16(p[i+2:i+4], (tci&0x1fff)|(uint16(*rw.Pcp)<<13))
+		}
+	}
+	if rw.Dscp != nil {
+		if ipv6 {
+			ip := layers.IPv6Header(p[l3 : l3+40])
+			ip.SetTOS((*rw.Dscp << 2) | (ip.TOS() & 0x3))
+		} else {
+			ip := layers.IPv4Header(p[l3:])
+			ip = ip[:ip.GetHeaderLen()] // the checksum covers the options
+			ip.SetTOS((*rw.Dscp << 2) | (ip.GetTOS() & 0x3))
+			ip.UpdateChecksum()
+		}
+	}
+	o.stats.reflectRewrite++
 }
 
 func (o *CNSCtx) GetVport() uint16 {
@@ -236,30 +588,26 @@ func (o *CNSCtx) AllocMbuf(len uint16) *Mbuf {
 	return m
 }
 
+// GetClientRestart returns the restart of the clients of the namespace
+func (o *CNSCtx) GetClientRestart() *CClientRestart {
+	if o.restart == nil {
+		o.restart = newClientRestart(o)
+	}
+	return o.restart
+}
+
+// GetAddrOwner returns the address ownership registry of the namespace
+func (o *CNSCtx) GetAddrOwner() *CAddrOwner {
+	return o.owner
+}
+
 // Look for a client by MAC
 func (o *CNSCtx) CLookupByMac(mac *MACKey) *CClient {
-	if mac.IsZero() {
-		return nil
-	}
-	c, ok := o.mapMAC[*mac]
-	if ok {
-		return c
-	} else {
-		return nil
-	}
+	return o.owner.LookupMac(mac)
 }
 
 func (o *CNSCtx) CLookupByIPv4(ipv4 *Ipv4Key) *CClient {
-
-	if ipv4.IsZero() {
-		return nil
-	}
-	c, ok := o.mapIpv4[*ipv4]
-	if ok {
-		return c
-	} else {
-		return nil
-	}
+	return o.owner.LookupIpv4(ipv4)
 }
 
 // look by local and global addr
@@ -294,71 +642,14 @@ func (o *CNSCtx) CLookupByIPv6LocalGlobal(ipv6 *Ipv6Key) *CClient {
 }
 
 func (o *CNSCtx) CLookupByIPv6(ipv6 *Ipv6Key) *CClient {
-
-	if ipv6.IsZero() {
-		return nil
-	}
-	c, ok := o.mapIpv6[*ipv6]
-	if ok {
-		return c
-	} else {
-		return nil
-	}
+	return o.owner.LookupIpv6(ipv6)
 }
 
 // AddClient add a client object to the maps and dlist
 func (o *CNSCtx) AddClient(client *CClient) error {
 
-	if client.Mac.IsZero() {
-		return fmt.Errorf(" Adding client with invalid zero MAC (zero)")
-	}
-
-	var c *CClient
-	c = o.CLookupByMac(&client.Mac)
-	if c != nil {
-		return fmt.Errorf(" client with the same MAC %v already exist", client.Mac)
-	}
-	// mac is valid
-	hasIpv4 := !client.Ipv4.IsZero()
-
-	if hasIpv4 {
-		c = o.CLookupByIPv4(&client.Ipv4)
-		if c != nil {
-			return fmt.Errorf(" client with the same IPv4 %v already exist", client.Ipv4)
-		}
-	}
-
-	hasIpv6 := !client.Ipv6.IsZero()
-
-	if hasIpv6 {
-		c = o.CLookupByIPv6(&client.Ipv6)
-		if c != nil {
-			return fmt.Errorf(" client with the same IPv6 %v already exist", client.Ipv6)
-		}
-	}
-
-	hasIpv6D := !client.Dhcpv6.IsZero()
-
-	if hasIpv6D {
-		c = o.CLookupByIPv6(&client.Dhcpv6)
-		if c != nil {
-			return fmt.Errorf(" client with the same IPv6 %v already exist", client.Dhcpv6)
-		}
-	}
-
-	// Valid client add it
-	o.mapMAC[client.Mac] = client
-	if hasIpv4 {
-		o.mapIpv4[client.Ipv4] = client
-	}
-
-	if hasIpv6 {
-		o.mapIpv6[client.Ipv6] = client
-	}
-
-	if hasIpv6D {
-		o.mapIpv6[client.Dhcpv6] = client
-
+	if err := o.owner.Add(client); err != nil {
+		return err
 	}
 	o.clientHead.AddLast(&client.dlist)
 	o.epoc++
@@ -384,30 +675,24 @@ func (o *CNSCtx) RemoveClient(client *CClient) error {
 	/* callback to remove plugin*/
 	c.OnRemove()
 
-	delete(o.mapMAC, client.Mac)
+	o.owner.RemoveMac(client)
 
 	o.clientHead.RemoveNode(&client.dlist)
 
 	if !client.Ipv4.IsZero() {
-		if o.CLookupByIPv4(&client.Ipv4) != nil {
-			delete(o.mapIpv4, client.Ipv4)
-		} else {
+		if !o.owner.RemoveIpv4(client) {
 			o.stats.errRemoveIPv4tbl++
 		}
 	}
 
 	if !client.Ipv6.IsZero() {
-		if o.CLookupByIPv6(&client.Ipv6) != nil {
-			delete(o.mapIpv6, client.Ipv6)
-		} else {
+		if !o.owner.RemoveIpv6(client, client.Ipv6, client.Dhcpv6) {
 			o.stats.errRemoveIPv6tbl++
 		}
 	}
 
 	if !client.Dhcpv6.IsZero() {
-		if o.CLookupByIPv6(&client.Dhcpv6) != nil {
-			delete(o.mapIpv6, client.Dhcpv6)
-		} else {
+		if !o.owner.RemoveIpv6(client, client.Dhcpv6, Ipv6Key{}) {
 			o.stats.errRemoveIPv6tbl++
 		}
 	}
@@ -421,27 +706,12 @@ func (o *CNSCtx) UpdateClientIpv4(client *CClient, NewIpv4 Ipv4Key) error {
 
 	oldIpv4 := client.Ipv4
 
-	var ok bool
 	if oldIpv4 == NewIpv4 {
 		return nil
 	}
 
-	if !oldIpv4.IsZero() {
-		_, ok = o.mapIpv4[oldIpv4]
-		if !ok {
-			client.Ipv4 = [4]byte{0, 0, 0, 0}
-			return fmt.Errorf(" Somthing is wrong, couldn't find self ipv4 %v ", oldIpv4)
-		}
-		delete(o.mapIpv4, oldIpv4)
-	}
-
-	if !NewIpv4.IsZero() {
-		_, ok = o.mapIpv4[NewIpv4]
-		if ok {
-			client.Ipv4 = [4]byte{0, 0, 0, 0}
-			return fmt.Errorf(" Somthing is wrong, couldn't update client with new ipv4 %v ", NewIpv4)
-		}
-		o.mapIpv4[NewIpv4] = client
+	if err := o.owner.RenumberIpv4(client, oldIpv4, NewIpv4); err != nil {
+		return err
 	}
 	client.Ipv4 = NewIpv4
 	client.PluginCtx.BroadcastMsg(nil, MSG_UPDATE_IPV4_ADDR, oldIpv4, NewIpv4)
@@ -451,28 +721,13 @@ func (o *CNSCtx) UpdateClientIpv4(client *CClient, NewIpv4 Ipv4Key) error {
 func (o *CNSCtx) UpdateClientIpv6(client *CClient, NewIpv6 Ipv6Key) error {
 
 	oldIpv6 := client.Ipv6
-	var ok bool
 
 	if oldIpv6 == NewIpv6 {
 		return nil
 	}
 
-	if !oldIpv6.IsZero() {
-		_, ok = o.mapIpv6[oldIpv6]
-		if !ok {
-			client.Ipv6 = [16]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
-			return fmt.Errorf(" Somthing is wrong, couldn't find self ipv4 %v ", oldIpv6)
-		}
-		delete(o.mapIpv6, oldIpv6)
-	}
-
-	if !NewIpv6.IsZero() {
-		_, ok = o.mapIpv6[NewIpv6]
-		if ok {
-			client.Ipv6 = [16]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
-			return fmt.Errorf(" Somthing is wrong, couldn't update client with new ipv4 %v ", NewIpv6)
-		}
-		o.mapIpv6[NewIpv6] = client
+	if err := o.owner.RenumberIpv6(client, oldIpv6, NewIpv6, client.Dhcpv6); err != nil {
+		return err
 	}
 	client.Ipv6 = NewIpv6
 	client.PluginCtx.BroadcastMsg(nil, MSG_UPDATE_IPV6_ADDR, oldIpv6, NewIpv6)
@@ -482,28 +737,13 @@ func (o *CNSCtx) UpdateClientIpv6(client *CClient, NewIpv6 Ipv6Key) error {
 func (o *CNSCtx) UpdateClientDIpv6(client *CClient, NewIpv6 Ipv6Key) error {
 
 	oldIpv6 := client.Dhcpv6
-	var ok bool
 
 	if oldIpv6 == NewIpv6 {
 		return nil
 	}
 
-	if !oldIpv6.IsZero() {
-		_, ok = o.mapIpv6[oldIpv6]
-		if !ok {
-			client.Dhcpv6 = [16]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
-			return fmt.Errorf(" Somthing is wrong, couldn't find self ipv6 %v ", oldIpv6)
-		}
-		delete(o.mapIpv6, oldIpv6)
-	}
-
-	if !NewIpv6.IsZero() {
-		_, ok = o.mapIpv6[NewIpv6]
-		if ok {
-			client.Dhcpv6 = [16]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
-			return fmt.Errorf(" Somthing is wrong, couldn't update client with new ipv6 %v ", NewIpv6)
-		}
-		o.mapIpv6[NewIpv6] = client
+	if err := o.owner.RenumberIpv6(client, oldIpv6, NewIpv6, client.Ipv6); err != nil {
+		return err
 	}
 	client.Dhcpv6 = NewIpv6
 	client.PluginCtx.BroadcastMsg(nil, MSG_UPDATE_DIPV6_ADDR, oldIpv6, NewIpv6)
@@ -576,17 +816,21 @@ func (o *CNSCtx) GetInfo() *CNsInfo {
 	info.Tpid = d.Tpid
 	info.ActiveClients = o.stats.activeClient
 	info.PlugNames = o.PluginCtx.GetAllPlugNames()
+	info.Stealth = o.stealth
+	info.TsSource = TsSourceString(o.tsSource)
+	info.RxFcs = o.fcs != nil
+	info.ReflectRewrite = o.reflect
 	return &info
 }
 
 func (o *CNSCtx) HasClient(key *MACKey) bool {
-	_, ok := o.mapMAC[*key]
+	_, ok := o.owner.mapMAC[*key]
 	return ok
 }
 
 func (o *CNSCtx) GetClient(key *MACKey) *CClient {
 	if o.HasClient(key) {
-		r, _ := o.mapMAC[*key]
+		r, _ := o.owner.mapMAC[*key]
 		return r
 	} else {
 		return nil
@@ -0,0 +1,58 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"external/google/gopacket/layers"
+	"testing"
+
+	"github.com/intel-go/fastjson"
+)
+
+// the checksum of an ipv4 header with options is updated over the whole header
+func TestNsReflectRewriteOptions(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	dscp := uint8(46)
+	ns.SetReflectRewrite(&CReflectRewrite{Dscp: &dscp})
+
+	p := make([]byte, 14+24+8)
+	ip := layers.IPv4Header(p[14 : 14+24])
+	ip[0] = 0x46 // one word of options
+	ip.SetLength(24 + 8)
+	ip[8], ip[9] = 64, 1
+	copy(ip[20:24], []byte{0x94, 0x04, 0, 0}) // router alert
+	ip.UpdateChecksum()
+
+	ns.ReflectRewrite(p, 14, false)
+	if ip.GetTOS() != dscp<<2 || !ip.IsValidHeaderChecksum() {
+		t.Fatalf(" bad rewrite of the header %x \n", []byte(ip))
+	}
+}
+
+// the time scale of a new namespace is limited and its timer view is added with the namespace
+func TestNsAddTimeScale(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	timerctx := tctx.GetTimerCtx()
+	params := fastjson.RawMessage(`{"tunnels": [{"vport": 1, "tpid": [0, 0], "tci": [0, 0], "time_scale": 1001}]}`)
+	if tctx.AddNsRpcSlice(&params) == nil || len(tctx.mapNs) != 0 || len(timerctx.views) != 0 {
+		t.Fatalf(" time scale bigger than 1000 should be rejected \n")
+	}
+	params = fastjson.RawMessage(`{"tunnels": [{"vport": 1, "tpid": [0, 0], "tci": [0, 0], "time_scale": 10}]}`)
+	if err := tctx.AddNsRpcSlice(&params); err != nil || len(timerctx.views) != 1 {
+		t.Fatalf(" namespace with a time scale should be added %v \n", err)
+	}
+	for _, ns := range tctx.mapNs {
+		if ns.GetTimeScale() != 10 {
+			t.Fatalf(" bad time scale %d \n", ns.GetTimeScale())
+		}
+	}
+}
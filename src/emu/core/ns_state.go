@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"bytes"
+	"sort"
+)
+
+/* Export of the state of a namespace
+
+ctx_get_state returns one document with the namespace, the state of its plugins and its clients with
+the state of their plugins (addresses, caches, leases, memberships, authentication, flows). Each plugin
+contributes its own part by IPluginState. The clients are sorted by MAC and the plugins by name, so the
+export of two runs can be compared as is. The clients are returned in pages for large namespaces,
+the namespace part is returned only with the first page.
+*/
+
+const (
+	STATE_DEF_PAGE_SIZE = 100
+	STATE_MAX_PAGE_SIZE = 1000
+)
+
+// IPluginState is implemented by the plugins that contribute to ctx_get_state, the state should not
+// depend on the order of a map so the export of two runs could be compared
+type IPluginState interface {
+	GetState() interface{}
+}
+
+// CClientState the state of a client and its plugins
+type CClientState struct {
+	CClientInfo
+	Plugins map[string]interface{} `json:"plugins"`
+}
+
+// CNsState the state of a namespace, a page of its clients
+type CNsState struct {
+	Ns      *CNsInfo               `json:"ns,omitempty"`
+	Plugins map[string]interface{} `json:"plugins,omitempty"`
+	Clients []CClientState         `json:"clients"`
+	Total   uint32                 `json:"total"` // clients in the namespace
+	Next    uint32                 `json:"next"`  // index of the next page, zero in case this is the last one
+}
+
+// getPluginsState collects the state of the plugins that implement IPluginState
+func getPluginsState(ctx *PluginCtx) map[string]interface{} {
+	r := make(map[string]interface{})
+	for _, name := range ctx.GetAllPlugNames() {
+		plug := ctx.Get(name)
+		if plug == nil {
+			continue
+		}
+		if ps, ok := plug.Ext.(IPluginState); ok {
+			r[name] = ps.GetState()
+		}
+	}
+	return r
+}
+
+// GetState returns the state of the client and its plugins
+func (o *CClient) GetState() *CClientState {
+	var r CClientState
+	r.CClientInfo = *o.GetInfo()
+	sort.Strings(r.PlugNames)
+	r.Plugins = getPluginsState(o.PluginCtx)
+	return &r
+}
+
+// GetState returns the state of count clients starting at index in the order of the MACs, the
+// namespace itself is returned only with the first page
+func (o *CNSCtx) GetState(index, count uint32) *CNsState {
+	if count == 0 {
+		count = STATE_DEF_PAGE_SIZE
+	}
+	if count > STATE_MAX_PAGE_SIZE {
+		count = STATE_MAX_PAGE_SIZE
+	}
+	var r CNsState
+	if index == 0 {
+		r.Ns = o.GetInfo()
+		sort.Strings(r.Ns.PlugNames)
+		r.Plugins = getPluginsState(o.PluginCtx)
+	}
+
+	macs := make([]MACKey, 0, o.stats.activeClient)
+	var it DListIterHead
+	it.Init(&o.clientHead)
+	for ; it.IsCont(); it.Next() {
+		macs = append(macs, castDlistClient(it.Val()).Mac)
+	}
+	sort.Slice(macs, func(i, j int) bool { return bytes.Compare(macs[i][:], macs[j][:]) < 0 })
+
+	r.Total = uint32(len(macs))
+	r.Clients = make([]CClientState, 0)
+	end := r.Total
+	if index < r.Total && count < r.Total-index {
+		end = index + count
+		r.Next = end
+	}
+	for i := index; i < end; i++ {
+		r.Clients = append(r.Clients, *o.CLookupByMac(&macs[i]).GetState())
+	}
+	return &r
+}
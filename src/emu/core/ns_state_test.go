@@ -0,0 +1,50 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNsState1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	// added out of the MAC order
+	for _, i := range []uint8{3, 1, 2} {
+		ns.AddClient(NewClient(ns, MACKey{0, 0, 1, 0, 0, i}, Ipv4Key{16, 0, 0, i}, Ipv6Key{}, Ipv4Key{16, 0, 0, 100}))
+	}
+
+	s := ns.GetState(0, 2)
+	if s.Ns == nil || s.Total != 3 || s.Next != 2 || len(s.Clients) != 2 {
+		t.Fatalf(" bad first page %+v \n", s)
+	}
+	if s.Clients[0].Mac[5] != 1 || s.Clients[1].Mac[5] != 2 || s.Clients[0].Ipv4 != (Ipv4Key{16, 0, 0, 1}) {
+		t.Fatalf(" clients should be sorted by MAC %+v \n", s.Clients)
+	}
+
+	s = ns.GetState(s.Next, 2)
+	if s.Ns != nil || s.Plugins != nil || s.Next != 0 || len(s.Clients) != 1 || s.Clients[0].Mac[5] != 3 {
+		t.Fatalf(" bad last page %+v \n", s)
+	}
+
+	// the end of the page does not wrap
+	s = ns.GetState(1, 0xffffffff)
+	if s.Next != 0 || len(s.Clients) != 2 || len(ns.GetState(4, 0xffffffff).Clients) != 0 {
+		t.Fatalf(" bad page of a large count %+v \n", s)
+	}
+
+	// the export of the same state is the same document
+	a, _ := json.Marshal(ns.GetState(0, 0))
+	b, _ := json.Marshal(ns.GetState(0, 0))
+	if string(a) != string(b) {
+		t.Fatalf(" export is not stable \n%s\n%s \n", a, b)
+	}
+}
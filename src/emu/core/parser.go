@@ -27,6 +27,10 @@ const (
 	IPV6_EXT_END        = 59
 )
 
+const (
+	ICMPV6_TYPE_NI_QUERY = 139 // RFC 4620 node information query
+)
+
 const (
 	PARSER_ERR = -1
 	PARSER_OK  = 0
@@ -101,6 +105,10 @@ type ParserStats struct {
 	errL4ProtoUnsupported uint64
 	errL3ProtoUnsupported uint64
 	errPacketIsTooShort   uint64
+	errSlowTooShort       uint64
+	slowPkts              uint64
+	slowBytes             uint64
+	csErrSampled          uint64
 }
 
 func newParserStatsDb(o *ParserStats) *CCounterDb {
@@ -421,7 +429,7 @@ func newParserStatsDb(o *ParserStats) *CCounterDb {
 	db.Add(&CCounterRec{
 		Counter:  &o.errIPv6Fragment,
 		Name:     "errIPv6Fragment",
-		Help:     "ipv6 fragment is not supported",
+		Help:     "ipv6 fragment dropped",
 		Unit:     "pkt",
 		DumpZero: false,
 		Info:     ScERROR})
@@ -429,7 +437,7 @@ func newParserStatsDb(o *ParserStats) *CCounterDb {
 	db.Add(&CCounterRec{
 		Counter:  &o.errIPv4Fragment,
 		Name:     "errIPv4Fragment",
-		Help:     "ipv4 fragment is not supported",
+		Help:     "ipv4 fragment dropped",
 		Unit:     "pkt",
 		DumpZero: false,
 		Info:     ScERROR})
@@ -450,9 +458,44 @@ func newParserStatsDb(o *ParserStats) *CCounterDb {
 		DumpZero: false,
 		Info:     ScERROR})
 
+	db.Add(&CCounterRec{
+		Counter:  &o.errSlowTooShort,
+		Name:     "errSlowTooShort",
+		Help:     "slow protocols packet is too short",
+		Unit:     "pkt",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.slowPkts,
+		Name:     "slowPkts",
+		Help:     "slow protocols (lacp) packets",
+		Unit:     "pkt",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.slowBytes,
+		Name:     "slowBytes",
+		Help:     "slow protocols (lacp) bytes",
+		Unit:     "bytes",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.csErrSampled,
+		Name:     "csErrSampled",
+		Help:     "tcp/udp checksum errors kept by the sample",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
 	return db
 }
 
+// ETH_TYPE_SLOW_PROTOCOLS is the ethertype of LACP and marker, IEEE 802.3 annex 57A
+const ETH_TYPE_SLOW_PROTOCOLS layers.EthernetType = 0x8809
+
 /* counters */
 type Parser struct {
 	tctx *CThreadCtx
@@ -468,7 +511,26 @@ type Parser struct {
 	udp    ParserCb
 	icmpv6 ParserCb
 	eapol  ParserCb
+	lacp   ParserCb
+	reass  Reassembly
 	Cdb    *CCounterDb
+
+	noIpCsVerify bool          // skip the verification of the ipv4 header checksum
+	noL4CsVerify bool          // skip the verification of the tcp/udp checksum
+	csErrs       CCsErrSampler // sample of the frames with a bad tcp/udp checksum
+}
+
+// SetCsVerify enables/disables the verification of the ipv4 header and the tcp/udp checksums of
+// the received packets, both are enabled by default
+func (o *Parser) SetCsVerify(ip, l4 bool) {
+	o.noIpCsVerify = !ip
+	o.noL4CsVerify = !l4
+}
+
+func (o *Parser) onL4CsErr(ps *ParserPacketState, proto string, l4len, csOff uint16, pcs uint32, layer3 uint16) {
+	if o.csErrs.OnErr(ps.M, proto, layer3 == uint16(layers.EthernetTypeIPv6), ps.L4, l4len, csOff, pcs) {
+		o.stats.csErrSampled++
+	}
 }
 
 func parserNotSupported(ps *ParserPacketState) int {
@@ -497,6 +559,9 @@ func (o *Parser) Register(protocol string) {
 	if protocol == "dot1x" {
 		o.eapol = getProto("dot1x")
 	}
+	if protocol == "lacp" {
+		o.lacp = getProto("lacp")
+	}
 
 	if protocol == "transport" {
 		o.tcp = getProto("transport")
@@ -513,8 +578,10 @@ func (o *Parser) Init(tctx *CThreadCtx) {
 	o.tcp = parserNotSupported
 	o.udp = parserNotSupported
 	o.icmpv6 = parserNotSupported
+	o.lacp = parserNotSupported
 	o.dhcpv6 = parserNotSupported
 	o.Cdb = newParserStatsDb(&o.stats)
+	o.reass.Init(tctx, o)
 }
 
 func (o *Parser) parsePacketL4(ps *ParserPacketState,
@@ -562,8 +629,9 @@ func (o *Parser) parsePacketL4(ps *ParserPacketState,
 		ps.L7 = ps.L4 + uint16(tcplen)
 		ps.L7Len = l4len - uint16(tcplen)
 
-		if layers.PktChecksum(p[ps.L4:ps.L4+l4len], pcs) != 0 {
+		if !o.noL4CsVerify && layers.PktChecksum(p[ps.L4:ps.L4+l4len], pcs) != 0 {
 			o.stats.tcpCsErr++
+			o.onL4CsErr(ps, "tcp", l4len, 16, pcs, layer3)
 			return PARSER_ERR
 		}
 
@@ -577,9 +645,10 @@ func (o *Parser) parsePacketL4(ps *ParserPacketState,
 		}
 		ps.L7Len = l4len - 8
 		udp := layers.UDPHeader(p[ps.L4 : ps.L4+8])
-		if udp.Checksum() > 0 {
+		if udp.Checksum() > 0 && !o.noL4CsVerify {
 			if layers.PktChecksum(p[ps.L4:ps.L4+l4len], pcs) != 0 {
 				o.stats.udpCsErr++
+				o.onL4CsErr(ps, "udp", l4len, 6, pcs, layer3)
 				return PARSER_ERR
 			}
 		}
@@ -600,6 +669,7 @@ func (o *Parser) parsePacketL4(ps *ParserPacketState,
 				ps.L7 = ps.L4 + 8
 				return o.dhcp(ps)
 			} else {
+				ps.L7 = ps.L4 + 8
 				return o.udp(ps)
 			}
 		}
@@ -632,7 +702,8 @@ func (o *Parser) parsePacketL4(ps *ParserPacketState,
 			layers.ICMPv6TypeRouterSolicitation,
 			layers.ICMPv6TypeRouterAdvertisement,
 			layers.ICMPv6TypeNeighborSolicitation,
-			layers.ICMPv6TypeNeighborAdvertisement:
+			layers.ICMPv6TypeNeighborAdvertisement,
+			ICMPV6_TYPE_NI_QUERY:
 			o.stats.Icmpv6Pkt++
 			o.stats.Icmpv6Bytes += uint64(packetSize)
 			return (o.icmpv6(ps))
@@ -691,6 +762,17 @@ func (o *Parser) ParsePacket(m *Mbuf) int {
 			o.stats.eapolBytes += uint64(packetSize)
 			return o.eapol(&ps)
 
+		case ETH_TYPE_SLOW_PROTOCOLS:
+			if packetSize < uint32(offset+2) {
+				o.stats.errSlowTooShort++
+				return PARSER_ERR
+			}
+			ps.L3 = offset
+			tun.Set(&d)
+			o.stats.slowPkts++
+			o.stats.slowBytes += uint64(packetSize)
+			return o.lacp(&ps)
+
 		case layers.EthernetTypeARP:
 			if packetSize < uint32(offset+layers.ARPHeaderSize) {
 				o.stats.errArpTooShort++
@@ -726,10 +808,6 @@ func (o *Parser) ParsePacket(m *Mbuf) int {
 				o.stats.errIPv4HeaderTooShort++
 				return PARSER_ERR
 			}
-			if ipv4.IsFragment() {
-				o.stats.errIPv4Fragment++
-				return PARSER_ERR
-			}
 			hdr := ipv4.GetHeaderLen()
 			if hdr < 20 {
 				o.stats.errIPv4HeaderTooShort++
@@ -747,7 +825,7 @@ func (o *Parser) ParsePacket(m *Mbuf) int {
 				ipv4 = layers.IPv4Header(p[offset : offset+hdr])
 			}
 
-			if !ipv4.IsValidHeaderChecksum() {
+			if !o.noIpCsVerify && !ipv4.IsValidHeaderChecksum() {
 				o.stats.errIPv4cs++
 				return PARSER_ERR
 			}
@@ -756,6 +834,14 @@ func (o *Parser) ParsePacket(m *Mbuf) int {
 			offset = ps.L4
 			tun.Set(&d)
 
+			if ipv4.IsFragment() {
+				r := o.reass.handleIpv4(&ps, ipv4)
+				if r != PARSER_OK {
+					o.stats.errIPv4Fragment++
+				}
+				return r
+			}
+
 			return o.parsePacketL4(&ps, ipv4.GetNextProtocol(), ipv4.GetPhCs(), l4len, uint16(nextHdr))
 		case layers.EthernetTypeIPv6:
 			ps.L3 = offset
@@ -780,8 +866,12 @@ func (o *Parser) ParsePacket(m *Mbuf) int {
 			l4 := ps.L3 + IPV6_HEADER_SIZE
 			l4len := ipv6.PayloadLength()
 			tun.Set(&d)
+			if o.tctx.scopeCnt > 0 && !o.tctx.rxIpv6Scope(&tun, p, ps.L3) {
+				return PARSER_OK // counted by the namespace
+			}
 
 			nh := ipv6.NextHeader()
+			nhOff := ps.L3 + 6 // the next header field that points to the current header
 			var osize uint16
 			doloop := true
 			for doloop {
@@ -803,6 +893,7 @@ func (o *Parser) ParsePacket(m *Mbuf) int {
 						// rounter alert
 						ps.Flags |= IPV6_M_RTALERT_ML
 					}
+					nhOff = l4
 					l4len -= hl
 					osize += hl
 					l4 += hl
@@ -830,12 +921,16 @@ func (o *Parser) ParsePacket(m *Mbuf) int {
 						// rounter alert
 						ps.Flags |= IPV6_M_RTALERT_ML
 					}
+					nhOff = l4
 					l4len -= hl
 					osize += hl
 					l4 += hl
 				case IPV6_EXT_Fragment:
-					o.stats.errIPv6Fragment++
-					return PARSER_ERR
+					r := o.reass.handleIpv6(&ps, l4, nhOff, l4len)
+					if r != PARSER_OK {
+						o.stats.errIPv6Fragment++
+					}
+					return r
 
 				case IPV6_EXT_JUMBO:
 					// not supported
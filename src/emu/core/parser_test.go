@@ -11,6 +11,8 @@ import (
 	"fmt"
 	"net"
 	"testing"
+
+	"github.com/intel-go/fastjson"
 )
 
 var arp uint16
@@ -368,3 +370,92 @@ func TestParserDhcpInvalidCs(t *testing.T) {
 	}
 
 }
+
+func TestParserUdpInvalidCs(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	var parser Parser
+	parser.tctx = tctx
+	parser.dhcp = arpSupported
+	parser.csErrs.Set(2, 1)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 128, Id: 0xcc, SrcIP: net.IPv4(16, 0, 0, 1), DstIP: net.IPv4(48, 0, 0, 1),
+		Protocol: layers.IPProtocolUDP}
+	udp := &layers.UDP{SrcPort: 67, DstPort: 68}
+	udp.SetNetworkLayerForChecksum(ip)
+	gopacket.SerializeLayers(buf, opts,
+		&layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 1, 1, 1, 1, 1},
+			DstMAC:       net.HardwareAddr{0, 2, 2, 2, 2, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		},
+		ip,
+		udp,
+		gopacket.Payload([]byte{1, 2, 3, 4, 5, 6, 7, 8}),
+	)
+
+	data := buf.Bytes()
+	good := uint16(data[14+20+6])<<8 | uint16(data[14+20+7])
+	data[14+20+6] ^= 0x55 // corrupt the udp checksum
+
+	for i := 0; i < 3; i++ {
+		m1 := tctx.MPool.Alloc(uint16(len(data)))
+		m1.SetVPort(7)
+		m1.Append(data)
+		parser.ParsePacket(m1)
+		m1.FreeMbuf()
+	}
+
+	if parser.stats.udpCsErr != 3 || parser.stats.csErrSampled != 3 {
+		t.Fatalf(" udp checksum should be wrong %+v ", parser.stats)
+	}
+	f := parser.csErrs.Get(true)
+	if len(f) != 2 || f[0].Proto != "udp" || f[0].Expected != good || f[0].Received != good^0x5500 || f[0].Vport != 7 {
+		t.Fatalf(" bad sample %+v ", f)
+	}
+
+	// the ip header is still verified
+	parser.SetCsVerify(true, false)
+	arp = 0
+	m1 := tctx.MPool.Alloc(uint16(len(data)))
+	m1.Append(data)
+	parser.ParsePacket(m1)
+	m1.FreeMbuf()
+	if parser.stats.udpCsErr != 3 || arp != 1 {
+		t.Fatalf(" udp checksum should not be verified %+v ", parser.stats)
+	}
+	data[14+10] ^= 0x55
+	m1 = tctx.MPool.Alloc(uint16(len(data)))
+	m1.Append(data)
+	parser.ParsePacket(m1)
+	m1.FreeMbuf()
+	if parser.stats.errIPv4cs != 1 {
+		t.Fatalf(" ipv4 checksum should be wrong ")
+	}
+}
+
+// the sampler is updated only with the fields that are present
+func TestCsVerifyRpc(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	verify := func(req string) {
+		params := fastjson.RawMessage(req)
+		if _, err := (ApiCsVerifyHandler{}).ServeJSONRPC(tctx, &params); err != nil {
+			t.Fatalf(" %s failed %v \n", req, err)
+		}
+	}
+	verify(`{"sample_size": 4, "sample_rate": 2}`)
+	verify(`{"l4": false}`)
+	if tctx.parser.csErrs.size != 4 || tctx.parser.csErrs.rate != 2 || !tctx.parser.noL4CsVerify {
+		t.Fatalf(" sampler should be kept %+v \n", tctx.parser.csErrs)
+	}
+	verify(`{"sample_rate": 3}`)
+	if tctx.parser.csErrs.size != 4 || tctx.parser.csErrs.rate != 3 {
+		t.Fatalf(" only the rate should be changed %+v \n", tctx.parser.csErrs)
+	}
+	verify(`{"sample_size": 0}`)
+	if tctx.parser.csErrs.size != 0 {
+		t.Fatalf(" sampler should be disabled %+v \n", tctx.parser.csErrs)
+	}
+}
@@ -122,6 +122,13 @@ type PluginCtx struct {
 	T          PluginLevelType
 	mapPlugins MapPlugins
 	eventBus   MapEventBus // event bus
+	created    []pluginInit
+}
+
+// pluginInit a plugin and its init json, in the order of creation
+type pluginInit struct {
+	name     string
+	initJson []byte
 }
 
 func NewPluginCtx(client *CClient,
@@ -208,6 +215,7 @@ func (o *PluginCtx) addPlugin(pl string, initJson []byte) error {
 	}
 
 	o.mapPlugins[pl] = nobj
+	o.created = append(o.created, pluginInit{name: pl, initJson: initJson})
 	return nil
 }
 
@@ -0,0 +1,428 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"external/google/gopacket/layers"
+	"sort"
+	"time"
+)
+
+/* IPv4/IPv6 reassembly of the rx side. The fragments are kept per
+(tunnel, src, dst, id, protocol) until all of them arrive, then the packet is
+rebuilt without the fragmentation fields and parsed again so the UDP
+plugins (DHCP etc.) receive the full payload transparently.
+An exact duplicate of a fragment (a retransmission) is ignored. Overlapping
+IPv6 fragments drop the whole datagram (RFC 5722), the bytes of an IPv4
+fragment that overlap the received fragments are ignored. */
+
+const (
+	REASS_TIMEOUT   = 30 * time.Second // time to wait for all the fragments
+	REASS_MAX_FLOWS = 1024             // datagrams in reassembly per thread
+)
+
+type ReassStats struct {
+	ipv4Frags       uint64
+	ipv6Frags       uint64
+	ipv4Reassembled uint64
+	ipv6Reassembled uint64
+	delivered       uint64
+	timeout         uint64
+	errOverlap      uint64
+	errTooBig       uint64
+	errTblFull      uint64
+	errInvalid      uint64
+	active          uint64
+	duplicate       uint64
+	ipv4Overlap     uint64
+}
+
+func newReassStatsDb(o *ReassStats) *CCounterDb {
+	db := NewCCounterDb("reassembly")
+
+	db.Add(&CCounterRec{
+		Counter:  &o.ipv4Frags,
+		Name:     "ipv4Frags",
+		Help:     "ipv4 fragments received",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.ipv6Frags,
+		Name:     "ipv6Frags",
+		Help:     "ipv6 fragments received",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.ipv4Reassembled,
+		Name:     "ipv4Reassembled",
+		Help:     "ipv4 packets reassembled",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.ipv6Reassembled,
+		Name:     "ipv6Reassembled",
+		Help:     "ipv6 packets reassembled",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.delivered,
+		Name:     "delivered",
+		Help:     "reassembled packets delivered to a plugin",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.active,
+		Name:     "active",
+		Help:     "packets waiting for fragments",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.timeout,
+		Name:     "timeout",
+		Help:     "packets dropped, not all the fragments arrived",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.errOverlap,
+		Name:     "errOverlap",
+		Help:     "packets dropped, overlapping fragments",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.errTooBig,
+		Name:     "errTooBig",
+		Help:     "packets dropped, reassembled packet is bigger than an mbuf",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.errTblFull,
+		Name:     "errTblFull",
+		Help:     "fragments dropped, too many packets in reassembly",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.errInvalid,
+		Name:     "errInvalid",
+		Help:     "fragments dropped, invalid offset or length",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.duplicate,
+		Name:     "duplicate",
+		Help:     "fragments ignored, exact duplicate of a received fragment",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	db.Add(&CCounterRec{
+		Counter:  &o.ipv4Overlap,
+		Name:     "ipv4Overlap",
+		Help:     "ipv4 fragments that overlap, only the new bytes are kept",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+
+	return db
+}
+
+type reassKey struct {
+	tun   CTunnelKey
+	src   Ipv6Key // ipv4 uses the first 4 bytes
+	dst   Ipv6Key
+	id    uint32
+	proto uint8
+	ipv6  bool
+}
+
+type reassFrag struct {
+	off  uint16
+	data []byte
+}
+
+type reassEntry struct {
+	timer  CHTimerObj
+	key    reassKey
+	frags  []reassFrag
+	hdr    []byte // L2 + L3 headers of the first fragment, without the fragment header for ipv6
+	nhOff  uint16 // ipv6 offset of the next header field that points to the fragment header
+	nh     uint8  // ipv6 next header of the fragment header
+	vport  uint16
+	l3     uint16
+	recv   uint32 // bytes received
+	end    uint32 // total payload length, valid if last
+	last   bool   // the last fragment was received
+	parent *Reassembly
+}
+
+func (o *reassEntry) OnEvent(a, b interface{}) {
+	o.parent.stats.timeout++
+	o.parent.remove(o)
+}
+
+// Reassembly table of the thread, used by the parser
+type Reassembly struct {
+	tctx   *CThreadCtx
+	parser *Parser
+	tbl    map[reassKey]*reassEntry
+	stats  ReassStats
+	Cdb    *CCounterDb
+}
+
+func (o *Reassembly) Init(tctx *CThreadCtx, parser *Parser) {
+	o.tctx = tctx
+	o.parser = parser
+	o.tbl = make(map[reassKey]*reassEntry)
+	o.Cdb = newReassStatsDb(&o.stats)
+}
+
+func (o *Reassembly) remove(e *reassEntry) {
+	if e.timer.IsRunning() {
+		o.tctx.GetTimerCtx().Stop(&e.timer)
+	}
+	delete(o.tbl, e.key)
+	o.stats.active--
+}
+
+func (o *Reassembly) lookup(key *reassKey) *reassEntry {
+	e, ok := o.tbl[*key]
+	if ok {
+		return e
+	}
+	if len(o.tbl) >= REASS_MAX_FLOWS {
+		o.stats.errTblFull++
+		return nil
+	}
+	e = &reassEntry{key: *key, parent: o}
+	e.timer.SetCB(e, 0, 0)
+	o.tctx.GetTimerCtx().Start(&e.timer, REASS_TIMEOUT)
+	o.tbl[*key] = e
+	o.stats.active++
+	return e
+}
+
+// add a fragment, returns true in case the packet is complete
+func (o *Reassembly) add(e *reassEntry, off uint16, more bool, data []byte) bool {
+	end := uint32(off) + uint32(len(data))
+	if more && (len(data)&7) != 0 {
+		o.stats.errInvalid++
+		return false
+	}
+	for _, f := range e.frags {
+		if f.off == off && bytes.Equal(f.data, data) {
+			o.stats.duplicate++
+			return false
+		}
+	}
+	if (e.last && end > e.end) || (!more && e.recv > 0 && end < e.maxEnd()) {
+		o.stats.errInvalid++
+		return false
+	}
+	pieces := []reassFrag{{off: off, data: data}}
+	for _, f := range e.frags {
+		fend := uint32(f.off) + uint32(len(f.data))
+		if uint32(off) < fend && uint32(f.off) < end {
+			if e.key.ipv6 {
+				o.stats.errOverlap++
+				o.remove(e)
+				return false
+			}
+			o.stats.ipv4Overlap++
+			pieces = e.gaps(off, data)
+			break
+		}
+	}
+	if end > uint32(MAX_PACKET_SIZE) {
+		o.stats.errTooBig++
+		o.remove(e)
+		return false
+	}
+	for _, f := range pieces {
+		e.frags = append(e.frags, reassFrag{off: f.off, data: append([]byte{}, f.data...)})
+		e.recv += uint32(len(f.data))
+	}
+	if !more {
+		e.last = true
+		e.end = end
+	}
+	return e.last && e.recv == e.end && e.hdr != nil
+}
+
+func (o *reassEntry) maxEnd() uint32 {
+	var max uint32
+	for _, f := range o.frags {
+		fend := uint32(f.off) + uint32(len(f.data))
+		if fend > max {
+			max = fend
+		}
+	}
+	return max
+}
+
+// gaps returns the parts of a fragment that were not received, the received bytes are kept
+func (o *reassEntry) gaps(off uint16, data []byte) []reassFrag {
+	sort.Slice(o.frags, func(i, j int) bool { return o.frags[i].off < o.frags[j].off })
+	var res []reassFrag
+	cur := uint32(off)
+	end := cur + uint32(len(data))
+	for _, f := range o.frags {
+		fstart := uint32(f.off)
+		fend := fstart + uint32(len(f.data))
+		if fend <= cur {
+			continue
+		}
+		if fstart >= end {
+			break
+		}
+		if fstart > cur {
+			res = append(res, reassFrag{off: uint16(cur), data: data[cur-uint32(off) : fstart-uint32(off)]})
+		}
+		cur = fend
+	}
+	if cur < end {
+		res = append(res, reassFrag{off: uint16(cur), data: data[cur-uint32(off):]})
+	}
+	return res
+}
+
+// build the reassembled packet and parse it again
+func (o *Reassembly) deliver(e *reassEntry) int {
+	o.remove(e)
+	size := len(e.hdr) + int(e.end)
+	if size > int(MAX_PACKET_SIZE) {
+		o.stats.errTooBig++
+		return PARSER_ERR
+	}
+	sort.Slice(e.frags, func(i, j int) bool { return e.frags[i].off < e.frags[j].off })
+
+	m := o.tctx.MPool.Alloc(uint16(size))
+	m.SetVPort(e.vport)
+	m.Append(e.hdr)
+	for _, f := range e.frags {
+		m.Append(f.data)
+	}
+	p := m.GetData()
+	l3 := e.l3
+	if !e.key.ipv6 {
+		ipv4 := layers.IPv4Header(p[l3 : l3+20])
+		hdr := ipv4.GetHeaderLen()
+		ipv4 = layers.IPv4Header(p[l3 : l3+hdr])
+		ipv4.SetLength(hdr + uint16(e.end))
+		frag := binary.BigEndian.Uint16(p[l3+6 : l3+8])
+		binary.BigEndian.PutUint16(p[l3+6:l3+8], frag&0x4000) // keep DF only
+		ipv4.UpdateChecksum()
+		o.stats.ipv4Reassembled++
+	} else {
+		ipv6 := layers.IPv6Header(p[l3 : l3+IPV6_HEADER_SIZE])
+		ipv6.SetPyloadLength(uint16(len(e.hdr)) - l3 - IPV6_HEADER_SIZE + uint16(e.end))
+		p[e.nhOff] = e.nh
+		o.stats.ipv6Reassembled++
+	}
+
+	r := o.parser.ParsePacket(m)
+	if r == PARSER_OK {
+		o.stats.delivered++
+	}
+	m.FreeMbuf()
+	return r
+}
+
+// handleIpv4 is called by the parser for an ipv4 fragment, the header was verified
+func (o *Reassembly) handleIpv4(ps *ParserPacketState, ipv4 layers.IPv4Header) int {
+	o.stats.ipv4Frags++
+	p := ps.M.GetData()
+	l3 := ps.L3
+	hdr := ipv4.GetHeaderLen()
+	if ipv4.GetLength() < hdr {
+		o.stats.errInvalid++
+		return PARSER_ERR
+	}
+	frag := binary.BigEndian.Uint16(p[l3+6 : l3+8])
+	off := (frag & 0x1fff) << 3
+	more := (frag & 0x2000) != 0
+
+	var key reassKey
+	key.tun = *ps.Tun
+	copy(key.src[:], p[l3+12:l3+16])
+	copy(key.dst[:], p[l3+16:l3+20])
+	key.id = uint32(binary.BigEndian.Uint16(p[l3+4 : l3+6]))
+	key.proto = ipv4.GetNextProtocol()
+
+	e := o.lookup(&key)
+	if e == nil {
+		return PARSER_ERR
+	}
+	if off == 0 {
+		e.hdr = append([]byte{}, p[0:l3+hdr]...)
+		e.l3 = l3
+		e.vport = ps.M.VPort()
+	}
+	if !o.add(e, off, more, p[l3+hdr:l3+ipv4.GetLength()]) {
+		return PARSER_OK
+	}
+	return o.deliver(e)
+}
+
+// handleIpv6 is called by the parser for an ipv6 fragment header at offset fh,
+// nhOff is the offset of the next header field that points to it
+func (o *Reassembly) handleIpv6(ps *ParserPacketState, fh uint16, nhOff uint16, l4len uint16) int {
+	o.stats.ipv6Frags++
+	p := ps.M.GetData()
+	l3 := ps.L3
+	if l4len < 8 {
+		o.stats.errInvalid++
+		return PARSER_ERR
+	}
+	fo := binary.BigEndian.Uint16(p[fh+2 : fh+4])
+	off := fo & 0xfff8
+	more := (fo & 0x1) != 0
+
+	var key reassKey
+	key.tun = *ps.Tun
+	copy(key.src[:], p[l3+8:l3+24])
+	copy(key.dst[:], p[l3+24:l3+40])
+	key.id = binary.BigEndian.Uint32(p[fh+4 : fh+8])
+	key.ipv6 = true
+
+	e := o.lookup(&key)
+	if e == nil {
+		return PARSER_ERR
+	}
+	if off == 0 {
+		e.hdr = append([]byte{}, p[0:fh]...)
+		e.l3 = l3
+		e.nhOff = nhOff
+		e.nh = p[fh]
+		e.vport = ps.M.VPort()
+	}
+	if !o.add(e, off, more, p[fh+8:fh+l4len]) {
+		return PARSER_OK
+	}
+	return o.deliver(e)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"bytes"
+	"external/google/gopacket/layers"
+	"testing"
+)
+
+func TestReassemblyDuplicate(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	reass := &tctx.parser.reass
+	payload := make([]byte, 40)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	entry := func(ipv6 bool, id uint32) *reassEntry {
+		e := reass.lookup(&reassKey{id: id, ipv6: ipv6})
+		e.hdr = []byte{}
+		return e
+	}
+
+	// a retransmitted ipv4 fragment is ignored
+	e := entry(false, 1)
+	if reass.add(e, 0, true, payload[0:16]) || reass.add(e, 16, true, payload[16:32]) ||
+		reass.add(e, 16, true, payload[16:32]) || reass.stats.duplicate != 1 {
+		t.Fatalf(" duplicate fragment should be ignored %+v \n", reass.stats)
+	}
+	if !reass.add(e, 32, false, payload[32:40]) || e.recv != 40 {
+		t.Fatalf(" packet should be complete %+v \n", reass.stats)
+	}
+	reass.remove(e)
+
+	// the overlapping bytes of an ipv4 fragment are ignored, the first received are kept
+	e = entry(false, 2)
+	other := make([]byte, 16)
+	if reass.add(e, 0, true, payload[0:16]) || reass.add(e, 8, true, other) || reass.stats.ipv4Overlap != 1 ||
+		e.recv != 24 || !reass.add(e, 24, false, payload[24:40]) {
+		t.Fatalf(" overlapping ipv4 fragment should keep the packet %+v \n", reass.stats)
+	}
+	var p []byte
+	for _, f := range e.frags {
+		if f.off != uint16(len(p)) {
+			t.Fatalf(" bad fragment offset %d \n", f.off)
+		}
+		p = append(p, f.data...)
+	}
+	if !bytes.Equal(p[0:16], payload[0:16]) || !bytes.Equal(p[16:24], other[8:16]) || !bytes.Equal(p[24:], payload[24:]) {
+		t.Fatalf(" bad reassembled payload %v \n", p)
+	}
+	reass.remove(e)
+
+	// ipv6 ignores a duplicate and drops the packet on an overlap
+	e = entry(true, 3)
+	if reass.add(e, 0, true, payload[0:16]) || reass.add(e, 0, true, payload[0:16]) || reass.stats.duplicate != 2 {
+		t.Fatalf(" duplicate ipv6 fragment should be ignored %+v \n", reass.stats)
+	}
+	if reass.add(e, 8, true, payload[8:24]) || reass.stats.errOverlap != 1 || len(reass.tbl) != 0 || reass.stats.active != 0 {
+		t.Fatalf(" overlapping ipv6 fragment should drop the packet %+v \n", reass.stats)
+	}
+}
+
+func TestReassemblyInvalidLength(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+
+	// a fragment with a total length smaller than its 24 bytes header
+	p := make([]byte, 14+24+8)
+	p[12], p[13] = 0x08, 0x00
+	ipv4 := layers.IPv4Header(p[14 : 14+24])
+	ipv4[0] = 0x46
+	ipv4.SetLength(20)
+	ipv4[6] = 0x20 // more fragments
+	ipv4[8] = 64
+	ipv4[9] = 17
+	ipv4.UpdateChecksum()
+
+	m := tctx.MPool.Alloc(128)
+	m.Append(p)
+	if tctx.parser.ParsePacket(m) != PARSER_ERR || tctx.parser.reass.stats.errInvalid != 1 ||
+		len(tctx.parser.reass.tbl) != 0 {
+		t.Fatalf(" invalid fragment should be dropped %+v \n", tctx.parser.reass.stats)
+	}
+	m.FreeMbuf()
+}
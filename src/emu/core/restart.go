@@ -0,0 +1,257 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	CLIENT_RESTART_MAX_SPREAD_MSEC = 3600 * 1000
+	clientRestartCheck             = 100 * time.Millisecond // resolution of the convergence time
+)
+
+// RestartClient removes the client and adds a new one with its configuration and plugins, as after a
+// reboot. The learned state (DHCP lease, resolved gateways, DAD, authentication) is lost and the
+// plugins start over with their init json. The new client is validated before the old one is
+// removed, in case of an error the old client is kept as is.
+func (o *CNSCtx) RestartClient(c *CClient) (*CClient, error) {
+	cmd := c.initCmd
+	plugs := c.PluginCtx.created
+	nc := NewClientCmd(o, &cmd)
+	if err := o.initRestartedClient(c, nc, &cmd, plugs); err != nil {
+		nc.OnRemove()
+		return nil, err
+	}
+	if err := o.RemoveClient(c); err != nil {
+		nc.OnRemove()
+		return nil, err
+	}
+	if err := o.AddClient(nc); err != nil {
+		nc.OnRemove()
+		return nil, err
+	}
+	nc.SetIpv6ScopeFilter(cmd.Ipv6ScopeFilter)
+	for _, p := range plugs {
+		if nc.PluginCtx.Get(p.name) != nil {
+			continue // created by another plugin
+		}
+		if err := nc.PluginCtx.addPlugin(p.name, p.initJson); err != nil {
+			o.RemoveClient(nc) // not a half built client, the plugins were verified
+			return nil, err
+		}
+	}
+	nc.AttemptResolve()
+	o.stats.restartClient++
+	return nc, nil
+}
+
+// initRestartedClient applies the configuration of cmd to nc and verifies that its addresses are
+// not owned by a client other than c and that its plugins exist, so adding it once c is removed
+// can't fail
+func (o *CNSCtx) initRestartedClient(c, nc *CClient, cmd *CClientCmd, plugs []pluginInit) error {
+	for _, p := range plugs {
+		if _, ok := pluginregister.M[p.name]; !ok {
+			return fmt.Errorf(" plugin %s does not exist", p.name)
+		}
+	}
+	if err := nc.SetRoutes(cmd.Routes); err != nil {
+		return err
+	}
+	if err := nc.SetVlanPolicy(cmd.VlanPolicy); err != nil {
+		return err
+	}
+	if err := nc.SetDns(cmd.Dns); err != nil {
+		return err
+	}
+	if err := nc.SetNat64(cmd.Nat64); err != nil {
+		return err
+	}
+	if err := nc.SetEncap(cmd.Encap); err != nil {
+		return err
+	}
+	if nc.Mac.IsZero() {
+		return fmt.Errorf(" Adding client with invalid zero MAC (zero)")
+	}
+	if owner, ok := o.owner.mapMAC[nc.Mac]; ok && owner != c {
+		return fmt.Errorf(" client with the same MAC %v already exist", nc.Mac)
+	}
+	if owner, ok := o.owner.mapIpv4[nc.Ipv4]; ok && owner != c && !nc.Ipv4.IsZero() {
+		return fmt.Errorf(" client with the same IPv4 %v already exist", nc.Ipv4)
+	}
+	if owner, ok := o.owner.mapIpv6[nc.Ipv6]; ok && owner != c && !nc.Ipv6.IsZero() {
+		return fmt.Errorf(" client with the same IPv6 %v already exist", nc.Ipv6)
+	}
+	return nil
+}
+
+// SelectClientsToRestart returns the macs, or all the clients of the namespace in case macs is empty,
+// and keeps percent of them spread evenly over the list
+func (o *CNSCtx) SelectClientsToRestart(macs []MACKey, percent uint32) []MACKey {
+	if len(macs) == 0 {
+		var it DListIterHead
+		it.Init(&o.clientHead)
+		for ; it.IsCont(); it.Next() {
+			macs = append(macs, castDlistClient(it.Val()).Mac)
+		}
+	}
+	if percent == 0 || percent >= 100 {
+		return macs
+	}
+	r := make([]MACKey, 0, len(macs)*int(percent)/100+1)
+	for i := range macs {
+		if (i+1)*int(percent)/100 > i*int(percent)/100 {
+			r = append(r, macs[i])
+		}
+	}
+	return r
+}
+
+// CClientRestartStatus the progress of the last restart of the clients of a namespace,
+// see ctx_client_restart_status
+type CClientRestartStatus struct {
+	Selected     uint32 `json:"selected"`
+	Restarted    uint32 `json:"restarted"`
+	Errors       uint32 `json:"errors"`    // removed meanwhile or failed to restart
+	Converged    uint32 `json:"converged"` // back to the address and gateways they had before the restart
+	Done         bool   `json:"done"`      // all the selected clients were restarted and converged
+	ConvergeMsec uint64 `json:"converge_msec"`
+}
+
+// clientRestartRec a selected client, the state before the restart is the state to converge to
+type clientRestartRec struct {
+	mac       MACKey
+	ticks     uint64 // offset from the start of the restart
+	ipv4      bool
+	dgv4      bool
+	dgv6      bool
+	restarted bool
+	done      bool
+}
+
+// CClientRestart restarts a selected set of the clients of a namespace at once or spread over a
+// window, and measures the time until all of them converge, see ctx_client_restart
+type CClientRestart struct {
+	ns     *CNSCtx
+	timerw *TimerCtx
+	timer  CHTimerObj
+	start  uint64
+	recs   []clientRestartRec
+	status CClientRestartStatus
+}
+
+func clientConvergeState(c *CClient) (ipv4, dgv4, dgv6 bool) {
+	ipv4 = !c.Ipv4.IsZero()
+	_, dgv4 = c.ResolveIPv4DGMac()
+	_, dgv6 = c.ResolveIPv6DGMac()
+	return ipv4, dgv4, dgv6
+}
+
+func newClientRestart(ns *CNSCtx) *CClientRestart {
+	o := new(CClientRestart)
+	o.ns = ns
+	o.timerw = ns.GetTimerCtx()
+	o.timer.SetCB(o, 0, 0)
+	return o
+}
+
+// Start restarts the clients with the macs, spread evenly over spread, and stops a restart that
+// is in progress.
+func (o *CClientRestart) Start(macs []MACKey, spread time.Duration) error {
+	if spread > time.Duration(CLIENT_RESTART_MAX_SPREAD_MSEC)*time.Millisecond {
+		return fmt.Errorf("restart spread %v is bigger than %d msec", spread, CLIENT_RESTART_MAX_SPREAD_MSEC)
+	}
+	o.Stop()
+	o.timerw = o.ns.GetTimerCtx()
+	o.start = o.timerw.Ticks
+	o.status = CClientRestartStatus{Selected: uint32(len(macs))}
+	o.recs = make([]clientRestartRec, 0, len(macs))
+	window := o.timerw.DurationToTicks(spread)
+	for i, mac := range macs {
+		rec := clientRestartRec{mac: mac, ticks: uint64(window) * uint64(i) / uint64(len(macs))}
+		if c := o.ns.CLookupByMac(&mac); c != nil {
+			rec.ipv4, rec.dgv4, rec.dgv6 = clientConvergeState(c)
+		}
+		o.recs = append(o.recs, rec)
+	}
+	o.OnEvent(nil, nil)
+	return nil
+}
+
+// Stop stops the restart, the clients that were not restarted yet are left as they are
+func (o *CClientRestart) Stop() {
+	if o.timer.IsRunning() {
+		o.timerw.Stop(&o.timer)
+	}
+}
+
+func (o *CClientRestart) OnEvent(a, b interface{}) {
+	now := o.timerw.Ticks - o.start
+	next := uint64(0) // offset of the next restart
+	hasNext := false
+	pending := false
+	for i := range o.recs {
+		r := &o.recs[i]
+		if r.done {
+			continue
+		}
+		if !r.restarted {
+			if r.ticks > now {
+				if !hasNext || r.ticks < next {
+					next = r.ticks
+				}
+				hasNext = true
+				pending = true
+				continue
+			}
+			r.restarted = true
+			c := o.ns.CLookupByMac(&r.mac)
+			if c == nil {
+				o.status.Errors++
+				r.done = true
+				continue
+			}
+			if _, err := o.ns.RestartClient(c); err != nil {
+				o.status.Errors++
+				r.done = true
+				continue
+			}
+			o.status.Restarted++
+		}
+		c := o.ns.CLookupByMac(&r.mac)
+		if c == nil {
+			o.status.Errors++
+			r.done = true
+			continue
+		}
+		ipv4, dgv4, dgv6 := clientConvergeState(c)
+		if (ipv4 || !r.ipv4) && (dgv4 || !r.dgv4) && (dgv6 || !r.dgv6) {
+			r.done = true
+			o.status.Converged++
+			o.status.ConvergeMsec = uint64(time.Duration(now) * o.timerw.TickDuration / time.Millisecond)
+			continue
+		}
+		pending = true
+	}
+	if o.status.Converged+o.status.Errors == o.status.Selected {
+		o.status.Done = true
+		return
+	}
+	if !pending {
+		return
+	}
+	ticks := o.timerw.DurationToTicks(clientRestartCheck)
+	if hasNext && next-now < uint64(ticks) {
+		ticks = uint32(next - now)
+	}
+	o.timerw.StartTicks(&o.timer, ticks)
+}
+
+// GetStatus returns the progress of the last restart
+func (o *CClientRestart) GetStatus() *CClientRestartStatus {
+	return &o.status
+}
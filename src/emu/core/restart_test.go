@@ -0,0 +1,132 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/intel-go/fastjson"
+)
+
+func TestClientRestart1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	var old []*CClient
+	for i := uint8(1); i <= 4; i++ {
+		c := NewClient(ns, MACKey{0, 0, 1, 0, 0, i}, Ipv4Key{16, 0, 0, i}, Ipv6Key{}, Ipv4Key{16, 0, 0, 100})
+		c.SetRoutes([]CClientRouteCmd{{Ipv4: Ipv4Key{48, 0, 0, 0}, PrefixLen: 8, NextHopIpv4: Ipv4Key{16, 0, 0, 101}}})
+		ns.AddClient(c)
+		old = append(old, c)
+	}
+
+	// every second client
+	macs := ns.SelectClientsToRestart(nil, 50)
+	if len(macs) != 2 || macs[0] != old[1].Mac || macs[1] != old[3].Mac {
+		t.Fatalf(" bad selection %v \n", macs)
+	}
+	if ns.GetClientRestart().Start(macs, time.Duration(CLIENT_RESTART_MAX_SPREAD_MSEC+1)*time.Millisecond) == nil {
+		t.Fatalf(" spread should be limited \n")
+	}
+	ns.GetClientRestart().Start(macs, 0)
+	s := ns.GetClientRestart().GetStatus()
+	if s.Restarted != 2 || s.Converged != 2 || !s.Done || ns.stats.restartClient != 2 {
+		t.Fatalf(" bad status %+v \n", s)
+	}
+	c := ns.CLookupByMac(&old[1].Mac)
+	if c == old[1] || c.Ipv4 != old[1].Ipv4 || c.DgIpv4 != old[1].DgIpv4 || len(c.Routes) != 1 {
+		t.Fatalf(" restarted client lost its configuration \n")
+	}
+	if ns.CLookupByMac(&old[0].Mac) != old[0] {
+		t.Fatalf(" client was restarted \n")
+	}
+}
+
+func TestClientRestartError(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	c := NewClientCmd(ns, &CClientCmd{Mac: MACKey{0, 0, 1, 0, 0, 1}, Ipv4: Ipv4Key{16, 0, 0, 1},
+		DgIpv4: Ipv4Key{16, 0, 0, 100}})
+	c.SetVlanPolicy([]CClientVlanRuleCmd{{Ipv4: Ipv4Key{48, 0, 0, 0}, PrefixLen: 8, Vlan: 100}})
+	ns.AddClient(c)
+	other := NewClient(ns, MACKey{0, 0, 1, 0, 0, 2}, Ipv4Key{16, 0, 0, 2}, Ipv6Key{}, Ipv4Key{16, 0, 0, 100})
+	ns.AddClient(other)
+
+	// an invalid configuration keeps the old client
+	c.initCmd.Dns = &CClientDnsCmd{Ipv4: []Ipv4Key{{}}}
+	if _, err := ns.RestartClient(c); err == nil {
+		t.Fatalf(" restart with an invalid dns should fail \n")
+	}
+	c.initCmd.Dns = nil
+
+	// an address owned by another client keeps the old client
+	c.initCmd.Ipv4 = other.Ipv4
+	if _, err := ns.RestartClient(c); err == nil {
+		t.Fatalf(" restart with the ipv4 of another client should fail \n")
+	}
+	if ns.CLookupByMac(&c.Mac) != c || ns.CLookupByIPv4(&c.Ipv4) != c || ns.stats.restartClient != 0 ||
+		tctx.vlanClients != 1 {
+		t.Fatalf(" failed restart should keep the client \n")
+	}
+}
+
+func TestClientRestartNat64(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	c := NewClient(ns, MACKey{0, 0, 1, 0, 0, 1}, Ipv4Key{}, Ipv6Key{0x20, 0x01, 0x0d, 0xb8, 15: 1}, Ipv4Key{})
+	c.SetNat64(&CClientNat64Cmd{Prefix: parseIpv6("2001:db8:122:344::"), PrefixLen: 64, Dns64: true})
+	ns.AddClient(c)
+
+	nc, err := ns.RestartClient(c)
+	if err != nil {
+		t.Fatalf(" restart failed %v \n", err)
+	}
+	info := nc.GetNat64()
+	if info.Nat64 == nil || info.Nat64.PrefixLen != 64 || !info.Nat64.Dns64 {
+		t.Fatalf(" restarted client lost its nat64 %+v \n", info)
+	}
+	if d, ok := nc.Nat64Dst(Ipv4Key{192, 0, 2, 33}); !ok || d != parseIpv6("2001:db8:122:344:c0:2:2100:0") {
+		t.Fatalf(" bad synthesized address %v \n", d)
+	}
+}
+
+func TestClientRestartDg(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	c := NewClient(ns, MACKey{0, 0, 1, 0, 0, 1}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 100})
+	ns.AddClient(c)
+
+	params := fastjson.RawMessage(`{"tun": {"vport": 1}, "macs": [[0, 0, 1, 0, 0, 1]], "dg": [16, 0, 0, 101]}`)
+	if _, err := (ApiClientSetDgHandler{}).ServeJSONRPC(tctx, &params); err != nil {
+		t.Fatalf(" set dg failed %v \n", err)
+	}
+	nc, err := ns.RestartClient(c)
+	if err != nil || nc.DgIpv4 != (Ipv4Key{16, 0, 0, 101}) {
+		t.Fatalf(" restarted client lost its gateway %v \n", err)
+	}
+
+	// a plugin that does not exist keeps the old client
+	nc.PluginCtx.created = append(nc.PluginCtx.created, pluginInit{name: "no-such-plugin"})
+	if _, err := ns.RestartClient(nc); err == nil || ns.CLookupByMac(&nc.Mac) != nc {
+		t.Fatalf(" failed restart should keep the client \n")
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CClientRouteCmd a static route of a client, exactly one of the next-hops should be provided.
+// A zero prefix length is a default route, it has priority over the default gateway of the client.
+type CClientRouteCmd struct {
+	Ipv4        Ipv4Key `json:"ipv4"` // prefix
+	Ipv6        Ipv6Key `json:"ipv6"` // prefix
+	PrefixLen   uint8   `json:"prefix_len"`
+	NextHopIpv4 Ipv4Key `json:"ipv4_next_hop"`
+	NextHopIpv6 Ipv6Key `json:"ipv6_next_hop"`
+}
+
+// CClientRoute a static route of a client, the next-hop is resolved by the ARP (IPv4) or ND (IPv6) plugin
+type CClientRoute struct {
+	Ipv4        Ipv4Key
+	Ipv6        Ipv6Key
+	PrefixLen   uint8
+	IsIpv6      bool
+	NextHopIpv4 Ipv4Key
+	NextHopIpv6 Ipv6Key
+	Dg          *CClientDg // resolution of the next-hop, set by the resolver plugin
+	Pkts        uint64     // packets sent by this route
+}
+
+// CClientRouteInfo a route of a client, see ctx_client_get_routes
+type CClientRouteInfo struct {
+	CClientRouteCmd
+	Resolved bool   `json:"resolve"`
+	Mac      MACKey `json:"mac"`
+	Pkts     uint64 `json:"pkts"`
+}
+
+// CClientNextHopInfo packets sent toward one next-hop by all the routes of a client
+type CClientNextHopInfo struct {
+	NextHopIpv4 Ipv4Key `json:"ipv4_next_hop"`
+	NextHopIpv6 Ipv6Key `json:"ipv6_next_hop"`
+	Pkts        uint64  `json:"pkts"`
+}
+
+// CClientRoutes the routing table of a client
+type CClientRoutes struct {
+	Mac      MACKey               `json:"mac"`
+	Routes   []CClientRouteInfo   `json:"routes"`
+	NextHops []CClientNextHopInfo `json:"next_hops"`
+}
+
+// maskPrefix clears the host bits of a prefix
+func maskPrefix(p []byte, plen uint8) {
+	for i := range p {
+		bits := int(plen) - i*8
+		if bits >= 8 {
+			continue
+		}
+		if bits <= 0 {
+			p[i] = 0
+		} else {
+			p[i] &= ^byte(0xff >> uint(bits))
+		}
+	}
+}
+
+// matchPrefix returns true if the first plen bits of ip and prefix are equal, the prefix is masked
+func matchPrefix(ip []byte, prefix []byte, plen uint8) bool {
+	full := int(plen / 8)
+	for i := 0; i < full; i++ {
+		if ip[i] != prefix[i] {
+			return false
+		}
+	}
+	if rem := plen % 8; rem != 0 {
+		mask := ^byte(0xff >> rem)
+		if ip[full]&mask != prefix[full] {
+			return false
+		}
+	}
+	return true
+}
+
+// NewClientRoute validates the command and builds a route
+func NewClientRoute(cmd *CClientRouteCmd) (*CClientRoute, error) {
+	o := new(CClientRoute)
+	switch {
+	case !cmd.NextHopIpv4.IsZero() && cmd.NextHopIpv6.IsZero():
+		if !cmd.Ipv6.IsZero() {
+			return nil, fmt.Errorf("route with an ipv4 next-hop %v can't have an ipv6 prefix", cmd.NextHopIpv4)
+		}
+		if cmd.PrefixLen > 32 {
+			return nil, fmt.Errorf("invalid ipv4 prefix length %d", cmd.PrefixLen)
+		}
+		o.Ipv4 = cmd.Ipv4
+		maskPrefix(o.Ipv4[:], cmd.PrefixLen)
+		o.NextHopIpv4 = cmd.NextHopIpv4
+	case cmd.NextHopIpv4.IsZero() && !cmd.NextHopIpv6.IsZero():
+		if !cmd.Ipv4.IsZero() {
+			return nil, fmt.Errorf("route with an ipv6 next-hop %v can't have an ipv4 prefix", cmd.NextHopIpv6)
+		}
+		if cmd.PrefixLen > 128 {
+			return nil, fmt.Errorf("invalid ipv6 prefix length %d", cmd.PrefixLen)
+		}
+		o.Ipv6 = cmd.Ipv6
+		maskPrefix(o.Ipv6[:], cmd.PrefixLen)
+		o.NextHopIpv6 = cmd.NextHopIpv6
+		o.IsIpv6 = true
+	default:
+		return nil, fmt.Errorf("route should have exactly one next-hop, ipv4 or ipv6")
+	}
+	o.PrefixLen = cmd.PrefixLen
+	return o, nil
+}
+
+// SetRoutes replaces the routing table of the client, MSG_UPDATE_ROUTES is sent to the plugins
+// with the old and the new table so the resolver could move to the new next-hops
+func (o *CClient) SetRoutes(cmds []CClientRouteCmd) error {
+	routes := make([]*CClientRoute, 0, len(cmds))
+	for i := range cmds {
+		r, err := NewClientRoute(&cmds[i])
+		if err != nil {
+			return err
+		}
+		for _, e := range routes {
+			if e.IsIpv6 == r.IsIpv6 && e.PrefixLen == r.PrefixLen && e.Ipv4 == r.Ipv4 && e.Ipv6 == r.Ipv6 {
+				return fmt.Errorf("duplicate route, prefix length %d", r.PrefixLen)
+			}
+		}
+		routes = append(routes, r)
+	}
+	// longest prefix first
+	sort.SliceStable(routes, func(i, j int) bool { return routes[i].PrefixLen > routes[j].PrefixLen })
+	old := o.Routes
+	o.Routes = routes
+	o.routesEpoc++
+	o.initCmd.Routes = append([]CClientRouteCmd(nil), cmds...)
+	o.PluginCtx.BroadcastMsg(nil, MSG_UPDATE_ROUTES, old, routes)
+	return nil
+}
+
+// RoutesEpoc returns the epoc of the static routes, a flow that resolved its next-hop by a route should
+// resolve it again once the epoc was changed
+func (o *CClient) RoutesEpoc() uint32 {
+	return o.routesEpoc
+}
+
+// LookupRouteIPv4 longest prefix match of an ipv4 destination, nil if there is no route
+func (o *CClient) LookupRouteIPv4(dst Ipv4Key) *CClientRoute {
+	for _, r := range o.Routes {
+		if !r.IsIpv6 && matchPrefix(dst[:], r.Ipv4[:], r.PrefixLen) {
+			return r
+		}
+	}
+	return nil
+}
+
+// LookupRouteIPv6 longest prefix match of an ipv6 destination, nil if there is no route
+func (o *CClient) LookupRouteIPv6(dst Ipv6Key) *CClientRoute {
+	for _, r := range o.Routes {
+		if r.IsIpv6 && matchPrefix(dst[:], r.Ipv6[:], r.PrefixLen) {
+			return r
+		}
+	}
+	return nil
+}
+
+// resolve returns the MAC of the next-hop of the route
+func (o *CClientRoute) resolve() (mac MACKey, ok bool) {
+	if o.Dg != nil && o.Dg.IpdgResolved {
+		mac, ok = o.Dg.IpdgMac, true
+	}
+	return
+}
+
+// ResolveIPv4RouteMac returns the MAC of the next-hop toward dst, the route is nil in case the
+// default gateway is used. A matching route with an unresolved next-hop is not resolved.
+func (o *CClient) ResolveIPv4RouteMac(dst Ipv4Key) (mac MACKey, route *CClientRoute, ok bool) {
+	route = o.LookupRouteIPv4(dst)
+	if route == nil {
+		mac, ok = o.ResolveIPv4DGMac()
+		return
+	}
+	mac, ok = route.resolve()
+	return
+}
+
+// ResolveIPv6RouteMac returns the MAC of the next-hop toward dst, see ResolveIPv4RouteMac
+func (o *CClient) ResolveIPv6RouteMac(dst Ipv6Key) (mac MACKey, route *CClientRoute, ok bool) {
+	route = o.LookupRouteIPv6(dst)
+	if route == nil {
+		mac, ok = o.ResolveIPv6DGMac()
+		return
+	}
+	mac, ok = route.resolve()
+	return
+}
+
+// GetRoutes returns the routing table with the packets per route and per next-hop
+func (o *CClient) GetRoutes() *CClientRoutes {
+	res := &CClientRoutes{Mac: o.Mac}
+	res.Routes = make([]CClientRouteInfo, 0, len(o.Routes))
+	res.NextHops = make([]CClientNextHopInfo, 0)
+	for _, r := range o.Routes {
+		var info CClientRouteInfo
+		info.Ipv4 = r.Ipv4
+		info.Ipv6 = r.Ipv6
+		info.PrefixLen = r.PrefixLen
+		info.NextHopIpv4 = r.NextHopIpv4
+		info.NextHopIpv6 = r.NextHopIpv6
+		info.Mac, info.Resolved = r.resolve()
+		info.Pkts = r.Pkts
+		res.Routes = append(res.Routes, info)
+
+		found := false
+		for i := range res.NextHops {
+			nh := &res.NextHops[i]
+			if nh.NextHopIpv4 == r.NextHopIpv4 && nh.NextHopIpv6 == r.NextHopIpv6 {
+				nh.Pkts += r.Pkts
+				found = true
+				break
+			}
+		}
+		if !found {
+			res.NextHops = append(res.NextHops, CClientNextHopInfo{NextHopIpv4: r.NextHopIpv4, NextHopIpv6: r.NextHopIpv6, Pkts: r.Pkts})
+		}
+	}
+	return res
+}
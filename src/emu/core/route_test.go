@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+)
+
+func TestClientRoute1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1})
+	ns := NewNSCtx(tctx, &key)
+	c := NewClient(ns, MACKey{0, 0, 1, 0, 0, 0}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 2})
+
+	err := c.SetRoutes([]CClientRouteCmd{
+		{Ipv4: Ipv4Key{48, 0, 0, 0}, PrefixLen: 8, NextHopIpv4: Ipv4Key{16, 0, 0, 3}},
+		{Ipv4: Ipv4Key{48, 1, 2, 3}, PrefixLen: 23, NextHopIpv4: Ipv4Key{16, 0, 0, 4}}, // masked to 48.1.2.0
+		{Ipv6: Ipv6Key{0x20, 0x01, 0x0d, 0xb8}, PrefixLen: 32, NextHopIpv6: Ipv6Key{0xfe, 0x80, 15: 1}},
+	})
+	if err != nil {
+		t.Fatalf(" set routes failed %v \n", err)
+	}
+
+	for _, e := range []struct {
+		dst Ipv4Key
+		nh  Ipv4Key
+	}{
+		{Ipv4Key{48, 1, 3, 1}, Ipv4Key{16, 0, 0, 4}},
+		{Ipv4Key{48, 1, 4, 1}, Ipv4Key{16, 0, 0, 3}},
+		{Ipv4Key{48, 9, 9, 9}, Ipv4Key{16, 0, 0, 3}},
+	} {
+		r := c.LookupRouteIPv4(e.dst)
+		if r == nil || r.NextHopIpv4 != e.nh {
+			t.Fatalf(" bad route for %v %+v \n", e.dst, r)
+		}
+	}
+	if r := c.LookupRouteIPv4(Ipv4Key{49, 0, 0, 1}); r != nil {
+		t.Fatalf(" unexpected route %+v \n", r)
+	}
+	if r := c.LookupRouteIPv6(Ipv6Key{0x20, 0x01, 0x0d, 0xb8, 15: 5}); r == nil || !r.IsIpv6 {
+		t.Fatalf(" bad ipv6 route %+v \n", r)
+	}
+
+	// a route with an unresolved next-hop does not fall back to the default gateway
+	c.ForceDGW = true
+	if _, r, ok := c.ResolveIPv4RouteMac(Ipv4Key{48, 0, 0, 1}); ok || r == nil {
+		t.Fatalf(" unresolved next-hop should not resolve \n")
+	}
+	if _, r, ok := c.ResolveIPv4RouteMac(Ipv4Key{49, 0, 0, 1}); !ok || r != nil {
+		t.Fatalf(" default gateway should be used \n")
+	}
+	c.LookupRouteIPv4(Ipv4Key{48, 0, 0, 1}).Dg = &CClientDg{IpdgResolved: true, IpdgMac: MACKey{0, 0, 3, 0, 0, 0}}
+	c.LookupRouteIPv4(Ipv4Key{48, 0, 0, 1}).Pkts = 5
+	c.LookupRouteIPv4(Ipv4Key{48, 1, 2, 1}).Pkts = 2
+	if mac, _, ok := c.ResolveIPv4RouteMac(Ipv4Key{48, 0, 0, 1}); !ok || mac != (MACKey{0, 0, 3, 0, 0, 0}) {
+		t.Fatalf(" bad next-hop mac %v \n", mac)
+	}
+	res := c.GetRoutes()
+	if len(res.Routes) != 3 || len(res.NextHops) != 3 || res.NextHops[1].Pkts != 2 || res.NextHops[2].Pkts != 5 {
+		t.Fatalf(" bad routes %+v \n", res)
+	}
+
+	for _, bad := range [][]CClientRouteCmd{
+		{{PrefixLen: 8}},
+		{{PrefixLen: 33, NextHopIpv4: Ipv4Key{16, 0, 0, 3}}},
+		{{Ipv6: Ipv6Key{0x20}, NextHopIpv4: Ipv4Key{16, 0, 0, 3}}},
+		{{NextHopIpv4: Ipv4Key{16, 0, 0, 3}}, {NextHopIpv4: Ipv4Key{16, 0, 0, 4}}},
+	} {
+		if c.SetRoutes(bad) == nil {
+			t.Fatalf(" invalid routes should be rejected %+v \n", bad)
+		}
+	}
+	if len(c.Routes) != 3 {
+		t.Fatalf(" invalid routes should not change the table \n")
+	}
+}
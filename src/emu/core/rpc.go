@@ -6,28 +6,193 @@
 package core
 
 import (
+	"crypto/subtle"
 	"external/osamingo/jsonrpc"
 	zmq "external/pebbe/zmq4"
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
+
+	"github.com/intel-go/fastjson"
 )
 
 var method_repo []cRpcMethodRec = make([]cRpcMethodRec, 0)
 
+const RPC_DEFAULT_QUEUE = 64
+
 type cRpcMethodRec struct {
 	method string
 	h      jsonrpc.Handler
 	noApi  bool
 }
 
+// cRpcReq a request of a client, id is the zmq identity of the client for the response
+type cRpcReq struct {
+	id  []byte
+	msg []byte
+}
+
+// CZmqJsonRPC2 the rpc server. The rx thread receives the requests of the clients (ROUTER socket) and
+// queues them to the main loop, a request that finds the queue full is answered busy by the rx thread.
+// The main loop sends the responses back to the rx thread by an inproc socket.
 type CZmqJsonRPC2 struct {
 	ctx        *zmq.Context
 	socket     *zmq.Socket
+	resRx      *zmq.Socket // rx thread side of the responses
+	resTx      *zmq.Socket // main loop side of the responses
 	serverPort uint16
 	mr         *jsonrpc.MethodRepository
-	cn         chan []byte
+	cn         chan cRpcReq // the queue of the main loop
 	simulation bool
+	stats      CRpcStats
+	Cdb        *CCounterDb
+}
+
+type CRpcStats struct {
+	rxPending     uint64 // queued or in the main loop, updated by the rx thread
+	rxBusy        uint64 // updated by the rx thread
+	authenticated uint64
+	rejected      uint64
+	rateLimited   uint64
+	busy          uint64
+	queueDepth    uint64
+}
+
+// PreUpdate copies the counters of the rx thread
+func (o *CRpcStats) PreUpdate() {
+	o.busy = atomic.LoadUint64(&o.rxBusy)
+	o.queueDepth = atomic.LoadUint64(&o.rxPending)
+}
+
+func newRpcStatsDb(o *CRpcStats) *CCounterDb {
+	db := NewCCounterDb("rpc")
+	db.IOpt = o
+	db.Add(&CCounterRec{
+		Counter:  &o.authenticated,
+		Name:     "authenticated",
+		Help:     "rpc requests authenticated",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.rejected,
+		Name:     "rejected",
+		Help:     "rpc requests rejected, not authenticated",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScERROR})
+	db.Add(&CCounterRec{
+		Counter:  &o.rateLimited,
+		Name:     "rateLimited",
+		Help:     "rpc requests rejected, over the rate limit",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScERROR})
+	db.Add(&CCounterRec{
+		Counter:  &o.busy,
+		Name:     "busy",
+		Help:     "rpc messages rejected, the queue of the main loop is full",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScERROR})
+	db.Add(&CCounterRec{
+		Counter:  &o.queueDepth,
+		Name:     "queueDepth",
+		Help:     "rpc messages received and not answered yet",
+		Unit:     "msgs",
+		DumpZero: false,
+		Info:     ScINFO})
+	return db
+}
+
+// CRpcAuthCounter wraps an authenticator and counts its results
+type CRpcAuthCounter struct {
+	auth  jsonrpc.Authenticator
+	stats *CRpcStats
+}
+
+func (o *CRpcAuthCounter) Authenticate(method string, params *fastjson.RawMessage) *jsonrpc.Error {
+	err := o.auth.Authenticate(method, params)
+	if err != nil {
+		o.stats.rejected++
+	} else {
+		o.stats.authenticated++
+	}
+	return err
+}
+
+// CRpcTokenAuth verifies a shared token, each request should have "auth_token" in its params
+type CRpcTokenAuth struct {
+	token []byte
+}
+
+type rpcAuthTokenParams struct {
+	Token string `json:"auth_token"`
+}
+
+func NewRpcTokenAuth(token string) *CRpcTokenAuth {
+	return &CRpcTokenAuth{token: []byte(token)}
+}
+
+func (o *CRpcTokenAuth) Authenticate(method string, params *fastjson.RawMessage) *jsonrpc.Error {
+	var p rpcAuthTokenParams
+	if params == nil || fastjson.Unmarshal(*params, &p) != nil || p.Token == "" {
+		err := jsonrpc.ErrUnauthorized()
+		err.Data = "auth_token is missing"
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(p.Token), o.token) != 1 {
+		err := jsonrpc.ErrUnauthorized()
+		err.Data = "wrong auth_token"
+		return err
+	}
+	return nil
+}
+
+// CRpcLimiter is a token bucket, rate requests per second with bursts of up to burst requests. Only the
+// authenticated requests take a token.
+type CRpcLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	stats  *CRpcStats
+}
+
+// NewRpcLimiter creates a limiter, zero burst is one second of rate
+func NewRpcLimiter(rate, burst uint32, stats *CRpcStats) *CRpcLimiter {
+	o := new(CRpcLimiter)
+	if burst == 0 {
+		burst = rate
+	}
+	if burst == 0 {
+		burst = 1
+	}
+	o.rate = float64(rate)
+	o.burst = float64(burst)
+	o.tokens = o.burst
+	o.now = time.Now
+	o.stats = stats
+	return o
+}
+
+func (o *CRpcLimiter) Allow(method string) *jsonrpc.Error {
+	now := o.now()
+	if !o.last.IsZero() {
+		o.tokens += now.Sub(o.last).Seconds() * o.rate
+		if o.tokens > o.burst {
+			o.tokens = o.burst
+		}
+	}
+	o.last = now
+	if o.tokens < 1 {
+		o.stats.rateLimited++
+		return jsonrpc.ErrBusy()
+	}
+	o.tokens--
+	return nil
 }
 
 func RegisterCB(method string, h jsonrpc.Handler, noApi bool) {
@@ -38,12 +203,36 @@ func (o *CZmqJsonRPC2) SetCtx(i interface{}) {
 	o.mr.SetCtx(i)
 }
 
+// SetAuthenticator verifies each request with a, nil disables the authentication (default)
+func (o *CZmqJsonRPC2) SetAuthenticator(a jsonrpc.Authenticator) {
+	if a == nil {
+		o.mr.SetAuthenticator(nil)
+		return
+	}
+	o.mr.SetAuthenticator(&CRpcAuthCounter{auth: a, stats: &o.stats})
+}
+
+// SetLimit limits the requests to rate per second with bursts of burst, zero rate disables the limit (default).
+// A message that finds queue messages waiting for the main loop is answered busy by the rx thread, zero is
+// RPC_DEFAULT_QUEUE. Should be called before StartRxThread.
+func (o *CZmqJsonRPC2) SetLimit(rate, burst uint32, queue uint32) {
+	if rate == 0 {
+		o.mr.SetLimiter(nil)
+	} else {
+		o.mr.SetLimiter(NewRpcLimiter(rate, burst, &o.stats))
+	}
+	if queue == 0 {
+		queue = RPC_DEFAULT_QUEUE
+	}
+	o.cn = make(chan cRpcReq, queue)
+}
+
 // NewZmqRpc create a zmq server in port
 func (o *CZmqJsonRPC2) NewZmqRpc(serverPort uint16, simulation bool) {
 	context, err := zmq.NewContext()
 	o.simulation = simulation
-	socket, err := context.NewSocket(zmq.REP)
-	o.cn = make(chan []byte)
+	socket, err := context.NewSocket(zmq.ROUTER)
+	o.cn = make(chan cRpcReq, RPC_DEFAULT_QUEUE)
 
 	if err != nil {
 		panic(err)
@@ -59,9 +248,22 @@ func (o *CZmqJsonRPC2) NewZmqRpc(serverPort uint16, simulation bool) {
 	bindStr := fmt.Sprintf("tcp://*:%d", o.serverPort)
 	socket.Bind(bindStr)
 
+	resStr := fmt.Sprintf("inproc://rpc-res-%d", o.serverPort)
+	o.resRx, err = context.NewSocket(zmq.PAIR)
+	if err != nil {
+		panic(err)
+	}
+	o.resRx.Bind(resStr)
+	o.resTx, err = context.NewSocket(zmq.PAIR)
+	if err != nil {
+		panic(err)
+	}
+	o.resTx.Connect(resStr)
+
 	mr := jsonrpc.NewMethodRepository()
 	o.mr = mr
 	o.mr.Verbose = false
+	o.Cdb = newRpcStatsDb(&o.stats)
 
 	for _, rec := range method_repo {
 		if o.mr.Verbose {
@@ -79,21 +281,62 @@ func (o *CZmqJsonRPC2) NewZmqRpc(serverPort uint16, simulation bool) {
 }
 
 func (o *CZmqJsonRPC2) rxThread() {
+	poller := zmq.NewPoller()
+	poller.Add(o.socket, zmq.POLLIN)
+	poller.Add(o.resRx, zmq.POLLIN)
 	for {
-		msg, err := o.socket.RecvBytes(0)
+		polled, err := poller.Poll(-1)
 		if err != nil {
 			time.Sleep(10 * time.Millisecond)
-		} else {
-			o.cn <- msg
-			res := <-o.cn
-			o.socket.SendBytes(res, 0)
-
+			continue
+		}
+		for _, p := range polled {
+			if p.Socket == o.socket {
+				o.rxReq()
+			} else {
+				o.txRes()
+			}
 		}
 	}
 }
 
-// GetC return the channel
-func (o *CZmqJsonRPC2) GetC() chan []byte {
+// rxReq receives a request, identity, empty delimiter and the message
+func (o *CZmqJsonRPC2) rxReq() {
+	parts, err := o.socket.RecvMessageBytes(0)
+	if err != nil || len(parts) != 3 {
+		return
+	}
+	req := cRpcReq{id: parts[0], msg: parts[2]}
+	if !o.enqueue(req) {
+		o.socket.SendMessage(req.id, "", jsonrpc.ServeBytesError(req.msg, jsonrpc.ErrBusy()))
+	}
+}
+
+// txRes sends a response of the main loop to its client
+func (o *CZmqJsonRPC2) txRes() {
+	parts, err := o.resRx.RecvMessageBytes(0)
+	if err != nil || len(parts) != 2 {
+		return
+	}
+	o.socket.SendMessage(parts[0], "", parts[1])
+	atomic.AddUint64(&o.stats.rxPending, ^uint64(0))
+}
+
+// enqueue passes the request to the main loop, false in case the queue is full
+func (o *CZmqJsonRPC2) enqueue(req cRpcReq) bool {
+	atomic.AddUint64(&o.stats.rxPending, 1)
+	select {
+	case o.cn <- req:
+		return true
+	default:
+		atomic.AddUint64(&o.stats.rxPending, ^uint64(0))
+		atomic.AddUint64(&o.stats.rxBusy, 1)
+		return false
+	}
+}
+
+// GetC return the queue of the requests
+func (o *CZmqJsonRPC2) GetC() chan cRpcReq {
 	return o.cn
 }
 
@@ -105,12 +348,14 @@ func (o *CZmqJsonRPC2) StartRxThread() {
 // Delete  this is an help
 func (o *CZmqJsonRPC2) Delete() {
 	o.socket.Close()
+	o.resTx.Close()
+	o.resRx.Close()
 }
 
-// HandleReqToChan input buffer return resonse to chan
-func (o *CZmqJsonRPC2) HandleReqToChan(req []byte) {
-	res := o.mr.ServeBytesCompress(req)
-	o.cn <- res
+// HandleReqToChan handles a request of the queue and sends the response to the rx thread
+func (o *CZmqJsonRPC2) HandleReqToChan(req cRpcReq) {
+	res := o.mr.ServeBytesCompress(req.msg)
+	o.resTx.SendMessage(req.id, res)
 }
 
 // HandleReq input buffer return buffer
@@ -72,6 +72,91 @@ type (
 		DefPlugs MapJsonPlugs `json:"def_plugs"`
 	}
 
+	/* Ns time scale, affects all the protocol timers of the namespace */
+	ApiNsSetTimeScaleHandler struct{}
+	ApiNsSetTimeScaleParams  struct {
+		Scale uint32 `json:"scale" validate:"required,gte=1,lte=1000"`
+	} /* key tunnel */
+	/* Ns passive mode, suppress the proactive tx of all the plugins */
+	ApiNsSetStealthHandler struct{}
+	ApiNsSetStealthParams  struct {
+		Stealth bool `json:"stealth"`
+	} /* key tunnel */
+	/* Ns timestamp source of the captures, traces and event logs */
+	ApiNsSetTsSourceHandler struct{}
+	ApiNsSetTsSourceParams  struct {
+		Source string `json:"source"` // mono or realtime, see TS_SOURCE_MONO
+	} /* key tunnel */
+
+	/* Ns address ownership registry */
+	ApiNsAddrOwnersHandler struct{}
+	ApiNsAddrOwnersParams  struct {
+		Kind string `json:"kind"` // see ADDR_OWNER_MAC, empty for all the kinds
+	}
+	ApiNsAddrOwnersResult struct {
+		Owners []CAddrOwnerRec `json:"owners"`
+	}
+
+	ApiNsAddrOwnerHandler struct{}
+	ApiNsAddrOwnerParams  struct {
+		Mac  *MACKey  `json:"mac"`
+		Ipv4 *Ipv4Key `json:"ipv4"`
+		Ipv6 *Ipv6Key `json:"ipv6"` // link-local and SLAAC addresses are owned too
+	}
+	ApiNsAddrOwnerResult struct {
+		Found bool   `json:"found"`
+		Owner MACKey `json:"owner"`
+	}
+
+	ApiNsAddrOwnerCntHandler struct{}
+
+	/* Ns restart of many clients at once */
+	ApiNsClientRestartHandler struct{}
+	ApiNsClientRestartParams  struct {
+		Macs       []MACKey `json:"macs"`                       // all the clients in case it is empty
+		Percent    uint32   `json:"percent" validate:"lte=100"` // of the selected clients, zero is all of them
+		SpreadMsec uint32   `json:"spread_msec"`                // zero restarts all of them at once
+	}
+	ApiNsClientRestartResult struct {
+		Selected uint32 `json:"selected"`
+	}
+
+	ApiNsClientRestartStatusHandler struct{}
+
+	/* Ns export of the state, see CNsState */
+	ApiNsGetStateHandler struct{}
+	ApiNsGetStateParams  struct {
+		Index uint32 `json:"index"` // first client of the page
+		Count uint32 `json:"count"` // clients in the page, zero for the default, STATE_MAX_PAGE_SIZE at most
+	}
+
+	/* Ns stuck transactions of the clients */
+	ApiNsClientStuckHandler struct{}
+	ApiNsClientStuckParams  struct {
+		CStuckFilter
+	}
+	ApiNsClientStuckResetParams struct {
+		CStuckFilter
+		Macs []MACKey `json:"macs"` // all the clients in case it is empty
+	}
+	ApiNsClientStuckResult struct {
+		Transactions []CStuckTransaction `json:"transactions"`
+	}
+
+	ApiNsClientStuckResetHandler struct{}
+
+	/* Ns DSCP/PCP rewrite of the reflected frames */
+	ApiNsSetReflectRewriteHandler struct{}
+	ApiNsSetReflectRewriteParams  struct {
+		CReflectRewrite
+	} /* key tunnel */
+
+	ApiNsGetTimeScaleHandler struct{}
+	ApiNsGetTimeScaleResult  struct {
+		Scale    uint32  `json:"scale"`
+		TickMsec float64 `json:"tick_msec"` // scaled duration of a tick
+	}
+
 	/* Client Commands */
 	ApiClientAddHandler struct{}
 	ApiClientAddParams  struct{} /* key tunnel, [ClientCmd] */
@@ -85,6 +170,93 @@ type (
 		ClientInfo []CClientInfo `json:"client_info"`
 	}
 
+	ApiClientGetGwHandler struct{}
+	ApiClientGetGwParams  struct{} /* key tunnel, [MAC] */
+	ApiClientGetGwResult  struct {
+		Clients    []CClientGwStatus `json:"clients"`
+		Unresolved uint32            `json:"unresolved"` // clients with a gateway that is not resolved
+	}
+
+	ApiClientSetRoutesHandler struct{}
+	ApiClientSetRoutesParams  struct {
+		Routes []CClientRouteCmd `json:"routes"`
+	} /* key tunnel, [MAC] */
+
+	ApiClientSetVlanPolicyHandler struct{}
+	ApiClientSetVlanPolicyParams  struct {
+		Rules []CClientVlanRuleCmd `json:"rules"` // empty for untagged
+	} /* key tunnel, [MAC] */
+
+	ApiClientGetVlanPolicyHandler struct{}
+	ApiClientGetVlanPolicyResult  struct {
+		Clients []*CClientVlanPolicyInfo `json:"clients"`
+	}
+
+	ApiClientSetNat64Handler struct{}
+	ApiClientSetNat64Params  struct {
+		Nat64 *CClientNat64Cmd `json:"nat64"` // null removes the NAT64
+	} /* key tunnel, [MAC] */
+
+	ApiClientGetNat64Handler struct{}
+	ApiClientGetNat64Result  struct {
+		Clients []*CClientNat64Info `json:"clients"`
+	}
+
+	ApiClientSetDnsHandler struct{}
+	ApiClientSetDnsParams  struct {
+		Dns *CClientDnsCmd `json:"dns"` // null removes the static resolvers
+	} /* key tunnel, [MAC] */
+
+	ApiClientGetDnsHandler struct{}
+	ApiClientGetDnsResult  struct {
+		Clients []*CClientDnsInfo `json:"clients"`
+	}
+
+	ApiClientSetEncapHandler struct{}
+	ApiClientSetEncapParams  struct {
+		Encap *CClientEncapCmd `json:"encap"` // null is the encapsulation of the namespace
+	} /* key tunnel, [MAC] */
+
+	ApiClientGetEncapHandler struct{}
+	ApiClientGetEncapResult  struct {
+		Clients []*CClientEncapInfo `json:"clients"`
+	}
+
+	ApiClientSetIpv6ScopeHandler struct{}
+	ApiClientSetIpv6ScopeParams  struct {
+		Enable bool `json:"enable"`
+	} /* key tunnel, [MAC] */
+
+	ApiNsGetIpv6ScopeHandler struct{}
+	ApiNsGetIpv6ScopeParams  struct {
+		Clear bool `json:"clear"` // clear the samples
+	} /* key tunnel */
+
+	ApiClientDns64Handler struct{}
+	ApiClientDns64Params  struct {
+		Mac MACKey    `json:"mac" validate:"required"`
+		Vec []Ipv4Key `json:"vec"` // A records
+	} /* key tunnel */
+	ApiClientDns64Result struct {
+		Vec []Ipv6Key `json:"vec"` // AAAA records
+	}
+
+	ApiClientBlackholeHandler struct{}
+	ApiClientBlackholeParams  struct {
+		Blackhole bool `json:"blackhole"` // false restores the clients
+	} /* key tunnel, [MAC] */
+
+	ApiClientLinkUpHandler struct{}
+	ApiClientLinkUpParams  struct{} /* key tunnel, [MAC] */
+
+	ApiClientGetRoutesHandler struct{}
+	ApiClientGetRoutesParams  struct{} /* key tunnel, [MAC] */
+
+	ApiClientSetDgHandler struct{}
+	ApiClientSetDgParams  struct {
+		Dg Ipv4Key `json:"dg"` // new default gateway, zero for none
+	} /* key tunnel, [MAC] */
+
 	/* Client Default Plugins */
 	ApiClientSetDefPlugHandler struct{}
 	ApiClientSetDefPlugParams  struct {
@@ -114,6 +286,77 @@ type (
 		Mask  []string `json:"mask"`  // get only specific counters blocks if it is empty get all
 		Clear bool     `json:"clear"` // clear all counters
 	}
+
+	/* Received frames compare */
+	ApiRxHistoryHandler struct{}
+	ApiRxHistoryParams  struct {
+		Size uint32 `json:"size"` // number of received frames to keep, 0 disables
+	}
+
+	/* limits of the concurrent captures */
+	ApiSetCaptureLimitsHandler struct{}
+
+	ApiGetCapturesHandler struct{}
+
+	/* timeline of timed actions */
+	ApiTimelineStartHandler struct{}
+	ApiTimelineStartParams  struct {
+		Actions []CTimelineAction `json:"actions" validate:"required,dive"`
+	}
+
+	ApiTimelineGetHandler struct{}
+
+	ApiTimelineCancelHandler struct{}
+
+	/* verification of the checksums of the received packets */
+	ApiCsVerifyHandler struct{}
+	ApiCsVerifyParams  struct {
+		Ip         *bool   `json:"ip"`          // ipv4 header checksum, keep the current if missing
+		L4         *bool   `json:"l4"`          // tcp/udp checksum, keep the current if missing
+		SampleSize *uint32 `json:"sample_size"` // number of frames with a bad tcp/udp checksum to keep, 0 disables, keep the current if missing
+		SampleRate *uint32 `json:"sample_rate"` // keep one of every rate bad frames, keep the current if missing
+	}
+
+	/* FCS of the received frames of a namespace */
+	ApiNsSetRxFcsHandler struct{}
+	ApiNsSetRxFcsParams  struct {
+		Fcs        bool   `json:"fcs"`         // the received frames end with the FCS
+		SampleSize uint32 `json:"sample_size"` // number of frames with a bad FCS to keep, 0 disables
+		SampleRate uint32 `json:"sample_rate"` // keep one of every rate bad frames, default 1
+	} /* key tunnel */
+
+	ApiNsFcsErrorsHandler struct{}
+	ApiNsFcsErrorsParams  struct {
+		Clear bool `json:"clear"`
+	} /* key tunnel */
+	ApiNsFcsErrorsResult struct {
+		Frames []CFcsErrFrame `json:"frames"`
+	}
+
+	ApiCsErrorsHandler struct{}
+	ApiCsErrorsParams  struct {
+		Clear bool `json:"clear"`
+	}
+	ApiCsErrorsResult struct {
+		Frames []CCsErrFrame `json:"frames"`
+	}
+
+	ApiFrameDiffHandler struct{}
+	ApiFrameDiffParams  struct {
+		Frame    []byte   `json:"frame" validate:"required"` // expected frame, base64
+		Key      []string `json:"key"`                       // see FRAME_KEY_DST_MAC, empty matches the last frame
+		Vport    uint16   `json:"vport"`
+		MaxDiffs uint16   `json:"max_diffs"` // default 256
+	}
+
+	ApiMetricsHandler struct{}
+	ApiMetricsParams  struct {
+		Zero    bool `json:"zero"`    // export zero counters too
+		Clients bool `json:"clients"` // a client label per client instead of a sum per namespace
+	}
+	ApiMetricsResult struct {
+		Metrics string `json:"metrics"` // Prometheus text exposition format
+	}
 )
 
 // ping
@@ -124,6 +367,217 @@ func (h ApiPingHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessag
 	}, nil
 }
 
+// set the size of the rx frames history
+func (h ApiRxHistoryHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiRxHistoryParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err == nil {
+		err = tctx.SetRxHistory(p.Size)
+	}
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// set the limits of the concurrent captures
+func (h ApiSetCaptureLimitsHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p CCaptureLimits
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err == nil {
+		err = tctx.captures.SetLimits(&p)
+	}
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// get the captures in progress, their memory and the limits
+func (h ApiGetCapturesHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	return tctx.captures.GetInfo(), nil
+}
+
+// start a timeline of actions executed on the clock of the thread, the timeline in progress is canceled
+func (h ApiTimelineStartHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiTimelineStartParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err == nil {
+		err = tctx.timeline.Start(tctx, p.Actions)
+	}
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// get the progress of the timeline
+func (h ApiTimelineGetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	return tctx.timeline.GetInfo(), nil
+}
+
+// cancel the timeline in progress
+func (h ApiTimelineCancelHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	tctx.timeline.Cancel()
+	return nil, nil
+}
+
+// set the verification of the checksums of the received packets and the sample of the bad frames
+func (h ApiCsVerifyHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiCsVerifyParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err == nil && (p.SampleSize != nil || p.SampleRate != nil) {
+		size, rate := tctx.parser.csErrs.size, tctx.parser.csErrs.rate
+		if p.SampleSize != nil {
+			size = *p.SampleSize
+		}
+		if p.SampleRate != nil {
+			rate = *p.SampleRate
+		}
+		err = tctx.SetCsErrSampler(size, rate)
+	}
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	ip, l4 := !tctx.parser.noIpCsVerify, !tctx.parser.noL4CsVerify
+	if p.Ip != nil {
+		ip = *p.Ip
+	}
+	if p.L4 != nil {
+		l4 = *p.L4
+	}
+	tctx.parser.SetCsVerify(ip, l4)
+	return nil, nil
+}
+
+// get the sampled frames with a bad tcp/udp checksum
+func (h ApiCsErrorsHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiCsErrorsParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return &ApiCsErrorsResult{Frames: tctx.parser.csErrs.Get(p.Clear)}, nil
+}
+
+func (h ApiNsSetRxFcsHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsSetRxFcsParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err == nil {
+		err = ns.SetRxFcs(p.Fcs, p.SampleSize, p.SampleRate)
+	}
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+// get the sampled frames with a bad FCS
+func (h ApiNsFcsErrorsHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsFcsErrorsParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return &ApiNsFcsErrorsResult{Frames: ns.GetFcsErrors(p.Clear)}, nil
+}
+
+func (h ApiNsGetIpv6ScopeHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsGetIpv6ScopeParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return ns.GetIpv6Scope(p.Clear), nil
+}
+
+// compare an expected frame with the last received one
+func (h ApiFrameDiffHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiFrameDiffParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err == nil && !tctx.rxHistory.IsEnabled() {
+		err = fmt.Errorf("rx history is disabled, see ctx_rx_history")
+	}
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	maxDiffs := 256
+	if p.MaxDiffs > 0 {
+		maxDiffs = int(p.MaxDiffs)
+	}
+	res, err := tctx.rxHistory.Compare(p.Frame, p.Key, p.Vport, maxDiffs)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return res, nil
+}
+
 // GetVersion
 func (h ApiGetVersionHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
 
@@ -318,6 +772,30 @@ func (h ApiClientAddHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawM
 	for _, c := range newc.Clients {
 		client := NewClientCmd(ns, &c)
 
+		err = client.SetRoutes(c.Routes)
+		if err != nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: err.Error(),
+			}
+		}
+
+		err = client.SetNat64(c.Nat64)
+		if err != nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: err.Error(),
+			}
+		}
+
+		err = client.SetDns(c.Dns)
+		if err != nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: err.Error(),
+			}
+		}
+
 		err = ns.AddClient(client)
 		if err != nil {
 			return nil, &jsonrpc.Error{
@@ -326,6 +804,20 @@ func (h ApiClientAddHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawM
 			}
 		}
 
+		// the scope filter, the vlan policy and the encapsulation are shared with the thread, set them only for a client that was added
+		client.SetIpv6ScopeFilter(c.Ipv6ScopeFilter)
+		err = client.SetVlanPolicy(c.VlanPolicy)
+		if err == nil {
+			err = client.SetEncap(c.Encap)
+		}
+		if err != nil {
+			ns.RemoveClient(client)
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: err.Error(),
+			}
+		}
+
 		var plugMap *MapJsonPlugs
 		if c.Plugins == nil {
 			/* client didn't supply plugins, use defaults */
@@ -408,10 +900,833 @@ func (h ApiClientGetInfoHandler) ServeJSONRPC(ctx interface{}, params *fastjson.
 	return res, nil
 }
 
-func (h ApiClientSetDefPlugHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
-	tctx := ctx.(*CThreadCtx)
-	var p ApiClientSetDefPlugParams
-	err := tctx.UnmarshalValidate(*params, &p)
+func (h ApiClientGetGwHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	var res ApiClientGetGwResult
+	res.Clients = make([]CClientGwStatus, len(keys))
+	for i, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		res.Clients[i] = *client.GetGwStatus()
+		if res.Clients[i].IsGwUnresolved() {
+			res.Unresolved++
+		}
+	}
+
+	return &res, nil
+}
+
+func (h ApiClientSetRoutesHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	tctx := ctx.(*CThreadCtx)
+	var p ApiClientSetRoutesParams
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		err = client.SetRoutes(p.Routes)
+		if err != nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidParams,
+				Message: err.Error(),
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiClientSetDgHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	tctx := ctx.(*CThreadCtx)
+	var p ApiClientSetDgParams
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		if client.DgIpv4 != p.Dg {
+			client.UpdateDgIPv4(p.Dg)
+		}
+		client.initCmd.DgIpv4 = p.Dg // a restart keeps the gateway that was set
+	}
+	return nil, nil
+}
+
+func (h ApiClientSetVlanPolicyHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	tctx := ctx.(*CThreadCtx)
+	var p ApiClientSetVlanPolicyParams
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		err = client.SetVlanPolicy(p.Rules)
+		if err != nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidParams,
+				Message: err.Error(),
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiClientGetVlanPolicyHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	var res ApiClientGetVlanPolicyResult
+	res.Clients = make([]*CClientVlanPolicyInfo, 0, len(keys))
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		res.Clients = append(res.Clients, client.GetVlanPolicy())
+	}
+	return &res, nil
+}
+
+func (h ApiClientSetNat64Handler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	tctx := ctx.(*CThreadCtx)
+	var p ApiClientSetNat64Params
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		err = client.SetNat64(p.Nat64)
+		if err != nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidParams,
+				Message: err.Error(),
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiClientGetNat64Handler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	var res ApiClientGetNat64Result
+	res.Clients = make([]*CClientNat64Info, 0, len(keys))
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		res.Clients = append(res.Clients, client.GetNat64())
+	}
+	return &res, nil
+}
+
+func (h ApiClientSetDnsHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	tctx := ctx.(*CThreadCtx)
+	var p ApiClientSetDnsParams
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		err = client.SetDns(p.Dns)
+		if err != nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidParams,
+				Message: err.Error(),
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiClientGetDnsHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	var res ApiClientGetDnsResult
+	res.Clients = make([]*CClientDnsInfo, 0, len(keys))
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		res.Clients = append(res.Clients, client.GetDns())
+	}
+	return &res, nil
+}
+
+func (h ApiClientSetEncapHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	tctx := ctx.(*CThreadCtx)
+	var p ApiClientSetEncapParams
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		err = client.SetEncap(p.Encap)
+		if err != nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidParams,
+				Message: err.Error(),
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiClientGetEncapHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	var res ApiClientGetEncapResult
+	res.Clients = make([]*CClientEncapInfo, 0, len(keys))
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		res.Clients = append(res.Clients, client.GetEncap())
+	}
+	return &res, nil
+}
+
+func (h ApiClientSetIpv6ScopeHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	tctx := ctx.(*CThreadCtx)
+	var p ApiClientSetIpv6ScopeParams
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	for _, key := range keys {
+		if ns.GetClient(&key) == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+	}
+	for _, key := range keys {
+		ns.GetClient(&key).SetIpv6ScopeFilter(p.Enable)
+	}
+	return nil, nil
+}
+
+func (h ApiClientDns64Handler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiClientDns64Params
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	client := ns.GetClient(&p.Mac)
+	if client == nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("client with mac: %v doesn't exists", p.Mac),
+		}
+	}
+	var res ApiClientDns64Result
+	res.Vec, err = client.Dns64(p.Vec)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return &res, nil
+}
+
+func (h ApiClientBlackholeHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	tctx := ctx.(*CThreadCtx)
+	var p ApiClientBlackholeParams
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	for _, key := range keys {
+		if ns.GetClient(&key) == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+	}
+	for _, key := range keys {
+		ns.GetClient(&key).SetBlackhole(p.Blackhole)
+	}
+	return nil, nil
+}
+
+func (h ApiClientLinkUpHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	for _, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		client.LinkUp()
+	}
+	return nil, nil
+}
+
+func (h ApiClientGetRoutesHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	ns, keys, err := getNsAndMacs(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	res := make([]CClientRoutes, len(keys))
+	for i, key := range keys {
+		client := ns.GetClient(&key)
+		if client == nil {
+			return nil, &jsonrpc.Error{
+				Code:    jsonrpc.ErrorCodeInvalidRequest,
+				Message: fmt.Sprintf("client with mac: %v doesn't exists", key),
+			}
+		}
+		res[i] = *client.GetRoutes()
+	}
+
+	return res, nil
+}
+
+func (h ApiNsSetTimeScaleHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsSetTimeScaleParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	err = ns.SetTimeScale(p.Scale)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiNsSetStealthHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsSetStealthParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	ns.SetStealth(p.Stealth)
+	return nil, nil
+}
+
+func (h ApiNsSetTsSourceHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsSetTsSourceParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	src, err := ParseTsSource(p.Source)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	ns.SetTsSource(src)
+	return nil, nil
+}
+
+func (h ApiNsSetReflectRewriteHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsSetReflectRewriteParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	ns.SetReflectRewrite(&p.CReflectRewrite)
+	return nil, nil
+}
+
+func (h ApiNsGetTimeScaleHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	var res ApiNsGetTimeScaleResult
+	timerw := ns.GetTimerCtx()
+	res.Scale = timerw.Scale()
+	res.TickMsec = float64(timerw.TickDuration) / float64(time.Millisecond)
+	return &res, nil
+}
+
+func (h ApiNsAddrOwnersHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsAddrOwnersParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	var res ApiNsAddrOwnersResult
+	res.Owners, err = ns.GetAddrOwner().GetOwners(p.Kind)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return &res, nil
+}
+
+func (h ApiNsAddrOwnerHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsAddrOwnerParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	var c *CClient
+	switch {
+	case p.Mac != nil:
+		c = ns.CLookupByMac(p.Mac)
+	case p.Ipv4 != nil:
+		c = ns.CLookupByIPv4(p.Ipv4)
+	case p.Ipv6 != nil:
+		c = ns.CLookupByIPv6LocalGlobal(p.Ipv6)
+	default:
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: "one of mac, ipv4 or ipv6 is required",
+		}
+	}
+	var res ApiNsAddrOwnerResult
+	if c != nil {
+		res.Found = true
+		res.Owner = c.Mac
+	}
+	return &res, nil
+}
+
+func (h ApiNsAddrOwnerCntHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	var p ApiCntParams
+	tctx := ctx.(*CThreadCtx)
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return ns.GetAddrOwner().GetCdbv().GeneralCounters(err, tctx, params, &p)
+}
+
+func (h ApiNsClientRestartHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsClientRestartParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	macs := ns.SelectClientsToRestart(p.Macs, p.Percent)
+	err = ns.GetClientRestart().Start(macs, time.Duration(p.SpreadMsec)*time.Millisecond)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return &ApiNsClientRestartResult{Selected: uint32(len(macs))}, nil
+}
+
+func (h ApiNsClientRestartStatusHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return ns.GetClientRestart().GetStatus(), nil
+}
+
+func (h ApiNsGetStateHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsGetStateParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return ns.GetState(p.Index, p.Count), nil
+}
+
+func (h ApiNsClientStuckHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsClientStuckParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err == nil {
+		err = p.Validate()
+	}
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return &ApiNsClientStuckResult{Transactions: ns.FindStuckTransactions(&p.CStuckFilter)}, nil
+}
+
+func (h ApiNsClientStuckResetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiNsClientStuckResetParams
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err == nil {
+		err = p.Validate()
+	}
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	ns, err := tctx.GetNsRpc(params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return &ApiNsClientStuckResult{Transactions: ns.ResetStuckTransactions(&p.CStuckFilter, p.Macs)}, nil
+}
+
+func (h ApiClientSetDefPlugHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	tctx := ctx.(*CThreadCtx)
+	var p ApiClientSetDefPlugParams
+	err := tctx.UnmarshalValidate(*params, &p)
 	if err != nil {
 		return nil, &jsonrpc.Error{
 			Code:    jsonrpc.ErrorCodeInvalidRequest,
@@ -513,6 +1828,19 @@ func (h ApiCntHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage
 	return tctx.GetCounterDbVec().GeneralCounters(nil, tctx, params, &p)
 }
 
+func (h ApiMetricsHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	var p ApiMetricsParams
+	tctx := ctx.(*CThreadCtx)
+	err := tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return &ApiMetricsResult{Metrics: tctx.GetMetrics(p.Zero, p.Clients)}, nil
+}
+
 func getNsAndMacs(ctx interface{}, params *fastjson.RawMessage) (*CNSCtx, []MACKey, error) {
 	tctx := ctx.(*CThreadCtx)
 	ns, err := tctx.GetNsRpc(params)
@@ -544,11 +1872,53 @@ func init() {
 	RegisterCB("ctx_get_info", ApiNsGetInfoHandler{}, false)
 	RegisterCB("ctx_set_def_plugins", ApiNsSetDefPlugHandler{}, false)
 	RegisterCB("ctx_get_def_plugins", ApiNsGetDefPlugHandler{}, false)
-	RegisterCB("ctx_cnt", ApiCntHandler{}, false) // get counters
+	RegisterCB("ctx_cnt", ApiCntHandler{}, false)         // get counters
+	RegisterCB("ctx_metrics", ApiMetricsHandler{}, false) // get all the counters in Prometheus format
+	RegisterCB("ctx_set_time_scale", ApiNsSetTimeScaleHandler{}, false)
+	RegisterCB("ctx_get_time_scale", ApiNsGetTimeScaleHandler{}, false)
+	RegisterCB("ctx_set_stealth", ApiNsSetStealthHandler{}, false)
+	RegisterCB("ctx_set_ts_source", ApiNsSetTsSourceHandler{}, false)
+	RegisterCB("ctx_set_reflect_rewrite", ApiNsSetReflectRewriteHandler{}, false)
+	RegisterCB("ctx_get_addr_owners", ApiNsAddrOwnersHandler{}, false)
+	RegisterCB("ctx_addr_owner", ApiNsAddrOwnerHandler{}, false)
+	RegisterCB("ctx_addr_owner_cnt", ApiNsAddrOwnerCntHandler{}, false)
+	RegisterCB("ctx_client_restart", ApiNsClientRestartHandler{}, false)
+	RegisterCB("ctx_client_restart_status", ApiNsClientRestartStatusHandler{}, false)
+	RegisterCB("ctx_get_state", ApiNsGetStateHandler{}, false)
+	RegisterCB("ctx_client_stuck", ApiNsClientStuckHandler{}, false)
+	RegisterCB("ctx_client_stuck_reset", ApiNsClientStuckResetHandler{}, false)
+	RegisterCB("ctx_rx_history", ApiRxHistoryHandler{}, false)
+	RegisterCB("ctx_set_cs_verify", ApiCsVerifyHandler{}, false)
+	RegisterCB("ctx_get_cs_errors", ApiCsErrorsHandler{}, false)
+	RegisterCB("ctx_set_rx_fcs", ApiNsSetRxFcsHandler{}, false)
+	RegisterCB("ctx_set_capture_limits", ApiSetCaptureLimitsHandler{}, false)
+	RegisterCB("ctx_get_captures", ApiGetCapturesHandler{}, false)
+	RegisterCB("ctx_timeline_start", ApiTimelineStartHandler{}, false)
+	RegisterCB("ctx_timeline_get", ApiTimelineGetHandler{}, false)
+	RegisterCB("ctx_timeline_cancel", ApiTimelineCancelHandler{}, false)
+	RegisterCB("ctx_get_fcs_errors", ApiNsFcsErrorsHandler{}, false)
+	RegisterCB("ctx_get_ipv6_scope", ApiNsGetIpv6ScopeHandler{}, false)
+	RegisterCB("ctx_frame_diff", ApiFrameDiffHandler{}, false)
 
 	RegisterCB("ctx_client_add", ApiClientAddHandler{}, false)
 	RegisterCB("ctx_client_remove", ApiClientRemoveHandler{}, false)
 	RegisterCB("ctx_client_get_info", ApiClientGetInfoHandler{}, false)
+	RegisterCB("ctx_client_get_gw", ApiClientGetGwHandler{}, false)
+	RegisterCB("ctx_client_set_routes", ApiClientSetRoutesHandler{}, false)
+	RegisterCB("ctx_client_get_routes", ApiClientGetRoutesHandler{}, false)
+	RegisterCB("ctx_client_set_dg", ApiClientSetDgHandler{}, false)
+	RegisterCB("ctx_client_link_up", ApiClientLinkUpHandler{}, false)
+	RegisterCB("ctx_client_set_vlan_policy", ApiClientSetVlanPolicyHandler{}, false)
+	RegisterCB("ctx_client_get_vlan_policy", ApiClientGetVlanPolicyHandler{}, false)
+	RegisterCB("ctx_client_blackhole", ApiClientBlackholeHandler{}, false)
+	RegisterCB("ctx_client_set_nat64", ApiClientSetNat64Handler{}, false)
+	RegisterCB("ctx_client_get_nat64", ApiClientGetNat64Handler{}, false)
+	RegisterCB("ctx_client_set_dns", ApiClientSetDnsHandler{}, false)
+	RegisterCB("ctx_client_get_dns", ApiClientGetDnsHandler{}, false)
+	RegisterCB("ctx_client_set_encap", ApiClientSetEncapHandler{}, false)
+	RegisterCB("ctx_client_get_encap", ApiClientGetEncapHandler{}, false)
+	RegisterCB("ctx_client_set_ipv6_scope", ApiClientSetIpv6ScopeHandler{}, false)
+	RegisterCB("ctx_client_dns64", ApiClientDns64Handler{}, false) // A records synthesized into AAAA
 	RegisterCB("ctx_client_set_def_plugins", ApiClientSetDefPlugHandler{}, false)
 	RegisterCB("ctx_client_get_def_plugins", ApiClientGetDefPlugHandler{}, false)
 	RegisterCB("ctx_client_iter", ApiClientIterHandler{}, false)
@@ -0,0 +1,138 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"external/osamingo/jsonrpc"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/intel-go/fastjson"
+)
+
+type myRpcPingHandler struct{}
+
+func (h myRpcPingHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	return "pong", nil
+}
+
+func TestRpcTokenAuth1(t *testing.T) {
+	var stats CRpcStats
+	mr := jsonrpc.NewMethodRepository()
+	mr.RegisterMethod("ping", myRpcPingHandler{}, true)
+
+	req := `{"jsonrpc": "2.0", "id": 1, "method": "ping", "params": {"auth_token": "secret"}}`
+	if r := string(mr.ServeBytes([]byte(req))); !strings.Contains(r, "pong") {
+		t.Fatalf(" no authentication by default, got %s \n", r)
+	}
+
+	mr.SetAuthenticator(&CRpcAuthCounter{auth: NewRpcTokenAuth("secret"), stats: &stats})
+	if r := string(mr.ServeBytes([]byte(req))); !strings.Contains(r, "pong") {
+		t.Fatalf(" valid token was rejected, got %s \n", r)
+	}
+	for _, bad := range []string{
+		`{"jsonrpc": "2.0", "id": 2, "method": "ping", "params": {"auth_token": "wrong"}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "ping", "params": {}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "ping"}`,
+	} {
+		r := string(mr.ServeBytes([]byte(bad)))
+		if strings.Contains(r, "pong") || !strings.Contains(r, "-32001") || !strings.Contains(r, "auth_token") {
+			t.Fatalf(" request should be rejected %s, got %s \n", bad, r)
+		}
+	}
+	if stats.authenticated != 1 || stats.rejected != 3 {
+		t.Fatalf(" bad stats %+v \n", stats)
+	}
+}
+
+func TestRpcLimit1(t *testing.T) {
+	var stats CRpcStats
+	mr := jsonrpc.NewMethodRepository()
+	mr.RegisterMethod("ping", myRpcPingHandler{}, true)
+
+	now := time.Unix(1000, 0)
+	l := NewRpcLimiter(10, 2, &stats)
+	l.now = func() time.Time { return now }
+	mr.SetLimiter(l)
+
+	req := []byte(`{"jsonrpc": "2.0", "id": 1, "method": "ping"}`)
+	ping := func() bool {
+		r := string(mr.ServeBytes(req))
+		if !strings.Contains(r, "pong") && !strings.Contains(r, "-32002") {
+			t.Fatalf(" unexpected response %s \n", r)
+		}
+		return strings.Contains(r, "pong")
+	}
+	if !ping() || !ping() || ping() {
+		t.Fatalf(" burst of 2 was expected \n")
+	}
+	now = now.Add(100 * time.Millisecond) // one token
+	if !ping() || ping() {
+		t.Fatalf(" one token was expected \n")
+	}
+	now = now.Add(10 * time.Second) // capped by the burst
+	if !ping() || !ping() || ping() {
+		t.Fatalf(" burst of 2 was expected after idle \n")
+	}
+	if stats.rateLimited != 3 {
+		t.Fatalf(" bad stats %+v \n", stats)
+	}
+
+	r := string(jsonrpc.ServeBytesError([]byte(`[{"jsonrpc": "2.0", "id": 7, "method": "ping"}]`), jsonrpc.ErrBusy()))
+	if !strings.Contains(r, "-32002") || !strings.Contains(r, `"id":7`) || !strings.HasPrefix(r, "[") {
+		t.Fatalf(" bad busy response %s \n", r)
+	}
+}
+
+func TestRpcLimitAuth1(t *testing.T) {
+	var stats CRpcStats
+	mr := jsonrpc.NewMethodRepository()
+	mr.RegisterMethod("ping", myRpcPingHandler{}, true)
+
+	now := time.Unix(1000, 0)
+	l := NewRpcLimiter(1, 1, &stats)
+	l.now = func() time.Time { return now }
+	mr.SetLimiter(l)
+	mr.SetAuthenticator(&CRpcAuthCounter{auth: NewRpcTokenAuth("secret"), stats: &stats})
+
+	// the rejected requests do not take the token of the client
+	bad := []byte(`{"jsonrpc": "2.0", "id": 1, "method": "ping", "params": {"auth_token": "wrong"}}`)
+	for i := 0; i < 3; i++ {
+		if r := string(mr.ServeBytes(bad)); !strings.Contains(r, "-32001") {
+			t.Fatalf(" request should be unauthorized, got %s \n", r)
+		}
+	}
+	req := []byte(`{"jsonrpc": "2.0", "id": 2, "method": "ping", "params": {"auth_token": "secret"}}`)
+	if r := string(mr.ServeBytes(req)); !strings.Contains(r, "pong") {
+		t.Fatalf(" authenticated request should be served, got %s \n", r)
+	}
+	if stats.rejected != 3 || stats.rateLimited != 0 {
+		t.Fatalf(" bad stats %+v \n", stats)
+	}
+}
+
+func TestRpcQueue1(t *testing.T) {
+	var o CZmqJsonRPC2
+	o.cn = make(chan cRpcReq, 2)
+
+	if !o.enqueue(cRpcReq{id: []byte{1}}) || !o.enqueue(cRpcReq{id: []byte{2}}) {
+		t.Fatalf(" queue of 2 was expected \n")
+	}
+	if o.enqueue(cRpcReq{id: []byte{3}}) {
+		t.Fatalf(" full queue should be busy \n")
+	}
+	o.stats.PreUpdate()
+	if o.stats.queueDepth != 2 || o.stats.busy != 1 {
+		t.Fatalf(" bad stats %+v \n", o.stats)
+	}
+	if r := <-o.GetC(); r.id[0] != 1 {
+		t.Fatalf(" requests should be taken in order \n")
+	}
+	if !o.enqueue(cRpcReq{id: []byte{4}}) {
+		t.Fatalf(" queue should take a request again \n")
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import "fmt"
+
+const (
+	SEQRX_DEFAULT_WINDOW = 64
+	SEQRX_MAX_WINDOW     = 4096
+)
+
+// CSeqRxStats are the counters of a receiver of a flow with an embedded sequence number.
+type CSeqRxStats struct {
+	rxPkts     uint64 // packets with a sequence number
+	inOrder    uint64 // sequence number bigger than all the previous
+	reordered  uint64 // older than the highest, within the window and not seen before
+	duplicated uint64 // seen before, within the window
+	late       uint64 // older than the window, can't tell reordering from a restart of the sender
+	gaps       uint64 // jumps forward of the highest sequence number
+}
+
+// NewSeqRxStatsDb creates a database of the reorder stats
+func NewSeqRxStatsDb(name string, o *CSeqRxStats) *CCounterDb {
+	db := NewCCounterDb(name)
+	db.Add(&CCounterRec{
+		Counter:  &o.rxPkts,
+		Name:     "rxPkts",
+		Help:     "packets with a sequence number",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.inOrder,
+		Name:     "inOrder",
+		Help:     "packets in order",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScINFO})
+	db.Add(&CCounterRec{
+		Counter:  &o.reordered,
+		Name:     "reordered",
+		Help:     "packets received after a newer one",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+	db.Add(&CCounterRec{
+		Counter:  &o.duplicated,
+		Name:     "duplicated",
+		Help:     "packets received more than once",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+	db.Add(&CCounterRec{
+		Counter:  &o.late,
+		Name:     "late",
+		Help:     "packets older than the reorder window",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     ScERROR})
+	db.Add(&CCounterRec{
+		Counter:  &o.gaps,
+		Name:     "gaps",
+		Help:     "jumps forward of the sequence number",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     ScINFO})
+	return db
+}
+
+// CSeqRxDistance the number of reordered packets up to a distance, see CSeqRx.GetDistances
+type CSeqRxDistance struct {
+	MaxDistance uint32 `json:"max_distance"`
+	Pkts        uint64 `json:"pkts"`
+}
+
+// CSeqRxInfo the reorder report of a flow, see CSeqRx.GetInfo
+type CSeqRxInfo struct {
+	Window     uint32           `json:"window"`
+	RxPkts     uint64           `json:"rx_pkts"`
+	InOrder    uint64           `json:"in_order"`
+	Reordered  uint64           `json:"reordered"`
+	Duplicated uint64           `json:"duplicated"`
+	Late       uint64           `json:"late"`
+	Gaps       uint64           `json:"gaps"`
+	Distances  []CSeqRxDistance `json:"distances"`
+}
+
+// CSeqRx tracks the sequence numbers of a received flow and detects reordering and duplication.
+// The reorder window is the distance from the highest sequence number that is considered as
+// reordering, an older packet is counted as late. The distance of the reordered packets is kept
+// in power of two buckets. The sequence number is 32 bit with wrap around, the window is a power of
+// two so the ring stays continuous over the wrap.
+type CSeqRx struct {
+	window  uint32
+	seen    []bool // ring of window entries, indexed by seq % window
+	max     uint32 // highest sequence number
+	started bool
+	dist    []uint64 // bucket i counts distances in (2^(i-1), 2^i]
+	stats   CSeqRxStats
+	Cdb     *CCounterDb
+}
+
+// NewSeqRx creates a tracker, zero window is the default. name is the name of the counters database.
+// The window should be a power of 2.
+func NewSeqRx(window uint32, name string) (*CSeqRx, error) {
+	if window == 0 {
+		window = SEQRX_DEFAULT_WINDOW
+	}
+	if window > SEQRX_MAX_WINDOW {
+		return nil, fmt.Errorf("reorder window %d is bigger than %d", window, SEQRX_MAX_WINDOW)
+	}
+	if window&(window-1) != 0 {
+		return nil, fmt.Errorf("reorder window %d is not a power of 2", window)
+	}
+	o := new(CSeqRx)
+	o.window = window
+	o.seen = make([]bool, window)
+	buckets := 1
+	for (uint32(1) << uint(buckets-1)) < window {
+		buckets++
+	}
+	o.dist = make([]uint64, buckets)
+	o.Cdb = NewSeqRxStatsDb(name, &o.stats)
+	return o, nil
+}
+
+func (o *CSeqRx) addDistance(d uint32) {
+	i := 0
+	for (uint32(1) << uint(i)) < d {
+		i++
+	}
+	o.dist[i]++
+}
+
+// OnRx accounts a received sequence number
+func (o *CSeqRx) OnRx(seq uint32) {
+	o.stats.rxPkts++
+	if !o.started {
+		o.started = true
+		o.max = seq
+		o.seen[seq%o.window] = true
+		o.stats.inOrder++
+		return
+	}
+	diff := int32(seq - o.max)
+	if diff > 0 {
+		if diff > 1 {
+			o.stats.gaps++
+		}
+		if uint32(diff) >= o.window {
+			for i := range o.seen {
+				o.seen[i] = false
+			}
+		} else {
+			for s := o.max + 1; s != seq; s++ {
+				o.seen[s%o.window] = false
+			}
+		}
+		o.max = seq
+		o.seen[seq%o.window] = true
+		o.stats.inOrder++
+		return
+	}
+	d := uint32(-diff)
+	if d >= o.window {
+		o.stats.late++
+		return
+	}
+	if o.seen[seq%o.window] {
+		o.stats.duplicated++
+		return
+	}
+	o.seen[seq%o.window] = true
+	o.stats.reordered++
+	o.addDistance(d)
+}
+
+// GetDistances returns the distribution of the reorder distance
+func (o *CSeqRx) GetDistances() []CSeqRxDistance {
+	res := make([]CSeqRxDistance, 0, len(o.dist))
+	for i, n := range o.dist {
+		max := uint32(1) << uint(i)
+		if max > o.window-1 {
+			max = o.window - 1
+		}
+		res = append(res, CSeqRxDistance{MaxDistance: max, Pkts: n})
+	}
+	return res
+}
+
+// GetInfo returns the counters and the distribution of the reorder distance
+func (o *CSeqRx) GetInfo() *CSeqRxInfo {
+	s := &o.stats
+	return &CSeqRxInfo{Window: o.window, RxPkts: s.rxPkts, InOrder: s.inOrder, Reordered: s.reordered,
+		Duplicated: s.duplicated, Late: s.late, Gaps: s.gaps, Distances: o.GetDistances()}
+}
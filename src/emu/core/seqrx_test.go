@@ -0,0 +1,37 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+)
+
+func TestSeqRx1(t *testing.T) {
+	if _, err := NewSeqRx(SEQRX_MAX_WINDOW+1, "seqrx"); err == nil {
+		t.Fatalf(" window should be limited \n")
+	}
+	if _, err := NewSeqRx(100, "seqrx"); err == nil {
+		t.Fatalf(" window should be a power of 2 \n")
+	}
+	o, _ := NewSeqRx(16, "seqrx")
+
+	// 0xfffffffe..2 wraps, 5 and 3 are reordered, 2 is a duplicate, 100 is a gap and 10 is late
+	for _, s := range []uint32{0xfffffffe, 0xffffffff, 0, 2, 1, 6, 5, 3, 2, 7, 100, 10, 99} {
+		o.OnRx(s)
+	}
+	s := o.stats
+	if s.rxPkts != 13 || s.inOrder != 7 || s.reordered != 4 || s.duplicated != 1 || s.late != 1 || s.gaps != 3 {
+		t.Fatalf(" bad stats %+v \n", s)
+	}
+	d := o.GetDistances()
+	if len(d) != 5 || d[4].MaxDistance != 15 {
+		t.Fatalf(" bad buckets %+v \n", d)
+	}
+	// distances 1 (1 after 2), 1 (5 after 6), 3 (3 after 6) and 1 (99 after 100)
+	if d[0].Pkts != 3 || d[1].Pkts != 0 || d[2].Pkts != 1 {
+		t.Fatalf(" bad distances %+v \n", d)
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"encoding/binary"
 	"encoding/hex"
+	"external/osamingo/jsonrpc"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -38,10 +39,11 @@ type CTunnelData struct {
 
 /* CTunnelDataJson json representation of tunnel data */
 type CTunnelDataJson struct {
-	Vport   uint16        `json:"vport"`
-	Tpid    [2]uint16     `json:"tpid"`
-	Tci     [2]uint16     `json:"tci"`
-	Plugins *MapJsonPlugs `json:"plugs"`
+	Vport     uint16        `json:"vport"`
+	Tpid      [2]uint16     `json:"tpid"`
+	Tci       [2]uint16     `json:"tci"`
+	Plugins   *MapJsonPlugs `json:"plugs"`
+	TimeScale uint32        `json:"time_scale,omitempty" validate:"lte=1000"` // scale the timers of a new namespace, see CNSCtx.SetTimeScale
 }
 
 type RpcCmdTunnel struct {
@@ -49,7 +51,7 @@ type RpcCmdTunnel struct {
 }
 
 type RpcCmdTunnels struct {
-	Tunnels []CTunnelDataJson `json:"tunnels" validate:"required"`
+	Tunnels []CTunnelDataJson `json:"tunnels" validate:"required,dive"`
 }
 
 type CTunnelKey [4 + 4 + 4]byte
@@ -204,6 +206,15 @@ type CThreadCtx struct {
 	cdbv        *CCounterDbVec
 	clientStats CClientStats
 	DefNsPlugs  *MapJsonPlugs // Default plugins for each new namespace
+	rxHistory   CRxHistory    // last received frames, see ctx_frame_diff
+	vlanClients int           // clients with a vlan policy, see txVlanPolicy
+	fcsNs       int           // namespaces with FCS on rx, see rxFcs
+	bhClients   int           // clients in blackhole, see txBlackhole
+	encapCnt    int           // clients with a tx or rx encapsulation, see txEncap
+	encapRx     []*CClient    // clients with an rx encapsulation, see rxEncap
+	scopeCnt    int           // clients with ipv6 scope filtering, see rxIpv6Scope
+	captures    CCaptureReg   // the captures in memory and their limits
+	timeline    CTimeline     // timed actions, see ctx_timeline_start
 }
 
 func NewThreadCtxProxy() *CThreadCtx {
@@ -234,6 +245,7 @@ func NewThreadCtx(Id uint32, serverPort uint16, simulation bool, simRx *VethIFSi
 	o.rpc.SetCtx(o) /* back pointer to interface this */
 	o.nsHead.SetSelf()
 	o.PluginCtx = NewPluginCtx(nil, nil, o, PLUGIN_LEVEL_THREAD)
+	o.captures.tctx = o
 	o.DefNsPlugs = nil
 	o.validate = validator.New()
 	o.parser.Init(o)
@@ -253,6 +265,8 @@ func NewThreadCtx(Id uint32, serverPort uint16, simulation bool, simRx *VethIFSi
 	o.cdbv.AddVec(o.MPool.Cdbv)
 	o.cdbv.Add(o.MPool.Cdb)
 	o.cdbv.Add(o.parser.Cdb)
+	o.cdbv.Add(o.parser.reass.Cdb)
+	o.cdbv.Add(o.rpc.Cdb)
 	o.cdbv.Add(o.timerctx.Cdb)
 	cdb := newThreadCtxStats(&o.stats)
 	cdb.IOpt = &o.stats
@@ -321,6 +335,19 @@ func (o *CThreadCtx) RegisterParserCb(protocol string) {
 }
 
 func (o *CThreadCtx) HandleRxPacket(m *Mbuf) {
+	if !o.rxFcs(m) {
+		m.FreeMbuf()
+		return
+	}
+	o.rxEncap(m)
+	o.rxVlanPolicy(m)
+	if !o.rxBlackhole(m) {
+		m.FreeMbuf()
+		return
+	}
+	if o.rxHistory.IsEnabled() {
+		o.rxHistory.Add(m, o.timerctx.Ticks, o.FrameTimestamp(m))
+	}
 	r := o.parser.ParsePacket(m)
 	if r < 0 {
 		if r == -1 {
@@ -507,6 +534,19 @@ func (o *CThreadCtx) UnmarshalTunnelsPlugins(data []byte) ([]*MapJsonPlugs, erro
 	return plugs, nil
 }
 
+func (o *CThreadCtx) UnmarshalTunnelsTimeScale(data []byte) ([]uint32, error) {
+	var tuns RpcCmdTunnels
+	err := o.UnmarshalValidate(data, &tuns)
+	if err != nil {
+		return nil, err
+	}
+	scales := make([]uint32, len(tuns.Tunnels))
+	for i, tun := range tuns.Tunnels {
+		scales[i] = tun.TimeScale
+	}
+	return scales, nil
+}
+
 func (o *CThreadCtx) RemoveNsRpc(params *fastjson.RawMessage) error {
 	var key CTunnelKey
 	err := o.UnmarshalTunnel(*params, &key)
@@ -575,6 +615,11 @@ func (o *CThreadCtx) AddNsRpcSlice(params *fastjson.RawMessage) error {
 		return err
 	}
 
+	scales, err := o.UnmarshalTunnelsTimeScale(*params)
+	if err != nil {
+		return err
+	}
+
 	for i, key := range keys {
 		ns := o.GetNs(&key)
 		if ns != nil {
@@ -583,8 +628,14 @@ func (o *CThreadCtx) AddNsRpcSlice(params *fastjson.RawMessage) error {
 		}
 
 		ns = NewNSCtx(o, &key)
+		if scales[i] > 1 {
+			if err = ns.SetTimeScale(scales[i]); err != nil {
+				return err
+			}
+		}
 		err := o.AddNs(&key, ns)
 		if err != nil {
+			ns.SetTimeScale(1) // releases the scaled timers
 			return err
 		}
 
@@ -819,3 +870,22 @@ func (o *CThreadCtx) GetCounterDbVec() *CCounterDbVec {
 func (o *CThreadCtx) SetVerbose(v bool) {
 	o.rpc.mr.Verbose = v
 }
+
+// SetRpcAuthenticator verifies each RPC request with a, nil disables the authentication
+func (o *CThreadCtx) SetRpcAuthenticator(a jsonrpc.Authenticator) {
+	o.rpc.SetAuthenticator(a)
+}
+
+// SetRpcAuthToken requires the shared token in each RPC request, empty disables the authentication
+func (o *CThreadCtx) SetRpcAuthToken(token string) {
+	if token == "" {
+		o.rpc.SetAuthenticator(nil)
+		return
+	}
+	o.rpc.SetAuthenticator(NewRpcTokenAuth(token))
+}
+
+// SetRpcLimit limits the RPC requests per second, see CZmqJsonRPC2.SetLimit
+func (o *CThreadCtx) SetRpcLimit(rate, burst uint32, queue uint32) {
+	o.rpc.SetLimit(rate, burst, queue)
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"external/osamingo/jsonrpc"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/intel-go/fastjson"
+)
+
+/* Timeline of timed actions
+
+A test that changes the configuration at given times (e.g. link down at 10 sec, a client removed at
+20 sec) can't rely on the timing of the RPC client. A timeline is a list of actions, each is an
+existing RPC method and its params with a time from the start of the timeline. The actions are
+executed by the timer wheel of the thread on its own clock, in the order of their time. A failed
+action does not stop the timeline. There is one timeline for each thread, a new timeline replaces
+the one in progress.
+*/
+
+const (
+	TIMELINE_ACTION_PENDING  = "pending"
+	TIMELINE_ACTION_OK       = "ok"
+	TIMELINE_ACTION_FAILED   = "failed"
+	TIMELINE_ACTION_CANCELED = "canceled"
+
+	timelineRpcPrefix = "ctx_timeline_" // an action can't change the timeline
+)
+
+// CTimelineAction an RPC method to call at a time from the start of the timeline
+type CTimelineAction struct {
+	AtMsec uint64               `json:"at_msec"`
+	Method string               `json:"method" validate:"required"`
+	Params *fastjson.RawMessage `json:"params"` // the params of the method without the api
+}
+
+// CTimelineActionInfo the state of an action, see TIMELINE_ACTION_PENDING
+type CTimelineActionInfo struct {
+	AtMsec uint64 `json:"at_msec"`
+	Method string `json:"method"`
+	State  string `json:"state"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CTimelineInfo the progress of the timeline, see ctx_timeline_get
+type CTimelineInfo struct {
+	Running   bool                  `json:"running"`
+	Canceled  bool                  `json:"canceled"`
+	Elapsed   uint64                `json:"elapsed_msec"` // from the start of the timeline
+	Next      uint32                `json:"next"`         // index of the next action
+	Total     uint32                `json:"total"`
+	Actions   []CTimelineActionInfo `json:"actions"`
+	Executed  uint64                `json:"executed"` // all the timelines of the thread
+	Failed    uint64                `json:"failed"`
+	Timelines uint64                `json:"timelines"`
+}
+
+// CTimeline the timeline of the thread
+type CTimeline struct {
+	tctx    *CThreadCtx
+	timer   CHTimerObj
+	actions []CTimelineAction
+	info    []CTimelineActionInfo
+	next    int
+	start   uint64 // ticks
+	running bool
+	cancel  bool
+
+	executed  uint64
+	failed    uint64
+	timelines uint64
+}
+
+func (o *CTimeline) elapsed() time.Duration {
+	return time.Duration(o.tctx.timerctx.Ticks-o.start) * o.tctx.timerctx.TickDuration
+}
+
+func (o *CTimeline) invoke(a *CTimelineAction) error {
+	h, jerr, _ := o.tctx.rpc.mr.TakeMethod(&jsonrpc.Request{Version: jsonrpc.Version, Method: a.Method})
+	if jerr != nil {
+		return jerr
+	}
+	params := a.Params
+	if params == nil {
+		empty := fastjson.RawMessage("{}")
+		params = &empty
+	}
+	if _, jerr = h.ServeJSONRPC(o.tctx, params); jerr != nil {
+		return jerr
+	}
+	return nil
+}
+
+// OnEvent executes the actions that are due and restarts the timer for the next one
+func (o *CTimeline) OnEvent(a, b interface{}) {
+	elapsed := o.elapsed()
+	for o.next < len(o.actions) {
+		act := &o.actions[o.next]
+		at := time.Duration(act.AtMsec) * time.Millisecond
+		if at > elapsed {
+			// round up, the action is not executed before its time
+			tick := o.tctx.timerctx.TickDuration
+			o.tctx.timerctx.StartTicks(&o.timer, uint32((at-elapsed+tick-1)/tick))
+			return
+		}
+		o.next++
+		if err := o.invoke(act); err != nil {
+			o.failed++
+			o.info[o.next-1].State = TIMELINE_ACTION_FAILED
+			o.info[o.next-1].Error = err.Error()
+		} else {
+			o.executed++
+			o.info[o.next-1].State = TIMELINE_ACTION_OK
+		}
+	}
+	o.running = false
+}
+
+// Start starts a timeline of actions, the timeline in progress is canceled
+func (o *CTimeline) Start(tctx *CThreadCtx, actions []CTimelineAction) error {
+	for i := range actions {
+		a := &actions[i]
+		if strings.HasPrefix(a.Method, timelineRpcPrefix) {
+			return fmt.Errorf("action %d method %s can't be a timeline method", i, a.Method)
+		}
+		if _, jerr, _ := tctx.rpc.mr.TakeMethod(&jsonrpc.Request{Version: jsonrpc.Version, Method: a.Method}); jerr != nil {
+			return fmt.Errorf("action %d method %s is not valid, %s", i, a.Method, jerr.Message)
+		}
+	}
+	o.Cancel()
+	o.tctx = tctx
+	o.timer.SetCB(o, nil, nil)
+	o.actions = append([]CTimelineAction{}, actions...)
+	sort.SliceStable(o.actions, func(i, j int) bool { return o.actions[i].AtMsec < o.actions[j].AtMsec })
+	o.info = make([]CTimelineActionInfo, len(o.actions))
+	for i, a := range o.actions {
+		o.info[i] = CTimelineActionInfo{AtMsec: a.AtMsec, Method: a.Method, State: TIMELINE_ACTION_PENDING}
+	}
+	o.next = 0
+	o.start = tctx.timerctx.Ticks
+	o.running = true
+	o.cancel = false
+	o.timelines++
+	o.OnEvent(nil, nil)
+	return nil
+}
+
+// Cancel stops the timeline in progress, the actions that were not executed are canceled
+func (o *CTimeline) Cancel() {
+	if !o.running {
+		return
+	}
+	if o.tctx.timerctx.IsRunning(&o.timer) {
+		o.tctx.timerctx.Stop(&o.timer)
+	}
+	for i := o.next; i < len(o.info); i++ {
+		o.info[i].State = TIMELINE_ACTION_CANCELED
+	}
+	o.running = false
+	o.cancel = true
+}
+
+// GetInfo returns the progress of the timeline
+func (o *CTimeline) GetInfo() *CTimelineInfo {
+	res := &CTimelineInfo{Running: o.running, Canceled: o.cancel, Next: uint32(o.next), Total: uint32(len(o.actions))}
+	res.Actions = append([]CTimelineActionInfo{}, o.info...)
+	if o.running {
+		res.Elapsed = uint64(o.elapsed() / time.Millisecond)
+	}
+	res.Executed = o.executed
+	res.Failed = o.failed
+	res.Timelines = o.timelines
+	return res
+}
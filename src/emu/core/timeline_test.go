@@ -0,0 +1,68 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/intel-go/fastjson"
+)
+
+func TestTimeline1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+
+	params := func(s string) *fastjson.RawMessage {
+		r := fastjson.RawMessage(s)
+		return &r
+	}
+	tick := func(n int) {
+		for i := 0; i < n; i++ {
+			tctx.timerctx.HandleTicks()
+		}
+	}
+
+	if tctx.timeline.Start(tctx, []CTimelineAction{{Method: "ctx_timeline_cancel"}}) == nil ||
+		tctx.timeline.Start(tctx, []CTimelineAction{{Method: "no_such_method"}}) == nil {
+		t.Fatalf(" invalid actions should be rejected \n")
+	}
+
+	actions := []CTimelineAction{
+		{AtMsec: 1000, Method: "ctx_set_capture_limits", Params: params(`{"max_captures": 3}`)},
+		{AtMsec: 55, Method: "ctx_set_capture_limits", Params: params(`{"policy": "drop"}`)},
+		{AtMsec: 0, Method: "ctx_set_capture_limits", Params: params(`{"max_captures": 1}`)},
+	}
+	if err := tctx.timeline.Start(tctx, actions); err != nil {
+		t.Fatalf(" timeline should start %v \n", err)
+	}
+	// the action at zero is executed on start
+	if tctx.captures.limits.MaxCaptures != 1 || tctx.timeline.executed != 1 {
+		t.Fatalf(" first action should be executed \n")
+	}
+	tick(5)
+	if tctx.timeline.failed != 0 {
+		t.Fatalf(" action should not be executed before its time \n")
+	}
+	tick(2)
+	info := tctx.timeline.GetInfo()
+	if !info.Running || info.Next != 2 || info.Failed != 1 || info.Actions[1].State != TIMELINE_ACTION_FAILED {
+		t.Fatalf(" bad progress %+v \n", info)
+	}
+
+	tctx.timeline.Cancel()
+	tick(100)
+	info = tctx.timeline.GetInfo()
+	if info.Running || !info.Canceled || info.Actions[2].State != TIMELINE_ACTION_CANCELED || tctx.captures.limits.MaxCaptures != 1 {
+		t.Fatalf(" timeline should be canceled %+v \n", info)
+	}
+
+	tctx.timeline.Start(tctx, actions)
+	tick(110)
+	info = tctx.timeline.GetInfo()
+	if info.Running || info.Executed != 3 || info.Failed != 2 || info.Timelines != 2 || tctx.captures.limits.MaxCaptures != 3 {
+		t.Fatalf(" timeline should be done %+v \n", info)
+	}
+}
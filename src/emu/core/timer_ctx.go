@@ -27,6 +27,8 @@ type TimerCtx struct {
 	timerw       *CNATimerWheel
 	Ticks        uint64
 	Cdb          *CCounterDb
+	scale        uint32      // time scale of a scaled view, 1 for the thread timer
+	views        []*TimerCtx // scaled views of this timer, updated on each tick
 }
 
 // NewTimerCtx create a context
@@ -49,6 +51,7 @@ func NewTimerCtx(simulation bool) *TimerCtx {
 		panic("can't init timew")
 	}
 	o.timerw = timerw
+	o.scale = 1
 	o.Cdb = NewCCounterDb("timerw")
 	o.Cdb.Add(&CCounterRec{
 		Counter:  &o.timerw.totalEvents,
@@ -68,6 +71,36 @@ func NewTimerCtx(simulation bool) *TimerCtx {
 	return o
 }
 
+// NewScaled creates a view of the timer that runs scale times faster. The view shares the
+// timer wheel and the ticks, only the duration of its tick is longer, so a duration of
+// 10 sec takes 1 sec of real time with a scale of 10. Should be removed by RemoveScaled.
+func (o *TimerCtx) NewScaled(scale uint32) *TimerCtx {
+	v := new(TimerCtx)
+	v.Timer = o.Timer
+	v.TickDuration = o.TickDuration * time.Duration(scale)
+	v.timerw = o.timerw
+	v.Ticks = o.Ticks
+	v.Cdb = o.Cdb
+	v.scale = scale
+	o.views = append(o.views, v)
+	return v
+}
+
+// RemoveScaled stops updating the ticks of a view created by NewScaled
+func (o *TimerCtx) RemoveScaled(v *TimerCtx) {
+	for i, view := range o.views {
+		if view == v {
+			o.views = append(o.views[:i], o.views[i+1:]...)
+			return
+		}
+	}
+}
+
+// Scale returns the time scale of the timer, 1 for real time
+func (o *TimerCtx) Scale() uint32 {
+	return o.scale
+}
+
 func (o *TimerCtx) ActiveTimers() uint64 {
 	return o.timerw.ActiveTimers()
 }
@@ -110,6 +143,9 @@ func (o *TimerCtx) Start(tmr *CHTimerObj, duration time.Duration) {
 // HandleTicks should be called only by main loop
 func (o *TimerCtx) HandleTicks() {
 	o.Ticks++
+	for _, v := range o.views {
+		v.Ticks = o.Ticks
+	}
 	o.timerw.OnTick(eTIMERW_SECOND_LEVEL_BURST)
 	o.Timer.Reset(o.TickDuration)
 }
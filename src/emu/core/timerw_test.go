@@ -8,6 +8,7 @@ package core
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 /*var i, numEvent uint32
@@ -135,3 +136,45 @@ func TestTimerw2(t *testing.T) {
 		t.Fatalf(" expected ticks %d is not %d ", globalStats.ticks, expectedTicks)
 	}
 }
+
+type myScaledEventTest struct {
+	CHTimerObj
+	ticks uint64
+	timer *TimerCtx
+}
+
+func (o *myScaledEventTest) OnEvent(a, b interface{}) {
+	o.ticks = o.timer.Ticks
+}
+
+func TestTimerCtxScaled(t *testing.T) {
+	timerctx := NewTimerCtx(true)
+	scaled := timerctx.NewScaled(10)
+	if scaled.Scale() != 10 || timerctx.Scale() != 1 {
+		t.Fatalf(" bad scale %d %d ", scaled.Scale(), timerctx.Scale())
+	}
+
+	var e1, e2 myScaledEventTest
+	e1.timer = timerctx
+	e1.SetCB(&e1, nil, nil)
+	e2.timer = scaled
+	e2.SetCB(&e2, nil, nil)
+	timerctx.Start(&e1.CHTimerObj, 10*time.Second)
+	scaled.Start(&e2.CHTimerObj, 10*time.Second)
+
+	for i := 0; i < 200; i++ {
+		timerctx.HandleTicks()
+	}
+	// the event is called on the tick after the duration
+	if e1.ticks != 101 || e2.ticks != 11 {
+		t.Fatalf(" expected events at ticks 101/11 got %d/%d ", e1.ticks, e2.ticks)
+	}
+	if scaled.Ticks != timerctx.Ticks {
+		t.Fatalf(" scaled ticks %d are not synced with %d ", scaled.Ticks, timerctx.Ticks)
+	}
+	timerctx.RemoveScaled(scaled)
+	timerctx.HandleTicks()
+	if len(timerctx.views) != 0 || scaled.Ticks == timerctx.Ticks {
+		t.Fatalf(" scaled view was not removed ")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"encoding/binary"
+	"external/google/gopacket/layers"
+	"fmt"
+	"time"
+)
+
+// The timestamp source of the captures, the received frames history and the event logs of a
+// namespace.
+//
+// mono is the time of the thread timer since the start of the emulator. It never goes backwards
+// and it is not affected by the clock of the host, so intervals between timestamps are right, but
+// it can't be correlated with the logs of other systems.
+//
+// realtime is the wall clock of the host (CLOCK_REALTIME) in seconds since the epoch. It can be
+// correlated with the logs of the DUT in case both clocks are synchronized, but it can jump and even
+// go backwards when the clock is set or stepped by NTP, so an interval between two timestamps
+// can be wrong or negative. It is not related to the simulation time of the unit tests.
+const (
+	TS_SOURCE_MONO     = 0 // default
+	TS_SOURCE_REALTIME = 1
+)
+
+// ParseTsSource converts "mono" or "realtime" to TS_SOURCE_xx, empty is mono
+func ParseTsSource(s string) (uint8, error) {
+	switch s {
+	case "", "mono":
+		return TS_SOURCE_MONO, nil
+	case "realtime":
+		return TS_SOURCE_REALTIME, nil
+	}
+	return TS_SOURCE_MONO, fmt.Errorf("invalid timestamp source %q, should be mono or realtime", s)
+}
+
+// TsSourceString converts TS_SOURCE_xx to its name
+func TsSourceString(src uint8) string {
+	if src == TS_SOURCE_REALTIME {
+		return "realtime"
+	}
+	return "mono"
+}
+
+// SetTsSource sets the timestamp source of the namespace, see TS_SOURCE_MONO
+func (o *CNSCtx) SetTsSource(src uint8) {
+	o.tsSource = src
+}
+
+// GetTsSource returns the timestamp source of the namespace
+func (o *CNSCtx) GetTsSource() uint8 {
+	return o.tsSource
+}
+
+// Timestamp returns the current time in seconds by the timestamp source of the namespace. The
+// plugins should use it for the time of the events they log.
+func (o *CNSCtx) Timestamp() float64 {
+	if o.tsSource == TS_SOURCE_REALTIME {
+		return float64(time.Now().UnixNano()) / 1e9
+	}
+	return o.ThreadCtx.GetTickSimInSec()
+}
+
+// frameTunnelKey sets the key of the namespace of a frame from its port and vlan tags
+func frameTunnelKey(m *Mbuf, key *CTunnelKey) {
+	var d CTunnelData
+	d.Vport = m.VPort()
+	p := m.GetData()
+	off := 12
+	for i := 0; i < 2 && len(p) >= off+6; i++ {
+		t := layers.EthernetType(binary.BigEndian.Uint16(p[off : off+2]))
+		if t != layers.EthernetTypeDot1Q && t != layers.EthernetTypeQinQ {
+			break
+		}
+		d.Vlans[i] = binary.BigEndian.Uint32(p[off:off+4]) & 0xffff0fff
+		off += 4
+	}
+	key.Set(&d)
+}
+
+// FrameTimestamp returns the timestamp of a captured frame by the timestamp source of its namespace,
+// the thread time in case the frame does not belong to a namespace
+func (o *CThreadCtx) FrameTimestamp(m *Mbuf) float64 {
+	var key CTunnelKey
+	frameTunnelKey(m, &key)
+	if ns := o.GetNs(&key); ns != nil {
+		return ns.Timestamp()
+	}
+	return o.GetTickSimInSec()
+}
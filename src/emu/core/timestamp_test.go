@@ -0,0 +1,53 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTsSource1(t *testing.T) {
+	for _, s := range []string{"", "mono", "realtime"} {
+		if _, err := ParseTsSource(s); err != nil {
+			t.Fatalf(" %q should be valid \n", s)
+		}
+	}
+	if _, err := ParseTsSource("utc"); err == nil {
+		t.Fatalf(" utc should be invalid \n")
+	}
+
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000007, 0}})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+
+	if ns.GetTsSource() != TS_SOURCE_MONO || ns.Timestamp() != tctx.GetTickSimInSec() {
+		t.Fatalf(" mono should be the default \n")
+	}
+
+	// a frame of the namespace, vlan 7
+	f := []byte{0, 0, 2, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0x81, 0, 0, 7, 0x08, 0x06}
+	m := tctx.MPool.Alloc(uint16(len(f)))
+	m.SetVPort(1)
+	m.Append(f)
+	defer m.FreeMbuf()
+
+	ns.SetTsSource(TS_SOURCE_REALTIME)
+	now := float64(time.Now().UnixNano()) / 1e9
+	ts := tctx.FrameTimestamp(m)
+	if ts < now-1 || ts > now+1 || ns.GetInfo().TsSource != "realtime" {
+		t.Fatalf(" frame timestamp %v should be realtime %v \n", ts, now)
+	}
+
+	// other vlan, not a frame of the namespace
+	m.GetData()[15] = 8
+	if tctx.FrameTimestamp(m) != tctx.GetTickSimInSec() {
+		t.Fatalf(" frame without namespace should use the thread time \n")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// IPluginTransaction is implemented by client plugins with transactions that could get stuck at
+// scale, e.g. a DHCP client that retransmits to a server that does not answer
+type IPluginTransaction interface {
+	// GetTransaction returns the transaction in progress, false in case there is none (e.g. bound)
+	GetTransaction() (CTransaction, bool)
+	// ResetTransaction stops the transaction and starts the protocol over from a clean state
+	ResetTransaction()
+}
+
+// CTransaction a transaction in progress of a client plugin
+type CTransaction struct {
+	State       string `json:"state"`
+	Start       uint64 `json:"-"` // ticks of the first packet
+	AgeMsec     uint64 `json:"age_msec"`
+	Retransmits uint32 `json:"retransmits"`
+}
+
+// CStuckTransaction a transaction of a client that exceeds the limits of ctx_client_stuck
+type CStuckTransaction struct {
+	Mac    MACKey `json:"mac"`
+	Plugin string `json:"plugin"`
+	CTransaction
+}
+
+// CStuckFilter the limits of a stuck transaction, it is stuck in case it exceeds one of the limits
+// that are not zero
+type CStuckFilter struct {
+	AgeMsec     uint64 `json:"age_msec"`
+	Retransmits uint32 `json:"retransmits"`
+	Plugin      string `json:"plugin"` // all the plugins in case it is empty
+}
+
+func (o *CStuckFilter) Validate() error {
+	if o.AgeMsec == 0 && o.Retransmits == 0 {
+		return fmt.Errorf("age_msec or retransmits should be set")
+	}
+	return nil
+}
+
+func (o *CStuckFilter) isStuck(t *CTransaction) bool {
+	if o.AgeMsec > 0 && t.AgeMsec >= o.AgeMsec {
+		return true
+	}
+	return o.Retransmits > 0 && t.Retransmits >= o.Retransmits
+}
+
+// clientStuckTransactions appends the stuck transactions of the plugins of the client, reset
+// resets them
+func (o *CNSCtx) clientStuckTransactions(c *CClient, f *CStuckFilter, reset bool, r []CStuckTransaction) []CStuckTransaction {
+	timerw := o.GetTimerCtx()
+	names := c.PluginCtx.GetAllPlugNames()
+	sort.Strings(names)
+	for _, name := range names {
+		if f.Plugin != "" && f.Plugin != name {
+			continue
+		}
+		plug := c.PluginCtx.Get(name)
+		if plug == nil {
+			continue
+		}
+		pt, ok := plug.Ext.(IPluginTransaction)
+		if !ok {
+			continue
+		}
+		t, ok := pt.GetTransaction()
+		if !ok {
+			continue
+		}
+		t.AgeMsec = uint64(time.Duration(timerw.Ticks-t.Start) * timerw.TickDuration / time.Millisecond)
+		if !f.isStuck(&t) {
+			continue
+		}
+		o.stats.stuckFound++
+		if reset {
+			pt.ResetTransaction()
+			o.stats.stuckCleared++
+		}
+		r = append(r, CStuckTransaction{Mac: c.Mac, Plugin: name, CTransaction: t})
+	}
+	return r
+}
+
+// FindStuckTransactions returns the transactions of the clients that exceed the limits of the filter
+func (o *CNSCtx) FindStuckTransactions(f *CStuckFilter) []CStuckTransaction {
+	r := make([]CStuckTransaction, 0)
+	var it DListIterHead
+	it.Init(&o.clientHead)
+	for ; it.IsCont(); it.Next() {
+		r = o.clientStuckTransactions(castDlistClient(it.Val()), f, false, r)
+	}
+	return r
+}
+
+// ResetStuckTransactions resets the transactions that exceed the limits of the filter, of the
+// clients with the macs or of all the clients in case macs is empty, and returns them
+func (o *CNSCtx) ResetStuckTransactions(f *CStuckFilter, macs []MACKey) []CStuckTransaction {
+	r := make([]CStuckTransaction, 0)
+	if len(macs) == 0 {
+		var it DListIterHead
+		it.Init(&o.clientHead)
+		for ; it.IsCont(); it.Next() {
+			macs = append(macs, castDlistClient(it.Val()).Mac)
+		}
+	}
+	// the plugins could change the clients, lookup each one after the previous reset
+	for i := range macs {
+		if c := o.CLookupByMac(&macs[i]); c != nil {
+			r = o.clientStuckTransactions(c, f, true, r)
+		}
+	}
+	return r
+}
@@ -172,6 +172,12 @@ func (o *VethIFSimulator) AppendSimuationRPC(request []byte) {
 
 func (o *VethIFSimulator) Send(m *Mbuf) {
 
+	if !o.tctx.txBlackhole(m) {
+		m.FreeMbuf()
+		return
+	}
+	o.tctx.txVlanPolicy(m)
+	o.tctx.txEncap(m)
 	o.stats.TxPkts++
 	o.stats.TxBytes += uint64(m.PktLen())
 	if !m.IsContiguous() {
@@ -214,10 +220,10 @@ func (o *VethIFSimulator) OnRx(m *Mbuf) {
 	o.stats.RxBytes += uint64(m.PktLen())
 	if o.K12Monitor {
 		fmt.Printf("\n ->RX<- \n")
-		m.DumpK12(o.tctx.GetTickSimInSec())
+		m.DumpK12(o.tctx.FrameTimestamp(m))
 	}
 	if o.Record {
-		o.tctx.SimRecordAppend(m.GetRecord(o.tctx.GetTickSimInSec(), "rx"))
+		o.tctx.SimRecordAppend(m.GetRecord(o.tctx.FrameTimestamp(m), "rx"))
 	}
 
 	o.tctx.HandleRxPacket(m)
@@ -262,10 +268,10 @@ func (o *VethIFSimulator) SimulatorCheckRxQueue() {
 	o.handleRpcQueue()
 	for _, m := range o.vec {
 		if o.K12Monitor {
-			m.DumpK12(o.tctx.GetTickSimInSec())
+			m.DumpK12(o.tctx.FrameTimestamp(m))
 		}
 		if o.Record {
-			o.tctx.SimRecordAppend(m.GetRecord(o.tctx.GetTickSimInSec(), "tx"))
+			o.tctx.SimRecordAppend(m.GetRecord(o.tctx.FrameTimestamp(m), "tx"))
 		}
 
 		mrx := o.Sim.ProcessTxToRx(m)
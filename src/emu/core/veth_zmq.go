@@ -159,7 +159,7 @@ func (o *VethIFZmq) FlushTx() {
 			panic(" mbuf should be contiguous  ")
 		}
 		if o.K12Monitor {
-			m.DumpK12(o.tctx.GetTickSimInSec())
+			m.DumpK12(o.tctx.FrameTimestamp(m))
 		}
 		var pktHeader uint32
 		pktHeader = (uint32(0xAA) << 24) + uint32((m.VPort()&0xff))<<16 + uint32(m.pktLen&0xffff)
@@ -175,6 +175,12 @@ func (o *VethIFZmq) FlushTx() {
 
 func (o *VethIFZmq) Send(m *Mbuf) {
 
+	if !o.tctx.txBlackhole(m) {
+		m.FreeMbuf()
+		return
+	}
+	o.tctx.txVlanPolicy(m)
+	o.tctx.txEncap(m)
 	pktlen := m.PktLen()
 	o.stats.TxPkts++
 	o.stats.TxBytes += uint64(pktlen)
@@ -227,7 +233,7 @@ func (o *VethIFZmq) OnRx(m *Mbuf) {
 	o.stats.RxBytes += uint64(m.PktLen())
 	if o.K12Monitor {
 		fmt.Printf("\n ->RX<- \n")
-		m.DumpK12(o.tctx.GetTickSimInSec())
+		m.DumpK12(o.tctx.FrameTimestamp(m))
 	}
 	if o.proxyMode {
 		o.cb.HandleRxPacket(m)
@@ -0,0 +1,290 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"encoding/binary"
+	"external/google/gopacket/layers"
+	"fmt"
+	"sort"
+)
+
+/* Per destination vlan policy of a client
+
+The frames of the client toward a destination that matches a rule (longest prefix first) are sent
+with the vlan tag of the rule, pushed as the innermost tag after the tags of the namespace. The other
+frames are sent untagged (default). The destination is the destination ip of IPv4/IPv6 and the target
+ip of ARP, the other frames are untagged.
+
+The tag is popped from a received frame with the tags of the namespace and the tag of a rule, so the
+replies get to the namespace. A namespace with 2 tags can't have a vlan policy, there is no room for a
+third tag in the tunnel key.
+*/
+
+const VLAN_POLICY_DEF_TPID = 0x8100
+
+// CClientVlanRuleCmd the frames toward the prefix are tagged with the vlan. A zero prefix length
+// without a prefix matches all the destinations.
+type CClientVlanRuleCmd struct {
+	Ipv4      Ipv4Key `json:"ipv4"` // prefix
+	Ipv6      Ipv6Key `json:"ipv6"` // prefix
+	PrefixLen uint8   `json:"prefix_len"`
+	Vlan      uint16  `json:"vlan" validate:"required,gte=1,lte=4094"`
+	Pcp       uint8   `json:"pcp" validate:"lte=7"`
+	Tpid      uint16  `json:"tpid"` // zero is 0x8100
+}
+
+// CClientVlanRuleInfo a rule and the frames it tagged, see ctx_client_get_vlan_policy
+type CClientVlanRuleInfo struct {
+	CClientVlanRuleCmd
+	Pkts uint64 `json:"pkts"`
+}
+
+// CClientVlanPolicyInfo the vlan policy of a client
+type CClientVlanPolicyInfo struct {
+	Mac      MACKey                `json:"mac"`
+	Rules    []CClientVlanRuleInfo `json:"rules"`
+	Untagged uint64                `json:"untagged"` // frames that did not match any rule
+}
+
+type clientVlanRule struct {
+	cmd    CClientVlanRuleCmd
+	isIpv6 bool
+	any    bool // matches all the destinations
+	tag    uint32
+	pkts   uint64
+}
+
+func (o *clientVlanRule) match(dst []byte) bool {
+	if o.any {
+		return true
+	}
+	if o.isIpv6 {
+		return len(dst) == 16 && matchPrefix(dst, o.cmd.Ipv6[:], o.cmd.PrefixLen)
+	}
+	return len(dst) == 4 && matchPrefix(dst, o.cmd.Ipv4[:], o.cmd.PrefixLen)
+}
+
+// CClientVlanPolicy the per destination vlan policy of a client
+type CClientVlanPolicy struct {
+	rules    []*clientVlanRule // longest prefix first
+	untagged uint64
+}
+
+func newClientVlanRule(cmd *CClientVlanRuleCmd) (*clientVlanRule, error) {
+	o := &clientVlanRule{cmd: *cmd}
+	switch {
+	case !cmd.Ipv4.IsZero() && !cmd.Ipv6.IsZero():
+		return nil, fmt.Errorf("vlan rule can't have both ipv4 and ipv6 prefix")
+	case !cmd.Ipv6.IsZero():
+		if cmd.PrefixLen > 128 {
+			return nil, fmt.Errorf("invalid ipv6 prefix length %d", cmd.PrefixLen)
+		}
+		maskPrefix(o.cmd.Ipv6[:], cmd.PrefixLen)
+		o.isIpv6 = true
+	case !cmd.Ipv4.IsZero():
+		if cmd.PrefixLen > 32 {
+			return nil, fmt.Errorf("invalid ipv4 prefix length %d", cmd.PrefixLen)
+		}
+		maskPrefix(o.cmd.Ipv4[:], cmd.PrefixLen)
+	default:
+		if cmd.PrefixLen != 0 {
+			return nil, fmt.Errorf("vlan rule with prefix length %d should have a prefix", cmd.PrefixLen)
+		}
+		o.any = true
+	}
+	if cmd.Vlan == 0 || cmd.Vlan > 4094 || cmd.Pcp > 7 {
+		return nil, fmt.Errorf("invalid vlan %d pcp %d", cmd.Vlan, cmd.Pcp)
+	}
+	if o.cmd.Tpid == 0 {
+		o.cmd.Tpid = VLAN_POLICY_DEF_TPID
+	}
+	o.tag = uint32(o.cmd.Tpid)<<16 | uint32(cmd.Pcp)<<13 | uint32(cmd.Vlan)
+	return o, nil
+}
+
+// SetVlanPolicy replaces the per destination vlan policy of the client, an empty policy sends all
+// the frames untagged
+func (o *CClient) SetVlanPolicy(cmds []CClientVlanRuleCmd) error {
+	var p *CClientVlanPolicy
+	if len(cmds) > 0 {
+		p = new(CClientVlanPolicy)
+		for i := range cmds {
+			r, err := newClientVlanRule(&cmds[i])
+			if err != nil {
+				return err
+			}
+			for _, e := range p.rules {
+				if e.any == r.any && e.isIpv6 == r.isIpv6 && e.cmd.PrefixLen == r.cmd.PrefixLen &&
+					e.cmd.Ipv4 == r.cmd.Ipv4 && e.cmd.Ipv6 == r.cmd.Ipv6 {
+					return fmt.Errorf("duplicate vlan rule, prefix length %d", r.cmd.PrefixLen)
+				}
+			}
+			p.rules = append(p.rules, r)
+		}
+		sort.SliceStable(p.rules, func(i, j int) bool { return p.rules[i].cmd.PrefixLen > p.rules[j].cmd.PrefixLen })
+		if n, _ := nsTagsCnt(&o.Ns.Key); n == 2 {
+			return fmt.Errorf("namespace has 2 vlan tags, no room for the tag of the vlan policy")
+		}
+	}
+	tctx := o.Ns.ThreadCtx
+	if o.vlanPolicy != nil {
+		tctx.vlanClients--
+		o.Ns.refVlanTags(o.vlanPolicy, false)
+	}
+	if p != nil {
+		tctx.vlanClients++
+		o.Ns.refVlanTags(p, true)
+	}
+	o.vlanPolicy = p
+	o.initCmd.VlanPolicy = append([]CClientVlanRuleCmd(nil), cmds...)
+	return nil
+}
+
+// refVlanTags counts the tags of the rules of a policy of a client of the namespace, see rxVlanPolicy
+func (o *CNSCtx) refVlanTags(p *CClientVlanPolicy, add bool) {
+	if o.vlanTags == nil {
+		o.vlanTags = make(map[uint32]uint32)
+	}
+	for _, r := range p.rules {
+		tag := r.tag & 0xffff0fff
+		if add {
+			o.vlanTags[tag]++
+		} else if o.vlanTags[tag] <= 1 {
+			delete(o.vlanTags, tag)
+		} else {
+			o.vlanTags[tag]--
+		}
+	}
+}
+
+func (o *CClientVlanPolicy) hasTag(tag uint32) bool {
+	for _, r := range o.rules {
+		if r.tag&0xffff0fff == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// GetVlanPolicy returns the vlan policy of the client with the frames per rule
+func (o *CClient) GetVlanPolicy() *CClientVlanPolicyInfo {
+	res := &CClientVlanPolicyInfo{Mac: o.Mac, Rules: make([]CClientVlanRuleInfo, 0)}
+	if o.vlanPolicy == nil {
+		return res
+	}
+	for _, r := range o.vlanPolicy.rules {
+		res.Rules = append(res.Rules, CClientVlanRuleInfo{CClientVlanRuleCmd: r.cmd, Pkts: r.pkts})
+	}
+	res.Untagged = o.vlanPolicy.untagged
+	return res
+}
+
+// txVlanPolicy tags a frame by the vlan policy of the client that sends it, the client is looked up
+// by the source MAC only in case there is a client with a policy
+func (o *CThreadCtx) txVlanPolicy(m *Mbuf) {
+	if o.vlanClients == 0 {
+		return
+	}
+	p := m.GetData()
+	if len(p) < 14 {
+		return
+	}
+	var key CTunnelKey
+	frameTunnelKey(m, &key)
+	ns := o.GetNs(&key)
+	if ns == nil {
+		return
+	}
+	var mac MACKey
+	copy(mac[:], p[6:12])
+	c := ns.CLookupByMac(&mac)
+	if c == nil || c.vlanPolicy == nil {
+		return
+	}
+
+	off := uint16(12)
+	for off+4 <= uint16(len(p)) {
+		t := layers.EthernetType(binary.BigEndian.Uint16(p[off : off+2]))
+		if t != layers.EthernetTypeDot1Q && t != layers.EthernetTypeQinQ {
+			break
+		}
+		off += 4
+	}
+	if int(off)+2 > len(p) {
+		return
+	}
+	var dst []byte
+	l3 := int(off) + 2
+	switch layers.EthernetType(binary.BigEndian.Uint16(p[off : off+2])) {
+	case layers.EthernetTypeIPv4:
+		if len(p) >= l3+20 {
+			dst = p[l3+16 : l3+20]
+		}
+	case layers.EthernetTypeIPv6:
+		if len(p) >= l3+40 {
+			dst = p[l3+24 : l3+40]
+		}
+	case layers.EthernetTypeARP:
+		if len(p) >= l3+28 {
+			dst = p[l3+24 : l3+28]
+		}
+	}
+	if off >= 12+8 {
+		dst = nil // there is no room for a third tag
+	}
+
+	policy := c.vlanPolicy
+	if dst != nil {
+		for _, r := range policy.rules {
+			if r.match(dst) {
+				if m.PushVlan(off, r.tag) {
+					r.pkts++
+					ns.stats.txVlanTagged++
+					return
+				}
+				break
+			}
+		}
+	}
+	policy.untagged++
+	ns.stats.txVlanUntagged++
+}
+
+// rxVlanPolicy pops the tag of a frame that arrived with the tags of a namespace and the tag of a rule
+// of the vlan policy of its client, a broadcast or multicast frame in case a client has the rule
+func (o *CThreadCtx) rxVlanPolicy(m *Mbuf) {
+	if o.vlanClients == 0 || !m.IsContiguous() {
+		return
+	}
+	var key CTunnelKey
+	frameTunnelKey(m, &key)
+	if o.HasNs(&key) {
+		return
+	}
+	n, vlans := nsTagsCnt(&key)
+	if n == 0 {
+		return
+	}
+	tag := vlans[n-1]
+	vlans[n-1] = 0
+	key.Set(&CTunnelData{Vport: m.VPort(), Vlans: vlans})
+	ns := o.GetNs(&key)
+	if ns == nil || ns.vlanTags[tag] == 0 {
+		return
+	}
+	p := m.GetData()
+	if p[0]&1 == 0 {
+		var mac MACKey
+		copy(mac[:], p[0:6])
+		c := ns.CLookupByMac(&mac)
+		if c == nil || c.vlanPolicy == nil || !c.vlanPolicy.hasTag(tag) {
+			return
+		}
+	}
+	m.PopVlan(uint16(12 + 4*(n-1)))
+	ns.stats.rxVlanPopped++
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/intel-go/fastjson"
+)
+
+func TestClientVlanPolicy1(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000007, 0}})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	c := NewClient(ns, MACKey{0, 0, 1, 0, 0, 0}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 2})
+	ns.AddClient(c)
+
+	if c.SetVlanPolicy([]CClientVlanRuleCmd{{Vlan: 10}, {PrefixLen: 8, Vlan: 11}}) == nil {
+		t.Fatalf(" prefix length without prefix should fail \n")
+	}
+	err := c.SetVlanPolicy([]CClientVlanRuleCmd{
+		{Ipv4: Ipv4Key{48, 0, 0, 0}, PrefixLen: 8, Vlan: 10},
+		{Ipv4: Ipv4Key{48, 1, 0, 0}, PrefixLen: 16, Vlan: 11, Pcp: 5, Tpid: 0x88a8},
+	})
+	if err != nil || tctx.vlanClients != 1 {
+		t.Fatalf(" set vlan policy failed %v \n", err)
+	}
+
+	send := func(dst Ipv4Key) []byte {
+		// eth, vlan 7 of the namespace, ipv4 header
+		f := []byte{0, 0, 2, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0x81, 0, 0, 7, 0x08, 0x00}
+		ip := make([]byte, 20)
+		ip[0] = 0x45
+		copy(ip[16:], dst[:])
+		m := tctx.MPool.Alloc(128)
+		m.SetVPort(1)
+		m.Append(f)
+		m.Append(ip)
+		tctx.txVlanPolicy(m)
+		r := append([]byte(nil), m.GetData()...)
+		m.FreeMbuf()
+		return r
+	}
+
+	if p := send(Ipv4Key{48, 1, 2, 3}); !bytes.Equal(p[12:22], []byte{0x81, 0, 0, 7, 0x88, 0xa8, 0xa0, 11, 0x08, 0x00}) {
+		t.Fatalf(" bad tag for the longest prefix %x \n", p[:22])
+	}
+	if p := send(Ipv4Key{48, 2, 2, 3}); !bytes.Equal(p[12:22], []byte{0x81, 0, 0, 7, 0x81, 0, 0, 10, 0x08, 0x00}) {
+		t.Fatalf(" bad tag for the short prefix %x \n", p[:22])
+	}
+	if p := send(Ipv4Key{49, 0, 0, 1}); len(p) != 38 {
+		t.Fatalf(" frame should be untagged %x \n", p)
+	}
+
+	info := c.GetVlanPolicy()
+	if len(info.Rules) != 2 || info.Rules[0].Pkts != 1 || info.Rules[1].Pkts != 1 || info.Untagged != 1 {
+		t.Fatalf(" bad vlan policy info %+v \n", info)
+	}
+	if ns.stats.txVlanTagged != 2 || ns.stats.txVlanUntagged != 1 {
+		t.Fatalf(" bad counters %+v \n", ns.stats)
+	}
+
+	c.SetVlanPolicy(nil)
+	if tctx.vlanClients != 0 {
+		t.Fatalf(" vlan clients should be zero \n")
+	}
+	if p := send(Ipv4Key{48, 1, 2, 3}); len(p) != 38 {
+		t.Fatalf(" frame should be untagged without a policy %x \n", p)
+	}
+}
+
+func TestClientVlanPolicyRx(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000007, 0}})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	c := NewClient(ns, MACKey{0, 0, 1, 0, 0, 0}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 2})
+	ns.AddClient(c)
+	c.SetVlanPolicy([]CClientVlanRuleCmd{{Ipv4: Ipv4Key{48, 0, 0, 0}, PrefixLen: 8, Vlan: 10, Pcp: 3}})
+
+	rx := func(dst MACKey, vlan byte) []byte {
+		m := tctx.MPool.Alloc(128)
+		m.SetVPort(1)
+		m.Append(dst[:])
+		m.Append([]byte{0, 0, 2, 0, 0, 0, 0x81, 0, 0, 7, 0x81, 0, 0, vlan, 0x08, 0x06})
+		m.Append(make([]byte, 28))
+		tctx.rxVlanPolicy(m)
+		r := append([]byte(nil), m.GetData()...)
+		m.FreeMbuf()
+		return r
+	}
+	bcast := MACKey{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	if p := rx(c.Mac, 10); !bytes.Equal(p[12:18], []byte{0x81, 0, 0, 7, 0x08, 0x06}) {
+		t.Fatalf(" tag of the policy should be popped %x \n", p[:18])
+	}
+	if p := rx(bcast, 10); len(p) != 46 {
+		t.Fatalf(" tag of a broadcast should be popped %x \n", p[:18])
+	}
+	if p := rx(MACKey{0, 0, 1, 0, 0, 9}, 10); len(p) != 50 {
+		t.Fatalf(" frame to another mac should be kept %x \n", p[:18])
+	}
+	if p := rx(c.Mac, 11); len(p) != 50 {
+		t.Fatalf(" frame with another tag should be kept %x \n", p[:18])
+	}
+	if ns.stats.rxVlanPopped != 2 {
+		t.Fatalf(" bad counters %+v \n", ns.stats)
+	}
+
+	ns.RemoveClient(c)
+	if len(ns.vlanTags) != 0 || tctx.vlanClients != 0 {
+		t.Fatalf(" tags of a removed client should be released \n")
+	}
+}
+
+func TestClientVlanPolicyError(t *testing.T) {
+	tctx := NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key CTunnelKey
+	key.Set(&CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000007, 0x81000008}})
+	ns := NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	c := NewClient(ns, MACKey{0, 0, 1, 0, 0, 0}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 2})
+	ns.AddClient(c)
+
+	if c.SetVlanPolicy([]CClientVlanRuleCmd{{Vlan: 10}}) == nil || tctx.vlanClients != 0 {
+		t.Fatalf(" namespace with 2 tags should not have a vlan policy \n")
+	}
+
+	// a client with the same mac is not added and should not keep its vlan policy
+	key.Set(&CTunnelData{Vport: 1})
+	ns = NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	ns.AddClient(NewClient(ns, MACKey{0, 0, 1, 0, 0, 0}, Ipv4Key{16, 0, 0, 1}, Ipv6Key{}, Ipv4Key{16, 0, 0, 2}))
+	params := fastjson.RawMessage(`{"tun": {"vport": 1}, "clients": [{"mac": [0, 0, 1, 0, 0, 0],
+		"vlan_policy": [{"vlan": 10}]}]}`)
+	if _, err := (ApiClientAddHandler{}).ServeJSONRPC(tctx, &params); err == nil {
+		t.Fatalf(" client with the same mac should not be added \n")
+	}
+	if tctx.vlanClients != 0 || len(ns.vlanTags) != 0 {
+		t.Fatalf(" vlan policy of a client that was not added should be removed \n")
+	}
+}
@@ -11,6 +11,8 @@ RFC 826  for ARP
 client inijson {
 	Timer uint32 `json:"timer"` // timer in sec for query and keep the client alive from DUT, default is 60 sec
 	TimerDisable bool `json:"timer_disable"` // disable the Query timer (timer is zero)
+	OffSubnet string `json:"off_subnet"` // requests of a sender outside the subnet: answer (default) or ignore
+	SubnetLen uint8 `json:"subnet_len"` // prefix length of the client subnet, default from the client mask, 32 is unknown
 }:
 
 */
@@ -20,6 +22,7 @@ import (
 	"external/google/gopacket/layers"
 	"external/osamingo/jsonrpc"
 	"fmt"
+	"sort"
 	"time"
 	"unsafe"
 
@@ -36,20 +39,38 @@ const (
 	stateIncomplete      = 17
 	stateComplete        = 18
 	stateRefresh         = 19 /* re-query wait for results to get back to stateQuery */
+	stateRefreshUnicast  = 20 /* unicast query to the resolved MAC before the entry ages out */
+	flapSampleSize       = 4  /* number of flapping MACs to keep per entry */
+	defaultFlapThreshold = 3
+	defendInterval       = 10 * time.Second /* RFC 5227 DEFEND_INTERVAL, minimum time between defenses */
 )
 
 // refresh the time here
 // I would like to make this table generic, let try to the table without generic first
 // then optimize it
 
+type ArpNsInit struct {
+	FlapThreshold uint32 `json:"flap_threshold"` // number of flaps on an entry that trigger MSG_ARP_FLAP, 0 disables the event
+	GarpPolicy    string `json:"garp_policy"`    // cache update on a gratuitous ARP of a neighbor: learn (default), update or ignore
+	RefreshSec    uint32 `json:"refresh_sec"`    // send a unicast query this number of seconds before a resolved entry ages out, 0 disables
+}
+
 type ArpCInit struct {
 	Timer        uint32 `json:"timer"`
 	TimerDisable bool   `json:"timer_disable"`
+	DgChangeGarp *bool  `json:"dg_change_garp"` // send a gratuitous ARP when the default gateway is changed, true by default
+	Defend       bool   `json:"defend"`         // defend the address against conflicting ARP packets, RFC 5227
+	OffSubnet    string `json:"off_subnet"`     // requests of a sender outside the subnet: answer (default) or ignore
+	SubnetLen    uint8  `json:"subnet_len"`     // prefix length of the client subnet, zero for the client mask
+
+	Claim []core.Ipv4Key `json:"claim"` // addresses the client does not own but answers in ARP, see arp_c_set_claim
+	Spoof bool           `json:"spoof"` // the claims are spoofing (e.g. the gateway) and not a duplicate address
 }
 
 type ArpFlow struct {
 	dlist  core.DList
 	head   core.DList /* pointer to PerClientARP object */
+	routes core.DList /* pointer to arpRouteRef objects, next-hop of static routes */
 	timer  core.CHTimerObj
 	ipv4   core.Ipv4Key // key
 	state  uint8
@@ -57,18 +78,51 @@ type ArpFlow struct {
 	touch  bool
 	refc   uint32
 	action core.CClientDg
+
+	replied   bool   // a reply was received for this entry
+	lastReply uint64 // ticks of the last reply
+	flaps     uint32 // replies with a MAC different from the resolved one
+	dups      uint32 // identical replies within a second of each other
+	sampleCnt uint32
+	sample    [flapSampleSize]core.MACKey // last flapping MACs
+	dgChange  bool                        // a query after a change of the default gateway is waiting for a reply
+	stale     bool                        // the entry was forced to stale, waiting for the re-resolution
 }
 
 func covertToArpFlow(dlist *core.DList) *ArpFlow {
 	return (*ArpFlow)(unsafe.Pointer(dlist))
 }
 
+// getFlapSample returns the last flapping MACs, oldest first
+func (o *ArpFlow) getFlapSample() []core.MACKey {
+	if o.sampleCnt == 0 {
+		return nil
+	}
+	n := o.sampleCnt
+	if n > flapSampleSize {
+		n = flapSampleSize
+	}
+	r := make([]core.MACKey, 0, n)
+	for i := o.sampleCnt - n; i < o.sampleCnt; i++ {
+		r = append(r, o.sample[i%flapSampleSize])
+	}
+	return r
+}
+
 type ArpCacheRec struct {
-	Ipv4    core.Ipv4Key `json:"ipv4"`
-	Refc    uint32       `json:"refc"`
-	State   uint8        `json:"state"`
-	Resolve bool         `json:"resolve"`
-	Mac     core.MACKey  `json:"mac"`
+	Ipv4    core.Ipv4Key  `json:"ipv4"`
+	Refc    uint32        `json:"refc"`
+	State   uint8         `json:"state"`
+	Resolve bool          `json:"resolve"`
+	Mac     core.MACKey   `json:"mac"`
+	Flaps   uint32        `json:"flaps,omitempty"`
+	Dups    uint32        `json:"dups,omitempty"`
+	Sample  []core.MACKey `json:"flap_sample,omitempty"`
+}
+
+// ArpNsState the state of the namespace in ctx_get_state
+type ArpNsState struct {
+	Cache []ArpCacheRec `json:"cache"`
 }
 
 type MapArpTbl map[core.Ipv4Key]*ArpFlow
@@ -94,6 +148,11 @@ type ArpNsStats struct {
 	pktRxArpQuery         uint64
 	pktRxArpQueryNotForUs uint64
 	pktRxArpReply         uint64
+	pktRxArpReplyFlap     uint64
+	pktRxArpReplyDup      uint64
+	pktRxGarp             uint64
+	pktRxGarpMacChange    uint64
+	eventsFlap            uint64
 	pktTxArpQuery         uint64
 	pktTxGArp             uint64
 	pktTxReply            uint64
@@ -102,6 +161,24 @@ type ArpNsStats struct {
 	tblRemove             uint64
 	associateWithClient   uint64
 	disasociateWithClient uint64
+	associateWithRoute    uint64
+	disassociateWithRoute uint64
+	pktTxArpRefresh       uint64
+	refreshKeptAlive      uint64
+	refreshNoReply        uint64
+	dgChangeFlush         uint64
+	dgChangeQuery         uint64
+	dgChangeResolved      uint64
+	forcedStale           uint64
+	staleResolved         uint64
+	conflictDetected      uint64
+	pktTxDefend           uint64
+	defendRateLimited     uint64
+	offSubnetAnswered     uint64
+	offSubnetSuppressed   uint64
+	pktTxClaimReply       uint64
+	pktTxSpoofReply       uint64
+	claimErrInit          uint64
 }
 
 func NewArpNsStatsDb(o *ArpNsStats) *core.CCounterDb {
@@ -227,6 +304,27 @@ func NewArpNsStatsDb(o *ArpNsStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScINFO})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxArpReplyFlap,
+		Name:     "pktRxArpReplyFlap",
+		Help:     "rx arp reply with a mac different from the resolved one",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxArpReplyDup,
+		Name:     "pktRxArpReplyDup",
+		Help:     "rx duplicate arp reply",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.eventsFlap,
+		Name:     "eventsFlap",
+		Help:     "entries that crossed the flap threshold",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
 	db.Add(&core.CCounterRec{
 		Counter:  &o.pktTxArpQuery,
 		Name:     "pktTxArpQuery",
@@ -285,6 +383,152 @@ func NewArpNsStatsDb(o *ArpNsStats) *core.CCounterDb {
 		Unit:     "ops",
 		DumpZero: false,
 		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxGarp,
+		Name:     "pktRxGarp",
+		Help:     "rx gratuitous arp of a neighbor",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxGarpMacChange,
+		Name:     "pktRxGarpMacChange",
+		Help:     "rx gratuitous arp with a MAC different from the cache",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.associateWithRoute,
+		Name:     "associateWithRoute",
+		Help:     "associate with a next-hop of a static route",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.disassociateWithRoute,
+		Name:     "disassociateWithRoute",
+		Help:     "disassociate with a next-hop of a static route",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxArpRefresh,
+		Name:     "pktTxArpRefresh",
+		Help:     "unicast refresh queries sent before an entry ages out",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.refreshKeptAlive,
+		Name:     "refreshKeptAlive",
+		Help:     "entries kept alive by a unicast refresh",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.refreshNoReply,
+		Name:     "refreshNoReply",
+		Help:     "unicast refresh without a reply, moved to broadcast query",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dgChangeFlush,
+		Name:     "dgChangeFlush",
+		Help:     "old default gateway entry flushed on a change",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dgChangeQuery,
+		Name:     "dgChangeQuery",
+		Help:     "new default gateway queried on a change",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dgChangeResolved,
+		Name:     "dgChangeResolved",
+		Help:     "new default gateway resolved after a change",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.forcedStale,
+		Name:     "forcedStale",
+		Help:     "resolved entries forced to stale by rpc",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.staleResolved,
+		Name:     "staleResolved",
+		Help:     "forced stale entries resolved again",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.conflictDetected,
+		Name:     "conflictDetected",
+		Help:     "arp packets of another host that claim the address of a client",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxDefend,
+		Name:     "pktTxDefend",
+		Help:     "tx arp announcements that defend an address",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.defendRateLimited,
+		Name:     "defendRateLimited",
+		Help:     "conflicts not defended, within the defend interval of the last defense",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.offSubnetAnswered,
+		Name:     "offSubnetAnswered",
+		Help:     "answered requests of a sender outside the subnet of the client",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.offSubnetSuppressed,
+		Name:     "offSubnetSuppressed",
+		Help:     "requests of a sender outside the subnet of the client, not answered by the policy",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxClaimReply,
+		Name:     "pktTxClaimReply",
+		Help:     "tx replies for a claimed address of a client",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxSpoofReply,
+		Name:     "pktTxSpoofReply",
+		Help:     "tx spoofed replies for a claimed address of a client",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.claimErrInit,
+		Name:     "claimErrInit",
+		Help:     "claims of the init json that were rejected, the client has no claim",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
 	return db
 }
 
@@ -295,6 +539,7 @@ type ArpFlowTable struct {
 	tbl           MapArpTbl
 	head          core.DList
 	completeTicks uint32 /* timer to send query */
+	refreshTicks  uint32 /* unicast refresh before completeTicks, zero disables */
 	learnTimer    uint32
 	second        uint32      /* timer to remove */
 	activeIter    *core.DList /* iterator */
@@ -311,6 +556,23 @@ func (o *ArpFlowTable) Create(timerw *core.TimerCtx) {
 	o.second = timerw.DurationToTicks(time.Second)
 }
 
+// SetRefresh sets the unicast refresh, sec before a resolved entry ages out. It should be less
+// than the complete timer, zero disables
+func (o *ArpFlowTable) SetRefresh(sec uint32) {
+	o.refreshTicks = 0
+	if sec > 0 {
+		ticks := o.timerw.DurationToTicks(time.Duration(sec) * time.Second)
+		if ticks < o.completeTicks {
+			o.refreshTicks = ticks
+		}
+	}
+}
+
+// getCompleteTicks returns the timer of a resolved entry, shorter in case of unicast refresh
+func (o *ArpFlowTable) getCompleteTicks() uint32 {
+	return o.completeTicks - o.refreshTicks
+}
+
 func (o *ArpFlowTable) OnRemove() {
 	for k := range o.tbl {
 		flow := o.tbl[k]
@@ -349,6 +611,12 @@ func (o *ArpFlowTable) OnDeleteFlow(flow *ArpFlow) {
 	}
 }
 
+// Flush removes an entry that is not used, its MAC should not be used anymore
+func (o *ArpFlowTable) Flush(flow *ArpFlow) {
+	o.OnRemoveFlow(flow)
+	o.OnDeleteFlow(flow)
+}
+
 /*AssociateWithClient  associate the flow with a client
 and return if this is the first and require to send GARP and Query*/
 func (o *ArpFlowTable) AssociateWithClient(flow *ArpFlow) bool {
@@ -379,11 +647,13 @@ func (o *ArpFlowTable) AddNew(ipv4 core.Ipv4Key,
 	flow.ipv4 = ipv4
 	flow.state = state
 	flow.head.SetSelf()
+	flow.routes.SetSelf()
 	if IpdgMac != nil {
 		flow.action.IpdgResolved = true
 		flow.action.IpdgMac = *IpdgMac
 	} else {
 		flow.action.IpdgResolved = false
+		flow.action.StartResolve(o.timerw.Ticks)
 	}
 	flow.timer.SetCB(o, flow, 0)
 
@@ -425,15 +695,24 @@ func (o *ArpFlowTable) MoveToComplete(flow *ArpFlow) {
 		panic("MoveToComplete timer should always on")
 	}
 	flow.touch = false
-	o.timerw.StartTicks(&flow.timer, o.completeTicks)
+	o.timerw.StartTicks(&flow.timer, o.getCompleteTicks())
 	flow.state = stateComplete
 	o.stats.moveComplete++
 }
 
 func (o *ArpFlowTable) ArpLearn(flow *ArpFlow, mac *core.MACKey) {
+	if flow.dgChange {
+		flow.dgChange = false
+		o.stats.dgChangeResolved++
+	}
+	if flow.stale {
+		flow.stale = false
+		o.stats.staleResolved++
+	}
 
 	flow.action.IpdgResolved = true
 	flow.action.IpdgMac = *mac
+	flow.action.OnResolved(o.timerw.Ticks)
 	switch flow.state {
 	case stateLearned:
 		flow.touch = true
@@ -443,11 +722,40 @@ func (o *ArpFlowTable) ArpLearn(flow *ArpFlow, mac *core.MACKey) {
 		flow.touch = true
 	case stateRefresh:
 		o.MoveToComplete(flow)
+	case stateRefreshUnicast:
+		o.stats.refreshKeptAlive++
+		o.MoveToComplete(flow)
 	default:
 		panic("ArpLearn ")
 	}
 }
 
+// CheckReply check a reply against a resolved entry before learning it. A reply with a
+// different MAC is a flap, the same MAC within a second of the previous reply is a duplicate.
+// return true for each flap once the number of flaps reached the threshold
+func (o *ArpFlowTable) CheckReply(flow *ArpFlow, mac *core.MACKey, threshold uint32) bool {
+	var crossed bool
+	now := o.timerw.Ticks
+	if flow.action.IpdgResolved {
+		if flow.action.IpdgMac != *mac {
+			o.stats.pktRxArpReplyFlap++
+			flow.flaps++
+			flow.sample[flow.sampleCnt%flapSampleSize] = *mac
+			flow.sampleCnt++
+			if threshold > 0 && flow.flaps >= threshold {
+				o.stats.eventsFlap++
+				crossed = true
+			}
+		} else if flow.replied && (now-flow.lastReply) < uint64(o.second) {
+			o.stats.pktRxArpReplyDup++
+			flow.dups++
+		}
+	}
+	flow.replied = true
+	flow.lastReply = now
+	return crossed
+}
+
 // Lookup for a resolution
 func (o *ArpFlowTable) Lookup(ipv4 core.Ipv4Key) *ArpFlow {
 	v, ok := o.tbl[ipv4]
@@ -461,17 +769,55 @@ func (o *ArpFlowTable) Lookup(ipv4 core.Ipv4Key) *ArpFlow {
 /*SendQuery on behalf of the first client */
 func (o *ArpFlowTable) SendQuery(flow *ArpFlow) {
 	if flow.state == stateRefresh || flow.state == stateIncomplete {
-		if flow.head.IsEmpty() {
+		if !flow.head.IsEmpty() {
+			/* take the first and query */
+			cplg := pluginArpClientCastfromDlist(flow.head.Next())
+			cplg.SendQuery()
+		} else if !flow.routes.IsEmpty() {
+			/* only next-hop of static routes */
+			ref := arpRouteRefCastfromDlist(flow.routes.Next())
+			ref.arpc.sendQuery(flow.ipv4)
+		} else {
 			panic("SendQuery no valid list  ")
 		}
-		/* take the first and query */
-		cplg := pluginArpClientCastfromDlist(flow.head.Next())
-		cplg.SendQuery()
 	} else {
 		panic("SendQuery in not valid state ")
 	}
 }
 
+// SendRefresh sends a unicast query to the resolved MAC on behalf of the first client
+func (o *ArpFlowTable) SendRefresh(flow *ArpFlow) {
+	o.stats.pktTxArpRefresh++
+	if !flow.head.IsEmpty() {
+		cplg := pluginArpClientCastfromDlist(flow.head.Next())
+		cplg.sendUnicastQuery(flow.ipv4, flow.action.IpdgMac)
+	} else if !flow.routes.IsEmpty() {
+		ref := arpRouteRefCastfromDlist(flow.routes.Next())
+		ref.arpc.sendUnicastQuery(flow.ipv4, flow.action.IpdgMac)
+	} else {
+		panic("SendRefresh no valid list  ")
+	}
+}
+
+// Release remove a reference of a client, the last one moves the flow to learn
+func (o *ArpFlowTable) Release(flow *ArpFlow) {
+	if flow.refc == 0 {
+		panic(" ref count can't be zero before remove")
+	}
+	flow.refc--
+	if flow.refc == 0 {
+		// move to Learn
+		if !flow.head.IsEmpty() || !flow.routes.IsEmpty() {
+			panic(" head should be empty ")
+		}
+		o.MoveToLearn(flow)
+	} else {
+		if flow.head.IsEmpty() && flow.routes.IsEmpty() {
+			panic(" head should not be empty ")
+		}
+	}
+}
+
 func (o *ArpFlowTable) GetNextTicks(flow *ArpFlow) uint32 {
 	index := flow.index
 	maxl := uint8((len(defaultRetryTimerSec) - 1))
@@ -496,7 +842,24 @@ func (o *ArpFlowTable) handleRefreshState(flow *ArpFlow) {
 		o.stats.moveIncompleteAfterRefresh++
 		flow.action.IpdgResolved = false
 		flow.action.IpdgMac.Clear()
+		flow.action.StartResolve(o.timerw.Ticks)
+	}
+}
+
+// SetStale moves a resolved entry to the refresh state as if the complete timer has just expired
+// without a packet, the query is sent now and the resolved MAC is kept until the retries are done.
+func (o *ArpFlowTable) SetStale(flow *ArpFlow) error {
+	if flow.state != stateComplete && flow.state != stateRefreshUnicast {
+		return fmt.Errorf("arp entry %v is not resolved", flow.ipv4.ToIP())
 	}
+	o.timerw.Stop(&flow.timer)
+	flow.touch = false
+	flow.stale = true
+	flow.state = stateRefresh
+	flow.index = 0
+	o.stats.forcedStale++
+	o.handleRefreshState(flow)
+	return nil
 }
 
 /* OnEvent timer callback */
@@ -520,7 +883,11 @@ func (o *ArpFlowTable) OnEvent(a, b interface{}) {
 		o.stats.timerEventComplete++
 		if flow.touch {
 			flow.touch = false
-			o.timerw.StartTicks(&flow.timer, o.completeTicks)
+			o.timerw.StartTicks(&flow.timer, o.getCompleteTicks())
+		} else if o.refreshTicks > 0 {
+			flow.state = stateRefreshUnicast
+			o.timerw.StartTicks(&flow.timer, o.refreshTicks)
+			o.SendRefresh(flow)
 		} else {
 			flow.state = stateRefresh
 			flow.index = 0
@@ -529,6 +896,12 @@ func (o *ArpFlowTable) OnEvent(a, b interface{}) {
 	case stateRefresh:
 		o.stats.timerEventRefresh++
 		o.handleRefreshState(flow)
+	case stateRefreshUnicast:
+		/* the entry aged out without a reply */
+		o.stats.refreshNoReply++
+		flow.state = stateRefresh
+		flow.index = 0
+		o.handleRefreshState(flow)
 
 	default:
 		panic("Arp on event  ")
@@ -569,24 +942,52 @@ func (o *ArpFlowTable) GetNext(n uint16) ([]ArpCacheRec, error) {
 		}
 
 		ent := covertToArpFlow(o.activeIter)
-		var jsone ArpCacheRec
-		jsone.Ipv4 = ent.ipv4
-		jsone.Refc = ent.refc
-		jsone.State = ent.state
-		jsone.Resolve = ent.action.IpdgResolved
-		jsone.Mac = ent.action.IpdgMac
-
-		r = append(r, jsone)
+		r = append(r, ent.getRec())
 		o.activeIter = o.activeIter.Next()
 	}
 	return r, nil
 }
 
+func (o *ArpFlow) getRec() ArpCacheRec {
+	var jsone ArpCacheRec
+	jsone.Ipv4 = o.ipv4
+	jsone.Refc = o.refc
+	jsone.State = o.state
+	jsone.Resolve = o.action.IpdgResolved
+	jsone.Mac = o.action.IpdgMac
+	jsone.Flaps = o.flaps
+	jsone.Dups = o.dups
+	jsone.Sample = o.getFlapSample()
+	return jsone
+}
+
+// GetAll returns all the entries of the cache sorted by the ip
+func (o *ArpFlowTable) GetAll() []ArpCacheRec {
+	r := make([]ArpCacheRec, 0, len(o.tbl))
+	for _, ent := range o.tbl {
+		r = append(r, ent.getRec())
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Ipv4.Uint32() < r[j].Ipv4.Uint32() })
+	return r
+}
+
 func pluginArpClientCastfromDlist(o *core.DList) *PluginArpClient {
 	var s PluginArpClient
 	return (*PluginArpClient)(unsafe.Pointer(uintptr(unsafe.Pointer(o)) - unsafe.Offsetof(s.dlist)))
 }
 
+// arpRouteRef a reference of a client to the flow of a next-hop of its static routes
+type arpRouteRef struct {
+	dlist core.DList /* to link to ArpFlow */
+	arpc  *PluginArpClient
+	flow  *ArpFlow
+}
+
+func arpRouteRefCastfromDlist(o *core.DList) *arpRouteRef {
+	var s arpRouteRef
+	return (*arpRouteRef)(unsafe.Pointer(uintptr(unsafe.Pointer(o)) - unsafe.Offsetof(s.dlist)))
+}
+
 type PluginArpCTimer struct {
 }
 
@@ -608,6 +1009,15 @@ type PluginArpClient struct {
 	timerw         *core.TimerCtx
 	arpNsPlug      *PluginArpNs
 	timerSec       uint32
+	routes         map[core.Ipv4Key]*arpRouteRef // next-hops of the static routes
+	dgChangeGarp   bool                          // announce the client on a change of the default gateway
+	defend         bool                          // defend the address, RFC 5227
+	defended       bool                          // a defense was sent
+	lastDefend     uint64                        // ticks of the last defense
+	offSubnet      uint8                         // see core.OFF_SUBNET_ANSWER
+	subnetLen      uint8                         // zero for the mask of the client
+	claim          []core.Ipv4Key                // addresses the client answers without owning them
+	spoof          bool                          // the claims are spoofing
 }
 
 func (o *PluginArpClient) onTimerUpdate() {
@@ -632,7 +1042,7 @@ func (o *PluginArpClient) preparePacketTemplate() {
 		DstProtAddress:    []uint8{0x00, 0x00, 0x00, 0x00}})
 	o.arpPktTemplate = append(l2, arpHeader...)
 	o.arpHeader = layers.ArpHeader(o.arpPktTemplate[arpOffset : arpOffset+28])
-	o.timerw = o.Tctx.GetTimerCtx()
+	o.timerw = o.Ns.GetTimerCtx()
 	o.timer.SetCB(&o.timerCb, o, 0) // set the callback to OnEvent
 	if o.timerSec > 0 {
 		o.timerw.Start(&o.timer, time.Duration(o.timerSec)*time.Second)
@@ -646,6 +1056,7 @@ func NewArpClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 
 	o := new(PluginArpClient)
 	o.timerSec = 60
+	o.dgChangeGarp = true
 
 	if err == nil {
 		/* init json was provided */
@@ -655,15 +1066,31 @@ func NewArpClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 		if init.TimerDisable {
 			o.timerSec = 0
 		}
+		if init.DgChangeGarp != nil {
+			o.dgChangeGarp = *init.DgChangeGarp
+		}
+		o.defend = init.Defend
+		o.offSubnet, _ = core.ParseOffSubnetPolicy(init.OffSubnet)
+		if init.SubnetLen <= 32 {
+			o.subnetLen = init.SubnetLen
+		}
+	}
+	claim := init.Claim
+	if err != nil {
+		claim = nil
 	}
 
 	o.arpEnable = true
 	o.dlist.SetSelf()
+	o.routes = make(map[core.Ipv4Key]*arpRouteRef)
 	o.InitPluginBase(ctx, o)            /* init base object*/
 	o.RegisterEvents(ctx, arpEvents, o) /* register events, only if exits*/
 	o.preparePacketTemplate()
 	nsplg := o.Ns.PluginCtx.GetOrCreate(ARP_PLUG)
 	o.arpNsPlug = nsplg.Ext.(*PluginArpNs)
+	if o.SetClaim(claim, init.Spoof) != nil {
+		o.arpNsPlug.stats.claimErrInit++
+	}
 
 	o.OnCreate()
 
@@ -684,6 +1111,7 @@ func (o *PluginArpClient) OnEvent(msg string, a, b interface{}) {
 				o.Client.DgIpv4,
 				!oldIPv4.IsZero(),
 				!newIPv4.IsZero())
+			o.updateRoutes(o.Client.Routes, o.Client.Routes, !newIPv4.IsZero())
 		}
 
 	case core.MSG_UPDATE_DGIPV4_ADDR:
@@ -692,17 +1120,54 @@ func (o *PluginArpClient) OnEvent(msg string, a, b interface{}) {
 		if newIPv4 != oldIPv4 {
 			/* there was a change in Source IPv4 */
 			o.arpNsPlug.stats.eventsChangeDgIPv4++
-			o.OnChangeDGSrcIPv4(oldIPv4,
-				newIPv4,
-				!o.Client.Ipv4.IsZero(),
-				!o.Client.Ipv4.IsZero())
+			if !o.Client.Ipv4.IsZero() {
+				o.arpNsPlug.ChangeClientDg(o, oldIPv4)
+			}
 		}
 
+	case core.MSG_UPDATE_ROUTES:
+		o.updateRoutes(a.([]*core.CClientRoute), b.([]*core.CClientRoute), !o.Client.Ipv4.IsZero())
 	}
 
 }
 
-var arpEvents = []string{core.MSG_UPDATE_IPV4_ADDR, core.MSG_UPDATE_DGIPV4_ADDR}
+var arpEvents = []string{core.MSG_UPDATE_IPV4_ADDR, core.MSG_UPDATE_DGIPV4_ADDR, core.MSG_UPDATE_ROUTES}
+
+// updateRoutes - called in case the static routes were replaced, the next-hops of the new ipv4
+// routes are associated with ArpFlow objects, only if there is a valid src IPv4
+func (o *PluginArpClient) updateRoutes(old []*core.CClientRoute,
+	routes []*core.CClientRoute,
+	isSrcIPv4 bool) {
+	for _, r := range old {
+		if !r.IsIpv6 {
+			r.Dg = nil
+		}
+	}
+	refs := make(map[core.Ipv4Key]*arpRouteRef)
+	if isSrcIPv4 {
+		for _, r := range routes {
+			if r.IsIpv6 {
+				continue
+			}
+			nh := r.NextHopIpv4
+			ref, ok := refs[nh]
+			if !ok {
+				ref, ok = o.routes[nh]
+				if ok {
+					delete(o.routes, nh)
+				} else {
+					ref = o.arpNsPlug.AssociateRoute(o, nh)
+				}
+				refs[nh] = ref
+			}
+			r.Dg = &ref.flow.action
+		}
+	}
+	for _, ref := range o.routes {
+		o.arpNsPlug.DisassociateRoute(ref)
+	}
+	o.routes = refs
+}
 
 /*OnChangeDGSrcIPv4 - called in case there is a change in DG or srcIPv4 */
 func (o *PluginArpClient) OnChangeDGSrcIPv4(oldDgIpv4 core.Ipv4Key,
@@ -729,10 +1194,37 @@ func (o *PluginArpClient) OnRemove(ctx *core.PluginCtx) {
 		o.Client.DgIpv4,
 		!o.Client.Ipv4.IsZero(),
 		false)
+	o.updateRoutes(o.Client.Routes, nil, false)
+	o.SetClaim(nil, false)
 	ctx.UnregisterEvents(&o.PluginBase, arpEvents)
 }
 
+// SetClaim sets the addresses the client answers in ARP without owning them, e.g. the address of the
+// gateway to emulate ARP spoofing or the address of another host to emulate a duplicate address. An
+// address is claimed by one client of the namespace.
+func (o *PluginArpClient) SetClaim(claim []core.Ipv4Key, spoof bool) error {
+	claims := o.arpNsPlug.claims
+	for _, ipv4 := range claim {
+		if ipv4.IsZero() || ipv4 == o.Client.Ipv4 {
+			return fmt.Errorf(" invalid claim %v, the client owns it or it is zero", ipv4)
+		}
+		if c, ok := claims[ipv4]; ok && c != o {
+			return fmt.Errorf(" %v is already claimed by client %v", ipv4, c.Client.Mac)
+		}
+	}
+	for _, ipv4 := range o.claim {
+		delete(claims, ipv4)
+	}
+	o.claim = append([]core.Ipv4Key(nil), claim...)
+	o.spoof = spoof
+	for _, ipv4 := range o.claim {
+		claims[ipv4] = o
+	}
+	return nil
+}
+
 func (o *PluginArpClient) OnCreate() {
+	o.updateRoutes(nil, o.Client.Routes, !o.Client.Ipv4.IsZero())
 	if o.Client.ForceDGW {
 		return
 	}
@@ -745,37 +1237,123 @@ func (o *PluginArpClient) OnCreate() {
 }
 
 func (o *PluginArpClient) SendGArp() {
+	if o.Ns.SuppressTx() {
+		return
+	}
 	if !o.Client.Ipv4.IsZero() {
 		o.arpNsPlug.stats.pktTxGArp++
-		o.arpHeader.SetOperation(1)
-		o.arpHeader.SetSrcIpAddress(o.Client.Ipv4.Uint32())
-		o.arpHeader.SetDstIpAddress(o.Client.Ipv4.Uint32())
-		o.arpHeader.SetDestAddress([]byte{0, 0, 0, 0, 0, 0})
-		o.Tctx.Veth.SendBuffer(false, o.Client, o.arpPktTemplate)
+		o.sendAnnouncement()
 	} else {
 		//panic("  SendGArp() arp wasn't sent ")
 	}
 }
 
+// sendAnnouncement broadcast an ARP request with the address of the client as sender and target
+func (o *PluginArpClient) sendAnnouncement() {
+	o.arpHeader.SetOperation(1)
+	o.arpHeader.SetSrcIpAddress(o.Client.Ipv4.Uint32())
+	o.arpHeader.SetDstIpAddress(o.Client.Ipv4.Uint32())
+	o.arpHeader.SetDestAddress([]byte{0, 0, 0, 0, 0, 0})
+	o.Tctx.Veth.SendBuffer(false, o.Client, o.arpPktTemplate)
+}
+
+// Defend handles an ARP packet of another host that claims the address of the client. By RFC 5227
+// a single announcement is broadcast, unless the last one was sent within the defend interval.
+func (o *PluginArpClient) Defend() {
+	stats := &o.arpNsPlug.stats
+	stats.conflictDetected++
+	now := o.timerw.Ticks
+	if o.defended && (now-o.lastDefend) < uint64(o.timerw.DurationToTicks(defendInterval)) {
+		stats.defendRateLimited++
+		return
+	}
+	if o.Ns.SuppressTx() {
+		return
+	}
+	o.defended = true
+	o.lastDefend = now
+	stats.pktTxDefend++
+	o.sendAnnouncement()
+}
+
 func (o *PluginArpClient) SendQuery() {
 	if !o.Client.DgIpv4.IsZero() {
-		o.arpNsPlug.stats.pktTxArpQuery++
-		o.arpHeader.SetOperation(1)
-		o.arpHeader.SetSrcIpAddress(o.Client.Ipv4.Uint32())
-		o.arpHeader.SetDstIpAddress(o.Client.DgIpv4.Uint32())
-		o.arpHeader.SetDestAddress([]byte{0, 0, 0, 0, 0, 0})
-		o.Tctx.Veth.SendBuffer(false, o.Client, o.arpPktTemplate)
+		o.sendQuery(o.Client.DgIpv4)
 	} else {
 		//panic("  SendQuery() arp wasn't sent ")
 	}
 }
 
+// sendQuery query the default gateway or a next-hop of a static route
+func (o *PluginArpClient) sendQuery(ipv4 core.Ipv4Key) {
+	if o.Ns.SuppressTx() {
+		return
+	}
+	o.arpNsPlug.stats.pktTxArpQuery++
+	o.arpHeader.SetOperation(1)
+	o.arpHeader.SetSrcIpAddress(o.Client.Ipv4.Uint32())
+	o.arpHeader.SetDstIpAddress(ipv4.Uint32())
+	o.arpHeader.SetDestAddress([]byte{0, 0, 0, 0, 0, 0})
+	o.Tctx.Veth.SendBuffer(false, o.Client, o.arpPktTemplate)
+}
+
+// sendUnicastQuery query a resolved neighbor directly, used to refresh the entry
+func (o *PluginArpClient) sendUnicastQuery(ipv4 core.Ipv4Key, mac core.MACKey) {
+	if o.Ns.SuppressTx() {
+		return
+	}
+	o.arpHeader.SetOperation(1)
+	o.arpHeader.SetSrcIpAddress(o.Client.Ipv4.Uint32())
+	o.arpHeader.SetDstIpAddress(ipv4.Uint32())
+	o.arpHeader.SetDestAddress(mac[:])
+
+	eth := layers.EthernetHeader(o.arpPktTemplate[0:12])
+	eth.SetDestAddress(mac[:])
+	o.Tctx.Veth.SendBuffer(false, o.Client, o.arpPktTemplate)
+	eth.SetBroadcast() /* back to default as broadcast */
+}
+
+// isOffSubnet checks that the sender of a request is outside the subnet of the client. The subnet is
+// not known for a /32 (the default mask), a probe (zero sender) is never off subnet.
+func (o *PluginArpClient) isOffSubnet(sender uint32) bool {
+	mask := o.Client.Maskv4.Uint32()
+	if o.subnetLen > 0 {
+		mask = ^uint32(0) << (32 - o.subnetLen)
+	}
+	if mask == 0xffffffff || sender == 0 {
+		return false
+	}
+	return (sender & mask) != (o.Client.Ipv4.Uint32() & mask)
+}
+
 func (o *PluginArpClient) Respond(arpHeader *layers.ArpHeader) {
 
+	if o.isOffSubnet(arpHeader.GetSrcIpAddress()) {
+		if o.offSubnet == core.OFF_SUBNET_IGNORE {
+			o.arpNsPlug.stats.offSubnetSuppressed++
+			return
+		}
+		o.arpNsPlug.stats.offSubnetAnswered++
+	}
+
 	o.arpNsPlug.stats.pktTxReply++
+	o.sendReply(arpHeader, o.Client.Ipv4)
+}
 
+// RespondClaim answers a request for an address the client claims
+func (o *PluginArpClient) RespondClaim(arpHeader *layers.ArpHeader, ipv4 core.Ipv4Key) {
+	if o.spoof {
+		o.arpNsPlug.stats.pktTxSpoofReply++
+	} else {
+		o.arpNsPlug.stats.pktTxClaimReply++
+	}
+	o.sendReply(arpHeader, ipv4)
+}
+
+// sendReply sends a reply to a request with the MAC of the client for the address
+func (o *PluginArpClient) sendReply(arpHeader *layers.ArpHeader, ipv4 core.Ipv4Key) {
 	o.arpHeader.SetOperation(2)
-	o.arpHeader.SetSrcIpAddress(o.Client.Ipv4.Uint32())
+	o.arpHeader.SetSrcIpAddress(ipv4.Uint32())
 	o.arpHeader.SetDstIpAddress(arpHeader.GetSrcIpAddress())
 	o.arpHeader.SetDestAddress(arpHeader.GetSourceAddress())
 
@@ -789,19 +1367,37 @@ func (o *PluginArpClient) Respond(arpHeader *layers.ArpHeader) {
 // PluginArpNs arp information per namespace
 type PluginArpNs struct {
 	core.PluginBase
-	arpEnable bool
-	tbl       ArpFlowTable
-	stats     ArpNsStats
-	cdb       *core.CCounterDb
-	cdbv      *core.CCounterDbVec
+	arpEnable     bool
+	flapThreshold uint32
+	garpPolicy    uint8
+	garps         core.CNeighborAnnounceLog
+	tbl           ArpFlowTable
+	claims        map[core.Ipv4Key]*PluginArpClient // addresses claimed by the clients, see SetClaim
+	stats         ArpNsStats
+	cdb           *core.CCounterDb
+	cdbv          *core.CCounterDbVec
 }
 
 func NewArpNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	var init ArpNsInit
+	err := fastjson.Unmarshal(initJson, &init)
+
 	o := new(PluginArpNs)
 	o.InitPluginBase(ctx, o)
 	o.RegisterEvents(ctx, []string{}, o)
 	o.arpEnable = true
-	o.tbl.Create(ctx.Tctx.GetTimerCtx())
+	o.flapThreshold = defaultFlapThreshold
+	if err == nil && init.FlapThreshold > 0 {
+		o.flapThreshold = init.FlapThreshold
+	}
+	if err == nil {
+		o.garpPolicy, _ = core.ParseAnnouncePolicy(init.GarpPolicy)
+	}
+	o.tbl.Create(ctx.Ns.GetTimerCtx())
+	o.claims = make(map[core.Ipv4Key]*PluginArpClient)
+	if err == nil {
+		o.tbl.SetRefresh(init.RefreshSec)
+	}
 	o.tbl.stats = &o.stats
 	o.cdb = NewArpNsStatsDb(&o.stats)
 	o.cdbv = core.NewCCounterDbVec("arp")
@@ -809,6 +1405,16 @@ func NewArpNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 	return &o.PluginBase
 }
 
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginArpNs) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
+// GetState the arp cache of the namespace, see ctx_get_state
+func (o *PluginArpNs) GetState() interface{} {
+	return &ArpNsState{Cache: o.tbl.GetAll()}
+}
+
 func (o *PluginArpNs) OnRemove(ctx *core.PluginCtx) {
 	o.tbl.OnRemove()
 }
@@ -834,18 +1440,7 @@ func (o *PluginArpNs) DisassociateClient(arpc *PluginArpClient,
 		panic(" ref count can't be zero before remove")
 	}
 	flow.head.RemoveNode(&arpc.dlist)
-	flow.refc--
-	if flow.refc == 0 {
-		// move to Learn
-		if !flow.head.IsEmpty() {
-			panic(" head should be empty ")
-		}
-		o.tbl.MoveToLearn(flow)
-	} else {
-		if flow.head.IsEmpty() {
-			panic(" head should not be empty ")
-		}
-	}
+	o.tbl.Release(flow)
 	o.stats.disasociateWithClient++
 	arpc.Client.DGW = nil
 }
@@ -857,6 +1452,10 @@ func (o *PluginArpNs) DisassociateClient(arpc *PluginArpClient,
   3. if this is the first, generate GARP and
 */
 func (o *PluginArpNs) AssociateClient(arpc *PluginArpClient) {
+	o.associateClient(arpc, true)
+}
+
+func (o *PluginArpNs) associateClient(arpc *PluginArpClient, garp bool) *ArpFlow {
 	if arpc.Client.Ipv4.IsZero() || arpc.Client.DgIpv4.IsZero() {
 		panic("AssociateClient should have valid source ipv4 and default gateway ")
 	}
@@ -872,10 +1471,69 @@ func (o *PluginArpNs) AssociateClient(arpc *PluginArpClient) {
 	o.stats.associateWithClient++
 	flow.head.AddLast(&arpc.dlist)
 
-	arpc.SendGArp()
+	if garp {
+		arpc.SendGArp()
+	}
 	arpc.SendQuery()
 
 	arpc.Client.DGW = &flow.action
+	return flow
+}
+
+// ChangeClientDg moves a client with a valid source ipv4 from the old default gateway to the new one.
+// The entry of the old gateway is flushed in case no one else uses it, the new gateway is always
+// queried even if it is already resolved, so the client does not keep a stale MAC.
+func (o *PluginArpNs) ChangeClientDg(arpc *PluginArpClient, oldDgIpv4 core.Ipv4Key) {
+	if !oldDgIpv4.IsZero() {
+		o.DisassociateClient(arpc, oldDgIpv4)
+		flow := o.tbl.Lookup(oldDgIpv4)
+		if flow != nil && flow.refc == 0 {
+			o.tbl.Flush(flow)
+			o.stats.dgChangeFlush++
+		}
+	}
+	if arpc.Client.DgIpv4.IsZero() {
+		return
+	}
+	flow := o.associateClient(arpc, arpc.dgChangeGarp)
+	flow.dgChange = true
+	o.stats.dgChangeQuery++
+}
+
+// SetStale forces the resolved entry of ipv4 to stale, so the re-resolution starts now and not
+// when the complete timer expires
+func (o *PluginArpNs) SetStale(ipv4 core.Ipv4Key) error {
+	flow := o.tbl.Lookup(ipv4)
+	if flow == nil {
+		return fmt.Errorf("arp entry %v does not exist", ipv4.ToIP())
+	}
+	return o.tbl.SetStale(flow)
+}
+
+// AssociateRoute associate a next-hop of a static route of the client with a ArpFlow,
+// the same as AssociateClient without a GARP
+func (o *PluginArpNs) AssociateRoute(arpc *PluginArpClient, ipv4 core.Ipv4Key) *arpRouteRef {
+	flow := o.tbl.Lookup(ipv4)
+	if flow != nil {
+		o.tbl.AssociateWithClient(flow)
+	} else {
+		flow = o.tbl.AddNew(ipv4, nil, stateIncomplete)
+	}
+
+	o.stats.associateWithRoute++
+	ref := &arpRouteRef{arpc: arpc, flow: flow}
+	flow.routes.AddLast(&ref.dlist)
+	if !flow.action.IpdgResolved {
+		arpc.sendQuery(ipv4)
+	}
+	return ref
+}
+
+// DisassociateRoute remove the reference of a next-hop of a static route
+func (o *PluginArpNs) DisassociateRoute(ref *arpRouteRef) {
+	ref.flow.routes.RemoveNode(&ref.dlist)
+	o.tbl.Release(ref.flow)
+	o.stats.disassociateWithRoute++
 }
 
 func (o *PluginArpNs) ArpLearn(arpHeader *layers.ArpHeader) {
@@ -895,6 +1553,27 @@ func (o *PluginArpNs) ArpLearn(arpHeader *layers.ArpHeader) {
 	}
 }
 
+// ArpLearnReply learn a reply, detecting flaps and duplicates of a resolved entry
+func (o *PluginArpNs) ArpLearnReply(arpHeader *layers.ArpHeader) {
+
+	var ipv4 core.Ipv4Key
+	var mkey core.MACKey
+	ipv4.SetUint32(arpHeader.GetSrcIpAddress())
+	copy(mkey[0:6], arpHeader.GetSourceAddress())
+
+	flow := o.tbl.Lookup(ipv4)
+
+	if flow != nil {
+		if o.tbl.CheckReply(flow, &mkey, o.flapThreshold) {
+			o.Ns.PluginCtx.BroadcastMsg(nil, core.MSG_ARP_FLAP, ipv4, flow.flaps)
+		}
+		o.tbl.ArpLearn(flow, &mkey)
+	} else {
+		flow = o.tbl.AddNew(ipv4, &mkey, stateLearned)
+		o.tbl.CheckReply(flow, &mkey, o.flapThreshold)
+	}
+}
+
 //HandleRxArpPacket there is no need to free  buffer
 func (o *PluginArpNs) HandleRxArpPacket(m *core.Mbuf, l3 uint16) {
 	if m.PktLen() < uint32(layers.ARPHeaderSize+l3) {
@@ -906,6 +1585,22 @@ func (o *PluginArpNs) HandleRxArpPacket(m *core.Mbuf, l3 uint16) {
 	arpHeader := layers.ArpHeader(p[l3:])
 	ethHeader := layers.EthernetHeader(p[0:6])
 
+	var rx core.CArpRx
+	rx.Operation = arpHeader.GetOperation()
+	copy(rx.SrcMac[:], arpHeader.GetSourceAddress())
+	rx.SrcIpv4.SetUint32(arpHeader.GetSrcIpAddress())
+	rx.DstIpv4.SetUint32(arpHeader.GetDstIpAddress())
+	o.Ns.PluginCtx.BroadcastMsg(nil, core.MSG_ARP_RX, &rx, nil)
+
+	if o.handleConflict(&rx) {
+		return
+	}
+
+	if o.isGarp(&rx) {
+		o.HandleGarp(&arpHeader, &rx)
+		return
+	}
+
 	switch arpHeader.GetOperation() {
 	case layers.ARPRequest:
 		o.stats.pktRxArpQuery++
@@ -923,7 +1618,11 @@ func (o *PluginArpNs) HandleRxArpPacket(m *core.Mbuf, l3 uint16) {
 				arpCPlug := cplg.Ext.(*PluginArpClient)
 				arpCPlug.Respond(&arpHeader)
 			}
-		} else {
+		}
+		// a claim of an address of another host (or of a client) is answered too
+		if c, ok := o.claims[ipv4]; ok {
+			c.RespondClaim(&arpHeader, ipv4)
+		} else if client == nil {
 			o.stats.pktRxArpQueryNotForUs++
 		}
 
@@ -933,13 +1632,81 @@ func (o *PluginArpNs) HandleRxArpPacket(m *core.Mbuf, l3 uint16) {
 			return
 		}
 		o.stats.pktRxArpReply++
-		o.ArpLearn(&arpHeader)
+		o.ArpLearnReply(&arpHeader)
 
 	default:
 		o.stats.pktRxErrWrongOp++
 	}
 }
 
+// handleConflict detects an ARP packet of another host with the address of a client that defends
+// it, as the sender (reply, request or announcement) or as the target of a probe (zero sender).
+// return true in case the packet was a conflict with the sender address, it is not learned.
+func (o *PluginArpNs) handleConflict(rx *core.CArpRx) bool {
+	probe := rx.SrcIpv4.IsZero()
+	if probe && rx.Operation != layers.ARPRequest {
+		return false
+	}
+	ipv4 := rx.SrcIpv4
+	if probe {
+		ipv4 = rx.DstIpv4
+	}
+	client := o.Ns.CLookupByIPv4(&ipv4)
+	if client == nil || client.Mac == rx.SrcMac {
+		return false
+	}
+	cplg := client.PluginCtx.Get(ARP_PLUG)
+	if cplg == nil {
+		return false
+	}
+	arpc := cplg.Ext.(*PluginArpClient)
+	if !arpc.defend {
+		return false
+	}
+	arpc.Defend()
+	return !probe
+}
+
+// isGarp a gratuitous ARP (request or reply with SPA==TPA) of a neighbor, not of our clients
+func (o *PluginArpNs) isGarp(rx *core.CArpRx) bool {
+	if rx.Operation != layers.ARPRequest && rx.Operation != layers.ARPReply {
+		return false
+	}
+	if rx.SrcIpv4 != rx.DstIpv4 || rx.SrcIpv4.IsZero() {
+		return false
+	}
+	return o.Ns.CLookupByIPv4(&rx.SrcIpv4) == nil
+}
+
+// HandleGarp reports a gratuitous ARP of a neighbor and updates the cache by the policy.
+// The reply may be broadcast.
+func (o *PluginArpNs) HandleGarp(arpHeader *layers.ArpHeader, rx *core.CArpRx) {
+	if rx.Operation == layers.ARPRequest {
+		o.stats.pktRxArpQuery++
+	} else {
+		o.stats.pktRxArpReply++
+	}
+	o.stats.pktRxGarp++
+
+	flow := o.tbl.Lookup(rx.SrcIpv4)
+	ev := core.CNeighborAnnounce{Time: o.Ns.Timestamp(), Ip: rx.SrcIpv4.ToIP(), Mac: rx.SrcMac}
+	if flow != nil && flow.action.IpdgResolved && flow.action.IpdgMac != rx.SrcMac {
+		ev.Changed = true
+		o.stats.pktRxGarpMacChange++
+	}
+	o.garps.Add(&ev)
+	o.Ns.PluginCtx.BroadcastMsg(nil, core.MSG_ARP_GARP, &ev, nil)
+
+	switch o.garpPolicy {
+	case core.ANNOUNCE_POLICY_LEARN:
+		o.ArpLearnReply(arpHeader)
+	case core.ANNOUNCE_POLICY_UPDATE:
+		if flow != nil {
+			o.ArpLearnReply(arpHeader)
+		}
+	}
+}
+
 // PluginArpThread  per thread
 /*type PluginArpThread struct {
 	core.PluginBase
@@ -994,6 +1761,27 @@ type (
 		Garp bool `json:"garp"`
 	}
 
+	ApiArpCSetClaimHandler struct{} // addresses answered by the client without owning them
+	ApiArpCSetClaimParams  struct { /* +tunnel, mac */
+		Claim []core.Ipv4Key `json:"claim"` // empty removes the claims
+		Spoof bool           `json:"spoof"`
+	}
+
+	ApiArpCGetClaimHandler struct{}
+
+	ApiArpNsGetGarpHandler struct{} // the last gratuitous ARPs of the neighbors
+	ApiArpNsGetGarpParams  struct {
+		Clear bool `json:"clear"`
+	}
+	ApiArpNsGetGarpResult struct {
+		Vec []core.CNeighborAnnounce `json:"data"`
+	}
+
+	ApiArpNsSetStaleHandler struct{} // force an entry of the cache to stale
+	ApiArpNsSetStaleParams  struct {
+		Ipv4 core.Ipv4Key `json:"ipv4"`
+	}
+
 	ApiArpNsIterHandler struct{} // iterate on the nd ipv6 cache table
 	ApiArpNsIterParams  struct {
 		Reset bool   `json:"reset"`
@@ -1089,6 +1877,39 @@ func (h ApiArpNsCntHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMe
 	return arpNsPlug.cdbv.GeneralCounters(err, tctx, params, &p)
 }
 
+func (h ApiArpCSetClaimHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiArpCSetClaimParams
+	tctx := ctx.(*core.CThreadCtx)
+
+	arpC, err := getClient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 == nil {
+		err1 = arpC.SetClaim(p.Claim, p.Spoof)
+	}
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiArpCGetClaimHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	arpC, err := getClient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	claim := append(make([]core.Ipv4Key, 0), arpC.claim...)
+	return &ApiArpCSetClaimParams{Claim: claim, Spoof: arpC.spoof}, nil
+}
+
 func (h ApiArpCCmdQueryHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
 
 	var p ApiArpCCmdQueryParams
@@ -1116,6 +1937,66 @@ func (h ApiArpCCmdQueryHandler) ServeJSONRPC(ctx interface{}, params *fastjson.R
 	return nil, nil
 }
 
+func (h ApiArpNsGetGarpHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiArpNsGetGarpParams
+	var res ApiArpNsGetGarpResult
+	tctx := ctx.(*core.CThreadCtx)
+
+	arpNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	res.Vec = arpNs.garps.Get()
+	if p.Clear {
+		arpNs.garps.Clear()
+	}
+	return &res, nil
+}
+
+func (h ApiArpNsSetStaleHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiArpNsSetStaleParams
+	tctx := ctx.(*core.CThreadCtx)
+
+	arpNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err = arpNs.SetStale(p.Ipv4)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
 func (h ApiArpNsIterHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
 
 	var p ApiArpNsIterParams
@@ -1188,6 +2069,10 @@ func init() {
 	core.RegisterCB("arp_ns_cnt", ApiArpNsCntHandler{}, true)
 	core.RegisterCB("arp_c_cmd_query", ApiArpCCmdQueryHandler{}, true)
 	core.RegisterCB("arp_ns_iter", ApiArpNsIterHandler{}, true)
+	core.RegisterCB("arp_ns_get_garp", ApiArpNsGetGarpHandler{}, true)
+	core.RegisterCB("arp_ns_set_stale", ApiArpNsSetStaleHandler{}, true)
+	core.RegisterCB("arp_c_set_claim", ApiArpCSetClaimHandler{}, true)
+	core.RegisterCB("arp_c_get_claim", ApiArpCGetClaimHandler{}, true)
 
 	/* register callback for rx side*/
 	core.ParserRegister("arp", HandleRxArpPacket)
@@ -29,12 +29,17 @@ type ArpTestBase struct {
 	dropAll      bool
 	monitor      bool
 	match        uint8
+	flap         bool
 	capture      bool
 	duration     time.Duration
 	clientsToSim int
 	cb           ArpTestCb
 	cbArg1       interface{}
 	cbArg2       interface{}
+	nextHop      uint32 // another neighbor that answers queries, next-hop of static routes
+	nsInit       []byte // init json of the namespace plugin
+	clientInit   []byte // init json of the client plugins
+	stealth      bool   // passive namespace
 }
 
 type ArpTestCb func(tctx *core.CThreadCtx, test *ArpTestBase) int
@@ -48,7 +53,9 @@ func (o *ArpTestBase) Run(t *testing.T) {
 	if o.match > 0 {
 		simVeth.match = o.match
 	}
-	tctx, _ := createSimulationEnv(&simrx, o.clientsToSim)
+	simVeth.flap = o.flap
+	simVeth.nextHop = o.nextHop
+	tctx, _ := createSimulationEnv(&simrx, o.clientsToSim, o)
 	if o.cb != nil {
 		o.cb(tctx, o)
 	}
@@ -78,12 +85,20 @@ func (o *ArpTestBase) Run(t *testing.T) {
 
 }
 
-func createSimulationEnv(simRx *core.VethIFSim, num int) (*core.CThreadCtx, *core.CClient) {
+func createSimulationEnv(simRx *core.VethIFSim, num int, test *ArpTestBase) (*core.CThreadCtx, *core.CClient) {
 	tctx := core.NewThreadCtx(0, 4510, true, simRx)
 	var key core.CTunnelKey
 	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
 	ns := core.NewNSCtx(tctx, &key)
 	tctx.AddNs(&key, ns)
+	ns.SetStealth(test.stealth)
+	if test.nsInit != nil {
+		ns.PluginCtx.CreatePlugins([]string{"arp"}, [][]byte{test.nsInit})
+	}
+	var cinit [][]byte
+	if test.clientInit != nil {
+		cinit = [][]byte{test.clientInit}
+	}
 	for j := 0; j < num; j++ {
 		a := uint8((j >> 8) & 0xff)
 		b := uint8(j & 0xff)
@@ -98,7 +113,7 @@ func createSimulationEnv(simRx *core.VethIFSim, num int) (*core.CThreadCtx, *cor
 			core.Ipv6Key{},
 			dg)
 		ns.AddClient(client)
-		client.PluginCtx.CreatePlugins([]string{"arp"}, [][]byte{})
+		client.PluginCtx.CreatePlugins([]string{"arp"}, cinit)
 	}
 	tctx.RegisterParserCb("arp")
 	return tctx, nil
@@ -108,6 +123,8 @@ type VethArpSim struct {
 	DropAll bool
 	cnt     uint8
 	match   uint8
+	flap    bool   // answer each query from a different MAC
+	nextHop uint32 // answer queries of this ipv4 too, from 00:00:03:00:00:00
 	tctx    *core.CThreadCtx
 }
 
@@ -120,6 +137,21 @@ func (o *VethArpSim) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
 	var arpHeader layers.ArpHeader
 	var arpHeader1 layers.ArpHeader
 	arpHeader = m.GetData()[22:]
+	if arpHeader.GetOperation() == 1 && o.nextHop != 0 && arpHeader.GetDstIpAddress() == o.nextHop {
+		srcMac := []byte{0, 0, 3, 0, 0, 0}
+		m1 := m.DeepClone()
+		eth := layers.EthernetHeader(m1.GetData()[0:12])
+		eth.SetDestAddress(arpHeader.GetSourceAddress())
+		eth.SetSrcAddress(srcMac)
+		arpHeader1 = m1.GetData()[22:]
+		arpHeader1.SetOperation(2)
+		arpHeader1.SetDestAddress(arpHeader.GetSourceAddress())
+		arpHeader1.SetDstIpAddress(arpHeader.GetSrcIpAddress())
+		arpHeader1.SetSourceAddress(srcMac)
+		arpHeader1.SetSrcIpAddress(o.nextHop)
+		m.FreeMbuf()
+		return m1
+	}
 	if arpHeader.GetOperation() == 1 && (arpHeader.GetDstIpAddress() == 0x10000002) {
 		o.cnt++
 		if o.cnt != 0 {
@@ -129,15 +161,19 @@ func (o *VethArpSim) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
 			}
 
 		}
+		srcMac := []byte{0, 0, 2, 0, 0, 0}
+		if o.flap {
+			srcMac[5] = o.cnt & 1
+		}
 		m1 := m.DeepClone()
 		eth := layers.EthernetHeader(m1.GetData()[0:12])
 		eth.SetDestAddress(arpHeader.GetSourceAddress())
-		eth.SetSrcAddress([]byte{0, 0, 2, 0, 0, 0})
+		eth.SetSrcAddress(srcMac)
 		arpHeader1 = m1.GetData()[22:]
 		arpHeader1.SetOperation(2)
 		arpHeader1.SetDestAddress(arpHeader.GetSourceAddress())
 		arpHeader1.SetDstIpAddress(arpHeader.GetSrcIpAddress())
-		arpHeader1.SetSourceAddress([]byte{0, 0, 2, 0, 0, 0})
+		arpHeader1.SetSourceAddress(srcMac)
 		arpHeader1.SetSrcIpAddress(0x10000002)
 		m.FreeMbuf()
 		return m1
@@ -521,6 +557,622 @@ func TestPluginArp9(t *testing.T) {
 	a.Run(t)*/
 }
 
+/*TestPluginArp10 - default gateway answers each query from a different MAC, should count flaps */
+func TestPluginArp10(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp10",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		flap:         true,
+		capture:      true,
+		duration:     60 * time.Minute,
+		clientsToSim: 1,
+	}
+	a.Run(t)
+}
+
+type ArpRpcCtxGw struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+}
+
+func (o *ArpRpcCtxGw) OnEvent(a, b interface{}) {
+	o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+	"method":"ctx_client_get_gw",
+	"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,0]] },
+	"id": 3 }`))
+}
+
+func rpcQueueGw(tctx *core.CThreadCtx, test *ArpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(test.cbArg1.(time.Duration))
+	var arpctx ArpRpcCtxGw
+	arpctx.timer.SetCB(&arpctx, test.cbArg1, test.cbArg2)
+	arpctx.tctx = tctx
+	timerw.StartTicks(&arpctx.timer, ticks)
+	return 0
+}
+
+/*TestPluginArp11 - the first queries are dropped, report the resolved gateway and the resolution latency */
+func TestPluginArp11(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp11",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     2 * time.Minute,
+		clientsToSim: 1,
+		cb:           rpcQueueGw,
+		cbArg1:       90 * time.Second,
+	}
+	a.Run(t)
+}
+
+/*TestPluginArp12 - the gateway does not answer, should be reported as unresolved */
+func TestPluginArp12(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp12",
+		dropAll:      true,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		cb:           rpcQueueGw,
+		cbArg1:       30 * time.Second,
+	}
+	a.Run(t)
+}
+
+type ArpGarpCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint32
+}
+
+// sendGarp injects a broadcast gratuitous ARP of a neighbor
+func (o *ArpGarpCtx) sendGarp(op uint16, mac net.HardwareAddr, ipv4 []uint8) {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{}
+	gopacket.SerializeLayers(buf, opts,
+		&layers.Ethernet{
+			SrcMAC:       mac,
+			DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			EthernetType: layers.EthernetTypeDot1Q,
+		},
+		&layers.Dot1Q{
+			Priority:       uint8(0),
+			VLANIdentifier: uint16(1),
+			Type:           layers.EthernetTypeDot1Q,
+		},
+		&layers.Dot1Q{
+			Priority:       uint8(0),
+			VLANIdentifier: uint16(2),
+			Type:           layers.EthernetTypeARP,
+		},
+
+		&layers.ARP{
+			AddrType:          0x1,
+			Protocol:          0x800,
+			HwAddressSize:     0x6,
+			ProtAddressSize:   0x4,
+			Operation:         op,
+			SourceHwAddress:   mac,
+			SourceProtAddress: ipv4,
+			DstHwAddress:      []uint8{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			DstProtAddress:    ipv4})
+
+	m := o.tctx.MPool.Alloc(uint16(128))
+	m.SetVPort(1)
+	m.Append(buf.Bytes())
+	o.tctx.Veth.OnRx(m)
+}
+
+func (o *ArpGarpCtx) OnEvent(a, b interface{}) {
+	switch o.cnt {
+	case 0:
+		// the gateway fails over to a new MAC, and a new neighbor announces itself
+		o.sendGarp(layers.ARPReply, net.HardwareAddr{0, 0, 2, 0, 0, 1}, []uint8{16, 0, 0, 2})
+		o.sendGarp(layers.ARPRequest, net.HardwareAddr{0, 0, 2, 0, 0, 9}, []uint8{16, 0, 0, 9})
+		timerw := o.tctx.GetTimerCtx()
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(1*time.Second))
+	case 1:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"arp_ns_get_garp",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "clear": true },
+		"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_get_gw",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,0]] },
+		"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"arp_ns_get_garp",
+		"params": {"tun": {"vport":1,"tci":[1,2]} },
+		"id": 3 }`))
+	}
+	o.cnt++
+}
+
+func rpcQueueGarp(tctx *core.CThreadCtx, test *ArpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(test.cbArg1.(time.Duration))
+	var arpctx ArpGarpCtx
+	arpctx.timer.SetCB(&arpctx, test.cbArg1, test.cbArg2)
+	arpctx.tctx = tctx
+	timerw.StartTicks(&arpctx.timer, ticks)
+	return 0
+}
+
+/*TestPluginArp13 - the resolved gateway sends a gratuitous ARP with a new MAC, should be reported and learned */
+func TestPluginArp13(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp13",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		cb:           rpcQueueGarp,
+		cbArg1:       30 * time.Second,
+	}
+	a.Run(t)
+}
+
+type ArpRouteCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint32
+}
+
+func (o *ArpRouteCtx) OnEvent(a, b interface{}) {
+	switch o.cnt {
+	case 0:
+		// 48.0.0.0/8 via a second router, the rest via the default gateway
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_set_routes",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,0]],
+		           "routes": [{"ipv4": [48,0,0,0], "prefix_len": 8, "ipv4_next_hop": [16,0,0,3]},
+		                      {"ipv4": [48,1,0,0], "prefix_len": 16, "ipv4_next_hop": [16,0,0,3]},
+		                      {"prefix_len": 0, "ipv4_next_hop": [16,0,0,2]}] },
+		"id": 3 }`))
+	case 1:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_get_routes",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,0]] },
+		"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"arp_ns_iter",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "reset": true, "count" : 10 },
+		"id": 3 }`))
+		// invalid, two next-hops
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_set_routes",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,0]],
+		           "routes": [{"prefix_len": 0, "ipv4_next_hop": [16,0,0,3], "ipv6_next_hop": [32,1,13,184,0,0,0,0,0,0,0,0,0,0,0,3]}] },
+		"id": 3 }`))
+	case 2:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_set_routes",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,0]], "routes": [] },
+		"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_get_routes",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,0]] },
+		"id": 3 }`))
+	}
+	o.cnt++
+	if o.cnt < 3 {
+		timerw := o.tctx.GetTimerCtx()
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(10*time.Second))
+	}
+}
+
+func rpcQueueRoute(tctx *core.CThreadCtx, test *ArpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(test.cbArg1.(time.Duration))
+	var arpctx ArpRouteCtx
+	arpctx.timer.SetCB(&arpctx, test.cbArg1, test.cbArg2)
+	arpctx.tctx = tctx
+	timerw.StartTicks(&arpctx.timer, ticks)
+	return 0
+}
+
+/*TestPluginArp14 - static routes, the next-hop should be resolved and released on removal */
+func TestPluginArp14(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp14",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		cb:           rpcQueueRoute,
+		cbArg1:       5 * time.Second,
+		nextHop:      0x10000003,
+	}
+	a.Run(t)
+}
+
+/*TestPluginArp15 - unicast refresh of the gateway before the entry ages out, the entry should be kept alive */
+func TestPluginArp15(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp15",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     30 * time.Minute,
+		clientsToSim: 1,
+		nsInit:       []byte(`{"refresh_sec": 30}`),
+		clientInit:   []byte(`{"timer_disable": true}`),
+	}
+	a.Run(t)
+}
+
+/*TestPluginArp16 - stealth namespace, no gratuitous ARP or queries, only replies to the queries of the DUT */
+func TestPluginArp16(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp16",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		cb:           Cb4,
+		stealth:      true,
+	}
+	a.Run(t)
+}
+
+type ArpDgChangeCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint32
+}
+
+func (o *ArpDgChangeCtx) OnEvent(a, b interface{}) {
+	switch o.cnt {
+	case 0:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_set_dg",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,0]], "dg": [16,0,0,3] },
+		"id": 3 }`))
+		// invalid, unknown client
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_set_dg",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,9]], "dg": [16,0,0,3] },
+		"id": 3 }`))
+	case 1:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_get_gw",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,0]] },
+		"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"arp_ns_iter",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "reset": true, "count" : 10 },
+		"id": 3 }`))
+	}
+	o.cnt++
+	if o.cnt < 2 {
+		timerw := o.tctx.GetTimerCtx()
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(10*time.Second))
+	}
+}
+
+func rpcQueueDgChange(tctx *core.CThreadCtx, test *ArpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(test.cbArg1.(time.Duration))
+	var arpctx ArpDgChangeCtx
+	arpctx.timer.SetCB(&arpctx, test.cbArg1, test.cbArg2)
+	arpctx.tctx = tctx
+	timerw.StartTicks(&arpctx.timer, ticks)
+	return 0
+}
+
+/*TestPluginArp17 - change of the default gateway, the old entry is flushed and the new gateway is resolved without a GARP */
+func TestPluginArp17(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp17",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     30 * time.Second,
+		clientsToSim: 1,
+		cb:           rpcQueueDgChange,
+		cbArg1:       10 * time.Second,
+		nextHop:      0x10000003,
+		clientInit:   []byte(`{"dg_change_garp": false}`),
+	}
+	a.Run(t)
+}
+
+type ArpSetStaleCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint32
+}
+
+func (o *ArpSetStaleCtx) OnEvent(a, b interface{}) {
+	switch o.cnt {
+	case 0:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"arp_ns_set_stale",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "ipv4": [16,0,0,2] },
+		"id": 3 }`))
+		// invalid, unknown entry
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"arp_ns_set_stale",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "ipv4": [16,0,0,9] },
+		"id": 3 }`))
+	case 1:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"arp_ns_iter",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "reset": true, "count" : 10 },
+		"id": 3 }`))
+	}
+	o.cnt++
+	if o.cnt < 2 {
+		timerw := o.tctx.GetTimerCtx()
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(5*time.Second))
+	}
+}
+
+func rpcQueueSetStale(tctx *core.CThreadCtx, test *ArpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(test.cbArg1.(time.Duration))
+	var arpctx ArpSetStaleCtx
+	arpctx.timer.SetCB(&arpctx, test.cbArg1, test.cbArg2)
+	arpctx.tctx = tctx
+	timerw.StartTicks(&arpctx.timer, ticks)
+	return 0
+}
+
+/*TestPluginArp18 - the default gateway is forced to stale, it is queried at once and resolved again */
+func TestPluginArp18(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp18",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     20 * time.Second,
+		clientsToSim: 1,
+		cb:           rpcQueueSetStale,
+		cbArg1:       10 * time.Second,
+	}
+	a.Run(t)
+}
+
 func init() {
 	flag.IntVar(&monitor, "monitor", 0, "monitor")
 }
+
+type ArpDefendCtx struct {
+	ArpGarpCtx
+}
+
+// sendArp injects a broadcast ARP packet of another host
+func (o *ArpDefendCtx) sendArp(op uint16, mac net.HardwareAddr, spa, tpa []uint8) {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{}
+	gopacket.SerializeLayers(buf, opts,
+		&layers.Ethernet{
+			SrcMAC:       mac,
+			DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			EthernetType: layers.EthernetTypeDot1Q,
+		},
+		&layers.Dot1Q{
+			Priority:       uint8(0),
+			VLANIdentifier: uint16(1),
+			Type:           layers.EthernetTypeDot1Q,
+		},
+		&layers.Dot1Q{
+			Priority:       uint8(0),
+			VLANIdentifier: uint16(2),
+			Type:           layers.EthernetTypeARP,
+		},
+
+		&layers.ARP{
+			AddrType:          0x1,
+			Protocol:          0x800,
+			HwAddressSize:     0x6,
+			ProtAddressSize:   0x4,
+			Operation:         op,
+			SourceHwAddress:   mac,
+			SourceProtAddress: spa,
+			DstHwAddress:      []uint8{0, 0, 0, 0, 0, 0},
+			DstProtAddress:    tpa})
+
+	m := o.tctx.MPool.Alloc(uint16(128))
+	m.SetVPort(1)
+	m.Append(buf.Bytes())
+	o.tctx.Veth.OnRx(m)
+}
+
+func (o *ArpDefendCtx) OnEvent(a, b interface{}) {
+	mac := net.HardwareAddr{0, 0, 4, 0, 0, 1}
+	timerw := o.tctx.GetTimerCtx()
+	switch o.cnt {
+	case 0:
+		// another host announces the address of the client
+		o.sendArp(layers.ARPRequest, mac, []uint8{16, 0, 0, 0}, []uint8{16, 0, 0, 0})
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(2*time.Second))
+	case 1:
+		// a probe within the defend interval, answered but not defended
+		o.sendArp(layers.ARPRequest, mac, []uint8{0, 0, 0, 0}, []uint8{16, 0, 0, 0})
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(10*time.Second))
+	case 2:
+		o.sendArp(layers.ARPReply, mac, []uint8{16, 0, 0, 0}, []uint8{16, 0, 0, 2})
+	}
+	o.cnt++
+}
+
+func rpcQueueDefend(tctx *core.CThreadCtx, test *ArpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(test.cbArg1.(time.Duration))
+	var arpctx ArpDefendCtx
+	arpctx.timer.SetCB(&arpctx, test.cbArg1, test.cbArg2)
+	arpctx.tctx = tctx
+	timerw.StartTicks(&arpctx.timer, ticks)
+	return 0
+}
+
+/*TestPluginArp19 - another host claims the address of the client, it is defended once per defend interval */
+type ArpOffSubnetCtx struct {
+	ArpDefendCtx
+}
+
+func (o *ArpOffSubnetCtx) OnEvent(a, b interface{}) {
+	// a request of a host in the /24 of the client and of a host outside of it
+	o.sendArp(layers.ARPRequest, net.HardwareAddr{0, 0, 4, 0, 0, 1}, []uint8{16, 0, 0, 9}, []uint8{16, 0, 0, 0})
+	o.sendArp(layers.ARPRequest, net.HardwareAddr{0, 0, 4, 0, 0, 2}, []uint8{10, 0, 0, 9}, []uint8{16, 0, 0, 0})
+}
+
+func rpcQueueOffSubnet(tctx *core.CThreadCtx, test *ArpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(test.cbArg1.(time.Duration))
+	var arpctx ArpOffSubnetCtx
+	arpctx.timer.SetCB(&arpctx, test.cbArg1, test.cbArg2)
+	arpctx.tctx = tctx
+	timerw.StartTicks(&arpctx.timer, ticks)
+	return 0
+}
+
+// the request of the off subnet host is not answered
+func TestPluginArp20(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp20",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     15 * time.Second,
+		clientsToSim: 1,
+		cb:           rpcQueueOffSubnet,
+		cbArg1:       10 * time.Second,
+		clientInit:   []byte(`{"off_subnet": "ignore", "subnet_len": 24}`),
+	}
+	a.Run(t)
+}
+
+// both are answered, the off subnet one is counted
+func TestPluginArp21(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp21",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     15 * time.Second,
+		clientsToSim: 1,
+		cb:           rpcQueueOffSubnet,
+		cbArg1:       10 * time.Second,
+		clientInit:   []byte(`{"subnet_len": 24}`),
+	}
+	a.Run(t)
+}
+
+func TestPluginArp19(t *testing.T) {
+
+	a := &ArpTestBase{
+		testname:     "arp19",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     30 * time.Second,
+		clientsToSim: 1,
+		cb:           rpcQueueDefend,
+		cbArg1:       10 * time.Second,
+		clientInit:   []byte(`{"defend": true}`),
+	}
+	a.Run(t)
+}
+
+// TestPluginArpClaim1 a client answers the requests for the address of the gateway it claims
+func TestPluginArpClaim1(t *testing.T) {
+	var simVeth VethArpSim
+	simVeth.DropAll = true
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	test := &ArpTestBase{clientInit: []byte(`{"claim": [[16, 0, 0, 2]], "spoof": true}`)}
+	tctx, _ := createSimulationEnv(&simrx, 1, test)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := tctx.GetNs(&key)
+	nsPlug := ns.PluginCtx.Get(ARP_PLUG).Ext.(*PluginArpNs)
+	client := ns.CLookupByMac(&core.MACKey{0, 0, 1, 0, 0, 0})
+	arpC := client.PluginCtx.Get(ARP_PLUG).Ext.(*PluginArpClient)
+
+	var rx ArpDefendCtx
+	rx.tctx = tctx
+	mac := net.HardwareAddr{0, 0, 4, 0, 0, 1}
+	rx.sendArp(layers.ARPRequest, mac, []uint8{16, 0, 0, 9}, []uint8{16, 0, 0, 2})
+	if nsPlug.stats.pktTxSpoofReply != 1 || nsPlug.stats.pktRxArpQueryNotForUs != 0 {
+		t.Fatalf(" the claim of the gateway should be answered %+v \n", nsPlug.stats)
+	}
+
+	if arpC.SetClaim([]core.Ipv4Key{{16, 0, 0, 0}}, false) == nil {
+		t.Fatalf(" the address of the client can't be claimed \n")
+	}
+	// a duplicate address, not spoofing
+	arpC.SetClaim([]core.Ipv4Key{{16, 0, 0, 3}}, false)
+	rx.sendArp(layers.ARPRequest, mac, []uint8{16, 0, 0, 9}, []uint8{16, 0, 0, 3})
+	rx.sendArp(layers.ARPRequest, mac, []uint8{16, 0, 0, 9}, []uint8{16, 0, 0, 2})
+	if nsPlug.stats.pktTxClaimReply != 1 || nsPlug.stats.pktTxSpoofReply != 1 || nsPlug.stats.pktRxArpQueryNotForUs != 1 {
+		t.Fatalf(" bad claim replies %+v \n", nsPlug.stats)
+	}
+
+	// the claim of another client is rejected and counted
+	client2 := core.NewClient(ns, core.MACKey{0, 0, 1, 0, 0, 1}, core.Ipv4Key{16, 0, 0, 1}, core.Ipv6Key{}, core.Ipv4Key{16, 0, 0, 2})
+	ns.AddClient(client2)
+	client2.PluginCtx.CreatePlugins([]string{"arp"}, [][]byte{[]byte(`{"claim": [[16, 0, 0, 3]]}`)})
+	if nsPlug.stats.claimErrInit != 1 || nsPlug.claims[core.Ipv4Key{16, 0, 0, 3}] != arpC {
+		t.Fatalf(" the claim of the init json should be rejected %+v \n", nsPlug.stats)
+	}
+	ns.RemoveClient(client2)
+
+	ns.RemoveClient(client)
+	if len(nsPlug.claims) != 0 {
+		t.Fatalf(" the claims of a removed client should be released \n")
+	}
+}
+
+/*TestArpFlapThreshold - the event is reported for each flap at or above the threshold */
+func TestArpFlapThreshold(t *testing.T) {
+	var stats ArpNsStats
+	var tbl ArpFlowTable
+	tbl.Create(core.NewTimerCtx(true))
+	tbl.stats = &stats
+	flow := &ArpFlow{}
+	flow.action.IpdgResolved = true
+	flow.action.IpdgMac = core.MACKey{0, 0, 2, 0, 0, 0}
+	var events []uint32
+	for i := 0; i < 6; i++ {
+		mac := core.MACKey{0, 0, 2, 0, 0, uint8(i%2 + 1)}
+		if tbl.CheckReply(flow, &mac, 3) {
+			events = append(events, flow.flaps)
+		}
+	}
+	if flow.flaps != 6 || len(events) != 4 || events[0] != 3 || events[3] != 6 || stats.eventsFlap != 4 {
+		t.Fatalf(" bad flap events %v %+v \n", events, stats)
+	}
+}
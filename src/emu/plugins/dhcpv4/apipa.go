@@ -0,0 +1,283 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package dhcp
+
+/*
+RFC 3927 IPv4 link-local (APIPA) fallback
+
+After apipa_retries DISCOVERs without an OFFER the client picks a random address
+in 169.254.1.0-169.254.254.255, probes it with ARP and claims it in case there is
+no conflict. DISCOVER is still sent in the background, the link-local address
+is released once DHCP is bound.
+Conflicts are detected using the ARP packets of the namespace, so the arp plugin
+should be loaded.
+
+*/
+
+import (
+	"emu/core"
+	"encoding/binary"
+	"external/google/gopacket/layers"
+	"math/rand"
+	"time"
+)
+
+const (
+	/* RFC 3927 constants */
+	APIPA_PROBE_WAIT          = 1 * time.Second
+	APIPA_PROBE_NUM           = 3
+	APIPA_PROBE_MIN           = 1 * time.Second
+	APIPA_PROBE_MAX           = 2 * time.Second
+	APIPA_ANNOUNCE_WAIT       = 2 * time.Second
+	APIPA_ANNOUNCE_NUM        = 2
+	APIPA_ANNOUNCE_INTERVAL   = 2 * time.Second
+	APIPA_MAX_CONFLICTS       = 10
+	APIPA_RATE_LIMIT_INTERVAL = 60 * time.Second
+	APIPA_DEFEND_INTERVAL     = 10 * time.Second
+
+	APIPA_DEF_RETRIES = 3 // DISCOVERs without an OFFER before the fallback
+
+	/* state of the link-local address */
+	APIPA_STATE_NONE       = 0
+	APIPA_STATE_PROBING    = 1
+	APIPA_STATE_ANNOUNCING = 2
+	APIPA_STATE_CLAIMED    = 3
+)
+
+type PluginDhcpApipaTimer struct {
+}
+
+func (o *PluginDhcpApipaTimer) OnEvent(a, b interface{}) {
+	pi := a.(*PluginDhcpClient)
+	pi.onApipaTimerEvent()
+}
+
+// dhcpApipa the link-local state of a client
+type dhcpApipa struct {
+	enable      bool
+	retries     uint32 // DISCOVERs without an OFFER before the fallback
+	discoverCnt uint32 // DISCOVERs without an OFFER
+	state       uint8
+	cnt         uint8 // probes/announcements sent on this state
+	conflicts   uint32
+	ipv4        core.Ipv4Key // the candidate/claimed address
+	defendTicks uint64       // last time the address was defended
+	defended    bool
+	rnd         *rand.Rand
+	timer       core.CHTimerObj
+	timerCb     PluginDhcpApipaTimer
+	pktTemplate []byte
+	arpHeader   layers.ArpHeader
+}
+
+func (o *PluginDhcpClient) apipaInit(enable bool, retries uint32) {
+	a := &o.apipa
+	a.enable = enable
+	a.retries = APIPA_DEF_RETRIES
+	if retries > 0 {
+		a.retries = retries
+	}
+	if !enable {
+		return
+	}
+	/* the seed is derived from the MAC so each client selects the same addresses (RFC 3927 2.1) */
+	a.rnd = rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(append([]byte{0, 0}, o.Client.Mac[:]...)))))
+	a.timer.SetCB(&a.timerCb, o, 0)
+
+	l2 := o.Client.GetL2Header(true, uint16(layers.EthernetTypeARP))
+	arpOffset := len(l2)
+	arpHeader := core.PacketUtlBuild(&layers.ARP{
+		AddrType:          0x1,
+		Protocol:          0x800,
+		HwAddressSize:     0x6,
+		ProtAddressSize:   0x4,
+		Operation:         layers.ARPRequest,
+		SourceHwAddress:   o.Client.Mac[:],
+		SourceProtAddress: []uint8{0x0, 0x0, 0x0, 0x0},
+		DstHwAddress:      []uint8{0x0, 0x0, 0x0, 0x0, 0x0, 0x0},
+		DstProtAddress:    []uint8{0x00, 0x00, 0x00, 0x00}})
+	a.pktTemplate = append(l2, arpHeader...)
+	a.arpHeader = layers.ArpHeader(a.pktTemplate[arpOffset : arpOffset+28])
+}
+
+func (o *PluginDhcpClient) apipaRestartTimer(d time.Duration) {
+	a := &o.apipa
+	if a.timer.IsRunning() {
+		o.timerw.Stop(&a.timer)
+	}
+	o.timerw.Start(&a.timer, d)
+}
+
+// apipaRandDuration returns a random duration in [min, max]
+func (o *PluginDhcpClient) apipaRandDuration(min, max time.Duration) time.Duration {
+	return min + time.Duration(o.apipa.rnd.Int63n(int64(max-min)+1))
+}
+
+// apipaOnDiscoverTimeout is called when a DISCOVER was not answered
+func (o *PluginDhcpClient) apipaOnDiscoverTimeout() {
+	a := &o.apipa
+	if !a.enable || a.state != APIPA_STATE_NONE {
+		return
+	}
+	a.discoverCnt++
+	if a.discoverCnt >= a.retries {
+		o.stats.apipaStart++
+		o.apipaSelect(APIPA_PROBE_WAIT)
+	}
+}
+
+// apipaSelect picks a new candidate address and starts probing it after a random wait up to maxWait
+func (o *PluginDhcpClient) apipaSelect(maxWait time.Duration) {
+	a := &o.apipa
+	o.apipaSetCandidate(nil)
+	var ipv4 core.Ipv4Key
+	for {
+		/* 169.254.1.0 - 169.254.254.255 */
+		ipv4 = core.Ipv4Key{169, 254, uint8(1 + a.rnd.Intn(254)), uint8(a.rnd.Intn(256))}
+		if o.Ns.CLookupByIPv4(&ipv4) == nil {
+			break
+		}
+	}
+	o.apipaSetCandidate(&ipv4)
+	a.state = APIPA_STATE_PROBING
+	a.cnt = 0
+	a.defended = false
+	wait := o.apipaRandDuration(0, maxWait)
+	if a.conflicts >= APIPA_MAX_CONFLICTS {
+		wait = APIPA_RATE_LIMIT_INTERVAL
+	}
+	o.apipaRestartTimer(wait)
+}
+
+// apipaSetCandidate registers the candidate in the namespace for conflict detection, nil to remove it
+func (o *PluginDhcpClient) apipaSetCandidate(ipv4 *core.Ipv4Key) {
+	a := &o.apipa
+	if !a.ipv4.IsZero() {
+		delete(o.dhcpNsPlug.apipa, a.ipv4)
+		a.ipv4.SetUint32(0)
+	}
+	if ipv4 != nil {
+		a.ipv4 = *ipv4
+		o.dhcpNsPlug.apipa[a.ipv4] = o
+	}
+}
+
+func (o *PluginDhcpClient) apipaSendArp(probe bool) {
+	if o.Ns.SuppressTx() {
+		return
+	}
+	a := &o.apipa
+	if probe {
+		o.stats.apipaPktTxProbe++
+		a.arpHeader.SetSrcIpAddress(0)
+	} else {
+		o.stats.apipaPktTxAnnounce++
+		a.arpHeader.SetSrcIpAddress(a.ipv4.Uint32())
+	}
+	a.arpHeader.SetDstIpAddress(a.ipv4.Uint32())
+	o.Tctx.Veth.SendBuffer(false, o.Client, a.pktTemplate)
+}
+
+func (o *PluginDhcpClient) onApipaTimerEvent() {
+	a := &o.apipa
+	switch a.state {
+	case APIPA_STATE_PROBING:
+		if a.cnt < APIPA_PROBE_NUM {
+			a.cnt++
+			o.apipaSendArp(true)
+			if a.cnt < APIPA_PROBE_NUM {
+				o.apipaRestartTimer(o.apipaRandDuration(APIPA_PROBE_MIN, APIPA_PROBE_MAX))
+			} else {
+				o.apipaRestartTimer(APIPA_ANNOUNCE_WAIT)
+			}
+			return
+		}
+		/* no conflict, claim the address */
+		if o.Client.UpdateIPv4(a.ipv4) != nil {
+			o.stats.apipaConflicts++
+			a.conflicts++
+			o.apipaSelect(0)
+			return
+		}
+		o.stats.apipaClaimed++
+		a.state = APIPA_STATE_ANNOUNCING
+		a.cnt = 1
+		o.apipaSendArp(false)
+		o.apipaRestartTimer(APIPA_ANNOUNCE_INTERVAL)
+	case APIPA_STATE_ANNOUNCING:
+		a.cnt++
+		o.apipaSendArp(false)
+		if a.cnt >= APIPA_ANNOUNCE_NUM {
+			a.state = APIPA_STATE_CLAIMED
+		} else {
+			o.apipaRestartTimer(APIPA_ANNOUNCE_INTERVAL)
+		}
+	}
+}
+
+// apipaOnArp checks an ARP packet of the namespace for a conflict with the link-local address
+func (o *PluginDhcpClient) apipaOnArp(rx *core.CArpRx) {
+	a := &o.apipa
+	if rx.SrcMac == o.Client.Mac {
+		return
+	}
+	switch a.state {
+	case APIPA_STATE_PROBING:
+		/* another host uses the address or probes it */
+		if rx.SrcIpv4 == a.ipv4 || (rx.Operation == layers.ARPRequest && rx.SrcIpv4.IsZero() && rx.DstIpv4 == a.ipv4) {
+			o.stats.apipaConflicts++
+			a.conflicts++
+			o.apipaSelect(0)
+		}
+	case APIPA_STATE_ANNOUNCING, APIPA_STATE_CLAIMED:
+		if rx.SrcIpv4 != a.ipv4 {
+			return
+		}
+		o.stats.apipaConflicts++
+		a.conflicts++
+		now := o.timerw.Ticks
+		if !a.defended || now-a.defendTicks >= uint64(o.timerw.DurationToTicks(APIPA_DEFEND_INTERVAL)) {
+			/* defend the address once */
+			o.stats.apipaDefend++
+			a.defended = true
+			a.defendTicks = now
+			o.apipaSendArp(false)
+			return
+		}
+		/* second conflict in the defend interval, give up the address */
+		o.stats.apipaAbandoned++
+		o.Client.UpdateIPv4(core.Ipv4Key{})
+		o.apipaSelect(0)
+	}
+}
+
+// apipaRelease stops using the link-local address, called when DHCP is bound
+func (o *PluginDhcpClient) apipaRelease() {
+	a := &o.apipa
+	a.discoverCnt = 0
+	if a.state == APIPA_STATE_NONE {
+		return
+	}
+	if a.timer.IsRunning() {
+		o.timerw.Stop(&a.timer)
+	}
+	if a.state != APIPA_STATE_PROBING {
+		o.stats.apipaReleased++
+	}
+	a.state = APIPA_STATE_NONE
+	o.apipaSetCandidate(nil)
+}
+
+func (o *PluginDhcpClient) apipaOnRemove() {
+	a := &o.apipa
+	if !a.enable {
+		return
+	}
+	if a.timer.IsRunning() {
+		o.timerw.Stop(&a.timer)
+	}
+	o.apipaSetCandidate(nil)
+}
@@ -9,10 +9,45 @@ package dhcp
 RFC 2131 DHCP client
 
 client inijson {
-	TimerDiscoverSec uint32 `json:"timerd"`
-	TimerOfferSec    uint32 `json:"timero"`
+	TimerDiscoverSec uint32       `json:"timerd"`
+	TimerOfferSec    uint32       `json:"timero"`
+	ClientIdType     string       `json:"client_id_type"`
+	ClientId         string       `json:"client_id"`
+	OfferPolicy      string       `json:"offer_policy"`
+	OfferServerId    core.Ipv4Key `json:"offer_server_id"`
+	OfferWindowMsec  uint32       `json:"offer_window_msec"`
+	Apipa            bool         `json:"apipa"`
+	ApipaRetries     uint32       `json:"apipa_retries"`
+	InitReboot       core.Ipv4Key `json:"init_reboot"`
+	InitRebootRetry  uint32       `json:"init_reboot_retries"`
 }:
 
+client_id_type - the form of option 61 (client-identifier) in DISCOVER/REQUEST
+	"mac"  - hardware type (1) + client MAC, the default
+	"raw"  - the bytes of client_id
+	"none" - omit option 61
+
+client_id - the raw identifier, "{mac}" is replaced by the client MAC in hex (e.g. 000001000001)
+	so a single init json generates a unique identifier per client
+
+offer_policy - which OFFER is answered with a REQUEST
+	"first"         - the first OFFER, no collection window, the default
+	"last"          - the last OFFER received in the window
+	"highest_lease" - the OFFER with the highest lease time in the window
+	"server_id"     - the OFFER of offer_server_id, in case no such OFFER was received in the window DISCOVER is sent again
+
+offer_window_msec - the window for collecting OFFERs, starts with the first OFFER, default 1000 msec
+
+apipa - fall back to an IPv4 link-local address (RFC 3927) in case DHCP fails, see apipa.go
+
+apipa_retries - DISCOVERs without an OFFER before the fallback, default 3
+
+init_reboot - a remembered address, the client starts in INIT-REBOOT (RFC 2131 3.2) with a broadcast REQUEST
+	of it without a server id. ACK confirms the address, NAK moves to INIT
+	also by the dhcp_client_reboot rpc
+
+init_reboot_retries - REQUEST retransmits of INIT-REBOOT without an answer before INIT, default 3
+
 */
 
 import (
@@ -22,8 +57,10 @@ import (
 	"external/google/gopacket"
 	"external/google/gopacket/layers"
 	"external/osamingo/jsonrpc"
+	"fmt"
 	"math/rand"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/intel-go/fastjson"
@@ -39,11 +76,35 @@ const (
 	DHCP_STATE_REBINDING  = 4
 	DHCP_STATE_RENEWING   = 5
 	DHCP_STATE_BOUND      = 6
+
+	/* client-identifier (option 61) form */
+	DHCP_CLIENT_ID_MAC  = "mac"
+	DHCP_CLIENT_ID_RAW  = "raw"
+	DHCP_CLIENT_ID_NONE = "none"
+
+	/* OFFER selection policy */
+	DHCP_OFFER_POLICY_FIRST         = "first"
+	DHCP_OFFER_POLICY_LAST          = "last"
+	DHCP_OFFER_POLICY_HIGHEST_LEASE = "highest_lease"
+	DHCP_OFFER_POLICY_SERVER_ID     = "server_id"
+
+	DHCP_OFFER_WINDOW_MSEC = 1000
+
+	DHCP_INIT_REBOOT_RETRIES = 3 // REQUEST retransmits of INIT-REBOOT before falling back to INIT
 )
 
 type DhcpInit struct {
-	TimerDiscoverSec uint32 `json:"timerd"`
-	TimerOfferSec    uint32 `json:"timero"`
+	TimerDiscoverSec uint32       `json:"timerd"`
+	TimerOfferSec    uint32       `json:"timero"`
+	ClientIdType     string       `json:"client_id_type"`
+	ClientId         string       `json:"client_id"`
+	OfferPolicy      string       `json:"offer_policy"`
+	OfferServerId    core.Ipv4Key `json:"offer_server_id"`
+	OfferWindowMsec  uint32       `json:"offer_window_msec"`
+	Apipa            bool         `json:"apipa"`
+	ApipaRetries     uint32       `json:"apipa_retries"`
+	InitReboot       core.Ipv4Key `json:"init_reboot"`
+	InitRebootRetry  uint32       `json:"init_reboot_retries"`
 }
 
 type DhcpStats struct {
@@ -62,6 +123,27 @@ type DhcpStats struct {
 	pktRxNack        uint64
 	pktRxRebind      uint64
 	pktRxBroadcast   uint64
+
+	pktTxClientIdMac  uint64
+	pktTxClientIdRaw  uint64
+	pktTxClientIdNone uint64
+
+	pktRxOfferIgnored uint64
+	pktRxOfferNoMatch uint64
+
+	apipaStart         uint64
+	apipaPktTxProbe    uint64
+	apipaPktTxAnnounce uint64
+	apipaClaimed       uint64
+	apipaConflicts     uint64
+	apipaDefend        uint64
+	apipaAbandoned     uint64
+	apipaReleased      uint64
+
+	initReboot        uint64
+	initRebootAck     uint64
+	initRebootNak     uint64
+	initRebootTimeout uint64
 }
 
 func NewDhcpStatsDb(o *DhcpStats) *core.CCounterDb {
@@ -184,6 +266,142 @@ func NewDhcpStatsDb(o *DhcpStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScERROR})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxClientIdMac,
+		Name:     "pktTxClientIdMac",
+		Help:     "tx discover/request with hw type + mac client id",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxClientIdRaw,
+		Name:     "pktTxClientIdRaw",
+		Help:     "tx discover/request with raw client id",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxClientIdNone,
+		Name:     "pktTxClientIdNone",
+		Help:     "tx discover/request without client id",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxOfferIgnored,
+		Name:     "pktRxOfferIgnored",
+		Help:     "rx offer that was not selected",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxOfferNoMatch,
+		Name:     "pktRxOfferNoMatch",
+		Help:     "offer window ended without an offer of the server id",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.apipaStart,
+		Name:     "apipaStart",
+		Help:     "fallback to a link-local address, no offer",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.apipaPktTxProbe,
+		Name:     "apipaPktTxProbe",
+		Help:     "tx arp probe of a link-local address",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.apipaPktTxAnnounce,
+		Name:     "apipaPktTxAnnounce",
+		Help:     "tx arp announcement of a link-local address",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.apipaClaimed,
+		Name:     "apipaClaimed",
+		Help:     "link-local addresses claimed",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.apipaConflicts,
+		Name:     "apipaConflicts",
+		Help:     "link-local address conflicts",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.apipaDefend,
+		Name:     "apipaDefend",
+		Help:     "link-local address defended",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.apipaAbandoned,
+		Name:     "apipaAbandoned",
+		Help:     "link-local address given up after a second conflict",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.apipaReleased,
+		Name:     "apipaReleased",
+		Help:     "link-local address released, dhcp is bound",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.initReboot,
+		Name:     "initReboot",
+		Help:     "init-reboot attempts, request of a remembered address",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.initRebootAck,
+		Name:     "initRebootAck",
+		Help:     "init-reboot address confirmed by an ack",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.initRebootNak,
+		Name:     "initRebootNak",
+		Help:     "init-reboot address refused by a nak, back to init",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.initRebootTimeout,
+		Name:     "initRebootTimeout",
+		Help:     "init-reboot without an answer, back to init",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
 	return db
 }
 
@@ -195,6 +413,14 @@ func (o *PluginDhcpClientTimer) OnEvent(a, b interface{}) {
 	pi.onTimerEvent()
 }
 
+// dhcpOffer an OFFER collected in the selecting window
+type dhcpOffer struct {
+	Ipv4      core.Ipv4Key `json:"ipv4"`
+	Server    core.Ipv4Key `json:"server"`
+	ServerMac core.MACKey  `json:"server_mac"`
+	Lease     uint32       `json:"lease"`
+}
+
 //PluginDhcpClient information per client
 type PluginDhcpClient struct {
 	core.PluginBase
@@ -207,6 +433,7 @@ type PluginDhcpClient struct {
 	server                     core.Ipv4Key
 	serverMac                  core.MACKey
 	dg                         core.Ipv4Key
+	dns                        []core.Ipv4Key // resolvers of the last packet, option 6
 	timer                      core.CHTimerObj
 	stats                      DhcpStats
 	cdb                        *core.CCounterDb
@@ -219,8 +446,22 @@ type PluginDhcpClient struct {
 	discoverPktTemplate        []byte
 	requestPktTemplate         []byte
 	requestRenewPktTemplate    []byte
+	rebootPktTemplate          []byte // REQUEST of INIT-REBOOT, no server id
 	l3Offset                   uint16
+	reqIpOffset                uint16 // offset of the requested ip in the request template
 	xid                        uint32
+	clientIdType               string
+	clientId                   string
+	offerPolicy                string
+	offerServerId              core.Ipv4Key
+	offerWindowMsec            uint32
+	offers                     []dhcpOffer // OFFERs of the last DISCOVER
+	selected                   int         // index of the selected offer, -1 if none
+	apipa                      dhcpApipa
+	rebootIpv4                 core.Ipv4Key // remembered address of INIT-REBOOT, zero for a fresh discovery
+	rebootRetries              uint32
+	txStart                    uint64 // ticks of the first packet of the transaction
+	txPkts                     uint32 // packets of the transaction, zero when bound
 }
 
 var dhcpEvents = []string{}
@@ -235,6 +476,31 @@ func NewDhcpClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 	o.RegisterEvents(ctx, dhcpEvents, o) /* register events, only if exits*/
 	nsplg := o.Ns.PluginCtx.GetOrCreate(DHCP_PLUG)
 	o.dhcpNsPlug = nsplg.Ext.(*PluginDhcpNs)
+	o.clientIdType = DHCP_CLIENT_ID_MAC
+	o.offerPolicy = DHCP_OFFER_POLICY_FIRST
+	o.offerWindowMsec = DHCP_OFFER_WINDOW_MSEC
+	o.selected = -1
+	o.rebootRetries = DHCP_INIT_REBOOT_RETRIES
+	if err == nil {
+		o.rebootIpv4 = init.InitReboot
+		if init.InitRebootRetry > 0 {
+			o.rebootRetries = init.InitRebootRetry
+		}
+		switch init.ClientIdType {
+		case DHCP_CLIENT_ID_RAW, DHCP_CLIENT_ID_NONE:
+			o.clientIdType = init.ClientIdType
+		}
+		o.clientId = init.ClientId
+		switch init.OfferPolicy {
+		case DHCP_OFFER_POLICY_LAST, DHCP_OFFER_POLICY_HIGHEST_LEASE, DHCP_OFFER_POLICY_SERVER_ID:
+			o.offerPolicy = init.OfferPolicy
+		}
+		o.offerServerId = init.OfferServerId
+		if init.OfferWindowMsec > 0 {
+			o.offerWindowMsec = init.OfferWindowMsec
+		}
+	}
+	o.apipaInit(init.Apipa, init.ApipaRetries)
 	o.OnCreate()
 
 	if err == nil {
@@ -251,7 +517,7 @@ func NewDhcpClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 }
 
 func (o *PluginDhcpClient) OnCreate() {
-	o.timerw = o.Tctx.GetTimerCtx()
+	o.timerw = o.Ns.GetTimerCtx()
 	o.preparePacketTemplate()
 	o.timerDiscoverRetransmitSec = 5
 	o.timerOfferRetransmitSec = 10
@@ -259,14 +525,56 @@ func (o *PluginDhcpClient) OnCreate() {
 	o.cdbv = core.NewCCounterDbVec("dhcp")
 	o.cdbv.Add(o.cdb)
 	o.timer.SetCB(&o.timerCb, o, 0) // set the callback to OnEvent
-	o.SendDiscover()
+	if !o.rebootIpv4.IsZero() {
+		o.InitReboot(o.rebootIpv4)
+	} else {
+		o.SendDiscover()
+	}
+}
+
+// buildClientId returns the option 61 data, nil in case it should be omitted
+func (o *PluginDhcpClient) buildClientId() []byte {
+	switch o.clientIdType {
+	case DHCP_CLIENT_ID_NONE:
+		return nil
+	case DHCP_CLIENT_ID_RAW:
+		mac := fmt.Sprintf("%x", o.Client.Mac[:])
+		id := []byte(strings.Replace(o.clientId, "{mac}", mac, -1))
+		if len(id) == 0 {
+			return nil
+		}
+		if len(id) > 255 {
+			id = id[:255]
+		}
+		return id
+	default:
+		return append([]byte{1}, o.Client.Mac[:]...)
+	}
+}
+
+// countClientId update the counters of the client-identifier form
+func (o *PluginDhcpClient) countClientId() {
+	switch o.clientIdType {
+	case DHCP_CLIENT_ID_NONE:
+		o.stats.pktTxClientIdNone++
+	case DHCP_CLIENT_ID_RAW:
+		o.stats.pktTxClientIdRaw++
+	default:
+		o.stats.pktTxClientIdMac++
+	}
 }
 
 func (o *PluginDhcpClient) preparePacketTemplate() {
 	l2 := o.Client.GetL2Header(true, uint16(layers.EthernetTypeIPv4))
 	o.l3Offset = uint16(len(l2))
 
-	options := append([]byte{1}, o.Client.Mac[:]...)
+	options := o.buildClientId()
+	/* fixed header + magic + message type option */
+	o.reqIpOffset = 236 + 4 + 3
+	if options != nil {
+		o.reqIpOffset += uint16(len(options)) + 2
+	}
+	o.reqIpOffset += 2
 
 	var xid uint32
 	if !o.Tctx.Simulation {
@@ -287,7 +595,9 @@ func (o *PluginDhcpClient) preparePacketTemplate() {
 		ClientHWAddr: net.HardwareAddr(o.Client.Mac[:]),
 		ServerName:   make([]byte, 64), File: make([]byte, 128)}
 	dhcp.Options = append(dhcp.Options, layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeDiscover)}))
-	dhcp.Options = append(dhcp.Options, layers.NewDHCPOption(layers.DHCPOptClientID, options))
+	if options != nil {
+		dhcp.Options = append(dhcp.Options, layers.NewDHCPOption(layers.DHCPOptClientID, options))
+	}
 	dhcp.Options = append(dhcp.Options, layers.NewDHCPOption(layers.DHCPOptRequestIP, []byte{0, 0, 0, 0}))
 	dhcp.Options = append(dhcp.Options, layers.NewDHCPOption(layers.DHCPOptHostname, []byte{'h', 'o', 's', 't', '-', 't', 'r', 'e', 'x', 's'}))
 	dhcp.Options = append(dhcp.Options, layers.NewDHCPOption(layers.DHCPOptParamsRequest,
@@ -330,7 +640,9 @@ func (o *PluginDhcpClient) preparePacketTemplate() {
 		ClientHWAddr: net.HardwareAddr(o.Client.Mac[:]),
 		ServerName:   make([]byte, 64), File: make([]byte, 128)}
 	dhcpReq.Options = append(dhcpReq.Options, layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeRequest)}))
-	dhcpReq.Options = append(dhcpReq.Options, layers.NewDHCPOption(layers.DHCPOptClientID, options))
+	if options != nil {
+		dhcpReq.Options = append(dhcpReq.Options, layers.NewDHCPOption(layers.DHCPOptClientID, options))
+	}
 	dhcpReq.Options = append(dhcpReq.Options, layers.NewDHCPOption(layers.DHCPOptRequestIP, []byte{0, 0, 0, 0}))
 	dhcpReq.Options = append(dhcpReq.Options, layers.NewDHCPOption(layers.DHCPOptServerID, []byte{0, 0, 0, 0}))
 
@@ -363,6 +675,40 @@ func (o *PluginDhcpClient) preparePacketTemplate() {
 
 	o.requestPktTemplate = append(l2, dr...)
 
+	dhcpReboot := &layers.DHCPv4{Operation: layers.DHCPOpRequest,
+		HardwareType: layers.LinkTypeEthernet,
+		HardwareLen:  6,
+		Xid:          xid,
+		ClientIP:     net.IP{0, 0, 0, 0},
+		YourClientIP: net.IP{0, 0, 0, 0},
+		NextServerIP: net.IP{0, 0, 0, 0},
+		RelayAgentIP: net.IP{0, 0, 0, 0},
+		ClientHWAddr: net.HardwareAddr(o.Client.Mac[:]),
+		ServerName:   make([]byte, 64), File: make([]byte, 128)}
+	dhcpReboot.Options = append(dhcpReboot.Options, layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeRequest)}))
+	if options != nil {
+		dhcpReboot.Options = append(dhcpReboot.Options, layers.NewDHCPOption(layers.DHCPOptClientID, options))
+	}
+	dhcpReboot.Options = append(dhcpReboot.Options, layers.NewDHCPOption(layers.DHCPOptRequestIP, []byte{0, 0, 0, 0}))
+	dhcpReboot.Options = append(dhcpReboot.Options, dhcpReq.Options[len(dhcpReq.Options)-1])
+
+	drb := core.PacketUtlBuild(
+		&layers.IPv4{Version: 4, IHL: 5, TTL: 128, Id: 0xcc,
+			SrcIP:    net.IPv4(0, 0, 0, 0),
+			DstIP:    net.IPv4(255, 255, 255, 255),
+			Protocol: layers.IPProtocolUDP},
+
+		&layers.UDP{SrcPort: 68, DstPort: 67},
+		dhcpReboot,
+	)
+
+	ipv4 = layers.IPv4Header(drb[0:20])
+	ipv4.SetLength(uint16(len(drb)))
+	ipv4.UpdateChecksum()
+	binary.BigEndian.PutUint16(drb[24:26], uint16(len(drb)-20))
+
+	o.rebootPktTemplate = append(l2, drb...)
+
 	dhcpReqRenew := &layers.DHCPv4{Operation: layers.DHCPOpRequest,
 		HardwareType: layers.LinkTypeEthernet,
 		HardwareLen:  6,
@@ -374,7 +720,9 @@ func (o *PluginDhcpClient) preparePacketTemplate() {
 		ClientHWAddr: net.HardwareAddr(o.Client.Mac[:]),
 		ServerName:   make([]byte, 64), File: make([]byte, 128)}
 	dhcpReqRenew.Options = append(dhcpReqRenew.Options, layers.NewDHCPOption(layers.DHCPOptMessageType, []byte{byte(layers.DHCPMsgTypeRequest)}))
-	dhcpReqRenew.Options = append(dhcpReqRenew.Options, layers.NewDHCPOption(layers.DHCPOptClientID, options))
+	if options != nil {
+		dhcpReqRenew.Options = append(dhcpReqRenew.Options, layers.NewDHCPOption(layers.DHCPOptClientID, options))
+	}
 
 	drn := core.PacketUtlBuild(
 		&layers.IPv4{Version: 4, IHL: 5, TTL: 128, Id: 0xcc,
@@ -399,10 +747,17 @@ func (o *PluginDhcpClient) preparePacketTemplate() {
 }
 
 func (o *PluginDhcpClient) SendDiscover() {
+	o.txCount()
 	o.state = DHCP_STATE_INIT
 	o.cnt = 0
+	o.offers = o.offers[:0]
+	o.selected = -1
 	o.restartTimer(o.timerDiscoverRetransmitSec)
+	if o.Ns.SuppressTx() {
+		return
+	}
 	o.stats.pktTxDiscover++
+	o.countClientId()
 	o.Tctx.Veth.SendBuffer(false, o.Client, o.discoverPktTemplate)
 }
 
@@ -411,17 +766,77 @@ func (o *PluginDhcpClient) OnEvent(msg string, a, b interface{}) {
 
 }
 
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginDhcpClient) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
+// txCount counts a packet of the transaction, it starts with the first packet that is not bound
+func (o *PluginDhcpClient) txCount() {
+	if o.txPkts == 0 {
+		o.txStart = o.timerw.Ticks
+	}
+	o.txPkts++
+}
+
+var dhcpStateNames = map[uint8]string{
+	DHCP_STATE_INIT:       "init",
+	DHCP_STATE_REBOOTING:  "rebooting",
+	DHCP_STATE_REQUESTING: "requesting",
+	DHCP_STATE_SELECTING:  "selecting",
+	DHCP_STATE_REBINDING:  "rebinding",
+	DHCP_STATE_RENEWING:   "renewing",
+	DHCP_STATE_BOUND:      "bound",
+}
+
+// GetTransaction implements core.IPluginTransaction
+func (o *PluginDhcpClient) GetTransaction() (core.CTransaction, bool) {
+	if o.state == DHCP_STATE_BOUND || o.txPkts == 0 {
+		return core.CTransaction{}, false
+	}
+	return core.CTransaction{State: dhcpStateNames[o.state], Start: o.txStart, Retransmits: o.txPkts - 1}, true
+}
+
+// ResetTransaction implements core.IPluginTransaction, the client starts over with a new discovery
+func (o *PluginDhcpClient) ResetTransaction() {
+	if o.timer.IsRunning() {
+		o.timerw.Stop(&o.timer)
+	}
+	o.txPkts = 0
+	o.SendDiscover()
+}
+
+// DhcpClientState the lease of the client in ctx_get_state
+type DhcpClientState struct {
+	State  string       `json:"state"`
+	Ipv4   core.Ipv4Key `json:"ipv4"`
+	Server core.Ipv4Key `json:"server"`
+	Dg     core.Ipv4Key `json:"dg"`
+	T1     uint32       `json:"t1"`
+	T2     uint32       `json:"t2"`
+}
+
+// GetState implements core.IPluginState
+func (o *PluginDhcpClient) GetState() interface{} {
+	return &DhcpClientState{State: dhcpStateNames[o.state], Ipv4: o.ipv4, Server: o.server, Dg: o.dg, T1: o.t1, T2: o.t2}
+}
+
 func (o *PluginDhcpClient) OnRemove(ctx *core.PluginCtx) {
 	/* force removing the link to the client */
 	o.SendRenewRebind(false, true, 0)
+	o.Client.SetDhcpDns(nil)
 	ctx.UnregisterEvents(&o.PluginBase, dhcpEvents)
 	// TBD send release message
 	if o.timer.IsRunning() {
 		o.timerw.Stop(&o.timer)
 	}
+	o.apipaOnRemove()
 }
 
 func (o *PluginDhcpClient) SendRenewRebind(rebind bool, release bool, timerSec uint32) {
+	if !release {
+		o.txCount()
+	}
 
 	pkt := o.requestRenewPktTemplate
 
@@ -459,17 +874,21 @@ func (o *PluginDhcpClient) SendRenewRebind(rebind bool, release bool, timerSec u
 	cs := layers.PktChecksumTcpUdp(pkt[ipo+20:], 0, ipv4)
 	binary.BigEndian.PutUint16(pkt[ipo+26:ipo+28], cs)
 
-	o.stats.pktTxRequest++
-
 	o.restartTimer(timerSec)
+	if o.Ns.SuppressTx() {
+		return
+	}
+	o.stats.pktTxRequest++
+	o.countClientId()
 	o.Tctx.Veth.SendBuffer(false, o.Client, pkt)
 }
 
 func (o *PluginDhcpClient) SendReq() {
+	o.txCount()
 	pkt := o.requestPktTemplate
 
 	// offset for the option
-	off := o.l3Offset + 20 + 8 + 254
+	off := o.l3Offset + 20 + 8 + o.reqIpOffset
 	copy(pkt[off:off+4], o.ipv4[:])
 	copy(pkt[off+6:off+10], o.server[:])
 	ipo := o.l3Offset
@@ -479,8 +898,47 @@ func (o *PluginDhcpClient) SendReq() {
 	cs := layers.PktChecksumTcpUdp(pkt[ipo+20:], 0, ipv4)
 	binary.BigEndian.PutUint16(pkt[ipo+26:ipo+28], cs)
 
-	o.stats.pktTxRequest++
 	o.restartTimer(o.timerOfferRetransmitSec)
+	if o.Ns.SuppressTx() {
+		return
+	}
+	o.stats.pktTxRequest++
+	o.countClientId()
+	o.Tctx.Veth.SendBuffer(false, o.Client, pkt)
+}
+
+// InitReboot starts the INIT-REBOOT state (RFC 2131 3.2) with a remembered address, a broadcast
+// REQUEST without a server id. An ACK confirms the address, a NAK or no answer moves to INIT.
+func (o *PluginDhcpClient) InitReboot(ipv4 core.Ipv4Key) {
+	o.stats.initReboot++
+	o.state = DHCP_STATE_REBOOTING
+	o.cnt = 0
+	o.ipv4 = ipv4
+	o.server.SetUint32(0)
+	o.offers = o.offers[:0]
+	o.selected = -1
+	o.sendRebootReq()
+}
+
+func (o *PluginDhcpClient) sendRebootReq() {
+	o.txCount()
+	pkt := o.rebootPktTemplate
+
+	off := o.l3Offset + 20 + 8 + o.reqIpOffset
+	copy(pkt[off:off+4], o.ipv4[:])
+	ipo := o.l3Offset
+	ipv4 := layers.IPv4Header(pkt[ipo : ipo+20])
+
+	binary.BigEndian.PutUint16(pkt[ipo+26:ipo+28], 0)
+	cs := layers.PktChecksumTcpUdp(pkt[ipo+20:], 0, ipv4)
+	binary.BigEndian.PutUint16(pkt[ipo+26:ipo+28], cs)
+
+	o.restartTimer(o.timerDiscoverRetransmitSec)
+	if o.Ns.SuppressTx() {
+		return
+	}
+	o.stats.pktTxRequest++
+	o.countClientId()
 	o.Tctx.Veth.SendBuffer(false, o.Client, pkt)
 }
 
@@ -550,10 +1008,67 @@ func (o *PluginDhcpClient) restartTimer(sec uint32) {
 	if sec == 0 {
 		return
 	}
+	o.restartTimerDuration(time.Duration(sec) * time.Second)
+}
+
+func (o *PluginDhcpClient) restartTimerDuration(d time.Duration) {
 	if o.timer.IsRunning() {
 		o.timerw.Stop(&o.timer)
 	}
-	o.timerw.Start(&o.timer, time.Duration(sec)*time.Second)
+	o.timerw.Start(&o.timer, d)
+}
+
+func (o *PluginDhcpClient) getLeaseInSec(p *layers.DHCPOption) uint32 {
+	if len(p.Data) != 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(p.Data[0:4])
+}
+
+// collectOffer keeps an OFFER in the selecting window, returns true in case it should be requested right away
+func (o *PluginDhcpClient) collectOffer(offer *dhcpOffer) bool {
+	o.offers = append(o.offers, *offer)
+	if o.offerPolicy == DHCP_OFFER_POLICY_SERVER_ID && offer.Server == o.offerServerId {
+		o.selected = len(o.offers) - 1
+		return true
+	}
+	if o.state != DHCP_STATE_SELECTING {
+		o.state = DHCP_STATE_SELECTING
+		o.restartTimerDuration(time.Duration(o.offerWindowMsec) * time.Millisecond)
+	}
+	return false
+}
+
+// selectOffer picks one of the collected OFFERs by the policy, returns -1 if none
+func (o *PluginDhcpClient) selectOffer() int {
+	sel := -1
+	for i := range o.offers {
+		switch o.offerPolicy {
+		case DHCP_OFFER_POLICY_LAST:
+			sel = i
+		case DHCP_OFFER_POLICY_HIGHEST_LEASE:
+			if sel < 0 || o.offers[i].Lease > o.offers[sel].Lease {
+				sel = i
+			}
+		case DHCP_OFFER_POLICY_SERVER_ID:
+			if sel < 0 && o.offers[i].Server == o.offerServerId {
+				sel = i
+			}
+		}
+	}
+	return sel
+}
+
+// requestOffer sends a REQUEST for the selected OFFER
+func (o *PluginDhcpClient) requestOffer(sel int) {
+	offer := &o.offers[sel]
+	o.selected = sel
+	o.ipv4 = offer.Ipv4
+	o.server = offer.Server
+	o.serverMac = offer.ServerMac
+	o.stats.pktRxOfferIgnored += uint64(len(o.offers) - 1)
+	o.state = DHCP_STATE_REQUESTING
+	o.SendReq()
 }
 
 func (o *PluginDhcpClient) getT1InSec(p *layers.DHCPOption) uint32 {
@@ -567,7 +1082,17 @@ func (o *PluginDhcpClient) getT1InSec(p *layers.DHCPOption) uint32 {
 func (o *PluginDhcpClient) onTimerEvent() {
 	switch o.state {
 	case DHCP_STATE_INIT:
+		o.apipaOnDiscoverTimeout()
 		o.SendDiscover()
+	case DHCP_STATE_SELECTING:
+		sel := o.selectOffer()
+		if sel < 0 {
+			o.stats.pktRxOfferIgnored += uint64(len(o.offers))
+			o.stats.pktRxOfferNoMatch++
+			o.SendDiscover()
+		} else {
+			o.requestOffer(sel)
+		}
 	case DHCP_STATE_REQUESTING:
 		o.cnt++
 		if o.cnt > 5 {
@@ -575,6 +1100,14 @@ func (o *PluginDhcpClient) onTimerEvent() {
 		} else {
 			o.SendReq()
 		}
+	case DHCP_STATE_REBOOTING:
+		o.cnt++
+		if uint32(o.cnt) > o.rebootRetries {
+			o.stats.initRebootTimeout++
+			o.SendDiscover()
+		} else {
+			o.sendRebootReq()
+		}
 	case DHCP_STATE_BOUND:
 		o.state = DHCP_STATE_RENEWING
 		o.stats.pktRxRenew++
@@ -587,6 +1120,15 @@ func (o *PluginDhcpClient) onTimerEvent() {
 
 }
 
+// Renew renews the lease before T1 as at T1, it returns false in case the client is not bound
+func (o *PluginDhcpClient) Renew() bool {
+	if o.state != DHCP_STATE_BOUND {
+		return false
+	}
+	o.onTimerEvent()
+	return true
+}
+
 func (o *PluginDhcpClient) HandleAckNak(dhcpmt layers.DHCPMsgType,
 	dhcph *layers.DHCPv4,
 	ipv4 layers.IPv4Header,
@@ -601,6 +1143,8 @@ func (o *PluginDhcpClient) HandleAckNak(dhcpmt layers.DHCPMsgType,
 			return -1
 		}
 		o.state = DHCP_STATE_BOUND
+		o.txPkts = 0
+		o.apipaRelease()
 		if notify {
 			o.stats.pktRxNotify++
 			ipv4addr := ipv4.GetIPDst()
@@ -616,6 +1160,8 @@ func (o *PluginDhcpClient) HandleAckNak(dhcpmt layers.DHCPMsgType,
 					ipv4key.SetUint32(o.server.Uint32())
 				}
 				o.Client.UpdateDgIPv4(ipv4key)
+				// the resolvers are updated by the renewals too
+				o.Client.SetDhcpDns(o.dns)
 			}
 		}
 		o.restartTimer(t1)
@@ -625,6 +1171,7 @@ func (o *PluginDhcpClient) HandleAckNak(dhcpmt layers.DHCPMsgType,
 			o.t2 = o.t1 + 1
 		}
 	case layers.DHCPMsgTypeNak:
+		o.Client.SetDhcpDns(nil)
 		o.SendDiscover()
 	}
 	return 0
@@ -665,15 +1212,17 @@ func (o *PluginDhcpClient) HandleRxDhcpPacket(ps *core.ParserPacketState) int {
 	t1 = 1811
 	t2 = 3200
 	o.dg.SetUint32(0)
+	o.dns = o.dns[:0]
 	var server *core.Ipv4Key
 	server = nil
 	var serverOp core.Ipv4Key
+	var lease uint32
 
 	for _, op := range dhcph.Options {
 		switch op.Type {
 		case layers.DHCPOptServerID:
 			if len(op.Data) == 4 {
-				if o.state == DHCP_STATE_INIT {
+				if o.state == DHCP_STATE_INIT || o.state == DHCP_STATE_SELECTING {
 					copy(o.server[:], op.Data[:])
 				} else {
 					copy(serverOp[:], op.Data[:])
@@ -688,16 +1237,24 @@ func (o *PluginDhcpClient) HandleRxDhcpPacket(ps *core.ParserPacketState) int {
 			if op.Length == 4 {
 				copy(o.dg[:], op.Data[:])
 			}
+		case layers.DHCPOptDNS:
+			for i := 0; i+4 <= len(op.Data); i += 4 {
+				var dns core.Ipv4Key
+				copy(dns[:], op.Data[i:i+4])
+				o.dns = append(o.dns, dns)
+			}
 		case layers.DHCPOptT1:
 			t1 = o.getT1InSec(&op)
 		case layers.DHCPOptT2:
 			t2 = o.getT1InSec(&op)
+		case layers.DHCPOptLeaseTime:
+			lease = o.getLeaseInSec(&op)
 		default:
 		}
 	}
 
 	switch o.state {
-	case DHCP_STATE_INIT:
+	case DHCP_STATE_INIT, DHCP_STATE_SELECTING:
 
 		if dhcpmt == layers.DHCPMsgTypeOffer {
 			o.stats.pktRxOffer++
@@ -706,13 +1263,46 @@ func (o *PluginDhcpClient) HandleRxDhcpPacket(ps *core.ParserPacketState) int {
 			}
 
 			copy(o.serverMac[:], p[6:12])
-			o.state = DHCP_STATE_REQUESTING
-			o.SendReq()
+			if o.offerPolicy == DHCP_OFFER_POLICY_FIRST {
+				o.state = DHCP_STATE_REQUESTING
+				o.SendReq()
+				return 0
+			}
+			offer := dhcpOffer{Ipv4: o.ipv4, Server: o.server, ServerMac: o.serverMac, Lease: lease}
+			if o.collectOffer(&offer) {
+				o.requestOffer(len(o.offers) - 1)
+			}
 			return 0
 		}
 
 	case DHCP_STATE_REQUESTING:
+		if dhcpmt == layers.DHCPMsgTypeOffer {
+			/* late OFFER of another server */
+			o.stats.pktRxOffer++
+			o.stats.pktRxOfferIgnored++
+			return 0
+		}
 		return o.HandleAckNak(dhcpmt, &dhcph, ipv4, t1, t2, true, server)
+	case DHCP_STATE_REBOOTING:
+		switch dhcpmt {
+		case layers.DHCPMsgTypeAck:
+			if server == nil || convert(dhcph.YourClientIP) != o.ipv4 {
+				o.stats.pktRxAck++
+				o.stats.pktRxWrongIP++
+				return -1
+			}
+			o.server = *server
+			copy(o.serverMac[:], p[6:12])
+			if o.HandleAckNak(dhcpmt, &dhcph, ipv4, t1, t2, true, server) == 0 {
+				o.stats.initRebootAck++
+			}
+		case layers.DHCPMsgTypeNak:
+			o.stats.initRebootNak++
+			o.ipv4.SetUint32(0)
+			return o.HandleAckNak(dhcpmt, &dhcph, ipv4, t1, t2, true, server)
+		default:
+			o.stats.pktRxUnhandle++
+		}
 	case DHCP_STATE_BOUND:
 		o.stats.pktRxUnhandle++
 	case DHCP_STATE_RENEWING:
@@ -732,22 +1322,43 @@ func (o *PluginDhcpClient) HandleRxDhcpPacket(ps *core.ParserPacketState) int {
 type PluginDhcpNs struct {
 	core.PluginBase
 	stats DhcpStats
+	apipa map[core.Ipv4Key]*PluginDhcpClient // link-local candidate/claimed addresses
 }
 
+var dhcpNsEvents = []string{core.MSG_ARP_RX}
+
 func NewDhcpNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 
 	o := new(PluginDhcpNs)
 	o.InitPluginBase(ctx, o)
-	o.RegisterEvents(ctx, []string{}, o)
+	o.RegisterEvents(ctx, dhcpNsEvents, o)
+	o.apipa = make(map[core.Ipv4Key]*PluginDhcpClient)
 
 	return &o.PluginBase
 }
 
 func (o *PluginDhcpNs) OnRemove(ctx *core.PluginCtx) {
+	ctx.UnregisterEvents(&o.PluginBase, dhcpNsEvents)
 }
 
 func (o *PluginDhcpNs) OnEvent(msg string, a, b interface{}) {
-
+	switch msg {
+	case core.MSG_ARP_RX:
+		if len(o.apipa) == 0 {
+			return
+		}
+		rx := a.(*core.CArpRx)
+		if c, ok := o.apipa[rx.SrcIpv4]; ok {
+			c.apipaOnArp(rx)
+			return
+		}
+		if rx.SrcIpv4.IsZero() {
+			/* probe of another host */
+			if c, ok := o.apipa[rx.DstIpv4]; ok {
+				c.apipaOnArp(rx)
+			}
+		}
+	}
 }
 
 func (o *PluginDhcpNs) SetTruncated() {
@@ -847,7 +1458,12 @@ func (o PluginDhcpNsReg) NewPlugin(ctx *core.PluginCtx, initJson []byte) *core.P
 /*******************************************/
 /*  RPC commands */
 type (
-	ApiDhcpClientCntHandler struct{}
+	ApiDhcpClientCntHandler    struct{}
+	ApiDhcpClientOffersHandler struct{}
+	ApiDhcpClientRebootHandler struct{} // INIT-REBOOT with the current or a given address
+	ApiDhcpClientRebootParams  struct {
+		Ipv4 core.Ipv4Key `json:"ipv4"` // the address to request, the current address of the client if missing
+	}
 )
 
 func getNs(ctx interface{}, params *fastjson.RawMessage) (*PluginDhcpNs, *jsonrpc.Error) {
@@ -894,6 +1510,53 @@ func (h ApiDhcpClientCntHandler) ServeJSONRPC(ctx interface{}, params *fastjson.
 	return c.cdbv.GeneralCounters(err, tctx, params, &p)
 }
 
+type ApiDhcpClientOffersResult struct {
+	Policy   string        `json:"policy"`
+	Offers   []dhcpOffer   `json:"offers"`
+	Selected *core.Ipv4Key `json:"selected"` // server of the selected offer, null if none was selected
+}
+
+func (h ApiDhcpClientOffersHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	c, err := getClientPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	res := ApiDhcpClientOffersResult{Policy: c.offerPolicy, Offers: make([]dhcpOffer, len(c.offers))}
+	copy(res.Offers, c.offers)
+	if c.selected >= 0 {
+		res.Selected = &c.offers[c.selected].Server
+	}
+	return &res, nil
+}
+
+func (h ApiDhcpClientRebootHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiDhcpClientRebootParams
+	tctx := ctx.(*core.CThreadCtx)
+	c, err := getClientPlugin(ctx, params)
+	if err == nil {
+		err = tctx.UnmarshalValidate(*params, &p)
+	}
+	if err == nil && p.Ipv4.IsZero() {
+		p.Ipv4 = c.ipv4
+		if p.Ipv4.IsZero() {
+			err = fmt.Errorf("client does not have an address to request")
+		}
+	}
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	c.InitReboot(p.Ipv4)
+	return nil, nil
+}
+
 func init() {
 
 	/* register of plugins callbacks for ns,c level  */
@@ -917,7 +1580,9 @@ func init() {
 	  aa - misc
 	*/
 
-	core.RegisterCB("dhcp_client_cnt", ApiDhcpClientCntHandler{}, false) // get counters/meta
+	core.RegisterCB("dhcp_client_cnt", ApiDhcpClientCntHandler{}, false)       // get counters/meta
+	core.RegisterCB("dhcp_client_offers", ApiDhcpClientOffersHandler{}, false) // get the collected offers and the selected server
+	core.RegisterCB("dhcp_client_reboot", ApiDhcpClientRebootHandler{}, false) // INIT-REBOOT, request the remembered address
 
 	/* register callback for rx side*/
 	core.ParserRegister("dhcp", HandleRxDhcpPacket)
@@ -7,6 +7,7 @@ package dhcp
 
 import (
 	"emu/core"
+	_ "emu/plugins/arp"
 	"encoding/binary"
 	"encoding/hex"
 	"external/google/gopacket"
@@ -28,6 +29,8 @@ type DhcpTestBase struct {
 	capture      bool
 	duration     time.Duration
 	clientsToSim int
+	initJson     []byte
+	arp          bool // load the arp plugin, for link-local conflict detection
 	cb           IgmpTestCb
 	cbArg1       interface{}
 	cbArg2       interface{}
@@ -44,7 +47,7 @@ func (o *DhcpTestBase) Run(t *testing.T) {
 	if o.match > 0 {
 		simVeth.match = o.match
 	}
-	tctx, _ := createSimulationEnv(&simrx, o.clientsToSim)
+	tctx, _ := createSimulationEnv(&simrx, o.clientsToSim, o.initJson, o.arp)
 	if o.cb != nil {
 		o.cb(tctx, o)
 	}
@@ -78,7 +81,7 @@ func (o *DhcpTestBase) Run(t *testing.T) {
 
 }
 
-func createSimulationEnv(simRx *core.VethIFSim, num int) (*core.CThreadCtx, *core.CClient) {
+func createSimulationEnv(simRx *core.VethIFSim, num int, initJson []byte, arp bool) (*core.CThreadCtx, *core.CClient) {
 	tctx := core.NewThreadCtx(0, 4510, true, simRx)
 	var key core.CTunnelKey
 	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
@@ -93,7 +96,12 @@ func createSimulationEnv(simRx *core.VethIFSim, num int) (*core.CThreadCtx, *cor
 		dg)
 	ns.AddClient(client)
 	ns.PluginCtx.CreatePlugins([]string{"dhcp"}, [][]byte{})
-	client.PluginCtx.CreatePlugins([]string{"dhcp"}, [][]byte{})
+	client.PluginCtx.CreatePlugins([]string{"dhcp"}, [][]byte{initJson})
+	if arp {
+		ns.PluginCtx.CreatePlugins([]string{"arp"}, [][]byte{})
+		client.PluginCtx.CreatePlugins([]string{"arp"}, [][]byte{[]byte(`{"timer_disable": true}`)})
+		tctx.RegisterParserCb("arp")
+	}
 	ns.Dump()
 	tctx.RegisterParserCb("dhcp")
 
@@ -109,8 +117,11 @@ func createSimulationEnv(simRx *core.VethIFSim, num int) (*core.CThreadCtx, *cor
 type VethIgmpSim struct {
 	DropAll bool
 	cnt     uint8
+	probes  uint8 // link-local probes received
 	match   uint8
 	tctx    *core.CThreadCtx
+	server  net.IP // server of the last request, renew/rebind do not carry it
+	ip      net.IP
 }
 
 func genMbuf(tctx *core.CThreadCtx, pkt []byte) *core.Mbuf {
@@ -130,6 +141,19 @@ func (o *VethIgmpSim) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
 
 	off := 14 + 8 + 20 + 8
 
+	if o.match == 6 && m.PktLen() >= 14+8+28 && binary.BigEndian.Uint16(m.GetData()[20:22]) == uint16(layers.EthernetTypeARP) {
+		/* another host uses the first link-local candidate */
+		arph := layers.ArpHeader(m.GetData()[22:])
+		if arph.GetOperation() == layers.ARPRequest && arph.GetSrcIpAddress() == 0 {
+			o.probes++
+			if o.probes == 1 {
+				mr = genMbuf(o.tctx, generateArpReply(arph.GetDstIpAddress()))
+			}
+		}
+		m.FreeMbuf()
+		return mr
+	}
+
 	if m.PktLen() <= uint32(off) {
 		m.FreeMbuf()
 		return nil
@@ -145,11 +169,19 @@ func (o *VethIgmpSim) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
 
 	var dhcpmt layers.DHCPMsgType
 	dhcpmt = layers.DHCPMsgTypeUnspecified
+	var server net.IP
+	var reqIp net.IP
 
 	for _, o := range dhcph.Options {
 		if o.Type == layers.DHCPOptMessageType {
 			dhcpmt = layers.DHCPMsgType(o.Data[0])
 		}
+		if o.Type == layers.DHCPOptServerID && len(o.Data) == 4 {
+			server = net.IP(append([]byte{}, o.Data...))
+		}
+		if o.Type == layers.DHCPOptRequestIP && len(o.Data) == 4 {
+			reqIp = net.IP(append([]byte{}, o.Data...))
+		}
 	}
 
 	switch o.match {
@@ -175,6 +207,72 @@ func (o *VethIgmpSim) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
 			pkt := GenerateOfferPacket(dhcph.Xid, net.IPv4(16, 0, 0, 1), net.IPv4(16, 0, 0, 2), int(layers.DHCPMsgTypeOffer), true)
 			mr = genMbuf(o.tctx, pkt)
 		}
+	case 4:
+		/* two servers, the second offers a longer lease */
+		if dhcpmt == layers.DHCPMsgTypeDiscover {
+			pkt := GenerateOfferPacketServer(dhcph.Xid, net.IPv4(16, 0, 0, 1), net.IPv4(16, 0, 0, 2), int(layers.DHCPMsgTypeOffer), false, net.IPv4(0xe, 0, 0xe, 0x10), 3600)
+			o.tctx.Veth.OnRx(genMbuf(o.tctx, pkt))
+			pkt = GenerateOfferPacketServer(dhcph.Xid, net.IPv4(16, 0, 0, 11), net.IPv4(16, 0, 0, 3), int(layers.DHCPMsgTypeOffer), false, net.IPv4(0xe, 0, 0xe, 0x11), 7200)
+			mr = genMbuf(o.tctx, pkt)
+		} else {
+			if dhcpmt == layers.DHCPMsgTypeRequest {
+				if server != nil {
+					o.server = server
+					o.ip = reqIp
+				}
+				pkt := GenerateOfferPacketServer(dhcph.Xid, net.IPv4(16, 0, 0, 1), o.ip, int(layers.DHCPMsgTypeAck), false, o.server, 3600)
+				mr = genMbuf(o.tctx, pkt)
+			}
+		}
+	case 7:
+		/* the server is up after 60 sec, the client has a link-local address by then */
+		if o.tctx.GetTimerCtx().Ticks < 600 {
+			break
+		}
+		if dhcpmt == layers.DHCPMsgTypeDiscover {
+			pkt := GenerateOfferPacket(dhcph.Xid, net.IPv4(16, 0, 0, 1), net.IPv4(16, 0, 0, 2), int(layers.DHCPMsgTypeOffer), false)
+			mr = genMbuf(o.tctx, pkt)
+		} else {
+			if dhcpmt == layers.DHCPMsgTypeRequest {
+				pkt := GenerateOfferPacket(dhcph.Xid, net.IPv4(16, 0, 0, 1), net.IPv4(16, 0, 0, 2), int(layers.DHCPMsgTypeAck), false)
+				mr = genMbuf(o.tctx, pkt)
+			}
+		}
+	case 8, 9:
+		/* init-reboot, 8 acks the request of 16.0.0.2 and naks others, 9 does not answer it */
+		if dhcpmt == layers.DHCPMsgTypeDiscover {
+			pkt := GenerateOfferPacket(dhcph.Xid, net.IPv4(16, 0, 0, 1), net.IPv4(16, 0, 0, 2), int(layers.DHCPMsgTypeOffer), false)
+			mr = genMbuf(o.tctx, pkt)
+		} else if dhcpmt == layers.DHCPMsgTypeRequest {
+			dt := layers.DHCPMsgTypeAck
+			if server == nil && reqIp != nil {
+				if o.match == 9 {
+					break
+				}
+				if !reqIp.Equal(net.IPv4(16, 0, 0, 2)) {
+					dt = layers.DHCPMsgTypeNak
+				}
+			}
+			pkt := GenerateOfferPacket(dhcph.Xid, net.IPv4(16, 0, 0, 1), net.IPv4(16, 0, 0, 2), int(dt), false)
+			mr = genMbuf(o.tctx, pkt)
+		}
+	case 5:
+		/* fragmented offer/ack, the last fragment arrives first */
+		var pkt []byte
+		if dhcpmt == layers.DHCPMsgTypeDiscover {
+			pkt = GenerateOfferPacket(dhcph.Xid, net.IPv4(16, 0, 0, 1), net.IPv4(16, 0, 0, 2), int(layers.DHCPMsgTypeOffer), false)
+		} else {
+			if dhcpmt == layers.DHCPMsgTypeRequest {
+				pkt = GenerateOfferPacket(dhcph.Xid, net.IPv4(16, 0, 0, 1), net.IPv4(16, 0, 0, 2), int(layers.DHCPMsgTypeAck), false)
+			}
+		}
+		if pkt != nil {
+			frags := fragmentIpv4(pkt, len(getL2()), 128)
+			for i := len(frags) - 1; i > 0; i-- {
+				o.tctx.Veth.OnRx(genMbuf(o.tctx, frags[i]))
+			}
+			mr = genMbuf(o.tctx, frags[0])
+		}
 	}
 
 	m.FreeMbuf()
@@ -233,6 +331,309 @@ func TestPluginDhcp5(t *testing.T) {
 	a.Run(t)
 }
 
+/*TestPluginDhcp6 - raw client-identifier generated from a template */
+func TestPluginDhcp6(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp6",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     120 * time.Second,
+		clientsToSim: 1,
+		initJson:     []byte(`{"client_id_type": "raw", "client_id": "trex-{mac}"}`),
+	}
+	a.Run(t)
+}
+
+/*TestPluginDhcp7 - no client-identifier */
+func TestPluginDhcp7(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp7",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     120 * time.Second,
+		clientsToSim: 1,
+		initJson:     []byte(`{"client_id_type": "none"}`),
+	}
+	a.Run(t)
+}
+
+/*TestPluginDhcp8 - two offers, request the one with the highest lease */
+func TestPluginDhcp8(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp8",
+		dropAll:      false,
+		monitor:      false,
+		match:        4,
+		capture:      true,
+		duration:     120 * time.Second,
+		clientsToSim: 1,
+		initJson:     []byte(`{"offer_policy": "highest_lease", "offer_window_msec": 500}`),
+	}
+	a.Run(t)
+}
+
+/*TestPluginDhcp9 - two offers, request the one of a specific server, ignore the first */
+func TestPluginDhcp9(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp9",
+		dropAll:      false,
+		monitor:      false,
+		match:        4,
+		capture:      true,
+		duration:     120 * time.Second,
+		clientsToSim: 1,
+		initJson:     []byte(`{"offer_policy": "server_id", "offer_server_id": [14, 0, 14, 17]}`),
+	}
+	a.Run(t)
+}
+
+/*TestPluginDhcp10 - offer and ack are ipv4 fragments, reassembled by the parser */
+func TestPluginDhcp10(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp10",
+		dropAll:      false,
+		monitor:      false,
+		match:        5,
+		capture:      true,
+		duration:     120 * time.Second,
+		clientsToSim: 1,
+	}
+	a.Run(t)
+}
+
+/*TestPluginDhcp11 - no server, fallback to a link-local address, the first candidate is in use */
+func TestPluginDhcp11(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp11",
+		dropAll:      false,
+		monitor:      false,
+		match:        6,
+		capture:      true,
+		duration:     60 * time.Second,
+		clientsToSim: 1,
+		initJson:     []byte(`{"apipa": true}`),
+		arp:          true,
+	}
+	a.Run(t)
+}
+
+/*TestPluginDhcp12 - link-local address is released once the server is up */
+func TestPluginDhcp12(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp12",
+		dropAll:      false,
+		monitor:      false,
+		match:        7,
+		capture:      true,
+		duration:     120 * time.Second,
+		clientsToSim: 1,
+		initJson:     []byte(`{"apipa": true, "apipa_retries": 2}`),
+		arp:          true,
+	}
+	a.Run(t)
+}
+
+/*generateArpReply - reply of another host that owns ipv4 */
+type DhcpRebootCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+}
+
+func (o *DhcpRebootCtx) OnEvent(a, b interface{}) {
+	o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+	"method":"dhcp_client_reboot",
+	"params": {"tun": {"vport":1,"tci":[1,2]}, "mac": [0, 0, 1, 0, 0, 1] },
+	"id": 3 }`))
+	o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+	"method":"dhcp_client_cnt",
+	"params": {"tun": {"vport":1,"tci":[1,2]}, "mac": [0, 0, 1, 0, 0, 1], "meta": false, "zero": false },
+	"id": 3 }`))
+}
+
+func rpcQueueReboot(tctx *core.CThreadCtx, test *DhcpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(test.cbArg1.(time.Duration))
+	var rpcctx DhcpRebootCtx
+	rpcctx.timer.SetCB(&rpcctx, test.cbArg1, test.cbArg2)
+	rpcctx.tctx = tctx
+	timerw.StartTicks(&rpcctx.timer, ticks)
+	return 0
+}
+
+/*TestPluginDhcp13 - init-reboot of a remembered address that is confirmed, again by rpc once bound */
+func TestPluginDhcp13(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp13",
+		dropAll:      false,
+		monitor:      false,
+		match:        8,
+		capture:      true,
+		duration:     20 * time.Second,
+		clientsToSim: 1,
+		initJson:     []byte(`{"init_reboot": [16, 0, 0, 2]}`),
+		cb:           rpcQueueReboot,
+		cbArg1:       5 * time.Second,
+	}
+	a.Run(t)
+}
+
+/*TestPluginDhcp14 - init-reboot of an address that is refused, a fresh discovery follows */
+func TestPluginDhcp14(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp14",
+		dropAll:      false,
+		monitor:      false,
+		match:        8,
+		capture:      true,
+		duration:     20 * time.Second,
+		clientsToSim: 1,
+		initJson:     []byte(`{"init_reboot": [16, 0, 0, 9]}`),
+	}
+	a.Run(t)
+}
+
+/*TestPluginDhcp15 - init-reboot without an answer, a fresh discovery after the retransmits */
+func TestPluginDhcp15(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp15",
+		dropAll:      false,
+		monitor:      false,
+		match:        9,
+		capture:      true,
+		duration:     30 * time.Second,
+		clientsToSim: 1,
+		initJson:     []byte(`{"init_reboot": [16, 0, 0, 2], "init_reboot_retries": 2}`),
+	}
+	a.Run(t)
+}
+
+type DhcpRestartCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   int
+}
+
+func (o *DhcpRestartCtx) OnEvent(a, b interface{}) {
+	if o.cnt == 0 {
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_restart",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "spread_msec": 500 },
+		"id": 3 }`))
+		timerw := o.tctx.GetTimerCtx()
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(2*time.Second))
+	} else {
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_client_restart_status",
+		"params": {"tun": {"vport":1,"tci":[1,2]} },
+		"id": 3 }`))
+	}
+	o.cnt++
+}
+
+func rpcQueueRestart(tctx *core.CThreadCtx, test *DhcpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(test.cbArg1.(time.Duration))
+	var rpcctx DhcpRestartCtx
+	rpcctx.timer.SetCB(&rpcctx, test.cbArg1, test.cbArg2)
+	rpcctx.tctx = tctx
+	timerw.StartTicks(&rpcctx.timer, ticks)
+	return 0
+}
+
+/*TestPluginDhcp16 - the bound client is restarted, it runs the discovery again and converges */
+func TestPluginDhcp16(t *testing.T) {
+	a := &DhcpTestBase{
+		testname:     "dhcp16",
+		dropAll:      false,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     20 * time.Second,
+		clientsToSim: 1,
+		cb:           rpcQueueRestart,
+		cbArg1:       10 * time.Second,
+	}
+	a.Run(t)
+}
+
+/*TestPluginDhcpStuck - the server does not answer, the discovery is found stuck and reset */
+func TestPluginDhcpStuck(t *testing.T) {
+	var simVeth VethIgmpSim
+	simVeth.DropAll = true
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, 1, nil, false)
+	defer tctx.Delete()
+	simVeth.tctx = tctx
+	tctx.MainLoopSim(22 * time.Second) // discover every 5 sec
+
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := tctx.GetNs(&key)
+	f := core.CStuckFilter{Retransmits: 5}
+	if len(ns.FindStuckTransactions(&f)) != 0 {
+		t.Fatalf(" transaction should not be stuck yet \n")
+	}
+	f.Retransmits = 4
+	r := ns.FindStuckTransactions(&f)
+	if len(r) != 1 || r[0].Plugin != DHCP_PLUG || r[0].State != "init" || r[0].AgeMsec < 20000 {
+		t.Fatalf(" bad stuck transactions %+v \n", r)
+	}
+	r = ns.ResetStuckTransactions(&core.CStuckFilter{AgeMsec: 15000}, nil)
+	if len(r) != 1 || r[0].Mac != (core.MACKey{0, 0, 1, 0, 0, 1}) {
+		t.Fatalf(" transaction should be reset %+v \n", r)
+	}
+	if len(ns.FindStuckTransactions(&f)) != 0 {
+		t.Fatalf(" transaction should start over \n")
+	}
+}
+
+func generateArpReply(ipv4 uint32) []byte {
+	var ip core.Ipv4Key
+	ip.SetUint32(ipv4)
+	arp := core.PacketUtlBuild(&layers.ARP{
+		AddrType:          0x1,
+		Protocol:          0x800,
+		HwAddressSize:     0x6,
+		ProtAddressSize:   0x4,
+		Operation:         layers.ARPReply,
+		SourceHwAddress:   []byte{0, 0, 2, 0, 0, 0x99},
+		SourceProtAddress: ip[:],
+		DstHwAddress:      []byte{0, 0, 1, 0, 0, 1},
+		DstProtAddress:    []byte{0, 0, 0, 0}})
+	l2 := getL2()
+	binary.BigEndian.PutUint16(l2[20:22], uint16(layers.EthernetTypeARP))
+	return append(l2, arp...)
+}
+
+/*fragmentIpv4 - split an ipv4 packet into fragments with size bytes of payload */
+func fragmentIpv4(pkt []byte, l3 int, size int) [][]byte {
+	var frags [][]byte
+	ipv4 := layers.IPv4Header(pkt[l3 : l3+20])
+	hdr := int(ipv4.GetHeaderLen())
+	payload := pkt[l3+hdr : l3+int(ipv4.GetLength())]
+	for off := 0; off < len(payload); off += size {
+		end := off + size
+		more := uint16(0x2000)
+		if end >= len(payload) {
+			end = len(payload)
+			more = 0
+		}
+		f := append([]byte{}, pkt[:l3+hdr]...)
+		f = append(f, payload[off:end]...)
+		fh := layers.IPv4Header(f[l3 : l3+hdr])
+		fh.SetLength(uint16(hdr + end - off))
+		binary.BigEndian.PutUint16(f[l3+6:l3+8], more|uint16(off>>3))
+		fh.UpdateChecksum()
+		frags = append(frags, f)
+	}
+	return frags
+}
+
 func getL2() []byte {
 	l2 := []byte{0, 0, 1, 0, 0, 1, 0, 0, 1, 0, 0, 2, 0x81, 00, 0x00, 0x01, 0x81, 00, 0x00, 0x02, 0x08, 00}
 	return l2
@@ -244,6 +645,13 @@ func getL2B() []byte {
 }
 
 func GenerateOfferPacket(xid uint32, src net.IP, dst net.IP, dt int, broadcast bool) []byte {
+	return GenerateOfferPacketServer(xid, src, dst, dt, broadcast, net.IPv4(0xe, 0, 0xe, 0x10), 3600)
+}
+
+/*GenerateOfferPacketServer - offer/ack of a specific server id and lease time */
+func GenerateOfferPacketServer(xid uint32, src net.IP, dst net.IP, dt int, broadcast bool, server net.IP, lease uint32) []byte {
+	leaseData := make([]byte, 4)
+	binary.BigEndian.PutUint32(leaseData, lease)
 
 	dhcpOffer := &layers.DHCPv4{Operation: layers.DHCPOpReply,
 		HardwareType: layers.LinkTypeEthernet,
@@ -259,8 +667,8 @@ func GenerateOfferPacket(xid uint32, src net.IP, dst net.IP, dt int, broadcast b
 	dhcpOffer.Options = append(dhcpOffer.Options, layers.NewDHCPOption(layers.DHCPOptSubnetMask, []byte{255, 255, 255, 0}))
 	dhcpOffer.Options = append(dhcpOffer.Options, layers.NewDHCPOption(layers.DHCPOptT1, []byte{0, 0, 0, 8}))
 	dhcpOffer.Options = append(dhcpOffer.Options, layers.NewDHCPOption(layers.DHCPOptT2, []byte{0, 0, 0, 10}))
-	dhcpOffer.Options = append(dhcpOffer.Options, layers.NewDHCPOption(layers.DHCPOptLeaseTime, []byte{0, 0, 0xe, 0x10}))
-	dhcpOffer.Options = append(dhcpOffer.Options, layers.NewDHCPOption(layers.DHCPOptServerID, []byte{0xe, 0, 0xe, 0x10}))
+	dhcpOffer.Options = append(dhcpOffer.Options, layers.NewDHCPOption(layers.DHCPOptLeaseTime, leaseData))
+	dhcpOffer.Options = append(dhcpOffer.Options, layers.NewDHCPOption(layers.DHCPOptServerID, []byte(server.To4())))
 
 	dr := core.PacketUtlBuild(
 		&layers.IPv4{Version: 4, IHL: 5, TTL: 128, Id: 0xcc,
@@ -13,6 +13,10 @@ client inijson {
 	TimerOfferSec    uint32 `json:"timero"`
 }:
 
+On a link change (MSG_LINK_UP, ctx_client_link_up rpc) a client with an address sends CONFIRM
+(RFC 8415 18.2.3) instead of a new SOLICIT. A REPLY with success keeps the address, NotOnLink
+restarts the client with SOLICIT and no REPLY in CNF_MAX_RD keeps the address.
+
 */
 
 import (
@@ -39,6 +43,7 @@ const (
 	DHCP_STATE_REBINDING   = 4
 	DHCP_STATE_RENEWING    = 5
 	DHCP_STATE_BOUND       = 6
+	DHCP_STATE_CONFIRMING  = 7
 	IPV6_HEADER_SIZE       = 40
 	STATUS_Success         = 0
 	STATUS_UnspecFail      = 1
@@ -50,6 +55,9 @@ const (
 	REQ_MAX_RC             = 10 /* Max Request retry attempts */
 	DEFAULT_TIMEOUT_T1_SEC = 1800
 	DEFAULT_TIMEOUT_T2_SEC = 3600
+	CNF_TIMEOUT_SEC        = 1  /* Initial Confirm timeout */
+	CNF_MAX_RT_SEC         = 4  /* Max Confirm timeout */
+	CNF_MAX_RD_SEC         = 10 /* Max Confirm duration */
 )
 
 type DhcpInit struct {
@@ -85,6 +93,12 @@ type DhcpStats struct {
 	pktRxNotify   uint64
 	pktRxRenew    uint64
 	pktRxRebind   uint64
+
+	pktTxConfirm     uint64
+	confirmOk        uint64
+	confirmNotOnLink uint64
+	confirmFail      uint64
+	confirmTimeout   uint64
 }
 
 func NewDhcpStatsDb(o *DhcpStats) *core.CCounterDb {
@@ -286,6 +300,46 @@ func NewDhcpStatsDb(o *DhcpStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScERROR})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxConfirm,
+		Name:     "pktTxConfirm",
+		Help:     "tx confirm after a link change",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.confirmOk,
+		Name:     "confirmOk",
+		Help:     "confirm, the address is valid on the link",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.confirmNotOnLink,
+		Name:     "confirmNotOnLink",
+		Help:     "confirm, not on link, restart with solicit",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.confirmFail,
+		Name:     "confirmFail",
+		Help:     "confirm, other status, the address is kept",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.confirmTimeout,
+		Name:     "confirmTimeout",
+		Help:     "confirm without a reply, the address is kept",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
 	return db
 }
 
@@ -327,9 +381,12 @@ type PluginDhcpClient struct {
 	iaid                       uint32
 	serverOption               []byte
 	pktIana                    layers.DHCPv6OptionIANA
+	cnfTimeoutSec              uint32 // retransmit timeout of CONFIRM, doubled up to CNF_MAX_RT_SEC
+	txStart                    uint64 // ticks of the first packet of the transaction
+	txPkts                     uint32 // packets of the transaction, zero when bound
 }
 
-var dhcpEvents = []string{}
+var dhcpEvents = []string{core.MSG_LINK_UP}
 
 /*NewDhcpClient create plugin */
 func NewDhcpClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
@@ -357,7 +414,7 @@ func NewDhcpClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 }
 
 func (o *PluginDhcpClient) OnCreate() {
-	o.timerw = o.Tctx.GetTimerCtx()
+	o.timerw = o.Ns.GetTimerCtx()
 
 	// build local source ipv6
 	o.srcIpv6 = make(net.IP, net.IPv6len)
@@ -469,6 +526,10 @@ func (o *PluginDhcpClient) SendDhcpPacket(
 	msgType byte,
 	serverOption bool) {
 
+	if o.Ns.SuppressTx() {
+		return
+	}
+
 	var msec uint32
 	msec = uint32(o.timerw.Ticks-o.ticksStart) * o.timerw.MinTickMsec()
 
@@ -506,6 +567,7 @@ func (o *PluginDhcpClient) SendDhcpPacket(
 }
 
 func (o *PluginDhcpClient) SendDiscover() {
+	o.txCount()
 	o.state = DHCP_STATE_INIT
 	o.cnt = 0
 	o.restartTimer(o.timerDiscoverRetransmitSec)
@@ -515,7 +577,172 @@ func (o *PluginDhcpClient) SendDiscover() {
 
 /*OnEvent support event change of IP  */
 func (o *PluginDhcpClient) OnEvent(msg string, a, b interface{}) {
+	switch msg {
+	case core.MSG_LINK_UP:
+		o.onLinkUp()
+	}
+}
+
+// onLinkUp a client with an address confirms it is still valid on the link, a client without
+// an address goes on with the solicit
+func (o *PluginDhcpClient) onLinkUp() {
+	switch o.state {
+	case DHCP_STATE_BOUND, DHCP_STATE_RENEWING, DHCP_STATE_REBINDING, DHCP_STATE_CONFIRMING:
+		if !o.Client.Dhcpv6.IsZero() {
+			o.SendConfirm()
+		}
+	}
+}
+
+// SendConfirm starts the CONFIRM of the address of the client (RFC 8415 18.2.3)
+func (o *PluginDhcpClient) SendConfirm() {
+	o.resetTransactionTimer()
+	o.state = DHCP_STATE_CONFIRMING
+	o.cnt = 0
+	o.cnfTimeoutSec = CNF_TIMEOUT_SEC
+	o.restartTimer(o.cnfTimeoutSec)
+	o.sendConfirmPacket()
+}
+
+// sendConfirmPacket sends CONFIRM with the address of the client, no server id and zero lifetimes
+func (o *PluginDhcpClient) sendConfirmPacket() {
+	o.txCount()
+	o.stats.pktTxConfirm++
+	if o.Ns.SuppressTx() {
+		return
+	}
+
+	msec := uint32(o.timerw.Ticks-o.ticksStart) * o.timerw.MinTickMsec()
+	elapsed := []byte{0, 0}
+	binary.BigEndian.PutUint16(elapsed, uint16(msec/10))
+
+	dhcp := &layers.DHCPv6{MsgType: layers.DHCPv6MsgTypeConfirm,
+		TransactionID: []byte{(byte((o.xid >> 16) & 0xff)), byte(((o.xid & 0xff00) >> 8)), byte(o.xid & 0xff)}}
+	dhcp.Options = append(dhcp.Options, layers.NewDHCPv6Option(layers.DHCPv6OptClientID, o.cid))
+	dhcp.Options = append(dhcp.Options, layers.NewDHCPv6Option(layers.DHCPv6OptElapsedTime, elapsed))
+
+	// IA_NA, T1/T2 and the lifetimes of the address are zero
+	ianao := make([]byte, 12+4+24)
+	binary.BigEndian.PutUint32(ianao[0:4], o.iaid)
+	binary.BigEndian.PutUint16(ianao[12:14], uint16(layers.DHCPv6OptIAAddr))
+	binary.BigEndian.PutUint16(ianao[14:16], 24)
+	copy(ianao[16:32], o.Client.Dhcpv6[:])
+	dhcp.Options = append(dhcp.Options, layers.NewDHCPv6Option(layers.DHCPv6OptIANA, ianao))
+
+	l2 := o.Client.GetL2Header(true, uint16(layers.EthernetTypeIPv6))
+	p := o.buildPacket(l2, dhcp)
+	m := o.Ns.AllocMbuf(uint16(len(p)))
+	m.Append(p)
+	o.Tctx.Veth.Send(m)
+}
+
+// onConfirmTimeout retransmits CONFIRM, in case there is no reply in CNF_MAX_RD_SEC the client
+// keeps its address
+func (o *PluginDhcpClient) onConfirmTimeout() {
+	elapsedSec := uint32(o.timerw.Ticks-o.ticksStart) * o.timerw.MinTickMsec() / 1000
+	if elapsedSec >= CNF_MAX_RD_SEC {
+		o.stats.confirmTimeout++
+		o.confirmDone()
+		return
+	}
+	o.cnfTimeoutSec *= 2
+	if o.cnfTimeoutSec > CNF_MAX_RT_SEC {
+		o.cnfTimeoutSec = CNF_MAX_RT_SEC
+	}
+	o.restartTimer(o.cnfTimeoutSec)
+	o.sendConfirmPacket()
+}
+
+// confirmDone the client keeps its address, back to bound with a new renew time
+func (o *PluginDhcpClient) confirmDone() {
+	o.state = DHCP_STATE_BOUND
+	o.txPkts = 0
+	o.cnt = 0
+	o.restartTimer(o.t1)
+}
+
+// HandleConfirmReply the reply of the server to CONFIRM, NotOnLink restarts the client with
+// solicit, the other status codes keep the address
+func (o *PluginDhcpClient) HandleConfirmReply(dhcpmt layers.DHCPv6MsgType, status uint16) int {
+	if dhcpmt != layers.DHCPv6MsgTypeReply {
+		o.stats.pktRxUnhandle++
+		return -1
+	}
 
+	switch status {
+	case STATUS_Success:
+		o.stats.confirmOk++
+	case STATUS_NotOnLink:
+		o.stats.confirmNotOnLink++
+		o.sid = o.sid[:0]
+		o.Client.UpdateDIPv6(core.Ipv6Key{})
+		o.resetTransactionTimer()
+		o.SendDiscover()
+		return 0
+	default:
+		o.stats.confirmFail++
+	}
+	o.confirmDone()
+	return 0
+}
+
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginDhcpClient) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
+// txCount counts a packet of the transaction, it starts with the first packet that is not bound
+func (o *PluginDhcpClient) txCount() {
+	if o.txPkts == 0 {
+		o.txStart = o.timerw.Ticks
+	}
+	o.txPkts++
+}
+
+var dhcpStateNames = map[uint8]string{
+	DHCP_STATE_INIT:       "init",
+	DHCP_STATE_REBOOTING:  "rebooting",
+	DHCP_STATE_REQUESTING: "requesting",
+	DHCP_STATE_SELECTING:  "selecting",
+	DHCP_STATE_REBINDING:  "rebinding",
+	DHCP_STATE_RENEWING:   "renewing",
+	DHCP_STATE_BOUND:      "bound",
+	DHCP_STATE_CONFIRMING: "confirming",
+}
+
+// GetTransaction implements core.IPluginTransaction
+func (o *PluginDhcpClient) GetTransaction() (core.CTransaction, bool) {
+	if o.state == DHCP_STATE_BOUND || o.txPkts == 0 {
+		return core.CTransaction{}, false
+	}
+	return core.CTransaction{State: dhcpStateNames[o.state], Start: o.txStart, Retransmits: o.txPkts - 1}, true
+}
+
+// ResetTransaction implements core.IPluginTransaction, the client starts over with a new solicit
+func (o *PluginDhcpClient) ResetTransaction() {
+	if o.timer.IsRunning() {
+		o.timerw.Stop(&o.timer)
+	}
+	o.txPkts = 0
+	o.sid = o.sid[:0]
+	o.resetTransactionTimer()
+	o.SendDiscover()
+}
+
+// DhcpClientState the lease of the client in ctx_get_state
+type DhcpClientState struct {
+	State  string       `json:"state"`
+	Ipv6   core.Ipv6Key `json:"ipv6"`
+	Server core.Ipv6Key `json:"server"`
+	T1     uint32       `json:"t1"`
+	T2     uint32       `json:"t2"`
+}
+
+// GetState implements core.IPluginState
+func (o *PluginDhcpClient) GetState() interface{} {
+	r := &DhcpClientState{State: dhcpStateNames[o.state], Ipv6: o.Client.Dhcpv6, T1: o.t1, T2: o.t2}
+	copy(r.Server[:], o.sipv6.To16())
+	return r
 }
 
 func (o *PluginDhcpClient) OnRemove(ctx *core.PluginCtx) {
@@ -528,6 +755,9 @@ func (o *PluginDhcpClient) OnRemove(ctx *core.PluginCtx) {
 }
 
 func (o *PluginDhcpClient) SendRenewRebind(rebind bool, release bool, timerSec uint32) {
+	if !release {
+		o.txCount()
+	}
 
 	o.stats.pktTxRequest++
 	o.restartTimer(timerSec)
@@ -545,6 +775,7 @@ func (o *PluginDhcpClient) SendRenewRebind(rebind bool, release bool, timerSec u
 }
 
 func (o *PluginDhcpClient) SendReq() {
+	o.txCount()
 
 	o.restartTimer(o.timerOfferRetransmitSec)
 	o.SendDhcpPacket(byte(layers.DHCPv6MsgTypeRequest), true)
@@ -568,8 +799,8 @@ func (o *PluginDhcpClient) verifyPkt(dhcph *layers.DHCPv6,
 ) int {
 
 	var verifysid bool
-	if o.state != DHCP_STATE_INIT {
-		verifysid = true
+	if o.state != DHCP_STATE_INIT && o.state != DHCP_STATE_CONFIRMING {
+		verifysid = true // any server could answer CONFIRM
 	}
 
 	if XidToUint32(dhcph.TransactionID) != o.xid {
@@ -584,7 +815,7 @@ func (o *PluginDhcpClient) verifyPkt(dhcph *layers.DHCPv6,
 		return -1
 	}
 
-	if !validiana {
+	if !validiana && o.state != DHCP_STATE_CONFIRMING {
 		o.stats.pktRxNoIANA++
 		return -1
 		if o.pktIana.IAID != o.iaid {
@@ -632,6 +863,10 @@ func (o *PluginDhcpClient) restartTimer(sec uint32) {
 
 //onTimerEvent on timer event callback
 func (o *PluginDhcpClient) onTimerEvent() {
+	if o.state == DHCP_STATE_CONFIRMING {
+		o.onConfirmTimeout()
+		return
+	}
 	o.cnt++
 
 	if o.cnt > REQ_MAX_RC {
@@ -688,6 +923,7 @@ func (o *PluginDhcpClient) HandleAckNak(dhcpmt layers.DHCPv6MsgType,
 	case layers.DHCPv6MsgTypeReply:
 		o.stats.pktRxAck++
 		o.state = DHCP_STATE_BOUND
+		o.txPkts = 0
 		if notify {
 			o.stats.pktRxNotify++
 			var NewIpv6 core.Ipv6Key
@@ -755,7 +991,7 @@ func (o *PluginDhcpClient) HandleRxDhcpPacket(ps *core.ParserPacketState) int {
 				validiana = true
 			}
 		case layers.DHCPv6OptStatusCode:
-			if len(op.Data) == 2 {
+			if len(op.Data) >= 2 { // the code and an optional message
 				status = binary.BigEndian.Uint16(op.Data[0:2])
 			} else {
 				status = STATUS_UnspecFail
@@ -823,6 +1059,9 @@ func (o *PluginDhcpClient) HandleRxDhcpPacket(ps *core.ParserPacketState) int {
 	case DHCP_STATE_REBINDING:
 		return o.HandleAckNak(dhcpmt, &dhcph, ipv6, true, status)
 
+	case DHCP_STATE_CONFIRMING:
+		return o.HandleConfirmReply(dhcpmt, status)
+
 	default:
 		o.stats.pktRxUnhandle++
 	}
@@ -161,6 +161,19 @@ func (o *VethIgmpSim) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
 
 	xid := XidToUint32(dhcph.TransactionID)
 	switch o.match {
+	case 3, 4, 5:
+		// confirm after the link up, success, not on link or no reply
+		if dhcpmt == layers.DHCPv6MsgTypeConfirm {
+			if o.match != 5 {
+				status := uint16(STATUS_Success)
+				if o.match == 4 {
+					status = STATUS_NotOnLink
+				}
+				mr = genMbuf(o.tctx, GenerateConfirmReplyPacket(xid, src, dst, status))
+			}
+			break
+		}
+		fallthrough
 	case 0:
 		if dhcpmt == layers.DHCPv6MsgTypeSolicit {
 			pkt := GenerateOfferPacket(xid, src, dst, int(layers.DHCPv6MsgTypeAdverstise))
@@ -248,6 +261,26 @@ func GenerateOfferPacket(xid uint32, src net.IP, dst net.IP, dt int) []byte {
 	dhcp.Options = append(dhcp.Options, layers.NewDHCPv6Option(layers.DHCPv6OptElapsedTime, []byte{0x00, 0x00}))
 	dhcp.Options = append(dhcp.Options, layers.NewDHCPv6Option(layers.DHCPv6OptServerID, []byte{0x00, 0x01, 0x00, 0x01, 0x21, 0x54, 0xee, 0xe7, 0x00, 0x0c, 0x29, 0x70, 0x3d, 0xd8}))
 
+	return buildServerPacket(dhcp, src, dst)
+}
+
+// GenerateConfirmReplyPacket the reply to confirm, no IA_NA, the status has a message
+func GenerateConfirmReplyPacket(xid uint32, src net.IP, dst net.IP, status uint16) []byte {
+
+	dhcp := &layers.DHCPv6{MsgType: layers.DHCPv6MsgTypeReply,
+		TransactionID: []byte{(byte((xid & 0xff0000) >> 16)), byte((xid & 0xff00) >> 8), byte(xid & 0xff)}}
+
+	clientid := &layers.DHCPv6DUID{Type: layers.DHCPv6DUIDTypeLL, HardwareType: []byte{0, 1}, LinkLayerAddress: []byte{0, 0, 1, 0, 0, 1}}
+	dhcp.Options = append(dhcp.Options, layers.NewDHCPv6Option(layers.DHCPv6OptClientID, clientid.Encode()))
+	dhcp.Options = append(dhcp.Options, layers.NewDHCPv6Option(layers.DHCPv6OptServerID, []byte{0x00, 0x01, 0x00, 0x01, 0x21, 0x54, 0xee, 0xe7, 0x00, 0x0c, 0x29, 0x70, 0x3d, 0xd8}))
+	dhcp.Options = append(dhcp.Options, layers.NewDHCPv6Option(layers.DHCPv6OptStatusCode,
+		append([]byte{byte(status >> 8), byte(status & 0xff)}, "confirm"...)))
+
+	return buildServerPacket(dhcp, src, dst)
+}
+
+func buildServerPacket(dhcp *layers.DHCPv6, src net.IP, dst net.IP) []byte {
+
 	ipv6pkt := core.PacketUtlBuild(
 
 		&layers.IPv6{
@@ -285,6 +318,78 @@ func GenerateOfferPacket(xid uint32, src net.IP, dst net.IP, dt int) []byte {
 	return p
 }
 
+type DhcpLinkUpCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+}
+
+func (o *DhcpLinkUpCtx) OnEvent(a, b interface{}) {
+	o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+	"method":"ctx_client_link_up",
+	"params": {"tun": {"vport":1,"tci":[1,2]}, "macs": [[0,0,1,0,0,1]] },
+	"id": 3 }`))
+}
+
+// runLinkUp the bound client gets a link up after 10 sec
+func runLinkUp(match uint8, duration time.Duration) (*core.CThreadCtx, *PluginDhcpClient) {
+	var simVeth VethIgmpSim
+	simVeth.match = match
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, 1)
+	simVeth.tctx = tctx
+
+	var rpcctx DhcpLinkUpCtx
+	rpcctx.tctx = tctx
+	rpcctx.timer.SetCB(&rpcctx, nil, nil)
+	timerw := tctx.GetTimerCtx()
+	timerw.StartTicks(&rpcctx.timer, timerw.DurationToTicks(10*time.Second))
+	tctx.MainLoopSim(duration)
+
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	c := tctx.GetNs(&key).CLookupByMac(&core.MACKey{0, 0, 1, 0, 0, 1})
+	plug := c.PluginCtx.Get(DHCPV6_PLUG).Ext.(*PluginDhcpClient)
+	plug.cdbv.Dump()
+	return tctx, plug
+}
+
+/*TestPluginDhcpv6Confirm1 - the address is confirmed after the link up */
+func TestPluginDhcpv6Confirm1(t *testing.T) {
+	tctx, plug := runLinkUp(3, 15*time.Second)
+	defer tctx.Delete()
+	if plug.stats.pktTxConfirm != 1 || plug.stats.confirmOk != 1 || plug.state != DHCP_STATE_BOUND {
+		t.Fatalf(" address should be confirmed %+v \n", plug.stats)
+	}
+	if plug.Client.Dhcpv6.IsZero() || plug.stats.pktTxDiscover != 1 {
+		t.Fatalf(" address should be kept \n")
+	}
+}
+
+/*TestPluginDhcpv6Confirm2 - not on link, the client restarts with solicit and gets the address again */
+func TestPluginDhcpv6Confirm2(t *testing.T) {
+	tctx, plug := runLinkUp(4, 15*time.Second)
+	defer tctx.Delete()
+	if plug.stats.pktTxConfirm != 1 || plug.stats.confirmNotOnLink != 1 || plug.stats.pktTxDiscover != 2 {
+		t.Fatalf(" client should restart %+v \n", plug.stats)
+	}
+	if plug.Client.Dhcpv6.IsZero() || plug.state != DHCP_STATE_BOUND {
+		t.Fatalf(" client should be bound again \n")
+	}
+}
+
+/*TestPluginDhcpv6Confirm3 - no reply to confirm in CNF_MAX_RD, the address is kept */
+func TestPluginDhcpv6Confirm3(t *testing.T) {
+	tctx, plug := runLinkUp(5, 25*time.Second)
+	defer tctx.Delete()
+	if plug.stats.pktTxConfirm != 4 || plug.stats.confirmTimeout != 1 || plug.state != DHCP_STATE_BOUND {
+		t.Fatalf(" confirm should time out %+v \n", plug.stats)
+	}
+	if plug.Client.Dhcpv6.IsZero() {
+		t.Fatalf(" address should be kept \n")
+	}
+}
+
 func init() {
 	flag.IntVar(&monitor, "monitor", 0, "monitor")
 }
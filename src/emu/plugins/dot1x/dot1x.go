@@ -283,7 +283,7 @@ func (o *PluginDot1xClient) LoadCfg(initJson []byte) {
 }
 
 func (o *PluginDot1xClient) OnCreate() {
-	o.timerw = o.Tctx.GetTimerCtx()
+	o.timerw = o.Ns.GetTimerCtx()
 
 	// build local source ipv6
 	o.preparePacketTemplate()
@@ -348,6 +348,9 @@ func (o *PluginDot1xClient) preparePacketTemplate() {
 }
 
 func (o *PluginDot1xClient) SendStartPacket() {
+	if o.Ns.SuppressTx() {
+		return
+	}
 
 	m := o.Ns.AllocMbuf(uint16(len(o.startPktTemplate)))
 	m.Append(o.startPktTemplate)
@@ -357,6 +360,9 @@ func (o *PluginDot1xClient) SendStartPacket() {
 }
 
 func (o *PluginDot1xClient) SendLogoffPacket() {
+	if o.Ns.SuppressTx() {
+		return
+	}
 
 	m := o.Ns.AllocMbuf(uint16(len(o.startPktTemplate)))
 	m.Append(o.startPktTemplate)
@@ -398,6 +404,20 @@ func (o *PluginDot1xClient) OnEvent(msg string, a, b interface{}) {
 
 }
 
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginDot1xClient) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
+func (o *PluginDot1xClient) getInfo() *Dot1xClientInfo {
+	return &Dot1xClientInfo{State: o.smState, SelectedMethod: o.selectedMethod, EapVer: o.eapVer}
+}
+
+// GetState implements core.IPluginState, the authentication state of the client
+func (o *PluginDot1xClient) GetState() interface{} {
+	return o.getInfo()
+}
+
 func (o *PluginDot1xClient) OnRemove(ctx *core.PluginCtx) {
 	/* force removing the link to the client */
 	ctx.UnregisterEvents(&o.PluginBase, dot1xEvents)
@@ -731,12 +751,7 @@ func (h ApiDot1xClientInfoHandler) ServeJSONRPC(ctx interface{}, params *fastjso
 
 	res := make([]Dot1xClientInfo, len(plugs))
 	for i, p := range plugs {
-		rp := &res[i]
-		var pc *PluginDot1xClient
-		pc = p.Ext.(*PluginDot1xClient)
-		rp.State = pc.smState
-		rp.SelectedMethod = pc.selectedMethod
-		rp.EapVer = pc.eapVer
+		res[i] = *p.Ext.(*PluginDot1xClient).getInfo()
 	}
 
 	return res, nil
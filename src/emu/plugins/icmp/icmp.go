@@ -11,6 +11,10 @@ EchoRequest
 TimestampRequest
 Ping
 
+The queries (echo, timestamp) to a client are answered by its source policy (icmp_src_policy in the
+init json of the client): allow_all (default), on_link answers only the sources in the subnet of the
+client, its default gateway and the other clients of the namespace, deny_all does not answer.
+
 */
 
 import (
@@ -40,6 +44,9 @@ type IcmpNsStats struct {
 	pktRxErrMulticastB      uint64
 	pktRxNoClientUnhandled  uint64
 	pktRxIcmpDstUnreachable uint64
+
+	pktRxPolicyAnswered uint64 // queries answered by the on_link policy
+	pktRxPolicyDrop     uint64 // queries dropped by the source policy
 }
 
 func NewIcmpNsStatsDb(o *IcmpNsStats) *core.CCounterDb {
@@ -107,6 +114,20 @@ func NewIcmpNsStatsDb(o *IcmpNsStats) *core.CCounterDb {
 		Unit:     "ops",
 		DumpZero: false,
 		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxPolicyAnswered,
+		Name:     "pktRxPolicyAnswered",
+		Help:     "rx query from an on-link source answered by the policy",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxPolicyDrop,
+		Name:     "pktRxPolicyDrop",
+		Help:     "rx query dropped by the source policy",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
 
 	return db
 }
@@ -117,9 +138,15 @@ type PluginIcmpClient struct {
 	icmpNsPlug *PluginIcmpNs
 	ping       *ping.Ping
 	pingData   *ApiIcmpClientStartPingHandler
+	pingRoute  *core.CClientRoute // static route toward the ping destination
+	srcPolicy  uint8              // see core.ICMP_SRC_ALLOW_ALL
+}
+
+type IcmpClientInit struct {
+	SrcPolicy string `json:"icmp_src_policy"` // queries of allow_all (default), on_link or deny_all sources
 }
 
-var icmpEvents = []string{}
+var icmpEvents = []string{core.MSG_UPDATE_ROUTES}
 
 /*NewIcmpClient create plugin */
 func NewIcmpClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
@@ -128,13 +155,22 @@ func NewIcmpClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 	o.RegisterEvents(ctx, icmpEvents, o) /* register events, only if exits*/
 	nsplg := o.Ns.PluginCtx.GetOrCreate(ICMP_PLUG)
 	o.icmpNsPlug = nsplg.Ext.(*PluginIcmpNs)
+	var init IcmpClientInit
+	if err := fastjson.Unmarshal(initJson, &init); err == nil {
+		o.srcPolicy, _ = core.ParseIcmpSrcPolicy(init.SrcPolicy)
+	}
 	o.OnCreate()
 	return &o.PluginBase
 }
 
 /*OnEvent support event change of IP  */
 func (o *PluginIcmpClient) OnEvent(msg string, a, b interface{}) {
-
+	switch msg {
+	case core.MSG_UPDATE_ROUTES:
+		if o.ping != nil {
+			o.ping.UpdatePacketTemplate()
+		}
+	}
 }
 
 func (o *PluginIcmpClient) OnRemove(ctx *core.PluginCtx) {
@@ -146,6 +182,32 @@ func (o *PluginIcmpClient) OnRemove(ctx *core.PluginCtx) {
 func (o *PluginIcmpClient) OnCreate() {
 }
 
+// isOnLink checks that the source is on the link of the client, in its subnet, the default gateway or
+// another client of the namespace. The subnet is not known for a /32 (the default mask).
+func (o *PluginIcmpClient) isOnLink(src core.Ipv4Key) bool {
+	mask := o.Client.Maskv4.Uint32()
+	if mask != 0xffffffff && (src.Uint32()&mask) == (o.Client.Ipv4.Uint32()&mask) {
+		return true
+	}
+	return src == o.Client.DgIpv4 || o.Ns.CLookupByIPv4(&src) != nil
+}
+
+// allowQuery checks the source of a query by the source policy
+func (o *PluginIcmpClient) allowQuery(src core.Ipv4Key) bool {
+	switch o.srcPolicy {
+	case core.ICMP_SRC_DENY_ALL:
+		o.icmpNsPlug.stats.pktRxPolicyDrop++
+		return false
+	case core.ICMP_SRC_ON_LINK:
+		if !o.isOnLink(src) {
+			o.icmpNsPlug.stats.pktRxPolicyDrop++
+			return false
+		}
+		o.icmpNsPlug.stats.pktRxPolicyAnswered++
+	}
+	return true
+}
+
 //StartPing creates a ping object in case there isn't any.
 func (o *PluginIcmpClient) StartPing(data *ApiIcmpClientStartPingHandler) bool {
 	if o.ping != nil {
@@ -209,10 +271,11 @@ func (o *PluginIcmpClient) PreparePingPacketTemplate(id, seq uint16, magic uint6
 	myIPv4 := o.Client.Ipv4
 	dstIPv4 := o.pingData.Dst
 	pkt = o.Client.GetL2Header(false, uint16(layers.EthernetTypeIPv4))
-	dstMac, ok := o.Client.ResolveIPv4DGMac()
+	dstMac, route, ok := o.Client.ResolveIPv4RouteMac(dstIPv4)
 	if ok {
 		layers.EthernetHeader(pkt).SetDestAddress(dstMac[:])
 	}
+	o.pingRoute = route
 	ipHeaderOffset := len(pkt)
 	ipHeader := core.PacketUtlBuild(
 		&layers.IPv4{Version: 4, IHL: 5,
@@ -239,6 +302,9 @@ func (o *PluginIcmpClient) PreparePingPacketTemplate(id, seq uint16, magic uint6
 // UpdateTxIcmpQuery implements ping.PingClientIF.UpdateTxIcmpQuery by incrementing the Tx Query every time an echo request is sent.
 func (o *PluginIcmpClient) UpdateTxIcmpQuery(pktSent uint64) {
 	o.icmpNsPlug.stats.pktTxIcmpQuery += pktSent
+	if o.pingRoute != nil {
+		o.pingRoute.Pkts += pktSent
+	}
 
 }
 
@@ -267,6 +333,11 @@ func NewIcmpNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 	return &o.PluginBase
 }
 
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginIcmpNs) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
 func (o *PluginIcmpNs) OnRemove(ctx *core.PluginCtx) {
 }
 
@@ -319,6 +390,7 @@ func (o *PluginIcmpNs) HandleEcho(ps *core.ParserPacketState, ts bool) {
 		binary.BigEndian.PutUint32(icmp[16:20], ipt)
 		icmp.UpdateChecksum()
 	}
+	o.Ns.ReflectRewrite(p, ps.L3, false)
 	o.stats.pktRxIcmpQuery++
 	o.stats.pktTxIcmpResponse++
 	o.Tctx.Veth.Send(mc)
@@ -437,9 +509,13 @@ func (o *PluginIcmpNs) HandleRxIcmpPacket(ps *core.ParserPacketState) int {
 
 	switch icmpv4.TypeCode {
 	case layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0):
-		o.HandleEcho(ps, false)
+		if o.allowQuery(client, ipv4Key) {
+			o.HandleEcho(ps, false)
+		}
 	case layers.CreateICMPv4TypeCode(layers.ICMPv4TypeTimestampRequest, 0):
-		o.HandleEcho(ps, true)
+		if o.allowQuery(client, ipv4Key) {
+			o.HandleEcho(ps, true)
+		}
 	case layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoReply, 0):
 		res := o.HandleEchoReply(ps)
 		if res == core.PARSER_ERR {
@@ -461,6 +537,16 @@ func (o *PluginIcmpNs) HandleRxIcmpPacket(ps *core.ParserPacketState) int {
 	return 0
 }
 
+// allowQuery checks the source of a query by the source policy of the client plugin, a client without
+// the plugin answers all the sources
+func (o *PluginIcmpNs) allowQuery(client *core.CClient, src core.Ipv4Key) bool {
+	plug := client.PluginCtx.Get(ICMP_PLUG)
+	if plug == nil {
+		return true
+	}
+	return plug.Ext.(*PluginIcmpClient).allowQuery(src)
+}
+
 //GetIcmpClientByMac is a method of the ICMP Namespace that returns the Icmp Client given its MAC address.
 func (o *PluginIcmpNs) GetIcmpClientByMac(mackey core.MACKey) (*PluginIcmpClient, error) {
 
@@ -325,6 +325,84 @@ func TestPluginIcmp3(t *testing.T) {
 	a.Run(t, true)
 }
 
+type IcmpReflectCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+}
+
+func (o *IcmpReflectCtx) OnEvent(a, b interface{}) {
+	o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_set_reflect_rewrite",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "dscp": 46, "pcp": 5},
+		"id": 3}`))
+	// invalid pcp
+	o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ctx_set_reflect_rewrite",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "pcp": 8},
+		"id": 3}`))
+}
+
+func rpcReflect(tctx *core.CThreadCtx, test *IcmpTestBase) int {
+	Cb4(tctx, test)
+	timerw := tctx.GetTimerCtx()
+	var tstctx IcmpReflectCtx
+	tstctx.timer.SetCB(&tstctx, test.cbArg1, test.cbArg2)
+	tstctx.tctx = tctx
+	timerw.StartTicks(&tstctx.timer, timerw.DurationToTicks(5*time.Second))
+	return 0
+}
+
+/*TestPluginIcmp4 - the echo replies are sent with the DSCP/PCP of the reflect rewrite after the rpc */
+func TestPluginIcmp4(t *testing.T) {
+	a := &IcmpTestBase{
+		testname:     "icmp4",
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     30 * time.Second,
+		clientsToSim: 1,
+		cb:           rpcReflect,
+	}
+	a.Run(t, true)
+}
+
+// the queries of the sources by the source policy of the clients
+func TestPluginIcmpSrcPolicy(t *testing.T) {
+	tctx := core.NewThreadCtx(0, 4510, false, nil)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1})
+	ns := core.NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+
+	newClient := func(i uint8, init string) *PluginIcmpClient {
+		client := core.NewClient(ns, core.MACKey{0, 0, 1, 0, 0, i}, core.Ipv4Key{16, 0, 0, i}, core.Ipv6Key{}, core.Ipv4Key{16, 0, 0, 254})
+		ns.AddClient(client)
+		client.PluginCtx.CreatePlugins([]string{ICMP_PLUG}, [][]byte{[]byte(init)})
+		return client.PluginCtx.Get(ICMP_PLUG).Ext.(*PluginIcmpClient)
+	}
+	onLink := newClient(1, `{"icmp_src_policy": "on_link"}`)
+	denyAll := newClient(2, `{"icmp_src_policy": "deny_all"}`)
+	allowAll := newClient(3, `{}`)
+	stats := &onLink.icmpNsPlug.stats
+
+	// a /32 client, the gateway and the other clients are on link
+	if !onLink.allowQuery(core.Ipv4Key{16, 0, 0, 254}) || !onLink.allowQuery(core.Ipv4Key{16, 0, 0, 3}) ||
+		onLink.allowQuery(core.Ipv4Key{16, 0, 0, 100}) {
+		t.Fatalf(" on link policy of a /32 client \n")
+	}
+	onLink.Client.Maskv4 = core.Ipv4Key{255, 255, 255, 0}
+	if !onLink.allowQuery(core.Ipv4Key{16, 0, 0, 100}) || onLink.allowQuery(core.Ipv4Key{48, 0, 0, 1}) {
+		t.Fatalf(" on link policy of a /24 client \n")
+	}
+	if denyAll.allowQuery(core.Ipv4Key{16, 0, 0, 1}) || !allowAll.allowQuery(core.Ipv4Key{48, 0, 0, 1}) {
+		t.Fatalf(" deny all and allow all policies \n")
+	}
+	if stats.pktRxPolicyAnswered != 3 || stats.pktRxPolicyDrop != 3 {
+		t.Fatalf(" bad counters %+v \n", stats)
+	}
+}
+
 func init() {
 	flag.IntVar(&monitor, "monitor", 0, "monitor")
 }
@@ -25,7 +25,16 @@ inijson :
 		DesignatorMac core.MACKey    `json:"dmac"`  // mac addrees of the client that represent the network
 		Vec           []core.Ipv4Key `json:"vec"` // add mc
 		Version       uint16 		 `json:"version"` // the init version
+		Robustness    uint8          `json:"robustness"` // the number of unsolicited reports sent on join (RFC3376 robustness), default 1
+		UnsolicitedIvl uint32        `json:"unsolicited_ivl"` // the interval between the join reports in msec, default 1000
+		Querier         bool         `json:"querier"` // act as a querier, send general queries from the designator client
+		StartupQueryCnt uint8        `json:"startup_query_cnt"` // number of startup queries, default qrv (2)
+		StartupQueryIvl uint32       `json:"startup_query_ivl"` // startup query interval in msec, default 1/4 of query_ivl
+		QueryIvl        uint32       `json:"query_ivl"` // steady query interval in sec, default 125
 	}
+
+Querier mode (RFC3376 8.6/8.7), a querier that comes up sends startup_query_cnt general queries
+startup_query_ivl apart and then settles to a general query every query_ivl.
 */
 
 import (
@@ -38,6 +47,7 @@ import (
 	"math/rand"
 	"net"
 	"sort"
+	"time"
 	"unsafe"
 
 	"github.com/intel-go/fastjson"
@@ -67,6 +77,11 @@ const (
 	IGMP_HOST_LEAVE_MESSAGE        = 0x17 /* Leave-group message     */
 	IGMP_v2_HOST_MEMBERSHIP_REPORT = 0x16 /* Ver. 2 membership report */
 	IPV4_HEADER_SIZE               = 24   /* plus router alert */
+
+	IGMP_QUERIER_DEF_IVL       = 125 /* default query interval in sec */
+	IGMP_QUERIER_PHASE_OFF     = "off"
+	IGMP_QUERIER_PHASE_STARTUP = "startup"
+	IGMP_QUERIER_PHASE_STEADY  = "steady"
 )
 
 // return ticks (not in time), burst each tick , bool
@@ -120,10 +135,23 @@ func calcTimerInfo(totalrecords uint32,
 }
 
 type IgmpNsInit struct {
-	Mtu           uint16         `json:"mtu" validate:"required,gte=256,lte=9000"`
-	DesignatorMac core.MACKey    `json:"dmac"`
-	Vec           []core.Ipv4Key `json:"vec"`     // add mc (*) include all mask (EXCLUDE {}) to add (s,g) use RPC
-	Version       uint16         `json:"version"` // the init version of IGMP, it will learn from Query
+	Mtu            uint16         `json:"mtu" validate:"required,gte=256,lte=9000"`
+	DesignatorMac  core.MACKey    `json:"dmac"`
+	Vec            []core.Ipv4Key `json:"vec"`             // add mc (*) include all mask (EXCLUDE {}) to add (s,g) use RPC
+	Version        uint16         `json:"version"`         // the init version of IGMP, it will learn from Query
+	Robustness     uint8          `json:"robustness"`      // number of unsolicited reports sent on join, default 1
+	UnsolicitedIvl uint32         `json:"unsolicited_ivl"` // unsolicited report interval in msec, default 1000
+
+	Querier         bool   `json:"querier"`           // act as a querier
+	StartupQueryCnt uint8  `json:"startup_query_cnt"` // number of startup queries, default qrv
+	StartupQueryIvl uint32 `json:"startup_query_ivl"` // startup query interval in msec, default 1/4 of query_ivl
+	QueryIvl        uint32 `json:"query_ivl"`         // steady query interval in sec, default 125
+}
+
+// IgmpClientRef a group referenced by the applications of a client
+type IgmpClientRef struct {
+	G    core.Ipv4Key `json:"g"`
+	Refc uint32       `json:"refc"`
 }
 
 type IgmpSGRecord struct {
@@ -157,6 +185,10 @@ type IgmpNsStats struct {
 	pktRxNora                 uint64 /* received w/o Router Alert option */
 	pktRxSndReports           uint64 /* sent membership reports */
 	pktSndAddRemoveReports    uint64 /* explicit reports dur to add/remove command */
+	pktSndJoinReports         uint64 /* unsolicited reports sent on join, including retransmissions */
+	pktSndJoinRetrans         uint64 /* robustness retransmissions of unsolicited join reports */
+	pktTxQueryStartup         uint64 /* general queries sent in the querier startup phase */
+	pktTxQuerySteady          uint64 /* general queries sent in the querier steady phase */
 	pktNoDesignatorClient     uint64 /* There is no designator client with this MAC addr */
 	pktNoDesignatorClientIPv4 uint64 /* there designator client does not have valid IPv4 addr */
 
@@ -172,6 +204,12 @@ type IgmpNsStats struct {
 
 	opsRateIsTooHigh uint64
 
+	opsAppJoin       uint64 /* join of an application of a client */
+	opsAppLeave      uint64 /* leave of an application of a client */
+	opsAppErr        uint64
+	reportSuppressed uint64 /* joins of a group that was already joined, no report */
+	leaveSuppressed  uint64 /* leaves of a group that is still referenced, no leave */
+
 	pktRxSndReportsSGChangeToInclude uint64 /* sent change to include state */ /*TBD*/
 	pktRxSndReportsSGAdd             uint64
 	pktRxSndReportsSGRemove          uint64
@@ -345,6 +383,38 @@ func NewIgmpNsStatsDb(o *IgmpNsStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScINFO})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktSndJoinReports,
+		Name:     "pktSndJoinReports",
+		Help:     "unsolicited reports sent on join",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktSndJoinRetrans,
+		Name:     "pktSndJoinRetrans",
+		Help:     "robustness retransmissions of join reports",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxQueryStartup,
+		Name:     "pktTxQueryStartup",
+		Help:     "querier general queries in startup phase",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxQuerySteady,
+		Name:     "pktTxQuerySteady",
+		Help:     "querier general queries in steady phase",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
 	db.Add(&core.CCounterRec{
 		Counter:  &o.pktRxSndReports,
 		Name:     "pktRxSndReports",
@@ -438,6 +508,46 @@ func NewIgmpNsStatsDb(o *IgmpNsStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScERROR})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAppJoin,
+		Name:     "opsAppJoin",
+		Help:     "joins of the applications of the clients",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAppLeave,
+		Name:     "opsAppLeave",
+		Help:     "leaves of the applications of the clients",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAppErr,
+		Name:     "opsAppErr",
+		Help:     "joins or leaves of the applications with an error",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.reportSuppressed,
+		Name:     "reportSuppressed",
+		Help:     "joins of a group that was already joined, no report",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.leaveSuppressed,
+		Name:     "leaveSuppressed",
+		Help:     "leaves of a group that is still referenced, no leave",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
 	return db
 }
 
@@ -456,6 +566,7 @@ type IgmpEntryJson struct {
 	G    core.Ipv4Key    `json:"g"`
 	Mode uint8           `json:"mode"`
 	S    *[]core.Ipv4Key `json:"sv,omitempty"`
+	Refc uint32          `json:"refc,omitempty"` // references of the applications of the clients
 }
 
 //IgmpEntry includes one ipv4 mc addr
@@ -464,12 +575,15 @@ type IgmpEntry struct {
 	Ipv4      core.Ipv4Key
 	epocQuery uint32
 	maps      MapIgmpS // map for source
+	mgmt      bool     // added by igmp_ns_add or igmp_ns_sg_add
+	refc      uint32   // references of the applications of the clients, see igmp_c_join
 }
 
 func (o *IgmpEntry) getJson() *IgmpEntryJson {
 	var j IgmpEntryJson
 	j.G = o.Ipv4
 	j.Mode = o.getMode()
+	j.Refc = o.refc
 	j.S = nil
 	if o.getMode() == IGMP_ENTRY_MODE_INCLUDE_S {
 		j.S = new([]core.Ipv4Key)
@@ -586,6 +700,7 @@ func (o *IgmpFlowTbl) addMcSG(ipv4 core.Ipv4Key, s core.Ipv4Key) (bool, error) {
 		e.Ipv4 = ipv4
 		e.epocQuery = o.epocQuery
 		e.allocMap() // create maps
+		e.mgmt = true
 		o.mapIgmp[ipv4] = e
 		o.head.AddLast(&e.dlist)
 		r = true
@@ -625,11 +740,45 @@ func (o *IgmpFlowTbl) addMc(ipv4 core.Ipv4Key) error {
 	e := new(IgmpEntry)
 	e.Ipv4 = ipv4
 	e.epocQuery = o.epocQuery
+	e.mgmt = true
 	o.mapIgmp[ipv4] = e
 	o.head.AddLast(&e.dlist)
 	return nil
 }
 
+// addRef adds a reference of an application to MC(*), returns true in case the entry is new
+func (o *IgmpFlowTbl) addRef(ipv4 core.Ipv4Key) (bool, error) {
+	e, ok := o.mapIgmp[ipv4]
+	if ok {
+		if e.getMode() != IGMP_ENTRY_MODE_INCLUDE_ALL {
+			return false, fmt.Errorf(" ns:%v mc-ipv4 %v already is in filter mode", o.ns.Key.StringRpc(), ipv4)
+		}
+		e.refc++
+		return false, nil
+	}
+	if err := o.addMc(ipv4); err != nil {
+		return false, err
+	}
+	e = o.mapIgmp[ipv4]
+	e.mgmt = false
+	e.refc = 1
+	return true, nil
+}
+
+// removeRef removes a reference of an application, returns true in case it was the last reference
+// and the entry was removed
+func (o *IgmpFlowTbl) removeRef(ipv4 core.Ipv4Key) (bool, error) {
+	e, ok := o.mapIgmp[ipv4]
+	if !ok || e.refc == 0 {
+		return false, fmt.Errorf(" ns:%v mc-ipv4 %v is not referenced", o.ns.Key.StringRpc(), ipv4)
+	}
+	e.refc--
+	if e.refc > 0 || e.mgmt {
+		return false, nil
+	}
+	return true, o.removeMc(ipv4)
+}
+
 // removeMC(*)
 func (o *IgmpFlowTbl) removeMc(ipv4 core.Ipv4Key) error {
 	e, ok := o.mapIgmp[ipv4]
@@ -665,6 +814,7 @@ func (o *IgmpFlowTbl) dumpAll() {
 type PluginIgmpClient struct {
 	core.PluginBase
 	igmpNsPlug *PluginIgmpNs
+	refs       map[core.Ipv4Key]uint32 // groups referenced by the applications of the client
 }
 
 var igmpEvents = []string{}
@@ -688,6 +838,98 @@ func (o *PluginIgmpClient) OnEvent(msg string, a, b interface{}) {
 func (o *PluginIgmpClient) OnRemove(ctx *core.PluginCtx) {
 	/* force removing the link to the client */
 	ctx.UnregisterEvents(&o.PluginBase, igmpEvents)
+	// the applications of a removed client release all their references
+	var vec []core.Ipv4Key
+	for g, n := range o.refs {
+		for i := uint32(0); i < n; i++ {
+			vec = append(vec, g)
+		}
+	}
+	sort.Slice(vec, func(i, j int) bool { return vec[i].Uint32() < vec[j].Uint32() })
+	o.Leave(vec)
+}
+
+// Join adds a reference of an application of the client to each group, a report is sent only for
+// the groups that were not joined
+func (o *PluginIgmpClient) Join(vecIpv4 []core.Ipv4Key) error {
+	ns := o.igmpNsPlug
+	vec := []uint32{}
+	maxIds := int(ns.getMaxIPv4Ids())
+	ns.tbl.epoc++
+	var err error
+	for _, ipv4 := range vecIpv4 {
+		var add bool
+		add, err = ns.tbl.addRef(ipv4)
+		if err != nil {
+			ns.stats.opsAppErr++
+			break
+		}
+		ns.stats.opsAppJoin++
+		if o.refs == nil {
+			o.refs = make(map[core.Ipv4Key]uint32)
+		}
+		o.refs[ipv4]++
+		if !add {
+			ns.stats.reportSuppressed++
+			continue
+		}
+		vec = append(vec, ipv4.Uint32())
+		if len(vec) == maxIds {
+			ns.sendJoinReport(vec)
+			vec = vec[:0]
+		}
+	}
+	ns.sendJoinReport(vec)
+	return err
+}
+
+// Leave removes a reference of an application of the client from each group, a leave is sent
+// only for the groups without references
+func (o *PluginIgmpClient) Leave(vecIpv4 []core.Ipv4Key) error {
+	ns := o.igmpNsPlug
+	vec := []uint32{}
+	maxIds := int(ns.getMaxIPv4Ids())
+	ns.tbl.epoc++
+	var err error
+	for _, ipv4 := range vecIpv4 {
+		if o.refs[ipv4] == 0 {
+			ns.stats.opsAppErr++
+			err = fmt.Errorf(" client %v does not reference mc-ipv4 %v", o.Client.Mac, ipv4)
+			break
+		}
+		var last bool
+		last, err = ns.tbl.removeRef(ipv4)
+		if err != nil {
+			ns.stats.opsAppErr++
+			break
+		}
+		ns.stats.opsAppLeave++
+		o.refs[ipv4]--
+		if o.refs[ipv4] == 0 {
+			delete(o.refs, ipv4)
+		}
+		if !last {
+			ns.stats.leaveSuppressed++
+			continue
+		}
+		vec = append(vec, ipv4.Uint32())
+		if len(vec) == maxIds {
+			ns.SendMcPacket(vec, true, false)
+			vec = vec[:0]
+		}
+	}
+	ns.SendMcPacket(vec, true, false)
+	return err
+}
+
+// getRefs returns the groups referenced by the client sorted by the group
+func (o *PluginIgmpClient) getRefs() []IgmpClientRef {
+	r := make([]IgmpClientRef, 0, len(o.refs))
+	for g, n := range o.refs {
+		r = append(r, IgmpClientRef{G: g, Refc: n})
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].G.Uint32() < r[j].G.Uint32() })
+	return r
 }
 
 func (o *PluginIgmpClient) OnCreate() {
@@ -701,6 +943,31 @@ func (o *PluginIgmpNsTimer) OnEvent(a, b interface{}) {
 	pigmp.onTimerUpdate()
 }
 
+// PluginIgmpNsRetransTimer retransmit the unsolicited join reports
+type PluginIgmpNsRetransTimer struct {
+}
+
+func (o *PluginIgmpNsRetransTimer) OnEvent(a, b interface{}) {
+	pigmp := a.(*PluginIgmpNs)
+	pigmp.onRetransTimer(b.(*igmpJoinRetrans))
+}
+
+// PluginIgmpNsQuerierTimer send the general queries in querier mode
+type PluginIgmpNsQuerierTimer struct {
+}
+
+func (o *PluginIgmpNsQuerierTimer) OnEvent(a, b interface{}) {
+	pigmp := a.(*PluginIgmpNs)
+	pigmp.onQuerierTimer()
+}
+
+// igmpJoinRetrans a batch of joined groups that should be reported again (RFC 3376 5.1)
+type igmpJoinRetrans struct {
+	timer core.CHTimerObj
+	vec   []uint32
+	left  uint8 /* retransmissions left */
+}
+
 type igmpPktBuilder struct {
 	e        *IgmpEntry
 	freePyld uint16
@@ -736,6 +1003,18 @@ type PluginIgmpNs struct {
 	rpcIterEpoc     uint32
 	iter            core.DListIterHead
 	iterReady       bool
+	robustness      uint8  /* number of unsolicited reports on join */
+	unsolicitedIvl  uint32 /* unsolicited report interval in msec */
+	retransCb       PluginIgmpNsRetransTimer
+	retransVec      []*igmpJoinRetrans
+
+	querier         bool   /* querier mode */
+	startupQueryCnt uint8  /* 0 - use qrv */
+	startupQueryIvl uint32 /* in msec, 0 - use 1/4 of queryIvl */
+	queryIvl        uint32 /* in sec */
+	startupLeft     uint8  /* startup queries left to send */
+	querierTimer    core.CHTimerObj
+	querierCb       PluginIgmpNsQuerierTimer
 }
 
 func NewIgmpNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
@@ -756,8 +1035,12 @@ func NewIgmpNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 	o.qrv = 2
 	o.qqi = 125
 	o.maxresp = 100
-	o.timerw = ctx.Tctx.GetTimerCtx()
+	o.robustness = 1
+	o.unsolicitedIvl = 1000
+	o.queryIvl = IGMP_QUERIER_DEF_IVL
+	o.timerw = ctx.Ns.GetTimerCtx()
 	o.timer.SetCB(&o.timerCb, o, 0) // set the callback to OnEvent
+	o.querierTimer.SetCB(&o.querierCb, o, 0)
 	o.preparePacketTemplate()
 	if err == nil {
 		/* init json was provided */
@@ -767,12 +1050,26 @@ func NewIgmpNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 		if !init.DesignatorMac.IsZero() {
 			o.designatorMac = init.DesignatorMac
 		}
+		if init.Robustness > 0 {
+			o.robustness = init.Robustness
+		}
+		if init.UnsolicitedIvl > 0 {
+			o.unsolicitedIvl = init.UnsolicitedIvl
+		}
 		if len(init.Vec) > 0 {
 			o.addMc(init.Vec)
 		}
 		if init.Version == 2 {
 			o.igmpVersion = IGMP_VERSION_2
 		}
+		o.startupQueryCnt = init.StartupQueryCnt
+		o.startupQueryIvl = init.StartupQueryIvl
+		if init.QueryIvl > 0 {
+			o.queryIvl = init.QueryIvl
+		}
+		if init.Querier {
+			o.querierStart()
+		}
 	}
 
 	return &o.PluginBase
@@ -842,10 +1139,42 @@ func (o *PluginIgmpNs) preparePacketTemplate() {
 	o.ipv4pktTemplate = append(l2, igmpHeader...)
 }
 
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginIgmpNs) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
+// IgmpNsState the state of the namespace in ctx_get_state
+type IgmpNsState struct {
+	Groups []IgmpEntryJson `json:"groups"`
+}
+
+// GetState the memberships of the namespace sorted by the group, see ctx_get_state
+func (o *PluginIgmpNs) GetState() interface{} {
+	r := make([]IgmpEntryJson, 0, len(o.tbl.mapIgmp))
+	for _, ent := range o.tbl.mapIgmp {
+		j := ent.getJson()
+		if j.S != nil {
+			s := *j.S
+			sort.Slice(s, func(i, k int) bool { return s[i].Uint32() < s[k].Uint32() })
+		}
+		r = append(r, *j)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].G.Uint32() < r[j].G.Uint32() })
+	return &IgmpNsState{Groups: r}
+}
+
 func (o *PluginIgmpNs) OnRemove(ctx *core.PluginCtx) {
 	if o.timer.IsRunning() {
 		o.timerw.Stop(&o.timer)
 	}
+	for _, r := range o.retransVec {
+		if r.timer.IsRunning() {
+			o.timerw.Stop(&r.timer)
+		}
+	}
+	o.retransVec = nil
+	o.querierStop()
 }
 
 func (o *PluginIgmpNs) OnEvent(msg string, a, b interface{}) {
@@ -929,29 +1258,97 @@ func (o *PluginIgmpNs) addMc(vecIpv4 []core.Ipv4Key) error {
 	maxIds := int(o.getMaxIPv4Ids())
 	o.tbl.epoc++
 	for _, ipv4 := range vecIpv4 {
+		if e, ok := o.tbl.mapIgmp[ipv4]; ok && !e.mgmt && e.getMode() == IGMP_ENTRY_MODE_INCLUDE_ALL {
+			// already joined by the applications of the clients
+			e.mgmt = true
+			o.stats.opsAdd++
+			o.stats.reportSuppressed++
+			continue
+		}
 		err = o.tbl.addMc(ipv4)
 		if err != nil {
 			o.stats.opsAddErr++
-			o.SendMcPacket(vec, false, false)
+			o.sendJoinReport(vec)
 			return err
 		}
 		o.stats.opsAdd++
 		vec = append(vec, ipv4.Uint32())
 		if len(vec) == maxIds {
-			o.SendMcPacket(vec, false, false)
+			o.sendJoinReport(vec)
 			vec = vec[:0]
 		}
 	}
-	o.SendMcPacket(vec, false, false)
+	o.sendJoinReport(vec)
 	return nil
 }
 
+// sendJoinReport send the unsolicited report for new groups and schedule
+// robustness-1 retransmissions spaced by the unsolicited report interval
+func (o *PluginIgmpNs) sendJoinReport(vec []uint32) {
+	if len(vec) == 0 {
+		return
+	}
+	o.stats.pktSndJoinReports++
+	o.SendMcPacket(vec, false, false)
+	if o.robustness < 2 {
+		return
+	}
+	r := new(igmpJoinRetrans)
+	r.vec = make([]uint32, len(vec))
+	copy(r.vec, vec)
+	r.left = o.robustness - 1
+	r.timer.SetCB(&o.retransCb, o, r)
+	o.retransVec = append(o.retransVec, r)
+	o.timerw.Start(&r.timer, time.Duration(o.unsolicitedIvl)*time.Millisecond)
+}
+
+func (o *PluginIgmpNs) onRetransTimer(r *igmpJoinRetrans) {
+	// report only the groups that were not removed in the meantime
+	vec := []uint32{}
+	for _, g := range r.vec {
+		var k core.Ipv4Key
+		k.SetUint32(g)
+		if _, ok := o.tbl.mapIgmp[k]; ok {
+			vec = append(vec, g)
+		}
+	}
+	if len(vec) > 0 {
+		o.stats.pktSndJoinReports++
+		o.stats.pktSndJoinRetrans++
+		o.SendMcPacket(vec, false, false)
+	}
+	r.left--
+	if r.left > 0 && len(vec) > 0 {
+		r.vec = vec
+		o.timerw.Start(&r.timer, time.Duration(o.unsolicitedIvl)*time.Millisecond)
+		return
+	}
+	for i, e := range o.retransVec {
+		if e == r {
+			o.retransVec = append(o.retransVec[:i], o.retransVec[i+1:]...)
+			break
+		}
+	}
+}
+
 func (o *PluginIgmpNs) RemoveMc(vecIpv4 []core.Ipv4Key) error {
 	var err error
 	vec := []uint32{}
 	o.tbl.epoc++
 	maxIds := int(o.getMaxIPv4Ids())
 	for _, ipv4 := range vecIpv4 {
+		if e, ok := o.tbl.mapIgmp[ipv4]; ok && e.refc > 0 {
+			if !e.mgmt {
+				o.stats.opsRemoveErr++
+				o.SendMcPacket(vec, true, false)
+				return fmt.Errorf(" ns:%v mc-ipv4 %v wasn't added by management and can't be removed", o.Ns.Key.StringRpc(), ipv4)
+			}
+			// still referenced by the applications of the clients
+			e.mgmt = false
+			o.stats.opsRemove++
+			o.stats.leaveSuppressed++
+			continue
+		}
 		err = o.tbl.removeMc(ipv4)
 		if err != nil {
 			o.stats.opsRemoveErr++
@@ -1148,6 +1545,9 @@ func (o *PluginIgmpNs) getdClient() *core.CClient {
 }
 
 func (o *PluginIgmpNs) SendMcPacketSG(fvec []uint32, vec []*IgmpSGRecord, remove bool) {
+	if o.Ns.SuppressTx() {
+		return
+	}
 
 	client := o.getdClient()
 	if client == nil {
@@ -1396,6 +1796,9 @@ func (o *PluginIgmpNs) SendMcPacketSGQuery(vec []uint32) {
 }
 
 func (o *PluginIgmpNs) SendMcPacket(vec []uint32, remove bool, query bool) {
+	if !query && o.Ns.SuppressTx() {
+		return
+	}
 
 	client := o.getdClient()
 	if client == nil {
@@ -1498,6 +1901,127 @@ func (o *PluginIgmpNs) SendMcPacket(vec []uint32, remove bool, query bool) {
 	o.Tctx.Veth.Send(m)
 }
 
+// igmpEncodeCode encode a Max Resp Code/QQIC value (RFC3376 4.1.1, 4.1.7)
+func igmpEncodeCode(v uint32) uint8 {
+	if v < 128 {
+		return uint8(v)
+	}
+	var exp uint32
+	for exp < 7 && (v>>(exp+3)) > 0x1f {
+		exp++
+	}
+	if (v >> (exp + 3)) > 0x1f {
+		return 0xff
+	}
+	mant := (v >> (exp + 3)) & 0x0f
+	return uint8(0x80 | (exp << 4) | mant)
+}
+
+func (o *PluginIgmpNs) getStartupQueryCnt() uint8 {
+	if o.startupQueryCnt > 0 {
+		return o.startupQueryCnt
+	}
+	return o.qrv
+}
+
+func (o *PluginIgmpNs) getStartupQueryIvl() uint32 {
+	if o.startupQueryIvl > 0 {
+		return o.startupQueryIvl
+	}
+	return o.queryIvl * 1000 / 4
+}
+
+func (o *PluginIgmpNs) getQuerierPhase() string {
+	if !o.querier {
+		return IGMP_QUERIER_PHASE_OFF
+	}
+	if o.startupLeft > 0 {
+		return IGMP_QUERIER_PHASE_STARTUP
+	}
+	return IGMP_QUERIER_PHASE_STEADY
+}
+
+// querierStart start (or restart) the querier from the startup phase, the first query is sent on the next tick
+func (o *PluginIgmpNs) querierStart() {
+	o.querierStop()
+	o.querier = true
+	o.startupLeft = o.getStartupQueryCnt()
+	o.timerw.StartTicks(&o.querierTimer, 1)
+}
+
+func (o *PluginIgmpNs) querierStop() {
+	o.querier = false
+	o.startupLeft = 0
+	if o.querierTimer.IsRunning() {
+		o.timerw.Stop(&o.querierTimer)
+	}
+}
+
+func (o *PluginIgmpNs) onQuerierTimer() {
+	var ivl time.Duration
+	if o.startupLeft > 0 {
+		o.stats.pktTxQueryStartup++
+		o.startupLeft--
+	} else {
+		o.stats.pktTxQuerySteady++
+	}
+	o.SendGenQuery()
+	if o.startupLeft > 0 {
+		ivl = time.Duration(o.getStartupQueryIvl()) * time.Millisecond
+	} else {
+		ivl = time.Duration(o.queryIvl) * time.Second
+	}
+	ticks := o.timerw.DurationToTicks(ivl)
+	if ticks == 0 {
+		ticks = 1
+	}
+	o.timerw.StartTicks(&o.querierTimer, ticks)
+}
+
+// SendGenQuery send a general query to all-hosts on behalf of the designator client
+func (o *PluginIgmpNs) SendGenQuery() {
+	if o.Ns.SuppressTx() {
+		return
+	}
+	client := o.getdClient()
+	if client == nil {
+		return
+	}
+
+	var query []byte
+	switch o.igmpVersion {
+	case IGMP_VERSION_3:
+		query = []byte{uint8(layers.IGMPMembershipQuery), igmpEncodeCode(o.maxresp), 0, 0,
+			0, 0, 0, 0,
+			o.qrv & 0x7, igmpEncodeCode(o.queryIvl), 0, 0}
+	default:
+		maxresp := o.maxresp
+		if maxresp > 0xff {
+			maxresp = 0xff
+		}
+		if o.igmpVersion == IGMP_VERSION_1 {
+			maxresp = 0
+		}
+		query = []byte{uint8(layers.IGMPMembershipQuery), uint8(maxresp), 0, 0,
+			0, 0, 0, 0}
+	}
+	binary.BigEndian.PutUint16(query[2:4], layers.PktChecksum(query, 0))
+
+	m := o.Ns.AllocMbuf(uint16(len(o.ipv4pktTemplate) + len(query)))
+	m.Append(o.ipv4pktTemplate)
+	m.Append(query)
+	p := m.GetData()
+	copy(p[0:6], []byte{0x01, 0x00, 0x5e, 0x00, 0x00, 0x01})
+	copy(p[6:12], o.designatorMac[:])
+
+	ipv4 := layers.IPv4Header(p[o.ipv4Offset : o.ipv4Offset+IPV4_HEADER_SIZE])
+	ipv4.SetIPSrc(client.Ipv4.Uint32())
+	ipv4.SetIPDst(IGMP_MC_DEST_HOST)
+	ipv4.SetLength(uint16(IPV4_HEADER_SIZE + len(query)))
+	ipv4.UpdateChecksum()
+	o.Tctx.Veth.Send(m)
+}
+
 func (o *PluginIgmpNs) HandleRxIgmpV2Query(ps *core.ParserPacketState) int {
 	m := ps.M
 	p := m.GetData()
@@ -1720,6 +2244,19 @@ type (
 		Vec []core.Ipv4Key `json:"vec"`
 	}
 
+	// join/leave of an application of a client, reference counted per group
+	ApiIgmpClientJoinHandler struct{}
+	ApiIgmpClientJoinParams  struct {
+		Vec []core.Ipv4Key `json:"vec"`
+	} /* key tunnel, mac */
+
+	ApiIgmpClientLeaveHandler struct{}
+
+	ApiIgmpClientRefsHandler struct{}
+	ApiIgmpClientRefsResult  struct {
+		Vec []IgmpClientRef `json:"vec"`
+	}
+
 	ApiIgmpNsIterHandler struct{}
 	ApiIgmpNsIterParams  struct {
 		Reset bool   `json:"reset"`
@@ -1733,16 +2270,38 @@ type (
 
 	ApiIgmpSetHandler struct{}
 	ApiIgmpSetParams  struct {
-		Mtu           uint16      `json:"mtu" validate:"required,gte=256,lte=9000"`
-		DesignatorMac core.MACKey `json:"dmac"`
+		Mtu            uint16      `json:"mtu" validate:"required,gte=256,lte=9000"`
+		DesignatorMac  core.MACKey `json:"dmac"`
+		Robustness     uint8       `json:"robustness" validate:"lte=7"`
+		UnsolicitedIvl uint32      `json:"unsolicited_ivl"`
 	}
 
 	ApiIgmpGetHandler struct{}
 
+	ApiIgmpQuerierSetHandler struct{}
+	ApiIgmpQuerierSetParams  struct {
+		Enable          bool   `json:"enable"`
+		StartupQueryCnt uint8  `json:"startup_query_cnt"`
+		StartupQueryIvl uint32 `json:"startup_query_ivl"`
+		QueryIvl        uint32 `json:"query_ivl"`
+	}
+
+	ApiIgmpQuerierGetHandler struct{}
+	ApiIgmpQuerierGetResult  struct {
+		Enable          bool   `json:"enable"`
+		Phase           string `json:"phase"`
+		StartupLeft     uint8  `json:"startup_left"`
+		StartupQueryCnt uint8  `json:"startup_query_cnt"`
+		StartupQueryIvl uint32 `json:"startup_query_ivl"`
+		QueryIvl        uint32 `json:"query_ivl"`
+	}
+
 	ApiIgmpGetResult struct {
-		Mtu           uint16      `json:"mtu"`
-		DesignatorMac core.MACKey `json:"dmac"`
-		Version       uint8       `json:"version"`
+		Mtu            uint16      `json:"mtu"`
+		DesignatorMac  core.MACKey `json:"dmac"`
+		Version        uint8       `json:"version"`
+		Robustness     uint8       `json:"robustness"`
+		UnsolicitedIvl uint32      `json:"unsolicited_ivl"`
 	}
 )
 
@@ -1802,6 +2361,14 @@ func (h ApiIgmpSetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMes
 	if !p.DesignatorMac.IsZero() {
 		igmpNs.designatorMac = p.DesignatorMac
 	}
+
+	if p.Robustness > 0 {
+		igmpNs.robustness = p.Robustness
+	}
+
+	if p.UnsolicitedIvl > 0 {
+		igmpNs.unsolicitedIvl = p.UnsolicitedIvl
+	}
 	return nil, nil
 }
 
@@ -1820,6 +2387,66 @@ func (h ApiIgmpGetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMes
 	res.Mtu = igmpPlug.mtu
 	res.DesignatorMac = igmpPlug.designatorMac
 	res.Version = uint8(igmpPlug.igmpVersion)
+	res.Robustness = igmpPlug.robustness
+	res.UnsolicitedIvl = igmpPlug.unsolicitedIvl
+
+	return &res, nil
+}
+
+func (h ApiIgmpQuerierSetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiIgmpQuerierSetParams
+
+	tctx := ctx.(*core.CThreadCtx)
+
+	igmpNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+
+	igmpNs.startupQueryCnt = p.StartupQueryCnt
+	igmpNs.startupQueryIvl = p.StartupQueryIvl
+	if p.QueryIvl > 0 {
+		igmpNs.queryIvl = p.QueryIvl
+	}
+
+	if p.Enable {
+		igmpNs.querierStart()
+	} else {
+		igmpNs.querierStop()
+	}
+	return nil, nil
+}
+
+func (h ApiIgmpQuerierGetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var res ApiIgmpQuerierGetResult
+
+	igmpNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	res.Enable = igmpNs.querier
+	res.Phase = igmpNs.getQuerierPhase()
+	res.StartupLeft = igmpNs.startupLeft
+	res.StartupQueryCnt = igmpNs.getStartupQueryCnt()
+	res.StartupQueryIvl = igmpNs.getStartupQueryIvl()
+	res.QueryIvl = igmpNs.queryIvl
 
 	return &res, nil
 }
@@ -1903,6 +2530,58 @@ func (h ApiIgmpNsRemoveHandler) ServeJSONRPC(ctx interface{}, params *fastjson.R
 	return nil, nil
 }
 
+func (h ApiIgmpClientJoinHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	var p ApiIgmpClientJoinParams
+	tctx := ctx.(*core.CThreadCtx)
+
+	c, err := getClient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 == nil {
+		err1 = c.Join(p.Vec)
+	}
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiIgmpClientLeaveHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	var p ApiIgmpClientJoinParams
+	tctx := ctx.(*core.CThreadCtx)
+
+	c, err := getClient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 == nil {
+		err1 = c.Leave(p.Vec)
+	}
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiIgmpClientRefsHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	c, err := getClient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &ApiIgmpClientRefsResult{Vec: c.getRefs()}, nil
+}
+
 func (h ApiIgmpNsAddSGHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
 	var p ApiIgmpNsAddSGParams
 	tctx := ctx.(*core.CThreadCtx)
@@ -2035,14 +2714,19 @@ func init() {
 	  aa - misc
 	*/
 
-	core.RegisterCB("igmp_ns_sg_add", ApiIgmpNsAddSGHandler{}, false)       // add (s,g) mc
-	core.RegisterCB("igmp_ns_sg_remove", ApiIgmpNsRemoveSGHandler{}, false) // remove (s,g) mc
-	core.RegisterCB("igmp_ns_cnt", ApiIgmpNsCntHandler{}, false)            // get counters/meta
-	core.RegisterCB("igmp_ns_add", ApiIgmpNsAddHandler{}, false)            // add mc (*)
-	core.RegisterCB("igmp_ns_remove", ApiIgmpNsRemoveHandler{}, false)      // remove mc(*) or global
-	core.RegisterCB("igmp_ns_iter", ApiIgmpNsIterHandler{}, false)          // iterator
-	core.RegisterCB("igmp_ns_get_cfg", ApiIgmpGetHandler{}, false)          // Get
-	core.RegisterCB("igmp_ns_set_cfg", ApiIgmpSetHandler{}, false)          // Set
+	core.RegisterCB("igmp_ns_sg_add", ApiIgmpNsAddSGHandler{}, false)         // add (s,g) mc
+	core.RegisterCB("igmp_ns_sg_remove", ApiIgmpNsRemoveSGHandler{}, false)   // remove (s,g) mc
+	core.RegisterCB("igmp_ns_cnt", ApiIgmpNsCntHandler{}, false)              // get counters/meta
+	core.RegisterCB("igmp_ns_add", ApiIgmpNsAddHandler{}, false)              // add mc (*)
+	core.RegisterCB("igmp_ns_remove", ApiIgmpNsRemoveHandler{}, false)        // remove mc(*) or global
+	core.RegisterCB("igmp_ns_iter", ApiIgmpNsIterHandler{}, false)            // iterator
+	core.RegisterCB("igmp_ns_get_cfg", ApiIgmpGetHandler{}, false)            // Get
+	core.RegisterCB("igmp_ns_set_cfg", ApiIgmpSetHandler{}, false)            // Set
+	core.RegisterCB("igmp_ns_querier_set", ApiIgmpQuerierSetHandler{}, false) // querier mode Set
+	core.RegisterCB("igmp_ns_querier_get", ApiIgmpQuerierGetHandler{}, false) // querier mode Get, including the phase
+	core.RegisterCB("igmp_c_join", ApiIgmpClientJoinHandler{}, false)         // join of an application, reference counted
+	core.RegisterCB("igmp_c_leave", ApiIgmpClientLeaveHandler{}, false)       // leave of an application, sent after the last reference
+	core.RegisterCB("igmp_c_refs", ApiIgmpClientRefsHandler{}, false)         // groups referenced by the client
 
 	/* register callback for rx side*/
 	core.ParserRegister("igmp", HandleRxIgmpPacket)
@@ -750,6 +750,128 @@ func TestPluginIgmp11(t *testing.T) {
 	a.Run(t)
 }
 
+type IgmpRpcJoinCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	test  *IgmpTestBase
+	cnt   uint32
+}
+
+func (o *IgmpRpcJoinCtx) OnEvent(a, b interface{}) {
+	if o.cnt == 0 {
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"igmp_ns_set_cfg",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "mtu": 1500, "robustness": 3, "unsolicited_ivl": 2000 },
+			"id": 3 }`))
+
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"igmp_ns_get_cfg",
+			"params": {"tun": {"vport":1,"tci":[1,2]} },
+			"id": 3 }`))
+
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"igmp_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "vec": [ [239,0,2,1],[239,0,2,2] ] },
+			"id": 3 }`))
+	}
+
+	if o.cnt == 1 {
+		// removed group should not be retransmitted
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"igmp_ns_remove",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "vec": [ [239,0,2,2] ] },
+			"id": 3 }`))
+	}
+
+	if o.cnt < 2 {
+		timerw := o.tctx.GetTimerCtx()
+		ticks := timerw.DurationToTicks(3 * time.Second)
+		timerw.StartTicks(&o.timer, ticks)
+	}
+	o.cnt += 1
+}
+
+func rpcQueueJoin(tctx *core.CThreadCtx, test *IgmpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(1 * time.Second)
+	var rpcctx IgmpRpcJoinCtx
+	rpcctx.timer.SetCB(&rpcctx, test.cbArg1, test.cbArg2)
+	rpcctx.tctx = tctx
+	rpcctx.test = test
+	timerw.StartTicks(&rpcctx.timer, ticks)
+	return 0
+}
+
+func TestPluginIgmp12(t *testing.T) {
+	a := &IgmpTestBase{
+		testname:     "igmp12",
+		dropAll:      true,
+		monitor:      false,
+		match:        4,
+		capture:      true,
+		duration:     20 * time.Second,
+		clientsToSim: 1,
+		cb:           rpcQueueJoin,
+	}
+	a.Run(t)
+}
+
+type IgmpRpcQuerierCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint32
+}
+
+func (o *IgmpRpcQuerierCtx) OnEvent(a, b interface{}) {
+	timerw := o.tctx.GetTimerCtx()
+	switch o.cnt {
+	case 0:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"igmp_ns_querier_set",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "enable": true, "startup_query_cnt": 3, "startup_query_ivl": 2000, "query_ivl": 10 },
+			"id": 3 }`))
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(2*time.Second))
+	case 1:
+		// still in the startup phase
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"igmp_ns_querier_get",
+			"params": {"tun": {"vport":1,"tci":[1,2]} },
+			"id": 3 }`))
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(10*time.Second))
+	case 2:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"igmp_ns_querier_get",
+			"params": {"tun": {"vport":1,"tci":[1,2]} },
+			"id": 3 }`))
+	}
+	o.cnt += 1
+}
+
+func rpcQueueQuerier(tctx *core.CThreadCtx, test *IgmpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(1 * time.Second)
+	var rpcctx IgmpRpcQuerierCtx
+	rpcctx.timer.SetCB(&rpcctx, test.cbArg1, test.cbArg2)
+	rpcctx.tctx = tctx
+	timerw.StartTicks(&rpcctx.timer, ticks)
+	return 0
+}
+
+/*TestPluginIgmp13 querier mode, 3 startup queries 2 sec apart and steady queries every 10 sec */
+func TestPluginIgmp13(t *testing.T) {
+	a := &IgmpTestBase{
+		testname:     "igmp13",
+		dropAll:      true,
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     40 * time.Second,
+		clientsToSim: 1,
+		cb:           rpcQueueQuerier,
+	}
+	a.Run(t)
+}
+
 func TestPluginIgmp20(t *testing.T) {
 	s := `{"jsonrpc": "2.0",
 		"method":"igmp_ns_sg_add",
@@ -762,6 +884,61 @@ func TestPluginIgmp20(t *testing.T) {
 	fmt.Printf(" %s \n", string(s))
 }
 
+// TestPluginIgmpAppRefs1 two applications of a client join the same group, a single report and a
+// single leave after the last reference, a management add/remove of the group keeps it joined
+func TestPluginIgmpAppRefs1(t *testing.T) {
+	var simVeth VethIgmpSim
+	simVeth.DropAll = true
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, 0)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := tctx.GetNs(&key)
+	nsPlug := ns.PluginCtx.Get(IGMP_PLUG).Ext.(*PluginIgmpNs)
+	client := ns.CLookupByMac(&core.MACKey{0, 0, 1, 0, 0, 1})
+	c := client.PluginCtx.Get(IGMP_PLUG).Ext.(*PluginIgmpClient)
+
+	g := core.Ipv4Key{239, 1, 1, 1}
+	if c.Join([]core.Ipv4Key{g}) != nil || c.Join([]core.Ipv4Key{g}) != nil {
+		t.Fatalf(" join should succeed \n")
+	}
+	st := &nsPlug.stats
+	if st.opsAppJoin != 2 || st.reportSuppressed != 1 || st.pktSndJoinReports != 1 || nsPlug.tbl.mapIgmp[g].refc != 2 {
+		t.Fatalf(" one report is expected for two joins %+v \n", *st)
+	}
+
+	// management add of a joined group, no report, and the leaves do not remove it
+	if nsPlug.addMc([]core.Ipv4Key{g}) != nil || st.reportSuppressed != 2 {
+		t.Fatalf(" management add of a joined group should be suppressed \n")
+	}
+	c.Leave([]core.Ipv4Key{g, g})
+	if _, ok := nsPlug.tbl.mapIgmp[g]; !ok || st.leaveSuppressed != 2 || st.opsAppLeave != 2 {
+		t.Fatalf(" group added by management should stay %+v \n", *st)
+	}
+
+	// the management removes the group without references, a leave
+	c.Join([]core.Ipv4Key{g})
+	if nsPlug.RemoveMc([]core.Ipv4Key{g}) != nil || st.leaveSuppressed != 3 {
+		t.Fatalf(" management remove of a referenced group should be suppressed \n")
+	}
+	c.Leave([]core.Ipv4Key{g})
+	if _, ok := nsPlug.tbl.mapIgmp[g]; ok || len(c.refs) != 0 {
+		t.Fatalf(" group should be removed after the last reference \n")
+	}
+	if c.Leave([]core.Ipv4Key{g}) == nil || st.opsAppErr != 1 {
+		t.Fatalf(" leave without a reference should fail \n")
+	}
+
+	// removing the client releases its references
+	c.Join([]core.Ipv4Key{g, {239, 1, 1, 2}})
+	ns.RemoveClient(client)
+	if len(nsPlug.tbl.mapIgmp) != 0 {
+		t.Fatalf(" the references of a removed client should be released \n")
+	}
+}
+
 func init() {
 	flag.IntVar(&monitor, "monitor", 0, "monitor")
 }
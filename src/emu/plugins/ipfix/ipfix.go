@@ -373,7 +373,7 @@ func (o *IPFixGen) calcMaxRecordsVarLength() uint32 {
 
 // sendTemplatePkt sends a Template packet
 func (o *IPFixGen) sendTemplatePkt() {
-	if o.enabled {
+	if o.enabled && !o.ipfixPlug.Ns.SuppressTx() {
 		ipfixVer := o.ipfixPlug.ver
 		payload := o.templatePayload
 		o.fixPayload(payload)
@@ -392,7 +392,7 @@ func (o *IPFixGen) sendTemplatePkt() {
 
 // sendDataPkt sends a burst of data packets (burst can be of size 1)
 func (o *IPFixGen) sendDataPkt() {
-	if o.enabled {
+	if o.enabled && !o.ipfixPlug.Ns.SuppressTx() {
 		ipfixVer := o.ipfixPlug.ver
 		// Only Data Packets can have bursts.
 		for i := 0; i < int(o.dataPktsPerInterval); i++ {
@@ -1009,7 +1009,7 @@ func (o *PluginIPFixClient) OnCreate() {
 		o.flowSeqNum = 0x12345678
 	}
 	// Timers
-	o.timerw = o.Tctx.GetTimerCtx()
+	o.timerw = o.Ns.GetTimerCtx()
 	o.sysStartTime = time.Now()
 	o.unixTimeNow = o.sysStartTime.Unix()
 	o.timer.SetCB(&o.timerCb, o, 0)
@@ -1041,6 +1041,11 @@ func (o *PluginIPFixClient) OnResolve() {
 
 }
 
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginIPFixClient) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
 // OnRemove is called when we are trying to remove this IPFix client.
 func (o *PluginIPFixClient) OnRemove(ctx *core.PluginCtx) {
 	ctx.UnregisterEvents(&o.PluginBase, ipfixEvents)
@@ -10,6 +10,7 @@ package ipv6
 RFC 4443: Internet Control Message Protocol (ICMPv6) for the Internet Protocol Version 6 (IPv6)
 RFC 4861: Neighbor Discovery for IP Version 6 (IPv6)
 RFC 4862: IPv6 Stateless Address Autoconfiguration.
+RFC 4620: IPv6 Node Information Queries (ni.go)
 
 not implemented:
 
@@ -18,13 +19,16 @@ RFC4941: random local ipv6 using md5
 */
 
 import (
+	"bytes"
 	"emu/core"
 	"emu/plugins/ping"
 	"encoding/binary"
 	"errors"
 	"external/google/gopacket/layers"
 	"external/osamingo/jsonrpc"
+	"fmt"
 	"net"
+	"sort"
 
 	"github.com/intel-go/fastjson"
 )
@@ -43,6 +47,9 @@ type pingNsStats struct {
 	pktRxErrMulticastB      uint64
 	pktRxNoClientUnhandled  uint64
 	pktRxIcmpDstUnreachable uint64
+
+	pktRxPolicyAnswered uint64 // echo requests answered by the on_link policy
+	pktRxPolicyDrop     uint64 // echo requests dropped by the source policy
 }
 
 func NewpingNsStatsDb(o *pingNsStats) *core.CCounterDb {
@@ -110,22 +117,53 @@ func NewpingNsStatsDb(o *pingNsStats) *core.CCounterDb {
 		Unit:     "ops",
 		DumpZero: false,
 		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxPolicyAnswered,
+		Name:     "pktRxPolicyAnswered",
+		Help:     "rx echo request from an on-link source answered by the policy",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxPolicyDrop,
+		Name:     "pktRxPolicyDrop",
+		Help:     "rx echo request dropped by the source policy",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
 
 	return db
 }
 
+// MldClientRef is a group referenced by the applications of a client, see ipv6_mld_c_refs
+type MldClientRef struct {
+	G    core.Ipv6Key `json:"g"`
+	Refc uint32       `json:"refc"`
+}
+
 // PluginIpv6Client icmp information per client
 type PluginIpv6Client struct {
 	core.PluginBase
 	ipv6NsPlug *PluginIpv6Ns
 	nd         NdClientCtx
+	ni         NiClientCtx
 	pingData   *ApiIpv6StartPingHandler
 	ping       *ping.Ping
+	pingRoute  *core.CClientRoute // static route toward the ping destination
+	// groups referenced by the applications of the client, see ipv6_mld_c_join
+	mldRefs map[core.Ipv6Key]uint32
+	// echo requests of allow_all, on_link or deny_all sources, see core.ICMP_SRC_ALLOW_ALL
+	srcPolicy uint8
+}
+
+type Ipv6ClientInit struct {
+	IcmpSrcPolicy string `json:"icmp_src_policy"` // echo requests of allow_all (default), on_link (link-local or the prefixes of the client) or deny_all sources
 }
 
 var icmpEvents = []string{core.MSG_UPDATE_IPV6_ADDR,
 	core.MSG_UPDATE_DGIPV6_ADDR,
-	core.MSG_UPDATE_DIPV6_ADDR}
+	core.MSG_UPDATE_DIPV6_ADDR,
+	core.MSG_UPDATE_ROUTES}
 
 /*NewIpv6Client create plugin */
 func NewIpv6Client(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
@@ -135,6 +173,11 @@ func NewIpv6Client(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 	nsplg := o.Ns.PluginCtx.GetOrCreate(IPV6_PLUG)
 	o.ipv6NsPlug = nsplg.Ext.(*PluginIpv6Ns)
 	o.nd.Init(o, &o.ipv6NsPlug.nd, o.Tctx, &o.ipv6NsPlug.mld, initJson)
+	o.ni.Init(initJson)
+	var init Ipv6ClientInit
+	if err := fastjson.Unmarshal(initJson, &init); err == nil {
+		o.srcPolicy, _ = core.ParseIcmpSrcPolicy(init.IcmpSrcPolicy)
+	}
 	o.OnCreate()
 	return &o.PluginBase
 }
@@ -142,10 +185,22 @@ func NewIpv6Client(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 /*OnEvent support event change of IP  */
 func (o *PluginIpv6Client) OnEvent(msg string, a, b interface{}) {
 	o.nd.OnEvent(msg, a, b)
+	if msg == core.MSG_UPDATE_ROUTES && o.ping != nil {
+		o.ping.UpdatePacketTemplate()
+	}
 }
 
 func (o *PluginIpv6Client) OnRemove(ctx *core.PluginCtx) {
 	o.StopPing()
+	// the applications of a removed client release all their references
+	var vec []core.Ipv6Key
+	for g, n := range o.mldRefs {
+		for i := uint32(0); i < n; i++ {
+			vec = append(vec, g)
+		}
+	}
+	sort.Slice(vec, func(i, j int) bool { return bytes.Compare(vec[i][:], vec[j][:]) < 0 })
+	o.MldLeave(vec)
 	/* force removing the link to the client */
 	o.nd.OnRemove(ctx)
 	ctx.UnregisterEvents(&o.PluginBase, icmpEvents)
@@ -154,6 +209,57 @@ func (o *PluginIpv6Client) OnRemove(ctx *core.PluginCtx) {
 func (o *PluginIpv6Client) OnCreate() {
 }
 
+// MldJoin adds a reference of an application of the client to each group, a report is sent only
+// for the groups that were not joined
+func (o *PluginIpv6Client) MldJoin(vec []core.Ipv6Key) error {
+	n, err := o.ipv6NsPlug.mld.appJoin(vec)
+	if n > 0 && o.mldRefs == nil {
+		o.mldRefs = make(map[core.Ipv6Key]uint32)
+	}
+	for _, g := range vec[:n] {
+		o.mldRefs[g]++
+	}
+	return err
+}
+
+// MldLeave removes a reference of an application of the client from each group, a leave is sent
+// only for the groups without references
+func (o *PluginIpv6Client) MldLeave(vec []core.Ipv6Key) error {
+	var err error
+	n := len(vec)
+	used := make(map[core.Ipv6Key]uint32)
+	for i, g := range vec {
+		if used[g] == o.mldRefs[g] {
+			o.ipv6NsPlug.mld.stats.opsAppErr++
+			err = fmt.Errorf(" client %v does not reference mc-ipv6 %v", o.Client.Mac, g)
+			n = i
+			break
+		}
+		used[g]++
+	}
+	n, err1 := o.ipv6NsPlug.mld.appLeave(vec[:n])
+	for _, g := range vec[:n] {
+		o.mldRefs[g]--
+		if o.mldRefs[g] == 0 {
+			delete(o.mldRefs, g)
+		}
+	}
+	if err1 != nil {
+		return err1
+	}
+	return err
+}
+
+// getMldRefs returns the groups referenced by the applications of the client, sorted
+func (o *PluginIpv6Client) getMldRefs() []MldClientRef {
+	r := make([]MldClientRef, 0, len(o.mldRefs))
+	for g, n := range o.mldRefs {
+		r = append(r, MldClientRef{G: g, Refc: n})
+	}
+	sort.Slice(r, func(i, j int) bool { return bytes.Compare(r[i].G[:], r[j].G[:]) < 0 })
+	return r
+}
+
 //StartPing creates a ping object in case there isn't any.
 func (o *PluginIpv6Client) StartPing(data *ApiIpv6StartPingHandler) bool {
 	if o.ping != nil {
@@ -217,11 +323,13 @@ func (o *PluginIpv6Client) PreparePingPacketTemplate(id, seq uint16, magic uint6
 	srcIPv6 := o.pingData.Src
 	dstIPv6 := o.pingData.Dst
 	pkt = o.Client.GetL2Header(false, uint16(layers.EthernetTypeIPv6))
+	o.pingRoute = nil
 	if !o.Client.IsDGIpv6(dstIPv6) {
-		dstMac, ok := o.Client.ResolveIPv6DGMac()
+		dstMac, route, ok := o.Client.ResolveIPv6RouteMac(dstIPv6)
 		if ok {
 			layers.EthernetHeader(pkt).SetDestAddress(dstMac[:])
 		}
+		o.pingRoute = route
 	} else {
 		dgIpv6, dgMac, ok := o.Client.ResolveDGv6()
 		if ok {
@@ -264,6 +372,9 @@ func (o *PluginIpv6Client) PreparePingPacketTemplate(id, seq uint16, magic uint6
 // UpdateTxIcmpQuery implements ping.PingClientIF.UpdateTxIcmpQuery by incrementing the Tx Query every time an echo request is sent.
 func (o *PluginIpv6Client) UpdateTxIcmpQuery(pktSent uint64) {
 	o.ipv6NsPlug.stats.pktTxIcmpQuery += pktSent
+	if o.pingRoute != nil {
+		o.pingRoute.Pkts += pktSent
+	}
 
 }
 
@@ -282,6 +393,7 @@ type PluginIpv6Ns struct {
 	cdbv  *core.CCounterDbVec
 	mld   mldNsCtx
 	nd    NdNsCtx
+	ni    NiNsCtx
 }
 
 func NewIpv6Ns(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
@@ -292,13 +404,31 @@ func NewIpv6Ns(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 	o.cdbv = core.NewCCounterDbVec("ipv6")
 	o.mld.Init(o, o.Tctx, initJson)
 	o.nd.Init(o, o.Tctx, initJson)
+	o.ni.Init(o, o.Tctx)
 
 	o.cdbv.Add(o.cdb)
 	o.cdbv.Add(o.mld.cdb)
 	o.cdbv.Add(o.nd.cdb)
+	o.cdbv.Add(o.ni.cdb)
 	return &o.PluginBase
 }
 
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginIpv6Ns) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
+// Ipv6NsState the state of the namespace in ctx_get_state
+type Ipv6NsState struct {
+	NdCache []Ipv6NsCacheRec   `json:"nd_cache"`
+	Mld     []MldEntryDataJson `json:"mld"`
+}
+
+// GetState the nd cache and the mld memberships of the namespace, see ctx_get_state
+func (o *PluginIpv6Ns) GetState() interface{} {
+	return &Ipv6NsState{NdCache: o.nd.tbl.GetAll(), Mld: o.mld.GetAll()}
+}
+
 func (o *PluginIpv6Ns) OnRemove(ctx *core.PluginCtx) {
 	o.mld.OnRemove(ctx)
 	o.nd.OnRemove(ctx)
@@ -350,6 +480,7 @@ func (o *PluginIpv6Ns) HandleEcho(ps *core.ParserPacketState, ts bool) {
 		uint16(layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoRequest, 0)),
 		uint16(layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoReply, 0)))
 	binary.BigEndian.PutUint16(p[ps.L4+2:ps.L4+4], newCs)
+	o.Ns.ReflectRewrite(p, ps.L3, true)
 
 	o.stats.pktRxIcmpQuery++
 	o.stats.pktTxIcmpResponse++
@@ -461,6 +592,28 @@ func (o *PluginIpv6Ns) HandleDestinationUnreachable(ps *core.ParserPacketState)
 	}
 }
 
+// allowEcho checks the source of an echo request by the source policy of the client. The link-local
+// sources and the sources in the /64 prefixes of the client are on link.
+func (o *PluginIpv6Ns) allowEcho(client *core.CClient, src net.IP) bool {
+	plug := client.PluginCtx.Get(IPV6_PLUG)
+	if plug == nil {
+		return true
+	}
+	c := plug.Ext.(*PluginIpv6Client)
+	switch c.srcPolicy {
+	case core.ICMP_SRC_DENY_ALL:
+		o.stats.pktRxPolicyDrop++
+		return false
+	case core.ICMP_SRC_ON_LINK:
+		if c.nd.isOffSubnet(src) {
+			o.stats.pktRxPolicyDrop++
+			return false
+		}
+		o.stats.pktRxPolicyAnswered++
+	}
+	return true
+}
+
 /* HandleRxIcmpPacket -1 for parser error, 0 valid  */
 func (o *PluginIpv6Ns) HandleRxIpv6Packet(ps *core.ParserPacketState) int {
 
@@ -501,6 +654,10 @@ func (o *PluginIpv6Ns) HandleRxIpv6Packet(ps *core.ParserPacketState) int {
 			return 0
 		}
 
+		if !o.allowEcho(client, net.IP(ipv6.SrcIP())) {
+			return 0
+		}
+
 		o.HandleEcho(ps, false)
 	case layers.CreateICMPv6TypeCode(layers.ICMPv6TypeMLDv1MulticastListenerQueryMessage, 0),
 		layers.CreateICMPv6TypeCode(layers.ICMPv6TypeMLDv1MulticastListenerReportMessage, 0),
@@ -514,6 +671,10 @@ func (o *PluginIpv6Ns) HandleRxIpv6Packet(ps *core.ParserPacketState) int {
 		layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborAdvertisement, 0),
 		layers.CreateICMPv6TypeCode(layers.ICMPv6TypeRedirect, 0):
 		return o.nd.HandleRxIpv6NdPacket(ps, icmpv6.TypeCode) // MLD, MLDv2
+	case layers.CreateICMPv6TypeCode(ICMPV6_NI_QUERY, NI_CODE_SUBJECT_IPV6),
+		layers.CreateICMPv6TypeCode(ICMPV6_NI_QUERY, NI_CODE_SUBJECT_NAME),
+		layers.CreateICMPv6TypeCode(ICMPV6_NI_QUERY, NI_CODE_SUBJECT_IPV4):
+		return o.ni.HandleRxNiQuery(ps) // RFC 4620
 	case layers.CreateICMPv6TypeCode(layers.ICMPv6TypeEchoReply, 0):
 		res := o.HandleEchoReply(ps)
 		if res == core.PARSER_ERR {
@@ -613,6 +774,19 @@ type (
 		Vec []core.Ipv6Key `json:"vec"`
 	}
 
+	// join/leave of an application of a client, reference counted per group
+	ApiMldClientJoinHandler struct{}
+	ApiMldClientJoinParams  struct {
+		Vec []core.Ipv6Key `json:"vec"`
+	} /* key tunnel, mac */
+
+	ApiMldClientLeaveHandler struct{}
+
+	ApiMldClientRefsHandler struct{}
+	ApiMldClientRefsResult  struct {
+		Vec []MldClientRef `json:"vec"`
+	}
+
 	ApiMldNsIterHandler struct{}
 	ApiMldNsIterParams  struct {
 		Reset bool   `json:"reset"`
@@ -626,16 +800,38 @@ type (
 
 	ApiMldSetHandler struct{}
 	ApiMldSetParams  struct {
-		Mtu           uint16      `json:"mtu" validate:"required,gte=256,lte=9000"`
-		DesignatorMac core.MACKey `json:"dmac"`
+		Mtu            uint16      `json:"mtu" validate:"required,gte=256,lte=9000"`
+		DesignatorMac  core.MACKey `json:"dmac"`
+		Robustness     uint8       `json:"robustness" validate:"lte=7"`
+		UnsolicitedIvl uint32      `json:"unsolicited_ivl"`
 	}
 
 	ApiMldGetHandler struct{}
 
 	ApiMldGetResult struct {
-		Mtu           uint16      `json:"mtu"`
-		DesignatorMac core.MACKey `json:"dmac"`
-		Version       uint8       `json:"version"`
+		Mtu            uint16      `json:"mtu"`
+		DesignatorMac  core.MACKey `json:"dmac"`
+		Version        uint8       `json:"version"`
+		Robustness     uint8       `json:"robustness"`
+		UnsolicitedIvl uint32      `json:"unsolicited_ivl"`
+	}
+
+	ApiMldQuerierSetHandler struct{}
+	ApiMldQuerierSetParams  struct {
+		Enable          bool   `json:"enable"`
+		StartupQueryCnt uint8  `json:"startup_query_cnt"`
+		StartupQueryIvl uint32 `json:"startup_query_ivl"`
+		QueryIvl        uint32 `json:"query_ivl"`
+	}
+
+	ApiMldQuerierGetHandler struct{}
+	ApiMldQuerierGetResult  struct {
+		Enable          bool   `json:"enable"`
+		Phase           string `json:"phase"`
+		StartupLeft     uint8  `json:"startup_left"`
+		StartupQueryCnt uint8  `json:"startup_query_cnt"`
+		StartupQueryIvl uint32 `json:"startup_query_ivl"`
+		QueryIvl        uint32 `json:"query_ivl"`
 	}
 
 	ApiNdNsIterHandler struct{} // iterate on the nd ipv6 cache table
@@ -649,6 +845,21 @@ type (
 		Vec     []Ipv6NsCacheRec `json:"data"`
 	}
 
+	ApiNdNsSetStaleHandler struct{} // force an entry of the nd cache to stale
+	ApiNdNsSetStaleParams  struct {
+		Ipv6 core.Ipv6Key `json:"ipv6"`
+	}
+
+	ApiNdCGetSlaacHandler struct{} // the SLAAC address of the client and its lifetimes
+
+	ApiNdNsGetUnaHandler struct{} // the last unsolicited NAs of the neighbors
+	ApiNdNsGetUnaParams  struct {
+		Clear bool `json:"clear"`
+	}
+	ApiNdNsGetUnaResult struct {
+		Vec []core.CNeighborAnnounce `json:"data"`
+	}
+
 	ApiIpv6StartPingHandler struct {
 		Amount      uint32       `json:"amount"  validate:"ne=0"`       // Amount of echo requests to send
 		Pace        float32      `json:"pace"    validate:"ne=0"`       // Pace of sending the Echo-Requests in packets per second.
@@ -770,6 +981,58 @@ func (h ApiMldNsAddHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMe
 	return nil, nil
 }
 
+func (h ApiMldClientJoinHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	var p ApiMldClientJoinParams
+	tctx := ctx.(*core.CThreadCtx)
+
+	c, err := getClient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 == nil {
+		err1 = c.MldJoin(p.Vec)
+	}
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiMldClientLeaveHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	var p ApiMldClientJoinParams
+	tctx := ctx.(*core.CThreadCtx)
+
+	c, err := getClient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 == nil {
+		err1 = c.MldLeave(p.Vec)
+	}
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiMldClientRefsHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	c, err := getClient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &ApiMldClientRefsResult{Vec: c.getMldRefs()}, nil
+}
+
 func (h ApiMldNsRemoveHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
 	var p ApiMldNsRemoveParams
 	tctx := ctx.(*core.CThreadCtx)
@@ -908,6 +1171,14 @@ func (h ApiMldSetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMess
 	if !p.DesignatorMac.IsZero() {
 		ipv6Ns.mld.designatorMac = p.DesignatorMac
 	}
+
+	if p.Robustness > 0 {
+		ipv6Ns.mld.robustness = p.Robustness
+	}
+
+	if p.UnsolicitedIvl > 0 {
+		ipv6Ns.mld.unsolicitedIvl = p.UnsolicitedIvl
+	}
 	return nil, nil
 }
 
@@ -926,10 +1197,142 @@ func (h ApiMldGetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMess
 	res.Mtu = ipv6Ns.mld.mtu
 	res.DesignatorMac = ipv6Ns.mld.designatorMac
 	res.Version = uint8(ipv6Ns.mld.mldVersion)
+	res.Robustness = ipv6Ns.mld.robustness
+	res.UnsolicitedIvl = ipv6Ns.mld.unsolicitedIvl
 
 	return &res, nil
 }
 
+func (h ApiMldQuerierSetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiMldQuerierSetParams
+
+	tctx := ctx.(*core.CThreadCtx)
+
+	ipv6Ns, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+
+	mld := &ipv6Ns.mld
+	mld.startupQueryCnt = p.StartupQueryCnt
+	mld.startupQueryIvl = p.StartupQueryIvl
+	if p.QueryIvl > 0 {
+		mld.queryIvl = p.QueryIvl
+	}
+
+	if p.Enable {
+		mld.querierStart()
+	} else {
+		mld.querierStop()
+	}
+	return nil, nil
+}
+
+func (h ApiMldQuerierGetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var res ApiMldQuerierGetResult
+
+	ipv6Ns, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	mld := &ipv6Ns.mld
+	res.Enable = mld.querier
+	res.Phase = mld.getQuerierPhase()
+	res.StartupLeft = mld.startupLeft
+	res.StartupQueryCnt = mld.getStartupQueryCnt()
+	res.StartupQueryIvl = mld.getStartupQueryIvl()
+	res.QueryIvl = mld.queryIvl
+
+	return &res, nil
+}
+
+func (h ApiNdNsGetUnaHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiNdNsGetUnaParams
+	var res ApiNdNsGetUnaResult
+
+	tctx := ctx.(*core.CThreadCtx)
+
+	ipv6Ns, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+
+	res.Vec = ipv6Ns.nd.unas.Get()
+	if p.Clear {
+		ipv6Ns.nd.unas.Clear()
+	}
+	return &res, nil
+}
+
+func (h ApiNdNsSetStaleHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiNdNsSetStaleParams
+	tctx := ctx.(*core.CThreadCtx)
+
+	ipv6Ns, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err = tctx.UnmarshalValidate(*params, &p)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err = ipv6Ns.nd.SetStale(p.Ipv6)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiNdCGetSlaacHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	c, err := getClient(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.nd.nsPlug.SlaacState(c.Client), nil
+}
+
 func (h ApiNdNsIterHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
 
 	var p ApiNdNsIterParams
@@ -1074,18 +1477,26 @@ func init() {
 	  aa - misc
 	*/
 
-	core.RegisterCB("ipv6_ns_cnt", ApiIpv6NsCntHandler{}, false)               // get counter mld/icmp/nd
-	core.RegisterCB("ipv6_mld_ns_sg_add", ApiMldNsAddSGHandler{}, false)       // add (g,s) mc
-	core.RegisterCB("ipv6_mld_ns_sg_remove", ApiMldNsRemoveSGHandler{}, false) // remove (g,s) mc
-	core.RegisterCB("ipv6_mld_ns_add", ApiMldNsAddHandler{}, false)            // mld add
-	core.RegisterCB("ipv6_mld_ns_remove", ApiMldNsRemoveHandler{}, false)      // mld remove
-	core.RegisterCB("ipv6_mld_ns_iter", ApiMldNsIterHandler{}, false)          // mld iterator
-	core.RegisterCB("ipv6_mld_ns_get_cfg", ApiMldGetHandler{}, false)          // mld Get
-	core.RegisterCB("ipv6_mld_ns_set_cfg", ApiMldSetHandler{}, false)          // mld Set
-	core.RegisterCB("ipv6_nd_ns_iter", ApiNdNsIterHandler{}, false)            // nd ipv6 cache table iterator
-	core.RegisterCB("ipv6_start_ping", ApiIpv6StartPingHandler{}, true)        // start ping
-	core.RegisterCB("ipv6_stop_ping", ApiIpv6StopPingHandler{}, true)          // stop ping
-	core.RegisterCB("ipv6_get_ping_stats", ApiIpv6GetPingStatsHandler{}, true) // get ping stats
+	core.RegisterCB("ipv6_ns_cnt", ApiIpv6NsCntHandler{}, false)                 // get counter mld/icmp/nd
+	core.RegisterCB("ipv6_mld_ns_sg_add", ApiMldNsAddSGHandler{}, false)         // add (g,s) mc
+	core.RegisterCB("ipv6_mld_ns_sg_remove", ApiMldNsRemoveSGHandler{}, false)   // remove (g,s) mc
+	core.RegisterCB("ipv6_mld_ns_add", ApiMldNsAddHandler{}, false)              // mld add
+	core.RegisterCB("ipv6_mld_ns_remove", ApiMldNsRemoveHandler{}, false)        // mld remove
+	core.RegisterCB("ipv6_mld_ns_iter", ApiMldNsIterHandler{}, false)            // mld iterator
+	core.RegisterCB("ipv6_mld_c_join", ApiMldClientJoinHandler{}, false)         // mld join of an application, reference counted
+	core.RegisterCB("ipv6_mld_c_leave", ApiMldClientLeaveHandler{}, false)       // mld leave of an application, sent after the last reference
+	core.RegisterCB("ipv6_mld_c_refs", ApiMldClientRefsHandler{}, false)         // groups referenced by the client
+	core.RegisterCB("ipv6_mld_ns_get_cfg", ApiMldGetHandler{}, false)            // mld Get
+	core.RegisterCB("ipv6_mld_ns_set_cfg", ApiMldSetHandler{}, false)            // mld Set
+	core.RegisterCB("ipv6_mld_ns_querier_set", ApiMldQuerierSetHandler{}, false) // mld querier mode Set
+	core.RegisterCB("ipv6_mld_ns_querier_get", ApiMldQuerierGetHandler{}, false) // mld querier mode Get, including the phase
+	core.RegisterCB("ipv6_nd_ns_iter", ApiNdNsIterHandler{}, false)              // nd ipv6 cache table iterator
+	core.RegisterCB("ipv6_nd_ns_get_una", ApiNdNsGetUnaHandler{}, false)         // nd unsolicited NAs of the neighbors
+	core.RegisterCB("ipv6_nd_ns_set_stale", ApiNdNsSetStaleHandler{}, false)     // force a nd cache entry to stale
+	core.RegisterCB("ipv6_nd_c_get_slaac", ApiNdCGetSlaacHandler{}, false)       // slaac address state and lifetimes
+	core.RegisterCB("ipv6_start_ping", ApiIpv6StartPingHandler{}, true)          // start ping
+	core.RegisterCB("ipv6_stop_ping", ApiIpv6StopPingHandler{}, true)            // stop ping
+	core.RegisterCB("ipv6_get_ping_stats", ApiIpv6GetPingStatsHandler{}, true)   // get ping stats
 
 	/* register callback for rx side*/
 	core.ParserRegister("icmpv6", HandleRxIcmpv6Packet) // support mld/icmp/nd
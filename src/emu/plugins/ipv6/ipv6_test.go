@@ -32,6 +32,9 @@ type IcmpTestBase struct {
 	cb           IcmpTestCb
 	cbArg1       interface{}
 	cbArg2       interface{}
+	clientInit   []byte        // ipv6 client plugin init json
+	nsInit       []byte        // ipv6 namespace plugin init json
+	firstQuery   time.Duration // time of the first injected packet, default is 1 second
 }
 
 type IcmpTestCb func(tctx *core.CThreadCtx, test *IcmpTestBase) int
@@ -104,10 +107,16 @@ func createSimulationEnv(simRx *core.VethIFSim, num int, mcSim int, test *IcmpTe
 				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03}
 		}
 		ns.AddClient(client)
-		if mcSim > 0 || test.flush > 0 {
+		if test.nsInit != nil {
+			ns.PluginCtx.CreatePlugins([]string{"ipv6"}, [][]byte{test.nsInit})
+		} else if mcSim > 0 || test.flush > 0 {
 			ns.PluginCtx.CreatePlugins([]string{"ipv6"}, [][]byte{[]byte(`{"dmac" :[0, 0, 1, 0, 0, 0]  } `)})
 		}
-		client.PluginCtx.CreatePlugins([]string{"ipv6"}, [][]byte{})
+		if test.clientInit != nil {
+			client.PluginCtx.CreatePlugins([]string{"ipv6"}, [][]byte{test.clientInit})
+		} else {
+			client.PluginCtx.CreatePlugins([]string{"ipv6"}, [][]byte{})
+		}
 	}
 	tctx.RegisterParserCb("icmpv6")
 
@@ -583,6 +592,184 @@ func (o *IcmpQueryCtx) OnEvent(a, b interface{}) {
 		binary.BigEndian.PutUint16(pkt[icmppyof+2:icmppyof+4], cs)
 		raw = pkt
 
+	case 8:
+		/* node information queries, a different qtype each time */
+		client := []byte{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02}
+		other := []byte{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x09}
+		code := uint8(NI_CODE_SUBJECT_IPV6)
+		var qtype, flags uint16
+		subject := client
+		switch o.cnt - 0xabcd {
+		case 0:
+			qtype = NI_QTYPE_SUPPORTED
+		case 1:
+			qtype = NI_QTYPE_NODE_NAME
+		case 2:
+			qtype = NI_QTYPE_NODE_ADDR
+			flags = NI_FLAG_ALL
+		case 3:
+			qtype = NI_QTYPE_IPV4_ADDR
+			code = NI_CODE_SUBJECT_NAME
+			subject = []byte{5, 'H', 'o', 's', 't', '1', 0, 0}
+		case 4:
+			qtype = 9 // unknown
+		default:
+			qtype = NI_QTYPE_NODE_NAME
+			subject = other
+		}
+		ni := make([]byte, 12)
+		binary.BigEndian.PutUint16(ni[0:2], qtype)
+		binary.BigEndian.PutUint16(ni[2:4], flags)
+		copy(ni[4:12], []byte{1, 2, 3, 4, 5, 6, 7, uint8(o.cnt)}) // nonce
+		ni = append(ni, subject...)
+
+		gopacket.SerializeLayers(buf, opts,
+			&layers.Ethernet{
+				SrcMAC:       net.HardwareAddr{0, 0, 0, 2, 0, 0},
+				DstMAC:       net.HardwareAddr{0, 0, 1, 0, 0, 0},
+				EthernetType: layers.EthernetTypeDot1Q,
+			},
+			&layers.Dot1Q{
+				Priority:       uint8(0),
+				VLANIdentifier: uint16(1),
+				Type:           layers.EthernetTypeDot1Q,
+			},
+			&layers.Dot1Q{
+				Priority:       uint8(0),
+				VLANIdentifier: uint16(2),
+				Type:           layers.EthernetTypeIPv6,
+			},
+
+			&layers.IPv6{
+				Version:      6,
+				TrafficClass: 0,
+				FlowLabel:    0,
+				Length:       8,
+				NextHeader:   layers.IPProtocolICMPv6,
+				HopLimit:     64,
+				SrcIP:        net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+				DstIP:        net.IP(client),
+			},
+
+			&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(ICMPV6_NI_QUERY, code)},
+			gopacket.Payload(ni),
+		)
+		pkt := buf.Bytes()
+		off := 14 + 8
+		ipv6 := layers.IPv6Header(pkt[off : off+40])
+		ipv6.SetPyloadLength(uint16(len(pkt) - off - 40))
+		ipv6.FixIcmpL4Checksum(pkt[off+40:], 0)
+		raw = pkt
+
+	case 9:
+		/* additional link-locals fe80::1 and fe80::2, DAD of another node on fe80::2 and then solicitations */
+		src := net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+		dst := net.IP{0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xff, 0x00, 0x00, 0x01}
+		target := net.IP{0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+		option := []byte{0x01, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00}
+		switch o.cnt - 0xabcd {
+		case 0:
+			src = net.IPv6unspecified
+			option = []byte{}
+			dst[15] = 2
+			target[15] = 2
+		case 1:
+		default:
+			dst[15] = 2
+			target[15] = 2
+		}
+		gopacket.SerializeLayers(buf, opts,
+			&layers.Ethernet{
+				SrcMAC:       net.HardwareAddr{0, 0, 0, 2, 0, 0},
+				DstMAC:       net.HardwareAddr{0x33, 0x33, 0xff, 0, 0, dst[15]},
+				EthernetType: layers.EthernetTypeDot1Q,
+			},
+			&layers.Dot1Q{
+				Priority:       uint8(0),
+				VLANIdentifier: uint16(1),
+				Type:           layers.EthernetTypeDot1Q,
+			},
+			&layers.Dot1Q{
+				Priority:       uint8(0),
+				VLANIdentifier: uint16(2),
+				Type:           layers.EthernetTypeIPv6,
+			},
+
+			&layers.IPv6{
+				Version:      6,
+				TrafficClass: 0,
+				FlowLabel:    0,
+				Length:       8,
+				NextHeader:   layers.IPProtocolICMPv6,
+				HopLimit:     255,
+				SrcIP:        src,
+				DstIP:        dst,
+			},
+
+			&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborSolicitation, 0)},
+
+			&layers.ICMPv6NeighborSolicitation{
+				TargetAddress: target,
+			},
+			gopacket.Payload(option),
+		)
+		pkt := buf.Bytes()
+		off := 14 + 8
+		ipv6 := layers.IPv6Header(pkt[off : off+40])
+		ipv6.SetPyloadLength(uint16(len(pkt) - off - 40))
+		ipv6.FixIcmpL4Checksum(pkt[off+40:], 0)
+		raw = pkt
+
+	case 10:
+		/* solicitations of the static ipv6 from the /64 of the client and from another prefix */
+		src := net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+		if (o.cnt-0xabcd)%2 == 1 {
+			src = net.IP{0x20, 0x01, 0x0d, 0xb9, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}
+		}
+		dst := net.IP{0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0xff, 0x00, 0x00, 0x02}
+		target := net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02}
+		gopacket.SerializeLayers(buf, opts,
+			&layers.Ethernet{
+				SrcMAC:       net.HardwareAddr{0, 0, 0, 2, 0, 0},
+				DstMAC:       net.HardwareAddr{0x33, 0x33, 0xff, 0, 0, 2},
+				EthernetType: layers.EthernetTypeDot1Q,
+			},
+			&layers.Dot1Q{
+				Priority:       uint8(0),
+				VLANIdentifier: uint16(1),
+				Type:           layers.EthernetTypeDot1Q,
+			},
+			&layers.Dot1Q{
+				Priority:       uint8(0),
+				VLANIdentifier: uint16(2),
+				Type:           layers.EthernetTypeIPv6,
+			},
+
+			&layers.IPv6{
+				Version:      6,
+				TrafficClass: 0,
+				FlowLabel:    0,
+				Length:       8,
+				NextHeader:   layers.IPProtocolICMPv6,
+				HopLimit:     255,
+				SrcIP:        src,
+				DstIP:        dst,
+			},
+
+			&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborSolicitation, 0)},
+
+			&layers.ICMPv6NeighborSolicitation{
+				TargetAddress: target,
+			},
+			gopacket.Payload([]byte{0x01, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00}),
+		)
+		pkt := buf.Bytes()
+		off := 14 + 8
+		ipv6 := layers.IPv6Header(pkt[off : off+40])
+		ipv6.SetPyloadLength(uint16(len(pkt) - off - 40))
+		ipv6.FixIcmpL4Checksum(pkt[off+40:], 0)
+		raw = pkt
+
 	}
 
 	o.cnt += 1
@@ -602,6 +789,9 @@ func (o *IcmpQueryCtx) OnEvent(a, b interface{}) {
 func Cb4(tctx *core.CThreadCtx, test *IcmpTestBase) int {
 	timerw := tctx.GetTimerCtx()
 	ticks := timerw.DurationToTicks(1 * time.Second)
+	if test.firstQuery > 0 {
+		ticks = timerw.DurationToTicks(test.firstQuery)
+	}
 	var arpctx IcmpQueryCtx
 	arpctx.match = test.match
 	arpctx.cnt = 0xabcd
@@ -829,6 +1019,63 @@ func TestPluginMldv2_rpc1(t *testing.T) {
 	a.Run(t, true) // the timestamp making a new json due to the timestamp. skip the it
 }
 
+type ipv6RpcQuerierCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint32
+}
+
+func (o *ipv6RpcQuerierCtx) OnEvent(a, b interface{}) {
+	timerw := o.tctx.GetTimerCtx()
+	switch o.cnt {
+	case 0:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"ipv6_mld_ns_querier_set",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "enable": true, "startup_query_cnt": 3, "startup_query_ivl": 2000, "query_ivl": 10 },
+			"id": 3 }`))
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(2*time.Second))
+	case 1:
+		// still in the startup phase
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"ipv6_mld_ns_querier_get",
+			"params": {"tun": {"vport":1,"tci":[1,2]} },
+			"id": 3 }`))
+		timerw.StartTicks(&o.timer, timerw.DurationToTicks(10*time.Second))
+	case 2:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"ipv6_mld_ns_querier_get",
+			"params": {"tun": {"vport":1,"tci":[1,2]} },
+			"id": 3 }`))
+	}
+	o.cnt += 1
+}
+
+func rpcQueueQuerier(tctx *core.CThreadCtx, test *IcmpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(1 * time.Second)
+	var tstctx ipv6RpcQuerierCtx
+	tstctx.timer.SetCB(&tstctx, test.cbArg1, test.cbArg2)
+	tstctx.tctx = tctx
+	timerw.StartTicks(&tstctx.timer, ticks)
+	return 0
+}
+
+/*TestPluginMldv2_querier querier mode, 3 startup queries 2 sec apart and steady queries every 10 sec */
+func TestPluginMldv2_querier(t *testing.T) {
+
+	a := &IcmpTestBase{
+		testname:     "mld2_querier",
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     40 * time.Second,
+		clientsToSim: 1,
+		mcToSim:      1,
+		cb:           rpcQueueQuerier,
+	}
+	a.Run(t, true)
+}
+
 func TestPluginNd_adv1(t *testing.T) {
 
 	a := &IcmpTestBase{
@@ -894,6 +1141,94 @@ func TestPluginNd_adv3(t *testing.T) {
 	a.Run(t, true) // the timestamp making a new json due to the timestamp. skip the it
 }
 
+// optimistic DAD, a DAD from another node invalidates the link-local address,
+// the global address becomes preferred
+func TestPluginNd_optimistic1(t *testing.T) {
+
+	a := &IcmpTestBase{
+		testname:     "ipv6nd_optimistic1",
+		monitor:      false,
+		match:        6,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		cb:           Cb4,
+		flush:        1,
+		clientInit:   []byte(`{"nd_optimistic_dad": true}`),
+		firstQuery:   500 * time.Millisecond,
+	}
+	a.Run(t, true)
+}
+
+// node information queries, supported qtypes, name, addresses, unknown qtype and a wrong subject
+func TestPluginIpv6Ni1(t *testing.T) {
+
+	a := &IcmpTestBase{
+		testname:     "ipv6ni1",
+		monitor:      false,
+		match:        8,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		cb:           Cb4,
+		clientInit:   []byte(`{"ni_enable": true, "ni_name": "host1"}`),
+	}
+	a.Run(t, true)
+}
+
+// node information is disabled by default, the queries are ignored
+func TestPluginIpv6Ni2(t *testing.T) {
+
+	a := &IcmpTestBase{
+		testname:     "ipv6ni2",
+		monitor:      false,
+		match:        8,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		cb:           Cb4,
+	}
+	a.Run(t, true)
+}
+
+// additional link-local addresses, DAD conflict on fe80::2 while it is tentative,
+// fe80::1 is answered and fe80::2 is not
+// the solicitation of a source outside the prefix of the client is not answered
+func TestPluginNd_offSubnet1(t *testing.T) {
+
+	a := &IcmpTestBase{
+		testname:     "ipv6nd_offsubnet1",
+		monitor:      false,
+		match:        10,
+		capture:      true,
+		duration:     30 * time.Second,
+		clientsToSim: 1,
+		cb:           Cb4,
+		flush:        1,
+		clientInit:   []byte(`{"nd_off_subnet": "ignore"}`),
+	}
+	a.Run(t, true)
+}
+
+func TestPluginNd_linkLocal1(t *testing.T) {
+
+	a := &IcmpTestBase{
+		testname:     "ipv6nd_linklocal1",
+		monitor:      false,
+		match:        9,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		cb:           Cb4,
+		flush:        1,
+		clientInit: []byte(`{"nd_link_locals": [[254, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1],
+		                                         [254, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2],
+		                                         [32, 1, 13, 184, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5]]}`),
+		firstQuery: 500 * time.Millisecond,
+	}
+	a.Run(t, true)
+}
+
 // send default gateway and resolve it
 func TestPluginNd_adv4(t *testing.T) {
 
@@ -1038,6 +1373,320 @@ func TestPluginNd_rpc1(t *testing.T) {
 	a.Run(t, true) // the timestamp making a new json due to the timestamp. skip the it
 }
 
+// buildNaPacket a NA of the gateway 2001:db8::3 with a target link-layer address option
+func buildNaPacket(flags uint8, mac []byte) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: false, ComputeChecksums: false}
+	gopacket.SerializeLayers(buf, opts,
+		&layers.Ethernet{
+			SrcMAC:       net.HardwareAddr(mac),
+			DstMAC:       net.HardwareAddr{0x33, 0x33, 0, 0, 0, 1},
+			EthernetType: layers.EthernetTypeDot1Q,
+		},
+		&layers.Dot1Q{
+			Priority:       uint8(0),
+			VLANIdentifier: uint16(1),
+			Type:           layers.EthernetTypeDot1Q,
+		},
+		&layers.Dot1Q{
+			Priority:       uint8(0),
+			VLANIdentifier: uint16(2),
+			Type:           layers.EthernetTypeIPv6,
+		},
+
+		&layers.IPv6{
+			Version:      6,
+			TrafficClass: 0,
+			FlowLabel:    0,
+			Length:       8,
+			NextHeader:   layers.IPProtocolICMPv6,
+			HopLimit:     255,
+			SrcIP:        net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0, 0x0, 0x0, 0x00, 0x03},
+			DstIP:        net.IP{0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		},
+
+		&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborAdvertisement, 0)},
+
+		&layers.ICMPv6NeighborAdvertisement{
+			Flags:         flags,
+			TargetAddress: net.IP{0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0, 0x0, 0x0, 0x00, 0x03},
+		},
+		gopacket.Payload(append([]byte{0x02, 0x01}, mac...)),
+	)
+
+	pkt := buf.Bytes()
+	off := 14 + 8
+	icmppyof := off + 40
+
+	ipv6 := layers.IPv6Header(pkt[off : off+40])
+	ipv6.SetPyloadLength(uint16(len(pkt) - off - 40))
+
+	binary.BigEndian.PutUint16(pkt[icmppyof+2:icmppyof+4], 0)
+	cs := layers.PktChecksumTcpUdpV6(pkt[icmppyof:], 0, ipv6, 0, 58)
+	binary.BigEndian.PutUint16(pkt[icmppyof+2:icmppyof+4], cs)
+	return pkt
+}
+
+type ipv6UnaCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint8
+}
+
+func (o *ipv6UnaCtx) OnEvent(a, b interface{}) {
+	var raw []byte
+	switch o.cnt {
+	case 0:
+		// solicited NA, resolves the gateway
+		raw = buildNaPacket(0x60, []byte{0, 0, 0, 0, 1, 1})
+	case 1:
+		// unsolicited NA with a new MAC, failover of the gateway
+		raw = buildNaPacket(0x20, []byte{0, 0, 0, 0, 2, 2})
+	case 2:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ipv6_nd_ns_get_una",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "clear": true},
+		"id": 3 }`))
+
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ipv6_nd_ns_iter",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "reset": true, "count" : 99},
+		"id": 3 }`))
+	}
+	if len(raw) > 0 {
+		m := o.tctx.MPool.Alloc(uint16(256))
+		m.SetVPort(1)
+		m.Append(raw)
+		o.tctx.Veth.OnRx(m)
+	}
+	o.cnt++
+	if o.cnt < 3 {
+		ticks := o.tctx.GetTimerCtx().DurationToTicks(5 * time.Second)
+		o.tctx.GetTimerCtx().StartTicks(&o.timer, ticks)
+	}
+}
+
+func rpcUnaQueue(tctx *core.CThreadCtx, test *IcmpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(20 * time.Second)
+	var tstctx ipv6UnaCtx
+	tstctx.timer.SetCB(&tstctx, test.cbArg1, test.cbArg2)
+	tstctx.tctx = tctx
+	timerw.StartTicks(&tstctx.timer, ticks)
+	return 0
+}
+
+// unsolicited NA of the gateway with a new MAC, should be reported and learned
+func TestPluginNd_una1(t *testing.T) {
+
+	a := &IcmpTestBase{
+		testname:     "ipv6nd_una1",
+		monitor:      false,
+		match:        7,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		flush:        1,
+		cb:           rpcUnaQueue,
+	}
+	a.Run(t, true)
+}
+
+type ipv6StaleCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint8
+}
+
+func (o *ipv6StaleCtx) OnEvent(a, b interface{}) {
+	var raw []byte
+	switch o.cnt {
+	case 0, 2:
+		// solicited NA, resolves the gateway
+		raw = buildNaPacket(0x60, []byte{0, 0, 0, 0, 1, 1})
+	case 1:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ipv6_nd_ns_set_stale",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "ipv6": [32,1,13,184,0,0,0,0,0,0,0,0,0,0,0,3]},
+		"id": 3 }`))
+
+		// invalid, unknown entry
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ipv6_nd_ns_set_stale",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "ipv6": [32,1,13,184,0,0,0,0,0,0,0,0,0,0,0,9]},
+		"id": 3 }`))
+	case 3:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ipv6_nd_ns_iter",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "reset": true, "count" : 99},
+		"id": 3 }`))
+	}
+	if len(raw) > 0 {
+		m := o.tctx.MPool.Alloc(uint16(256))
+		m.SetVPort(1)
+		m.Append(raw)
+		o.tctx.Veth.OnRx(m)
+	}
+	o.cnt++
+	if o.cnt < 4 {
+		ticks := o.tctx.GetTimerCtx().DurationToTicks(5 * time.Second)
+		o.tctx.GetTimerCtx().StartTicks(&o.timer, ticks)
+	}
+}
+
+func rpcStaleQueue(tctx *core.CThreadCtx, test *IcmpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(20 * time.Second)
+	var tstctx ipv6StaleCtx
+	tstctx.timer.SetCB(&tstctx, test.cbArg1, test.cbArg2)
+	tstctx.tctx = tctx
+	timerw.StartTicks(&tstctx.timer, ticks)
+	return 0
+}
+
+// the resolved gateway is forced to stale, it is solicited at once and learned again
+func TestPluginNd_stale1(t *testing.T) {
+
+	a := &IcmpTestBase{
+		testname:     "ipv6nd_stale1",
+		monitor:      false,
+		match:        7,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		flush:        1,
+		cb:           rpcStaleQueue,
+	}
+	a.Run(t, true)
+}
+
+// buildRaPacket a RA of the router with the prefix 2001:db8:0:1::/64
+func buildRaPacket(valid, preferred uint32) []byte {
+	prefix := []byte{0x03, 0x04, 0x40, 0xc0, 0, 0, 0, 0, 0, 0, 0, 0, 0x00, 0x00, 0x00, 0x00,
+		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	binary.BigEndian.PutUint32(prefix[4:8], valid)
+	binary.BigEndian.PutUint32(prefix[8:12], preferred)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: false, ComputeChecksums: false}
+	gopacket.SerializeLayers(buf, opts,
+		&layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 0, 0, 2, 0, 0},
+			DstMAC:       net.HardwareAddr{0x33, 0x33, 0, 0, 0, 1},
+			EthernetType: layers.EthernetTypeDot1Q,
+		},
+		&layers.Dot1Q{
+			Priority:       uint8(0),
+			VLANIdentifier: uint16(1),
+			Type:           layers.EthernetTypeDot1Q,
+		},
+		&layers.Dot1Q{
+			Priority:       uint8(0),
+			VLANIdentifier: uint16(2),
+			Type:           layers.EthernetTypeIPv6,
+		},
+
+		&layers.IPv6{
+			Version:      6,
+			TrafficClass: 0,
+			FlowLabel:    0,
+			Length:       8,
+			NextHeader:   layers.IPProtocolICMPv6,
+			HopLimit:     255,
+			SrcIP:        net.IP{0xfe, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0xfe, 0xf5, 0x00, 0x00},
+			DstIP:        net.IP{0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01},
+		},
+
+		&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeRouterAdvertisement, 0)},
+
+		&layers.ICMPv6RouterAdvertisement{
+			HopLimit:       64,
+			Flags:          0xc0,
+			RouterLifetime: 1800,
+			ReachableTime:  0,
+			RetransTimer:   0,
+		},
+
+		gopacket.Payload([]byte{0x01, 0x01, 0xc2, 0x00, 0x54, 0xf5, 0x00, 0x00}),
+		gopacket.Payload(prefix),
+	)
+
+	pkt := buf.Bytes()
+	off := 14 + 8
+	icmppyof := off + 40
+
+	ipv6 := layers.IPv6Header(pkt[off : off+40])
+	ipv6.SetPyloadLength(uint16(len(pkt) - off - 40))
+
+	binary.BigEndian.PutUint16(pkt[icmppyof+2:icmppyof+4], 0)
+	cs := layers.PktChecksumTcpUdpV6(pkt[icmppyof:], 0, ipv6, 0, 58)
+	binary.BigEndian.PutUint16(pkt[icmppyof+2:icmppyof+4], cs)
+	return pkt
+}
+
+type ipv6SlaacCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint8
+}
+
+func (o *ipv6SlaacCtx) OnEvent(a, b interface{}) {
+	var raw []byte
+	switch o.cnt {
+	case 0:
+		raw = buildRaPacket(30, 10)
+	case 3:
+		// the valid lifetime is not cut below two hours, only the preferred one is updated
+		raw = buildRaPacket(5, 0)
+	}
+	if len(raw) > 0 {
+		m := o.tctx.MPool.Alloc(uint16(256))
+		m.SetVPort(1)
+		m.Append(raw)
+		o.tctx.Veth.OnRx(m)
+	}
+	if o.cnt > 0 {
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ipv6_nd_c_get_slaac",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "mac": [0, 0, 1, 0, 0, 0]},
+		"id": 3 }`))
+	}
+	o.cnt++
+	if o.cnt < 5 {
+		ticks := o.tctx.GetTimerCtx().DurationToTicks(5 * time.Second)
+		if o.cnt == 4 {
+			ticks = o.tctx.GetTimerCtx().DurationToTicks(20 * time.Second)
+		}
+		o.tctx.GetTimerCtx().StartTicks(&o.timer, ticks)
+	}
+}
+
+func rpcSlaacQueue(tctx *core.CThreadCtx, test *IcmpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(20 * time.Second)
+	var tstctx ipv6SlaacCtx
+	tstctx.timer.SetCB(&tstctx, test.cbArg1, test.cbArg2)
+	tstctx.tctx = tctx
+	timerw.StartTicks(&tstctx.timer, ticks)
+	return 0
+}
+
+// the slaac address is deprecated at the end of the preferred lifetime and removed at the end of the valid one
+func TestPluginNd_slaac1(t *testing.T) {
+
+	a := &IcmpTestBase{
+		testname:     "ipv6nd_slaac1",
+		monitor:      false,
+		match:        7,
+		capture:      true,
+		duration:     1 * time.Minute,
+		clientsToSim: 1,
+		flush:        1,
+		cb:           rpcSlaacQueue,
+	}
+	a.Run(t, true)
+}
+
 type ipv6PingCtxRpc struct {
 	tctx  *core.CThreadCtx
 	timer core.CHTimerObj
@@ -1332,3 +1981,239 @@ func TestPluginPing(t *testing.T) {
 func init() {
 	flag.IntVar(&monitor, "monitor", 0, "monitor")
 }
+
+type ipv6NudCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint8
+}
+
+func (o *ipv6NudCtx) iter() {
+	o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ipv6_nd_ns_iter",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "reset": true, "count" : 99},
+		"id": 3 }`))
+}
+
+func (o *ipv6NudCtx) OnEvent(a, b interface{}) {
+	var raw []byte
+	var next time.Duration
+	switch o.cnt {
+	case 0:
+		// solicited NA, the gateway is reachable
+		raw = buildNaPacket(0x60, []byte{0, 0, 0, 0, 1, 1})
+		next = 16 * time.Second
+	case 1:
+		// answer of the first probe
+		raw = buildNaPacket(0x60, []byte{0, 0, 0, 0, 1, 1})
+		next = 1 * time.Second
+	case 2:
+		o.iter()
+		next = 22 * time.Second
+	case 3:
+		// the probes were not answered
+		o.iter()
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+		"method":"ipv6_ns_cnt",
+		"params": {"tun": {"vport":1,"tci":[1,2]}, "meta":false, "zero":false },
+		"id": 3 }`))
+	}
+	if len(raw) > 0 {
+		m := o.tctx.MPool.Alloc(uint16(256))
+		m.SetVPort(1)
+		m.Append(raw)
+		o.tctx.Veth.OnRx(m)
+	}
+	o.cnt++
+	if next > 0 {
+		o.tctx.GetTimerCtx().Start(&o.timer, next)
+	}
+}
+
+func rpcNudQueue(tctx *core.CThreadCtx, test *IcmpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(1 * time.Second)
+	var tstctx ipv6NudCtx
+	tstctx.timer.SetCB(&tstctx, test.cbArg1, test.cbArg2)
+	tstctx.tctx = tctx
+	timerw.StartTicks(&tstctx.timer, ticks)
+	return 0
+}
+
+// NUD of the gateway, reachable, delay and probe with unicast solicitations, the last probes are
+// not answered and the gateway is back to incomplete
+func TestPluginNd_nud1(t *testing.T) {
+
+	a := &IcmpTestBase{
+		testname:     "ipv6nd_nud1",
+		monitor:      false,
+		match:        7,
+		capture:      true,
+		duration:     45 * time.Second,
+		clientsToSim: 1,
+		flush:        1,
+		nsInit:       []byte(`{"dmac" :[0, 0, 1, 0, 0, 0], "nd_nud": true, "nd_reachable_sec": 10 }`),
+		cb:           rpcNudQueue,
+	}
+	a.Run(t, true)
+}
+
+func runDadSim(t *testing.T, clientInit string) *NdNsCtx {
+	var simVeth VethIcmpSim
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	test := &IcmpTestBase{clientInit: []byte(clientInit), flush: 1}
+	tctx, _ := createSimulationEnv(&simrx, 1, 0, test)
+	tctx.MainLoopSim(10 * time.Second)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := tctx.GetNs(&key)
+	if ns == nil {
+		t.Fatalf(" can't find ns")
+	}
+	return &ns.PluginCtx.Get(IPV6_PLUG).Ext.(*PluginIpv6Ns).nd
+}
+
+// a client that claims its addresses without DAD, and a client with a DAD shorter than RetransTimer
+func TestPluginNd_skipDad1(t *testing.T) {
+	nd := runDadSim(t, `{"nd_skip_dad": true, "nd_link_locals": [[254, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1]]}`)
+	// auto link-local, global and the additional link-local
+	if nd.stats.dadImproper != 3 || nd.stats.pktTxNeighborUnsolicitedDAD != 0 {
+		t.Fatalf(" skip dad, bad counters %+v \n", nd.stats)
+	}
+	if nd.stats.linkLocalAdd != 1 || nd.stats.linkLocalPreferred != 0 {
+		t.Fatalf(" skip dad, the link-local should not be tentative %+v \n", nd.stats)
+	}
+
+	nd = runDadSim(t, `{"nd_optimistic_dad": true, "nd_dad_msec": 100}`)
+	if nd.stats.dadImproper == 0 || nd.stats.dadImproper != nd.stats.pktTxNeighborUnsolicitedDAD {
+		t.Fatalf(" short dad, bad counters %+v \n", nd.stats)
+	}
+	if nd.stats.dadOptimisticAddr == 0 || nd.stats.dadOptimisticPreferred != nd.stats.dadOptimisticAddr {
+		t.Fatalf(" short dad, the addresses should be preferred %+v \n", nd.stats)
+	}
+
+	nd = runDadSim(t, `{"nd_optimistic_dad": true}`)
+	if nd.stats.dadImproper != 0 || nd.stats.pktTxNeighborUnsolicitedDAD == 0 {
+		t.Fatalf(" proper dad, bad counters %+v \n", nd.stats)
+	}
+}
+
+func runRsSim(t *testing.T, nsInit string) *NdNsCtx {
+	var simVeth VethIcmpSim
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	test := &IcmpTestBase{nsInit: []byte(nsInit)}
+	tctx, _ := createSimulationEnv(&simrx, 1, 0, test)
+	tctx.MainLoopSim(10 * time.Second)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := tctx.GetNs(&key)
+	if ns == nil {
+		t.Fatalf(" can't find ns")
+	}
+	return &ns.PluginCtx.Get(IPV6_PLUG).Ext.(*PluginIpv6Ns).nd
+}
+
+// router solicitations with and without SLLAO that are not answered, the client gives up after the retries
+func TestPluginNd_rs1(t *testing.T) {
+	nd := runRsSim(t, `{"dmac" :[0, 0, 1, 0, 0, 0], "nd_rs_sllao": true, "nd_rs_retries": 5}`)
+	if nd.stats.pktTxRsSllao != 4 || nd.stats.pktTxRsNoSllao != 0 || nd.stats.rsNoRaTimeout != 1 {
+		t.Fatalf(" rs with sllao, bad counters %+v \n", nd.stats)
+	}
+
+	nd = runRsSim(t, `{"dmac" :[0, 0, 1, 0, 0, 0]}`)
+	if nd.stats.pktTxRsNoSllao < 9 || nd.stats.pktTxRsSllao != 0 || nd.stats.rsNoRaTimeout != 0 {
+		t.Fatalf(" rs without sllao, bad counters %+v \n", nd.stats)
+	}
+}
+
+/*TestNdFlapThreshold - the event is reported for each flap at or above the threshold */
+func TestNdFlapThreshold(t *testing.T) {
+	var stats Ipv6NsStats
+	var tbl Ipv6NsCacheFlowTable
+	tbl.Create(core.NewTimerCtx(true))
+	tbl.stats = &stats
+	flow := &NdCacheFlow{}
+	flow.action.IpdgResolved = true
+	flow.action.IpdgMac = core.MACKey{0, 0, 2, 0, 0, 0}
+	var events []uint32
+	for i := 0; i < 6; i++ {
+		mac := core.MACKey{0, 0, 2, 0, 0, uint8(i%2 + 1)}
+		if tbl.CheckAdv(flow, &mac, 3) {
+			events = append(events, flow.flaps)
+		}
+	}
+	if flow.flaps != 6 || len(events) != 4 || events[0] != 3 || events[3] != 6 || stats.eventsFlap != 4 {
+		t.Fatalf(" bad flap events %v %+v \n", events, stats)
+	}
+}
+
+// a long finite lifetime does not wrap, a deprecated address is not the source of new traffic
+func TestNdSlaacLifetime(t *testing.T) {
+	o := &NdNsCtx{timerw: core.NewTimerCtx(true)}
+	o.slaacTimer.SetCB(&o.slaacTimerCB, o, 0)
+	prefix := core.Ipv6Key{0x20, 0x01, 0x0d, 0xb8}
+	if !o.updateSlaacPrefix(prefix, 64, slaacInfinite-1, 1) {
+		t.Fatalf(" prefix should be taken \n")
+	}
+	if left := o.lifetimeLeftSec(o.slaacValidEnd); left != slaacInfinite-1 {
+		t.Fatalf(" bad valid lifetime %d \n", left)
+	}
+
+	var c core.CClient
+	c.Mac = core.MACKey{0, 0, 1, 0, 0, 1}
+	c.Ipv6Router = &o.routerAd
+	if _, err := c.GetSourceIPv6(); err != nil {
+		t.Fatalf(" preferred address should be the source %v \n", err)
+	}
+	o.slaacPrefEnd = o.timerw.Ticks
+	o.onSlaacTimer()
+	if _, err := c.GetSourceIPv6(); err == nil || o.slaacState != slaacDeprecated {
+		t.Fatalf(" deprecated address should not be the source \n")
+	}
+	c.Ipv6 = core.Ipv6Key{0x20, 0x01, 0x0d, 0xb8, 15: 1}
+	if src, err := c.GetSourceIPv6(); err != nil || src != c.Ipv6 {
+		t.Fatalf(" static address should be the source %v %v \n", src, err)
+	}
+}
+
+// the new groups of a client join are reported together, the references are returned sorted
+func TestPluginMldClientRefs(t *testing.T) {
+	var simVeth VethIcmpSim
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	test := &IcmpTestBase{nsInit: []byte(`{"dmac" :[0, 0, 1, 0, 0, 0]}`)}
+	tctx, _ := createSimulationEnv(&simrx, 1, 0, test)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := tctx.GetNs(&key)
+	mld := &ns.PluginCtx.Get(IPV6_PLUG).Ext.(*PluginIpv6Ns).mld
+	client := ns.CLookupByMac(&core.MACKey{0, 0, 1, 0, 0, 0})
+	c := client.PluginCtx.Get(IPV6_PLUG).Ext.(*PluginIpv6Client)
+
+	g1 := core.Ipv6Key{0xff, 2, 15: 2}
+	g2 := core.Ipv6Key{0xff, 2, 15: 1}
+	if c.MldJoin([]core.Ipv6Key{g1, g2, g1}) != nil {
+		t.Fatalf(" join should succeed \n")
+	}
+	st := &mld.stats
+	if st.pktSndJoinReports != 1 || st.opsAppJoin != 3 || st.reportSuppressed != 1 {
+		t.Fatalf(" one report is expected for the new groups %+v \n", *st)
+	}
+	refs := c.getMldRefs()
+	if len(refs) != 2 || refs[0].G != g2 || refs[0].Refc != 1 || refs[1].G != g1 || refs[1].Refc != 2 {
+		t.Fatalf(" bad refs %+v \n", refs)
+	}
+
+	// the leave stops at the group without a reference of the client
+	if c.MldLeave([]core.Ipv6Key{g2, g2}) == nil || st.opsAppErr != 1 || st.opsAppLeave != 1 {
+		t.Fatalf(" leave of a released group should fail %+v \n", *st)
+	}
+	if refs = c.getMldRefs(); len(refs) != 1 || refs[0].G != g1 || refs[0].Refc != 2 {
+		t.Fatalf(" bad refs after leave %+v \n", refs)
+	}
+}
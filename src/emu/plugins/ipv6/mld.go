@@ -27,6 +27,7 @@ import (
 	"math/rand"
 	"net"
 	"sort"
+	"time"
 	"unsafe"
 
 	"github.com/intel-go/fastjson"
@@ -59,11 +60,25 @@ const (
 	IPV6_OPTION_ROUTER             = 8 /* plus router alert */
 )
 
+const (
+	MLD_QUERIER_DEF_IVL       = 125 /* default query interval in sec */
+	MLD_QUERIER_PHASE_OFF     = "off"
+	MLD_QUERIER_PHASE_STARTUP = "startup"
+	MLD_QUERIER_PHASE_STEADY  = "steady"
+)
+
 type MldNsInit struct {
-	Mtu           uint16         `json:"mtu" validate:"required,gte=256,lte=9000"`
-	DesignatorMac core.MACKey    `json:"dmac"`
-	Vec           []core.Ipv6Key `json:"vec"`     // add mc
-	Version       uint16         `json:"version"` // the init version, 1 or 2 (default)
+	Mtu            uint16         `json:"mtu" validate:"required,gte=256,lte=9000"`
+	DesignatorMac  core.MACKey    `json:"dmac"`
+	Vec            []core.Ipv6Key `json:"vec"`             // add mc
+	Version        uint16         `json:"version"`         // the init version, 1 or 2 (default)
+	Robustness     uint8          `json:"robustness"`      // number of unsolicited reports sent on join, default 1
+	UnsolicitedIvl uint32         `json:"unsolicited_ivl"` // unsolicited report interval in msec, default 1000
+
+	Querier         bool   `json:"querier"`           // act as a querier (RFC3810 9.6/9.7)
+	StartupQueryCnt uint8  `json:"startup_query_cnt"` // number of startup queries, default qrv
+	StartupQueryIvl uint32 `json:"startup_query_ivl"` // startup query interval in msec, default 1/4 of query_ivl
+	QueryIvl        uint32 `json:"query_ivl"`         // steady query interval in sec, default 125
 }
 
 var IN6_IS_ADDR_UNSPECIFIED = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
@@ -156,6 +171,10 @@ type mldNsStats struct {
 	pktRxNora                 uint64 /* received w/o Router Alert option */
 	pktRxSndReports           uint64 /* sent membership reports */
 	pktSndAddRemoveReports    uint64 /* explicit reports dur to add/remove command */
+	pktSndJoinReports         uint64 /* unsolicited reports sent on join, including retransmissions */
+	pktSndJoinRetrans         uint64 /* robustness retransmissions of unsolicited join reports */
+	pktTxQueryStartup         uint64 /* general queries sent in the querier startup phase */
+	pktTxQuerySteady          uint64 /* general queries sent in the querier steady phase */
 	pktNoDesignatorClient     uint64 /* There is no designator client with this MAC addr */
 	pktNoDesignatorClientIPv6 uint64 /* there designator client does not have valid IPv4 addr */
 
@@ -166,6 +185,12 @@ type mldNsStats struct {
 
 	opsRateIsTooHigh uint64
 
+	opsAppJoin       uint64 /* join of an application of a client */
+	opsAppLeave      uint64 /* leave of an application of a client */
+	opsAppErr        uint64
+	reportSuppressed uint64 /* joins of a group that was already joined, no report */
+	leaveSuppressed  uint64 /* leaves of a group that is still referenced, no leave */
+
 	opsAddSG       uint64 /* add mc (s,g)*/
 	opsRemoveSG    uint64 /* remove mc (s,g)*/
 	opsAddErrSG    uint64 /* add erro (s,g) */
@@ -372,6 +397,38 @@ func NewMldNsStatsDb(o *mldNsStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScINFO})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktSndJoinReports,
+		Name:     "pktSndJoinReports",
+		Help:     "unsolicited reports sent on join",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktSndJoinRetrans,
+		Name:     "pktSndJoinRetrans",
+		Help:     "robustness retransmissions of join reports",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxQueryStartup,
+		Name:     "pktTxQueryStartup",
+		Help:     "querier general queries in startup phase",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxQuerySteady,
+		Name:     "pktTxQuerySteady",
+		Help:     "querier general queries in steady phase",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
 	db.Add(&core.CCounterRec{
 		Counter:  &o.pktRxSndReports,
 		Name:     "pktRxSndReports",
@@ -436,6 +493,46 @@ func NewMldNsStatsDb(o *mldNsStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScERROR})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAppJoin,
+		Name:     "opsAppJoin",
+		Help:     "joins of the applications of the clients",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAppLeave,
+		Name:     "opsAppLeave",
+		Help:     "leaves of the applications of the clients",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAppErr,
+		Name:     "opsAppErr",
+		Help:     "joins or leaves of the applications with an error",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.reportSuppressed,
+		Name:     "reportSuppressed",
+		Help:     "joins of a group that was already joined, no report",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.leaveSuppressed,
+		Name:     "leaveSuppressed",
+		Help:     "leaves of a group that is still referenced, no leave",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
 	return db
 }
 
@@ -721,6 +818,30 @@ type mldPktBuilder struct {
 type mldCacheNsTimer struct {
 }
 
+type mldRetransNsTimer struct {
+}
+
+func (o *mldRetransNsTimer) OnEvent(a, b interface{}) {
+	obj := a.(*mldNsCtx)
+	obj.onRetransTimer(b.(*mldJoinRetrans))
+}
+
+// mldQuerierNsTimer send the general queries in querier mode
+type mldQuerierNsTimer struct {
+}
+
+func (o *mldQuerierNsTimer) OnEvent(a, b interface{}) {
+	mld := a.(*mldNsCtx)
+	mld.onQuerierTimer()
+}
+
+// mldJoinRetrans a batch of joined groups that should be reported again (RFC 3810 6.1)
+type mldJoinRetrans struct {
+	timer core.CHTimerObj
+	vec   []core.Ipv6Key
+	left  uint8 /* retransmissions left */
+}
+
 func (o *mldCacheNsTimer) OnEvent(a, b interface{}) {
 	obj := a.(*mldNsCtx)
 	obj.onCacheTimerUpdate(b)
@@ -755,6 +876,17 @@ type mldNsCtx struct {
 	removeCacheVec   []core.Ipv6Key
 	removeTimerCache core.CHTimerObj // timer for batching remove
 	removeCacheCB    mldCacheNsTimer
+	robustness       uint8  /* number of unsolicited reports on join */
+	unsolicitedIvl   uint32 /* unsolicited report interval in msec */
+	retransCb        mldRetransNsTimer
+	retransVec       []*mldJoinRetrans
+	querier          bool   /* querier mode */
+	startupQueryCnt  uint8  /* 0 - use qrv */
+	startupQueryIvl  uint32 /* in msec, 0 - use 1/4 of queryIvl */
+	queryIvl         uint32 /* in sec */
+	startupLeft      uint8  /* startup queries left to send */
+	querierTimer     core.CHTimerObj
+	querierCb        mldQuerierNsTimer
 }
 
 func (o *mldNsCtx) onCacheTimerUpdate(b interface{}) {
@@ -792,8 +924,12 @@ func (o *mldNsCtx) Init(base *PluginIpv6Ns, ctx *core.CThreadCtx, initJson []byt
 	o.qrv = 2
 	o.qqi = 125
 	o.maxresp = 10000
-	o.timerw = ctx.GetTimerCtx()
+	o.robustness = 1
+	o.unsolicitedIvl = 1000
+	o.queryIvl = MLD_QUERIER_DEF_IVL
+	o.timerw = o.base.Ns.GetTimerCtx()
 	o.timer.SetCB(o, 0, 0) // set the callback to OnEvent
+	o.querierTimer.SetCB(&o.querierCb, o, 0)
 	o.addCacheVec = []core.Ipv6Key{}
 	o.removeCacheVec = []core.Ipv6Key{}
 
@@ -809,12 +945,26 @@ func (o *mldNsCtx) Init(base *PluginIpv6Ns, ctx *core.CThreadCtx, initJson []byt
 		if !init.DesignatorMac.IsZero() {
 			o.designatorMac = init.DesignatorMac
 		}
+		if init.Robustness > 0 {
+			o.robustness = init.Robustness
+		}
+		if init.UnsolicitedIvl > 0 {
+			o.unsolicitedIvl = init.UnsolicitedIvl
+		}
 		if len(init.Vec) > 0 {
 			o.addMc(init.Vec)
 		}
 		if init.Version == 1 {
 			o.mldVersion = MLD_VERSION_1
 		}
+		o.startupQueryCnt = init.StartupQueryCnt
+		o.startupQueryIvl = init.StartupQueryIvl
+		if init.QueryIvl > 0 {
+			o.queryIvl = init.QueryIvl
+		}
+		if init.Querier {
+			o.querierStart()
+		}
 	}
 }
 
@@ -919,6 +1069,21 @@ func (o *mldNsCtx) GetNext(n uint16) ([]MldEntryDataJson, error) {
 	return r, nil
 }
 
+// GetAll returns all the memberships sorted by the group, the sources are sorted too
+func (o *mldNsCtx) GetAll() []MldEntryDataJson {
+	r := make([]MldEntryDataJson, 0, len(o.tbl.mapIgmp))
+	for _, ent := range o.tbl.mapIgmp {
+		j := ent.getJson()
+		if j.S != nil {
+			s := *j.S
+			sort.Slice(s, func(i, k int) bool { return bytes.Compare(s[i][:], s[k][:]) < 0 })
+		}
+		r = append(r, *j)
+	}
+	sort.Slice(r, func(i, j int) bool { return bytes.Compare(r[i].Ipv6[:], r[j].Ipv6[:]) < 0 })
+	return r
+}
+
 func (o *mldNsCtx) preparePacketTemplate() {
 
 	l2 := o.base.Ns.GetL2Header(true, uint16(layers.EthernetTypeIPv6)) //
@@ -958,6 +1123,13 @@ func (o *mldNsCtx) OnRemove(ctx *core.PluginCtx) {
 		o.timerw.Stop(&o.addTimerCache)
 		o.flushAddCache()
 	}
+	for _, r := range o.retransVec {
+		if r.timer.IsRunning() {
+			o.timerw.Stop(&r.timer)
+		}
+	}
+	o.retransVec = nil
+	o.querierStop()
 }
 
 // add to a temporary location for burst
@@ -1012,22 +1184,69 @@ func (o *mldNsCtx) addMcVec(vecIpv6 []core.Ipv6Key, man bool) error {
 		err, add = o.tbl.addMc(ipv6, man)
 		if err != nil {
 			o.stats.opsAddErr++
-			o.SendMcPacket(vec, false, false)
+			o.sendJoinReport(vec)
 			return err
 		}
 		if add {
 			o.stats.opsAdd++
 			vec = append(vec, ipv6)
 			if len(vec) == maxIds {
-				o.SendMcPacket(vec, false, false)
+				o.sendJoinReport(vec)
 				vec = vec[:0]
 			}
 		}
 	}
-	o.SendMcPacket(vec, false, false)
+	o.sendJoinReport(vec)
 	return nil
 }
 
+// sendJoinReport send the unsolicited report for new groups and schedule
+// robustness-1 retransmissions spaced by the unsolicited report interval
+func (o *mldNsCtx) sendJoinReport(vec []core.Ipv6Key) {
+	if len(vec) == 0 {
+		return
+	}
+	o.stats.pktSndJoinReports++
+	o.SendMcPacket(vec, false, false)
+	if o.robustness < 2 {
+		return
+	}
+	r := new(mldJoinRetrans)
+	r.vec = make([]core.Ipv6Key, len(vec))
+	copy(r.vec, vec)
+	r.left = o.robustness - 1
+	r.timer.SetCB(&o.retransCb, o, r)
+	o.retransVec = append(o.retransVec, r)
+	o.timerw.Start(&r.timer, time.Duration(o.unsolicitedIvl)*time.Millisecond)
+}
+
+func (o *mldNsCtx) onRetransTimer(r *mldJoinRetrans) {
+	// report only the groups that were not removed in the meantime
+	vec := []core.Ipv6Key{}
+	for _, g := range r.vec {
+		if _, ok := o.tbl.mapIgmp[g]; ok {
+			vec = append(vec, g)
+		}
+	}
+	if len(vec) > 0 {
+		o.stats.pktSndJoinReports++
+		o.stats.pktSndJoinRetrans++
+		o.SendMcPacket(vec, false, false)
+	}
+	r.left--
+	if r.left > 0 && len(vec) > 0 {
+		r.vec = vec
+		o.timerw.Start(&r.timer, time.Duration(o.unsolicitedIvl)*time.Millisecond)
+		return
+	}
+	for i, e := range o.retransVec {
+		if e == r {
+			o.retransVec = append(o.retransVec[:i], o.retransVec[i+1:]...)
+			break
+		}
+	}
+}
+
 func (o *mldNsCtx) removeMcInternal(vecIpv6 []core.Ipv6Key) error {
 	return o.removeMcVec(vecIpv6, false)
 }
@@ -1062,6 +1281,69 @@ func (o *mldNsCtx) removeMcVec(vecIpv6 []core.Ipv6Key, man bool) error {
 	return nil
 }
 
+// appJoin adds a reference of an application of a client to each group, a report is sent only for
+// the groups that were not joined. It returns the number of groups that were referenced.
+func (o *mldNsCtx) appJoin(vecIpv6 []core.Ipv6Key) (int, error) {
+	vec := []core.Ipv6Key{}
+	maxIds := int(o.getMaxIPv6Ids())
+	o.tbl.epoc++
+	for i, ipv6 := range vecIpv6 {
+		err, add := o.tbl.addMc(ipv6, false)
+		if err != nil {
+			o.stats.opsAppErr++
+			o.sendJoinReport(vec)
+			return i, err
+		}
+		o.stats.opsAppJoin++
+		if !add {
+			o.stats.reportSuppressed++
+			continue
+		}
+		o.stats.opsAdd++
+		vec = append(vec, ipv6)
+		if len(vec) == maxIds {
+			o.sendJoinReport(vec)
+			vec = vec[:0]
+		}
+	}
+	o.sendJoinReport(vec)
+	return len(vecIpv6), nil
+}
+
+// appLeave removes a reference of an application of a client from each group, a leave is sent
+// only for the groups without references. It returns the number of groups that were released.
+func (o *mldNsCtx) appLeave(vecIpv6 []core.Ipv6Key) (int, error) {
+	vec := []core.Ipv6Key{}
+	maxIds := int(o.getMaxIPv6Ids())
+	o.tbl.epoc++
+	for i, ipv6 := range vecIpv6 {
+		if e, ok := o.tbl.mapIgmp[ipv6]; !ok || e.refc == 0 {
+			o.stats.opsAppErr++
+			o.SendMcPacket(vec, true, false)
+			return i, fmt.Errorf(" ns:%v mc-ipv6 %v is not referenced", o.base.Ns.Key.StringRpc(), ipv6)
+		}
+		r, err := o.tbl.removeMc(ipv6, false)
+		if err != nil {
+			o.stats.opsAppErr++
+			o.SendMcPacket(vec, true, false)
+			return i, err
+		}
+		o.stats.opsAppLeave++
+		if !r {
+			o.stats.leaveSuppressed++
+			continue
+		}
+		o.stats.opsRemove++
+		vec = append(vec, ipv6)
+		if len(vec) == maxIds {
+			o.SendMcPacket(vec, true, false)
+			vec = vec[:0]
+		}
+	}
+	o.SendMcPacket(vec, true, false)
+	return len(vecIpv6), nil
+}
+
 func (o *mldNsCtx) IsValidQueryEpoc(v uint32) bool {
 	var d uint32
 	d = o.activeEpocQuery - v
@@ -1291,6 +1573,9 @@ func (o *mldNsCtx) getClient() *core.CClient {
 }
 
 func (o *mldNsCtx) SendMcPacket(vec []core.Ipv6Key, remove bool, query bool) {
+	if !query && o.base.Ns.SuppressTx() {
+		return
+	}
 
 	client := o.getClient()
 	if client == nil {
@@ -1367,6 +1652,9 @@ func (o *mldNsCtx) SendMcPacket(vec []core.Ipv6Key, remove bool, query bool) {
 }
 
 func (o *mldNsCtx) SendMcPacketSG(fvec []core.Ipv6Key, vec []*MldSGRecord, remove bool) {
+	if o.base.Ns.SuppressTx() {
+		return
+	}
 
 	client := o.getClient()
 	if client == nil {
@@ -1655,6 +1943,146 @@ func mldMantExp(v uint16) uint32 {
 	}
 }
 
+// mldEncodeCode8 encode a QQIC value (RFC3810 5.1.9)
+func mldEncodeCode8(v uint32) uint8 {
+	if v < 128 {
+		return uint8(v)
+	}
+	var exp uint32
+	for exp < 7 && (v>>(exp+3)) > 0x1f {
+		exp++
+	}
+	if (v >> (exp + 3)) > 0x1f {
+		return 0xff
+	}
+	return uint8(0x80 | (exp << 4) | ((v >> (exp + 3)) & 0x0f))
+}
+
+// mldEncodeCode encode a Maximum Response Code value (RFC3810 5.1.3)
+func mldEncodeCode(v uint32) uint16 {
+	if v < 32768 {
+		return uint16(v)
+	}
+	var exp uint32
+	for exp < 7 && (v>>(exp+3)) > 0x1fff {
+		exp++
+	}
+	if (v >> (exp + 3)) > 0x1fff {
+		return 0xffff
+	}
+	return uint16(0x8000 | (exp << 12) | ((v >> (exp + 3)) & 0x0fff))
+}
+
+func (o *mldNsCtx) getStartupQueryCnt() uint8 {
+	if o.startupQueryCnt > 0 {
+		return o.startupQueryCnt
+	}
+	return o.qrv
+}
+
+func (o *mldNsCtx) getStartupQueryIvl() uint32 {
+	if o.startupQueryIvl > 0 {
+		return o.startupQueryIvl
+	}
+	return o.queryIvl * 1000 / 4
+}
+
+func (o *mldNsCtx) getQuerierPhase() string {
+	if !o.querier {
+		return MLD_QUERIER_PHASE_OFF
+	}
+	if o.startupLeft > 0 {
+		return MLD_QUERIER_PHASE_STARTUP
+	}
+	return MLD_QUERIER_PHASE_STEADY
+}
+
+// querierStart start (or restart) the querier from the startup phase, the first query is sent on the next tick
+func (o *mldNsCtx) querierStart() {
+	o.querierStop()
+	o.querier = true
+	o.startupLeft = o.getStartupQueryCnt()
+	o.timerw.StartTicks(&o.querierTimer, 1)
+}
+
+func (o *mldNsCtx) querierStop() {
+	o.querier = false
+	o.startupLeft = 0
+	if o.querierTimer.IsRunning() {
+		o.timerw.Stop(&o.querierTimer)
+	}
+}
+
+func (o *mldNsCtx) onQuerierTimer() {
+	var ivl time.Duration
+	if o.startupLeft > 0 {
+		o.stats.pktTxQueryStartup++
+		o.startupLeft--
+	} else {
+		o.stats.pktTxQuerySteady++
+	}
+	o.SendGenQuery()
+	if o.startupLeft > 0 {
+		ivl = time.Duration(o.getStartupQueryIvl()) * time.Millisecond
+	} else {
+		ivl = time.Duration(o.queryIvl) * time.Second
+	}
+	ticks := o.timerw.DurationToTicks(ivl)
+	if ticks == 0 {
+		ticks = 1
+	}
+	o.timerw.StartTicks(&o.querierTimer, ticks)
+}
+
+// SendGenQuery send a general query to all-nodes on behalf of the designator client
+func (o *mldNsCtx) SendGenQuery() {
+	if o.base.Ns.SuppressTx() {
+		return
+	}
+	client := o.getClient()
+	if client == nil {
+		return
+	}
+
+	qlen := MLD_QUERY_MINLEN
+	if o.mldVersion == MLD_VERSION_2 {
+		qlen = MLD_V2_QUERY_MINLEN
+	}
+	m := o.base.Ns.AllocMbuf(uint16(len(o.ipv6pktTemplate) + qlen))
+	m.Append(o.ipv6pktTemplate)
+	// the template includes the first 8 bytes of the header
+	m.Append(make([]byte, qlen-8))
+	var l6 core.Ipv6Key
+	client.GetIpv6LocalLink(&l6)
+
+	p := m.GetData()
+	copy(p[0:6], []byte{0x33, 0x33, 0x00, 0x00, 0x00, 0x01})
+	copy(p[6:12], o.designatorMac[:])
+
+	ipv6 := layers.IPv6Header(p[o.ipv6Offset : o.ipv6Offset+IPV6_HEADER_SIZE])
+	copy(ipv6.SrcIP(), l6[:])
+	copy(ipv6.DstIP(), []byte{0xff, 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01})
+	ipv6.SetPyloadLength(uint16(qlen + IPV6_OPTION_ROUTER))
+
+	rcof := o.ipv6Offset + IPV6_HEADER_SIZE + IPV6_OPTION_ROUTER
+	q := p[rcof:]
+	q[0] = uint8(layers.ICMPv6TypeMLDv1MulticastListenerQueryMessage)
+	if o.mldVersion == MLD_VERSION_2 {
+		binary.BigEndian.PutUint16(q[4:6], mldEncodeCode(o.maxresp))
+		q[24] = o.qrv & 0x7
+		q[25] = mldEncodeCode8(o.queryIvl)
+	} else {
+		maxresp := o.maxresp
+		if maxresp > 0xffff {
+			maxresp = 0xffff
+		}
+		binary.BigEndian.PutUint16(q[4:6], uint16(maxresp))
+	}
+	cs := layers.PktChecksumTcpUdpV6(q, 0, ipv6, IPV6_OPTION_ROUTER, 58)
+	binary.BigEndian.PutUint16(q[2:4], cs)
+	o.base.Tctx.Veth.Send(m)
+}
+
 func (o *mldNsCtx) HandleRxMld2Query(ps *core.ParserPacketState,
 	mldh layers.Mldv2Header,
 	ipv6 layers.IPv6Header,
@@ -6,12 +6,15 @@
 package ipv6
 
 import (
+	"bytes"
 	"emu/core"
 	"encoding/binary"
 	"external/google/gopacket"
 	"external/google/gopacket/layers"
 	"fmt"
+	"math"
 	"net"
+	"sort"
 	"time"
 	"unsafe"
 
@@ -29,12 +32,48 @@ const (
 	stateIncomplete      = 17
 	stateComplete        = 18
 	stateRefresh         = 19 /* re-query wait for results to get back to stateQuery */
+	stateReachable       = 20 /* NUD (RFC 4861 7.3.2), used only in case nd_nud is enabled */
+	stateStale           = 21
+	stateDelay           = 22
+	stateProbe           = 23
 	hoplimitmax          = 255
 	routeSolSec          = 1  // number of seconds to send routeSol
 	routeSolRet          = 20 // number of retries to send routeSol
 	advTimerSec          = 29 // every 29 second adv all public ipv6 addr
+	flapSampleSize       = 4  // number of flapping MACs to keep per entry
+	defaultFlapThreshold = 3
+	dadRetransTimer      = time.Second // RFC 4861 RetransTimer, time to wait for a DAD answer
+	nudReachableTime     = 30          // RFC 4861 REACHABLE_TIME in sec
+	nudDelayFirstProbe   = 5 * time.Second
+	nudMaxUnicastSolicit = 3
 )
 
+// optimistic DAD (RFC 4429) state of a client address
+const (
+	dadOptimistic = 1 // DAD is running, the address is already in use
+	dadPreferred  = 2 // DAD finished without a conflict
+	dadDuplicate  = 3 // DAD detected a duplicate, the address is not used anymore
+	dadTentative  = 4 // DAD is running, the address is not used yet (RFC 4862)
+)
+
+// lifetime state of the SLAAC address (RFC 4862 5.5.4)
+const (
+	slaacNone       = 0
+	slaacPreferred  = 1 // the address is used for new traffic
+	slaacDeprecated = 2 // the address is valid, used for new traffic only if there is no other
+	slaacExpired    = 3 // the address was removed
+)
+
+const (
+	slaacInfinite    = 0xffffffff   // infinite lifetime
+	slaacTwoHours    = 2 * 60 * 60  // RFC 4862 5.5.3 (e), an RA can't cut the valid lifetime below it
+	slaacMaxTimerSec = 24 * 60 * 60 // longer lifetimes are checked again after a day
+)
+
+var slaacStateNames = [...]string{"none", "preferred", "deprecated", "expired"}
+
+const ndOptRdnss layers.ICMPv6Opt = 25 // recursive DNS server option of the RA (RFC 8106)
+
 // refresh the time here
 // I would like to make this table generic, let try to the table without generic first
 // then optimize it
@@ -42,6 +81,7 @@ const (
 type NdCacheFlow struct {
 	dlist  core.DList
 	head   core.DList /* pointer to the node that uses this */
+	routes core.DList /* pointer to ndRouteRef objects, next-hop of static routes */
 	timer  core.CHTimerObj
 	ipv6   core.Ipv6Key // key
 	state  uint8
@@ -49,21 +89,61 @@ type NdCacheFlow struct {
 	touch  bool
 	refc   uint32
 	action core.CClientDg
+
+	replied   bool   // an advertisement was received for this entry
+	lastReply uint64 // ticks of the last advertisement
+	flaps     uint32 // advertisements with a MAC different from the resolved one
+	dups      uint32 // identical advertisements within a second of each other
+	sampleCnt uint32
+	sample    [flapSampleSize]core.MACKey // last flapping MACs
+	stale     bool                        // the entry was forced to stale, waiting for the re-resolution
+	probes    uint8                       // unicast solicitations sent in the probe state
 }
 
 // refresh the time here
 // I would like to make this table generic, let try to the table without generic first
 // then optimize it
 
+type NdNsInit struct {
+	FlapThreshold uint32 `json:"nd_flap_threshold"` // number of flaps on an entry that trigger MSG_ND_FLAP, 0 disables the event
+	UnaPolicy     string `json:"nd_una_policy"`     // cache update on an unsolicited NA of a neighbor: learn (default), update or ignore
+	Nud           bool   `json:"nd_nud"`            // RFC 4861 NUD state machine of the resolved entries
+	ReachableSec  uint32 `json:"nd_reachable_sec"`  // NUD reachable time, 30 by default
+	RetransMsec   uint32 `json:"nd_retrans_msec"`   // NUD time between unicast probes, 1000 by default
+	RsSllao       bool   `json:"nd_rs_sllao"`       // router solicitations from the link-local address with the source link-layer address option
+	RsRetries     uint32 `json:"nd_rs_retries"`     // router solicitations without an RA before giving up, 20 by default
+}
+
 type Ipv6NdInit struct {
-	Timer        uint32 `json:"nd_timer"`
-	TimerDisable bool   `json:"nd_timer_disable"`
+	Timer         uint32         `json:"nd_timer"`
+	TimerDisable  bool           `json:"nd_timer_disable"`
+	OptimisticDad bool           `json:"nd_optimistic_dad"` // use the addresses while DAD is running (RFC 4429)
+	LinkLocals    []core.Ipv6Key `json:"nd_link_locals"`    // additional link-local addresses, DAD is run on each
+	OffSubnet     string         `json:"nd_off_subnet"`     // solicitations of a global source outside the prefixes of the client: answer (default) or ignore
+	SkipDad       bool           `json:"nd_skip_dad"`       // claim the addresses without DAD, a deliberate duplicate of another node
+	DadMsec       uint32         `json:"nd_dad_msec"`       // time to wait for a DAD answer, 1000 by default, shorter is not a proper DAD
 }
 
 func covertToNdCacheFlow(dlist *core.DList) *NdCacheFlow {
 	return (*NdCacheFlow)(unsafe.Pointer(dlist))
 }
 
+// getFlapSample returns the last flapping MACs, oldest first
+func (o *NdCacheFlow) getFlapSample() []core.MACKey {
+	if o.sampleCnt == 0 {
+		return nil
+	}
+	n := o.sampleCnt
+	if n > flapSampleSize {
+		n = flapSampleSize
+	}
+	r := make([]core.MACKey, 0, n)
+	for i := o.sampleCnt - n; i < o.sampleCnt; i++ {
+		r = append(r, o.sample[i%flapSampleSize])
+	}
+	return r
+}
+
 type MapNdTbl map[core.Ipv6Key]*NdCacheFlow
 
 type Ipv6NsStats struct {
@@ -87,6 +167,8 @@ type Ipv6NsStats struct {
 	pktRxErrWrongOp              uint64
 	pktRxErrWrongHopLimit        uint64
 	pktRxRouterLifetimeZero      uint64
+	pktRxRdnss                   uint64
+	pktRxErrRdnss                uint64
 	pktRxErrRouterLifetimeTooBig uint64
 	pktRxErrRouternotLinklocal   uint64
 	pktRxRouterSolicitation      uint64
@@ -107,16 +189,53 @@ type Ipv6NsStats struct {
 	pktRxNeighborAdvWrongOption uint64
 	pktRxNeighborAdvWithOwnAddr uint64
 	pktRxNeighborAdvLearn       uint64
+	pktRxNeighborAdvUnsolicited uint64
+	pktRxUnaMacChange           uint64
+	pktRxNeighborAdvFlap        uint64
+	pktRxNeighborAdvDup         uint64
+	eventsFlap                  uint64
 	pktTxNeighborUnsolicitedNA  uint64
 
 	pktTxNeighborUnsolicitedDAD   uint64
 	pktTxNeighborUnsolicitedQuery uint64
 
+	dadOptimisticAddr        uint64
+	dadOptimisticPreferred   uint64
+	dadOptimisticInvalidated uint64
+	pktTxNeighborNoOverride  uint64
+	pktTxNeighborNoSllao     uint64
+	dadImproper              uint64
+
+	linkLocalAdd         uint64
+	linkLocalErr         uint64
+	linkLocalPreferred   uint64
+	linkLocalDadConflict uint64
+
 	tblActive             uint64
 	tblAdd                uint64
 	tblRemove             uint64
 	associateWithClient   uint64
 	disasociateWithClient uint64
+	associateWithRoute    uint64
+	disassociateWithRoute uint64
+	forcedStale           uint64
+	staleResolved         uint64
+	slaacDeprecated       uint64
+	slaacExpired          uint64
+	slaacValidLimited     uint64
+	slaacErrLifetime      uint64
+	nudToReachable        uint64
+	nudToStale            uint64
+	nudToDelay            uint64
+	nudToProbe            uint64
+	nudToIncomplete       uint64
+	pktTxNudProbe         uint64
+	offSubnetAnswered     uint64
+	offSubnetSuppressed   uint64
+
+	pktTxRsSllao   uint64
+	pktTxRsNoSllao uint64
+	rsNoRaTimeout  uint64
 }
 
 func NewIpv6NsStatsDb(o *Ipv6NsStats) *core.CCounterDb {
@@ -428,6 +547,30 @@ func NewIpv6NsStatsDb(o *Ipv6NsStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScINFO})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxNeighborAdvFlap,
+		Name:     "pktRxNeighborAdvFlap",
+		Help:     "ipv6 rx neighbor advertisements with a mac different from the resolved one",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxNeighborAdvDup,
+		Name:     "pktRxNeighborAdvDup",
+		Help:     "ipv6 rx duplicate neighbor advertisements",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.eventsFlap,
+		Name:     "eventsFlap",
+		Help:     "neighbor entries that crossed the flap threshold",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
 	db.Add(&core.CCounterRec{
 		Counter:  &o.pktTxNeighborUnsolicitedNA,
 		Name:     "pktTxNeighborUnsolicitedNA",
@@ -452,15 +595,292 @@ func NewIpv6NsStatsDb(o *Ipv6NsStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScINFO})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dadOptimisticAddr,
+		Name:     "dadOptimisticAddr",
+		Help:     "addresses used as optimistic while DAD runs",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dadOptimisticPreferred,
+		Name:     "dadOptimisticPreferred",
+		Help:     "optimistic addresses that passed DAD",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dadOptimisticInvalidated,
+		Name:     "dadOptimisticInvalidated",
+		Help:     "optimistic addresses invalidated by a duplicate",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxNeighborNoOverride,
+		Name:     "pktTxNeighborNoOverride",
+		Help:     "ipv6 tx neighbor adv without override for an optimistic address",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxNeighborNoSllao,
+		Name:     "pktTxNeighborNoSllao",
+		Help:     "ipv6 tx neighbor solicitation from an optimistic address without source link option",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dadImproper,
+		Name:     "dadImproper",
+		Help:     "DAD solicitations that were skipped or sent with a wait shorter than RetransTimer",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.linkLocalAdd,
+		Name:     "linkLocalAdd",
+		Help:     "additional link-local addresses configured",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.linkLocalErr,
+		Name:     "linkLocalErr",
+		Help:     "additional link-local address ignored, not link-local or already used in the namespace",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.linkLocalPreferred,
+		Name:     "linkLocalPreferred",
+		Help:     "additional link-local addresses that finished DAD without a conflict",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.linkLocalDadConflict,
+		Name:     "linkLocalDadConflict",
+		Help:     "additional link-local addresses with a DAD conflict",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxNeighborAdvUnsolicited,
+		Name:     "pktRxNeighborAdvUnsolicited",
+		Help:     "ipv6 rx unsolicited neighbor advertisements of a neighbor",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxUnaMacChange,
+		Name:     "pktRxUnaMacChange",
+		Help:     "ipv6 rx unsolicited neighbor advertisements with a MAC different from the cache",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.associateWithRoute,
+		Name:     "associateWithRoute",
+		Help:     "associate with a next-hop of a static route",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.disassociateWithRoute,
+		Name:     "disassociateWithRoute",
+		Help:     "disassociate with a next-hop of a static route",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.forcedStale,
+		Name:     "forcedStale",
+		Help:     "resolved entries forced to stale by rpc",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.staleResolved,
+		Name:     "staleResolved",
+		Help:     "forced stale entries resolved again",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.slaacDeprecated,
+		Name:     "slaacDeprecated",
+		Help:     "slaac prefix preferred lifetime expired",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.slaacExpired,
+		Name:     "slaacExpired",
+		Help:     "slaac prefix valid lifetime expired, addresses removed",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.slaacValidLimited,
+		Name:     "slaacValidLimited",
+		Help:     "valid lifetime cut of an RA limited to two hours",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.slaacErrLifetime,
+		Name:     "slaacErrLifetime",
+		Help:     "prefix with preferred lifetime bigger than the valid lifetime",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.nudToReachable,
+		Name:     "nudToReachable",
+		Help:     "nud moves to reachable",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.nudToStale,
+		Name:     "nudToStale",
+		Help:     "nud moves to stale",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.nudToDelay,
+		Name:     "nudToDelay",
+		Help:     "nud moves to delay",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.nudToProbe,
+		Name:     "nudToProbe",
+		Help:     "nud moves to probe",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.nudToIncomplete,
+		Name:     "nudToIncomplete",
+		Help:     "nud probes without an answer, moves to incomplete",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxNudProbe,
+		Name:     "pktTxNudProbe",
+		Help:     "tx nud unicast solicitations",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.offSubnetAnswered,
+		Name:     "offSubnetAnswered",
+		Help:     "answered solicitations of a source outside the prefixes of the client",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.offSubnetSuppressed,
+		Name:     "offSubnetSuppressed",
+		Help:     "solicitations of a source outside the prefixes of the client, not answered by the policy",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxRsSllao,
+		Name:     "pktTxRsSllao",
+		Help:     "tx router solicitations with the source link-layer address option",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxRsNoSllao,
+		Name:     "pktTxRsNoSllao",
+		Help:     "tx router solicitations without the source link-layer address option",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.rsNoRaTimeout,
+		Name:     "rsNoRaTimeout",
+		Help:     "no router advertisement after the router solicitation retries, gave up",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxRdnss,
+		Name:     "pktRxRdnss",
+		Help:     "router advertisement with recursive dns servers",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxErrRdnss,
+		Name:     "pktRxErrRdnss",
+		Help:     "recursive dns server option with a wrong length",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
 	return db
 }
 
+// Ipv6SlaacInfo the SLAAC address of a client, lifetimes are the remaining seconds
+type Ipv6SlaacInfo struct {
+	Ipv6              core.Ipv6Key `json:"ipv6"`
+	PrefixLen         uint8        `json:"prefix_len"`
+	State             string       `json:"state"` // none, preferred, deprecated or expired
+	PreferredLifetime uint32       `json:"preferred_lifetime"`
+	ValidLifetime     uint32       `json:"valid_lifetime"`
+}
+
 type Ipv6NsCacheRec struct {
-	Ipv6    core.Ipv6Key `json:"ipv6"`
-	Refc    uint32       `json:"refc"`
-	State   uint8        `json:"state"`
-	Resolve bool         `json:"resolve"`
-	Mac     core.MACKey  `json:"mac"`
+	Ipv6    core.Ipv6Key  `json:"ipv6"`
+	Refc    uint32        `json:"refc"`
+	State   uint8         `json:"state"`
+	Resolve bool          `json:"resolve"`
+	Mac     core.MACKey   `json:"mac"`
+	Flaps   uint32        `json:"flaps,omitempty"`
+	Dups    uint32        `json:"dups,omitempty"`
+	Sample  []core.MACKey `json:"flap_sample,omitempty"`
+	Nud     string        `json:"nud_state,omitempty"` // INCOMPLETE, REACHABLE, STALE, DELAY or PROBE in case nd_nud is enabled
 }
 
 // Ipv6NsCacheFlowTable manage the ipv6 -> mac with timeout for outside case
@@ -475,6 +895,11 @@ type Ipv6NsCacheFlowTable struct {
 	activeIter    *core.DList /* iterator */
 	stats         *Ipv6NsStats
 	iterReady     bool
+
+	nud            bool   // RFC 4861 NUD of the referenced entries instead of complete/refresh
+	reachableTicks uint32 // NUD timers
+	delayTicks     uint32
+	retransTicks   uint32
 }
 
 func (o *Ipv6NsCacheFlowTable) Create(timerw *core.TimerCtx) {
@@ -486,6 +911,20 @@ func (o *Ipv6NsCacheFlowTable) Create(timerw *core.TimerCtx) {
 	o.second = timerw.DurationToTicks(time.Second)
 }
 
+// SetNud enables the NUD state machine, zero takes the default of the timer
+func (o *Ipv6NsCacheFlowTable) SetNud(reachableSec, retransMsec uint32) {
+	if reachableSec == 0 {
+		reachableSec = nudReachableTime
+	}
+	if retransMsec == 0 {
+		retransMsec = uint32(dadRetransTimer / time.Millisecond)
+	}
+	o.nud = true
+	o.reachableTicks = o.timerw.DurationToTicks(time.Duration(reachableSec) * time.Second)
+	o.delayTicks = o.timerw.DurationToTicks(nudDelayFirstProbe)
+	o.retransTicks = o.timerw.DurationToTicks(time.Duration(retransMsec) * time.Millisecond)
+}
+
 func (o *Ipv6NsCacheFlowTable) OnRemove() {
 	for k := range o.tbl {
 		flow := o.tbl[k]
@@ -532,7 +971,12 @@ func (o *Ipv6NsCacheFlowTable) AssociateWithClient(flow *NdCacheFlow) bool {
 			panic("AssociateWithClient ref should be zero in learn mode")
 		}
 		flow.refc = 1
-		o.MoveToComplete(flow)
+		if o.nud {
+			// learned without a confirmation
+			o.nudStale(flow)
+		} else {
+			o.MoveToComplete(flow)
+		}
 	} else {
 		flow.refc += 1
 	}
@@ -554,11 +998,13 @@ func (o *Ipv6NsCacheFlowTable) AddNew(ipv6 core.Ipv6Key,
 	flow.ipv6 = ipv6
 	flow.state = state
 	flow.head.SetSelf()
+	flow.routes.SetSelf()
 	if IpdgMac != nil {
 		flow.action.IpdgResolved = true
 		flow.action.IpdgMac = *IpdgMac
 	} else {
 		flow.action.IpdgResolved = false
+		flow.action.StartResolve(o.timerw.Ticks)
 	}
 	flow.timer.SetCB(o, flow, 0)
 
@@ -606,9 +1052,14 @@ func (o *Ipv6NsCacheFlowTable) MoveToComplete(flow *NdCacheFlow) {
 }
 
 func (o *Ipv6NsCacheFlowTable) NdLearn(flow *NdCacheFlow, mac *core.MACKey) {
+	if flow.stale {
+		flow.stale = false
+		o.stats.staleResolved++
+	}
 
 	flow.action.IpdgResolved = true
 	flow.action.IpdgMac = *mac
+	flow.action.OnResolved(o.timerw.Ticks)
 	switch flow.state {
 	case stateLearned:
 		flow.touch = true
@@ -623,6 +1074,134 @@ func (o *Ipv6NsCacheFlowTable) NdLearn(flow *NdCacheFlow, mac *core.MACKey) {
 	}
 }
 
+// nudMove moves the flow to a NUD state and restarts the timer, zero ticks does not start it
+func (o *Ipv6NsCacheFlowTable) nudMove(flow *NdCacheFlow, state uint8, ticks uint32) {
+	if flow.timer.IsRunning() {
+		o.timerw.Stop(&flow.timer)
+	}
+	flow.touch = false
+	flow.state = state
+	switch state {
+	case stateReachable:
+		o.stats.nudToReachable++
+	case stateStale:
+		o.stats.nudToStale++
+	case stateDelay:
+		o.stats.nudToDelay++
+	case stateProbe:
+		o.stats.nudToProbe++
+	}
+	if ticks > 0 {
+		o.timerw.StartTicks(&flow.timer, ticks)
+	}
+}
+
+// nudStale moves a referenced flow to stale. The clients send traffic through their gateway and
+// next-hops all the time, so the entry is in use and moves on to delay at once.
+func (o *Ipv6NsCacheFlowTable) nudStale(flow *NdCacheFlow) {
+	o.nudMove(flow, stateStale, 0)
+	o.nudMove(flow, stateDelay, o.delayTicks)
+}
+
+// NudLearn learns a MAC of a neighbor by RFC 4861 7.2.5, a solicited advertisement confirms the
+// reachability, a change of the MAC or an unsolicited learn moves an unconfirmed entry to stale
+func (o *Ipv6NsCacheFlowTable) NudLearn(flow *NdCacheFlow, mac *core.MACKey, solicited bool) {
+	if flow.stale {
+		flow.stale = false
+		o.stats.staleResolved++
+	}
+	changed := !flow.action.IpdgResolved || flow.action.IpdgMac != *mac
+
+	flow.action.IpdgResolved = true
+	flow.action.IpdgMac = *mac
+	flow.action.OnResolved(o.timerw.Ticks)
+	if flow.state == stateLearned {
+		flow.touch = true
+		return
+	}
+	if solicited {
+		o.nudMove(flow, stateReachable, o.reachableTicks)
+	} else if changed || flow.state == stateIncomplete {
+		o.nudStale(flow)
+	}
+}
+
+// sendProbe sends a unicast solicitation to the resolved MAC on behalf of the first client
+func (o *Ipv6NsCacheFlowTable) sendProbe(flow *NdCacheFlow) {
+	var c *NdClientCtx
+	if !flow.head.IsEmpty() {
+		c = pluginArpClientCastfromDlist(flow.head.Next())
+	} else if !flow.routes.IsEmpty() {
+		c = ndRouteRefCastfromDlist(flow.routes.Next()).c
+	} else {
+		panic("sendProbe no valid list  ")
+	}
+	flow.probes++
+	c.SendUnicastNS(&flow.ipv6, &flow.action.IpdgMac)
+}
+
+// onNudTimer handles the timer of the NUD states, the probes that are not answered move the
+// entry back to incomplete, with multicast solicitations
+func (o *Ipv6NsCacheFlowTable) onNudTimer(flow *NdCacheFlow) {
+	switch flow.state {
+	case stateReachable:
+		o.nudStale(flow)
+	case stateDelay:
+		o.nudMove(flow, stateProbe, o.retransTicks)
+		flow.probes = 0
+		o.sendProbe(flow)
+	case stateProbe:
+		if flow.probes < nudMaxUnicastSolicit {
+			o.timerw.StartTicks(&flow.timer, o.retransTicks)
+			o.sendProbe(flow)
+			return
+		}
+		o.stats.nudToIncomplete++
+		flow.state = stateIncomplete
+		flow.index = 0
+		flow.action.IpdgResolved = false
+		flow.action.IpdgMac.Clear()
+		flow.action.StartResolve(o.timerw.Ticks)
+		o.timerw.StartTicks(&flow.timer, o.GetNextTicks(flow))
+		o.SendQuery(flow)
+	}
+}
+
+var nudStateNames = map[uint8]string{
+	stateLearned:    "STALE",
+	stateIncomplete: "INCOMPLETE",
+	stateReachable:  "REACHABLE",
+	stateStale:      "STALE",
+	stateDelay:      "DELAY",
+	stateProbe:      "PROBE",
+}
+
+// CheckAdv check an advertisement against a resolved entry before learning it. An advertisement
+// with a different MAC is a flap, the same MAC within a second of the previous one is a duplicate.
+// return true for each flap once the number of flaps reached the threshold
+func (o *Ipv6NsCacheFlowTable) CheckAdv(flow *NdCacheFlow, mac *core.MACKey, threshold uint32) bool {
+	var crossed bool
+	now := o.timerw.Ticks
+	if flow.action.IpdgResolved {
+		if flow.action.IpdgMac != *mac {
+			o.stats.pktRxNeighborAdvFlap++
+			flow.flaps++
+			flow.sample[flow.sampleCnt%flapSampleSize] = *mac
+			flow.sampleCnt++
+			if threshold > 0 && flow.flaps >= threshold {
+				o.stats.eventsFlap++
+				crossed = true
+			}
+		} else if flow.replied && (now-flow.lastReply) < uint64(o.second) {
+			o.stats.pktRxNeighborAdvDup++
+			flow.dups++
+		}
+	}
+	flow.replied = true
+	flow.lastReply = now
+	return crossed
+}
+
 // Lookup for a resolution
 func (o *Ipv6NsCacheFlowTable) Lookup(ipv6 core.Ipv6Key) *NdCacheFlow {
 	v, ok := o.tbl[ipv6]
@@ -636,17 +1215,41 @@ func (o *Ipv6NsCacheFlowTable) Lookup(ipv6 core.Ipv6Key) *NdCacheFlow {
 /*SendQuery on behalf of the first client */
 func (o *Ipv6NsCacheFlowTable) SendQuery(flow *NdCacheFlow) {
 	if flow.state == stateRefresh || flow.state == stateIncomplete {
-		if flow.head.IsEmpty() {
+		if !flow.head.IsEmpty() {
+			/* take the first and query */
+			cplg := pluginArpClientCastfromDlist(flow.head.Next())
+			cplg.ResolveDG()
+		} else if !flow.routes.IsEmpty() {
+			/* only next-hop of static routes */
+			ref := ndRouteRefCastfromDlist(flow.routes.Next())
+			ref.c.resolveNextHop(&flow.ipv6)
+		} else {
 			panic("SendQuery no valid list  ")
 		}
-		/* take the first and query */
-		cplg := pluginArpClientCastfromDlist(flow.head.Next())
-		cplg.ResolveDG()
 	} else {
 		panic("SendQuery in not valid state ")
 	}
 }
 
+// Release remove a reference of a client, the last one moves the flow to learn
+func (o *Ipv6NsCacheFlowTable) Release(flow *NdCacheFlow) {
+	if flow.refc == 0 {
+		panic(" ref count can't be zero before remove")
+	}
+	flow.refc--
+	if flow.refc == 0 {
+		// move to Learn
+		if !flow.head.IsEmpty() || !flow.routes.IsEmpty() {
+			panic(" head should be empty ")
+		}
+		o.MoveToLearn(flow)
+	} else {
+		if flow.head.IsEmpty() && flow.routes.IsEmpty() {
+			panic(" head should not be empty ")
+		}
+	}
+}
+
 func (o *Ipv6NsCacheFlowTable) GetNextTicks(flow *NdCacheFlow) uint32 {
 	index := flow.index
 	maxl := uint8((len(defaultRetryTimerSec) - 1))
@@ -671,7 +1274,30 @@ func (o *Ipv6NsCacheFlowTable) handleRefreshState(flow *NdCacheFlow) {
 		o.stats.moveIncompleteAfterRefresh++
 		flow.action.IpdgResolved = false
 		flow.action.IpdgMac.Clear()
+		flow.action.StartResolve(o.timerw.Ticks)
+	}
+}
+
+// SetStale moves a resolved entry to the refresh state as if the complete timer has just expired
+// without a packet, the solicitation is sent now and the resolved MAC is kept until the retries are done.
+func (o *Ipv6NsCacheFlowTable) SetStale(flow *NdCacheFlow) error {
+	if o.nud && flow.state == stateReachable {
+		flow.stale = true
+		o.stats.forcedStale++
+		o.nudStale(flow)
+		return nil
+	}
+	if flow.state != stateComplete {
+		return fmt.Errorf("nd entry %v is not resolved", flow.ipv6.ToIP())
 	}
+	o.timerw.Stop(&flow.timer)
+	flow.touch = false
+	flow.stale = true
+	flow.state = stateRefresh
+	flow.index = 0
+	o.stats.forcedStale++
+	o.handleRefreshState(flow)
+	return nil
 }
 
 /* OnEvent timer callback */
@@ -705,6 +1331,9 @@ func (o *Ipv6NsCacheFlowTable) OnEvent(a, b interface{}) {
 		o.stats.timerEventRefresh++
 		o.handleRefreshState(flow)
 
+	case stateReachable, stateDelay, stateProbe:
+		o.onNudTimer(flow)
+
 	default:
 		panic("Ipv6nd on event  ")
 	}
@@ -744,24 +1373,55 @@ func (o *Ipv6NsCacheFlowTable) GetNext(n uint16) ([]Ipv6NsCacheRec, error) {
 		}
 
 		ent := covertToNdCacheFlow(o.activeIter)
-		var jsone Ipv6NsCacheRec
-		jsone.Ipv6 = ent.ipv6
-		jsone.Refc = ent.refc
-		jsone.State = ent.state
-		jsone.Resolve = ent.action.IpdgResolved
-		jsone.Mac = ent.action.IpdgMac
-
-		r = append(r, jsone)
+		r = append(r, o.getRec(ent))
 		o.activeIter = o.activeIter.Next()
 	}
 	return r, nil
 }
 
+func (o *Ipv6NsCacheFlowTable) getRec(ent *NdCacheFlow) Ipv6NsCacheRec {
+	var jsone Ipv6NsCacheRec
+	jsone.Ipv6 = ent.ipv6
+	jsone.Refc = ent.refc
+	jsone.State = ent.state
+	jsone.Resolve = ent.action.IpdgResolved
+	jsone.Mac = ent.action.IpdgMac
+	jsone.Flaps = ent.flaps
+	jsone.Dups = ent.dups
+	jsone.Sample = ent.getFlapSample()
+	if o.nud {
+		jsone.Nud = nudStateNames[ent.state]
+	}
+	return jsone
+}
+
+// GetAll returns all the entries of the cache sorted by the ip
+func (o *Ipv6NsCacheFlowTable) GetAll() []Ipv6NsCacheRec {
+	r := make([]Ipv6NsCacheRec, 0, len(o.tbl))
+	for _, ent := range o.tbl {
+		r = append(r, o.getRec(ent))
+	}
+	sort.Slice(r, func(i, j int) bool { return bytes.Compare(r[i].Ipv6[:], r[j].Ipv6[:]) < 0 })
+	return r
+}
+
 func pluginArpClientCastfromDlist(o *core.DList) *NdClientCtx {
 	var s NdClientCtx
 	return (*NdClientCtx)(unsafe.Pointer(uintptr(unsafe.Pointer(o)) - unsafe.Offsetof(s.dlist)))
 }
 
+// ndRouteRef a reference of a client to the flow of a next-hop of its static routes
+type ndRouteRef struct {
+	dlist core.DList /* to link to NdCacheFlow */
+	c     *NdClientCtx
+	flow  *NdCacheFlow
+}
+
+func ndRouteRefCastfromDlist(o *core.DList) *ndRouteRef {
+	var s ndRouteRef
+	return (*ndRouteRef)(unsafe.Pointer(uintptr(unsafe.Pointer(o)) - unsafe.Offsetof(s.dlist)))
+}
+
 type NdClientTimer struct {
 }
 
@@ -784,6 +1444,25 @@ type NdClientCtx struct {
 	timerCb          NdClientTimer
 	timerw           *core.TimerCtx
 	timerNASec       uint32
+	optimistic       bool                    // optimistic DAD (RFC 4429)
+	dadState         map[core.Ipv6Key]uint8  // DAD state of the addresses, see dadOptimistic
+	dadExpire        map[core.Ipv6Key]uint64 // tick in which the optimistic address becomes preferred
+	dadTimer         core.CHTimerObj
+	dadTimerCb       NdClientDadTimer
+	dadTicks         uint32
+	linkLocals       []core.Ipv6Key               // additional link-local addresses
+	routes           map[core.Ipv6Key]*ndRouteRef // next-hops of the static routes
+	offSubnet        uint8                        // see core.OFF_SUBNET_ANSWER
+	skipDad          bool                         // claim the addresses without DAD
+	shortDad         bool                         // DAD wait is shorter than RetransTimer
+}
+
+type NdClientDadTimer struct {
+}
+
+func (o *NdClientDadTimer) OnEvent(a, b interface{}) {
+	c := a.(*NdClientCtx)
+	c.onDadTimer()
 }
 
 func (o *NdClientCtx) advIPv6SrcAddr(srcipv6 *core.Ipv6Key) {
@@ -923,6 +1602,7 @@ func (o *NdClientCtx) Init(base *PluginIpv6Client,
 
 	// set default values
 	o.timerNASec = advTimerSec
+	dadWait := dadRetransTimer
 
 	if err == nil {
 		/* init json was provided */
@@ -932,10 +1612,26 @@ func (o *NdClientCtx) Init(base *PluginIpv6Client,
 		if init.TimerDisable {
 			o.timerNASec = 0
 		}
+		o.optimistic = init.OptimisticDad
+		o.linkLocals = init.LinkLocals
+		o.offSubnet, _ = core.ParseOffSubnetPolicy(init.OffSubnet)
+		o.skipDad = init.SkipDad
+		if init.DadMsec > 0 {
+			dadWait = time.Duration(init.DadMsec) * time.Millisecond
+		}
+		o.shortDad = dadWait < dadRetransTimer
 	}
 
-	o.timerw = o.base.Tctx.GetTimerCtx()
+	o.timerw = o.base.Ns.GetTimerCtx()
 	o.timer.SetCB(&o.timerCb, o, 0)
+	o.dadState = make(map[core.Ipv6Key]uint8)
+	o.dadExpire = make(map[core.Ipv6Key]uint64)
+	o.dadTimer.SetCB(&o.dadTimerCb, o, 0)
+	o.dadTicks = o.timerw.DurationToTicks(dadWait)
+	if o.dadTicks == 0 {
+		o.dadTicks = 1
+	}
+	o.routes = make(map[core.Ipv6Key]*ndRouteRef)
 	o.timerw.Start(&o.timer, time.Duration(o.timerNASec)*time.Second)
 
 	o.OnCreate()
@@ -965,6 +1661,7 @@ func (o *NdClientCtx) OnEvent(msg string, a, b interface{}) {
 		if newIPv6 != oldIPv6 {
 			if !oldIPv6.IsZero() {
 				o.removeMc(&oldIPv6)
+				o.removeDad(oldIPv6)
 			}
 
 			o.nsPlug.stats.eventsChangeDHCPSrc++
@@ -974,6 +1671,7 @@ func (o *NdClientCtx) OnEvent(msg string, a, b interface{}) {
 				l6 = newIPv6
 				// send unsolicitate message
 				pmac := &o.base.Client.Mac
+				o.startOptimistic(&l6)
 				o.SendUnsolicitedNaIpv6(&l6, nil, pmac)
 				o.SendNS(true, nil, &l6) // dad, not by RFC. assuming it is ok
 				o.AdvIPv6()
@@ -985,6 +1683,9 @@ func (o *NdClientCtx) OnEvent(msg string, a, b interface{}) {
 		newIPv6 := b.(core.Ipv6Key)
 		if !oldIPv6.IsZero() {
 			o.removeMc(&oldIPv6)
+			if newIPv6 != oldIPv6 {
+				o.removeDad(oldIPv6)
+			}
 		}
 		if newIPv6 != oldIPv6 {
 			o.nsPlug.stats.eventsChangeSrc++
@@ -1004,7 +1705,42 @@ func (o *NdClientCtx) OnEvent(msg string, a, b interface{}) {
 				newIPv6)
 		}
 
+	case core.MSG_UPDATE_ROUTES:
+		o.updateRoutes(a.([]*core.CClientRoute), b.([]*core.CClientRoute))
+	}
+}
+
+// updateRoutes - called in case the static routes were replaced, the next-hops of the new ipv6
+// routes are associated with NdCacheFlow objects
+func (o *NdClientCtx) updateRoutes(old []*core.CClientRoute,
+	routes []*core.CClientRoute) {
+	for _, r := range old {
+		if r.IsIpv6 {
+			r.Dg = nil
+		}
+	}
+	refs := make(map[core.Ipv6Key]*ndRouteRef)
+	for _, r := range routes {
+		if !r.IsIpv6 {
+			continue
+		}
+		nh := r.NextHopIpv6
+		ref, ok := refs[nh]
+		if !ok {
+			ref, ok = o.routes[nh]
+			if ok {
+				delete(o.routes, nh)
+			} else {
+				ref = o.nsPlug.AssociateRoute(o, nh)
+			}
+			refs[nh] = ref
+		}
+		r.Dg = &ref.flow.action
 	}
+	for _, ref := range o.routes {
+		o.nsPlug.DisassociateRoute(ref)
+	}
+	o.routes = refs
 }
 
 /*OnChangeDGSrcIPv6 - called in case there is a change in Client.DgIpv6 ,
@@ -1039,15 +1775,25 @@ func (o *NdClientCtx) OnRemove(ctx *core.PluginCtx) {
 		o.removeMc(&o.base.Client.Dhcpv6)
 	}
 
+	for i := range o.linkLocals {
+		l6 := &o.linkLocals[i]
+		o.removeMc(l6)
+		delete(o.nsPlug.linkLocals, *l6)
+	}
+
 	o.base.Client.Ipv6Router = nil
 
 	if !o.base.Client.DgIpv6.IsZero() {
 		o.nsPlug.DisassociateClient(o, o.base.Client.DgIpv6)
 	}
+	o.updateRoutes(o.base.Client.Routes, nil)
 
 	if o.timer.IsRunning() {
 		o.timerw.Stop(&o.timer)
 	}
+	if o.dadTimer.IsRunning() {
+		o.timerw.Stop(&o.dadTimer)
+	}
 }
 
 func IPv6SolicitationMcAddr(ipv6 *core.Ipv6Key, ipv6mc *core.Ipv6Key) {
@@ -1075,6 +1821,7 @@ func (o *NdClientCtx) OnCreate() {
 		o.addMcCache(&o.base.Client.Ipv6)
 	}
 	o.SendUnsolicitedNA()
+	o.addLinkLocals()
 	o.AdvIPv6()
 
 	// resolve the current default GW if exits
@@ -1084,13 +1831,24 @@ func (o *NdClientCtx) OnCreate() {
 			o.nsPlug.AssociateClient(o)
 		}
 	}
-
+	o.updateRoutes(nil, o.base.Client.Routes)
 }
 
 // send node solicitation
 func (o *NdClientCtx) SendNS(dad bool, sourceipv6 *core.Ipv6Key, target *core.Ipv6Key) {
+	if o.base.Ns.SuppressTx() {
+		return
+	}
 	mac := o.base.Client.Mac
 	if dad {
+		if o.skipDad {
+			// the address is used right away, the owner (if there is one) is not asked
+			o.nsPlug.stats.dadImproper++
+			return
+		}
+		if o.shortDad {
+			o.nsPlug.stats.dadImproper++
+		}
 		// no sourceTarget option
 		m := o.base.Ns.AllocMbuf(uint16(len(o.nsDadPktTemplate)))
 		m.Append(o.nsDadPktTemplate)
@@ -1107,10 +1865,33 @@ func (o *NdClientCtx) SendNS(dad bool, sourceipv6 *core.Ipv6Key, target *core.Ip
 		copy(p[l4+8:l4+8+16], target[:]) //target
 		copy(p[0:6], []byte{0x33, 0x33, mcipv6[12], mcipv6[13], mcipv6[14], mcipv6[15]})
 
+		o.startOptimistic(target)
 		o.nsPlug.stats.pktTxNeighborUnsolicitedDAD++
 		ipv6.FixIcmpL4Checksum(p[l4:], 0)
 		o.base.Tctx.Veth.Send(m)
 
+	} else if o.IsOptimistic(sourceipv6) {
+		// RFC 4429, no source link-layer option from an optimistic address
+		m := o.base.Ns.AllocMbuf(uint16(len(o.nsDadPktTemplate)))
+		m.Append(o.nsDadPktTemplate)
+		p := m.GetData()
+		l3 := o.pktOffset
+		ipv6 := layers.IPv6Header(p[l3 : l3+40])
+		l4 := l3 + 40
+
+		var mcipv6 core.Ipv6Key
+
+		IPv6SolicitationMcAddr(target, &mcipv6)
+
+		copy(ipv6.SrcIP()[:], sourceipv6[:])
+		copy(ipv6.DstIP()[:], mcipv6[:])
+		copy(p[l4+8:l4+8+16], target[:])
+		copy(p[0:6], []byte{0x33, 0x33, mcipv6[12], mcipv6[13], mcipv6[14], mcipv6[15]})
+
+		o.nsPlug.stats.pktTxNeighborUnsolicitedQuery++
+		o.nsPlug.stats.pktTxNeighborNoSllao++
+		ipv6.FixIcmpL4Checksum(p[l4:], 0)
+		o.base.Tctx.Veth.Send(m)
 	} else {
 
 		m := o.base.Ns.AllocMbuf(uint16(len(o.nsPktTemplate)))
@@ -1139,6 +1920,34 @@ func (o *NdClientCtx) SendNS(dad bool, sourceipv6 *core.Ipv6Key, target *core.Ip
 
 }
 
+// SendUnicastNS sends a NUD probe, a solicitation from the link-local address to the target and its MAC
+func (o *NdClientCtx) SendUnicastNS(target *core.Ipv6Key, dmac *core.MACKey) {
+	if o.base.Ns.SuppressTx() {
+		return
+	}
+	mac := o.base.Client.Mac
+	m := o.base.Ns.AllocMbuf(uint16(len(o.nsPktTemplate)))
+	m.Append(o.nsPktTemplate)
+	p := m.GetData()
+	l3 := o.pktOffset
+	ipv6 := layers.IPv6Header(p[l3 : l3+40])
+	l4 := l3 + 40
+
+	var l6 core.Ipv6Key
+	o.base.Client.GetIpv6LocalLink(&l6)
+	copy(ipv6.SrcIP()[:], l6[:])
+	copy(ipv6.DstIP()[:], target[:])
+	copy(p[l4+8:l4+8+16], target[:])
+	copy(p[0:6], dmac[:])
+
+	oo := l4 + 8 + 16 + 2
+	copy(p[oo:oo+6], mac[:])
+
+	o.nsPlug.stats.pktTxNudProbe++
+	ipv6.FixIcmpL4Checksum(p[l4:], 0)
+	o.base.Tctx.Veth.Send(m)
+}
+
 func (o *NdClientCtx) SendUnsolicitedSlaac() {
 	var l6 core.Ipv6Key
 	if o.base.Client.GetIpv6Slaac(&l6) {
@@ -1178,6 +1987,9 @@ func (o *NdClientCtx) SendUnsolicitedNA() {
 }
 
 func (o *NdClientCtx) SendUnsolicitedNaIpv6(target *core.Ipv6Key, source *core.Ipv6Key, mac *core.MACKey) {
+	if o.base.Ns.SuppressTx() {
+		return
+	}
 
 	m := o.base.Ns.AllocMbuf(uint16(len(o.naPktTemplate)))
 	m.Append(o.naPktTemplate)
@@ -1196,7 +2008,12 @@ func (o *NdClientCtx) SendUnsolicitedNaIpv6(target *core.Ipv6Key, source *core.I
 	}
 
 	copy(p[0:6], []byte{0x33, 0x33, 0, 0, 0, 1})
-	p[l4+4] = 0x20
+	if o.IsOptimistic(target) {
+		// RFC 4429, the override flag must not be set for an optimistic address
+		o.nsPlug.stats.pktTxNeighborNoOverride++
+	} else {
+		p[l4+4] = 0x20
+	}
 	o.nsPlug.stats.pktTxNeighborUnsolicitedNA++
 
 	ipv6.FixIcmpL4Checksum(p[l4:], 0)
@@ -1204,6 +2021,13 @@ func (o *NdClientCtx) SendUnsolicitedNaIpv6(target *core.Ipv6Key, source *core.I
 	o.base.Tctx.Veth.Send(m)
 }
 
+// resolveNextHop query a next-hop of a static route
+func (o *NdClientCtx) resolveNextHop(nh *core.Ipv6Key) {
+	var l6 core.Ipv6Key
+	o.base.Client.GetIpv6LocalLink(&l6)
+	o.SendNS(false, &l6, nh)
+}
+
 func (o *NdClientCtx) ResolveDG() {
 	// send query for DG
 	dg := &o.base.Client.DgIpv6
@@ -1216,6 +2040,30 @@ func (o *NdClientCtx) ResolveDG() {
 	}
 }
 
+// addLinkLocals registers the additional link-local addresses in the namespace and runs DAD on each,
+// the address is advertised once DAD has finished
+func (o *NdClientCtx) addLinkLocals() {
+	var auto core.Ipv6Key
+	o.base.Client.GetIpv6LocalLink(&auto)
+	vec := o.linkLocals
+	o.linkLocals = nil
+	for _, l6 := range vec {
+		_, used := o.nsPlug.linkLocals[l6]
+		if !net.IP(l6[:]).IsLinkLocalUnicast() || l6 == auto || used {
+			o.nsPlug.stats.linkLocalErr++
+			continue
+		}
+		o.linkLocals = append(o.linkLocals, l6)
+		o.nsPlug.linkLocals[l6] = o
+		o.nsPlug.stats.linkLocalAdd++
+		o.addMcCache(&l6)
+		if !o.optimistic && !o.skipDad {
+			o.startTentative(&l6)
+		}
+		o.SendNS(true, nil, &l6)
+	}
+}
+
 // respond with Neighbor adv
 func (o *NdClientCtx) Respond(mac *core.MACKey, ps *core.ParserPacketState) {
 
@@ -1232,6 +2080,34 @@ func (o *NdClientCtx) Respond(mac *core.MACKey, ps *core.ParserPacketState) {
 
 	sip := net.IP(sipv6.SrcIP()[:])
 	l4 := l3 + 40
+	var tipv6 core.Ipv6Key
+	copy(tipv6[:], psrc[ps.L4+8:ps.L4+8+16])
+	if o.dadState[tipv6] == dadDuplicate {
+		m.FreeMbuf()
+		return
+	}
+	if o.dadState[tipv6] == dadTentative {
+		// RFC 4862 5.4.3, a DAD of another node is a duplicate, other solicitations are ignored
+		m.FreeMbuf()
+		if sip.IsUnspecified() {
+			o.OnDadDuplicate(tipv6)
+		}
+		return
+	}
+	if sip.IsUnspecified() && o.IsOptimistic(&tipv6) {
+		// someone else runs DAD on our optimistic address
+		m.FreeMbuf()
+		o.OnDadDuplicate(tipv6)
+		return
+	}
+	if o.isOffSubnet(sip) {
+		if o.offSubnet == core.OFF_SUBNET_IGNORE {
+			o.nsPlug.stats.offSubnetSuppressed++
+			m.FreeMbuf()
+			return
+		}
+		o.nsPlug.stats.offSubnetAnswered++
+	}
 	copy(p[l4+8:l4+8+16], psrc[ps.L4+8:ps.L4+8+16]) //target
 	oo := l4 + 8 + 16 + 2
 	copy(p[oo:oo+6], mac[:]) //mac option as an answer
@@ -1244,7 +2120,12 @@ func (o *NdClientCtx) Respond(mac *core.MACKey, ps *core.ParserPacketState) {
 		copy(ipv6.SrcIP()[:], psrc[ps.L4+8:ps.L4+8+16]) //target
 		copy(ipv6.DstIP()[:], sipv6.SrcIP()[:])
 		o.nsPlug.stats.pktTxNeighborAdvUnicast++
-		p[l4+4] = 0x60
+		if o.IsOptimistic(&tipv6) {
+			o.nsPlug.stats.pktTxNeighborNoOverride++
+			p[l4+4] = 0x40
+		} else {
+			p[l4+4] = 0x60
+		}
 	}
 
 	ipv6.FixIcmpL4Checksum(p[l4:], 0)
@@ -1252,10 +2133,123 @@ func (o *NdClientCtx) Respond(mac *core.MACKey, ps *core.ParserPacketState) {
 	o.base.Tctx.Veth.Send(m)
 }
 
+// isOffSubnet checks that a global source is outside the /64 prefixes of the client (router, static
+// and DHCPv6). Link-local and unspecified sources are on link, the subnet is not known without a prefix.
+func (o *NdClientCtx) isOffSubnet(sip net.IP) bool {
+	if sip.IsUnspecified() || sip.IsLinkLocalUnicast() {
+		return false
+	}
+	c := o.base.Client
+	var prefixes []core.Ipv6Key
+	if c.Ipv6Router != nil && c.Ipv6Router.PrefixLen == 64 {
+		prefixes = append(prefixes, c.Ipv6Router.PrefixIpv6)
+	}
+	for _, a := range []core.Ipv6Key{c.Ipv6, c.Dhcpv6} {
+		if !a.IsZero() {
+			prefixes = append(prefixes, a)
+		}
+	}
+	if len(prefixes) == 0 {
+		return false
+	}
+	for _, pr := range prefixes {
+		if bytes.Equal(pr[0:8], sip[0:8]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (o *NdClientCtx) SendRouterSolicitation() {
 
 }
 
+// IsOptimistic returns true if DAD is still running on this optimistic address
+func (o *NdClientCtx) IsOptimistic(ipv6 *core.Ipv6Key) bool {
+	if !o.optimistic || ipv6 == nil {
+		return false
+	}
+	return o.dadState[*ipv6] == dadOptimistic
+}
+
+// startOptimistic marks a new address as optimistic until DAD has finished
+func (o *NdClientCtx) startOptimistic(ipv6 *core.Ipv6Key) {
+	if !o.optimistic || o.skipDad {
+		return
+	}
+	if _, ok := o.dadState[*ipv6]; ok {
+		return
+	}
+	o.dadState[*ipv6] = dadOptimistic
+	o.dadExpire[*ipv6] = o.timerw.Ticks + uint64(o.dadTicks)
+	o.nsPlug.stats.dadOptimisticAddr++
+	if !o.dadTimer.IsRunning() {
+		o.timerw.StartTicks(&o.dadTimer, o.dadTicks)
+	}
+}
+
+// IsTentative returns true if DAD is running on this address and it is not used yet
+func (o *NdClientCtx) IsTentative(ipv6 *core.Ipv6Key) bool {
+	return o.dadState[*ipv6] == dadTentative
+}
+
+// startTentative starts DAD on a new address, it is used only after DAD has finished
+func (o *NdClientCtx) startTentative(ipv6 *core.Ipv6Key) {
+	o.dadState[*ipv6] = dadTentative
+	o.dadExpire[*ipv6] = o.timerw.Ticks + uint64(o.dadTicks)
+	if !o.dadTimer.IsRunning() {
+		o.timerw.StartTicks(&o.dadTimer, o.dadTicks)
+	}
+}
+
+func (o *NdClientCtx) removeDad(ipv6 core.Ipv6Key) {
+	delete(o.dadState, ipv6)
+	delete(o.dadExpire, ipv6)
+}
+
+// onDadTimer moves the optimistic addresses without a conflict to preferred
+func (o *NdClientCtx) onDadTimer() {
+	var next uint64
+	pmac := &o.base.Client.Mac
+	for ipv6, expire := range o.dadExpire {
+		if expire > o.timerw.Ticks {
+			if next == 0 || expire < next {
+				next = expire
+			}
+			continue
+		}
+		delete(o.dadExpire, ipv6)
+		if o.dadState[ipv6] == dadTentative {
+			o.nsPlug.stats.linkLocalPreferred++
+		} else {
+			o.nsPlug.stats.dadOptimisticPreferred++
+		}
+		o.dadState[ipv6] = dadPreferred
+		// advertise again, this time with the override flag
+		l6 := ipv6
+		var source *core.Ipv6Key
+		if !net.IP(l6[:]).IsLinkLocalUnicast() {
+			source = &l6
+		}
+		o.SendUnsolicitedNaIpv6(&l6, source, pmac)
+	}
+	if next != 0 {
+		o.timerw.StartTicks(&o.dadTimer, uint32(next-o.timerw.Ticks))
+	}
+}
+
+// OnDadDuplicate is called when a duplicate of an optimistic or tentative address was detected,
+// the address is invalidated and the client stops answering for it.
+func (o *NdClientCtx) OnDadDuplicate(ipv6 core.Ipv6Key) {
+	delete(o.dadExpire, ipv6)
+	if o.dadState[ipv6] == dadTentative {
+		o.nsPlug.stats.linkLocalDadConflict++
+	} else {
+		o.nsPlug.stats.dadOptimisticInvalidated++
+	}
+	o.dadState[ipv6] = dadDuplicate
+}
+
 type RouterAdNsTimer struct {
 }
 
@@ -1264,6 +2258,14 @@ func (o *RouterAdNsTimer) OnEvent(a, b interface{}) {
 	ns.onRouterAdTimerUpdate()
 }
 
+type SlaacNsTimer struct {
+}
+
+func (o *SlaacNsTimer) OnEvent(a, b interface{}) {
+	ns := a.(*NdNsCtx)
+	ns.onSlaacTimer()
+}
+
 // NdNsCtx arp information per namespace
 type NdNsCtx struct {
 	base           *PluginIpv6Ns
@@ -1277,16 +2279,51 @@ type NdNsCtx struct {
 	routerAdCnt    uint32
 	timerRouterSo  core.CHTimerObj // timer to ask solicitation from the router
 	routerSoMac    core.MACKey
+	rsSllao        bool   // the router solicitations have the SLLAO
+	rsRetries      uint32 // router solicitations before giving up
+	flapThreshold  uint32
+	unaPolicy      uint8
+	unas           core.CNeighborAnnounceLog
+	linkLocals     map[core.Ipv6Key]*NdClientCtx // additional link-local addresses of the clients
+	slaacTimerCB   SlaacNsTimer
+	slaacTimer     core.CHTimerObj // the next preferred/valid lifetime expiration of the prefix
+	slaacState     uint8
+	slaacPrefix    core.Ipv6Key // the last prefix, kept after it expired
+	slaacPrefLen   uint8
+	slaacPrefEnd   uint64 // ticks, math.MaxUint64 is infinite
+	slaacValidEnd  uint64
 }
 
 func (o *NdNsCtx) Init(base *PluginIpv6Ns, ctx *core.CThreadCtx, initJson []byte) {
+	var init NdNsInit
+	err := fastjson.Unmarshal(initJson, &init)
+
 	o.base = base
-	o.timerw = ctx.GetTimerCtx()
+	o.flapThreshold = defaultFlapThreshold
+	if err == nil && init.FlapThreshold > 0 {
+		o.flapThreshold = init.FlapThreshold
+	}
+	if err == nil {
+		o.unaPolicy, _ = core.ParseAnnouncePolicy(init.UnaPolicy)
+	}
+	o.rsRetries = routeSolRet
+	if err == nil {
+		o.rsSllao = init.RsSllao
+		if init.RsRetries > 0 {
+			o.rsRetries = init.RsRetries
+		}
+	}
+	o.timerw = base.Ns.GetTimerCtx()
 	o.tbl.Create(o.timerw)
+	if err == nil && init.Nud {
+		o.tbl.SetNud(init.ReachableSec, init.RetransMsec)
+	}
 	o.tbl.stats = &o.stats
 	o.cdb = NewIpv6NsStatsDb(&o.stats)
+	o.linkLocals = make(map[core.Ipv6Key]*NdClientCtx)
 
 	o.timerRouterSo.SetCB(&o.routeAdTimerCB, o, 0) // set the callback to OnEvent
+	o.slaacTimer.SetCB(&o.slaacTimerCB, o, 0)
 	o.routerAdTicks = o.timerw.DurationToTicks(routeSolSec * time.Second)
 }
 
@@ -1306,10 +2343,13 @@ func (o *NdNsCtx) StartRouterSol(routerSoMac core.MACKey) {
 // callback in case of advTimer
 func (o *NdNsCtx) onRouterAdTimerUpdate() {
 	o.routerAdCnt++
-	if o.routerAdCnt < routeSolRet {
+	if o.routerAdCnt < o.rsRetries {
 		o.SendRouterSolicitation(o.routerSoMac)
 		o.timerw.StartTicks(&o.timerRouterSo, o.routerAdTicks)
+		return
 	}
+	// no RA for all the retries, give up
+	o.stats.rsNoRaTimeout++
 }
 
 func (o *NdNsCtx) OnRemove(ctx *core.PluginCtx) {
@@ -1317,6 +2357,9 @@ func (o *NdNsCtx) OnRemove(ctx *core.PluginCtx) {
 	if o.timerRouterSo.IsRunning() {
 		o.timerw.Stop(&o.timerRouterSo)
 	}
+	if o.slaacTimer.IsRunning() {
+		o.timerw.Stop(&o.slaacTimer)
+	}
 
 	o.tbl.OnRemove()
 }
@@ -1325,7 +2368,140 @@ func (o *NdNsCtx) OnEvent(msg string, a, b interface{}) {
 
 }
 
+func (o *NdNsCtx) lifetimeEnd(sec uint32) uint64 {
+	if sec == slaacInfinite {
+		return math.MaxUint64
+	}
+	// the ticks of a long lifetime do not fit in uint32, count them per second
+	return o.timerw.Ticks + uint64(sec)*uint64(o.timerw.DurationToTicks(time.Second))
+}
+
+// lifetimeLeft returns the remaining ticks up to end
+func (o *NdNsCtx) lifetimeLeft(end uint64) uint64 {
+	if end <= o.timerw.Ticks {
+		return 0
+	}
+	return end - o.timerw.Ticks
+}
+
+// lifetimeLeftSec returns the remaining lifetime in seconds as in the prefix option
+func (o *NdNsCtx) lifetimeLeftSec(end uint64) uint32 {
+	if end == math.MaxUint64 {
+		return slaacInfinite
+	}
+	return uint32(o.lifetimeLeft(end) / uint64(o.timerw.DurationToTicks(time.Second)))
+}
+
+// updateRdnss handles the recursive DNS servers of an RA, the resolvers of the clients. A zero
+// lifetime removes them, the lifetime is not tracked otherwise
+func (o *NdNsCtx) updateRdnss(data []byte) {
+	if len(data) < 22 || (len(data)-6)%16 != 0 {
+		o.stats.pktRxErrRdnss++
+		return
+	}
+	o.stats.pktRxRdnss++
+	o.routerAd.Rdnss = o.routerAd.Rdnss[:0]
+	if binary.BigEndian.Uint32(data[2:6]) == 0 {
+		return
+	}
+	for i := 6; i < len(data); i += 16 {
+		var dns core.Ipv6Key
+		copy(dns[:], data[i:i+16])
+		o.routerAd.Rdnss = append(o.routerAd.Rdnss, dns)
+	}
+}
+
+// updateSlaacPrefix handles an autonomous prefix of an RA (RFC 4862 5.5.3), a new prefix replaces
+// the current one, the same prefix updates the lifetimes. return false in case it was ignored
+func (o *NdNsCtx) updateSlaacPrefix(prefix core.Ipv6Key, prefixLen uint8, valid, preferred uint32) bool {
+	if preferred > valid {
+		o.stats.slaacErrLifetime++
+		return false
+	}
+	active := o.slaacState == slaacPreferred || o.slaacState == slaacDeprecated
+	if !active || o.slaacPrefix != prefix || o.slaacPrefLen != prefixLen {
+		if valid == 0 {
+			return false
+		}
+		o.slaacPrefix = prefix
+		o.slaacPrefLen = prefixLen
+		o.slaacValidEnd = o.lifetimeEnd(valid)
+	} else {
+		left := o.lifetimeLeftSec(o.slaacValidEnd)
+		if valid > slaacTwoHours || valid > left {
+			o.slaacValidEnd = o.lifetimeEnd(valid)
+		} else if left > slaacTwoHours {
+			o.slaacValidEnd = o.lifetimeEnd(slaacTwoHours)
+			o.stats.slaacValidLimited++
+		}
+	}
+	o.slaacPrefEnd = o.lifetimeEnd(preferred)
+	o.routerAd.PrefixLen = prefixLen
+	o.routerAd.PrefixIpv6 = prefix
+	o.onSlaacTimer()
+	return true
+}
+
+// onSlaacTimer moves the prefix to the state of its lifetimes and restarts the timer to the next expiration
+func (o *NdNsCtx) onSlaacTimer() {
+	if o.slaacTimer.IsRunning() {
+		o.timerw.Stop(&o.slaacTimer)
+	}
+	valid := o.lifetimeLeft(o.slaacValidEnd)
+	if valid == 0 {
+		o.slaacState = slaacExpired
+		o.stats.slaacExpired++
+		o.routerAd.Deprecated = false
+		o.routerAd.PrefixLen = 0
+		o.routerAd.PrefixIpv6 = core.Ipv6Key{}
+		return
+	}
+	next := valid
+	preferred := o.lifetimeLeft(o.slaacPrefEnd)
+	if preferred == 0 {
+		if o.slaacState != slaacDeprecated {
+			o.stats.slaacDeprecated++
+		}
+		o.slaacState = slaacDeprecated
+	} else {
+		o.slaacState = slaacPreferred
+		if preferred < next {
+			next = preferred
+		}
+	}
+	o.routerAd.Deprecated = o.slaacState == slaacDeprecated
+	if o.slaacValidEnd == math.MaxUint64 && (o.slaacState == slaacDeprecated || o.slaacPrefEnd == math.MaxUint64) {
+		return
+	}
+	maxTicks := uint64(o.timerw.DurationToTicks(slaacMaxTimerSec * time.Second))
+	if next > maxTicks {
+		next = maxTicks
+	}
+	o.timerw.StartTicks(&o.slaacTimer, uint32(next))
+}
+
+// SlaacState returns the state of the SLAAC address that the client has built from the last prefix
+func (o *NdNsCtx) SlaacState(c *core.CClient) *Ipv6SlaacInfo {
+	var res Ipv6SlaacInfo
+	res.State = slaacStateNames[o.slaacState]
+	if o.slaacState == slaacNone {
+		return &res
+	}
+	res.PrefixLen = o.slaacPrefLen
+	if o.slaacPrefLen == 64 {
+		c.GetIpv6SlaacOfPrefix(&o.slaacPrefix, &res.Ipv6)
+	}
+	if o.slaacState != slaacExpired {
+		res.PreferredLifetime = o.lifetimeLeftSec(o.slaacPrefEnd)
+		res.ValidLifetime = o.lifetimeLeftSec(o.slaacValidEnd)
+	}
+	return &res
+}
+
 func (o *NdNsCtx) SendRouterSolicitation(srcMac core.MACKey) {
+	if o.base.Ns.SuppressTx() {
+		return
+	}
 
 	// dynamic allocated because it is rare to have this message (once to trigger per namespace)
 	l2 := o.base.Ns.GetL2Header(false, uint16(layers.EthernetTypeIPv6))
@@ -1333,6 +2509,24 @@ func (o *NdNsCtx) SendRouterSolicitation(srcMac core.MACKey) {
 	copy(l2[0:6], []byte{0x33, 0x33, 0, 0, 0, 2})
 	copy(l2[6:12], srcMac[:])
 
+	// the SLLAO is not allowed with the unspecified source (RFC 4861 4.1), so the solicitation is
+	// sent from the link-local address of the client
+	var src net.IP = net.IPv6unspecified
+	var rs layers.ICMPv6RouterSolicitation
+	if o.rsSllao {
+		if c := o.base.Ns.CLookupByMac(&srcMac); c != nil {
+			var l6 core.Ipv6Key
+			c.GetIpv6LocalLink(&l6)
+			src = net.IP(l6[:])
+			rs.Options = layers.ICMPv6Options{{Type: layers.ICMPv6OptSourceAddress, Data: srcMac[:]}}
+		}
+	}
+	if rs.Options != nil {
+		o.stats.pktTxRsSllao++
+	} else {
+		o.stats.pktTxRsNoSllao++
+	}
+
 	rsHeader := core.PacketUtlBuild(
 
 		&layers.IPv6{
@@ -1342,13 +2536,13 @@ func (o *NdNsCtx) SendRouterSolicitation(srcMac core.MACKey) {
 			Length:       8,
 			NextHeader:   layers.IPProtocolICMPv6,
 			HopLimit:     255,
-			SrcIP:        net.IP{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+			SrcIP:        src,
 			DstIP:        net.IP{0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02},
 		},
 
 		&layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeRouterSolicitation, 0)},
 
-		&layers.ICMPv6RouterSolicitation{},
+		&rs,
 	)
 	ipv6pktrs := append(l2, rsHeader...)
 
@@ -1358,7 +2552,7 @@ func (o *NdNsCtx) SendRouterSolicitation(srcMac core.MACKey) {
 	p := m.GetData()
 
 	ipv6 := layers.IPv6Header(p[ipoffset : ipoffset+IPV6_HEADER_SIZE])
-	ipv6.SetPyloadLength(uint16(8))
+	ipv6.SetPyloadLength(uint16(len(rsHeader) - IPV6_HEADER_SIZE))
 
 	rcof := ipoffset + IPV6_HEADER_SIZE
 
@@ -1380,18 +2574,7 @@ func (o *NdNsCtx) DisassociateClient(c *NdClientCtx,
 		panic(" ref count can't be zero before remove")
 	}
 	flow.head.RemoveNode(&c.dlist)
-	flow.refc--
-	if flow.refc == 0 {
-		// move to Learn
-		if !flow.head.IsEmpty() {
-			panic(" head should be empty ")
-		}
-		o.tbl.MoveToLearn(flow)
-	} else {
-		if flow.head.IsEmpty() {
-			panic(" head should not be empty ")
-		}
-	}
+	o.tbl.Release(flow)
 	o.stats.disasociateWithClient++
 	c.base.Client.Ipv6DGW = nil
 
@@ -1434,21 +2617,160 @@ func (o *NdNsCtx) AssociateClient(c *NdClientCtx) {
 	c.base.Client.Ipv6DGW = &flow.action
 }
 
+// AssociateRoute associate a next-hop of a static route of the client with a NdCacheFlow,
+// the same as AssociateClient
+func (o *NdNsCtx) AssociateRoute(c *NdClientCtx, ipv6 core.Ipv6Key) *ndRouteRef {
+	flow := o.tbl.Lookup(ipv6)
+	if flow != nil {
+		o.tbl.AssociateWithClient(flow)
+	} else {
+		flow = o.tbl.AddNew(ipv6, nil, stateIncomplete)
+	}
+
+	o.stats.associateWithRoute++
+	ref := &ndRouteRef{c: c, flow: flow}
+	flow.routes.AddLast(&ref.dlist)
+	if !flow.action.IpdgResolved {
+		c.resolveNextHop(&ipv6)
+	}
+	return ref
+}
+
+// DisassociateRoute remove the reference of a next-hop of a static route
+func (o *NdNsCtx) DisassociateRoute(ref *ndRouteRef) {
+	ref.flow.routes.RemoveNode(&ref.dlist)
+	o.tbl.Release(ref.flow)
+	o.stats.disassociateWithRoute++
+}
+
+// SetStale forces the resolved entry of ipv6 to stale, so the re-resolution starts now and not
+// when the complete timer expires
+func (o *NdNsCtx) SetStale(ipv6 core.Ipv6Key) error {
+	flow := o.tbl.Lookup(ipv6)
+	if flow == nil {
+		return fmt.Errorf("nd entry %v does not exist", ipv6.ToIP())
+	}
+	return o.tbl.SetStale(flow)
+}
+
 func (o *NdNsCtx) NdLearn(ipv6 core.Ipv6Key, sourceMac *core.MACKey) {
 
 	flow := o.tbl.Lookup(ipv6)
 
 	if flow != nil {
-		o.tbl.NdLearn(flow, sourceMac)
+		if o.tbl.nud {
+			o.tbl.NudLearn(flow, sourceMac, false)
+		} else {
+			o.tbl.NdLearn(flow, sourceMac)
+		}
 	} else {
 		o.tbl.AddNew(ipv6, sourceMac, stateLearned)
 	}
 }
 
+// NdLearnAdv learn a neighbor advertisement, detecting flaps and duplicates of a resolved entry
+func (o *NdNsCtx) NdLearnAdv(ipv6 core.Ipv6Key, targetMac *core.MACKey, solicited bool) {
+
+	flow := o.tbl.Lookup(ipv6)
+
+	if flow != nil {
+		if o.tbl.CheckAdv(flow, targetMac, o.flapThreshold) {
+			o.base.Ns.PluginCtx.BroadcastMsg(nil, core.MSG_ND_FLAP, ipv6, flow.flaps)
+		}
+		if o.tbl.nud {
+			o.tbl.NudLearn(flow, targetMac, solicited)
+		} else {
+			o.tbl.NdLearn(flow, targetMac)
+		}
+	} else {
+		flow = o.tbl.AddNew(ipv6, targetMac, stateLearned)
+		o.tbl.CheckAdv(flow, targetMac, o.flapThreshold)
+	}
+}
+
 func (o *NdNsCtx) SetTruncated() {
 
 }
 
+// isOwnAddr checks if the address belongs to one of our clients
+func (o *NdNsCtx) isOwnAddr(ipv6 core.Ipv6Key) bool {
+	if _, ok := o.linkLocals[ipv6]; ok {
+		return true
+	}
+	if o.base.Ns.CLookupByIPv6(&ipv6) != nil {
+		return true
+	}
+	var mac core.MACKey
+	if core.ExtractOnlyMac(ipv6.ToIP(), &mac) {
+		client := o.base.Ns.CLookupByMac(&mac)
+		if client != nil && client.IsValidPrefix(ipv6) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleUnsolicitedNA reports an unsolicited NA of a neighbor, returns false in case the
+// cache should not learn it by the policy
+func (o *NdNsCtx) handleUnsolicitedNA(target net.IP, targetMac *core.MACKey) bool {
+	var tipv6 core.Ipv6Key
+	copy(tipv6[:], target)
+	if o.isOwnAddr(tipv6) {
+		return true
+	}
+	o.stats.pktRxNeighborAdvUnsolicited++
+
+	flow := o.tbl.Lookup(tipv6)
+	ev := core.CNeighborAnnounce{Time: o.base.Ns.Timestamp(), Ip: tipv6.ToIP(), Mac: *targetMac}
+	if flow != nil && flow.action.IpdgResolved && flow.action.IpdgMac != *targetMac {
+		ev.Changed = true
+		o.stats.pktRxUnaMacChange++
+	}
+	o.unas.Add(&ev)
+	o.base.Ns.PluginCtx.BroadcastMsg(nil, core.MSG_ND_UNSOLICITED_NA, &ev, nil)
+
+	switch o.unaPolicy {
+	case core.ANNOUNCE_POLICY_UPDATE:
+		return flow != nil
+	case core.ANNOUNCE_POLICY_IGNORE:
+		return false
+	}
+	return true
+}
+
+// handleOptimisticConflict checks if an advertisement is for an optimistic or tentative address of one of our clients
+func (o *NdNsCtx) handleOptimisticConflict(target net.IP) bool {
+	var tipv6 core.Ipv6Key
+	copy(tipv6[:], target)
+	if nd, ok := o.linkLocals[tipv6]; ok {
+		if !nd.IsOptimistic(&tipv6) && !nd.IsTentative(&tipv6) {
+			return false
+		}
+		nd.OnDadDuplicate(tipv6)
+		return true
+	}
+	var client *core.CClient
+	var mac core.MACKey
+	if core.ExtractOnlyMac(target, &mac) {
+		client = o.base.Ns.CLookupByMac(&mac)
+	} else {
+		client = o.base.Ns.CLookupByIPv6(&tipv6)
+	}
+	if client == nil {
+		return false
+	}
+	cplg := client.PluginCtx.Get(IPV6_PLUG)
+	if cplg == nil {
+		return false
+	}
+	nd := &cplg.Ext.(*PluginIpv6Client).nd
+	if !nd.IsOptimistic(&tipv6) {
+		return false
+	}
+	nd.OnDadDuplicate(tipv6)
+	return true
+}
+
 //HandleRxIpv6NdPacket there is no need to free  buffer
 func (o *NdNsCtx) HandleRxIpv6NdPacket(ps *core.ParserPacketState, code layers.ICMPv6TypeCode) int {
 
@@ -1522,12 +2844,12 @@ func (o *NdNsCtx) HandleRxIpv6NdPacket(ps *core.ParserPacketState, code layers.I
 					preferredLifetime := binary.BigEndian.Uint32(opt.Data[6:10])
 					prefix := net.IP(opt.Data[14:])
 
-					if prefixLen <= 64 && (validLifetime > 0) && (preferredLifetime > 0) && (prefixCnt == 0) {
-						// valid prefix
-						prefixCnt = 1
-						o.routerAd.PrefixLen = prefixLen
-						if len(prefix) == 16 {
-							copy(o.routerAd.PrefixIpv6[:], prefix[:])
+					if prefixLen <= 64 && (prefixCnt == 0) {
+						var prefix6 core.Ipv6Key
+						copy(prefix6[:], prefix[:])
+						if o.updateSlaacPrefix(prefix6, prefixLen, validLifetime, preferredLifetime) {
+							// valid prefix
+							prefixCnt = 1
 						}
 					}
 				}
@@ -1538,6 +2860,8 @@ func (o *NdNsCtx) HandleRxIpv6NdPacket(ps *core.ParserPacketState, code layers.I
 				if len(opt.Data) == 6 {
 					o.routerAd.MTU = uint16(binary.BigEndian.Uint32(opt.Data[2:]))
 				}
+			case ndOptRdnss:
+				o.updateRdnss(opt.Data)
 
 			}
 
@@ -1621,6 +2945,14 @@ func (o *NdNsCtx) HandleRxIpv6NdPacket(ps *core.ParserPacketState, code layers.I
 
 		global := ra.TargetAddress.IsGlobalUnicast()
 
+		var ltipv6 core.Ipv6Key
+		copy(ltipv6[:], ra.TargetAddress)
+		if nd, ok := o.linkLocals[ltipv6]; ok {
+			// additional link-local address
+			nd.Respond(&nd.base.Client.Mac, ps)
+			return core.PARSER_OK
+		}
+
 		if ra.TargetAddress.IsLinkLocalUnicast() || global {
 			// extract the MAC and lookup by MAC and answer
 			var mac core.MACKey
@@ -1724,16 +3056,21 @@ func (o *NdNsCtx) HandleRxIpv6NdPacket(ps *core.ParserPacketState, code layers.I
 			}
 		}
 
+		if o.handleOptimisticConflict(ra.TargetAddress) {
+			return core.PARSER_OK
+		}
+
+		if ra.Flags&0x40 == 0 && targetMacExists {
+			if !o.handleUnsolicitedNA(ra.TargetAddress, &targetMac) {
+				return core.PARSER_OK
+			}
+		}
+
 		var over bool
 		if ra.Flags&0x20 == 0x20 {
 			over = true
 		}
-		/*
-			//var sol bool
-
-			if ra.Flags&0x40 == 0x40 {
-				sol = true
-			}*/
+		sol := ra.Flags&0x40 == 0x40
 
 		if over && targetMacExists {
 			// only if it is override
@@ -1756,7 +3093,7 @@ func (o *NdNsCtx) HandleRxIpv6NdPacket(ps *core.ParserPacketState, code layers.I
 					}
 					if !ours {
 						o.stats.pktRxNeighborAdvLearn++
-						o.NdLearn(tipv6, &targetMac)
+						o.NdLearnAdv(tipv6, &targetMac, sol)
 					}
 
 				} else {
@@ -1766,7 +3103,7 @@ func (o *NdNsCtx) HandleRxIpv6NdPacket(ps *core.ParserPacketState, code layers.I
 					if client == nil {
 						// not our global IPv6 learn it
 						o.stats.pktRxNeighborAdvLearn++
-						o.NdLearn(tipv6, &targetMac)
+						o.NdLearnAdv(tipv6, &targetMac, sol)
 					} else {
 						o.stats.pktRxNeighborAdvWithOwnAddr++
 					}
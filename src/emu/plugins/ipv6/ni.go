@@ -0,0 +1,353 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package ipv6
+
+/* RFC 4620 ICMPv6 Node Information Queries
+
+A client with ni_enable answers the queries sent to one of its unicast addresses
+with NOOP, Supported Qtypes (the bitmap of the drafts, Qtype 1), Node Name,
+Node Addresses and IPv4 Addresses replies. The subject of the query (ipv6, name or
+ipv4) should belong to the client, otherwise the query is ignored.
+Clients without ni_enable ignore the queries.
+
+not implemented:
+
+queries to the NI group multicast address
+ttl of the addresses, always zero (unknown)
+
+*/
+
+import (
+	"emu/core"
+	"encoding/binary"
+	"external/google/gopacket/layers"
+	"strings"
+
+	"github.com/intel-go/fastjson"
+)
+
+const (
+	ICMPV6_NI_QUERY = core.ICMPV6_TYPE_NI_QUERY
+	ICMPV6_NI_REPLY = 140
+
+	/* query codes, type of the subject */
+	NI_CODE_SUBJECT_IPV6 = 0
+	NI_CODE_SUBJECT_NAME = 1
+	NI_CODE_SUBJECT_IPV4 = 2
+
+	/* reply codes */
+	NI_CODE_SUCCESS       = 0
+	NI_CODE_REFUSED       = 1
+	NI_CODE_UNKNOWN_QTYPE = 2
+
+	NI_QTYPE_NOOP       = 0
+	NI_QTYPE_SUPPORTED  = 1
+	NI_QTYPE_NODE_NAME  = 2
+	NI_QTYPE_NODE_ADDR  = 3
+	NI_QTYPE_IPV4_ADDR  = 4
+	NI_SUPPORTED_QTYPES = (1 << NI_QTYPE_NOOP) | (1 << NI_QTYPE_SUPPORTED) | (1 << NI_QTYPE_NODE_NAME) | (1 << NI_QTYPE_NODE_ADDR) | (1 << NI_QTYPE_IPV4_ADDR)
+
+	/* node addresses flags */
+	NI_FLAG_TRUNCATE = 0x0001
+	NI_FLAG_ALL      = 0x0002
+	NI_FLAG_COMPAT   = 0x0004
+	NI_FLAG_LINK     = 0x0008
+	NI_FLAG_SITE     = 0x0010
+	NI_FLAG_GLOBAL   = 0x0020
+
+	NI_HEADER_SIZE = 16
+)
+
+type Ipv6NiInit struct {
+	Enable bool   `json:"ni_enable"` // answer node information queries
+	Name   string `json:"ni_name"`   // node name, fully qualified in case it ends with a dot
+}
+
+type niNsStats struct {
+	pktRxNiQuery        uint64
+	pktTxNiReply        uint64
+	pktRxNiDisabled     uint64
+	pktRxNiWrongSubject uint64
+	pktRxNiUnknownQtype uint64
+	pktRxNiErrTooShort  uint64
+	pktRxNiNoClient     uint64
+}
+
+func NewNiNsStatsDb(o *niNsStats) *core.CCounterDb {
+	db := core.NewCCounterDb("ni")
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxNiQuery,
+		Name:     "pktRxNiQuery",
+		Help:     "rx node information query",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxNiReply,
+		Name:     "pktTxNiReply",
+		Help:     "tx node information reply",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxNiDisabled,
+		Name:     "pktRxNiDisabled",
+		Help:     "rx query ignored, node information is disabled for the client",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxNiWrongSubject,
+		Name:     "pktRxNiWrongSubject",
+		Help:     "rx query ignored, the subject is not the client",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxNiUnknownQtype,
+		Name:     "pktRxNiUnknownQtype",
+		Help:     "rx query with unknown qtype",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxNiErrTooShort,
+		Name:     "pktRxNiErrTooShort",
+		Help:     "rx query too short",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxNiNoClient,
+		Name:     "pktRxNiNoClient",
+		Help:     "rx query, no client",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	return db
+}
+
+// NiNsCtx node information per namespace
+type NiNsCtx struct {
+	base  *PluginIpv6Ns
+	tctx  *core.CThreadCtx
+	stats niNsStats
+	cdb   *core.CCounterDb
+}
+
+func (o *NiNsCtx) Init(base *PluginIpv6Ns, ctx *core.CThreadCtx) {
+	o.base = base
+	o.tctx = ctx
+	o.cdb = NewNiNsStatsDb(&o.stats)
+}
+
+// NiClientCtx node information per client
+type NiClientCtx struct {
+	enable bool
+	name   string // lower case, without the trailing dot
+	wire   []byte // the name in DNS format
+}
+
+func (o *NiClientCtx) Init(initJson []byte) {
+	var init Ipv6NiInit
+	if fastjson.Unmarshal(initJson, &init) != nil {
+		return
+	}
+	o.enable = init.Enable
+	if init.Name == "" {
+		return
+	}
+	fqdn := strings.HasSuffix(init.Name, ".")
+	o.name = strings.ToLower(strings.TrimSuffix(init.Name, "."))
+	for _, l := range strings.Split(strings.TrimSuffix(init.Name, "."), ".") {
+		if len(l) == 0 || len(l) > 63 {
+			continue
+		}
+		o.wire = append(o.wire, uint8(len(l)))
+		o.wire = append(o.wire, l...)
+	}
+	o.wire = append(o.wire, 0)
+	if !fqdn {
+		/* a single component name ends with two zero length labels */
+		o.wire = append(o.wire, 0)
+	}
+}
+
+// niDecodeName decodes a DNS name of the subject, returns lower case name without the trailing dot
+func niDecodeName(b []byte) (string, bool) {
+	var labels []string
+	for i := 0; i < len(b); {
+		l := int(b[i])
+		if l == 0 {
+			return strings.ToLower(strings.Join(labels, ".")), true
+		}
+		if l > 63 || i+1+l > len(b) {
+			return "", false
+		}
+		labels = append(labels, string(b[i+1:i+1+l]))
+		i += 1 + l
+	}
+	return "", false
+}
+
+// isSubject checks that the subject of the query is the client
+func (o *NiNsCtx) isSubject(client *core.CClient, ni *NiClientCtx, code uint8, subject []byte) bool {
+	switch code {
+	case NI_CODE_SUBJECT_IPV6:
+		if len(subject) != 16 {
+			return false
+		}
+		var ipv6 core.Ipv6Key
+		copy(ipv6[:], subject)
+		return client.OwnsIPv6(ipv6)
+	case NI_CODE_SUBJECT_NAME:
+		name, ok := niDecodeName(subject)
+		return ok && ni.name != "" && name == ni.name
+	case NI_CODE_SUBJECT_IPV4:
+		if len(subject) != 4 {
+			return false
+		}
+		var ipv4 core.Ipv4Key
+		copy(ipv4[:], subject)
+		return client.OwnsIPv4(ipv4)
+	}
+	return false
+}
+
+// niAddresses returns the ipv6 addresses of the client that match the flags
+func niAddresses(client *core.CClient, flags uint16) []core.Ipv6Key {
+	var addrs []core.Ipv6Key
+	var l6 core.Ipv6Key
+	client.GetIpv6LocalLink(&l6)
+	addrs = append(addrs, l6)
+	if client.GetIpv6Slaac(&l6) {
+		addrs = append(addrs, l6)
+	}
+	if !client.Ipv6.IsZero() {
+		addrs = append(addrs, client.Ipv6)
+	}
+	if !client.Dhcpv6.IsZero() {
+		addrs = append(addrs, client.Dhcpv6)
+	}
+	if (flags & (NI_FLAG_LINK | NI_FLAG_SITE | NI_FLAG_GLOBAL)) == 0 {
+		return addrs
+	}
+	var r []core.Ipv6Key
+	for _, a := range addrs {
+		link := a[0] == 0xfe && (a[1]&0xc0) == 0x80
+		site := a[0] == 0xfe && (a[1]&0xc0) == 0xc0
+		if (link && (flags&NI_FLAG_LINK) != 0) ||
+			(site && (flags&NI_FLAG_SITE) != 0) ||
+			(!link && !site && (flags&NI_FLAG_GLOBAL) != 0) {
+			r = append(r, a)
+		}
+	}
+	return r
+}
+
+// HandleRxNiQuery handles a node information query to a unicast address of a client
+func (o *NiNsCtx) HandleRxNiQuery(ps *core.ParserPacketState) int {
+	p := ps.M.GetData()
+	l4 := ps.L4
+	if len(p[l4:]) < NI_HEADER_SIZE {
+		o.stats.pktRxNiErrTooShort++
+		return core.PARSER_ERR
+	}
+	o.stats.pktRxNiQuery++
+
+	ipv6 := layers.IPv6Header(p[ps.L3 : ps.L3+40])
+	var dst core.Ipv6Key
+	copy(dst[:], ipv6.DstIP())
+	client := o.base.Ns.CLookupByIPv6LocalGlobal(&dst)
+	if client == nil || !client.IsUnicastToMe(p) {
+		o.stats.pktRxNiNoClient++
+		return core.PARSER_OK
+	}
+	plug := client.PluginCtx.Get(IPV6_PLUG)
+	if plug == nil {
+		o.stats.pktRxNiNoClient++
+		return core.PARSER_OK
+	}
+	ni := &plug.Ext.(*PluginIpv6Client).ni
+	if !ni.enable {
+		o.stats.pktRxNiDisabled++
+		return core.PARSER_OK
+	}
+
+	code := p[l4+1]
+	qtype := binary.BigEndian.Uint16(p[l4+4 : l4+6])
+	flags := binary.BigEndian.Uint16(p[l4+6 : l4+8])
+	if qtype != NI_QTYPE_NOOP && !o.isSubject(client, ni, code, p[l4+NI_HEADER_SIZE:]) {
+		o.stats.pktRxNiWrongSubject++
+		return core.PARSER_OK
+	}
+
+	rcode := uint8(NI_CODE_SUCCESS)
+	var rflags uint16
+	var data []byte
+	switch qtype {
+	case NI_QTYPE_NOOP:
+	case NI_QTYPE_SUPPORTED:
+		data = make([]byte, 4)
+		binary.BigEndian.PutUint32(data, NI_SUPPORTED_QTYPES)
+	case NI_QTYPE_NODE_NAME:
+		if ni.wire != nil {
+			data = make([]byte, 4, 4+len(ni.wire)) // ttl
+			data = append(data, ni.wire...)
+		}
+	case NI_QTYPE_NODE_ADDR:
+		rflags = flags &^ NI_FLAG_TRUNCATE
+		for _, a := range niAddresses(client, flags) {
+			data = append(data, 0, 0, 0, 0) // ttl
+			data = append(data, a[:]...)
+		}
+	case NI_QTYPE_IPV4_ADDR:
+		rflags = flags &^ NI_FLAG_TRUNCATE
+		if !client.Ipv4.IsZero() {
+			data = append(data, 0, 0, 0, 0) // ttl
+			data = append(data, client.Ipv4[:]...)
+		}
+	default:
+		o.stats.pktRxNiUnknownQtype++
+		rcode = NI_CODE_UNKNOWN_QTYPE
+	}
+	o.sendReply(ps, rcode, qtype, rflags, data)
+	return core.PARSER_OK
+}
+
+// sendReply answers the query with the same nonce
+func (o *NiNsCtx) sendReply(ps *core.ParserPacketState, code uint8, qtype uint16, flags uint16, data []byte) {
+	p := ps.M.GetData()
+	l3 := ps.L3
+	l4 := l3 + 40
+	size := int(l4) + NI_HEADER_SIZE + len(data)
+
+	m := o.tctx.MPool.Alloc(uint16(size))
+	m.SetVPort(ps.M.VPort())
+	m.Append(p[0:l4])
+	m.Append(make([]byte, NI_HEADER_SIZE))
+	m.Append(data)
+	np := m.GetData()
+
+	eth := layers.EthernetHeader(np[0:12])
+	eth.SwapSrcDst()
+
+	ipv6 := layers.IPv6Header(np[l3:l4])
+	ipv6.SwapSrcDst()
+	ipv6.SetNextHeader(uint8(layers.IPProtocolICMPv6))
+	ipv6.SetHopLimit(64)
+	ipv6.SetPyloadLength(uint16(NI_HEADER_SIZE + len(data)))
+
+	np[l4] = ICMPV6_NI_REPLY
+	np[l4+1] = code
+	binary.BigEndian.PutUint16(np[l4+4:l4+6], qtype)
+	binary.BigEndian.PutUint16(np[l4+6:l4+8], flags)
+	copy(np[l4+8:l4+16], p[ps.L4+8:ps.L4+16]) // nonce
+	ipv6.FixIcmpL4Checksum(np[l4:], 0)
+
+	o.stats.pktTxNiReply++
+	o.tctx.Veth.Send(m)
+}
@@ -0,0 +1,662 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package lacp
+
+/*
+IEEE 802.1AX LACP actor over the slow protocols ethertype (0x8809)
+
+Each client is one port of a LAG. It sends LACPDUs with its actor system id, key and port, learns the partner
+from the received LACPDUs and moves to collecting/distributing once both sides are in sync.
+The receive machine is simplified, the current while timer expires the partner and moves to defaulted.
+Marker PDUs are ignored.
+
+*/
+
+import (
+	"emu/core"
+	"encoding/binary"
+	"external/osamingo/jsonrpc"
+	"sort"
+	"time"
+
+	"github.com/intel-go/fastjson"
+)
+
+const (
+	LACP_PLUG = "lacp"
+
+	SLOW_SUBTYPE_LACP   = 1
+	SLOW_SUBTYPE_MARKER = 2
+	LACP_VERSION        = 1
+	LACPDU_SIZE         = 110
+
+	// offsets in the LACPDU
+	LACP_TLV_ACTOR_OFFSET     = 2
+	LACP_TLV_PARTNER_OFFSET   = 22
+	LACP_TLV_COLLECTOR_OFFSET = 42
+	LACP_TLV_INFO_LEN         = 20
+	LACP_TLV_COLLECTOR_LEN    = 16
+
+	LACP_TLV_ACTOR     = 1
+	LACP_TLV_PARTNER   = 2
+	LACP_TLV_COLLECTOR = 3
+
+	// port state bits
+	LACP_STATE_ACTIVITY     = 0x01
+	LACP_STATE_TIMEOUT      = 0x02 // short timeout
+	LACP_STATE_AGGREGATION  = 0x04
+	LACP_STATE_SYNC         = 0x08
+	LACP_STATE_COLLECTING   = 0x10
+	LACP_STATE_DISTRIBUTING = 0x20
+	LACP_STATE_DEFAULTED    = 0x40
+	LACP_STATE_EXPIRED      = 0x80
+
+	// timers
+	LACP_FAST_PERIODIC_SEC = 1
+	LACP_SLOW_PERIODIC_SEC = 30
+	LACP_SHORT_TIMEOUT_SEC = 3
+	LACP_LONG_TIMEOUT_SEC  = 90
+
+	LACP_DEFAULT_PRIORITY = 32768
+
+	timerTx           = 1
+	timerCurrentWhile = 2
+)
+
+var lacpDestMAC = []byte{0x01, 0x80, 0xc2, 0x00, 0x00, 0x02}
+
+type LacpCfg struct {
+	SystemId   core.MACKey `json:"system_id"`       // actor system id, the client mac by default
+	SystemPrio uint16      `json:"system_priority"` // actor system priority
+	Key        uint16      `json:"key"`             // actor operational key
+	Port       uint16      `json:"port"`            // actor port number, should be unique in the namespace
+	PortPrio   uint16      `json:"port_priority"`   // actor port priority
+	Passive    bool        `json:"passive"`         // send LACPDUs only when the partner is active
+	Fast       bool        `json:"fast"`            // short timeout, ask the partner for fast periodic tx
+}
+
+// LacpPortInfo the actor or partner information of a LACPDU
+type LacpPortInfo struct {
+	SystemPrio uint16      `json:"system_priority"`
+	System     core.MACKey `json:"system_id"`
+	Key        uint16      `json:"key"`
+	PortPrio   uint16      `json:"port_priority"`
+	Port       uint16      `json:"port"`
+	State      uint8       `json:"state"`
+}
+
+func (o *LacpPortInfo) encode(p []byte) {
+	binary.BigEndian.PutUint16(p[0:2], o.SystemPrio)
+	copy(p[2:8], o.System[:])
+	binary.BigEndian.PutUint16(p[8:10], o.Key)
+	binary.BigEndian.PutUint16(p[10:12], o.PortPrio)
+	binary.BigEndian.PutUint16(p[12:14], o.Port)
+	p[14] = o.State
+}
+
+func (o *LacpPortInfo) decode(p []byte) {
+	o.SystemPrio = binary.BigEndian.Uint16(p[0:2])
+	copy(o.System[:], p[2:8])
+	o.Key = binary.BigEndian.Uint16(p[8:10])
+	o.PortPrio = binary.BigEndian.Uint16(p[10:12])
+	o.Port = binary.BigEndian.Uint16(p[12:14])
+	o.State = p[14]
+}
+
+// samePort returns true if the port information is the same, the state is not compared
+func (o *LacpPortInfo) samePort(other *LacpPortInfo) bool {
+	return o.SystemPrio == other.SystemPrio && o.System == other.System &&
+		o.Key == other.Key && o.PortPrio == other.PortPrio && o.Port == other.Port
+}
+
+type LacpStats struct {
+	pktTx          uint64
+	pktRx          uint64
+	pktRxMarker    uint64
+	pktRxParserErr uint64
+	pktRxBadTlv    uint64
+	stateChanges   uint64
+	partnerExpired uint64
+	partnerChanged uint64
+}
+
+func NewLacpStatsDb(o *LacpStats) *core.CCounterDb {
+	db := core.NewCCounterDb("lacp")
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTx,
+		Name:     "pktTx",
+		Help:     "tx LACPDUs",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRx,
+		Name:     "pktRx",
+		Help:     "rx LACPDUs",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxMarker,
+		Name:     "pktRxMarker",
+		Help:     "rx marker PDUs, ignored",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxParserErr,
+		Name:     "pktRxParserErr",
+		Help:     "rx packet too short or invalid subtype",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxBadTlv,
+		Name:     "pktRxBadTlv",
+		Help:     "rx invalid actor/partner tlv",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.stateChanges,
+		Name:     "stateChanges",
+		Help:     "changes of the actor state",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.partnerExpired,
+		Name:     "partnerExpired",
+		Help:     "no LACPDU from the partner in the timeout",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.partnerChanged,
+		Name:     "partnerChanged",
+		Help:     "rx LACPDU from a different partner",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	return db
+}
+
+type PluginLacpClientTimer struct {
+}
+
+func (o *PluginLacpClientTimer) OnEvent(a, b interface{}) {
+	pi := a.(*PluginLacpClient)
+	pi.onTimerEvent(b.(int))
+}
+
+// LacpClientInfo the negotiated state of a port, see lacp_client_info
+type LacpClientInfo struct {
+	Actor        LacpPortInfo `json:"actor"`
+	Partner      LacpPortInfo `json:"partner"`
+	Selected     bool         `json:"selected"`
+	Sync         bool         `json:"sync"` // both sides are in sync
+	Collecting   bool         `json:"collecting"`
+	Distributing bool         `json:"distributing"`
+	Defaulted    bool         `json:"defaulted"`
+	Expired      bool         `json:"expired"`
+}
+
+// PluginLacpClient information per client
+type PluginLacpClient struct {
+	core.PluginBase
+	nsPlug       *PluginLacpNs
+	cfg          LacpCfg
+	timerw       *core.TimerCtx
+	txTimer      core.CHTimerObj
+	currentTimer core.CHTimerObj
+	timerCb      PluginLacpClientTimer
+	stats        LacpStats
+	cdb          *core.CCounterDb
+	cdbv         *core.CCounterDbVec
+	actor        LacpPortInfo
+	partner      LacpPortInfo
+	selected     bool
+	pktTemplate  []byte
+	l3Offset     uint16
+}
+
+var lacpEvents = []string{}
+
+/*NewLacpClient create plugin */
+func NewLacpClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+
+	o := new(PluginLacpClient)
+	o.InitPluginBase(ctx, o)             /* init base object*/
+	o.RegisterEvents(ctx, lacpEvents, o) /* register events, only if exits*/
+	nsplg := o.Ns.PluginCtx.GetOrCreate(LACP_PLUG)
+	o.nsPlug = nsplg.Ext.(*PluginLacpNs)
+	o.LoadCfg(initJson)
+	o.OnCreate()
+
+	return &o.PluginBase
+}
+
+func (o *PluginLacpClient) LoadCfg(initJson []byte) {
+
+	o.cfg.SystemPrio = LACP_DEFAULT_PRIORITY
+	o.cfg.PortPrio = LACP_DEFAULT_PRIORITY
+	o.cfg.Key = 1
+	o.cfg.Port = 1
+	fastjson.Unmarshal(initJson, &o.cfg)
+	if o.cfg.SystemId.IsZero() {
+		o.cfg.SystemId = o.Client.Mac
+	}
+}
+
+func (o *PluginLacpClient) OnCreate() {
+	o.timerw = o.Ns.GetTimerCtx()
+	o.cdb = NewLacpStatsDb(&o.stats)
+	o.cdbv = core.NewCCounterDbVec("lacp")
+	o.cdbv.Add(o.cdb)
+	o.txTimer.SetCB(&o.timerCb, o, timerTx)
+	o.currentTimer.SetCB(&o.timerCb, o, timerCurrentWhile)
+
+	o.actor = LacpPortInfo{SystemPrio: o.cfg.SystemPrio,
+		System:   o.cfg.SystemId,
+		Key:      o.cfg.Key,
+		PortPrio: o.cfg.PortPrio,
+		Port:     o.cfg.Port}
+	o.preparePacketTemplate()
+	o.nsPlug.addPort(o)
+	o.setDefaulted()
+	o.onTx()
+}
+
+func (o *PluginLacpClient) preparePacketTemplate() {
+
+	l2 := o.Client.GetL2Header(true, uint16(core.ETH_TYPE_SLOW_PROTOCOLS))
+	copy(l2[0:6], lacpDestMAC[:])
+	o.l3Offset = uint16(len(l2))
+	pdu := make([]byte, LACPDU_SIZE)
+	pdu[0] = SLOW_SUBTYPE_LACP
+	pdu[1] = LACP_VERSION
+	pdu[LACP_TLV_ACTOR_OFFSET] = LACP_TLV_ACTOR
+	pdu[LACP_TLV_ACTOR_OFFSET+1] = LACP_TLV_INFO_LEN
+	pdu[LACP_TLV_PARTNER_OFFSET] = LACP_TLV_PARTNER
+	pdu[LACP_TLV_PARTNER_OFFSET+1] = LACP_TLV_INFO_LEN
+	pdu[LACP_TLV_COLLECTOR_OFFSET] = LACP_TLV_COLLECTOR
+	pdu[LACP_TLV_COLLECTOR_OFFSET+1] = LACP_TLV_COLLECTOR_LEN
+	// the terminator and the collector max delay are zero
+	o.pktTemplate = append(l2, pdu...)
+}
+
+// setDefaulted moves to the defaulted state, the partner information is cleared
+func (o *PluginLacpClient) setDefaulted() {
+	o.partner = LacpPortInfo{}
+	o.selected = false
+	state := uint8(LACP_STATE_AGGREGATION | LACP_STATE_DEFAULTED)
+	if !o.cfg.Passive {
+		state |= LACP_STATE_ACTIVITY
+	}
+	if o.cfg.Fast {
+		state |= LACP_STATE_TIMEOUT
+	}
+	o.changeState(state)
+}
+
+func (o *PluginLacpClient) changeState(state uint8) bool {
+	if o.actor.State == state {
+		return false
+	}
+	o.actor.State = state
+	o.stats.stateChanges++
+	return true
+}
+
+func (o *PluginLacpClient) isDefaulted() bool {
+	return (o.actor.State & LACP_STATE_DEFAULTED) != 0
+}
+
+// periodicSec the periodic tx is fast if the partner asks for a short timeout
+func (o *PluginLacpClient) periodicSec() uint32 {
+	fast := o.cfg.Fast
+	if !o.isDefaulted() {
+		fast = (o.partner.State & LACP_STATE_TIMEOUT) != 0
+	}
+	if fast {
+		return LACP_FAST_PERIODIC_SEC
+	}
+	return LACP_SLOW_PERIODIC_SEC
+}
+
+// isPeriodic a passive port sends LACPDUs only to an active partner
+func (o *PluginLacpClient) isPeriodic() bool {
+	if !o.cfg.Passive {
+		return true
+	}
+	return !o.isDefaulted() && (o.partner.State&LACP_STATE_ACTIVITY) != 0
+}
+
+func (o *PluginLacpClient) restartTimer(timer *core.CHTimerObj, sec uint32) {
+	if timer.IsRunning() {
+		o.timerw.Stop(timer)
+	}
+	o.timerw.Start(timer, time.Duration(sec)*time.Second)
+}
+
+// onTx sends a LACPDU and restarts the periodic timer
+func (o *PluginLacpClient) onTx() {
+	if o.txTimer.IsRunning() {
+		o.timerw.Stop(&o.txTimer)
+	}
+	if !o.isPeriodic() {
+		return
+	}
+	o.SendLacpdu()
+	o.timerw.Start(&o.txTimer, time.Duration(o.periodicSec())*time.Second)
+}
+
+func (o *PluginLacpClient) SendLacpdu() {
+	if o.Ns.SuppressTx() {
+		return
+	}
+
+	m := o.Ns.AllocMbuf(uint16(len(o.pktTemplate)))
+	m.Append(o.pktTemplate)
+	p := m.GetData()
+	l3 := o.l3Offset
+	o.actor.encode(p[l3+LACP_TLV_ACTOR_OFFSET+2:])
+	o.partner.encode(p[l3+LACP_TLV_PARTNER_OFFSET+2:])
+	o.stats.pktTx++
+	o.Tctx.Veth.Send(m)
+}
+
+/*OnEvent support event change of IP  */
+func (o *PluginLacpClient) OnEvent(msg string, a, b interface{}) {
+
+}
+
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginLacpClient) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
+func (o *PluginLacpClient) OnRemove(ctx *core.PluginCtx) {
+	/* force removing the link to the client */
+	ctx.UnregisterEvents(&o.PluginBase, lacpEvents)
+	o.nsPlug.removePort(o)
+	if o.txTimer.IsRunning() {
+		o.timerw.Stop(&o.txTimer)
+	}
+	if o.currentTimer.IsRunning() {
+		o.timerw.Stop(&o.currentTimer)
+	}
+}
+
+func (o *PluginLacpClient) onTimerEvent(timer int) {
+	if timer == timerTx {
+		o.onTx()
+		return
+	}
+
+	// current while timer, expire the partner and move to defaulted on the next expiration
+	if (o.actor.State & LACP_STATE_EXPIRED) != 0 {
+		o.setDefaulted()
+		o.onTx()
+		return
+	}
+	o.stats.partnerExpired++
+	o.selected = false
+	o.partner.State |= LACP_STATE_TIMEOUT
+	state := o.actor.State | LACP_STATE_EXPIRED | LACP_STATE_TIMEOUT
+	state &^= LACP_STATE_SYNC | LACP_STATE_COLLECTING | LACP_STATE_DISTRIBUTING
+	o.changeState(state)
+	o.restartTimer(&o.currentTimer, LACP_SHORT_TIMEOUT_SEC)
+	o.onTx()
+}
+
+func (o *PluginLacpClient) HandleRxLacpPacket(ps *core.ParserPacketState) int {
+
+	p := ps.M.GetData()[ps.L3:]
+
+	if p[0] == SLOW_SUBTYPE_MARKER {
+		o.stats.pktRxMarker++
+		return 0
+	}
+	if len(p) < LACP_TLV_COLLECTOR_OFFSET || p[0] != SLOW_SUBTYPE_LACP {
+		o.stats.pktRxParserErr++
+		return core.PARSER_ERR
+	}
+	if p[LACP_TLV_ACTOR_OFFSET] != LACP_TLV_ACTOR || p[LACP_TLV_ACTOR_OFFSET+1] != LACP_TLV_INFO_LEN ||
+		p[LACP_TLV_PARTNER_OFFSET] != LACP_TLV_PARTNER || p[LACP_TLV_PARTNER_OFFSET+1] != LACP_TLV_INFO_LEN {
+		o.stats.pktRxBadTlv++
+		return core.PARSER_ERR
+	}
+	o.stats.pktRx++
+
+	var partner, seen LacpPortInfo
+	partner.decode(p[LACP_TLV_ACTOR_OFFSET+2:])
+	seen.decode(p[LACP_TLV_PARTNER_OFFSET+2:]) // the partner view of the actor
+
+	if !o.isDefaulted() && !o.partner.samePort(&partner) {
+		o.stats.partnerChanged++
+	}
+	o.partner = partner
+	o.selected = (partner.State & LACP_STATE_AGGREGATION) != 0
+
+	state := o.actor.State
+	state &^= LACP_STATE_DEFAULTED | LACP_STATE_EXPIRED | LACP_STATE_TIMEOUT
+	if o.cfg.Fast {
+		state |= LACP_STATE_TIMEOUT
+	}
+	inSync := seen.samePort(&o.actor) && (seen.State&LACP_STATE_AGGREGATION) != 0
+	if o.selected {
+		state |= LACP_STATE_SYNC
+	} else {
+		state &^= LACP_STATE_SYNC
+	}
+	if o.selected && inSync && (partner.State&LACP_STATE_SYNC) != 0 {
+		state |= LACP_STATE_COLLECTING | LACP_STATE_DISTRIBUTING
+	} else {
+		state &^= LACP_STATE_COLLECTING | LACP_STATE_DISTRIBUTING
+	}
+
+	timeout := uint32(LACP_LONG_TIMEOUT_SEC)
+	if (state & LACP_STATE_TIMEOUT) != 0 {
+		timeout = LACP_SHORT_TIMEOUT_SEC
+	}
+	o.restartTimer(&o.currentTimer, timeout)
+
+	// the partner should learn the new state or it has a stale view of the actor
+	if o.changeState(state) || !inSync || seen.State != o.actor.State {
+		o.onTx()
+	} else if !o.txTimer.IsRunning() {
+		o.onTx()
+	}
+	return 0
+}
+
+func (o *PluginLacpClient) getInfo() *LacpClientInfo {
+	var r LacpClientInfo
+	r.Actor = o.actor
+	r.Partner = o.partner
+	r.Selected = o.selected
+	r.Sync = (o.actor.State&LACP_STATE_SYNC) != 0 && (o.partner.State&LACP_STATE_SYNC) != 0
+	r.Collecting = (o.actor.State & LACP_STATE_COLLECTING) != 0
+	r.Distributing = (o.actor.State & LACP_STATE_DISTRIBUTING) != 0
+	r.Defaulted = o.isDefaulted()
+	r.Expired = (o.actor.State & LACP_STATE_EXPIRED) != 0
+	return &r
+}
+
+// PluginLacpNs information per namespace
+type PluginLacpNs struct {
+	core.PluginBase
+	ports map[uint16]*PluginLacpClient // by actor port
+}
+
+func NewLacpNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+
+	o := new(PluginLacpNs)
+	o.InitPluginBase(ctx, o)
+	o.RegisterEvents(ctx, []string{}, o)
+	o.ports = make(map[uint16]*PluginLacpClient)
+
+	return &o.PluginBase
+}
+
+func (o *PluginLacpNs) OnRemove(ctx *core.PluginCtx) {
+}
+
+func (o *PluginLacpNs) OnEvent(msg string, a, b interface{}) {
+
+}
+
+func (o *PluginLacpNs) addPort(c *PluginLacpClient) {
+	if _, ok := o.ports[c.actor.Port]; !ok {
+		o.ports[c.actor.Port] = c
+	}
+}
+
+func (o *PluginLacpNs) removePort(c *PluginLacpClient) {
+	if o.ports[c.actor.Port] == c {
+		delete(o.ports, c.actor.Port)
+	}
+}
+
+func (o *PluginLacpNs) HandleRxLacpPacket(ps *core.ParserPacketState) int {
+
+	p := ps.M.GetData()
+	l3 := int(ps.L3)
+
+	if len(p) < l3+LACP_TLV_COLLECTOR_OFFSET {
+		return core.PARSER_ERR
+	}
+	// the port the partner talks to, zero in case it does not know the actor yet
+	port := binary.BigEndian.Uint16(p[l3+LACP_TLV_PARTNER_OFFSET+14 : l3+LACP_TLV_PARTNER_OFFSET+16])
+	if c, ok := o.ports[port]; ok {
+		return c.HandleRxLacpPacket(ps)
+	}
+	if len(o.ports) == 0 {
+		return core.PARSER_ERR
+	}
+	// deliver to all the ports, in a deterministic order
+	keys := make([]int, 0, len(o.ports))
+	for k := range o.ports {
+		keys = append(keys, int(k))
+	}
+	sort.Ints(keys)
+	r := 0
+	for _, k := range keys {
+		if o.ports[uint16(k)].HandleRxLacpPacket(ps) != 0 {
+			r = core.PARSER_ERR
+		}
+	}
+	return r
+}
+
+// HandleRxLacpPacket Parser call this function with mbuf from the pool
+func HandleRxLacpPacket(ps *core.ParserPacketState) int {
+
+	ns := ps.Tctx.GetNs(ps.Tun)
+	if ns == nil {
+		return core.PARSER_ERR
+	}
+	nsplg := ns.PluginCtx.Get(LACP_PLUG)
+	if nsplg == nil {
+		return core.PARSER_ERR
+	}
+	lacpPlug := nsplg.Ext.(*PluginLacpNs)
+	return lacpPlug.HandleRxLacpPacket(ps)
+}
+
+type PluginLacpCReg struct{}
+type PluginLacpNsReg struct{}
+
+func (o PluginLacpCReg) NewPlugin(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	return NewLacpClient(ctx, initJson)
+}
+
+func (o PluginLacpNsReg) NewPlugin(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	return NewLacpNs(ctx, initJson)
+}
+
+/*******************************************/
+/*  RPC commands */
+type (
+	ApiLacpClientCntHandler  struct{}
+	ApiLacpClientInfoHandler struct{}
+)
+
+func getClientPlugin(ctx interface{}, params *fastjson.RawMessage) (*PluginLacpClient, error) {
+	tctx := ctx.(*core.CThreadCtx)
+
+	plug, err := tctx.GetClientPlugin(params, LACP_PLUG)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pClient := plug.Ext.(*PluginLacpClient)
+
+	return pClient, nil
+}
+
+func (h ApiLacpClientInfoHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	tctx := ctx.(*core.CThreadCtx)
+	plugs, err := tctx.GetClientsPlugin(params, LACP_PLUG)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	res := make([]LacpClientInfo, len(plugs))
+	for i, p := range plugs {
+		res[i] = *p.Ext.(*PluginLacpClient).getInfo()
+	}
+
+	return res, nil
+}
+
+func (h ApiLacpClientCntHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p core.ApiCntParams
+	tctx := ctx.(*core.CThreadCtx)
+	c, err := getClientPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return c.cdbv.GeneralCounters(err, tctx, params, &p)
+}
+
+func init() {
+
+	/* register of plugins callbacks for ns,c level  */
+	core.PluginRegister(LACP_PLUG,
+		core.PluginRegisterData{Client: PluginLacpCReg{},
+			Ns:     PluginLacpNsReg{},
+			Thread: nil}) /* no need for thread context for now */
+
+	core.RegisterCB("lacp_client_info", ApiLacpClientInfoHandler{}, false) // get the negotiated state per array
+	core.RegisterCB("lacp_client_cnt", ApiLacpClientCntHandler{}, false)   // get counters/meta
+
+	/* register callback for rx side*/
+	core.ParserRegister("lacp", HandleRxLacpPacket)
+}
+
+func Register(ctx *core.CThreadCtx) {
+	ctx.RegisterParserCb("lacp")
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package lacp
+
+import (
+	"emu/core"
+	"flag"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var monitor int
+
+type LacpTestBase struct {
+	testname     string
+	dropAll      bool
+	monitor      bool
+	replies      int // number of LACPDUs the partner answers, zero for no limit
+	capture      bool
+	duration     time.Duration
+	clientsToSim int
+	clientInit   []byte
+	cb           LacpTestCb
+	cbArg1       interface{}
+	cbArg2       interface{}
+}
+
+type LacpTestCb func(tctx *core.CThreadCtx, test *LacpTestBase) int
+
+func (o *LacpTestBase) Run(t *testing.T) {
+
+	var simVeth VethLacpSim
+	simVeth.DropAll = o.dropAll
+	simVeth.replies = o.replies
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, o.clientsToSim, o.clientInit)
+	if o.cb != nil {
+		o.cb(tctx, o)
+	}
+	m := false
+	if monitor > 0 {
+		m = true
+	}
+	simVeth.tctx = tctx
+	tctx.Veth.SetDebug(m, o.capture)
+	tctx.MainLoopSim(o.duration)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+
+	ns := tctx.GetNs(&key)
+	if ns == nil {
+		t.Fatalf(" can't find ns")
+		return
+	}
+	c := ns.CLookupByMac(&core.MACKey{0, 0, 1, 0, 0, 1})
+	nsplg := c.PluginCtx.Get(LACP_PLUG)
+	if nsplg == nil {
+		t.Fatalf(" can't find plugin")
+	}
+	lacpPlug := nsplg.Ext.(*PluginLacpClient)
+	lacpPlug.cdbv.Dump()
+	tctx.GetCounterDbVec().Dump()
+
+	tctx.SimRecordCompare(o.testname, t)
+}
+
+func createSimulationEnv(simRx *core.VethIFSim, num int, clientInit []byte) (*core.CThreadCtx, *core.CClient) {
+	tctx := core.NewThreadCtx(0, 4510, true, simRx)
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := core.NewNSCtx(tctx, &key)
+
+	tctx.AddNs(&key, ns)
+	dg := core.Ipv4Key{0, 0, 0, 0}
+
+	client := core.NewClient(ns, core.MACKey{0, 0, 1, 0, 0, 1},
+		core.Ipv4Key{0, 0, 0, 0},
+		core.Ipv6Key{},
+		dg)
+	ns.AddClient(client)
+
+	if clientInit == nil {
+		clientInit = []byte(`{"key": 10, "port": 3}`)
+	}
+
+	ns.PluginCtx.CreatePlugins([]string{"lacp"}, [][]byte{})
+	client.PluginCtx.CreatePlugins([]string{"lacp"}, [][]byte{clientInit})
+	ns.Dump()
+	tctx.RegisterParserCb("lacp")
+
+	nsplg := ns.PluginCtx.Get(LACP_PLUG)
+	if nsplg == nil {
+		panic(" can't find plugin")
+	}
+
+	return tctx, nil
+}
+
+// VethLacpSim answers each LACPDU as an active partner that is in sync with the actor
+type VethLacpSim struct {
+	DropAll bool
+	cnt     int
+	replies int
+	tctx    *core.CThreadCtx
+}
+
+var simPartner = LacpPortInfo{SystemPrio: 100,
+	System:   core.MACKey{0, 0, 0, 0xaa, 0xbb, 0xcc},
+	Key:      20,
+	PortPrio: 128,
+	Port:     7,
+	State: LACP_STATE_ACTIVITY | LACP_STATE_AGGREGATION | LACP_STATE_SYNC |
+		LACP_STATE_COLLECTING | LACP_STATE_DISTRIBUTING}
+
+func (o *VethLacpSim) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
+
+	if o.DropAll || (o.replies > 0 && o.cnt >= o.replies) {
+		m.FreeMbuf()
+		return nil
+	}
+	o.cnt++
+
+	p := append([]byte{}, m.GetData()...)
+	m.FreeMbuf()
+	l3 := 22 // two vlan tags
+	copy(p[6:12], []byte{0, 0, 0, 0xaa, 0xbb, 0xcd})
+
+	var actor LacpPortInfo
+	actor.decode(p[l3+LACP_TLV_ACTOR_OFFSET+2:])
+	actor.encode(p[l3+LACP_TLV_PARTNER_OFFSET+2:])
+	simPartner.encode(p[l3+LACP_TLV_ACTOR_OFFSET+2:])
+
+	mr := o.tctx.MPool.Alloc(uint16(len(p)))
+	mr.SetVPort(1)
+	mr.Append(p)
+	return mr
+}
+
+type LacpRpcCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	test  *LacpTestBase
+}
+
+func (o *LacpRpcCtx) OnEvent(a, b interface{}) {
+	fmt.Printf("add request %v %v \n", a, b)
+
+	o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+	"method":"lacp_client_cnt",
+	"params": {"tun": {"vport":1,"tci":[1,2]}, "mac":[0, 0, 1, 0, 0, 1] },
+	"id": 3 }`))
+
+	o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+	"method":"lacp_client_info",
+	"params": {"tun": {"vport":1,"tci":[1,2]}, "macs":[[0, 0, 1, 0, 0, 1]] },
+	"id": 3 }`))
+}
+
+func rpcQueue(tctx *core.CThreadCtx, test *LacpTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(test.cbArg1.(time.Duration))
+	var rpcctx LacpRpcCtx
+	rpcctx.timer.SetCB(&rpcctx, test.cbArg1, test.cbArg2)
+	rpcctx.tctx = tctx
+	rpcctx.test = test
+	timerw.StartTicks(&rpcctx.timer, ticks)
+	return 0
+}
+
+// the actor aggregates with the partner
+func TestPluginLacp1(t *testing.T) {
+	a := &LacpTestBase{
+		testname:     "lacp1",
+		dropAll:      false,
+		monitor:      false,
+		capture:      true,
+		duration:     70 * time.Second,
+		clientsToSim: 1,
+		cb:           rpcQueue,
+		cbArg1:       65 * time.Second,
+	}
+	a.Run(t)
+}
+
+// the partner stops to answer, the actor expires it and moves to defaulted
+func TestPluginLacp2(t *testing.T) {
+	a := &LacpTestBase{
+		testname:     "lacp2",
+		dropAll:      false,
+		monitor:      false,
+		replies:      2,
+		capture:      true,
+		duration:     10 * time.Second,
+		clientsToSim: 1,
+		clientInit:   []byte(`{"system_id": [0, 0, 0, 1, 2, 3], "system_priority": 10, "key": 10, "port": 3, "fast": true}`),
+		cb:           rpcQueue,
+		cbArg1:       8 * time.Second,
+	}
+	a.Run(t)
+}
+
+// a passive actor without an active partner does not send
+func TestPluginLacp3(t *testing.T) {
+	a := &LacpTestBase{
+		testname:     "lacp3",
+		dropAll:      false,
+		monitor:      false,
+		capture:      true,
+		duration:     70 * time.Second,
+		clientsToSim: 1,
+		clientInit:   []byte(`{"passive": true}`),
+		cb:           rpcQueue,
+		cbArg1:       65 * time.Second,
+	}
+	a.Run(t)
+}
+
+func init() {
+	flag.IntVar(&monitor, "monitor", 0, "monitor")
+}
@@ -0,0 +1,673 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package mcsource
+
+/* Multicast UDP sources, emulated clients that send data to a group
+
+A stream is keyed by (src client mac, group). The group is either IPv4 (224.0.0.0/4)
+or IPv6 (ff00::/8). The destination MAC is the group multicast MAC
+
+IPv4  01:00:5e + low 23 bits of the group (RFC 1112)
+IPv6  33:33 + low 32 bits of the group (RFC 2464)
+
+The source address is resolved before each burst (IPv4 or the IPv6 global/DHCPv6/SLAAC address)
+so a change of the client address is picked up automatically. It complements the receiver side
+(igmp/mld plugins) to test the DUT multicast forwarding end to end.
+
+*/
+
+import (
+	"emu/core"
+	"encoding/binary"
+	"external/google/gopacket"
+	"external/google/gopacket/layers"
+	"external/osamingo/jsonrpc"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/intel-go/fastjson"
+)
+
+const (
+	MCSOURCE_PLUG       = "mcsource"
+	defaultMcSourcePps  = 1
+	defaultMcSourceSize = 64
+	defaultMcSourcePort = 5001
+	defaultMcSourceTtl  = 64
+)
+
+type McSourceNsStats struct {
+	opsAdd        uint64 /* streams added */
+	opsRemove     uint64 /* streams removed */
+	opsAddErr     uint64 /* add error, stream exists, invalid group or client */
+	opsRemoveErr  uint64 /* remove error, stream does not exist */
+	pktTx         uint64 /* total packets sent by all the streams */
+	bytesTx       uint64 /* total bytes sent by all the streams */
+	pktTxIpv4     uint64 /* packets sent to IPv4 groups */
+	pktTxIpv6     uint64 /* packets sent to IPv6 groups */
+	opsAddrUpdate uint64 /* source address was changed and packet template rebuilt */
+	pktTxErrNoSrc uint64 /* source client does not exist or has no address */
+}
+
+func NewMcSourceNsStatsDb(o *McSourceNsStats) *core.CCounterDb {
+	db := core.NewCCounterDb("mcsource")
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAdd,
+		Name:     "opsAdd",
+		Help:     "streams added",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsRemove,
+		Name:     "opsRemove",
+		Help:     "streams removed",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAddErr,
+		Name:     "opsAddErr",
+		Help:     "add stream error",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsRemoveErr,
+		Name:     "opsRemoveErr",
+		Help:     "remove stream error",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTx,
+		Name:     "pktTx",
+		Help:     "tx packets",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.bytesTx,
+		Name:     "bytesTx",
+		Help:     "tx bytes",
+		Unit:     "bytes",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxIpv4,
+		Name:     "pktTxIpv4",
+		Help:     "tx packets to ipv4 groups",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxIpv6,
+		Name:     "pktTxIpv6",
+		Help:     "tx packets to ipv6 groups",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAddrUpdate,
+		Name:     "opsAddrUpdate",
+		Help:     "source address changed",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxErrNoSrc,
+		Name:     "pktTxErrNoSrc",
+		Help:     "source client not found or without address",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	return db
+}
+
+// mcGroup is an IPv4 or IPv6 group, IPv4 is kept in the first 4 bytes
+type mcGroup struct {
+	ip   core.Ipv6Key
+	ipv6 bool
+}
+
+func (o *mcGroup) set(ipv4 core.Ipv4Key, ipv6 core.Ipv6Key) error {
+	if ipv4.IsZero() == ipv6.IsZero() {
+		return fmt.Errorf("exactly one of ipv4/ipv6 group should be given")
+	}
+	if !ipv6.IsZero() {
+		if ipv6[0] != 0xff {
+			return fmt.Errorf("%v is not an ipv6 multicast group", ipv6.ToIP())
+		}
+		o.ip = ipv6
+		o.ipv6 = true
+		return nil
+	}
+	if ipv4[0]&0xf0 != 0xe0 {
+		return fmt.Errorf("%v is not an ipv4 multicast group", ipv4.ToIP())
+	}
+	copy(o.ip[:4], ipv4[:])
+	return nil
+}
+
+func (o *mcGroup) ipv4() (ipv4 core.Ipv4Key) {
+	copy(ipv4[:], o.ip[:4])
+	return ipv4
+}
+
+// mac returns the multicast MAC of the group
+func (o *mcGroup) mac() core.MACKey {
+	if o.ipv6 {
+		return core.MACKey{0x33, 0x33, o.ip[12], o.ip[13], o.ip[14], o.ip[15]}
+	}
+	return core.MACKey{0x01, 0x00, 0x5e, o.ip[1] & 0x7f, o.ip[2], o.ip[3]}
+}
+
+func (o *mcGroup) String() string {
+	if o.ipv6 {
+		return o.ip.ToIP().String()
+	}
+	ipv4 := o.ipv4()
+	return ipv4.ToIP().String()
+}
+
+type mcStreamKey struct {
+	src   core.MACKey
+	group mcGroup
+}
+
+// McStreamJson the configuration and counters of one stream
+type McStreamJson struct {
+	Src   core.MACKey  `json:"src"`
+	Ipv4  core.Ipv4Key `json:"ipv4"`
+	Ipv6  core.Ipv6Key `json:"ipv6"`
+	Mac   core.MACKey  `json:"mac"`
+	Pps   float32      `json:"pps"`
+	Size  uint16       `json:"size"`
+	Port  uint16       `json:"port"`
+	Ttl   uint8        `json:"ttl"`
+	Pkts  uint64       `json:"pkts"`
+	Bytes uint64       `json:"bytes"`
+}
+
+// McGroupJson the packets sent to one group by all the sources
+type McGroupJson struct {
+	Ipv4  core.Ipv4Key `json:"ipv4"`
+	Ipv6  core.Ipv6Key `json:"ipv6"`
+	Pkts  uint64       `json:"pkts"`
+	Bytes uint64       `json:"bytes"`
+}
+
+// mcStream one stream from src client to a group
+type mcStream struct {
+	key   mcStreamKey
+	pps   float32
+	size  uint16
+	port  uint16
+	ttl   uint8
+	ns    *PluginMcSourceNs
+	timer core.CHTimerObj
+	ticks uint32
+	burst uint32
+	pkt   []byte // packet template, valid for the source address below
+	srcIp core.Ipv6Key
+	pkts  uint64
+	bytes uint64
+}
+
+func (o *mcStream) OnEvent(a, b interface{}) {
+	o.ns.onStreamTimer(o)
+}
+
+func (o *mcStream) getJson() *McStreamJson {
+	var j McStreamJson
+	j.Src = o.key.src
+	if o.key.group.ipv6 {
+		j.Ipv6 = o.key.group.ip
+	} else {
+		j.Ipv4 = o.key.group.ipv4()
+	}
+	j.Mac = o.key.group.mac()
+	j.Pps = o.pps
+	j.Size = o.size
+	j.Port = o.port
+	j.Ttl = o.ttl
+	j.Pkts = o.pkts
+	j.Bytes = o.bytes
+	return &j
+}
+
+// PluginMcSourceClient is an empty shell, all the streams are in the namespace
+type PluginMcSourceClient struct {
+	core.PluginBase
+}
+
+var mcSourceEvents = []string{}
+
+func NewMcSourceClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	o := new(PluginMcSourceClient)
+	o.InitPluginBase(ctx, o)
+	o.RegisterEvents(ctx, mcSourceEvents, o)
+	o.Ns.PluginCtx.GetOrCreate(MCSOURCE_PLUG)
+	return &o.PluginBase
+}
+
+func (o *PluginMcSourceClient) OnEvent(msg string, a, b interface{}) {
+}
+
+func (o *PluginMcSourceClient) OnRemove(ctx *core.PluginCtx) {
+	ctx.UnregisterEvents(&o.PluginBase, mcSourceEvents)
+}
+
+// PluginMcSourceNs streams information per namespace
+type PluginMcSourceNs struct {
+	core.PluginBase
+	streams map[mcStreamKey]*mcStream
+	vec     []*mcStream // keep the add order for the get command
+	timerw  *core.TimerCtx
+	stats   McSourceNsStats
+	cdb     *core.CCounterDb
+	cdbv    *core.CCounterDbVec
+}
+
+func NewMcSourceNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	o := new(PluginMcSourceNs)
+	o.InitPluginBase(ctx, o)
+	o.RegisterEvents(ctx, []string{}, o)
+	o.streams = make(map[mcStreamKey]*mcStream)
+	o.timerw = ctx.Ns.GetTimerCtx()
+	o.cdb = NewMcSourceNsStatsDb(&o.stats)
+	o.cdbv = core.NewCCounterDbVec("mcsource")
+	o.cdbv.Add(o.cdb)
+	return &o.PluginBase
+}
+
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginMcSourceNs) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
+func (o *PluginMcSourceNs) OnRemove(ctx *core.PluginCtx) {
+	for _, s := range o.vec {
+		if s.timer.IsRunning() {
+			o.timerw.Stop(&s.timer)
+		}
+	}
+	o.streams = nil
+	o.vec = nil
+}
+
+func (o *PluginMcSourceNs) OnEvent(msg string, a, b interface{}) {
+}
+
+func (o *PluginMcSourceNs) addStream(p *ApiMcSourceNsAddParams) error {
+	key := mcStreamKey{src: p.Src}
+	if err := key.group.set(p.Ipv4, p.Ipv6); err != nil {
+		o.stats.opsAddErr++
+		return err
+	}
+	if _, ok := o.streams[key]; ok {
+		o.stats.opsAddErr++
+		return fmt.Errorf("stream %v->%v already exists", p.Src, key.group.String())
+	}
+	if o.Ns.CLookupByMac(&key.src) == nil {
+		o.stats.opsAddErr++
+		return fmt.Errorf("stream %v->%v client does not exist", p.Src, key.group.String())
+	}
+
+	s := new(mcStream)
+	s.key = key
+	s.pps = p.Pps
+	s.size = p.Size
+	s.port = p.Port
+	s.ttl = p.Ttl
+	s.ns = o
+	s.ticks, s.burst = o.timerw.DurationToTicksBurst(time.Duration(float32(time.Second) / s.pps))
+	s.timer.SetCB(s, 0, 0)
+	o.streams[key] = s
+	o.vec = append(o.vec, s)
+	o.stats.opsAdd++
+	o.timerw.StartTicks(&s.timer, s.ticks)
+	return nil
+}
+
+func (o *PluginMcSourceNs) removeStream(p *ApiMcSourceNsRemoveParams) error {
+	key := mcStreamKey{src: p.Src}
+	if err := key.group.set(p.Ipv4, p.Ipv6); err != nil {
+		o.stats.opsRemoveErr++
+		return err
+	}
+	s, ok := o.streams[key]
+	if !ok {
+		o.stats.opsRemoveErr++
+		return fmt.Errorf("stream %v->%v does not exist", p.Src, key.group.String())
+	}
+	if s.timer.IsRunning() {
+		o.timerw.Stop(&s.timer)
+	}
+	delete(o.streams, key)
+	for i, e := range o.vec {
+		if e == s {
+			o.vec = append(o.vec[:i], o.vec[i+1:]...)
+			break
+		}
+	}
+	o.stats.opsRemove++
+	return nil
+}
+
+// getGroups sums the counters of the streams per group, in the add order
+func (o *PluginMcSourceNs) getGroups() []McGroupJson {
+	groups := make([]McGroupJson, 0)
+	index := make(map[mcGroup]int)
+	for _, s := range o.vec {
+		i, ok := index[s.key.group]
+		if !ok {
+			var j McGroupJson
+			if s.key.group.ipv6 {
+				j.Ipv6 = s.key.group.ip
+			} else {
+				j.Ipv4 = s.key.group.ipv4()
+			}
+			i = len(groups)
+			index[s.key.group] = i
+			groups = append(groups, j)
+		}
+		groups[i].Pkts += s.pkts
+		groups[i].Bytes += s.bytes
+	}
+	return groups
+}
+
+// resolve the current source address, rebuild the template in case of a change
+func (o *PluginMcSourceNs) resolve(s *mcStream) bool {
+	src := o.Ns.CLookupByMac(&s.key.src)
+	if src == nil {
+		o.stats.pktTxErrNoSrc++
+		return false
+	}
+	var srcIp core.Ipv6Key
+	if s.key.group.ipv6 {
+		var err error
+		srcIp, err = src.GetSourceIPv6()
+		if err != nil {
+			o.stats.pktTxErrNoSrc++
+			return false
+		}
+	} else {
+		if src.Ipv4.IsZero() {
+			o.stats.pktTxErrNoSrc++
+			return false
+		}
+		copy(srcIp[:4], src.Ipv4[:])
+	}
+	if s.pkt != nil && s.srcIp == srcIp {
+		return true
+	}
+	if s.pkt != nil {
+		o.stats.opsAddrUpdate++
+	}
+	s.srcIp = srcIp
+	if s.key.group.ipv6 {
+		s.pkt = buildMcSourcePacketIpv6(src, s)
+	} else {
+		s.pkt = buildMcSourcePacketIpv4(src, s)
+	}
+	return true
+}
+
+func mcSourcePayload(size int, hdrs int) gopacket.Payload {
+	pyld := size - hdrs
+	if pyld < 0 {
+		pyld = 0
+	}
+	return gopacket.Payload(make([]byte, pyld))
+}
+
+func buildMcSourcePacketIpv4(src *core.CClient, s *mcStream) []byte {
+	l2 := src.GetL2Header(false, uint16(layers.EthernetTypeIPv4))
+	mac := s.key.group.mac()
+	layers.EthernetHeader(l2).SetDestAddress(mac[:])
+	sip := s.srcIp
+	d := s.key.group.ip
+	l3 := core.PacketUtlBuild(
+		&layers.IPv4{Version: 4, IHL: 5, TTL: s.ttl, Id: 0xcc,
+			SrcIP:    net.IPv4(sip[0], sip[1], sip[2], sip[3]),
+			DstIP:    net.IPv4(d[0], d[1], d[2], d[3]),
+			Protocol: layers.IPProtocolUDP},
+		&layers.UDP{SrcPort: layers.UDPPort(s.port), DstPort: layers.UDPPort(s.port)},
+		mcSourcePayload(int(s.size), len(l2)+20+8),
+	)
+	ipv4 := layers.IPv4Header(l3[0:20])
+	ipv4.SetLength(uint16(len(l3)))
+	ipv4.UpdateChecksum()
+
+	binary.BigEndian.PutUint16(l3[24:26], uint16(len(l3)-20))
+	binary.BigEndian.PutUint16(l3[26:28], 0)
+	cs := layers.PktChecksumTcpUdp(l3[20:], 0, ipv4)
+	binary.BigEndian.PutUint16(l3[26:28], cs)
+	return append(l2, l3...)
+}
+
+func buildMcSourcePacketIpv6(src *core.CClient, s *mcStream) []byte {
+	l2 := src.GetL2Header(false, uint16(layers.EthernetTypeIPv6))
+	mac := s.key.group.mac()
+	layers.EthernetHeader(l2).SetDestAddress(mac[:])
+	l3 := core.PacketUtlBuild(
+		&layers.IPv6{Version: 6, HopLimit: s.ttl,
+			SrcIP:      s.srcIp.ToIP(),
+			DstIP:      s.key.group.ip.ToIP(),
+			NextHeader: layers.IPProtocolUDP},
+		&layers.UDP{SrcPort: layers.UDPPort(s.port), DstPort: layers.UDPPort(s.port)},
+		mcSourcePayload(int(s.size), len(l2)+40+8),
+	)
+	ipv6 := layers.IPv6Header(l3[0:40])
+	ipv6.SetPyloadLength(uint16(len(l3) - 40))
+	binary.BigEndian.PutUint16(l3[44:46], uint16(len(l3)-40))
+	ipv6.FixUdpL4Checksum(l3[40:], 0)
+	return append(l2, l3...)
+}
+
+func (o *PluginMcSourceNs) onStreamTimer(s *mcStream) {
+	if !o.Ns.SuppressTx() && o.resolve(s) {
+		for i := uint32(0); i < s.burst; i++ {
+			m := o.Ns.AllocMbuf(uint16(len(s.pkt)))
+			m.Append(s.pkt)
+			o.Tctx.Veth.Send(m)
+		}
+		bytes := uint64(len(s.pkt)) * uint64(s.burst)
+		s.pkts += uint64(s.burst)
+		s.bytes += bytes
+		o.stats.pktTx += uint64(s.burst)
+		o.stats.bytesTx += bytes
+		if s.key.group.ipv6 {
+			o.stats.pktTxIpv6 += uint64(s.burst)
+		} else {
+			o.stats.pktTxIpv4 += uint64(s.burst)
+		}
+	}
+	o.timerw.StartTicks(&s.timer, s.ticks)
+}
+
+type PluginMcSourceCReg struct{}
+type PluginMcSourceNsReg struct{}
+
+func (o PluginMcSourceCReg) NewPlugin(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	return NewMcSourceClient(ctx, initJson)
+}
+
+func (o PluginMcSourceNsReg) NewPlugin(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	return NewMcSourceNs(ctx, initJson)
+}
+
+/*******************************************/
+/* mcsource RPC commands */
+type (
+	ApiMcSourceNsCntHandler struct{}
+
+	ApiMcSourceNsAddHandler struct{}
+	ApiMcSourceNsAddParams  struct {
+		Src  core.MACKey  `json:"src" validate:"required"`
+		Ipv4 core.Ipv4Key `json:"ipv4"`
+		Ipv6 core.Ipv6Key `json:"ipv6"`
+		Pps  float32      `json:"pps" validate:"gt=0,lte=10000"`
+		Size uint16       `json:"size" validate:"gte=60,lte=9000"`
+		Port uint16       `json:"port"`
+		Ttl  uint8        `json:"ttl" validate:"gt=0"`
+	}
+
+	ApiMcSourceNsRemoveHandler struct{}
+	ApiMcSourceNsRemoveParams  struct {
+		Src  core.MACKey  `json:"src" validate:"required"`
+		Ipv4 core.Ipv4Key `json:"ipv4"`
+		Ipv6 core.Ipv6Key `json:"ipv6"`
+	}
+
+	ApiMcSourceNsGetHandler struct{}
+	ApiMcSourceNsGetResult  struct {
+		Vec    []McStreamJson `json:"data"`
+		Groups []McGroupJson  `json:"groups"`
+	}
+)
+
+func getNsPlugin(ctx interface{}, params *fastjson.RawMessage) (*PluginMcSourceNs, error) {
+	tctx := ctx.(*core.CThreadCtx)
+	nsPlug, err := tctx.GetNsPlugin(params, MCSOURCE_PLUG)
+	if err != nil {
+		return nil, err
+	}
+	mcPlug := nsPlug.Ext.(*PluginMcSourceNs)
+	return mcPlug, nil
+}
+
+func (h ApiMcSourceNsCntHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p core.ApiCntParams
+	tctx := ctx.(*core.CThreadCtx)
+	c, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return c.cdbv.GeneralCounters(err, tctx, params, &p)
+}
+
+func (h ApiMcSourceNsAddHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	p := ApiMcSourceNsAddParams{Pps: defaultMcSourcePps, Size: defaultMcSourceSize,
+		Port: defaultMcSourcePort, Ttl: defaultMcSourceTtl}
+	tctx := ctx.(*core.CThreadCtx)
+
+	mcNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+
+	err1 = mcNs.addStream(&p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiMcSourceNsRemoveHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiMcSourceNsRemoveParams
+	tctx := ctx.(*core.CThreadCtx)
+
+	mcNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+
+	err1 = mcNs.removeStream(&p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiMcSourceNsGetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var res ApiMcSourceNsGetResult
+
+	mcNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	res.Vec = make([]McStreamJson, 0)
+	for _, s := range mcNs.vec {
+		res.Vec = append(res.Vec, *s.getJson())
+	}
+	res.Groups = mcNs.getGroups()
+	return &res, nil
+}
+
+func init() {
+
+	/* register of plugins callbacks for ns,c level  */
+	core.PluginRegister(MCSOURCE_PLUG,
+		core.PluginRegisterData{Client: PluginMcSourceCReg{},
+			Ns:     PluginMcSourceNsReg{},
+			Thread: nil}) /* no need for thread context for now */
+
+	/* The format of the RPC commands xxx_yy_zz_aa
+
+	  xxx - the plugin name
+
+	  yy  - ns - namespace
+			c  - client
+			t   -thread
+
+	  zz  - cmd  command like ping etc
+			set  set configuration
+			get  get configuration/counters
+
+	  aa - misc
+	*/
+
+	core.RegisterCB("mcsource_ns_cnt", ApiMcSourceNsCntHandler{}, false)
+	core.RegisterCB("mcsource_ns_add", ApiMcSourceNsAddHandler{}, false)
+	core.RegisterCB("mcsource_ns_remove", ApiMcSourceNsRemoveHandler{}, false)
+	core.RegisterCB("mcsource_ns_get", ApiMcSourceNsGetHandler{}, false)
+}
+
+func Register(ctx *core.CThreadCtx) {
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package mcsource
+
+import (
+	"emu/core"
+	"flag"
+	"testing"
+	"time"
+)
+
+var monitor int
+
+type McSourceTestBase struct {
+	testname     string
+	monitor      bool
+	capture      bool
+	duration     time.Duration
+	clientsToSim int
+	cb           McSourceTestCb
+	cbArg1       interface{}
+	cbArg2       interface{}
+}
+
+type McSourceTestCb func(tctx *core.CThreadCtx, test *McSourceTestBase) int
+
+func (o *McSourceTestBase) Run(t *testing.T) {
+
+	var simVeth VethMcSourceSim
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, o.clientsToSim)
+	if o.cb != nil {
+		o.cb(tctx, o)
+	}
+	m := false
+	if monitor > 0 {
+		m = true
+	}
+	tctx.Veth.SetDebug(m, o.capture)
+	tctx.MainLoopSim(o.duration)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+
+	ns := tctx.GetNs(&key)
+	if ns == nil {
+		t.Fatalf(" can't find ns")
+		return
+	}
+	nsplg := ns.PluginCtx.Get(MCSOURCE_PLUG)
+	if nsplg == nil {
+		t.Fatalf(" can't find plugin")
+	}
+	mcPlug := nsplg.Ext.(*PluginMcSourceNs)
+	mcPlug.cdb.Dump()
+	tctx.SimRecordAppend(mcPlug.cdb.MarshalValues(false))
+	tctx.SimRecordCompare(o.testname, t)
+}
+
+func createSimulationEnv(simRx *core.VethIFSim, num int) (*core.CThreadCtx, *core.CClient) {
+	tctx := core.NewThreadCtx(0, 4510, true, simRx)
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := core.NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	for j := 0; j < num; j++ {
+		client := core.NewClient(ns, core.MACKey{0, 0, 1, 0, 0, uint8(j)},
+			core.Ipv4Key{16, 0, 0, uint8(j + 1)},
+			core.Ipv6Key{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, uint8(j + 1)},
+			core.Ipv4Key{16, 0, 0, 100})
+		ns.AddClient(client)
+		client.PluginCtx.CreatePlugins([]string{MCSOURCE_PLUG}, [][]byte{})
+	}
+	return tctx, nil
+}
+
+type VethMcSourceSim struct {
+}
+
+func (o *VethMcSourceSim) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
+	m.FreeMbuf()
+	return nil
+}
+
+type McSourceRpcCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	test  *McSourceTestBase
+	cnt   uint32
+}
+
+func (o *McSourceRpcCtx) OnEvent(a, b interface{}) {
+	switch o.cnt {
+	case 0:
+		// two sources of the same ipv4 group and one ipv6 source
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"mcsource_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,0], "ipv4": [239,129,2,3], "pps": 1, "ttl": 8 },
+			"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"mcsource_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,1], "ipv4": [239,129,2,3], "pps": 1, "size": 128, "port": 7 },
+			"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"mcsource_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,0], "ipv6": [255,14,0,0,0,0,0,0,0,0,0,0,0,1,0,2], "pps": 1, "ttl": 16 },
+			"id": 3 }`))
+		// errors, already exists and not a multicast group
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"mcsource_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,0], "ipv4": [239,129,2,3] },
+			"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"mcsource_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,0], "ipv4": [16,0,0,2] },
+			"id": 3 }`))
+	case 1:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"mcsource_ns_get",
+			"params": {"tun": {"vport":1,"tci":[1,2]} },
+			"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"mcsource_ns_remove",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,0], "ipv4": [239,129,2,3] },
+			"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"mcsource_ns_get",
+			"params": {"tun": {"vport":1,"tci":[1,2]} },
+			"id": 3 }`))
+	}
+	if o.cnt < 1 {
+		timerw := o.tctx.GetTimerCtx()
+		ticks := timerw.DurationToTicks(2 * time.Second)
+		timerw.StartTicks(&o.timer, ticks)
+	}
+	o.cnt++
+}
+
+func rpcQueue(tctx *core.CThreadCtx, test *McSourceTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(500 * time.Millisecond)
+	var rpcctx McSourceRpcCtx
+	rpcctx.timer.SetCB(&rpcctx, test.cbArg1, test.cbArg2)
+	rpcctx.tctx = tctx
+	rpcctx.test = test
+	timerw.StartTicks(&rpcctx.timer, ticks)
+	return 0
+}
+
+func TestPluginMcSource1(t *testing.T) {
+	a := &McSourceTestBase{
+		testname:     "mcsource1",
+		monitor:      false,
+		capture:      true,
+		duration:     4 * time.Second,
+		clientsToSim: 2,
+		cb:           rpcQueue,
+	}
+	a.Run(t)
+}
+
+func init() {
+	flag.IntVar(&monitor, "monitor", 0, "monitor")
+}
@@ -0,0 +1,1228 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package pairflow
+
+/* UDP flows between pairs of emulated clients in the same namespace
+
+A flow is keyed by (src client mac, dst client mac). The destination IPv4/MAC is
+resolved from the namespace before each burst so a change of the destination
+address (e.g. new DHCP lease) is picked up automatically.
+
+dut=false  the packet is sent directly to the destination client MAC (stays in the emulated population)
+dut=true   the packet is sent to the source client default gateway MAC, so it crosses the DUT
+
+max_pkt_size  the maximum L3 size on the wire, the source client MTU by default. A bigger packet is
+              sent as IPv4 fragments, each packet of the flow has its own identification
+
+ip_id         the identification of the packets, fixed (ip_id_value), inc (incremented from
+              ip_id_value for each packet) or random. By default the unfragmented packets have a fixed
+              identification (ip_id_value) and each fragmented packet has its own, from ip_id_value
+df            the Don't Fragment bit. A packet with DF that is bigger than the max packet size is dropped
+              instead of fragmented and MSG_DF_DROP is sent once to the ns plugins (again after a change
+              of the addresses or the max packet size), for PMTUD testing
+
+The achieved rate of each flow is the rate that is received by the destination client, it is measured
+against the requested rate in windows of time (pairflow_ns_set_rate_check). A flow that is below the percent of its requested pps for a window is
+flagged, MSG_RATE_SHORTFALL is sent to the ns plugins and the window is kept in the shortfall history
+of the flow (pairflow_ns_get_rate). The flag is cleared by a window that reaches the rate.
+
+The destination client receives the flow on its port by the transport plugin (it should have the
+transport plugin). Each packet carries a magic and a sequence number at the start of the payload,
+the receiver tracks the reordering and the duplication of the flow in a window of reorder_window
+sequence numbers (a power of 2), see pairflow_ns_get_reorder and pairflow_ns_reorder_cnt.
+
+*/
+
+import (
+	"emu/core"
+	"emu/plugins/transport"
+	"encoding/binary"
+	"external/google/gopacket"
+	"external/google/gopacket/layers"
+	"external/osamingo/jsonrpc"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/intel-go/fastjson"
+)
+
+const (
+	PAIRFLOW_PLUG       = "pairflow"
+	defaultPairFlowPps  = 1
+	defaultPairFlowSize = 64
+	defaultPairFlowPort = 5001
+	defaultPairFlowIpId = 0xcc
+
+	IP_ID_FIXED  = "fixed"
+	IP_ID_INC    = "inc"
+	IP_ID_RANDOM = "random"
+
+	defaultRateCheckWindow = 5 // sec
+	rateShortfallHistory   = 16
+
+	pairFlowMagic   = 0x50464c57 // at the start of the payload, followed by the sequence number
+	pairFlowHdrSize = 8
+)
+
+type PairFlowNsStats struct {
+	opsAdd          uint64 /* flows added */
+	opsRemove       uint64 /* flows removed */
+	opsAddErr       uint64 /* add error, flow exists or invalid client */
+	opsRemoveErr    uint64 /* remove error, flow does not exist */
+	pktTx           uint64 /* total packets sent by all the flows */
+	bytesTx         uint64 /* total bytes sent by all the flows */
+	opsAddrUpdate   uint64 /* destination address was changed and packet template rebuilt */
+	pktTxErrNoSrc   uint64 /* source client does not exist or has no IPv4 */
+	pktTxErrNoDst   uint64 /* destination client does not exist or has no IPv4 */
+	pktTxErrNoDgMac uint64 /* dut mode and the default gateway is not resolved */
+	pktTxFragmented uint64 /* packets that were sent as fragments */
+	fragTx          uint64 /* fragments sent */
+	pktTxIdFixed    uint64 /* packets sent with a fixed identification */
+	pktTxIdInc      uint64 /* packets sent with an incremented identification */
+	pktTxIdRandom   uint64 /* packets sent with a random identification */
+	pktTxDfDrop     uint64 /* packets with DF that are bigger than the max packet size */
+	flowShortfall   uint64 /* flows that fell below the percent of their requested rate */
+	flowRecovered   uint64 /* flagged flows that reached their requested rate again */
+	pktRx           uint64 /* packets received by the destination clients */
+	pktRxErrNoFlow  uint64 /* received packet does not match a flow */
+	pktRxErrInvalid uint64 /* received packet without the magic and the sequence number */
+	opsRxListenErr  uint64 /* the port of the flow is used on the destination client */
+}
+
+func NewPairFlowNsStatsDb(o *PairFlowNsStats) *core.CCounterDb {
+	db := core.NewCCounterDb("pairflow")
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAdd,
+		Name:     "opsAdd",
+		Help:     "flows added",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsRemove,
+		Name:     "opsRemove",
+		Help:     "flows removed",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAddErr,
+		Name:     "opsAddErr",
+		Help:     "add flow error",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsRemoveErr,
+		Name:     "opsRemoveErr",
+		Help:     "remove flow error",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTx,
+		Name:     "pktTx",
+		Help:     "tx packets",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.bytesTx,
+		Name:     "bytesTx",
+		Help:     "tx bytes",
+		Unit:     "bytes",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsAddrUpdate,
+		Name:     "opsAddrUpdate",
+		Help:     "destination address changed",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxErrNoSrc,
+		Name:     "pktTxErrNoSrc",
+		Help:     "source client not found or without ipv4",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxErrNoDst,
+		Name:     "pktTxErrNoDst",
+		Help:     "destination client not found or without ipv4",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxErrNoDgMac,
+		Name:     "pktTxErrNoDgMac",
+		Help:     "default gateway is not resolved",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxFragmented,
+		Name:     "pktTxFragmented",
+		Help:     "tx packets bigger than the max packet size",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.fragTx,
+		Name:     "fragTx",
+		Help:     "tx fragments of the bigger packets",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxIdFixed,
+		Name:     "pktTxIdFixed",
+		Help:     "tx packets with a fixed ip id",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxIdInc,
+		Name:     "pktTxIdInc",
+		Help:     "tx packets with an incremented ip id",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxIdRandom,
+		Name:     "pktTxIdRandom",
+		Help:     "tx packets with a random ip id",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktTxDfDrop,
+		Name:     "pktTxDfDrop",
+		Help:     "packets with df bigger than the max packet size were dropped",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.flowShortfall,
+		Name:     "flowShortfall",
+		Help:     "flows below the percent of the requested rate",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.flowRecovered,
+		Name:     "flowRecovered",
+		Help:     "flows that reached the requested rate again",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRx,
+		Name:     "pktRx",
+		Help:     "rx packets",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxErrNoFlow,
+		Name:     "pktRxErrNoFlow",
+		Help:     "rx packet does not match a flow",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pktRxErrInvalid,
+		Name:     "pktRxErrInvalid",
+		Help:     "rx packet without a sequence number",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.opsRxListenErr,
+		Name:     "opsRxListenErr",
+		Help:     "flow port is used on the destination client",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	return db
+}
+
+type pairFlowKey struct {
+	src core.MACKey
+	dst core.MACKey
+}
+
+// PairFlowJson the configuration and counters of one flow
+type PairFlowJson struct {
+	Src     core.MACKey  `json:"src"`
+	Dst     core.MACKey  `json:"dst"`
+	Pps     float32      `json:"pps"`
+	Size    uint16       `json:"size"`
+	Port    uint16       `json:"port"`
+	Dut     bool         `json:"dut"`
+	DstIpv4 core.Ipv4Key `json:"dst_ipv4"`
+	DstMac  core.MACKey  `json:"dst_mac"`
+	Pkts    uint64       `json:"pkts"`
+	Bytes   uint64       `json:"bytes"`
+	RxPkts  uint64       `json:"rx_pkts"` // received by the destination client
+
+	MaxPktSize uint16 `json:"max_pkt_size"` // in use, L3
+	SegsPerPkt uint32 `json:"segs_per_pkt"` // packets on the wire for each packet of the flow
+	Segs       uint64 `json:"segs"`         // packets on the wire
+
+	IpId    string `json:"ip_id,omitempty"`
+	Df      bool   `json:"df,omitempty"`
+	DfDrops uint64 `json:"df_drops,omitempty"` // packets with DF bigger than the max packet size
+}
+
+// PairFlowReorderJson the reordering of one flow on the destination client
+type PairFlowReorderJson struct {
+	Src     core.MACKey      `json:"src"`
+	Dst     core.MACKey      `json:"dst"`
+	Reorder *core.CSeqRxInfo `json:"reorder"`
+}
+
+// PairFlowShortfall a window in which the flow was below the percent of its requested rate
+type PairFlowShortfall struct {
+	Time        float64 `json:"time"` // the end of the window, by the timestamp source of the namespace
+	AchievedPps float64 `json:"achieved_pps"`
+	Percent     float64 `json:"percent"` // of the requested pps
+}
+
+// PairFlowRateJson the requested and the achieved rate of one flow
+type PairFlowRateJson struct {
+	Src         core.MACKey         `json:"src"`
+	Dst         core.MACKey         `json:"dst"`
+	Pps         float32             `json:"pps"`
+	Bps         float64             `json:"bps"`
+	AchievedPps float64             `json:"achieved_pps"` // received in the last window
+	AchievedBps float64             `json:"achieved_bps"` // on the wire, with the fragments
+	Shortfall   bool                `json:"shortfall"`    // the last window is below the rate
+	Shortfalls  uint64              `json:"shortfalls"`   // times the flow was flagged
+	History     []PairFlowShortfall `json:"history"`      // the last windows below the rate, oldest first
+}
+
+// PairFlowRateCheck the check of the achieved rate of the flows
+type PairFlowRateCheck struct {
+	Percent uint8  `json:"percent" validate:"lte=100"`                 // of the requested pps, zero disables the check
+	Window  uint32 `json:"window" validate:"omitempty,gte=1,lte=3600"` // sec
+}
+
+// pairFlow one flow from src client to dst client
+type pairFlow struct {
+	key     pairFlowKey
+	pps     float32
+	size    uint16
+	port    uint16
+	dut     bool
+	ns      *PluginPairFlowNs
+	timer   core.CHTimerObj
+	ticks   uint32
+	burst   uint32
+	pkt     []byte // packet template, valid for the addresses below
+	srcIpv4 core.Ipv4Key
+	dstIpv4 core.Ipv4Key
+	dstMac  core.MACKey
+	pkts    uint64
+	bytes   uint64
+
+	maxPktSize uint16   // configured, zero for the source client MTU
+	mtu        uint16   // in use by the template
+	l3         uint16   // offset of the ipv4 header in the template
+	frags      [][]byte // fragments of the template, nil in case it fits
+	ipId       uint16
+	ipIdValue  uint16 // configured, the identification of the template
+	segs       uint64
+	wireBytes  uint64 // on the wire for each packet of the flow, with the fragments
+
+	ipIdMode string // see IP_ID_FIXED, empty for the default
+	df       bool
+	dfDrop   bool // the template has DF and is bigger than the mtu
+	dfSent   bool // MSG_DF_DROP was sent for the template
+	dfDrops  uint64
+
+	rateStart   uint64 // ticks, the start of the window
+	ratePkts    uint64 // rxPkts at the start of the window
+	achievedPps float64
+	achievedBps float64
+	shortfall   bool
+	shortfalls  uint64
+	history     []PairFlowShortfall
+
+	txSeq  uint32 // sequence number of the next packet
+	rxPkts uint64
+	seqRx  *core.CSeqRx
+	cdbv   *core.CCounterDbVec // the reorder counters
+	rx     *pairFlowRx
+}
+
+func (o *pairFlow) OnEvent(a, b interface{}) {
+	o.ns.onFlowTimer(o)
+}
+
+func (o *pairFlow) getJson() *PairFlowJson {
+	var j PairFlowJson
+	j.Src = o.key.src
+	j.Dst = o.key.dst
+	j.Pps = o.pps
+	j.Size = o.size
+	j.Port = o.port
+	j.Dut = o.dut
+	j.DstIpv4 = o.dstIpv4
+	j.DstMac = o.dstMac
+	j.Pkts = o.pkts
+	j.Bytes = o.bytes
+	j.RxPkts = o.rxPkts
+	j.MaxPktSize = o.mtu
+	j.SegsPerPkt = 1
+	if o.frags != nil {
+		j.SegsPerPkt = uint32(len(o.frags))
+	}
+	j.Segs = o.segs
+	j.IpId = o.ipIdMode
+	j.Df = o.df
+	j.DfDrops = o.dfDrops
+	return &j
+}
+
+func (o *pairFlow) getRateJson() *PairFlowRateJson {
+	var j PairFlowRateJson
+	j.Src = o.key.src
+	j.Dst = o.key.dst
+	j.Pps = o.pps
+	j.Bps = float64(o.pps) * float64(o.size) * 8
+	j.AchievedPps = o.achievedPps
+	j.AchievedBps = o.achievedBps
+	j.Shortfall = o.shortfall
+	j.Shortfalls = o.shortfalls
+	j.History = append([]PairFlowShortfall{}, o.history...)
+	return &j
+}
+
+// resetRate starts a new window of the rate check
+func (o *pairFlow) resetRate(ticks uint64) {
+	o.rateStart = ticks
+	o.ratePkts = o.rxPkts
+}
+
+// pairFlowRxKey a receiver of flows, the destination client and the port
+type pairFlowRxKey struct {
+	dst  core.MACKey
+	port uint16
+}
+
+// pairFlowRx the udp server of the flows to the same destination client and port
+type pairFlowRx struct {
+	ns     *PluginPairFlowNs
+	key    pairFlowRxKey
+	refs   uint32 // flows
+	client *core.CClient
+	trans  *transport.TransportCtx
+	socks  []transport.SocketApi
+}
+
+// OnAccept implements transport.IServerSocketCb, a socket for each source of flows
+func (o *pairFlowRx) OnAccept(socket transport.SocketApi) transport.ISocketCb {
+	host, _, err := net.SplitHostPort(socket.RemoteAddr().String())
+	ip := net.ParseIP(host).To4()
+	if err != nil || ip == nil {
+		o.ns.stats.pktRxErrNoFlow++
+		return nil
+	}
+	s := &pairFlowRxSocket{rx: o}
+	copy(s.src[:], ip)
+	o.socks = append(o.socks, socket)
+	return s
+}
+
+func (o *pairFlowRx) address() string {
+	return fmt.Sprintf(":%d", o.key.port)
+}
+
+func (o *pairFlowRx) listen(client *core.CClient) {
+	o.client = client
+	o.trans = transport.GetTransportCtx(client)
+	if err := o.trans.Listen("udp", o.address(), o); err != nil {
+		o.ns.stats.opsRxListenErr++
+		o.trans = nil
+	}
+}
+
+// close stops the server, the transport is left as is in case the client was removed
+func (o *pairFlowRx) close() {
+	if o.trans != nil && o.ns.Ns.CLookupByMac(&o.key.dst) == o.client {
+		for _, s := range o.socks {
+			s.Close()
+		}
+		o.trans.UnListen("udp", o.address(), o)
+	}
+	o.socks = nil
+	o.trans = nil
+	o.client = nil
+}
+
+type pairFlowRxSocket struct {
+	rx  *pairFlowRx
+	src core.Ipv4Key
+}
+
+func (o *pairFlowRxSocket) OnRxEvent(event transport.SocketEventType) {
+}
+
+func (o *pairFlowRxSocket) OnRxData(d []byte) {
+	o.rx.ns.onRx(o.src, &o.rx.key, d)
+}
+
+func (o *pairFlowRxSocket) OnTxEvent(event transport.SocketEventType) {
+}
+
+// PluginPairFlowClient is an empty shell, all the flows are in the namespace
+type PluginPairFlowClient struct {
+	core.PluginBase
+}
+
+var pairFlowEvents = []string{}
+
+func NewPairFlowClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	o := new(PluginPairFlowClient)
+	o.InitPluginBase(ctx, o)
+	o.RegisterEvents(ctx, pairFlowEvents, o)
+	o.Ns.PluginCtx.GetOrCreate(PAIRFLOW_PLUG)
+	return &o.PluginBase
+}
+
+func (o *PluginPairFlowClient) OnEvent(msg string, a, b interface{}) {
+}
+
+func (o *PluginPairFlowClient) OnRemove(ctx *core.PluginCtx) {
+	ctx.UnregisterEvents(&o.PluginBase, pairFlowEvents)
+}
+
+// PluginPairFlowNs flows information per namespace
+type PluginPairFlowNs struct {
+	core.PluginBase
+	flows  map[pairFlowKey]*pairFlow
+	vec    []*pairFlow // keep the add order for the get command
+	rx     map[pairFlowRxKey]*pairFlowRx
+	timerw *core.TimerCtx
+	stats  PairFlowNsStats
+	cdb    *core.CCounterDb
+	cdbv   *core.CCounterDbVec
+
+	rateCheck PairFlowRateCheck
+}
+
+func NewPairFlowNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	o := new(PluginPairFlowNs)
+	o.InitPluginBase(ctx, o)
+	o.RegisterEvents(ctx, []string{}, o)
+	o.flows = make(map[pairFlowKey]*pairFlow)
+	o.rx = make(map[pairFlowRxKey]*pairFlowRx)
+	o.timerw = ctx.Ns.GetTimerCtx()
+	o.cdb = NewPairFlowNsStatsDb(&o.stats)
+	o.cdbv = core.NewCCounterDbVec("pairflow")
+	o.cdbv.Add(o.cdb)
+	return &o.PluginBase
+}
+
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginPairFlowNs) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
+// getRates returns the requested and the achieved rate of the flows in the add order
+func (o *PluginPairFlowNs) getRates() []PairFlowRateJson {
+	r := make([]PairFlowRateJson, 0, len(o.vec))
+	for _, f := range o.vec {
+		r = append(r, *f.getRateJson())
+	}
+	return r
+}
+
+// setRateCheck sets the check of the achieved rate, the windows of the flows start again
+func (o *PluginPairFlowNs) setRateCheck(c *PairFlowRateCheck) {
+	o.rateCheck = *c
+	if o.rateCheck.Window == 0 {
+		o.rateCheck.Window = defaultRateCheckWindow
+	}
+	for _, f := range o.vec {
+		f.resetRate(o.timerw.Ticks)
+	}
+}
+
+// checkRate compares the achieved rate of the window with the requested rate at the end of a window
+func (o *PluginPairFlowNs) checkRate(f *pairFlow) {
+	if o.rateCheck.Percent == 0 {
+		return
+	}
+	elapsed := time.Duration(o.timerw.Ticks-f.rateStart) * o.timerw.TickDuration
+	if elapsed < time.Duration(o.rateCheck.Window)*time.Second {
+		return
+	}
+	sec := elapsed.Seconds()
+	f.achievedPps = float64(f.rxPkts-f.ratePkts) / sec
+	f.achievedBps = f.achievedPps * float64(f.wireBytes) * 8
+	f.resetRate(o.timerw.Ticks)
+
+	percent := f.achievedPps * 100 / float64(f.pps)
+	if percent >= float64(o.rateCheck.Percent) {
+		if f.shortfall {
+			f.shortfall = false
+			o.stats.flowRecovered++
+		}
+		return
+	}
+	if len(f.history) == rateShortfallHistory {
+		f.history = f.history[1:]
+	}
+	f.history = append(f.history, PairFlowShortfall{Time: o.Ns.Timestamp(), AchievedPps: f.achievedPps, Percent: percent})
+	if !f.shortfall {
+		f.shortfall = true
+		f.shortfalls++
+		o.stats.flowShortfall++
+		o.Ns.PluginCtx.BroadcastMsg(nil, core.MSG_RATE_SHORTFALL, &core.CRateShortfall{Src: f.key.src, Dst: f.key.dst,
+			Pps: float64(f.pps), AchievedPps: f.achievedPps}, nil)
+	}
+}
+
+// getFlows returns the flows in the add order
+func (o *PluginPairFlowNs) getFlows() []PairFlowJson {
+	r := make([]PairFlowJson, 0, len(o.vec))
+	for _, f := range o.vec {
+		r = append(r, *f.getJson())
+	}
+	return r
+}
+
+// getReorder returns the reordering of the flows in the add order
+func (o *PluginPairFlowNs) getReorder() []PairFlowReorderJson {
+	r := make([]PairFlowReorderJson, 0, len(o.vec))
+	for _, f := range o.vec {
+		r = append(r, PairFlowReorderJson{Src: f.key.src, Dst: f.key.dst, Reorder: f.seqRx.GetInfo()})
+	}
+	return r
+}
+
+// GetState implements core.IPluginState
+func (o *PluginPairFlowNs) GetState() interface{} {
+	return o.getFlows()
+}
+
+func (o *PluginPairFlowNs) OnRemove(ctx *core.PluginCtx) {
+	for _, f := range o.vec {
+		if f.timer.IsRunning() {
+			o.timerw.Stop(&f.timer)
+		}
+	}
+	for _, rx := range o.rx {
+		rx.close()
+	}
+	o.rx = nil
+	o.flows = nil
+	o.vec = nil
+}
+
+func (o *PluginPairFlowNs) OnEvent(msg string, a, b interface{}) {
+}
+
+func (o *PluginPairFlowNs) addFlow(p *ApiPairFlowNsAddParams) error {
+	key := pairFlowKey{src: p.Src, dst: p.Dst}
+	if _, ok := o.flows[key]; ok {
+		o.stats.opsAddErr++
+		return fmt.Errorf("flow %v->%v already exists", p.Src, p.Dst)
+	}
+	if p.Src == p.Dst {
+		o.stats.opsAddErr++
+		return fmt.Errorf("flow source and destination are the same client %v", p.Src)
+	}
+	if o.Ns.CLookupByMac(&key.src) == nil || o.Ns.CLookupByMac(&key.dst) == nil {
+		o.stats.opsAddErr++
+		return fmt.Errorf("flow %v->%v client does not exist", p.Src, p.Dst)
+	}
+
+	seqRx, err := core.NewSeqRx(p.ReorderWindow, "reorder")
+	if err != nil {
+		o.stats.opsAddErr++
+		return err
+	}
+
+	f := new(pairFlow)
+	f.key = key
+	f.pps = p.Pps
+	f.size = p.Size
+	f.port = p.Port
+	f.dut = p.Dut
+	f.maxPktSize = p.MaxPktSize
+	f.ipIdMode = p.IpId
+	f.ipIdValue = defaultPairFlowIpId
+	if p.IpIdValue != nil {
+		f.ipIdValue = *p.IpIdValue
+	}
+	f.ipId = f.ipIdValue
+	f.df = p.Df
+	f.seqRx = seqRx
+	f.cdbv = core.NewCCounterDbVec("reorder")
+	f.cdbv.Add(seqRx.Cdb)
+	f.ns = o
+	f.ticks, f.burst = o.timerw.DurationToTicksBurst(time.Duration(float32(time.Second) / f.pps))
+	f.timer.SetCB(f, 0, 0)
+	f.resetRate(o.timerw.Ticks)
+	o.flows[key] = f
+	o.vec = append(o.vec, f)
+	o.stats.opsAdd++
+	o.timerw.StartTicks(&f.timer, f.ticks)
+	return nil
+}
+
+func (o *PluginPairFlowNs) removeFlow(src, dst core.MACKey) error {
+	key := pairFlowKey{src: src, dst: dst}
+	f, ok := o.flows[key]
+	if !ok {
+		o.stats.opsRemoveErr++
+		return fmt.Errorf("flow %v->%v does not exist", src, dst)
+	}
+	if f.timer.IsRunning() {
+		o.timerw.Stop(&f.timer)
+	}
+	o.unlisten(f)
+	delete(o.flows, key)
+	for i, e := range o.vec {
+		if e == f {
+			o.vec = append(o.vec[:i], o.vec[i+1:]...)
+			break
+		}
+	}
+	o.stats.opsRemove++
+	return nil
+}
+
+// listen opens the receiver of the flow on the destination client, again in case the client was replaced
+func (o *PluginPairFlowNs) listen(f *pairFlow, dst *core.CClient) {
+	if f.rx == nil {
+		key := pairFlowRxKey{dst: f.key.dst, port: f.port}
+		rx, ok := o.rx[key]
+		if !ok {
+			rx = &pairFlowRx{ns: o, key: key}
+			o.rx[key] = rx
+		}
+		rx.refs++
+		f.rx = rx
+	}
+	if f.rx.client == dst {
+		return
+	}
+	f.rx.close()
+	f.rx.listen(dst)
+}
+
+// unlisten releases the receiver of the flow, the last flow closes it
+func (o *PluginPairFlowNs) unlisten(f *pairFlow) {
+	rx := f.rx
+	if rx == nil {
+		return
+	}
+	f.rx = nil
+	rx.refs--
+	if rx.refs == 0 {
+		rx.close()
+		delete(o.rx, rx.key)
+	}
+}
+
+// onRx accounts a packet that was received by the destination client of a flow
+func (o *PluginPairFlowNs) onRx(src core.Ipv4Key, key *pairFlowRxKey, d []byte) {
+	c := o.Ns.CLookupByIPv4(&src)
+	if c == nil {
+		o.stats.pktRxErrNoFlow++
+		return
+	}
+	f, ok := o.flows[pairFlowKey{src: c.Mac, dst: key.dst}]
+	if !ok || f.port != key.port {
+		o.stats.pktRxErrNoFlow++
+		return
+	}
+	if len(d) < pairFlowHdrSize || binary.BigEndian.Uint32(d[0:4]) != pairFlowMagic {
+		o.stats.pktRxErrInvalid++
+		return
+	}
+	f.rxPkts++
+	o.stats.pktRx++
+	f.seqRx.OnRx(binary.BigEndian.Uint32(d[4:8]))
+}
+
+// resolve the current addresses of the pair, rebuild the template in case of a change
+func (o *PluginPairFlowNs) resolve(f *pairFlow) bool {
+	src := o.Ns.CLookupByMac(&f.key.src)
+	if src == nil || src.Ipv4.IsZero() {
+		o.stats.pktTxErrNoSrc++
+		return false
+	}
+	dst := o.Ns.CLookupByMac(&f.key.dst)
+	if dst == nil || dst.Ipv4.IsZero() {
+		o.stats.pktTxErrNoDst++
+		return false
+	}
+	o.listen(f, dst)
+	dstMac := dst.Mac
+	if f.dut {
+		var ok bool
+		dstMac, ok = src.ResolveIPv4DGMac()
+		if !ok {
+			o.stats.pktTxErrNoDgMac++
+			return false
+		}
+	}
+	mtu := f.maxPktSize
+	if mtu == 0 {
+		mtu = src.MTU
+	}
+	if f.pkt != nil && f.srcIpv4 == src.Ipv4 && f.dstIpv4 == dst.Ipv4 && f.dstMac == dstMac && f.mtu == mtu {
+		return true
+	}
+	if f.pkt != nil {
+		o.stats.opsAddrUpdate++
+	}
+	f.srcIpv4 = src.Ipv4
+	f.dstIpv4 = dst.Ipv4
+	f.dstMac = dstMac
+	f.mtu = mtu
+	f.pkt = buildPairFlowPacket(src, f)
+	f.frags = core.Ipv4Fragment(f.pkt, f.l3, f.mtu)
+	f.wireBytes = uint64(len(f.pkt))
+	if f.frags != nil {
+		f.wireBytes = 0
+		for _, frag := range f.frags {
+			f.wireBytes += uint64(len(frag))
+		}
+	}
+	f.dfDrop = f.df && len(f.pkt) > int(f.l3)+int(f.mtu)
+	f.dfSent = false
+	return true
+}
+
+func buildPairFlowPacket(src *core.CClient, f *pairFlow) []byte {
+	l2 := src.GetL2Header(false, uint16(layers.EthernetTypeIPv4))
+	layers.EthernetHeader(l2).SetDestAddress(f.dstMac[:])
+	f.l3 = uint16(len(l2))
+	pyld := int(f.size) - len(l2) - 20 - 8
+	if pyld < pairFlowHdrSize {
+		pyld = pairFlowHdrSize
+	}
+	data := make([]byte, pyld)
+	binary.BigEndian.PutUint32(data[0:4], pairFlowMagic)
+	s := f.srcIpv4
+	d := f.dstIpv4
+	var flags layers.IPv4Flag
+	if f.df {
+		flags = layers.IPv4DontFragment
+	}
+	l3 := core.PacketUtlBuild(
+		&layers.IPv4{Version: 4, IHL: 5, TTL: 64, Id: f.ipIdValue, Flags: flags,
+			SrcIP:    net.IPv4(s[0], s[1], s[2], s[3]),
+			DstIP:    net.IPv4(d[0], d[1], d[2], d[3]),
+			Protocol: layers.IPProtocolUDP},
+		&layers.UDP{SrcPort: layers.UDPPort(f.port), DstPort: layers.UDPPort(f.port)},
+		gopacket.Payload(data),
+	)
+	ipv4 := layers.IPv4Header(l3[0:20])
+	ipv4.SetLength(uint16(len(l3)))
+	ipv4.UpdateChecksum()
+
+	binary.BigEndian.PutUint16(l3[24:26], uint16(len(l3)-20))
+	binary.BigEndian.PutUint16(l3[26:28], 0)
+	cs := layers.PktChecksumTcpUdp(l3[20:], 0, ipv4)
+	binary.BigEndian.PutUint16(l3[26:28], cs)
+	return append(l2, l3...)
+}
+
+func (o *PluginPairFlowNs) onFlowTimer(f *pairFlow) {
+	if !o.Ns.SuppressTx() && o.resolve(f) && !o.dropDf(f) {
+		for i := uint32(0); i < f.burst; i++ {
+			o.sendPacket(f)
+		}
+		f.pkts += uint64(f.burst)
+		o.stats.pktTx += uint64(f.burst)
+	}
+	o.checkRate(f)
+	o.timerw.StartTicks(&f.timer, f.ticks)
+}
+
+// dropDf drops the burst in case the packets have DF and are bigger than the max packet size, MSG_DF_DROP
+// is sent once for each template
+func (o *PluginPairFlowNs) dropDf(f *pairFlow) bool {
+	if !f.dfDrop {
+		return false
+	}
+	f.dfDrops += uint64(f.burst)
+	o.stats.pktTxDfDrop += uint64(f.burst)
+	if f.dfSent {
+		return true
+	}
+	f.dfSent = true
+	o.Ns.PluginCtx.BroadcastMsg(nil, core.MSG_DF_DROP, &core.CDfDrop{Src: f.key.src, Dst: f.key.dst,
+		Size: uint16(len(f.pkt)) - f.l3, Mtu: f.mtu, Pkts: f.burst}, nil)
+	return true
+}
+
+// nextIpId returns the identification of the next packet by the ip id strategy
+func (o *PluginPairFlowNs) nextIpId(f *pairFlow) uint16 {
+	switch f.ipIdMode {
+	case IP_ID_FIXED:
+		o.stats.pktTxIdFixed++
+	case IP_ID_INC:
+		f.ipId++
+		o.stats.pktTxIdInc++
+		return f.ipId - 1
+	case IP_ID_RANDOM:
+		f.ipId = uint16(o.Tctx.GetRandNumber(0, 0x10000))
+		o.stats.pktTxIdRandom++
+	default:
+		f.ipId++
+		return f.ipId - 1
+	}
+	return f.ipId
+}
+
+// setPairFlowSeq sets the sequence number of the packet and updates the udp checksum
+func setPairFlowSeq(p []byte, l3 uint16, seq uint32) {
+	off := l3 + 20 + 8 + 4
+	old := binary.BigEndian.Uint32(p[off : off+4])
+	binary.BigEndian.PutUint32(p[off:off+4], seq)
+	cs := binary.BigEndian.Uint16(p[l3+26 : l3+28])
+	cs = layers.UpdateInetChecksum(cs, uint16(old>>16), uint16(seq>>16))
+	cs = layers.UpdateInetChecksum(cs, uint16(old), uint16(seq))
+	if cs == 0 {
+		cs = 0xffff
+	}
+	binary.BigEndian.PutUint16(p[l3+26:l3+28], cs)
+}
+
+// sendPacket sends one packet of the flow, as fragments in case it is bigger than the max packet size
+func (o *PluginPairFlowNs) sendPacket(f *pairFlow) {
+	f.txSeq++
+	if f.frags == nil {
+		setPairFlowSeq(f.pkt, f.l3, f.txSeq-1)
+		if f.ipIdMode != "" {
+			binary.BigEndian.PutUint16(f.pkt[f.l3+4:f.l3+6], o.nextIpId(f))
+			layers.IPv4Header(f.pkt[f.l3 : f.l3+20]).UpdateChecksum()
+		}
+		o.send(f, f.pkt)
+		return
+	}
+	setPairFlowSeq(f.frags[0], f.l3, f.txSeq-1)
+	ipId := o.nextIpId(f)
+	for _, frag := range f.frags {
+		binary.BigEndian.PutUint16(frag[f.l3+4:f.l3+6], ipId)
+		layers.IPv4Header(frag[f.l3 : f.l3+20]).UpdateChecksum()
+		o.send(f, frag)
+	}
+	o.stats.pktTxFragmented++
+	o.stats.fragTx += uint64(len(f.frags))
+}
+
+func (o *PluginPairFlowNs) send(f *pairFlow, p []byte) {
+	m := o.Ns.AllocMbuf(uint16(len(p)))
+	m.Append(p)
+	o.Tctx.Veth.Send(m)
+	f.segs++
+	f.bytes += uint64(len(p))
+	o.stats.bytesTx += uint64(len(p))
+}
+
+type PluginPairFlowCReg struct{}
+type PluginPairFlowNsReg struct{}
+
+func (o PluginPairFlowCReg) NewPlugin(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	return NewPairFlowClient(ctx, initJson)
+}
+
+func (o PluginPairFlowNsReg) NewPlugin(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	return NewPairFlowNs(ctx, initJson)
+}
+
+/*******************************************/
+/* pairflow RPC commands */
+type (
+	ApiPairFlowNsCntHandler struct{}
+
+	ApiPairFlowNsAddHandler struct{}
+	ApiPairFlowNsAddParams  struct {
+		Src  core.MACKey `json:"src" validate:"required"`
+		Dst  core.MACKey `json:"dst" validate:"required"`
+		Pps  float32     `json:"pps" validate:"gt=0,lte=10000"`
+		Size uint16      `json:"size" validate:"gte=60,lte=9000"`
+		Port uint16      `json:"port"`
+		Dut  bool        `json:"dut"`
+
+		MaxPktSize uint16 `json:"max_pkt_size" validate:"omitempty,gte=68,lte=9000"`
+
+		IpId      string  `json:"ip_id" validate:"omitempty,oneof=fixed inc random"`
+		IpIdValue *uint16 `json:"ip_id_value"` // the fixed or the first identification
+		Df        bool    `json:"df"`
+
+		ReorderWindow uint32 `json:"reorder_window"` // power of 2, zero for the default
+	}
+
+	ApiPairFlowNsRemoveHandler struct{}
+	ApiPairFlowNsRemoveParams  struct {
+		Src core.MACKey `json:"src" validate:"required"`
+		Dst core.MACKey `json:"dst" validate:"required"`
+	}
+
+	ApiPairFlowNsGetHandler struct{}
+	ApiPairFlowNsGetResult  struct {
+		Vec []PairFlowJson `json:"data"`
+	}
+
+	ApiPairFlowNsSetRateCheckHandler struct{}
+
+	ApiPairFlowNsGetRateHandler struct{}
+	ApiPairFlowNsGetRateResult  struct {
+		RateCheck PairFlowRateCheck  `json:"rate_check"`
+		Vec       []PairFlowRateJson `json:"data"`
+	}
+
+	ApiPairFlowNsGetReorderHandler struct{}
+	ApiPairFlowNsGetReorderResult  struct {
+		Vec []PairFlowReorderJson `json:"data"`
+	}
+
+	ApiPairFlowNsReorderCntHandler struct{}
+	ApiPairFlowNsReorderCntParams  struct {
+		Src core.MACKey `json:"src" validate:"required"`
+		Dst core.MACKey `json:"dst" validate:"required"`
+	}
+)
+
+func getNsPlugin(ctx interface{}, params *fastjson.RawMessage) (*PluginPairFlowNs, error) {
+	tctx := ctx.(*core.CThreadCtx)
+	nsPlug, err := tctx.GetNsPlugin(params, PAIRFLOW_PLUG)
+	if err != nil {
+		return nil, err
+	}
+	pairPlug := nsPlug.Ext.(*PluginPairFlowNs)
+	return pairPlug, nil
+}
+
+func (h ApiPairFlowNsCntHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p core.ApiCntParams
+	tctx := ctx.(*core.CThreadCtx)
+	c, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return c.cdbv.GeneralCounters(err, tctx, params, &p)
+}
+
+func (h ApiPairFlowNsAddHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	p := ApiPairFlowNsAddParams{Pps: defaultPairFlowPps, Size: defaultPairFlowSize, Port: defaultPairFlowPort}
+	tctx := ctx.(*core.CThreadCtx)
+
+	pairNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+
+	err1 = pairNs.addFlow(&p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiPairFlowNsRemoveHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiPairFlowNsRemoveParams
+	tctx := ctx.(*core.CThreadCtx)
+
+	pairNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+
+	err1 = pairNs.removeFlow(p.Src, p.Dst)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+	return nil, nil
+}
+
+func (h ApiPairFlowNsGetHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var res ApiPairFlowNsGetResult
+
+	pairNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	res.Vec = pairNs.getFlows()
+	return &res, nil
+}
+
+func (h ApiPairFlowNsSetRateCheckHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p PairFlowRateCheck
+	tctx := ctx.(*core.CThreadCtx)
+
+	pairNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+
+	pairNs.setRateCheck(&p)
+	return nil, nil
+}
+
+func (h ApiPairFlowNsGetRateHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var res ApiPairFlowNsGetRateResult
+
+	pairNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	res.RateCheck = pairNs.rateCheck
+	res.Vec = pairNs.getRates()
+	return &res, nil
+}
+
+func (h ApiPairFlowNsGetReorderHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var res ApiPairFlowNsGetReorderResult
+
+	pairNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	res.Vec = pairNs.getReorder()
+	return &res, nil
+}
+
+func (h ApiPairFlowNsReorderCntHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p ApiPairFlowNsReorderCntParams
+	var pc core.ApiCntParams
+	tctx := ctx.(*core.CThreadCtx)
+
+	pairNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	err1 := tctx.UnmarshalValidate(*params, &p)
+	if err1 != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err1.Error(),
+		}
+	}
+
+	f, ok := pairNs.flows[pairFlowKey{src: p.Src, dst: p.Dst}]
+	if !ok {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: fmt.Sprintf("flow %v->%v does not exist", p.Src, p.Dst),
+		}
+	}
+	return f.cdbv.GeneralCounters(nil, tctx, params, &pc)
+}
+
+func init() {
+
+	/* register of plugins callbacks for ns,c level  */
+	core.PluginRegister(PAIRFLOW_PLUG,
+		core.PluginRegisterData{Client: PluginPairFlowCReg{},
+			Ns:     PluginPairFlowNsReg{},
+			Thread: nil}) /* no need for thread context for now */
+
+	/* The format of the RPC commands xxx_yy_zz_aa
+
+	  xxx - the plugin name
+
+	  yy  - ns - namespace
+			c  - client
+			t   -thread
+
+	  zz  - cmd  command like ping etc
+			set  set configuration
+			get  get configuration/counters
+
+	  aa - misc
+	*/
+
+	core.RegisterCB("pairflow_ns_cnt", ApiPairFlowNsCntHandler{}, false)
+	core.RegisterCB("pairflow_ns_add", ApiPairFlowNsAddHandler{}, false)
+	core.RegisterCB("pairflow_ns_remove", ApiPairFlowNsRemoveHandler{}, false)
+	core.RegisterCB("pairflow_ns_get", ApiPairFlowNsGetHandler{}, false)
+	core.RegisterCB("pairflow_ns_set_rate_check", ApiPairFlowNsSetRateCheckHandler{}, false)
+	core.RegisterCB("pairflow_ns_get_rate", ApiPairFlowNsGetRateHandler{}, false)
+	core.RegisterCB("pairflow_ns_get_reorder", ApiPairFlowNsGetReorderHandler{}, false)
+	core.RegisterCB("pairflow_ns_reorder_cnt", ApiPairFlowNsReorderCntHandler{}, false)
+}
+
+func Register(ctx *core.CThreadCtx) {
+}
@@ -0,0 +1,436 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package pairflow
+
+import (
+	"emu/core"
+	"emu/plugins/transport"
+	"encoding/binary"
+	"flag"
+	"testing"
+	"time"
+)
+
+var monitor int
+
+type PairFlowTestBase struct {
+	testname     string
+	monitor      bool
+	capture      bool
+	duration     time.Duration
+	clientsToSim int
+	cb           PairFlowTestCb
+	cbArg1       interface{}
+	cbArg2       interface{}
+}
+
+type PairFlowTestCb func(tctx *core.CThreadCtx, test *PairFlowTestBase) int
+
+func (o *PairFlowTestBase) Run(t *testing.T) {
+
+	var simVeth VethPairFlowSim
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, o.clientsToSim)
+	if o.cb != nil {
+		o.cb(tctx, o)
+	}
+	m := false
+	if monitor > 0 {
+		m = true
+	}
+	tctx.Veth.SetDebug(m, o.capture)
+	tctx.MainLoopSim(o.duration)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+
+	ns := tctx.GetNs(&key)
+	if ns == nil {
+		t.Fatalf(" can't find ns")
+		return
+	}
+	nsplg := ns.PluginCtx.Get(PAIRFLOW_PLUG)
+	if nsplg == nil {
+		t.Fatalf(" can't find plugin")
+	}
+	pairPlug := nsplg.Ext.(*PluginPairFlowNs)
+	pairPlug.cdb.Dump()
+	tctx.SimRecordAppend(pairPlug.cdb.MarshalValues(false))
+	tctx.SimRecordCompare(o.testname, t)
+}
+
+func createSimulationEnv(simRx *core.VethIFSim, num int) (*core.CThreadCtx, *core.CClient) {
+	tctx := core.NewThreadCtx(0, 4510, true, simRx)
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := core.NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	for j := 0; j < num; j++ {
+		client := core.NewClient(ns, core.MACKey{0, 0, 1, 0, 0, uint8(j)},
+			core.Ipv4Key{16, 0, 0, uint8(j + 1)},
+			core.Ipv6Key{},
+			core.Ipv4Key{16, 0, 0, 100})
+		client.ForceDGW = true
+		client.Ipv4ForcedgMac = core.MACKey{0, 0, 2, 0, 0, 0}
+		ns.AddClient(client)
+		client.PluginCtx.CreatePlugins([]string{PAIRFLOW_PLUG}, [][]byte{})
+	}
+	return tctx, nil
+}
+
+type VethPairFlowSim struct {
+}
+
+func (o *VethPairFlowSim) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
+	m.FreeMbuf()
+	return nil
+}
+
+// VethPairFlowLoop loops the packets back, or drops them
+type VethPairFlowLoop struct {
+	drop bool
+}
+
+func (o *VethPairFlowLoop) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
+	if o.drop {
+		m.FreeMbuf()
+		return nil
+	}
+	return m
+}
+
+type PairFlowRpcCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	test  *PairFlowTestBase
+	cnt   uint32
+}
+
+func (o *PairFlowRpcCtx) OnEvent(a, b interface{}) {
+	switch o.cnt {
+	case 0:
+		// direct flow 0->1 and a flow 1->2 that crosses the DUT
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,0], "dst": [0,0,1,0,0,1], "pps": 1, "size": 64 },
+			"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,1], "dst": [0,0,1,0,0,2], "pps": 1, "size": 128, "port": 7, "dut": true },
+			"id": 3 }`))
+		// error, already exists
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,0], "dst": [0,0,1,0,0,1] },
+			"id": 3 }`))
+	case 1:
+		// the destination got a new address, the flow should follow it
+		var key core.CTunnelKey
+		key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+		ns := o.tctx.GetNs(&key)
+		client := ns.CLookupByMac(&core.MACKey{0, 0, 1, 0, 0, 1})
+		client.UpdateIPv4(core.Ipv4Key{16, 0, 0, 50})
+	case 2:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_get",
+			"params": {"tun": {"vport":1,"tci":[1,2]} },
+			"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_remove",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,0], "dst": [0,0,1,0,0,1] },
+			"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_get",
+			"params": {"tun": {"vport":1,"tci":[1,2]} },
+			"id": 3 }`))
+	}
+	if o.cnt < 2 {
+		timerw := o.tctx.GetTimerCtx()
+		ticks := timerw.DurationToTicks(2 * time.Second)
+		timerw.StartTicks(&o.timer, ticks)
+	}
+	o.cnt++
+}
+
+func rpcQueue(tctx *core.CThreadCtx, test *PairFlowTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(500 * time.Millisecond)
+	var rpcctx PairFlowRpcCtx
+	rpcctx.timer.SetCB(&rpcctx, test.cbArg1, test.cbArg2)
+	rpcctx.tctx = tctx
+	rpcctx.test = test
+	timerw.StartTicks(&rpcctx.timer, ticks)
+	return 0
+}
+
+func TestPluginPairFlow1(t *testing.T) {
+	a := &PairFlowTestBase{
+		testname:     "pairflow1",
+		monitor:      false,
+		capture:      true,
+		duration:     6 * time.Second,
+		clientsToSim: 3,
+		cb:           rpcQueue,
+	}
+	a.Run(t)
+}
+
+type PairFlowFragRpcCtx struct {
+	tctx  *core.CThreadCtx
+	timer core.CHTimerObj
+	cnt   uint32
+}
+
+func (o *PairFlowFragRpcCtx) OnEvent(a, b interface{}) {
+	switch o.cnt {
+	case 0:
+		// 3 fragments of 1400 bytes, a flow of 2000 bytes is bigger than the default MTU and one that fits
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,0], "dst": [0,0,1,0,0,1], "pps": 1, "size": 3000, "max_pkt_size": 1400 },
+			"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,1], "dst": [0,0,1,0,0,2], "pps": 1, "size": 2000 },
+			"id": 3 }`))
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,2], "dst": [0,0,1,0,0,0], "pps": 1, "size": 2000, "max_pkt_size": 2000 },
+			"id": 3 }`))
+		// error, too small
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_add",
+			"params": {"tun": {"vport":1,"tci":[1,2]}, "src": [0,0,1,0,0,1], "dst": [0,0,1,0,0,0], "max_pkt_size": 40 },
+			"id": 3 }`))
+	case 1:
+		o.tctx.Veth.AppendSimuationRPC([]byte(`{"jsonrpc": "2.0",
+			"method":"pairflow_ns_get",
+			"params": {"tun": {"vport":1,"tci":[1,2]} },
+			"id": 3 }`))
+	}
+	if o.cnt < 1 {
+		timerw := o.tctx.GetTimerCtx()
+		ticks := timerw.DurationToTicks(2500 * time.Millisecond)
+		timerw.StartTicks(&o.timer, ticks)
+	}
+	o.cnt++
+}
+
+func rpcQueueFrag(tctx *core.CThreadCtx, test *PairFlowTestBase) int {
+	timerw := tctx.GetTimerCtx()
+	ticks := timerw.DurationToTicks(500 * time.Millisecond)
+	var rpcctx PairFlowFragRpcCtx
+	rpcctx.timer.SetCB(&rpcctx, test.cbArg1, test.cbArg2)
+	rpcctx.tctx = tctx
+	timerw.StartTicks(&rpcctx.timer, ticks)
+	return 0
+}
+
+func TestPluginPairFlow2(t *testing.T) {
+	a := &PairFlowTestBase{
+		testname:     "pairflow2",
+		monitor:      false,
+		capture:      true,
+		duration:     4 * time.Second,
+		clientsToSim: 3,
+		cb:           rpcQueueFrag,
+	}
+	a.Run(t)
+}
+
+func TestPluginPairFlowIpIdDf(t *testing.T) {
+	var simVeth VethPairFlowSim
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, 3)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	pairNs := tctx.GetNs(&key).PluginCtx.Get(PAIRFLOW_PLUG).Ext.(*PluginPairFlowNs)
+
+	mac := func(i uint8) core.MACKey { return core.MACKey{0, 0, 1, 0, 0, i} }
+	id := uint16(100)
+	add := func(p ApiPairFlowNsAddParams) *pairFlow {
+		p.Pps = 1
+		p.Port = defaultPairFlowPort
+		if err := pairNs.addFlow(&p); err != nil {
+			t.Fatalf(" add flow failed %v \n", err)
+		}
+		return pairNs.flows[pairFlowKey{src: p.Src, dst: p.Dst}]
+	}
+	ipId := func(p []byte, l3 uint16) uint16 { return binary.BigEndian.Uint16(p[l3+4 : l3+6]) }
+
+	inc := add(ApiPairFlowNsAddParams{Src: mac(0), Dst: mac(1), Size: 128, IpId: IP_ID_INC, IpIdValue: &id, Df: true})
+	drop := add(ApiPairFlowNsAddParams{Src: mac(1), Dst: mac(2), Size: 3000, Df: true})
+	fixed := add(ApiPairFlowNsAddParams{Src: mac(2), Dst: mac(0), Size: 3000, MaxPktSize: 1400, IpId: IP_ID_FIXED, IpIdValue: &id})
+	frag := add(ApiPairFlowNsAddParams{Src: mac(0), Dst: mac(2), Size: 3000, IpIdValue: &id})
+	single := add(ApiPairFlowNsAddParams{Src: mac(2), Dst: mac(1), Size: 128, IpIdValue: &id})
+
+	// two events of each flow, all the flows have the same rate
+	timerw := tctx.GetTimerCtx()
+	for i := uint32(0); i <= 2*inc.ticks; i++ {
+		timerw.HandleTicks()
+	}
+	if ipId(inc.pkt, inc.l3) != 100+uint16(2*inc.burst-1) || binary.BigEndian.Uint16(inc.pkt[inc.l3+6:inc.l3+8]) != 0x4000 {
+		t.Fatalf(" bad ip id or df of the incremented flow \n")
+	}
+	for _, frag := range fixed.frags {
+		if ipId(frag, fixed.l3) != 100 {
+			t.Fatalf(" fragments should have the fixed ip id \n")
+		}
+	}
+	// by default each fragmented packet has its own identification from the value
+	if ipId(frag.frags[0], frag.l3) != 100+uint16(2*frag.burst-1) || ipId(single.pkt, single.l3) != 100 {
+		t.Fatalf(" default ip id should start from the value \n")
+	}
+	s := &pairNs.stats
+	if s.pktTxIdInc != uint64(2*inc.burst) || s.pktTxIdFixed != uint64(2*fixed.burst) || s.pktTxIdRandom != 0 {
+		t.Fatalf(" bad ip id counters %+v \n", s)
+	}
+	if s.pktTxDfDrop != uint64(2*drop.burst) || drop.pkts != 0 || drop.segs != 0 || drop.getJson().DfDrops != s.pktTxDfDrop {
+		t.Fatalf(" packets with df bigger than the mtu should be dropped %+v \n", s)
+	}
+	if !drop.dfSent {
+		t.Fatalf(" df drop should be sent once for the template \n")
+	}
+}
+
+func TestPluginPairFlowRate(t *testing.T) {
+	var simVeth VethPairFlowLoop
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, 2)
+	defer tctx.Delete()
+	tctx.RegisterParserCb("transport")
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := tctx.GetNs(&key)
+	pairNs := ns.PluginCtx.Get(PAIRFLOW_PLUG).Ext.(*PluginPairFlowNs)
+	timerw := tctx.GetTimerCtx()
+	run := func(d time.Duration) {
+		for i := uint32(0); i < timerw.DurationToTicks(d); i++ {
+			timerw.HandleTicks()
+			tctx.Veth.SimulatorCheckRxQueue()
+		}
+	}
+
+	src, dst := core.MACKey{0, 0, 1, 0, 0, 0}, core.MACKey{0, 0, 1, 0, 0, 1}
+	ns.CLookupByMac(&dst).PluginCtx.CreatePlugins([]string{transport.TRANS_PLUG}, [][]byte{})
+	if err := pairNs.addFlow(&ApiPairFlowNsAddParams{Src: src, Dst: dst, Pps: 10, Size: 100}); err != nil {
+		t.Fatalf(" add flow failed %v \n", err)
+	}
+	pairNs.setRateCheck(&PairFlowRateCheck{Percent: 90, Window: 2})
+	run(2500 * time.Millisecond)
+	r := pairNs.getRates()[0]
+	if r.Shortfall || r.AchievedPps < 9 || r.Bps != 8000 || r.AchievedBps != r.AchievedPps*800 {
+		t.Fatalf(" flow should reach its rate %+v \n", r)
+	}
+
+	// the packets are sent but lost on the way
+	simVeth.drop = true
+	run(4 * time.Second)
+	r = pairNs.getRates()[0]
+	if !r.Shortfall || r.AchievedPps >= 9 || r.History[0].Time > ns.Timestamp() {
+		t.Fatalf(" flow should be flagged by the received rate %+v \n", r)
+	}
+	simVeth.drop = false
+	run(4 * time.Second)
+	if pairNs.getRates()[0].Shortfall || pairNs.stats.flowRecovered != 1 {
+		t.Fatalf(" flow should recover \n")
+	}
+
+	// the destination lost its address, nothing is sent
+	ns.CLookupByMac(&dst).UpdateIPv4(core.Ipv4Key{})
+	run(5 * time.Second)
+	r = pairNs.getRates()[0]
+	if !r.Shortfall || r.Shortfalls != 2 || r.History[len(r.History)-1].Percent != 0 || pairNs.stats.flowShortfall != 2 {
+		t.Fatalf(" flow should be flagged once %+v \n", r)
+	}
+
+	ns.CLookupByMac(&dst).UpdateIPv4(core.Ipv4Key{16, 0, 0, 2})
+	run(5 * time.Second)
+	r = pairNs.getRates()[0]
+	if r.Shortfall || r.Shortfalls != 2 || pairNs.stats.flowRecovered != 2 {
+		t.Fatalf(" flow should recover %+v \n", r)
+	}
+}
+
+// VethPairFlowSwap loops the packets back with each pair swapped
+type VethPairFlowSwap struct {
+	hold *core.Mbuf
+	late *core.Mbuf
+}
+
+func (o *VethPairFlowSwap) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
+	if o.late != nil {
+		r := o.late
+		o.late = nil
+		o.hold = m
+		return r
+	}
+	if o.hold != nil {
+		o.late = o.hold
+		o.hold = nil
+		return m
+	}
+	o.hold = m
+	return nil
+}
+
+func TestPluginPairFlowReorder(t *testing.T) {
+	var simVeth VethPairFlowSwap
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, 2)
+	defer tctx.Delete()
+	tctx.RegisterParserCb("transport")
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	ns := tctx.GetNs(&key)
+	pairNs := ns.PluginCtx.Get(PAIRFLOW_PLUG).Ext.(*PluginPairFlowNs)
+	src, dst := core.MACKey{0, 0, 1, 0, 0, 0}, core.MACKey{0, 0, 1, 0, 0, 1}
+	ns.CLookupByMac(&dst).PluginCtx.CreatePlugins([]string{transport.TRANS_PLUG}, [][]byte{})
+
+	if err := pairNs.addFlow(&ApiPairFlowNsAddParams{Src: src, Dst: dst, Pps: 100, Size: 100, Port: defaultPairFlowPort,
+		ReorderWindow: 100}); err == nil {
+		t.Fatalf(" reorder window should be a power of 2 \n")
+	}
+	if err := pairNs.addFlow(&ApiPairFlowNsAddParams{Src: src, Dst: dst, Pps: 100, Size: 100, Port: defaultPairFlowPort,
+		ReorderWindow: 16}); err != nil {
+		t.Fatalf(" add flow failed %v \n", err)
+	}
+	f := pairNs.flows[pairFlowKey{src: src, dst: dst}]
+	timerw := tctx.GetTimerCtx()
+	for i := uint32(0); i < timerw.DurationToTicks(time.Second); i++ {
+		timerw.HandleTicks()
+		tctx.Veth.SimulatorCheckRxQueue()
+	}
+
+	// 1,0,3,2.. the last one can be held by the veth
+	r := pairNs.getReorder()[0].Reorder
+	if f.pkts < 10 || f.rxPkts < f.pkts-1 || pairNs.stats.pktRx != f.rxPkts || r.RxPkts != f.rxPkts {
+		t.Fatalf(" the flow should be received %v %+v %+v \n", f.pkts, r, pairNs.stats)
+	}
+	if r.Window != 16 || r.Reordered != f.rxPkts/2 || r.InOrder != f.rxPkts-r.Reordered || r.Duplicated != 0 || r.Distances[0].Pkts != r.Reordered {
+		t.Fatalf(" each second packet should be reordered %+v \n", r)
+	}
+
+	// a packet without the magic is not accounted
+	pairNs.onRx(core.Ipv4Key{16, 0, 0, 1}, &f.rx.key, make([]byte, pairFlowHdrSize))
+	if pairNs.stats.pktRxErrInvalid != 1 || f.seqRx.GetInfo().RxPkts != r.RxPkts {
+		t.Fatalf(" invalid packet should be dropped %+v \n", pairNs.stats)
+	}
+
+	// the last flow closes the receiver
+	if err := pairNs.removeFlow(src, dst); err != nil || len(pairNs.rx) != 0 {
+		t.Fatalf(" receiver should be closed %v \n", err)
+	}
+}
+
+func init() {
+	flag.IntVar(&monitor, "monitor", 0, "monitor")
+}
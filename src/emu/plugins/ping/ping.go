@@ -175,10 +175,12 @@ type Ping struct {
 	params             PingParams          // Params received through the JSON-RPC
 	cdb                *core.CCounterDb    // Counter Database for Stats
 	cdbv               *core.CCounterDbVec // Database Vector
+	corr               *core.CCorrelator   // outstanding Echo Requests by sequence number
 	tctx               *core.CThreadCtx    // thread context
 	ns                 *core.CNSCtx        // namespace context
 	pingClient         PingClientIF        // an interface that the ping client must implement either it is ICMPv4 or ICMPv6
 	pingPkt            []byte              // the ping packet that will be sent
+	rebuildPkt         bool                // pingPkt is prepared again before the next send
 }
 
 // NewPing creates a new Ping instance and returns a pointer to it.
@@ -202,7 +204,9 @@ func NewPing(params PingParams, ns *core.CNSCtx, pingClient PingClientIF) *Ping
 	o.cdbv = core.NewCCounterDbVec("icmp_ping_stats")
 	o.cdbv.Add(o.cdb)
 	o.timer.SetCB(o, 0, 0)
-	o.timerw = o.tctx.GetTimerCtx()
+	o.timerw = o.ns.GetTimerCtx()
+	o.corr = core.NewCorrelator(o.timerw, "icmp_ping_correlator")
+	o.cdbv.Add(o.corr.Cdb)
 	dTime := time.Duration(float32(time.Second) / params.Pace)
 	o.ticksPerInterval, o.pktsPerInterval = o.timerw.DurationToTicksBurst(dTime)
 	o.icmpHeaderOffset, o.pingPkt = o.pingClient.PreparePingPacketTemplate(o.identifier, o.sequenceNumber, o.magic)
@@ -215,11 +219,18 @@ func (o *Ping) StartPinging() {
 	o.timerw.StartTicks(&o.timer, o.ticksPerInterval)
 }
 
+// UpdatePacketTemplate should be called when the next-hop toward the destination might have changed,
+// the template is prepared again before the next Echo Request.
+func (o *Ping) UpdatePacketTemplate() {
+	o.rebuildPkt = true
+}
+
 // OnRemove should be called when Ping has finished or it is stopped.
 func (o *Ping) OnRemove() {
 	if o.timer.IsRunning() {
 		o.timerw.Stop(&o.timer)
 	}
+	o.corr.OnRemove()
 	o.pingClient.OnPingRemove()
 }
 
@@ -268,6 +279,10 @@ func (o *Ping) HandleEchoReply(seq, id uint16, payload []byte) {
 		o.stats.repliesBadLatency++
 		return
 	}
+	if _, ok := o.corr.Match(uint64(seq)); !ok {
+		// late or duplicate reply, counted by the correlator
+		return
+	}
 	if !o.firstReplyReceived {
 		// This is the first Response
 		if seq == o.startingSeq {
@@ -315,6 +330,10 @@ func (o *Ping) GetPingCounters(params *fastjson.RawMessage) (interface{}, *jsonr
 // sendPing calculates how many packets to send (in case of burts), updates counters of ICMPQueries,
 // and calls the PingClientIF.SendPing which should send the updated packets.
 func (o *Ping) sendPing() {
+	if o.rebuildPkt {
+		o.rebuildPkt = false
+		o.icmpHeaderOffset, o.pingPkt = o.pingClient.PreparePingPacketTemplate(o.identifier, o.sequenceNumber, o.magic)
+	}
 	pktsToSend := MinUint32(o.pktsPerInterval, o.params.Amount-o.sentRequests)
 	o.sentRequests += pktsToSend
 	o.pingClient.UpdateTxIcmpQuery(uint64(pktsToSend))
@@ -329,6 +348,7 @@ func (o *Ping) sendPing() {
 		oldSequence := icmpHeader.GetSequenceNumber()
 		icmpHeader.SetSequenceNumber(o.sequenceNumber)
 		icmpHeader.UpdateChecksum2(oldSequence, o.sequenceNumber)
+		o.corr.Register(uint64(o.sequenceNumber), DefaultPingTimeout*time.Second, nil, nil)
 		o.sequenceNumber++
 		oldTimestamp := icmpHeader.GetTimestamp()
 		icmpHeader.SetTimestamp(uint64(timestamp)) // Put a timestamp in the payload to be able to calculate latency.
@@ -0,0 +1,618 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package profile
+
+/* Behavior profile of a client
+
+The control plane load of a real population is a mix of protocols, each host refreshes its ARP
+entries, resolves names, renews its lease, joins and leaves a few groups and pings in the background.
+The profile of a client generates this mix by the plugins of the client, each protocol at its own
+rate in events per minute. The events of a protocol are a Poisson process, the time to the next event
+is exponential with the mean of the rate, from the RNG of the client that is seeded by the MAC of the
+client (or by the seed of the profile) so a run is repeatable.
+
+arp   an ARP query of the default gateway (arp plugin)
+dns   an A query of one of the names to the resolver of the client, see ctx_client_set_dns (transport)
+dhcp  a renew of the lease before T1, the lease is renewed at T1 anyway (dhcp plugin, bound)
+igmp  a join of one of the groups, or a leave in case the profile joined it (igmp plugin)
+ping  an echo request to ping_dst, the default gateway by default (icmp plugin, not pinging)
+
+An event that the client can't do (no plugin, not bound, no resolver etc.) is skipped. The achieved
+rate of each protocol is reported against the configured rate per client (profile_c_get_rates) and
+for all the clients of the namespace (profile_ns_get_rates).
+
+*/
+
+import (
+	"emu/core"
+	"emu/plugins/arp"
+	dhcp "emu/plugins/dhcpv4"
+	"emu/plugins/icmp"
+	"emu/plugins/igmp"
+	"emu/plugins/ping"
+	"emu/plugins/transport"
+	"encoding/binary"
+	"external/google/gopacket/layers"
+	"external/osamingo/jsonrpc"
+	"math/rand"
+	"time"
+
+	"github.com/intel-go/fastjson"
+)
+
+const (
+	PROFILE_PLUG = "profile"
+
+	PROFILE_ARP  = "arp"
+	PROFILE_DNS  = "dns"
+	PROFILE_DHCP = "dhcp"
+	PROFILE_IGMP = "igmp"
+	PROFILE_PING = "ping"
+
+	defaultArpPerMin  = 1
+	defaultDnsPerMin  = 4
+	defaultIgmpPerMin = 1
+	defaultPingPerMin = 1
+	defaultDnsName    = "www.example.com"
+)
+
+const (
+	profileArp = iota
+	profileDns
+	profileDhcp
+	profileIgmp
+	profilePing
+	profileProtos
+)
+
+var profileProtoNames = [profileProtos]string{PROFILE_ARP, PROFILE_DNS, PROFILE_DHCP, PROFILE_IGMP, PROFILE_PING}
+
+type ProfileNsStats struct {
+	invalidInit uint64 /* client init json is not valid, the default profile is used */
+	arpEvent    uint64 /* arp queries */
+	arpSkip     uint64 /* arp events without the plugin or a default gateway */
+	dnsEvent    uint64 /* dns queries */
+	dnsSkip     uint64 /* dns events without a resolver or a resolved default gateway */
+	dnsRxReply  uint64 /* replies to the dns queries */
+	dhcpEvent   uint64 /* lease renewals */
+	dhcpSkip    uint64 /* dhcp events without the plugin or a lease */
+	igmpEvent   uint64 /* joins and leaves */
+	igmpSkip    uint64 /* igmp events without the plugin or groups */
+	igmpJoin    uint64 /* joins */
+	igmpLeave   uint64 /* leaves */
+	pingEvent   uint64 /* pings */
+	pingSkip    uint64 /* ping events without the plugin, a destination or while pinging */
+}
+
+func NewProfileNsStatsDb(o *ProfileNsStats) *core.CCounterDb {
+	db := core.NewCCounterDb("profile")
+	db.Add(&core.CCounterRec{
+		Counter:  &o.invalidInit,
+		Name:     "invalidInit",
+		Help:     "invalid client init json",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScERROR})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.arpEvent,
+		Name:     "arpEvent",
+		Help:     "arp queries",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.arpSkip,
+		Name:     "arpSkip",
+		Help:     "arp events skipped",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dnsEvent,
+		Name:     "dnsEvent",
+		Help:     "dns queries",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dnsSkip,
+		Name:     "dnsSkip",
+		Help:     "dns events skipped",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dnsRxReply,
+		Name:     "dnsRxReply",
+		Help:     "dns replies",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dhcpEvent,
+		Name:     "dhcpEvent",
+		Help:     "dhcp lease renewals",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dhcpSkip,
+		Name:     "dhcpSkip",
+		Help:     "dhcp events skipped",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.igmpEvent,
+		Name:     "igmpEvent",
+		Help:     "igmp joins and leaves",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.igmpSkip,
+		Name:     "igmpSkip",
+		Help:     "igmp events skipped",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.igmpJoin,
+		Name:     "igmpJoin",
+		Help:     "igmp joins",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.igmpLeave,
+		Name:     "igmpLeave",
+		Help:     "igmp leaves",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pingEvent,
+		Name:     "pingEvent",
+		Help:     "pings",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	db.Add(&core.CCounterRec{
+		Counter:  &o.pingSkip,
+		Name:     "pingSkip",
+		Help:     "ping events skipped",
+		Unit:     "ops",
+		DumpZero: false,
+		Info:     core.ScINFO})
+	return db
+}
+
+// ProfileInit the profile of a client, the rates are events per minute, zero disables the protocol
+type ProfileInit struct {
+	ArpPerMin  float64        `json:"arp_per_min" validate:"gte=0,lte=600"`
+	DnsPerMin  float64        `json:"dns_per_min" validate:"gte=0,lte=600"`
+	DhcpPerMin float64        `json:"dhcp_per_min" validate:"gte=0,lte=600"`
+	IgmpPerMin float64        `json:"igmp_per_min" validate:"gte=0,lte=600"`
+	PingPerMin float64        `json:"ping_per_min" validate:"gte=0,lte=600"`
+	Groups     []core.Ipv4Key `json:"groups"`   // joined and left by the igmp events
+	Names      []string       `json:"names"`    // resolved by the dns events
+	PingDst    core.Ipv4Key   `json:"ping_dst"` // zero is the default gateway
+	Seed       int64          `json:"seed"`     // zero is the MAC of the client
+}
+
+// ProfileRateJson the configured and the achieved rate of a protocol
+type ProfileRateJson struct {
+	Proto          string  `json:"proto"`
+	PerMin         float64 `json:"per_min"`
+	AchievedPerMin float64 `json:"achieved_per_min"` // since the start of the profile
+	Events         uint64  `json:"events"`
+	Skipped        uint64  `json:"skipped"`
+}
+
+// ProfileClientRatesJson the rates of the profile of a client
+type ProfileClientRatesJson struct {
+	Mac        core.MACKey       `json:"mac"`
+	Time       float64           `json:"time"` // sec, since the start of the profile
+	Rates      []ProfileRateJson `json:"rates"`
+	DnsReplies uint64            `json:"dns_replies"`
+}
+
+// profileEvent the events of one protocol of a client
+type profileEvent struct {
+	proto   int
+	perMin  float64
+	plug    *PluginProfileClient
+	timer   core.CHTimerObj
+	events  uint64
+	skipped uint64
+}
+
+func (o *profileEvent) OnEvent(a, b interface{}) {
+	o.plug.onEvent(o)
+}
+
+// PluginProfileClient the profile of a client
+type PluginProfileClient struct {
+	core.PluginBase
+	profNsPlug *PluginProfileNs
+	cfg        ProfileInit
+	timerw     *core.TimerCtx
+	rnd        *rand.Rand
+	start      float64 // sec
+	events     [profileProtos]profileEvent
+	joined     map[core.Ipv4Key]bool
+	trans      *transport.TransportCtx
+	socket     transport.SocketApi
+	dnsId      uint16
+	dnsReplies uint64
+}
+
+var profileEvents = []string{}
+
+func NewProfileClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	o := new(PluginProfileClient)
+	o.InitPluginBase(ctx, o)
+	o.RegisterEvents(ctx, profileEvents, o)
+	nsplg := o.Ns.PluginCtx.GetOrCreate(PROFILE_PLUG)
+	o.profNsPlug = nsplg.Ext.(*PluginProfileNs)
+	o.cfg = defaultProfile()
+	if len(initJson) > 0 && ctx.Tctx.UnmarshalValidate(initJson, &o.cfg) != nil {
+		o.profNsPlug.stats.invalidInit++
+		o.cfg = defaultProfile()
+	}
+	if len(o.cfg.Names) == 0 {
+		o.cfg.Names = []string{defaultDnsName}
+	}
+	seed := o.cfg.Seed
+	if seed == 0 {
+		seed = int64(binary.BigEndian.Uint64(append([]byte{0, 0}, o.Client.Mac[:]...)))
+	}
+	o.rnd = rand.New(rand.NewSource(seed))
+	o.joined = make(map[core.Ipv4Key]bool)
+	o.timerw = ctx.Ns.GetTimerCtx()
+	o.start = o.timerw.TicksInSec()
+	rates := [profileProtos]float64{o.cfg.ArpPerMin, o.cfg.DnsPerMin, o.cfg.DhcpPerMin, o.cfg.IgmpPerMin, o.cfg.PingPerMin}
+	for i := range o.events {
+		e := &o.events[i]
+		e.proto = i
+		e.perMin = rates[i]
+		e.plug = o
+		e.timer.SetCB(e, 0, 0)
+		o.schedule(e)
+	}
+	o.profNsPlug.vec = append(o.profNsPlug.vec, o)
+	return &o.PluginBase
+}
+
+func defaultProfile() ProfileInit {
+	return ProfileInit{ArpPerMin: defaultArpPerMin, DnsPerMin: defaultDnsPerMin,
+		IgmpPerMin: defaultIgmpPerMin, PingPerMin: defaultPingPerMin}
+}
+
+func (o *PluginProfileClient) OnEvent(msg string, a, b interface{}) {
+}
+
+func (o *PluginProfileClient) OnRemove(ctx *core.PluginCtx) {
+	ctx.UnregisterEvents(&o.PluginBase, profileEvents)
+	for i := range o.events {
+		if o.events[i].timer.IsRunning() {
+			o.timerw.Stop(&o.events[i].timer)
+		}
+	}
+	if o.socket != nil {
+		o.socket.Close()
+		o.socket = nil
+	}
+	vec := o.profNsPlug.vec
+	for i, c := range vec {
+		if c == o {
+			o.profNsPlug.vec = append(vec[:i], vec[i+1:]...)
+			break
+		}
+	}
+}
+
+// schedule starts the timer of the next event, the time to it is exponential with the mean of the rate
+func (o *PluginProfileClient) schedule(e *profileEvent) {
+	if e.perMin == 0 {
+		return
+	}
+	d := time.Duration(o.rnd.ExpFloat64() * 60 / e.perMin * float64(time.Second))
+	ticks := o.timerw.DurationToTicks(d)
+	if ticks == 0 {
+		ticks = 1
+	}
+	o.timerw.StartTicks(&e.timer, ticks)
+}
+
+func (o *PluginProfileClient) onEvent(e *profileEvent) {
+	ok := false
+	if !o.Ns.SuppressTx() {
+		switch e.proto {
+		case profileArp:
+			ok = o.arpQuery()
+		case profileDns:
+			ok = o.dnsQuery()
+		case profileDhcp:
+			ok = o.dhcpRenew()
+		case profileIgmp:
+			ok = o.igmpJoinLeave()
+		case profilePing:
+			ok = o.startPing()
+		}
+	}
+	if ok {
+		e.events++
+		*o.profNsPlug.eventCnt[e.proto]++
+	} else {
+		e.skipped++
+		*o.profNsPlug.skipCnt[e.proto]++
+	}
+	o.schedule(e)
+}
+
+func (o *PluginProfileClient) arpQuery() bool {
+	plug := o.Client.PluginCtx.Get(arp.ARP_PLUG)
+	if plug == nil || o.Client.DgIpv4.IsZero() {
+		return false
+	}
+	plug.Ext.(*arp.PluginArpClient).SendQuery()
+	return true
+}
+
+// dnsQuery sends a query from a new socket like a stub resolver, the socket of the previous query
+// is closed
+func (o *PluginProfileClient) dnsQuery() bool {
+	if o.socket != nil {
+		o.socket.Close()
+		o.socket = nil
+	}
+	if o.trans == nil {
+		o.trans = transport.GetTransportCtx(o.Client)
+	}
+	s, err := o.trans.Dial("udp", core.DNS_RESOLVER_HOST+":53", o, nil)
+	if err != nil {
+		return false
+	}
+	o.socket = s
+	o.dnsId = uint16(o.rnd.Intn(0x10000))
+	name := o.cfg.Names[o.rnd.Intn(len(o.cfg.Names))]
+	q := core.PacketUtlBuild(&layers.DNS{ID: o.dnsId, RD: true, QDCount: 1,
+		Questions: []layers.DNSQuestion{{Name: []byte(name), Type: layers.DNSTypeA, Class: layers.DNSClassIN}}})
+	r, _ := s.Write(q)
+	return r == transport.SeOK
+}
+
+func (o *PluginProfileClient) dhcpRenew() bool {
+	plug := o.Client.PluginCtx.Get(dhcp.DHCP_PLUG)
+	if plug == nil {
+		return false
+	}
+	return plug.Ext.(*dhcp.PluginDhcpClient).Renew()
+}
+
+// igmpJoinLeave joins a random group, or leaves it in case the profile joined it
+func (o *PluginProfileClient) igmpJoinLeave() bool {
+	plug := o.Client.PluginCtx.Get(igmp.IGMP_PLUG)
+	if plug == nil || len(o.cfg.Groups) == 0 {
+		return false
+	}
+	igmpPlug := plug.Ext.(*igmp.PluginIgmpClient)
+	g := o.cfg.Groups[o.rnd.Intn(len(o.cfg.Groups))]
+	if o.joined[g] {
+		if igmpPlug.Leave([]core.Ipv4Key{g}) != nil {
+			return false
+		}
+		delete(o.joined, g)
+		o.profNsPlug.stats.igmpLeave++
+		return true
+	}
+	if igmpPlug.Join([]core.Ipv4Key{g}) != nil {
+		return false
+	}
+	o.joined[g] = true
+	o.profNsPlug.stats.igmpJoin++
+	return true
+}
+
+func (o *PluginProfileClient) startPing() bool {
+	plug := o.Client.PluginCtx.Get(icmp.ICMP_PLUG)
+	dst := o.cfg.PingDst
+	if dst.IsZero() {
+		dst = o.Client.DgIpv4
+	}
+	if plug == nil || dst.IsZero() {
+		return false
+	}
+	return plug.Ext.(*icmp.PluginIcmpClient).StartPing(&icmp.ApiIcmpClientStartPingHandler{Amount: 1,
+		Pace: ping.DefaultPingPace, Dst: dst, Timeout: ping.DefaultPingTimeout, PayloadSize: ping.DefaultPingPayloadSize})
+}
+
+// OnRxEvent function to complete the ISocketCb interface.
+func (o *PluginProfileClient) OnRxEvent(event transport.SocketEventType) {
+}
+
+// OnRxData counts the reply to the last query
+func (o *PluginProfileClient) OnRxData(d []byte) {
+	if len(d) >= 12 && binary.BigEndian.Uint16(d[0:2]) == o.dnsId && d[2]&0x80 != 0 {
+		o.dnsReplies++
+		o.profNsPlug.stats.dnsRxReply++
+	}
+}
+
+// OnTxEvent function to complete the ISocketCb interface.
+func (o *PluginProfileClient) OnTxEvent(event transport.SocketEventType) {
+}
+
+// getRates returns the configured and the achieved rate of each protocol
+func (o *PluginProfileClient) getRates() *ProfileClientRatesJson {
+	res := &ProfileClientRatesJson{Mac: o.Client.Mac, DnsReplies: o.dnsReplies}
+	res.Time = o.timerw.TicksInSec() - o.start
+	for i := range o.events {
+		e := &o.events[i]
+		r := ProfileRateJson{Proto: profileProtoNames[i], PerMin: e.perMin, Events: e.events, Skipped: e.skipped}
+		if res.Time > 0 {
+			r.AchievedPerMin = float64(e.events) * 60 / res.Time
+		}
+		res.Rates = append(res.Rates, r)
+	}
+	return res
+}
+
+// PluginProfileNs the profiles of the clients of a namespace
+type PluginProfileNs struct {
+	core.PluginBase
+	vec      []*PluginProfileClient // keep the add order
+	stats    ProfileNsStats
+	eventCnt [profileProtos]*uint64
+	skipCnt  [profileProtos]*uint64
+	cdb      *core.CCounterDb
+	cdbv     *core.CCounterDbVec
+}
+
+func NewProfileNs(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	o := new(PluginProfileNs)
+	o.InitPluginBase(ctx, o)
+	o.RegisterEvents(ctx, []string{}, o)
+	s := &o.stats
+	o.eventCnt = [profileProtos]*uint64{&s.arpEvent, &s.dnsEvent, &s.dhcpEvent, &s.igmpEvent, &s.pingEvent}
+	o.skipCnt = [profileProtos]*uint64{&s.arpSkip, &s.dnsSkip, &s.dhcpSkip, &s.igmpSkip, &s.pingSkip}
+	o.cdb = NewProfileNsStatsDb(&o.stats)
+	o.cdbv = core.NewCCounterDbVec("profile")
+	o.cdbv.Add(o.cdb)
+	return &o.PluginBase
+}
+
+// GetCounterDbVec implements core.IPluginCounters
+func (o *PluginProfileNs) GetCounterDbVec() *core.CCounterDbVec {
+	return o.cdbv
+}
+
+func (o *PluginProfileNs) OnRemove(ctx *core.PluginCtx) {
+}
+
+func (o *PluginProfileNs) OnEvent(msg string, a, b interface{}) {
+}
+
+// getRates returns the aggregate rate of each protocol of all the clients, the sum of their rates
+func (o *PluginProfileNs) getRates() []ProfileRateJson {
+	res := make([]ProfileRateJson, profileProtos)
+	for i := range res {
+		res[i].Proto = profileProtoNames[i]
+	}
+	for _, c := range o.vec {
+		for i, r := range c.getRates().Rates {
+			res[i].PerMin += r.PerMin
+			res[i].AchievedPerMin += r.AchievedPerMin
+			res[i].Events += r.Events
+			res[i].Skipped += r.Skipped
+		}
+	}
+	return res
+}
+
+type PluginProfileCReg struct{}
+type PluginProfileNsReg struct{}
+
+func (o PluginProfileCReg) NewPlugin(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	return NewProfileClient(ctx, initJson)
+}
+
+func (o PluginProfileNsReg) NewPlugin(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
+	return NewProfileNs(ctx, initJson)
+}
+
+/*******************************************/
+/* profile RPC commands */
+type (
+	ApiProfileNsCntHandler struct{}
+
+	ApiProfileNsGetRatesHandler struct{}
+	ApiProfileNsGetRatesResult  struct {
+		Clients uint32            `json:"clients"`
+		Rates   []ProfileRateJson `json:"rates"`
+	}
+
+	ApiProfileClientGetRatesHandler struct{}
+)
+
+func getNsPlugin(ctx interface{}, params *fastjson.RawMessage) (*PluginProfileNs, error) {
+	tctx := ctx.(*core.CThreadCtx)
+	nsPlug, err := tctx.GetNsPlugin(params, PROFILE_PLUG)
+	if err != nil {
+		return nil, err
+	}
+	return nsPlug.Ext.(*PluginProfileNs), nil
+}
+
+func getClientPlugin(ctx interface{}, params *fastjson.RawMessage) (*PluginProfileClient, error) {
+	tctx := ctx.(*core.CThreadCtx)
+	plug, err := tctx.GetClientPlugin(params, PROFILE_PLUG)
+	if err != nil {
+		return nil, err
+	}
+	return plug.Ext.(*PluginProfileClient), nil
+}
+
+func (h ApiProfileNsCntHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var p core.ApiCntParams
+	tctx := ctx.(*core.CThreadCtx)
+	c, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return c.cdbv.GeneralCounters(err, tctx, params, &p)
+}
+
+func (h ApiProfileNsGetRatesHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	var res ApiProfileNsGetRatesResult
+
+	profNs, err := getNsPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	res.Clients = uint32(len(profNs.vec))
+	res.Rates = profNs.getRates()
+	return &res, nil
+}
+
+func (h ApiProfileClientGetRatesHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+
+	profClient, err := getClientPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return profClient.getRates(), nil
+}
+
+func init() {
+
+	/* register of plugins callbacks for ns,c level  */
+	core.PluginRegister(PROFILE_PLUG,
+		core.PluginRegisterData{Client: PluginProfileCReg{},
+			Ns:     PluginProfileNsReg{},
+			Thread: nil}) /* no need for thread context for now */
+
+	core.RegisterCB("profile_ns_cnt", ApiProfileNsCntHandler{}, false)
+	core.RegisterCB("profile_ns_get_rates", ApiProfileNsGetRatesHandler{}, false)
+	core.RegisterCB("profile_c_get_rates", ApiProfileClientGetRatesHandler{}, false)
+}
+
+func Register(ctx *core.CThreadCtx) {
+}
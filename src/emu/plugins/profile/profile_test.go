@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package profile
+
+import (
+	"emu/core"
+	"emu/plugins/igmp"
+	"testing"
+	"time"
+)
+
+type VethProfileSim struct {
+}
+
+func (o *VethProfileSim) ProcessTxToRx(m *core.Mbuf) *core.Mbuf {
+	m.FreeMbuf()
+	return nil
+}
+
+func TestPluginProfileRates(t *testing.T) {
+	var simVeth VethProfileSim
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx := core.NewThreadCtx(0, 4510, true, &simrx)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1})
+	ns := core.NewNSCtx(tctx, &key)
+	tctx.AddNs(&key, ns)
+	ns.PluginCtx.CreatePlugins([]string{igmp.IGMP_PLUG}, [][]byte{[]byte(`{"dmac" :[0, 0, 1, 0, 0, 1]  } `)})
+
+	cfg := []byte(`{"arp_per_min": 60, "dns_per_min": 0, "dhcp_per_min": 6, "igmp_per_min": 30, "ping_per_min": 0,
+		"groups": [[239, 1, 1, 1], [239, 1, 1, 2]], "seed": 7}`)
+	var clients []*PluginProfileClient
+	for j := 0; j < 2; j++ {
+		client := core.NewClient(ns, core.MACKey{0, 0, 1, 0, 0, uint8(j)},
+			core.Ipv4Key{16, 0, 0, uint8(j + 1)},
+			core.Ipv6Key{},
+			core.Ipv4Key{16, 0, 0, 100})
+		client.ForceDGW = true
+		client.Ipv4ForcedgMac = core.MACKey{0, 0, 2, 0, 0, 0}
+		ns.AddClient(client)
+		client.PluginCtx.CreatePlugins([]string{"arp", igmp.IGMP_PLUG, PROFILE_PLUG}, [][]byte{nil, nil, cfg})
+		clients = append(clients, client.PluginCtx.Get(PROFILE_PLUG).Ext.(*PluginProfileClient))
+	}
+	profNs := ns.PluginCtx.Get(PROFILE_PLUG).Ext.(*PluginProfileNs)
+
+	timerw := tctx.GetTimerCtx()
+	for i := uint32(0); i < timerw.DurationToTicks(4*time.Minute); i++ {
+		timerw.HandleTicks()
+	}
+
+	r := clients[0].getRates()
+	if r.Time < 239 || len(r.Rates) != profileProtos {
+		t.Fatalf(" bad rates %+v \n", r)
+	}
+	arpRate, dhcpRate, igmpRate := r.Rates[profileArp], r.Rates[profileDhcp], r.Rates[profileIgmp]
+	if arpRate.AchievedPerMin < 45 || arpRate.AchievedPerMin > 75 || arpRate.Skipped != 0 {
+		t.Fatalf(" arp should be close to its rate %+v \n", arpRate)
+	}
+	if igmpRate.AchievedPerMin < 20 || igmpRate.AchievedPerMin > 40 || igmpRate.Skipped != 0 {
+		t.Fatalf(" igmp should be close to its rate %+v \n", igmpRate)
+	}
+	// without the dhcp plugin the renewals are skipped
+	if dhcpRate.Events != 0 || dhcpRate.Skipped == 0 || r.Rates[profileDns].Skipped != 0 {
+		t.Fatalf(" bad dhcp or dns %+v \n", r.Rates)
+	}
+
+	// the same seed generates the same events
+	r1 := clients[1].getRates()
+	for i := range r.Rates {
+		if r.Rates[i] != r1.Rates[i] {
+			t.Fatalf(" clients with the same seed should have the same events %+v %+v \n", r.Rates[i], r1.Rates[i])
+		}
+	}
+
+	s := &profNs.stats
+	nsRates := profNs.getRates()
+	if nsRates[profileArp].PerMin != 120 || nsRates[profileArp].Events != 2*arpRate.Events ||
+		s.arpEvent != 2*arpRate.Events || s.igmpJoin+s.igmpLeave != s.igmpEvent || s.igmpJoin < s.igmpLeave {
+		t.Fatalf(" bad namespace rates %+v %+v \n", nsRates, s)
+	}
+
+	ns.RemoveClient(ns.CLookupByMac(&core.MACKey{0, 0, 1, 0, 0, 0}))
+	if len(profNs.vec) != 1 || profNs.getRates()[profileArp].PerMin != 60 {
+		t.Fatalf(" removed client should not be reported \n")
+	}
+}
@@ -7,6 +7,7 @@ package transport
 
 import (
 	"emu/core"
+	"encoding/binary"
 	"external/google/gopacket/layers"
 	"net"
 	"strconv"
@@ -17,6 +18,35 @@ func (o *baseSocket) init(client *core.CClient, ctx *TransportCtx) {
 	o.ns = client.Ns
 	o.tctx = o.ns.ThreadCtx
 	o.ctx = ctx
+	o.l4Checksum = ctx.l4_checksum
+}
+
+// updateL4Checksum fixes the tcp/udp checksum of a tx packet, csOffset is the offset of
+// the checksum field in the l4 header. returns false if the checksum was not computed
+func (o *baseSocket) updateL4Checksum(p []byte, csOffset uint16) bool {
+	l3 := o.l3Offset
+	l4 := o.l4Offset
+	switch o.l4Checksum {
+	case L4_CHECKSUM_ZERO:
+		binary.BigEndian.PutUint16(p[l4+csOffset:l4+csOffset+2], 0)
+		return false
+	case L4_CHECKSUM_STALE:
+		return false
+	}
+	if o.ipv6 == false {
+		ipv4 := layers.IPv4Header(p[l3 : l3+20])
+		binary.BigEndian.PutUint16(p[l4+csOffset:l4+csOffset+2], 0)
+		cs := layers.PktChecksumTcpUdp(p[l4:], 0, ipv4)
+		binary.BigEndian.PutUint16(p[l4+csOffset:l4+csOffset+2], cs)
+	} else {
+		ipv6 := layers.IPv6Header(p[l3 : l3+40])
+		if csOffset == 6 {
+			ipv6.FixUdpL4Checksum(p[l4:], 0)
+		} else {
+			ipv6.FixTcpL4Checksum(p[l4:], 0)
+		}
+	}
+	return true
 }
 
 func (o *baseSocket) setIoctlBase(m IoctlMap) error {
@@ -53,6 +83,17 @@ func (o *baseSocket) setIoctlBase(m IoctlMap) error {
 		}
 	}
 
+	val, prs = m[IP_IOCTL_L4_CHECKSUM]
+	if prs {
+		mode, ok := val.(int)
+		if ok {
+			if mode < L4_CHECKSUM_COMPUTE || mode > L4_CHECKSUM_STALE {
+				mode = L4_CHECKSUM_COMPUTE
+			}
+			o.l4Checksum = uint8(mode)
+		}
+	}
+
 	return nil
 }
 
@@ -67,6 +108,7 @@ func (o *baseSocket) getIoctlBase(m IoctlMap) error {
 		m[IP_IOCTL_TOS] = int(ipv4.GetTOS())
 		m[IP_IOCTL_TTL] = int(ipv4.GetTTL())
 	}
+	m[IP_IOCTL_L4_CHECKSUM] = int(o.l4Checksum)
 	return nil
 }
 
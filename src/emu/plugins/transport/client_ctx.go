@@ -12,6 +12,7 @@ import (
 	"external/google/gopacket/layers"
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 	"time"
 )
@@ -22,15 +23,19 @@ const (
 )
 
 type TransportCtxCfg struct {
-	TcpFastTickMsec *uint16 `json:"tcp_fasttick_msec" validate:"gte=20 &lte=100"`
-	Tcpkeepalive    *uint16 `json:"tcp_keepalive" validate:"gte=10 &lte=6500"`
-	TcpNoDelay      *uint8  `json:"tcp_no_delay" validate:"gte=0 &lte=4"`
-	TcpNoDelayCnt   *uint16 `json:"tcp_no_delay_counter" validate:"gte=0 &lte=65000"`
-	TcpInitWnd      *uint32 `json:"initwnd" validate:"gte=1 &lte=20"`
-	TcpRxBufSize    *uint32 `json:"rxbufsize" validate:"gte=8192 &lte=1048576"`
-	TcpTxBufSize    *uint32 `json:"txbufsize" validate:"gte=8192 &lte=1048576"`
-	TcpDorfc1323    *bool   `json:"do_rfc1323"`
-	TcpMss          *uint16 `json:"mss" validate:"gte=10 &lte=9000"`
+	TcpFastTickMsec *uint16  `json:"tcp_fasttick_msec" validate:"gte=20 &lte=100"`
+	Tcpkeepalive    *uint16  `json:"tcp_keepalive" validate:"gte=10 &lte=6500"`
+	TcpNoDelay      *uint8   `json:"tcp_no_delay" validate:"gte=0 &lte=4"`
+	TcpNoDelayCnt   *uint16  `json:"tcp_no_delay_counter" validate:"gte=0 &lte=65000"`
+	TcpInitWnd      *uint32  `json:"initwnd" validate:"gte=1 &lte=20"`
+	TcpRxBufSize    *uint32  `json:"rxbufsize" validate:"gte=8192 &lte=1048576"`
+	TcpTxBufSize    *uint32  `json:"txbufsize" validate:"gte=8192 &lte=1048576"`
+	TcpDorfc1323    *bool    `json:"do_rfc1323"`
+	TcpMss          *uint16  `json:"mss" validate:"gte=10 &lte=9000"`
+	TcpWscale       *uint8   `json:"wscale" validate:"gte=0 &lte=14"`     // window scale to request in the SYN, computed from rxbufsize by default
+	L4Checksum      *uint8   `json:"l4_checksum" validate:"gte=0 &lte=2"` // see L4_CHECKSUM_COMPUTE
+	TcpOpenPorts    []uint16 `json:"tcp_open_ports"`                      // accept on these ports without an application, see tcp_ports.go
+	TcpRstClosed    *bool    `json:"tcp_rst_closed"`                      // answer SYN to a closed port with RST
 }
 
 type prototbl map[uint8]IServerSocketCb // per protocol accept callback
@@ -194,6 +199,9 @@ type ftStats struct {
 	dial               uint64 // dial
 	dial_wrong_network uint64 // dial - wrong network
 	dial_wrong_addr    uint64 // dial - wrong addr
+	dial_nat64         uint64 // dial - ipv4 destination by the nat64 prefix
+	dial_resolver      uint64 // dial - the dns resolver of the client
+	dial_no_resolver   uint64 // dial - the client does not have a dns resolver
 }
 
 func newftStatsDb(o *ftStats) *core.CCounterDb {
@@ -295,6 +303,30 @@ func newftStatsDb(o *ftStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScERROR})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dial_nat64,
+		Name:     "dial_nat64",
+		Help:     "dial ipv4 destination by the nat64 prefix",
+		Unit:     "event",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dial_resolver,
+		Name:     "dial_resolver",
+		Help:     "dial the dns resolver of the client",
+		Unit:     "event",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.dial_no_resolver,
+		Name:     "dial_no_resolver",
+		Help:     "dial the resolver of a client without a dns resolver",
+		Unit:     "event",
+		DumpZero: false,
+		Info:     core.ScERROR})
+
 	db.Add(&core.CCounterRec{
 		Counter:  &o.src_port_alloc,
 		Name:     "src_port_alloc",
@@ -486,6 +518,9 @@ type TransportCtx struct {
 	tcp_maxidle          uint16 /* time to drop after starting probes */
 	tcp_maxpersistidle   uint16
 	tcp_fast_tick_msec   uint16
+	l4_checksum          uint8 /* default tx checksum mode of the sockets */
+	tcp_rst_closed       bool  /* answer SYN to a closed port with RST */
+	tcp_wscale           int16 /* window scale to request, negative to compute it from the rx buffer */
 
 	// flow table
 	flowTableStats ftStats
@@ -494,6 +529,30 @@ type TransportCtx struct {
 	ftv6           flowTablev6
 	srcPorts       srcPortManager
 	serverCb       serverft // server callbacks
+	portSink       portSinkServer
+
+	tcpNegotiated map[tcpNegotiatedKey]uint64 // established connections by mss/wscale
+}
+
+type tcpNegotiatedKey struct {
+	mss    uint16
+	wscale int8
+}
+
+// TcpNegotiatedRec the number of established connections with a segment size and window scale,
+// see transport_client_tcp_negotiated
+type TcpNegotiatedRec struct {
+	Mss    uint16 `json:"mss"`
+	Wscale int8   `json:"wscale"` // the window scale of the peer, -1 in case window scaling is not used
+	Cnt    uint64 `json:"cnt"`
+}
+
+// TransportFlowState a flow of the client, see ctx_get_state
+type TransportFlowState struct {
+	Proto  string `json:"proto"` // tcp or udp
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+	State  string `json:"state,omitempty"` // the state of a tcp flow
 }
 
 func updateInitwnd(mss uint16, initwnd uint16) uint16 {
@@ -511,7 +570,7 @@ func newCtx(c *core.CClient) *TransportCtx {
 	o.Client = c
 	o.Ns = c.Ns
 	o.Tctx = c.Ns.ThreadCtx
-	o.timerw = o.Tctx.GetTimerCtx()
+	o.timerw = c.Ns.GetTimerCtx()
 	o.cdbudp = NewUdpStatsDb(&o.udpStats)
 	o.cdbtcp = NewTcpStatsDb(&o.tcpStats)
 	o.cdbv = core.NewCCounterDbVec("tcp")
@@ -526,6 +585,7 @@ func newCtx(c *core.CClient) *TransportCtx {
 	o.ftv6 = make(flowTablev6)
 	o.srcPorts.init(o)
 	o.serverCb = make(serverft)
+	o.portSink.ctx = o
 	return o
 }
 
@@ -567,6 +627,73 @@ func (o *TransportCtx) setCfg(cfg *TransportCtxCfg) {
 		o.tcp_mssdflt_ = *cfg.TcpMss
 	}
 
+	if cfg.TcpWscale != nil {
+		o.tcp_wscale = int16(*cfg.TcpWscale)
+	}
+
+	if cfg.L4Checksum != nil {
+		o.l4_checksum = *cfg.L4Checksum
+	}
+
+	if cfg.TcpRstClosed != nil {
+		o.tcp_rst_closed = *cfg.TcpRstClosed
+	}
+
+	for _, port := range cfg.TcpOpenPorts {
+		o.addServerCb(port, TCP_PROTO, &o.portSink)
+	}
+
+}
+
+func (o *TransportCtx) countTcpNegotiated(mss uint16, wscale int8) {
+	if o.tcpNegotiated == nil {
+		o.tcpNegotiated = make(map[tcpNegotiatedKey]uint64)
+	}
+	o.tcpNegotiated[tcpNegotiatedKey{mss: mss, wscale: wscale}]++
+}
+
+// getTcpNegotiated returns the established connections by segment size and window scale
+func (o *TransportCtx) getTcpNegotiated() []TcpNegotiatedRec {
+	r := make([]TcpNegotiatedRec, 0, len(o.tcpNegotiated))
+	for k, v := range o.tcpNegotiated {
+		r = append(r, TcpNegotiatedRec{Mss: k.mss, Wscale: k.wscale, Cnt: v})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Mss != r[j].Mss {
+			return r[i].Mss < r[j].Mss
+		}
+		return r[i].Wscale < r[j].Wscale
+	})
+	return r
+}
+
+// getFlowsState returns the flows of the client sorted by protocol and addresses
+func (o *TransportCtx) getFlowsState() []TransportFlowState {
+	r := make([]TransportFlowState, 0, len(o.ftv4)+len(o.ftv6))
+	add := func(flow interface{}) {
+		s := flow.(SocketApi)
+		f := TransportFlowState{Proto: s.LocalAddr().Network(), Local: s.LocalAddr().String(), Remote: s.RemoteAddr().String()}
+		if tcp, ok := flow.(*TcpSocket); ok {
+			f.State = tcpstatename[tcp.state]
+		}
+		r = append(r, f)
+	}
+	for _, flow := range o.ftv4 {
+		add(flow)
+	}
+	for _, flow := range o.ftv6 {
+		add(flow)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Proto != r[j].Proto {
+			return r[i].Proto < r[j].Proto
+		}
+		if r[i].Local != r[j].Local {
+			return r[i].Local < r[j].Local
+		}
+		return r[i].Remote < r[j].Remote
+	})
+	return r
 }
 
 func (o *TransportCtx) getActiveFlows() uint64 {
@@ -678,6 +805,7 @@ func (o *TransportCtx) init() {
 	o.tcp_keepinit = TCPTV_KEEP_INIT
 	o.tcp_keepintvl = TCPTV_KEEPINTVL
 	o.tcp_mssdflt_ = TCP_MSS
+	o.tcp_wscale = -1
 	o.tcp_no_delay = 0
 	o.tcp_rx_socket_bsize = 32 * 1024
 	o.tcp_tx_socket_bsize = 32 * 1024
@@ -842,6 +970,7 @@ func (o *TransportCtx) handleRxTcpNewFlow(ps *core.ParserPacketState,
 		o.flowTableStats.ft_new_tcp_no_syn++
 		return -1
 	}
+	o.tcpStats.tcps_rcvsyn++
 
 	// register a callback?
 	dstport := tcp.GetDstPort()
@@ -849,6 +978,9 @@ func (o *TransportCtx) handleRxTcpNewFlow(ps *core.ParserPacketState,
 
 	if acceptCb == nil {
 		o.flowTableStats.ft_new_no_cb++
+		if o.tcp_rst_closed {
+			o.respondClosedPort(ps, ipv6, keyv4, keyv6)
+		}
 		return -1
 	}
 
@@ -970,6 +1102,7 @@ func (o *TransportCtx) handleRxPacket(ps *core.ParserPacketState) int {
 //	Dial("tcp", "192.0.2.1:80",cb,nil)
 //	Dial("tcp", "[2001:db8::1]:80",cb,nil)
 //	Dial("tcp", "[2001:db8::1]:80",cb,{"tos":12})
+//	Dial("udp", "resolver:53",cb,nil) the dns resolver of the client
 func (o *TransportCtx) Dial(network, address string, cb ISocketCb, ioctl IoctlMap) (SocketApi, error) {
 
 	o.flowTableStats.dial++
@@ -992,11 +1125,29 @@ func (o *TransportCtx) Dial(network, address string, cb ISocketCb, ioctl IoctlMa
 		return nil, err
 	}
 	port16 := uint16(value)
-	dst := net.ParseIP(host)
 	if cb == nil {
 		o.flowTableStats.dial_wrong_addr++
 		return nil, fmt.Errorf(" callback should not be nil ")
 	}
+	if host == core.DNS_RESOLVER_HOST {
+		resolver, err := o.Client.DnsResolver()
+		if err != nil {
+			o.flowTableStats.dial_no_resolver++
+			return nil, err
+		}
+		o.flowTableStats.dial_resolver++
+		host = resolver.String()
+	}
+	dst := net.ParseIP(host)
+	// an ipv6-only client with nat64 reaches an ipv4 destination by the synthesized address
+	if ipv4 := dst.To4(); ipv4 != nil {
+		var kipv4 core.Ipv4Key
+		toV4(ipv4, &kipv4)
+		if kipv6, ok := o.Client.Nat64Dst(kipv4); ok {
+			o.flowTableStats.dial_nat64++
+			dst = net.IP(kipv6[:])
+		}
+	}
 
 	switch network {
 	case "tcp":
@@ -57,6 +57,16 @@ func NewTransClient(ctx *core.PluginCtx, initJson []byte) *core.PluginBase {
 	o.ns = nsplg.Ext.(*PluginTransNs)
 
 	o.initJson = append(o.initJson, initJson...)
+
+	var cfg TransportCtxCfg
+	if len(initJson) > 0 && o.Tctx.UnmarshalValidate(initJson, &cfg) == nil {
+		if len(cfg.TcpOpenPorts) > 0 || cfg.TcpRstClosed != nil {
+			/* port posture without an application, the rx side needs the transport */
+			tc := newCtx(o.Client)
+			tc.setCfg(&cfg)
+			o.Client.SetTransportCtx(tc)
+		}
+	}
 	return &o.PluginBase
 }
 
@@ -64,6 +74,29 @@ func (o *PluginTransClient) OnEvent(msg string, a, b interface{}) {
 
 }
 
+// GetCounterDbVec implements core.IPluginCounters, nil in case there is no transport yet
+func (o *PluginTransClient) GetCounterDbVec() *core.CCounterDbVec {
+	tl := o.Client.GetTransportCtx()
+	if tl == nil {
+		return nil
+	}
+	return tl.(*TransportCtx).cdbv
+}
+
+// TransportClientState the state of the transport of a client, see ctx_get_state
+type TransportClientState struct {
+	Flows []TransportFlowState `json:"flows"`
+}
+
+// GetState implements core.IPluginState
+func (o *PluginTransClient) GetState() interface{} {
+	r := &TransportClientState{Flows: []TransportFlowState{}}
+	if tl := o.Client.GetTransportCtx(); tl != nil {
+		r.Flows = tl.(*TransportCtx).getFlowsState()
+	}
+	return r
+}
+
 func (o *PluginTransClient) OnRemove(ctx *core.PluginCtx) {
 	tl := o.Client.GetTransportCtx()
 	if tl == nil {
@@ -144,7 +177,8 @@ func (o PluginTransNsReg) NewPlugin(ctx *core.PluginCtx, initJson []byte) *core.
 /*  RPC commands */
 
 type (
-	ApiTransClientCntHandler struct{}
+	ApiTransClientCntHandler           struct{}
+	ApiTransClientTcpNegotiatedHandler struct{}
 )
 
 func getClientPlugin(ctx interface{}, params *fastjson.RawMessage) (*TransportCtx, error) {
@@ -180,6 +214,17 @@ func (h ApiTransClientCntHandler) ServeJSONRPC(ctx interface{}, params *fastjson
 	return c.cdbv.GeneralCounters(err, tctx, params, &p)
 }
 
+func (h ApiTransClientTcpNegotiatedHandler) ServeJSONRPC(ctx interface{}, params *fastjson.RawMessage) (interface{}, *jsonrpc.Error) {
+	c, err := getClientPlugin(ctx, params)
+	if err != nil {
+		return nil, &jsonrpc.Error{
+			Code:    jsonrpc.ErrorCodeInvalidRequest,
+			Message: err.Error(),
+		}
+	}
+	return c.getTcpNegotiated(), nil
+}
+
 func init() {
 
 	/* register of plugins callbacks for ns,c level  */
@@ -203,7 +248,8 @@ func init() {
 	  aa - misc
 	*/
 
-	core.RegisterCB("transport_client_cnt", ApiTransClientCntHandler{}, false) // get counters/meta
+	core.RegisterCB("transport_client_cnt", ApiTransClientCntHandler{}, false)                      // get counters/meta
+	core.RegisterCB("transport_client_tcp_negotiated", ApiTransClientTcpNegotiatedHandler{}, false) // connections by mss/wscale
 
 	/* register callback for rx side*/
 	core.ParserRegister("transport", HandleRxTransPacket)
@@ -17,6 +17,11 @@ type TcpStats struct {
 	tcps_delack      uint64 /* delayed acks sent */
 	tcps_sndtotal    uint64 /* total packets sent */
 	tcps_sndpack     uint64 /* data packets sent */
+	tcps_sndnocsum   uint64 /* packets sent without a computed checksum */
+
+	tcps_rcvsyn        uint64 /* SYN received for a new flow */
+	tcps_sndrst_closed uint64 /* RST sent for a SYN to a closed port */
+	tcps_port_accepts  uint64 /* connections accepted on the open port list */
 
 	tcps_sndbyte    uint64 /* data bytes sent by application layer  */
 	tcps_sndbyte_ok uint64 /* data bytes sent by tcp  */
@@ -81,6 +86,9 @@ type TcpStats struct {
 	tcps_already_closed    uint64 /* close  API error */
 	tcps_already_opened    uint64 /* connect/listen  API error */
 	tcps_write_while_drain uint64 /* write  API error */
+
+	tcps_mss_clamped       uint64 /* segment size clamped to the mss of the peer */
+	tcps_wscale_negotiated uint64 /* connections established with window scaling */
 }
 
 func NewTcpStatsDb(o *TcpStats) *core.CCounterDb {
@@ -182,6 +190,38 @@ func NewTcpStatsDb(o *TcpStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScINFO})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.tcps_sndnocsum,
+		Name:     "sndnocsum",
+		Help:     "packets sent without a computed checksum",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.tcps_rcvsyn,
+		Name:     "rcvsyn",
+		Help:     "syn received for a new flow",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.tcps_sndrst_closed,
+		Name:     "sndrst_closed",
+		Help:     "rst sent for a syn to a closed port",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.tcps_port_accepts,
+		Name:     "port_accepts",
+		Help:     "connections accepted on the open port list",
+		Unit:     "event",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
 	db.Add(&core.CCounterRec{
 		Counter:  &o.tcps_rcvoopack,
 		Name:     "rcvoopack",
@@ -582,5 +622,21 @@ func NewTcpStatsDb(o *TcpStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScINFO})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.tcps_mss_clamped,
+		Name:     "mss_clamped",
+		Help:     "segment size clamped to the mss of the peer",
+		Unit:     "event",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.tcps_wscale_negotiated,
+		Name:     "wscale_negotiated",
+		Help:     "connections established with window scaling",
+		Unit:     "event",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
 	return db
 }
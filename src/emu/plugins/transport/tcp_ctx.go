@@ -20,6 +20,7 @@ const (
 	TUNE_MSS      uint16 = 0x01
 	TUNE_INIT_WIN uint16 = 0x02
 	TUNE_NO_DELAY uint16 = 0x04
+	TUNE_WSCALE   uint16 = 0x08
 
 	DPC_EVENTS uint16 = 0x0002
 	DPC_OUTPUT uint16 = 0x0003
@@ -191,8 +192,11 @@ type baseSocket struct {
 	resolved     bool
 	interrupt    bool
 	srcPortAlloc bool
+	l4Checksum   uint8 // see L4_CHECKSUM_COMPUTE
 
 	client      *core.CClient
+	route       *core.CClientRoute // static route toward dst, nil in case of the default gateway
+	routesEpoc  uint32             // epoc of the routes of the client when dst was resolved
 	ns          *core.CNSCtx
 	tctx        *core.CThreadCtx
 	serverIoctl IoctlMap // save ioctl
@@ -224,6 +228,8 @@ type TcpSocket struct {
 	rxtshift int16  /* log(2) of rexmt exp. backoff */
 	rxtcur   uint16 /* current retransmit value */
 	maxseg   uint16 /* maximum segment size */
+	dflt_mss uint16 /* mss to advertise without a tunable */
+	peer_mss uint16 /* mss advertised by the peer in its SYN, zero if none */
 	flags    uint16
 
 	/*
@@ -299,4 +305,5 @@ type TcpSocket struct {
 	tun_mss         uint16
 	tun_init_window uint16
 	tun_no_delay    uint16
+	tun_wscale      uint16
 }
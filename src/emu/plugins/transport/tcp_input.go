@@ -143,15 +143,7 @@ func (o *TcpSocket) _input(ps *core.ParserPacketState) int {
 
 		/* Compute proper scaling value from buffer space
 		 */
-		for {
-			con := (o.request_r_scale < TCP_MAX_WINSHIFT) &&
-				(TCP_MAXWIN<<o.request_r_scale < so.so_rcv.sb_hiwat)
-			if con {
-				o.request_r_scale++
-			} else {
-				break
-			}
-		}
+		o.requestScale()
 	}
 
 	/*
@@ -396,6 +388,7 @@ func (o *TcpSocket) _input(ps *core.ParserPacketState) int {
 				o.snd_scale = o.requested_s_scale
 				o.rcv_scale = o.request_r_scale
 			}
+			o.countNegotiated()
 			o.tcp_reass_no_data()
 			/*
 			 * if we didn't have to retransmit the SYN,
@@ -635,7 +628,7 @@ func (o *TcpSocket) _input(ps *core.ParserPacketState) int {
 		}
 		sts.tcps_connects++
 		o.soisconnected_cb()
-		o.maxseg = o.mss(0)
+		o.maxseg = o.clampMss(o.mss(0))
 		o.state = TCPS_ESTABLISHED
 		/* Do window scaling? */
 		if (o.flags & (TF_RCVD_SCALE | TF_REQ_SCALE)) ==
@@ -643,6 +636,7 @@ func (o *TcpSocket) _input(ps *core.ParserPacketState) int {
 			o.snd_scale = o.requested_s_scale
 			o.rcv_scale = o.request_r_scale
 		}
+		o.countNegotiated()
 		o.tcp_reass_no_data()
 		o.snd_wl1 = tcph.Seq - 1
 		fallthrough
@@ -1182,8 +1176,13 @@ func (o *TcpSocket) dooptions(tcph *layers.TCP,
 			if obj.OptionLength == 4 {
 				if (tcph.Flags & TH_SYN) > 0 {
 					newmss := binary.BigEndian.Uint16(obj.OptionData[0:2])
-					/* sets t_maxseg */
-					o.maxseg = uint16(bsd_umin(uint32(o.maxseg), uint32(o.mss(uint32(newmss)))))
+					/* sets t_maxseg, the segments are not bigger than the mss of the peer */
+					o.peer_mss = newmss
+					mss := o.mss(uint32(newmss))
+					o.maxseg = o.clampMss(mss)
+					if o.maxseg < mss {
+						o.ctx.tcpStats.tcps_mss_clamped++
+					}
 				}
 			}
 
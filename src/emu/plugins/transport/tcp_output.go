@@ -23,14 +23,19 @@ func bsd_umin(a uint32, b uint32) uint32 {
 	return b
 }
 
-// resolve each flow once
+// resolve each flow once, and again in case the routes of the client were replaced
 func (o *TcpSocket) resolve() bool {
 	if o.resolved {
-		return true
+		if o.routesEpoc == o.client.RoutesEpoc() {
+			return true
+		}
+		o.resolved = false
 	}
+	o.routesEpoc = o.client.RoutesEpoc()
 	if o.ipv6 == false {
-		mac, ok := o.client.ResolveIPv4DGMac()
+		mac, route, ok := o.client.ResolveIPv4RouteMac(o.dst)
 		if ok {
+			o.route = route
 			layers.EthernetHeader(o.pktTemplate).SetDestAddress(mac[:])
 			o.resolved = true
 			return true
@@ -38,8 +43,9 @@ func (o *TcpSocket) resolve() bool {
 			o.ctx.tcpStats.tcps_drop_unresolved++
 		}
 	} else {
-		mac, ok := o.client.ResolveIPv6DGMac()
+		mac, route, ok := o.client.ResolveIPv6RouteMac(o.dstIPv6)
 		if ok {
+			o.route = route
 			layers.EthernetHeader(o.pktTemplate).SetDestAddress(mac[:])
 			o.resolved = true
 			return true
@@ -54,19 +60,11 @@ func (o *TcpSocket) send(pkt *tcpPkt) int {
 	// fix checksum
 	m := pkt.m
 	p := m.GetData()
-	if o.ipv6 == false {
-		l3 := o.l3Offset
-		l4 := o.l4Offset
-		ipv4 := layers.IPv4Header(p[l3 : l3+20])
-		/* update checsum */
-		binary.BigEndian.PutUint16(p[l4+16:l4+18], 0)
-		cs := layers.PktChecksumTcpUdp(p[l4:], 0, ipv4)
-		binary.BigEndian.PutUint16(p[l4+16:l4+18], cs)
-	} else {
-		l4 := o.l4Offset
-		l3 := o.l3Offset
-		ipv6 := layers.IPv6Header(p[l3 : l3+40])
-		ipv6.FixTcpL4Checksum(p[l4:], 0)
+	if !o.updateL4Checksum(p, 16) {
+		o.ctx.tcpStats.tcps_sndnocsum++
+	}
+	if o.route != nil {
+		o.route.Pkts++
 	}
 	o.tctx.Veth.Send(m)
 	return 0
@@ -160,16 +158,16 @@ func rangeset(tv *uint16, value uint16, tvmin uint16, tvmax uint16) {
  * parameters from pre-set or cached values in the routing entry.
  */
 func (o *TcpSocket) mss(offer uint32) uint16 {
-	if o.tuneable_flags == 0 {
+	if o.tuneable_flags&(TUNE_MSS|TUNE_INIT_WIN|TUNE_NO_DELAY) == 0 {
 		// no tunable
 		o.snd_cwnd = o.ctx.tcp_initwnd
-		return o.maxseg
+		return o.dflt_mss
 	} else {
 		var mss uint16
 		if o.tuneable_flags&TUNE_MSS > 0 {
 			mss = o.tun_mss
 		} else {
-			mss = o.maxseg
+			mss = o.dflt_mss
 		}
 		var initwnd uint32
 		if o.tuneable_flags&TUNE_INIT_WIN > 0 {
@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Cisco Systems and/or its affiliates.
+// Licensed under the Apache License, Version 2.0 (the "License")
+// that can be found in the LICENSE file in the root of the source
+// tree.
+
+package transport
+
+import (
+	"emu/core"
+	"external/google/gopacket/layers"
+)
+
+/* port posture of a client, without an application
+
+   tcp_open_ports - SYN to these ports is accepted and the handshake is completed, the data is discarded
+                    and the connection is closed when the remote side closes it
+   tcp_rst_closed - SYN to a port without a listener is answered with RST|ACK
+*/
+
+// portSinkServer accepts connections on the open port list
+type portSinkServer struct {
+	ctx *TransportCtx
+}
+
+func (o *portSinkServer) OnAccept(socket SocketApi) ISocketCb {
+	o.ctx.tcpStats.tcps_port_accepts++
+	return &portSinkSocket{socket: socket}
+}
+
+// portSinkSocket discards the data of an accepted connection
+type portSinkSocket struct {
+	socket SocketApi
+}
+
+func (o *portSinkSocket) OnRxEvent(event SocketEventType) {
+	if (event & SocketRemoteDisconnect) > 0 {
+		o.socket.Close()
+	}
+	if (event & SocketClosed) > 0 {
+		o.socket = nil
+	}
+}
+
+func (o *portSinkSocket) OnRxData(d []byte) {
+}
+
+func (o *portSinkSocket) OnTxEvent(event SocketEventType) {
+}
+
+// respondClosedPort answers a SYN to a closed port with RST|ACK. There is no flow,
+// a temporary socket is used only for building the template, see dropwithreset
+func (o *TransportCtx) respondClosedPort(ps *core.ParserPacketState,
+	ipv6 bool,
+	keyv4 *c5tuplekeyv4,
+	keyv6 *c5tuplekeyv6) {
+
+	p := ps.M.GetData()
+	tcph := layers.TcpHeader(p[ps.L4 : ps.L4+20])
+	dstport := tcph.GetDstPort()
+
+	s := new(TcpSocket)
+	s.init(o.Client, o)
+	if !ipv6 {
+		if o.Client.Ipv4.IsZero() {
+			o.flowTableStats.ft_new_no_client_ipv4++
+			return
+		}
+		s.setTupleIpv4(o.Client.Ipv4, keyv4.getSrcIp(), dstport, keyv4.getSrcPort())
+	} else {
+		ipv6src, err := o.Client.GetSourceIPv6()
+		if err != nil {
+			o.flowTableStats.ft_new_no_client_ipv6++
+			return
+		}
+		s.setTupleIpv6(ipv6src, keyv6.getSrcIp(), dstport, keyv6.getSrcPort())
+	}
+	s.baseSocket.initphase2(false)
+
+	var pkt tcpPkt
+	if s.buildCpkt(TCP_HEADER_LEN, &pkt) != 0 {
+		return
+	}
+	/* make the ACK acceptable, SYN takes one sequence number */
+	pkt.tcph.SetSeqNumber(0)
+	pkt.tcph.SetAckNumber(tcph.GetSeqNumber() + uint32(ps.L7Len) + 1)
+	pkt.tcph.SetFlags(TH_RST | TH_ACK)
+	pkt.tcph.SetWindowSize(0)
+	s.send(&pkt)
+	o.tcpStats.tcps_sndrst_closed++
+}
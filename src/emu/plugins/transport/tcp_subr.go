@@ -21,6 +21,22 @@ const (
 	TCP_IOCTL_DELAY_ACK_MSEC = "delay_ack_msec"   // msec of fast tcp time
 	TCP_IOCTL_TX_BUF_SIZE    = "txbufsize"        // tx queue in bytes, can be change only in case the queue if empty
 	TCP_IOCTL_RX_BUF_SIZE    = "rxbufsize"        // rx queue in bytes
+	TCP_IOCTL_WSCALE         = "wscale"           // window scale to request in the SYN (0-14), negative to compute it from rxbufsize
+	IP_IOCTL_L4_CHECKSUM     = "l4_checksum"      // tcp/udp checksum of the tx packets, see L4_CHECKSUM_COMPUTE
+)
+
+// tx fragmentation of udp over ipv6, used to test the reassembly of the DUT
+const (
+	IP_IOCTL_IPV6_FRAG_SIZE = "ipv6_frag_size"    // fragment payload size (multiple of 8), 0 - no fragmentation
+	IP_IOCTL_IPV6_FRAG_OVLP = "ipv6_frag_overlap" // 1 - each fragment overlaps the previous one by 8 bytes
+	IP_IOCTL_IPV6_FRAG_ID   = "ipv6_frag_id"      // fragment identification, see core.FRAG_ID_SEQ
+)
+
+// tx tcp/udp checksum modes, skipping the checksum is a performance trade-off for high rates
+const (
+	L4_CHECKSUM_COMPUTE = 0 // compute the checksum of each packet (default)
+	L4_CHECKSUM_ZERO    = 1 // put zero in the checksum field
+	L4_CHECKSUM_STALE   = 2 // leave the checksum field as is
 )
 
 func (o *TcpSocket) SetIoctl(m IoctlMap) error {
@@ -85,6 +101,23 @@ func (o *TcpSocket) SetIoctl(m IoctlMap) error {
 		}
 	}
 
+	val, prs = m[TCP_IOCTL_WSCALE]
+	if prs {
+		wscale, ok := val.(int)
+		if ok {
+			if wscale > TCP_MAX_WINSHIFT {
+				wscale = TCP_MAX_WINSHIFT
+			}
+			if wscale >= 0 {
+				o.tun_wscale = uint16(wscale)
+				o.tuneable_flags |= TUNE_WSCALE
+			} else {
+				o.tun_wscale = 0
+				o.tuneable_flags &= ^TUNE_WSCALE
+			}
+		}
+	}
+
 	val, prs = m[TCP_IOCTL_NODELAY_CNT]
 	if prs {
 		no_delay_cnt, ok := val.(int)
@@ -169,6 +202,11 @@ func (o *TcpSocket) GetIoctl(m IoctlMap) error {
 	} else {
 		delete(m, TCP_IOCTL_NODELAY)
 	}
+	if o.tuneable_flags&TUNE_WSCALE > 0 {
+		m[TCP_IOCTL_WSCALE] = int(o.tun_wscale)
+	} else {
+		delete(m, TCP_IOCTL_WSCALE)
+	}
 
 	m[TCP_IOCTL_NODELAY_CNT] = int(o.fastMsec)
 	m[TCP_IOCTL_TX_BUF_SIZE] = int(o.socket.so_snd.sb_hiwat)
@@ -203,14 +241,7 @@ func (o *TcpSocket) connect() SocketErr {
 	}
 
 	/* Compute window scaling to request.  */
-	for {
-		if (o.request_r_scale < TCP_MAX_WINSHIFT) &&
-			(TCP_MAXWIN<<o.request_r_scale) < o.socket.so_rcv.sb_hiwat {
-			o.request_r_scale++
-		} else {
-			break
-		}
-	}
+	o.requestScale()
 
 	sts.tcps_connattempt++
 	o.state = TCPS_SYN_SENT
@@ -222,6 +253,41 @@ func (o *TcpSocket) connect() SocketErr {
 	return SeOK
 }
 
+// requestScale sets the window scale to request, the tuned one or the smallest one that
+// covers the rx buffer
+func (o *TcpSocket) requestScale() {
+	if o.tuneable_flags&TUNE_WSCALE > 0 {
+		o.request_r_scale = uint8(o.tun_wscale)
+		return
+	}
+	for {
+		if (o.request_r_scale < TCP_MAX_WINSHIFT) &&
+			(TCP_MAXWIN<<o.request_r_scale) < o.socket.so_rcv.sb_hiwat {
+			o.request_r_scale++
+		} else {
+			break
+		}
+	}
+}
+
+// clampMss returns the segment size to send, mss limited by the mss the peer advertised
+func (o *TcpSocket) clampMss(mss uint16) uint16 {
+	if o.peer_mss > 0 && o.peer_mss < mss {
+		return o.peer_mss
+	}
+	return mss
+}
+
+// countNegotiated counts the established connection by its segment size and window scale
+func (o *TcpSocket) countNegotiated() {
+	wscale := int8(-1)
+	if (o.flags & (TF_RCVD_SCALE | TF_REQ_SCALE)) == (TF_RCVD_SCALE | TF_REQ_SCALE) {
+		wscale = int8(o.snd_scale)
+		o.ctx.tcpStats.tcps_wscale_negotiated++
+	}
+	o.ctx.countTcpNegotiated(o.maxseg, wscale)
+}
+
 func (o *TcpSocket) listen() SocketErr {
 	sts := &o.ctx.tcpStats
 
@@ -493,12 +559,17 @@ func (o *TcpSocket) quench() {
 func (o *TcpSocket) init(client *core.CClient, ctx *TransportCtx) {
 	o.baseSocket.init(client, ctx)
 
-	o.timerw = o.tctx.GetTimerCtx()
+	o.timerw = client.Ns.GetTimerCtx()
 
 	// set the tunables to zero
 	o.tun_mss = 0
 	o.tun_init_window = 0
 	o.tun_no_delay = 0
+	o.tun_wscale = 0
+	if ctx.tcp_wscale >= 0 {
+		o.tun_wscale = uint16(ctx.tcp_wscale)
+		o.tuneable_flags |= TUNE_WSCALE
+	}
 
 	if ctx.tcp_do_rfc1323 {
 		o.flags |= (TF_REQ_SCALE | TF_REQ_TSTMP)
@@ -574,6 +645,7 @@ func (o *TcpSocket) initphase2(cb ISocketCb) {
 	o.cb = cb
 	o.baseSocket.initphase2(false)
 	o.maxseg = o.ctx.tcp_mssdflt_ - (o.l4Offset - (20 + 14))
+	o.dflt_mss = o.maxseg
 	o.socket = new(socketData)
 	o.socket.so_snd.init(o.tctx, o.ctx.tcp_tx_socket_bsize)
 	o.socket.so_snd.s = o
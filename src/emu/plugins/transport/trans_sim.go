@@ -38,18 +38,28 @@ func newSimCtx(app iSockeApp, c *core.CClient, server bool, ioctl *map[string]in
 	}
 
 	if server {
+		if params.serverCfg != nil {
+			o.ctx.setCfg(params.serverCfg)
+		}
 		o.ctx.Listen(net, ":80", app.getServerAcceptCb())
 		if ioctl != nil {
 			o.ioctl = *ioctl // save it for the callback
 		}
 	} else {
+		if params.clientCfg != nil {
+			o.ctx.setCfg(params.clientCfg)
+		}
 		var mioctl IoctlMap
 		if ioctl != nil {
 			mioctl = *ioctl
 		}
-		d := "48.0.0.1:80"
+		port := uint16(80)
+		if params.dstPort != 0 {
+			port = params.dstPort
+		}
+		d := fmt.Sprintf("48.0.0.1:%d", port)
 		if params.ipv6 {
-			d = "[2001:db8::3000:1]:80"
+			d = fmt.Sprintf("[2001:db8::3000:1]:%d", port)
 		}
 		ap, err := o.ctx.Dial(net, d, app.getCb(), mioctl)
 		if err != nil {
@@ -615,6 +625,9 @@ type transportSimParam struct {
 	ioctls                  *map[string]interface{}
 	ipv6                    bool
 	udp                     bool
+	dstPort                 uint16           // client destination port, 80 by default
+	serverCfg               *TransportCtxCfg // server side transport config
+	clientCfg               *TransportCtxCfg // client side transport config
 }
 
 type transportSim struct {
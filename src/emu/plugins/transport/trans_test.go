@@ -6,11 +6,13 @@
 package transport
 
 import (
+	"bytes"
 	"emu/core"
 	"flag"
 	"fmt"
 	"math/rand"
 	"net"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -278,6 +280,7 @@ type TransportSimTestBase struct {
 	cbArg1       interface{}
 	cbArg2       interface{}
 	param        transportSimParam
+	negotiated   []TcpNegotiatedRec // expected client connections by mss/wscale
 }
 
 func (o *TransportSimTestBase) Run(t *testing.T, compare bool) {
@@ -296,6 +299,13 @@ func (o *TransportSimTestBase) Run(t *testing.T, compare bool) {
 	fmt.Printf("\n== Server counters === \n")
 	sim.server.ctx.cdbv.Dump()
 
+	if o.negotiated != nil {
+		n := sim.client.ctx.getTcpNegotiated()
+		if !reflect.DeepEqual(n, o.negotiated) {
+			t.Fatalf(" negotiated %+v expected %+v \n", n, o.negotiated)
+		}
+	}
+
 	acf := sim.client.ctx.getActiveFlows() + sim.server.ctx.getActiveFlows()
 	if acf > 0 {
 		panic(" active flows exists")
@@ -789,6 +799,204 @@ func TestPluginUdp2(t *testing.T) {
 	a.Run(t, false)
 }
 
+func TestPluginUdp3(t *testing.T) {
+	a := &TransportSimTestBase{
+		testname:     "tcp-udp3",
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     10 * time.Second,
+		clientsToSim: 1,
+		param: transportSimParam{
+			name:                    "r_r",
+			sendRandom:              false,
+			totalClientToServerSize: 1024,
+			chunkSize:               1024,
+			closeByClient:           true,
+			udp:                     true,
+			ioctlc:                  &map[string]interface{}{"l4_checksum": L4_CHECKSUM_ZERO},
+		},
+	}
+	a.Run(t, false)
+}
+
+/*TestPluginTcpClosedPort1 - SYN to a port without a listener is answered with RST */
+func TestPluginTcpClosedPort1(t *testing.T) {
+	rstClosed := true
+	a := &TransportSimTestBase{
+		testname:     "tcp-closed-port1",
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     10 * time.Second,
+		clientsToSim: 1,
+		param: transportSimParam{
+			name:                    "a",
+			sendRandom:              false,
+			totalClientToServerSize: 1024,
+			chunkSize:               1024,
+			closeByClient:           true,
+			dstPort:                 81,
+			serverCfg:               &TransportCtxCfg{TcpRstClosed: &rstClosed},
+		},
+	}
+	a.Run(t, false)
+}
+
+/*TestPluginTcpOpenPort1 - SYN to a port of the open port list, the handshake is completed and the data discarded */
+func TestPluginTcpOpenPort1(t *testing.T) {
+	rstClosed := true
+	a := &TransportSimTestBase{
+		testname:     "tcp-open-port1",
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     10 * time.Second,
+		clientsToSim: 1,
+		param: transportSimParam{
+			name:                    "a",
+			sendRandom:              false,
+			totalClientToServerSize: 1024,
+			chunkSize:               1024,
+			closeByClient:           true,
+			dstPort:                 22,
+			serverCfg:               &TransportCtxCfg{TcpRstClosed: &rstClosed, TcpOpenPorts: []uint16{22, 443}},
+		},
+	}
+	a.Run(t, false)
+}
+
+/*TestPluginTcpMss1 - the server advertises a smaller mss and the client segments are not bigger than it */
+func TestPluginTcpMss1(t *testing.T) {
+	var mss uint16 = 700 // 692 is advertised, the vlan tags are deducted
+	var wscalec, wscales uint8 = 2, 9
+	a := &TransportSimTestBase{
+		testname:     "tcp-mss1",
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     10 * time.Second,
+		clientsToSim: 1,
+		param: transportSimParam{
+			name:                    "a",
+			sendRandom:              false,
+			totalClientToServerSize: 4000,
+			chunkSize:               4000,
+			closeByClient:           true,
+			clientCfg:               &TransportCtxCfg{TcpWscale: &wscalec},
+			serverCfg:               &TransportCtxCfg{TcpMss: &mss, TcpWscale: &wscales},
+		},
+		negotiated: []TcpNegotiatedRec{{Mss: 692, Wscale: 9, Cnt: 1}},
+	}
+	a.Run(t, false)
+}
+
+/*TestPluginTcpMss2 - the client advertises mss 536 by ioctl and requests a window scale of 0 */
+func TestPluginTcpMss2(t *testing.T) {
+	a := &TransportSimTestBase{
+		testname:     "tcp-mss2",
+		monitor:      false,
+		match:        0,
+		capture:      true,
+		duration:     10 * time.Second,
+		clientsToSim: 1,
+		param: transportSimParam{
+			name:                    "a",
+			sendRandom:              false,
+			totalClientToServerSize: 2000,
+			chunkSize:               2000,
+			closeByClient:           true,
+			ioctlc:                  &map[string]interface{}{"mss": 536, "wscale": 0},
+		},
+		negotiated: []TcpNegotiatedRec{{Mss: 536, Wscale: 0, Cnt: 1}},
+	}
+	a.Run(t, false)
+}
+
+func newBenchUdpSocket(mode uint8) (*core.CThreadCtx, *UdpSocket, []byte) {
+	var simVeth VethIcmpSim
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, 1)
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	client := tctx.GetNs(&key).CLookupByMac(&core.MACKey{0, 0, 1, 0, 0, 0})
+	s := new(UdpSocket)
+	s.init(client, newCtx(client))
+	s.setTupleIpv4(client.Ipv4, core.Ipv4Key{48, 0, 0, 1}, 1025, 53)
+	s.baseSocket.initphase2(true)
+	s.l4Checksum = mode
+	p := append(append([]byte{}, s.pktTemplate...), make([]byte, 1400)...)
+	return tctx, s, p
+}
+
+func TestPluginUdpRoutes(t *testing.T) {
+	tctx, s, _ := newBenchUdpSocket(L4_CHECKSUM_COMPUTE)
+	defer tctx.Delete()
+	client := s.client
+	setRoute := func(nh core.Ipv4Key, mac core.MACKey) *core.CClientRoute {
+		client.SetRoutes([]core.CClientRouteCmd{{Ipv4: core.Ipv4Key{48, 0, 0, 0}, PrefixLen: 8, NextHopIpv4: nh}})
+		r := client.Routes[0]
+		r.Dg = &core.CClientDg{IpdgResolved: true, IpdgMac: mac}
+		return r
+	}
+
+	r := setRoute(core.Ipv4Key{16, 0, 0, 3}, core.MACKey{0, 0, 3, 0, 0, 3})
+	if !s.resolve() || s.route != r || !bytes.Equal(s.pktTemplate[0:6], r.Dg.IpdgMac[:]) {
+		t.Fatalf(" flow should be resolved by the route \n")
+	}
+	// the flow moves to the next-hop of the new routes
+	r = setRoute(core.Ipv4Key{16, 0, 0, 4}, core.MACKey{0, 0, 3, 0, 0, 4})
+	if !s.resolve() || s.route != r || !bytes.Equal(s.pktTemplate[0:6], r.Dg.IpdgMac[:]) {
+		t.Fatalf(" flow should be resolved again by the new route \n")
+	}
+}
+
+// the flows of the client in ctx_get_state are sorted by protocol and addresses
+func TestPluginTransState(t *testing.T) {
+	var simVeth VethIcmpSim
+	var simrx core.VethIFSim
+	simrx = &simVeth
+	tctx, _ := createSimulationEnv(&simrx, 1)
+	defer tctx.Delete()
+	var key core.CTunnelKey
+	key.Set(&core.CTunnelData{Vport: 1, Vlans: [2]uint32{0x81000001, 0x81000002}})
+	client := tctx.GetNs(&key).CLookupByMac(&core.MACKey{0, 0, 1, 0, 0, 0})
+	client.PluginCtx.CreatePlugins([]string{TRANS_PLUG}, nil)
+	plug := client.PluginCtx.Get(TRANS_PLUG).Ext.(*PluginTransClient)
+	if s := plug.GetState().(*TransportClientState); len(s.Flows) != 0 {
+		t.Fatalf(" client without transport should have no flows %+v \n", s)
+	}
+
+	ctx := newCtx(client)
+	client.SetTransportCtx(ctx)
+	ctx.Dial("udp", "48.0.0.1:53", &SocketAppRx1{}, nil)
+	ctx.Dial("tcp", "48.0.0.1:80", &SocketAppRx1{}, nil)
+	s := plug.GetState().(*TransportClientState)
+	if len(s.Flows) != 2 || s.Flows[0].Proto != "tcp" || s.Flows[0].State != "SYN_SENT" ||
+		s.Flows[0].Remote != "48.0.0.1:80" || s.Flows[1].Proto != "udp" || s.Flows[1].State != "" {
+		t.Fatalf(" bad flows %+v \n", s)
+	}
+}
+
+func benchmarkUdpChecksum(b *testing.B, mode uint8) {
+	tctx, s, p := newBenchUdpSocket(mode)
+	defer tctx.Delete()
+	b.SetBytes(int64(len(p)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.updateL4Checksum(p, 6)
+	}
+}
+
+func BenchmarkUdpChecksumCompute(b *testing.B) {
+	benchmarkUdpChecksum(b, L4_CHECKSUM_COMPUTE)
+}
+
+func BenchmarkUdpChecksumZero(b *testing.B) {
+	benchmarkUdpChecksum(b, L4_CHECKSUM_ZERO)
+}
+
 func init() {
 	flag.IntVar(&monitor, "monitor", 0, "monitor")
 }
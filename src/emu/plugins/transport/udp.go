@@ -21,6 +21,7 @@ type udpPkt struct {
 type UdpSocket struct {
 	baseSocket
 	isClosed bool
+	frag     core.CIpv6FragGen // tx fragmentation, ipv6 only
 }
 
 func (o *UdpSocket) init(client *core.CClient, ctx *TransportCtx) {
@@ -28,13 +29,49 @@ func (o *UdpSocket) init(client *core.CClient, ctx *TransportCtx) {
 }
 
 func (o *UdpSocket) SetIoctl(m IoctlMap) error {
+	o.setIoctlFrag(m)
 	return o.baseSocket.setIoctlBase(m)
 }
 
 func (o *UdpSocket) GetIoctl(m IoctlMap) error {
+	if o.ipv6 {
+		m[IP_IOCTL_IPV6_FRAG_SIZE] = int(o.frag.Size)
+		m[IP_IOCTL_IPV6_FRAG_ID] = int(o.frag.IdMode)
+		m[IP_IOCTL_IPV6_FRAG_OVLP] = 0
+		if o.frag.Overlap {
+			m[IP_IOCTL_IPV6_FRAG_OVLP] = 1
+		}
+	}
 	return o.baseSocket.getIoctlBase(m)
 }
 
+// setIoctlFrag sets the ipv6 fragmentation, invalid values are ignored
+func (o *UdpSocket) setIoctlFrag(m IoctlMap) {
+	frag := o.frag
+	val, prs := m[IP_IOCTL_IPV6_FRAG_SIZE]
+	if prs {
+		size, ok := val.(int)
+		if ok && size >= 0 && size <= int(core.MAX_PACKET_SIZE) {
+			frag.Size = uint16(size)
+		}
+	}
+	val, prs = m[IP_IOCTL_IPV6_FRAG_OVLP]
+	if prs {
+		ovlp, ok := val.(int)
+		if ok {
+			frag.Overlap = ovlp != 0
+		}
+	}
+	val, prs = m[IP_IOCTL_IPV6_FRAG_ID]
+	if prs {
+		mode, ok := val.(int)
+		if ok && (mode == core.FRAG_ID_SEQ || mode == core.FRAG_ID_RANDOM) {
+			frag.IdMode = uint8(mode)
+		}
+	}
+	o.frag.SetCfg(frag.Size, frag.Overlap, frag.IdMode, o.tctx.Simulation)
+}
+
 func (o *UdpSocket) connect() SocketErr {
 	return SeOK
 }
@@ -96,7 +133,13 @@ func (o *UdpSocket) Write(buf []byte) (res SocketErr, queued bool) {
 	}
 	var pkt udpPkt
 
-	if uint16(len(buf)) > o.GetL7MTU() {
+	if o.ipv6 && o.frag.IsEnabled() {
+		// fragmented, limited by the mbuf size
+		if len(buf)+len(o.pktTemplate) > int(core.MAX_PACKET_SIZE) {
+			o.ctx.udpStats.udp_drop_msg_bigger_mtu++
+			return SeENOBUFS, false
+		}
+	} else if uint16(len(buf)) > o.GetL7MTU() {
 		o.ctx.udpStats.udp_drop_msg_bigger_mtu++
 		return SeENOBUFS, false
 	}
@@ -140,19 +183,25 @@ func (o *UdpSocket) send(pkt *udpPkt) int {
 	// fix checksum
 	m := pkt.m
 	p := m.GetData()
-	if o.ipv6 == false {
-		l3 := o.l3Offset
-		l4 := o.l4Offset
-		ipv4 := layers.IPv4Header(p[l3 : l3+20])
-		/* update checksum */
-		binary.BigEndian.PutUint16(p[l4+6:l4+8], 0)
-		cs := layers.PktChecksumTcpUdp(p[l4:], 0, ipv4)
-		binary.BigEndian.PutUint16(p[l4+6:l4+8], cs)
-	} else {
-		l4 := o.l4Offset
-		l3 := o.l3Offset
-		ipv6 := layers.IPv6Header(p[l3 : l3+40])
-		ipv6.FixUdpL4Checksum(p[l4:], 0)
+	if !o.updateL4Checksum(p, 6) {
+		o.ctx.udpStats.udp_sndnocsum++
+	}
+	if o.route != nil {
+		o.route.Pkts++
+	}
+
+	if o.ipv6 {
+		if frags := o.frag.Fragment(p, o.l3Offset); frags != nil {
+			o.ctx.udpStats.udp_sndfragpkt++
+			for _, f := range frags {
+				fm := o.ns.AllocMbuf(uint16(len(f)))
+				fm.Append(f)
+				o.tctx.Veth.Send(fm)
+				o.ctx.udpStats.udp_sndfrags++
+			}
+			m.FreeMbuf()
+			return 0
+		}
 	}
 
 	o.tctx.Veth.Send(m)
@@ -193,13 +242,19 @@ func (o *UdpSocket) updatePktLen(pkt *udpPkt) {
 	}
 }
 
+// resolve each flow once, and again in case the routes of the client were replaced
 func (o *UdpSocket) resolve() bool {
 	if o.resolved {
-		return true
+		if o.routesEpoc == o.client.RoutesEpoc() {
+			return true
+		}
+		o.resolved = false
 	}
+	o.routesEpoc = o.client.RoutesEpoc()
 	if o.ipv6 == false {
-		mac, ok := o.client.ResolveIPv4DGMac()
+		mac, route, ok := o.client.ResolveIPv4RouteMac(o.dst)
 		if ok {
+			o.route = route
 			layers.EthernetHeader(o.pktTemplate).SetDestAddress(mac[:])
 			o.resolved = true
 			return true
@@ -207,8 +262,9 @@ func (o *UdpSocket) resolve() bool {
 			o.ctx.udpStats.udp_drop_unresolved++
 		}
 	} else {
-		mac, ok := o.client.ResolveIPv6DGMac()
+		mac, route, ok := o.client.ResolveIPv6RouteMac(o.dstIPv6)
 		if ok {
+			o.route = route
 			layers.EthernetHeader(o.pktTemplate).SetDestAddress(mac[:])
 			o.resolved = true
 			return true
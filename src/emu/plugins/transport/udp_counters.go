@@ -16,6 +16,9 @@ type UdpStats struct {
 
 	udp_drop_unresolved     uint64 /* not resolved  */
 	udp_drop_msg_bigger_mtu uint64 /* msg is bigger than mtu */
+	udp_sndnocsum           uint64 /* packets sent without a computed checksum */
+	udp_sndfragpkt          uint64 /* ipv6 packets sent as fragments */
+	udp_sndfrags            uint64 /* ipv6 fragments sent */
 
 }
 
@@ -63,5 +66,29 @@ func NewUdpStatsDb(o *UdpStats) *core.CCounterDb {
 		DumpZero: false,
 		Info:     core.ScERROR})
 
+	db.Add(&core.CCounterRec{
+		Counter:  &o.udp_sndnocsum,
+		Name:     "udp_sndnocsum",
+		Help:     "packets sent without a computed checksum",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.udp_sndfragpkt,
+		Name:     "udp_sndfragpkt",
+		Help:     "ipv6 packets sent as fragments",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
+	db.Add(&core.CCounterRec{
+		Counter:  &o.udp_sndfrags,
+		Name:     "udp_sndfrags",
+		Help:     "ipv6 fragments sent",
+		Unit:     "pkts",
+		DumpZero: false,
+		Info:     core.ScINFO})
+
 	return db
 }
@@ -192,3 +192,57 @@ func BenchmarkFlowFastHashLong(b *testing.B) {
 		e.FastHash()
 	}
 }
+
+// serializeJumboUDP does the prepends of an ethernet/ipv4/udp jumbo frame
+func serializeJumboUDP(w SerializeBuffer) {
+	w.Clear()
+	w.PrependBytes(8972) // payload
+	w.PrependBytes(8)    // udp
+	w.PrependBytes(20)   // ipv4
+	w.PrependBytes(14)   // ethernet
+}
+
+// serializeEthPad does the ethernet prepend-then-pad of a short frame (ARP)
+func serializeEthPad(w SerializeBuffer) {
+	w.Clear()
+	w.PrependBytes(28)
+	w.PrependBytes(14)
+	w.AppendBytes(60 - len(w.Bytes()))
+}
+
+func BenchmarkSerializeJumboNoHint(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		serializeJumboUDP(NewSerializeBuffer())
+	}
+}
+
+func BenchmarkSerializeJumboSizeHint(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		serializeJumboUDP(NewSerializeBufferSizeHint(9014))
+	}
+}
+
+func BenchmarkSerializeJumboPoolSizeHint(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w := GetSerializeBuffer(9014)
+		serializeJumboUDP(w)
+		PutSerializeBuffer(w)
+	}
+}
+
+func BenchmarkSerializeEthPadNoHint(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		serializeEthPad(NewSerializeBuffer())
+	}
+}
+
+func BenchmarkSerializeEthPadSizeHint(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		serializeEthPad(NewSerializeBufferSizeHint(42))
+	}
+}
@@ -22,6 +22,10 @@ func (o TcpHeader) SetSeqNumber(val uint32) {
 	binary.BigEndian.PutUint32(o[4:8], val)
 }
 
+func (o TcpHeader) GetSeqNumber() uint32 {
+	return binary.BigEndian.Uint32(o[4:8])
+}
+
 func (o TcpHeader) SetAckNumber(val uint32) {
 	binary.BigEndian.PutUint32(o[8:12], val)
 }
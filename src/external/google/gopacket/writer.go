@@ -8,6 +8,7 @@ package gopacket
 
 import (
 	"fmt"
+	"sync"
 )
 
 // SerializableLayer allows its implementations to be written out as a set of bytes,
@@ -132,6 +133,60 @@ func NewSerializeBufferExpectedSize(expectedPrependLength, expectedAppendLength
 	}
 }
 
+// sizeHintAppendRoom is the append room reserved together with a size hint.
+// It covers the padding of a minimum size Ethernet frame and short trailers,
+// the rest of the hint is reserved for prepends.
+const sizeHintAppendRoom = 64
+
+// NewSerializeBufferSizeHint creates a new buffer for serialization that
+// allocates once for a packet of up to size bytes (e.g. jumbo frames).
+func NewSerializeBufferSizeHint(size int) SerializeBuffer {
+	w := &serializeBuffer{}
+	w.reserve(size)
+	return w
+}
+
+var serializeBufferPool = sync.Pool{
+	New: func() interface{} { return &serializeBuffer{} },
+}
+
+// GetSerializeBuffer returns a cleared buffer from a pool. sizeHint is the
+// expected final size of the packet, the buffer is grown to it with a single
+// allocation if required. Use 0 for no hint.
+func GetSerializeBuffer(sizeHint int) SerializeBuffer {
+	w := serializeBufferPool.Get().(*serializeBuffer)
+	w.Clear()
+	w.reserve(sizeHint)
+	return w
+}
+
+// PutSerializeBuffer returns a buffer taken by GetSerializeBuffer to the pool.
+// The byte slices returned by its Bytes() should be considered invalidated.
+func PutSerializeBuffer(b SerializeBuffer) {
+	if w, ok := b.(*serializeBuffer); ok {
+		serializeBufferPool.Put(w)
+	}
+}
+
+// reserve makes sure a cleared buffer can hold size bytes of prepends and
+// sizeHintAppendRoom bytes of appends without another allocation.
+func (w *serializeBuffer) reserve(size int) {
+	if size <= 0 || (w.prepended >= size && w.appended >= sizeHintAppendRoom) {
+		return
+	}
+	if w.prepended > size {
+		size = w.prepended
+	}
+	room := sizeHintAppendRoom
+	if w.appended > room {
+		room = w.appended
+	}
+	w.data = make([]byte, size, size+room)
+	w.start = size
+	w.prepended = size
+	w.appended = room
+}
+
 func (w *serializeBuffer) Bytes() []byte {
 	return w.data[w.start:]
 }
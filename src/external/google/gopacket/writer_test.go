@@ -63,6 +63,28 @@ func TestExponentialSizeIncreaseAppend(t *testing.T) {
 	}
 }
 
+func TestSizeHintSingleAllocation(t *testing.T) {
+	for _, b := range []*serializeBuffer{
+		NewSerializeBufferSizeHint(9018).(*serializeBuffer),
+		GetSerializeBuffer(9018).(*serializeBuffer),
+	} {
+		c := cap(b.data)
+		b.PrependBytes(9000)
+		b.PrependBytes(4)
+		b.PrependBytes(14)
+		if c != cap(b.data) {
+			t.Error("prepend reallocated, cap was", c, "got", cap(b.data))
+		}
+		b.Clear()
+		b.PrependBytes(14)
+		b.AppendBytes(46) // ethernet padding
+		if c != cap(b.data) {
+			t.Error("append reallocated, cap was", c, "got", cap(b.data))
+		}
+		PutSerializeBuffer(b)
+	}
+}
+
 func ExampleSerializeBuffer() {
 	b := NewSerializeBuffer()
 	fmt.Println("1:", b.Bytes())
@@ -13,6 +13,10 @@ const (
 	ErrorCodeInvalidParams ErrorCode = -32602
 	// ErrorCodeInternal is internal error code.
 	ErrorCodeInternal ErrorCode = -32603
+	// ErrorCodeUnauthorized is unauthorized request error code.
+	ErrorCodeUnauthorized ErrorCode = -32001
+	// ErrorCodeBusy is server busy error code, the request should be retried later.
+	ErrorCodeBusy ErrorCode = -32002
 )
 
 type (
@@ -72,6 +76,22 @@ func ErrMethodNotValidAPI() *Error {
 	}
 }
 
+// ErrUnauthorized returns unauthorized request error.
+func ErrUnauthorized() *Error {
+	return &Error{
+		Code:    ErrorCodeUnauthorized,
+		Message: "Unauthorized",
+	}
+}
+
+// ErrBusy returns server busy error.
+func ErrBusy() *Error {
+	return &Error{
+		Code:    ErrorCodeBusy,
+		Message: "Server busy, try again later",
+	}
+}
+
 // ErrInternal returns internal error.
 func ErrInternal() *Error {
 	return &Error{
@@ -59,6 +59,31 @@ func (mr *MethodRepository) ServeBytesCompress(req []byte) []byte {
 	}
 }
 
+// ServeBytesError answers each request with e without invoking it, compressed if the request is
+func ServeBytesError(req []byte, e *Error) []byte {
+	if isCompress(req) {
+		return compressBuff(ServeBytesError(uncompressBuff(req), e))
+	}
+	rs, batch, err := ParseRequestBytes(req)
+	if err != nil {
+		b, _ := GetResponseBytes([]*Response{
+			{
+				Version: Version,
+				Error:   err,
+			},
+		}, false)
+		return b
+	}
+
+	resp := make([]*Response, len(rs))
+	for i := range rs {
+		resp[i] = NewResponse(rs[i])
+		resp[i].Error = e
+	}
+	b, _ := GetResponseBytes(resp, batch)
+	return b
+}
+
 // ServeHTTP provides basic JSON-RPC handling.
 func (mr *MethodRepository) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
@@ -98,6 +123,18 @@ func (mr *MethodRepository) InvokeMethod(c context.Context, r *Request) *Respons
 		return res
 	}
 
+	if mr.auth != nil {
+		if res.Error = mr.auth.Authenticate(r.Method, r.Params); res.Error != nil {
+			return res
+		}
+	}
+
+	if mr.limit != nil {
+		if res.Error = mr.limit.Allow(r.Method); res.Error != nil {
+			return res
+		}
+	}
+
 	if !noAPI {
 		// should check the API version
 		var p ApiSyncResult
@@ -2,6 +2,8 @@ package jsonrpc
 
 import (
 	"errors"
+
+	"github.com/intel-go/fastjson"
 )
 
 type (
@@ -11,12 +13,22 @@ type (
 		Verbose bool
 		api     string
 		ctx     interface{}
+		auth    Authenticator
+		limit   Limiter
 	}
 	// Metadata has method meta data.
 	Metadata struct {
 		Handler Handler
 		NoApi   bool
 	}
+	// Authenticator verifies a request before the method is invoked, a non nil error rejects it
+	Authenticator interface {
+		Authenticate(method string, params *fastjson.RawMessage) *Error
+	}
+	// Limiter admits a request after it is authenticated and before it is invoked, a non nil error rejects it
+	Limiter interface {
+		Allow(method string) *Error
+	}
 )
 
 // NewMethodRepository returns new MethodRepository.
@@ -26,6 +38,16 @@ func NewMethodRepository() *MethodRepository {
 	}
 }
 
+// SetAuthenticator sets the request verifier, nil disables the authentication
+func (mr *MethodRepository) SetAuthenticator(a Authenticator) {
+	mr.auth = a
+}
+
+// SetLimiter sets the request admission, nil disables the limit
+func (mr *MethodRepository) SetLimiter(l Limiter) {
+	mr.limit = l
+}
+
 // SetCtx set context, pass to each callback
 func (mr *MethodRepository) SetCtx(i interface{}) {
 	mr.ctx = i